@@ -15,6 +15,7 @@ import (
 	"github.com/dimitrije/nikode-api/internal/handlers"
 	"github.com/dimitrije/nikode-api/internal/hub"
 	authmw "github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/dimitrije/nikode-api/internal/services"
 	"github.com/m1z23r/drift/pkg/drift"
 	"github.com/m1z23r/drift/pkg/middleware"
@@ -39,33 +40,58 @@ func main() {
 	}
 
 	jwtService := services.NewJWTService(cfg.JWTSecret, cfg.JWTAccessExpiry, cfg.JWTRefreshExpiry)
+	signingKeyService := services.NewSigningKeyService(db, cfg.JWTSigningAlgorithm, cfg.JWTKeyRotationInterval, max(cfg.JWTAccessExpiry, cfg.JWTRefreshExpiry), cfg.JWTKeyEncryptionKey)
+	if err := signingKeyService.Refresh(ctx, jwtService); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
 	userService := services.NewUserService(db)
 	tokenService := services.NewTokenService(db)
 	workspaceService := services.NewWorkspaceService(db)
 	collectionService := services.NewCollectionService(db)
 	emailService := services.NewEmailService(cfg.SMTP)
+	magicLinkService := services.NewMagicLinkService(db, cfg.JWTSecret, cfg.MagicLinkTTL)
 	apiKeyService := services.NewAPIKeyService(db)
+	personalAccessTokenService := services.NewPersonalAccessTokenService(db)
+	twoFactorService := services.NewTwoFactorService(db)
+	ephemeralStore := services.NewPostgresEphemeralStore(db)
 	vaultService := services.NewVaultService(db)
 	openAPIService := services.NewOpenAPIService()
+	asyncAPIService := services.NewAsyncAPIService()
+	graphQLService := services.NewGraphQLService()
+	importService := services.NewImportService(
+		openAPIService,
+		asyncAPIService,
+		graphQLService,
+		services.NewPostmanService(),
+		services.NewInsomniaService(),
+		services.NewHARService(),
+	)
+	exportService := services.NewExportService()
 	templateService := services.NewTemplateService(db)
 
 	h := hub.NewHub()
 	go h.Run()
+	go apiKeyService.RunUsageLog()
 
-	authHandler := handlers.NewAuthHandler(cfg, userService, tokenService, jwtService)
+	authHandler := handlers.NewAuthHandler(cfg, userService, tokenService, jwtService, magicLinkService, emailService, twoFactorService, ephemeralStore, h)
 	userHandler := handlers.NewUserHandler(userService)
-	workspaceHandler := handlers.NewWorkspaceHandler(workspaceService, userService, emailService, h, cfg.BaseURL)
+	sessionHandler := handlers.NewSessionHandler(tokenService, h)
+	personalAccessTokenHandler := handlers.NewPersonalAccessTokenHandler(personalAccessTokenService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService)
+	workspaceHandler := handlers.NewWorkspaceHandler(workspaceService, userService, emailService, h, cfg.BaseURL, cfg.MagicLinkEnabled)
 	collectionHandler := handlers.NewCollectionHandler(collectionService, workspaceService, h)
+	importHandler := handlers.NewImportHandler(importService, collectionService, workspaceService, h)
+	exportHandler := handlers.NewExportHandler(exportService, collectionService, workspaceService)
 	inviteHandler := handlers.NewInviteHandler(workspaceService, h)
 	pingPongHandler := handlers.NewWebSocketHandler()
-	syncHandler := handlers.NewSyncHandler(h, workspaceService, userService, jwtService)
+	syncHandler := handlers.NewSyncHandler(h, workspaceService, userService, tokenService, jwtService)
 	apiKeyHandler := handlers.NewAPIKeyHandler(apiKeyService, workspaceService)
 	vaultHandler := handlers.NewVaultHandler(vaultService, workspaceService)
-	automationHandler := handlers.NewAutomationHandler(collectionService, openAPIService)
+	automationHandler := handlers.NewAutomationHandler(collectionService, importService, exportService, h)
 	templateHandler := handlers.NewTemplateHandler(templateService)
 	webhookHandler := handlers.NewWebhookHandler(h)
-	tunnelHandler := handlers.NewTunnelHandler(h, jwtService)
-	webhookWSHandler := handlers.NewWebhookWSHandler(h, jwtService)
+	tunnelHandler := handlers.NewTunnelHandler(h, tokenService, jwtService)
+	webhookWSHandler := handlers.NewWebhookWSHandler(h, tokenService, jwtService)
 
 	app := drift.New()
 
@@ -89,6 +115,7 @@ func main() {
 	})
 
 	app.Use(middleware.Recovery())
+	app.Use(authmw.RealIP(cfg.TrustedProxies))
 	app.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins: []string{"*"},
 		AllowMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
@@ -97,28 +124,64 @@ func main() {
 	}))
 	app.Use(middleware.BodyParser())
 
+	app.Get("/.well-known/jwks.json", authHandler.JWKS)
+
 	api := app.Group("/api/v1")
 
 	auth := api.Group("/auth")
 	auth.Get("/:provider/consent", authHandler.GetConsentURL)
 	auth.Get("/:provider/callback", authHandler.Callback)
 	auth.Post("/exchange", authHandler.ExchangeCode)
+	auth.Post("/2fa/verify", authHandler.VerifyTwoFactor)
 	auth.Post("/refresh", authHandler.RefreshToken)
 	auth.Post("/logout", authHandler.Logout)
+	auth.Post("/device/code", authHandler.RequestDeviceCode)
+	auth.Post("/device/token", authHandler.DeviceToken)
 
-	protected := api.Group("")
-	protected.Use(authmw.Auth(jwtService))
+	api.Get("/device", authHandler.DevicePage)
+	api.Get("/device/:provider", authHandler.DeviceLogin)
+	api.Post("/device/2fa", authHandler.DeviceTwoFactor)
+	api.Post("/device/approve", authHandler.ApproveDevice)
 
-	protected.Post("/auth/logout-all", authHandler.LogoutAll)
+	api.Post("/magic-link", authHandler.RequestMagicLink)
+	api.Get("/magic-link/verify", authHandler.MagicLinkPage)
+	api.Post("/magic-link/verify", authHandler.MagicLinkCallback)
+
+	sso := api.Group("/saml")
+	sso.Get("/:provider/metadata", authHandler.SAMLMetadata)
+	sso.Get("/:provider/consent", authHandler.SAMLConsentURL)
+	sso.Post("/:provider/acs", authHandler.SAMLACS)
+
+	protected := api.Group("")
+	protected.Use(authmw.AuthWithPersonalAccessTokens(jwtService, personalAccessTokenService))
 
 	protected.Get("/users/me", userHandler.GetMe)
 	protected.Patch("/users/me", userHandler.UpdateMe)
 
+	// Account and workspace administration need a signed-in session, not a
+	// personal access token
+	account := protected.Group("")
+	account.Use(authmw.RequireSession())
+	account.Post("/auth/logout-all", authHandler.LogoutAll)
+	account.Get("/users/me/identities", userHandler.ListIdentities)
+	account.Get("/users/me/identities/:provider/consent", authHandler.LinkConsentURL)
+	account.Delete("/users/me/identities/:identityId", userHandler.UnlinkIdentity)
+	account.Get("/users/me/sessions", sessionHandler.List)
+	account.Delete("/users/me/sessions/:sessionId", sessionHandler.Revoke)
+	account.Get("/users/me/tokens", personalAccessTokenHandler.List)
+	account.Post("/users/me/tokens", personalAccessTokenHandler.Create)
+	account.Delete("/users/me/tokens/:tokenId", personalAccessTokenHandler.Revoke)
+	account.Get("/users/me/2fa", twoFactorHandler.Status)
+	account.Post("/users/me/2fa/totp", twoFactorHandler.BeginEnrollment)
+	account.Post("/users/me/2fa/totp/confirm", twoFactorHandler.ConfirmEnrollment)
+	account.Post("/users/me/2fa/recovery-codes", twoFactorHandler.RegenerateRecoveryCodes)
+	account.Post("/users/me/2fa/disable", twoFactorHandler.Disable)
+
 	protected.Get("/workspaces", workspaceHandler.List)
 	protected.Post("/workspaces", workspaceHandler.Create)
 	protected.Get("/workspaces/:workspaceId", workspaceHandler.Get)
-	protected.Patch("/workspaces/:workspaceId", workspaceHandler.Update)
-	protected.Delete("/workspaces/:workspaceId", workspaceHandler.Delete)
+	account.Patch("/workspaces/:workspaceId", workspaceHandler.Update)
+	account.Delete("/workspaces/:workspaceId", workspaceHandler.Delete)
 	protected.Get("/workspaces/:workspaceId/members", workspaceHandler.GetMembers)
 	protected.Post("/workspaces/:workspaceId/members", workspaceHandler.InviteMember)
 	protected.Delete("/workspaces/:workspaceId/members/:memberId", workspaceHandler.RemoveMember)
@@ -132,14 +195,19 @@ func main() {
 
 	protected.Get("/workspaces/:workspaceId/collections", collectionHandler.List)
 	protected.Post("/workspaces/:workspaceId/collections", collectionHandler.Create)
+	protected.Post("/workspaces/:workspaceId/collections/import", importHandler.Import)
 	protected.Get("/workspaces/:workspaceId/collections/:collectionId", collectionHandler.Get)
 	protected.Patch("/workspaces/:workspaceId/collections/:collectionId", collectionHandler.Update)
 	protected.Delete("/workspaces/:workspaceId/collections/:collectionId", collectionHandler.Delete)
+	protected.Get("/workspaces/:workspaceId/collections/:collectionId/export", exportHandler.Export)
 
-	// API Key management (owner only)
-	protected.Post("/workspaces/:workspaceId/api-keys", apiKeyHandler.Create)
+	// API Key management (owner only); changing keys needs a signed-in session
+	account.Post("/workspaces/:workspaceId/api-keys", apiKeyHandler.Create)
 	protected.Get("/workspaces/:workspaceId/api-keys", apiKeyHandler.List)
-	protected.Delete("/workspaces/:workspaceId/api-keys/:keyId", apiKeyHandler.Revoke)
+	account.Patch("/workspaces/:workspaceId/api-keys/:keyId", apiKeyHandler.Update)
+	account.Delete("/workspaces/:workspaceId/api-keys/:keyId", apiKeyHandler.Revoke)
+	protected.Get("/workspaces/:workspaceId/api-keys/:keyId/usage", apiKeyHandler.Usage)
+	account.Post("/workspaces/:workspaceId/api-keys/:keyId/rotate", apiKeyHandler.Rotate)
 
 	// Vault (zero-knowledge encrypted vault per workspace)
 	protected.Post("/workspaces/:workspaceId/vault", vaultHandler.CreateVault)
@@ -150,10 +218,28 @@ func main() {
 	protected.Patch("/workspaces/:workspaceId/vault/items/:itemId", vaultHandler.UpdateItem)
 	protected.Delete("/workspaces/:workspaceId/vault/items/:itemId", vaultHandler.DeleteItem)
 
-	// Automation endpoints (API key auth)
-	automation := api.Group("/automation")
-	automation.Use(authmw.APIKeyAuth(apiKeyService))
-	automation.Put("/collections", automationHandler.UpsertCollection)
+	// Automation endpoints (API key auth, grouped by required scope)
+	automationRead := api.Group("/automation")
+	automationRead.Use(authmw.APIKeyAuth(apiKeyService, models.APIKeyScopeCollectionsRead))
+	automationRead.Get("/collections", automationHandler.ListCollections)
+	automationRead.Get("/collections/:collectionId", automationHandler.GetCollection)
+	automationRead.Get("/collections/:collectionId/environment", automationHandler.GetEnvironment)
+	automationRead.Get("/collections/:collectionId/export", automationHandler.ExportCollection)
+
+	automationWrite := api.Group("/automation")
+	automationWrite.Use(authmw.APIKeyAuth(apiKeyService, models.APIKeyScopeCollectionsWrite))
+	automationWrite.Put("/collections", automationHandler.UpsertCollection)
+	automationWrite.Put("/collections/batch", automationHandler.UpsertCollections)
+
+	automationVault := api.Group("/automation")
+	automationVault.Use(authmw.APIKeyAuth(apiKeyService, models.APIKeyScopeVaultReadCiphertext))
+	automationVault.Get("/vault", vaultHandler.GetVaultForAPIKey)
+	automationVault.Get("/vault/items", vaultHandler.ListItemsForAPIKey)
+
+	automationTemplates := api.Group("/automation")
+	automationTemplates.Use(authmw.APIKeyAuth(apiKeyService, models.APIKeyScopeTemplatesPublish))
+	automationTemplates.Use(authmw.APIKeyCreatorSuperAdmin(userService))
+	automationTemplates.Post("/templates", templateHandler.Create)
 
 	api.Get("/health", func(c *drift.Context) {
 		_ = c.JSON(200, map[string]string{"status": "ok"})
@@ -184,6 +270,22 @@ func main() {
 		ticker := time.NewTicker(1 * time.Hour)
 		for range ticker.C {
 			_ = tokenService.CleanupExpired(context.Background())
+			_ = apiKeyService.SendExpiryNotices(context.Background(), emailService)
+			_ = apiKeyService.CleanupUsage(context.Background())
+			_ = apiKeyService.CleanupExpired(context.Background())
+			_ = signingKeyService.CleanupExpired(context.Background())
+			_ = ephemeralStore.CleanupExpired(context.Background())
+		}
+	}()
+
+	// Rotation is checked often so every instance picks up a key another
+	// instance added well before the tokens it signs reach them
+	go func() {
+		ticker := time.NewTicker(1 * time.Minute)
+		for range ticker.C {
+			if err := signingKeyService.Refresh(context.Background(), jwtService); err != nil {
+				log.Printf("Failed to refresh signing keys: %v", err)
+			}
 		}
 	}()
 
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
+	"net/netip"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -16,14 +20,44 @@ type Config struct {
 	JWTAccessExpiry  time.Duration
 	JWTRefreshExpiry time.Duration
 
+	// JWTSigningAlgorithm is EdDSA or RS256. The signing key is replaced
+	// every JWTKeyRotationInterval.
+	JWTSigningAlgorithm    string
+	JWTKeyRotationInterval time.Duration
+	// JWTKeyEncryptionKey encrypts the signing keys in the database. It
+	// defaults to JWTSecret.
+	JWTKeyEncryptionKey string
+
 	FrontendCallbackURL string
 	BaseURL             string
 
+	// TrustedProxies are the proxies whose X-Forwarded-For headers are
+	// believed when resolving client addresses
+	TrustedProxies []netip.Prefix
+
 	GitHub OAuthConfig
 	GitLab OAuthConfig
 	Google OAuthConfig
 
+	// GitHubInstances and GitLabInstances are further named instances, such
+	// as GitHub Enterprise or self-hosted GitLab servers
+	GitHubInstances []OAuthConfig
+	GitLabInstances []OAuthConfig
+
+	// OIDC lists the generic OpenID Connect providers, keyed by name in the
+	// /auth/:provider routes
+	OIDC []OIDCConfig
+
+	// SAML lists the SAML 2.0 identity providers, keyed by name in the
+	// /saml/:provider routes
+	SAML []SAMLConfig
+
 	SMTP SMTPConfig
+
+	// MagicLinkEnabled turns on passwordless sign-in with links sent by
+	// email. Links expire after MagicLinkTTL.
+	MagicLinkEnabled bool
+	MagicLinkTTL     time.Duration
 }
 
 type SMTPConfig struct {
@@ -38,8 +72,53 @@ type OAuthConfig struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURL  string
+	// Name overrides the provider name of a named instance
+	Name string
+	// BaseURL is the server the provider runs on, used for the authorize and
+	// token endpoints; empty means the public service. APIURL overrides the
+	// API URL derived from it.
+	BaseURL string
+	APIURL  string
+}
+
+// OIDCConfig configures a generic OpenID Connect provider, named by the
+// embedded OAuthConfig's Name. Endpoints and signing keys are read from
+// DiscoveryURL.
+type OIDCConfig struct {
+	OAuthConfig
+	DiscoveryURL string
+	Scopes       []string
+	// EmailClaim, NameClaim and AvatarClaim name the ID token claims mapped
+	// onto the user. Dotted names reach into nested claims.
+	EmailClaim  string
+	NameClaim   string
+	AvatarClaim string
 }
 
+// SAMLConfig configures a SAML 2.0 identity provider. The IdP's entity ID,
+// single sign-on URL and signing certificates are read from IdPMetadata,
+// which is a URL or a file path.
+type SAMLConfig struct {
+	Name        string
+	IdPMetadata string
+	// EntityID identifies this service provider to the IdP; it defaults to
+	// the metadata URL
+	EntityID string
+	// EmailAttribute, NameAttribute and AvatarAttribute name the assertion
+	// attributes mapped onto the user, by Name or FriendlyName
+	EmailAttribute  string
+	NameAttribute   string
+	AvatarAttribute string
+	// AllowIdPInitiated accepts responses the IdP sends without a request
+	// from us, such as logins started from an IdP dashboard
+	AllowIdPInitiated bool
+}
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// reservedProviderNames are taken by the built-in providers
+var reservedProviderNames = map[string]bool{"github": true, "gitlab": true, "google": true, "email": true}
+
 func Load() (*Config, error) {
 	_ = godotenv.Load()
 
@@ -53,6 +132,58 @@ func Load() (*Config, error) {
 		refreshExpiry = 168 * time.Hour
 	}
 
+	signingAlgorithm := getEnv("JWT_SIGNING_ALG", "EdDSA")
+	if signingAlgorithm != "EdDSA" && signingAlgorithm != "RS256" {
+		return nil, fmt.Errorf("invalid JWT_SIGNING_ALG %q, expected EdDSA or RS256", signingAlgorithm)
+	}
+
+	keyRotationInterval, err := time.ParseDuration(getEnv("JWT_KEY_ROTATION_INTERVAL", "720h"))
+	if err != nil || keyRotationInterval <= 0 {
+		return nil, fmt.Errorf("invalid JWT_KEY_ROTATION_INTERVAL %q", getEnv("JWT_KEY_ROTATION_INTERVAL", ""))
+	}
+
+	seen := make(map[string]bool)
+	githubInstances, err := loadInstances("GITHUB", seen)
+	if err != nil {
+		return nil, err
+	}
+	gitlabInstances, err := loadInstances("GITLAB", seen)
+	if err != nil {
+		return nil, err
+	}
+	oidc, err := loadOIDC(seen)
+	if err != nil {
+		return nil, err
+	}
+	saml, err := loadSAML(seen)
+	if err != nil {
+		return nil, err
+	}
+
+	trustedProxies, err := parseTrustedProxies(getEnv("TRUSTED_PROXIES", ""))
+	if err != nil {
+		return nil, err
+	}
+
+	magicLinkTTL, err := time.ParseDuration(getEnv("MAGIC_LINK_TTL", "15m"))
+	if err != nil || magicLinkTTL <= 0 {
+		return nil, fmt.Errorf("invalid MAGIC_LINK_TTL %q", getEnv("MAGIC_LINK_TTL", ""))
+	}
+
+	smtp := SMTPConfig{
+		Host:     getEnv("SMTP_HOST", ""),
+		Port:     getEnv("SMTP_PORT", "587"),
+		Username: getEnv("SMTP_USERNAME", ""),
+		Password: getEnv("SMTP_PASSWORD", ""),
+		From:     getEnv("SMTP_FROM", ""),
+	}
+
+	// Sign-in links are only useful if they can be delivered
+	magicLinkEnabled := getEnv("MAGIC_LINK_ENABLED", "false") == "true"
+	if magicLinkEnabled && (smtp.Host == "" || smtp.Username == "" || smtp.Password == "" || smtp.From == "") {
+		return nil, fmt.Errorf("MAGIC_LINK_ENABLED requires SMTP_HOST, SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM")
+	}
+
 	return &Config{
 		Port:        getEnv("PORT", "8080"),
 		Env:         getEnv("ENV", "development"),
@@ -62,18 +193,28 @@ func Load() (*Config, error) {
 		JWTAccessExpiry:  accessExpiry,
 		JWTRefreshExpiry: refreshExpiry,
 
+		JWTSigningAlgorithm:    signingAlgorithm,
+		JWTKeyRotationInterval: keyRotationInterval,
+		JWTKeyEncryptionKey:    getEnv("JWT_KEY_ENCRYPTION_KEY", os.Getenv("JWT_SECRET")),
+
 		FrontendCallbackURL: getEnv("FRONTEND_CALLBACK_URL", "nikode://auth/callback"),
 		BaseURL:             getEnv("BASE_URL", "http://localhost:8080"),
 
+		TrustedProxies: trustedProxies,
+
 		GitHub: OAuthConfig{
 			ClientID:     getEnv("GITHUB_CLIENT_ID", ""),
 			ClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
 			RedirectURL:  getEnv("GITHUB_REDIRECT_URL", ""),
+			BaseURL:      getEnv("GITHUB_BASE_URL", ""),
+			APIURL:       getEnv("GITHUB_API_URL", ""),
 		},
 		GitLab: OAuthConfig{
 			ClientID:     getEnv("GITLAB_CLIENT_ID", ""),
 			ClientSecret: getEnv("GITLAB_CLIENT_SECRET", ""),
 			RedirectURL:  getEnv("GITLAB_REDIRECT_URL", ""),
+			BaseURL:      getEnv("GITLAB_BASE_URL", ""),
+			APIURL:       getEnv("GITLAB_API_URL", ""),
 		},
 		Google: OAuthConfig{
 			ClientID:     getEnv("GOOGLE_CLIENT_ID", ""),
@@ -81,16 +222,160 @@ func Load() (*Config, error) {
 			RedirectURL:  getEnv("GOOGLE_REDIRECT_URL", ""),
 		},
 
-		SMTP: SMTPConfig{
-			Host:     getEnv("SMTP_HOST", ""),
-			Port:     getEnv("SMTP_PORT", "587"),
-			Username: getEnv("SMTP_USERNAME", ""),
-			Password: getEnv("SMTP_PASSWORD", ""),
-			From:     getEnv("SMTP_FROM", ""),
-		},
+		GitHubInstances: githubInstances,
+		GitLabInstances: gitlabInstances,
+
+		OIDC: oidc,
+		SAML: saml,
+
+		SMTP: smtp,
+
+		MagicLinkEnabled: magicLinkEnabled,
+		MagicLinkTTL:     magicLinkTTL,
 	}, nil
 }
 
+// parseTrustedProxies parses a comma separated list of addresses and CIDR
+// ranges.
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(entry); err == nil {
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// loadInstances reads the named instances listed in <kind>_INSTANCES, each
+// configured by <kind>_<NAME>_CLIENT_ID, _CLIENT_SECRET, _REDIRECT_URL,
+// _BASE_URL and _API_URL.
+func loadInstances(kind string, seen map[string]bool) ([]OAuthConfig, error) {
+	names, err := providerNames(kind+"_INSTANCES", seen)
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []OAuthConfig
+	for _, name := range names {
+		prefix := envPrefix(kind, name)
+		cfg := OAuthConfig{
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Name:         name,
+			BaseURL:      getEnv(prefix+"BASE_URL", ""),
+			APIURL:       getEnv(prefix+"API_URL", ""),
+		}
+		if cfg.ClientID == "" {
+			return nil, fmt.Errorf("%s instance %q needs %sCLIENT_ID", kind, name, prefix)
+		}
+		instances = append(instances, cfg)
+	}
+	return instances, nil
+}
+
+// loadOIDC reads the providers named in OIDC_PROVIDERS (comma separated).
+// Each provider is configured by OIDC_<NAME>_* variables.
+func loadOIDC(seen map[string]bool) ([]OIDCConfig, error) {
+	names, err := providerNames("OIDC_PROVIDERS", seen)
+	if err != nil {
+		return nil, err
+	}
+
+	var providers []OIDCConfig
+	for _, name := range names {
+		prefix := envPrefix("OIDC", name)
+		cfg := OIDCConfig{
+			OAuthConfig: OAuthConfig{
+				ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+				ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+				RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+				Name:         name,
+			},
+			DiscoveryURL: getEnv(prefix+"DISCOVERY_URL", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+			EmailClaim:   getEnv(prefix+"EMAIL_CLAIM", "email"),
+			NameClaim:    getEnv(prefix+"NAME_CLAIM", "name"),
+			AvatarClaim:  getEnv(prefix+"AVATAR_CLAIM", "picture"),
+		}
+		if cfg.DiscoveryURL == "" || cfg.ClientID == "" {
+			return nil, fmt.Errorf("OIDC provider %q needs %sDISCOVERY_URL and %sCLIENT_ID", name, prefix, prefix)
+		}
+		providers = append(providers, cfg)
+	}
+	return providers, nil
+}
+
+// loadSAML reads the identity providers named in SAML_PROVIDERS, configured
+// by SAML_<NAME>_* variables like the OIDC providers.
+func loadSAML(seen map[string]bool) ([]SAMLConfig, error) {
+	names, err := providerNames("SAML_PROVIDERS", seen)
+	if err != nil {
+		return nil, err
+	}
+
+	var providers []SAMLConfig
+	for _, name := range names {
+		prefix := envPrefix("SAML", name)
+		cfg := SAMLConfig{
+			Name:              name,
+			IdPMetadata:       getEnv(prefix+"IDP_METADATA", ""),
+			EntityID:          getEnv(prefix+"ENTITY_ID", ""),
+			EmailAttribute:    getEnv(prefix+"EMAIL_ATTRIBUTE", "email"),
+			NameAttribute:     getEnv(prefix+"NAME_ATTRIBUTE", "displayName"),
+			AvatarAttribute:   getEnv(prefix+"AVATAR_ATTRIBUTE", ""),
+			AllowIdPInitiated: getEnv(prefix+"ALLOW_IDP_INITIATED", "false") == "true",
+		}
+		if cfg.IdPMetadata == "" {
+			return nil, fmt.Errorf("SAML provider %q needs %sIDP_METADATA", name, prefix)
+		}
+		providers = append(providers, cfg)
+	}
+	return providers, nil
+}
+
+// providerNames parses a comma separated list of provider names. Names must
+// be unique across all provider kinds since they share the users table.
+func providerNames(variable string, seen map[string]bool) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(getEnv(variable, ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !providerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid provider name %q in %s", name, variable)
+		}
+		if reservedProviderNames[name] {
+			return nil, fmt.Errorf("provider name %q in %s is reserved", name, variable)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate provider name %q", name)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// envPrefix returns the variable prefix of a named provider, with the name
+// upper cased and dashes replaced by underscores.
+func envPrefix(kind, name string) string {
+	return kind + "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+}
+
 func (c *Config) IsProduction() bool {
 	return c.Env == "production"
 }
@@ -221,6 +221,192 @@ var migrations = []string{
 
 	// Migration: Add global_role column to users table
 	`ALTER TABLE users ADD COLUMN IF NOT EXISTS global_role VARCHAR(50) NOT NULL DEFAULT 'user'`,
+
+	// Migration: Scoped API keys. Existing keys keep read and write access
+	// to every collection in their workspace
+	`ALTER TABLE workspace_api_keys ADD COLUMN IF NOT EXISTS scopes TEXT[] NOT NULL DEFAULT ARRAY['collections:read', 'collections:write']`,
+	`ALTER TABLE workspace_api_keys ADD COLUMN IF NOT EXISTS collection_ids UUID[] NOT NULL DEFAULT '{}'`,
+	`ALTER TABLE workspace_api_keys ADD COLUMN IF NOT EXISTS allowed_cidrs TEXT[] NOT NULL DEFAULT '{}'`,
+
+	// Migration: API key rotation and expiry notices
+	`ALTER TABLE workspace_api_keys ADD COLUMN IF NOT EXISTS replaced_by UUID REFERENCES workspace_api_keys(id) ON DELETE SET NULL`,
+	`ALTER TABLE workspace_api_keys ADD COLUMN IF NOT EXISTS expiry_notified_at TIMESTAMP WITH TIME ZONE`,
+
+	// Migration: API key rate limits and usage log
+	`ALTER TABLE workspace_api_keys ADD COLUMN IF NOT EXISTS rate_limit_per_minute INTEGER NOT NULL DEFAULT 120`,
+	`ALTER TABLE workspace_api_keys ADD COLUMN IF NOT EXISTS rate_limit_burst INTEGER NOT NULL DEFAULT 60`,
+
+	`CREATE TABLE IF NOT EXISTS api_key_usage (
+		id BIGSERIAL PRIMARY KEY,
+		api_key_id UUID NOT NULL REFERENCES workspace_api_keys(id) ON DELETE CASCADE,
+		method VARCHAR(10) NOT NULL,
+		path TEXT NOT NULL,
+		status INTEGER NOT NULL,
+		ip VARCHAR(64) NOT NULL,
+		latency_ms INTEGER NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+	)`,
+
+	`CREATE INDEX IF NOT EXISTS idx_api_key_usage_api_key_id ON api_key_usage(api_key_id, id DESC)`,
+
+	// Migration: Record API keys as the actor of automation writes
+	`ALTER TABLE collections ADD COLUMN IF NOT EXISTS updated_by_api_key UUID REFERENCES workspace_api_keys(id) ON DELETE SET NULL`,
+	`ALTER TABLE collections ADD COLUMN IF NOT EXISTS updated_by_api_key_name VARCHAR(255)`,
+
+	// Migration: Linked sign-in identities. users.provider keeps the identity
+	// the profile is synced from; existing users get it as their first
+	// identity. Their emails were never checked for verification, so they
+	// start unverified and take the provider's flag on the next sign-in
+	`CREATE TABLE IF NOT EXISTS user_identities (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		provider VARCHAR(50) NOT NULL,
+		provider_id VARCHAR(255) NOT NULL,
+		email VARCHAR(255) NOT NULL,
+		email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+		last_used_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+		UNIQUE(provider, provider_id)
+	)`,
+
+	`CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id)`,
+
+	`INSERT INTO user_identities (user_id, provider, provider_id, email, email_verified, created_at)
+		SELECT id, provider, provider_id, email, FALSE, created_at FROM users
+		ON CONFLICT (provider, provider_id) DO NOTHING`,
+
+	// Migration: Passwordless sign-in links and invites for people without
+	// an account yet
+	`CREATE TABLE IF NOT EXISTS magic_link_tokens (
+		token_hash VARCHAR(255) PRIMARY KEY,
+		email VARCHAR(255) NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+	)`,
+
+	`CREATE INDEX IF NOT EXISTS idx_magic_link_tokens_expires_at ON magic_link_tokens(expires_at)`,
+
+	`CREATE TABLE IF NOT EXISTS workspace_email_invites (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		workspace_id UUID NOT NULL REFERENCES workspaces(id) ON DELETE CASCADE,
+		inviter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		email VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+		UNIQUE(workspace_id, email)
+	)`,
+
+	`CREATE INDEX IF NOT EXISTS idx_workspace_email_invites_email ON workspace_email_invites(email)`,
+
+	// Migration: Sessions group the refresh tokens of one signed-in device.
+	// Existing refresh tokens each become their own session
+	`CREATE TABLE IF NOT EXISTS sessions (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		device_name VARCHAR(255) NOT NULL DEFAULT '',
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip_address VARCHAR(45) NOT NULL DEFAULT '',
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+		last_used_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+	)`,
+
+	`CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id)`,
+
+	`ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_id UUID REFERENCES sessions(id) ON DELETE CASCADE`,
+
+	`INSERT INTO sessions (id, user_id, created_at, last_used_at)
+		SELECT id, user_id, created_at, created_at FROM refresh_tokens WHERE session_id IS NULL
+		ON CONFLICT (id) DO NOTHING`,
+
+	`UPDATE refresh_tokens SET session_id = id WHERE session_id IS NULL`,
+
+	`ALTER TABLE refresh_tokens ALTER COLUMN session_id SET NOT NULL`,
+
+	`CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id)`,
+
+	// Migration: Rotated refresh tokens are kept, marked used, until they
+	// expire so a replayed token can be recognised
+	`ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS used_at TIMESTAMP WITH TIME ZONE`,
+
+	// Migration: Token signing keys. The key without expires_at signs new
+	// tokens; replaced keys verify until their tokens have expired
+	`CREATE TABLE IF NOT EXISTS signing_keys (
+		id VARCHAR(64) PRIMARY KEY,
+		algorithm VARCHAR(16) NOT NULL,
+		private_key BYTEA NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+		expires_at TIMESTAMP WITH TIME ZONE
+	)`,
+
+	// Migration: Personal access tokens (user-level API tokens)
+	`CREATE TABLE IF NOT EXISTS personal_access_tokens (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(255) NOT NULL,
+		token_hash VARCHAR(255) NOT NULL UNIQUE,
+		token_prefix VARCHAR(20) NOT NULL,
+		scopes TEXT[] NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE,
+		last_used_at TIMESTAMP WITH TIME ZONE,
+		revoked_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens(user_id)`,
+
+	// Migration: TOTP two-factor authentication. A secret without
+	// enabled_at is an enrollment waiting for its first code
+	`CREATE TABLE IF NOT EXISTS user_totp (
+		user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+		secret VARCHAR(64) NOT NULL,
+		enabled_at TIMESTAMP WITH TIME ZONE,
+		last_used_step BIGINT NOT NULL DEFAULT 0,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+	)`,
+
+	`CREATE TABLE IF NOT EXISTS user_recovery_codes (
+		id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+		user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		code_hash VARCHAR(255) NOT NULL,
+		used_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+	)`,
+
+	`CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id)`,
+
+	`ALTER TABLE workspaces ADD COLUMN IF NOT EXISTS require_2fa BOOLEAN NOT NULL DEFAULT FALSE`,
+
+	// Migration: short-lived values shared between instances, such as OAuth
+	// states and auth codes
+	`CREATE TABLE IF NOT EXISTS ephemeral_values (
+		key VARCHAR(255) PRIMARY KEY,
+		value BYTEA NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+	)`,
+
+	`CREATE INDEX IF NOT EXISTS idx_ephemeral_values_expires_at ON ephemeral_values(expires_at)`,
+
+	// Migration: Emails are looked up ignoring case. The index only enforces
+	// uniqueness when no existing accounts differ by case alone; those have
+	// to be merged by hand first
+	`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM users GROUP BY lower(email) HAVING COUNT(*) > 1) THEN
+			IF EXISTS (
+				SELECT 1 FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+				WHERE c.relname = 'idx_users_email_lower' AND NOT i.indisunique
+			) THEN
+				DROP INDEX idx_users_email_lower;
+			END IF;
+			CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email));
+		ELSE
+			RAISE WARNING 'users differ only by email case; idx_users_email_lower is not unique';
+			CREATE INDEX IF NOT EXISTS idx_users_email_lower ON users(lower(email));
+		END IF;
+	END $$`,
+
+	// Migration: Signing keys are encrypted at rest. Keys stored before are
+	// encrypted when the service next loads them
+	`ALTER TABLE signing_keys ADD COLUMN IF NOT EXISTS encrypted BOOLEAN NOT NULL DEFAULT FALSE`,
 }
 
 func (db *DB) Migrate(ctx context.Context) error {
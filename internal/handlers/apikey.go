@@ -2,10 +2,17 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
 	"github.com/dimitrije/nikode-api/pkg/dto"
 	"github.com/google/uuid"
 	"github.com/m1z23r/drift/pkg/drift"
@@ -58,25 +65,54 @@ func (h *APIKeyHandler) Create(c *drift.Context) {
 		return
 	}
 
-	apiKey, plainKey, err := h.apiKeyService.Create(context.Background(), workspaceID, req.Name, userID, req.ExpiresAt)
+	scopes, err := services.NormalizeAPIKeyScopes(req.Scopes)
 	if err != nil {
-		c.InternalServerError("failed to create api key")
+		c.BadRequest(err.Error() + ", expected one of: " + strings.Join(models.APIKeyScopes, ", "))
 		return
 	}
 
-	response := dto.APIKeyCreatedResponse{
-		ID:        apiKey.ID,
-		Name:      apiKey.Name,
-		Key:       plainKey,
-		KeyPrefix: apiKey.KeyPrefix,
-		CreatedAt: apiKey.CreatedAt.Format(time.RFC3339),
-	}
-	if apiKey.ExpiresAt != nil {
-		formatted := apiKey.ExpiresAt.Format(time.RFC3339)
-		response.ExpiresAt = &formatted
+	// Publishing templates is a super admin action, so only super admins can
+	// hand it to a key
+	if slices.Contains(scopes, models.APIKeyScopeTemplatesPublish) && middleware.GetUserGlobalRole(c) != models.GlobalRoleSuperAdmin {
+		c.Forbidden("only super admins can create keys with the " + models.APIKeyScopeTemplatesPublish + " scope")
+		return
+	}
+
+	allowedCIDRs, err := services.NormalizeAPIKeyCIDRs(req.AllowedCIDRs)
+	if err != nil {
+		c.BadRequest(err.Error())
+		return
+	}
+
+	restrictions := services.APIKeyRestrictions{
+		Scopes:        scopes,
+		CollectionIDs: req.CollectionIDs,
+		AllowedCIDRs:  allowedCIDRs,
+	}
+	if req.RateLimitPerMinute != nil {
+		restrictions.RateLimitPerMinute = *req.RateLimitPerMinute
+	}
+	if req.RateLimitBurst != nil {
+		restrictions.RateLimitBurst = *req.RateLimitBurst
+	}
+	if req.RateLimitPerMinute != nil || req.RateLimitBurst != nil {
+		if msg := validateRateLimit(restrictions.RateLimitPerMinute, restrictions.RateLimitBurst); msg != "" {
+			c.BadRequest(msg)
+			return
+		}
 	}
 
-	_ = c.JSON(201, response)
+	apiKey, plainKey, err := h.apiKeyService.Create(context.Background(), workspaceID, req.Name, userID, req.ExpiresAt, restrictions)
+	if err != nil {
+		if errors.Is(err, services.ErrAPIKeyCollectionNotInWorkspace) {
+			c.BadRequest("collection_ids must reference collections in this workspace")
+			return
+		}
+		c.InternalServerError("failed to create api key")
+		return
+	}
+
+	_ = c.JSON(201, apiKeyCreatedResponse(apiKey, plainKey))
 }
 
 func (h *APIKeyHandler) List(c *drift.Context) {
@@ -111,21 +147,7 @@ func (h *APIKeyHandler) List(c *drift.Context) {
 
 	var response []dto.APIKeyResponse
 	for _, k := range keys {
-		item := dto.APIKeyResponse{
-			ID:        k.ID,
-			Name:      k.Name,
-			KeyPrefix: k.KeyPrefix,
-			CreatedAt: k.CreatedAt.Format(time.RFC3339),
-		}
-		if k.ExpiresAt != nil {
-			formatted := k.ExpiresAt.Format(time.RFC3339)
-			item.ExpiresAt = &formatted
-		}
-		if k.LastUsedAt != nil {
-			formatted := k.LastUsedAt.Format(time.RFC3339)
-			item.LastUsedAt = &formatted
-		}
-		response = append(response, item)
+		response = append(response, apiKeyResponse(&k))
 	}
 
 	if response == nil {
@@ -173,3 +195,264 @@ func (h *APIKeyHandler) Revoke(c *drift.Context) {
 
 	_ = c.JSON(200, map[string]string{"message": "api key revoked"})
 }
+
+// Rotate issues a replacement for a key. The old key keeps working for the
+// grace period so pipelines can switch to the new secret.
+func (h *APIKeyHandler) Rotate(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	workspaceID, err := uuid.Parse(c.Param("workspaceId"))
+	if err != nil {
+		c.BadRequest("invalid workspace id")
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("keyId"))
+	if err != nil {
+		c.BadRequest("invalid key id")
+		return
+	}
+
+	// Only workspace owners can rotate API keys
+	isOwner, err := h.workspaceService.IsOwner(context.Background(), workspaceID, userID)
+	if err != nil {
+		c.InternalServerError("failed to check ownership")
+		return
+	}
+	if !isOwner {
+		c.Forbidden("only workspace owners can rotate api keys")
+		return
+	}
+
+	// The body is optional
+	var req dto.RotateAPIKeyRequest
+	if err := c.BindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.BadRequest("invalid request body")
+		return
+	}
+
+	gracePeriod := services.DefaultAPIKeyGracePeriod
+	if req.GracePeriodSeconds != nil {
+		gracePeriod = time.Duration(*req.GracePeriodSeconds) * time.Second
+		if *req.GracePeriodSeconds < 0 || gracePeriod > services.MaxAPIKeyGracePeriod {
+			c.BadRequest(fmt.Sprintf("grace_period_seconds must be between 0 and %d", int64(services.MaxAPIKeyGracePeriod.Seconds())))
+			return
+		}
+	}
+
+	rotation, err := h.apiKeyService.Rotate(context.Background(), keyID, workspaceID, userID, gracePeriod)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAPIKeyNotFound):
+			c.NotFound("api key not found")
+		case errors.Is(err, services.ErrAPIKeyRotated):
+			_ = c.JSON(409, map[string]string{
+				"error":   "api key already rotated",
+				"message": "rotate the key that replaced it instead",
+			})
+		default:
+			c.InternalServerError("failed to rotate api key")
+		}
+		return
+	}
+
+	_ = c.JSON(201, dto.RotateAPIKeyResponse{
+		Key:      apiKeyCreatedResponse(rotation.Key, rotation.PlainKey),
+		Previous: apiKeyResponse(rotation.Previous),
+	})
+}
+
+// Update changes the rate limit of a key. Omitted fields keep their value.
+func (h *APIKeyHandler) Update(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	workspaceID, err := uuid.Parse(c.Param("workspaceId"))
+	if err != nil {
+		c.BadRequest("invalid workspace id")
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("keyId"))
+	if err != nil {
+		c.BadRequest("invalid key id")
+		return
+	}
+
+	// Only workspace owners can update API keys
+	isOwner, err := h.workspaceService.IsOwner(context.Background(), workspaceID, userID)
+	if err != nil {
+		c.InternalServerError("failed to check ownership")
+		return
+	}
+	if !isOwner {
+		c.Forbidden("only workspace owners can update api keys")
+		return
+	}
+
+	var req dto.UpdateAPIKeyRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.BadRequest("invalid request body")
+		return
+	}
+
+	apiKey, err := h.apiKeyService.Get(context.Background(), keyID, workspaceID)
+	if err != nil {
+		c.NotFound("api key not found")
+		return
+	}
+
+	perMinute, burst := apiKey.RateLimitPerMinute, apiKey.RateLimitBurst
+	if req.RateLimitPerMinute != nil {
+		perMinute = *req.RateLimitPerMinute
+	}
+	if req.RateLimitBurst != nil {
+		burst = *req.RateLimitBurst
+	}
+	if msg := validateRateLimit(perMinute, burst); msg != "" {
+		c.BadRequest(msg)
+		return
+	}
+
+	updated, err := h.apiKeyService.UpdateRateLimit(context.Background(), keyID, workspaceID, perMinute, burst)
+	if err != nil {
+		c.NotFound("api key not found")
+		return
+	}
+
+	_ = c.JSON(200, apiKeyResponse(updated))
+}
+
+// Usage returns the most recent requests made with a key, newest first.
+func (h *APIKeyHandler) Usage(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	workspaceID, err := uuid.Parse(c.Param("workspaceId"))
+	if err != nil {
+		c.BadRequest("invalid workspace id")
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("keyId"))
+	if err != nil {
+		c.BadRequest("invalid key id")
+		return
+	}
+
+	limit := 100
+	if raw := c.QueryParam("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > services.MaxAPIKeyUsageEntries {
+			c.BadRequest(fmt.Sprintf("limit must be between 1 and %d", services.MaxAPIKeyUsageEntries))
+			return
+		}
+	}
+
+	// Only workspace owners can view API key usage
+	isOwner, err := h.workspaceService.IsOwner(context.Background(), workspaceID, userID)
+	if err != nil {
+		c.InternalServerError("failed to check ownership")
+		return
+	}
+	if !isOwner {
+		c.Forbidden("only workspace owners can view api key usage")
+		return
+	}
+
+	apiKey, err := h.apiKeyService.Get(context.Background(), keyID, workspaceID)
+	if err != nil {
+		c.NotFound("api key not found")
+		return
+	}
+
+	usage, err := h.apiKeyService.Usage(context.Background(), apiKey.ID, limit)
+	if err != nil {
+		c.InternalServerError("failed to get api key usage")
+		return
+	}
+
+	entries := make([]dto.APIKeyUsageEntry, len(usage))
+	for i, u := range usage {
+		entries[i] = dto.APIKeyUsageEntry{
+			Method:    u.Method,
+			Path:      u.Path,
+			Status:    u.Status,
+			IP:        u.IP,
+			LatencyMs: u.LatencyMs,
+			CreatedAt: u.CreatedAt.Format(time.RFC3339),
+		}
+	}
+
+	_ = c.JSON(200, dto.APIKeyUsageResponse{
+		KeyID:              apiKey.ID,
+		RateLimitPerMinute: apiKey.RateLimitPerMinute,
+		RateLimitBurst:     apiKey.RateLimitBurst,
+		Entries:            entries,
+	})
+}
+
+// validateRateLimit returns an error message for out of range limits.
+func validateRateLimit(perMinute, burst int) string {
+	if perMinute < 1 || perMinute > services.MaxAPIKeyRateLimitPerMinute {
+		return fmt.Sprintf("rate_limit_per_minute must be between 1 and %d", services.MaxAPIKeyRateLimitPerMinute)
+	}
+	if burst < 1 || burst > services.MaxAPIKeyRateLimitBurst {
+		return fmt.Sprintf("rate_limit_burst must be between 1 and %d", services.MaxAPIKeyRateLimitBurst)
+	}
+	return ""
+}
+
+func apiKeyResponse(k *models.WorkspaceAPIKey) dto.APIKeyResponse {
+	response := dto.APIKeyResponse{
+		ID:                 k.ID,
+		Name:               k.Name,
+		KeyPrefix:          k.KeyPrefix,
+		CreatedAt:          k.CreatedAt.Format(time.RFC3339),
+		Scopes:             k.Scopes,
+		CollectionIDs:      k.CollectionIDs,
+		AllowedCIDRs:       k.AllowedCIDRs,
+		ReplacedBy:         k.ReplacedBy,
+		RateLimitPerMinute: k.RateLimitPerMinute,
+		RateLimitBurst:     k.RateLimitBurst,
+	}
+	if k.ExpiresAt != nil {
+		formatted := k.ExpiresAt.Format(time.RFC3339)
+		response.ExpiresAt = &formatted
+	}
+	if k.LastUsedAt != nil {
+		formatted := k.LastUsedAt.Format(time.RFC3339)
+		response.LastUsedAt = &formatted
+	}
+	return response
+}
+
+func apiKeyCreatedResponse(k *models.WorkspaceAPIKey, plainKey string) dto.APIKeyCreatedResponse {
+	response := dto.APIKeyCreatedResponse{
+		ID:                 k.ID,
+		Name:               k.Name,
+		Key:                plainKey,
+		KeyPrefix:          k.KeyPrefix,
+		CreatedAt:          k.CreatedAt.Format(time.RFC3339),
+		Scopes:             k.Scopes,
+		CollectionIDs:      k.CollectionIDs,
+		AllowedCIDRs:       k.AllowedCIDRs,
+		RateLimitPerMinute: k.RateLimitPerMinute,
+		RateLimitBurst:     k.RateLimitBurst,
+	}
+	if k.ExpiresAt != nil {
+		formatted := k.ExpiresAt.Format(time.RFC3339)
+		response.ExpiresAt = &formatted
+	}
+	return response
+}
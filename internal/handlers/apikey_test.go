@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAPIKeyTest(t *testing.T) (*testutil.MockAPIKeyService, *testutil.MockWorkspaceService, *drift.Engine, *services.JWTService) {
+	t.Helper()
+	mockAPIKeyService := new(testutil.MockAPIKeyService)
+	mockWorkspaceService := new(testutil.MockWorkspaceService)
+	handler := NewAPIKeyHandler(mockAPIKeyService, mockWorkspaceService)
+	jwtSvc := services.NewJWTService("test-secret-key", 15*time.Minute, 24*time.Hour)
+
+	app := drift.New()
+	app.Use(middleware.Auth(jwtSvc))
+	app.Post("/workspaces/:workspaceId/api-keys", handler.Create)
+	app.Patch("/workspaces/:workspaceId/api-keys/:keyId", handler.Update)
+	app.Post("/workspaces/:workspaceId/api-keys/:keyId/rotate", handler.Rotate)
+	app.Get("/workspaces/:workspaceId/api-keys/:keyId/usage", handler.Usage)
+
+	return mockAPIKeyService, mockWorkspaceService, app, jwtSvc
+}
+
+func postAPIKeyRequest(t *testing.T, app *drift.Engine, token, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	return serveAPIKeyRequest(t, app, http.MethodPost, token, path, body)
+}
+
+func serveAPIKeyRequest(t *testing.T, app *drift.Engine, method, token, path string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var reader *bytes.Reader
+	if body == nil {
+		reader = bytes.NewReader(nil)
+	} else {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIKeyHandler_Create_Scopes(t *testing.T) {
+	mockAPIKeyService, mockWorkspaceService, app, jwtSvc := setupAPIKeyTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	token := generateTestToken(t, jwtSvc, userID, "owner@example.com")
+	mockWorkspaceService.On("IsOwner", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	restrictions := services.APIKeyRestrictions{
+		Scopes:       []string{models.APIKeyScopeCollectionsRead},
+		AllowedCIDRs: []string{"203.0.113.0/24"},
+	}
+	apiKey := &models.WorkspaceAPIKey{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		Name:         "CI",
+		KeyPrefix:    "nik_abc...",
+		CreatedAt:    time.Now(),
+		Scopes:       restrictions.Scopes,
+		AllowedCIDRs: restrictions.AllowedCIDRs,
+	}
+	mockAPIKeyService.On("Create", mock.Anything, workspaceID, "CI", userID, (*time.Time)(nil), restrictions).Return(apiKey, "nik_abc_secret", nil)
+
+	rec := postAPIKeyRequest(t, app, token, "/workspaces/"+workspaceID.String()+"/api-keys", map[string]any{
+		"name":          "CI",
+		"scopes":        []string{"collections:read"},
+		"allowed_cidrs": []string{"203.0.113.7/24"},
+	})
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var response dto.APIKeyCreatedResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "nik_abc_secret", response.Key)
+	assert.Equal(t, []string{"collections:read"}, response.Scopes)
+}
+
+func TestAPIKeyHandler_Create_InvalidScope(t *testing.T) {
+	mockAPIKeyService, mockWorkspaceService, app, jwtSvc := setupAPIKeyTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	mockWorkspaceService.On("IsOwner", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	rec := postAPIKeyRequest(t, app, generateTestToken(t, jwtSvc, userID, "owner@example.com"), "/workspaces/"+workspaceID.String()+"/api-keys", map[string]any{
+		"name":   "CI",
+		"scopes": []string{"collections:admin"},
+	})
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "collections:admin")
+	mockAPIKeyService.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAPIKeyHandler_Rotate(t *testing.T) {
+	mockAPIKeyService, mockWorkspaceService, app, jwtSvc := setupAPIKeyTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	keyID := uuid.New()
+	token := generateTestToken(t, jwtSvc, userID, "owner@example.com")
+	mockWorkspaceService.On("IsOwner", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	newKey := &models.WorkspaceAPIKey{ID: uuid.New(), WorkspaceID: workspaceID, Name: "CI", KeyPrefix: "nik_abc...", CreatedAt: time.Now(), Scopes: models.DefaultAPIKeyScopes}
+	lastUsed := time.Now().Add(-time.Minute)
+	graceEnd := time.Now().Add(time.Hour)
+	previous := &models.WorkspaceAPIKey{ID: keyID, WorkspaceID: workspaceID, Name: "CI", KeyPrefix: "nik_abc...", CreatedAt: time.Now().Add(-48 * time.Hour),
+		Scopes: models.DefaultAPIKeyScopes, LastUsedAt: &lastUsed, ExpiresAt: &graceEnd, ReplacedBy: &newKey.ID}
+	rotation := &services.APIKeyRotation{Key: newKey, PlainKey: "nik_abc_new", Previous: previous}
+
+	t.Run("default grace period", func(t *testing.T) {
+		mockAPIKeyService.On("Rotate", mock.Anything, keyID, workspaceID, userID, services.DefaultAPIKeyGracePeriod).Return(rotation, nil).Once()
+
+		rec := postAPIKeyRequest(t, app, token, "/workspaces/"+workspaceID.String()+"/api-keys/"+keyID.String()+"/rotate", nil)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		var response dto.RotateAPIKeyResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, "nik_abc_new", response.Key.Key)
+		assert.Equal(t, keyID, response.Previous.ID)
+		assert.Equal(t, &newKey.ID, response.Previous.ReplacedBy)
+		assert.NotNil(t, response.Previous.LastUsedAt)
+	})
+
+	t.Run("custom grace period", func(t *testing.T) {
+		mockAPIKeyService.On("Rotate", mock.Anything, keyID, workspaceID, userID, time.Hour).Return(rotation, nil).Once()
+
+		rec := postAPIKeyRequest(t, app, token, "/workspaces/"+workspaceID.String()+"/api-keys/"+keyID.String()+"/rotate", map[string]any{"grace_period_seconds": 3600})
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	t.Run("grace period too long", func(t *testing.T) {
+		rec := postAPIKeyRequest(t, app, token, "/workspaces/"+workspaceID.String()+"/api-keys/"+keyID.String()+"/rotate", map[string]any{"grace_period_seconds": 31 * 24 * 3600})
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("already rotated", func(t *testing.T) {
+		mockAPIKeyService.On("Rotate", mock.Anything, keyID, workspaceID, userID, time.Duration(0)).Return(nil, services.ErrAPIKeyRotated).Once()
+
+		rec := postAPIKeyRequest(t, app, token, "/workspaces/"+workspaceID.String()+"/api-keys/"+keyID.String()+"/rotate", map[string]any{"grace_period_seconds": 0})
+
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+}
+
+func TestAPIKeyHandler_Rotate_NotOwner(t *testing.T) {
+	mockAPIKeyService, mockWorkspaceService, app, jwtSvc := setupAPIKeyTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	mockWorkspaceService.On("IsOwner", mock.Anything, workspaceID, userID).Return(false, nil)
+
+	rec := postAPIKeyRequest(t, app, generateTestToken(t, jwtSvc, userID, "member@example.com"), "/workspaces/"+workspaceID.String()+"/api-keys/"+uuid.New().String()+"/rotate", nil)
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	mockAPIKeyService.AssertNotCalled(t, "Rotate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAPIKeyHandler_Update_RateLimit(t *testing.T) {
+	mockAPIKeyService, mockWorkspaceService, app, jwtSvc := setupAPIKeyTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	keyID := uuid.New()
+	token := generateTestToken(t, jwtSvc, userID, "owner@example.com")
+	path := "/workspaces/" + workspaceID.String() + "/api-keys/" + keyID.String()
+	mockWorkspaceService.On("IsOwner", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	apiKey := &models.WorkspaceAPIKey{ID: keyID, WorkspaceID: workspaceID, Name: "CI", RateLimitPerMinute: 120, RateLimitBurst: 60}
+	updated := *apiKey
+	updated.RateLimitPerMinute = 600
+	mockAPIKeyService.On("Get", mock.Anything, keyID, workspaceID).Return(apiKey, nil)
+	mockAPIKeyService.On("UpdateRateLimit", mock.Anything, keyID, workspaceID, 600, 60).Return(&updated, nil)
+
+	rec := serveAPIKeyRequest(t, app, http.MethodPatch, token, path, map[string]int{"rate_limit_per_minute": 600})
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response dto.APIKeyResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, 600, response.RateLimitPerMinute)
+	assert.Equal(t, 60, response.RateLimitBurst)
+
+	rec = serveAPIKeyRequest(t, app, http.MethodPatch, token, path, map[string]int{"rate_limit_burst": 0})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "rate_limit_burst")
+	mockAPIKeyService.AssertNumberOfCalls(t, "UpdateRateLimit", 1)
+}
+
+func TestAPIKeyHandler_Usage(t *testing.T) {
+	mockAPIKeyService, mockWorkspaceService, app, jwtSvc := setupAPIKeyTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	keyID := uuid.New()
+	token := generateTestToken(t, jwtSvc, userID, "owner@example.com")
+	path := "/workspaces/" + workspaceID.String() + "/api-keys/" + keyID.String() + "/usage"
+	mockWorkspaceService.On("IsOwner", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	apiKey := &models.WorkspaceAPIKey{ID: keyID, WorkspaceID: workspaceID, RateLimitPerMinute: 120, RateLimitBurst: 60}
+	mockAPIKeyService.On("Get", mock.Anything, keyID, workspaceID).Return(apiKey, nil)
+	mockAPIKeyService.On("Usage", mock.Anything, keyID, 10).Return([]models.APIKeyUsage{{
+		ID:        7,
+		APIKeyID:  keyID,
+		Method:    http.MethodPut,
+		Path:      "/api/v1/automation/collections",
+		Status:    http.StatusTooManyRequests,
+		IP:        "203.0.113.7",
+		LatencyMs: 3,
+		CreatedAt: time.Now(),
+	}}, nil)
+
+	rec := serveAPIKeyRequest(t, app, http.MethodGet, token, path+"?limit=10", nil)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response dto.APIKeyUsageResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, 120, response.RateLimitPerMinute)
+	require.Len(t, response.Entries, 1)
+	assert.Equal(t, http.StatusTooManyRequests, response.Entries[0].Status)
+	assert.Equal(t, "203.0.113.7", response.Entries[0].IP)
+
+	rec = serveAPIKeyRequest(t, app, http.MethodGet, token, path+"?limit=5000", nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAPIKeyHandler_Create_TemplatesPublishRequiresSuperAdmin(t *testing.T) {
+	mockAPIKeyService, mockWorkspaceService, app, jwtSvc := setupAPIKeyTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	mockWorkspaceService.On("IsOwner", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	rec := postAPIKeyRequest(t, app, generateTestToken(t, jwtSvc, userID, "owner@example.com"), "/workspaces/"+workspaceID.String()+"/api-keys", map[string]any{
+		"name":   "Publisher",
+		"scopes": []string{"templates:publish"},
+	})
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "super admin")
+	mockAPIKeyService.AssertNotCalled(t, "Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	pair, err := jwtSvc.GenerateTokenPair(userID, uuid.Nil, "owner@example.com", models.GlobalRoleSuperAdmin)
+	require.NoError(t, err)
+	restrictions := services.APIKeyRestrictions{Scopes: []string{models.APIKeyScopeTemplatesPublish}, AllowedCIDRs: []string{}}
+	apiKey := &models.WorkspaceAPIKey{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Publisher", KeyPrefix: "nik_abc...", CreatedAt: time.Now(), Scopes: restrictions.Scopes}
+	mockAPIKeyService.On("Create", mock.Anything, workspaceID, "Publisher", userID, (*time.Time)(nil), restrictions).Return(apiKey, "nik_abc_secret", nil)
+
+	rec = postAPIKeyRequest(t, app, pair.AccessToken, "/workspaces/"+workspaceID.String()+"/api-keys", map[string]any{
+		"name":   "Publisher",
+		"scopes": []string{"templates:publish"},
+	})
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
@@ -2,14 +2,20 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"net/url"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/dimitrije/nikode-api/internal/config"
 	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/saml"
 	"github.com/dimitrije/nikode-api/internal/services"
 	"github.com/dimitrije/nikode-api/pkg/dto"
 	"github.com/google/uuid"
@@ -17,22 +23,66 @@ import (
 )
 
 type AuthHandler struct {
-	cfg          *config.Config
-	providers    map[string]oauth.Provider
-	userService  UserServiceInterface
-	tokenService TokenServiceInterface
-	jwtService   JWTServiceInterface
-	states       sync.Map
-	authCodes    sync.Map
+	cfg              *config.Config
+	providers        map[string]oauth.Provider
+	samlProviders    map[string]SAMLProviderInterface
+	userService      UserServiceInterface
+	tokenService     TokenServiceInterface
+	jwtService       JWTServiceInterface
+	magicLinkService MagicLinkServiceInterface
+	emailService     EmailServiceInterface
+	twoFactorService TwoFactorServiceInterface
+	hub              HubInterface
+
+	// store holds OAuth states, auth codes, two-factor challenges and
+	// device logins, so the steps of a login can land on different
+	// instances
+	store services.EphemeralStore
+
+	// twoFactorLimiter throttles two-factor codes per user
+	twoFactorLimiter *services.TokenBucketLimiter
+
+	// magicLinkEmailLimiter and magicLinkIPLimiter throttle sign-in link
+	// requests per address and per client
+	magicLinkEmailLimiter *services.TokenBucketLimiter
+	magicLinkIPLimiter    *services.TokenBucketLimiter
+
+	// deviceCodeLimiter and deviceVerifyLimiter throttle device code
+	// requests and user code lookups per client
+	deviceCodeLimiter   *services.TokenBucketLimiter
+	deviceVerifyLimiter *services.TokenBucketLimiter
 }
 
+// Keys of the values in the ephemeral store are prefixed by their kind
+const (
+	stateKeyPrefix              = "oauth_state:"
+	authCodeKeyPrefix           = "auth_code:"
+	twoFactorChallengeKeyPrefix = "two_factor:"
+	deviceCodeKeyPrefix         = "device_code:"
+	deviceUserCodeKeyPrefix     = "device_user_code:"
+	deviceApprovalKeyPrefix     = "device_approval:"
+	devicePollKeyPrefix         = "device_poll:"
+	deviceConfirmKeyPrefix      = "device_confirm:"
+	deviceClientKeyPrefix       = "device_client:"
+
+	stateTTL    = 10 * time.Minute
+	authCodeTTL = 30 * time.Second
+
+	// linkStateCookie binds a link state to the browser that started it
+	linkStateCookie = "nikode_link_state"
+)
+
 type stateData struct {
-	expiresAt time.Time
+	// SAMLRequestID is set for states of SP-initiated SAML logins
+	SAMLRequestID string `json:"saml_request_id,omitempty"`
+	// LinkUserID is set when a signed-in user links another identity
+	LinkUserID uuid.UUID `json:"link_user_id,omitempty"`
+	// DeviceCode is set when the user approves a device login
+	DeviceCode string `json:"device_code,omitempty"`
 }
 
 type authCodeData struct {
-	userID    uuid.UUID
-	expiresAt time.Time
+	UserID uuid.UUID `json:"user_id"`
 }
 
 func NewAuthHandler(
@@ -40,13 +90,29 @@ func NewAuthHandler(
 	userService UserServiceInterface,
 	tokenService TokenServiceInterface,
 	jwtService JWTServiceInterface,
+	magicLinkService MagicLinkServiceInterface,
+	emailService EmailServiceInterface,
+	twoFactorService TwoFactorServiceInterface,
+	store services.EphemeralStore,
+	hub HubInterface,
 ) *AuthHandler {
 	h := &AuthHandler{
-		cfg:          cfg,
-		providers:    make(map[string]oauth.Provider),
-		userService:  userService,
-		tokenService: tokenService,
-		jwtService:   jwtService,
+		cfg:                   cfg,
+		providers:             make(map[string]oauth.Provider),
+		samlProviders:         make(map[string]SAMLProviderInterface),
+		userService:           userService,
+		tokenService:          tokenService,
+		jwtService:            jwtService,
+		magicLinkService:      magicLinkService,
+		emailService:          emailService,
+		twoFactorService:      twoFactorService,
+		store:                 store,
+		hub:                   hub,
+		twoFactorLimiter:      services.NewTokenBucketLimiter(),
+		magicLinkEmailLimiter: services.NewTokenBucketLimiter(),
+		magicLinkIPLimiter:    services.NewTokenBucketLimiter(),
+		deviceCodeLimiter:     services.NewTokenBucketLimiter(),
+		deviceVerifyLimiter:   services.NewTokenBucketLimiter(),
 	}
 
 	if cfg.GitHub.ClientID != "" {
@@ -58,29 +124,53 @@ func NewAuthHandler(
 	if cfg.Google.ClientID != "" {
 		h.providers["google"] = oauth.NewGoogleProvider(cfg.Google)
 	}
-
-	go h.cleanupStates()
+	for _, instance := range cfg.GitHubInstances {
+		h.providers[instance.Name] = oauth.NewGitHubProvider(instance)
+	}
+	for _, instance := range cfg.GitLabInstances {
+		h.providers[instance.Name] = oauth.NewGitLabProvider(instance)
+	}
+	for _, oidcCfg := range cfg.OIDC {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		provider, err := oauth.NewOIDCProvider(ctx, oidcCfg)
+		cancel()
+		if err != nil {
+			log.Printf("OIDC provider %s disabled: %v", oidcCfg.Name, err)
+			continue
+		}
+		h.providers[oidcCfg.Name] = provider
+	}
+	for _, samlCfg := range cfg.SAML {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		provider, err := saml.NewServiceProvider(ctx, samlCfg, cfg.BaseURL, store)
+		cancel()
+		if err != nil {
+			log.Printf("SAML provider %s disabled: %v", samlCfg.Name, err)
+			continue
+		}
+		h.samlProviders[samlCfg.Name] = provider
+	}
 
 	return h
 }
 
-func (h *AuthHandler) cleanupStates() {
-	ticker := time.NewTicker(1 * time.Minute)
-	for range ticker.C {
-		now := time.Now()
-		h.states.Range(func(key, value any) bool {
-			if sd, ok := value.(stateData); ok && now.After(sd.expiresAt) {
-				h.states.Delete(key)
-			}
-			return true
-		})
-		h.authCodes.Range(func(key, value any) bool {
-			if acd, ok := value.(authCodeData); ok && now.After(acd.expiresAt) {
-				h.authCodes.Delete(key)
-			}
-			return true
-		})
+// putState stores the state of a login started at a provider
+func (h *AuthHandler) putState(ctx context.Context, state string, sd stateData) error {
+	return services.PutJSON(ctx, h.store, stateKeyPrefix+state, sd, stateTTL)
+}
+
+// takeState returns the state of a login once; it reports false if the
+// state is unknown or expired
+func (h *AuthHandler) takeState(ctx context.Context, state string) (stateData, bool, error) {
+	var sd stateData
+	err := services.TakeJSON(ctx, h.store, stateKeyPrefix+state, &sd)
+	if errors.Is(err, services.ErrEphemeralValueNotFound) {
+		return stateData{}, false, nil
 	}
+	if err != nil {
+		return stateData{}, false, err
+	}
+	return sd, true, nil
 }
 
 func (h *AuthHandler) GetConsentURL(c *drift.Context) {
@@ -98,7 +188,10 @@ func (h *AuthHandler) GetConsentURL(c *drift.Context) {
 		return
 	}
 
-	h.states.Store(state, stateData{expiresAt: time.Now().Add(10 * time.Minute)})
+	if err := h.putState(context.Background(), state, stateData{}); err != nil {
+		c.InternalServerError("failed to store state")
+		return
+	}
 
 	_ = c.JSON(200, dto.ConsentURLResponse{
 		URL: p.GetConsentURL(state),
@@ -120,21 +213,29 @@ func (h *AuthHandler) Callback(c *drift.Context) {
 		return
 	}
 
-	sd, ok := h.states.LoadAndDelete(state)
+	sd, ok, err := h.takeState(context.Background(), state)
+	if err != nil {
+		h.redirectWithError(c, "failed to load state")
+		return
+	}
 	if !ok {
 		h.redirectWithError(c, "invalid or expired state")
 		return
 	}
 
-	sdTyped, ok := sd.(stateData)
-	if !ok || time.Now().After(sdTyped.expiresAt) {
-		h.redirectWithError(c, "state expired")
+	// Device approvals happen in a plain browser, not the app
+	fail := func(errMsg string) { h.redirectWithError(c, errMsg) }
+	if sd.DeviceCode != "" {
+		fail = func(errMsg string) { h.deviceError(c, errMsg) }
+	}
+	if sd.LinkUserID != uuid.Nil && !h.takeLinkCookie(c, state) {
+		fail("linking was started in another browser")
 		return
 	}
 
 	code := c.QueryParam("code")
 	if code == "" {
-		h.redirectWithError(c, "missing authorization code")
+		fail("missing authorization code")
 		return
 	}
 
@@ -143,26 +244,132 @@ func (h *AuthHandler) Callback(c *drift.Context) {
 
 	userInfo, err := p.ExchangeCode(ctx, code)
 	if err != nil {
-		h.redirectWithError(c, "failed to exchange code: "+err.Error())
+		fail("failed to exchange code: " + err.Error())
+		return
+	}
+
+	if sd.DeviceCode != "" {
+		h.completeDevice(ctx, c, sd.DeviceCode, userInfo)
+		return
+	}
+	if sd.LinkUserID != uuid.Nil {
+		h.completeLink(ctx, c, sd.LinkUserID, userInfo)
+		return
+	}
+	h.completeLogin(ctx, c, userInfo)
+}
+
+// LinkConsentURL starts linking another identity to the signed-in user. The
+// provider redirects back to the usual callback, which links the identity
+// instead of signing in. A cookie ties the state to the browser that asked
+// for it, so nobody else can complete the link by opening the consent URL.
+func (h *AuthHandler) LinkConsentURL(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	provider := c.Param("provider")
+
+	state, err := oauth.GenerateState()
+	if err != nil {
+		c.InternalServerError("failed to generate state")
+		return
+	}
+
+	sd := stateData{LinkUserID: userID}
+
+	var consentURL string
+	if p, ok := h.providers[provider]; ok {
+		consentURL = p.GetConsentURL(state)
+	} else if p, ok := h.samlProviders[provider]; ok {
+		consentURL, sd.SAMLRequestID, err = p.AuthnRequestURL(state)
+		if err != nil {
+			c.InternalServerError("failed to create SAML request")
+			return
+		}
+	} else {
+		c.BadRequest("unsupported provider: " + provider)
 		return
 	}
 
+	if err := h.putState(context.Background(), state, sd); err != nil {
+		c.InternalServerError("failed to store state")
+		return
+	}
+	h.setLinkCookie(c, state, int(stateTTL.Seconds()))
+
+	_ = c.JSON(200, dto.ConsentURLResponse{
+		URL: consentURL,
+	})
+}
+
+// setLinkCookie stores or, with a negative maxAge, clears the link state
+// cookie. Over HTTPS it is sent cross-site too, because SAML providers post
+// their response to the ACS.
+func (h *AuthHandler) setLinkCookie(c *drift.Context, state string, maxAge int) {
+	secure := strings.HasPrefix(h.cfg.BaseURL, "https://")
+	sameSite := http.SameSiteLaxMode
+	if secure {
+		sameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(c.Response, &http.Cookie{
+		Name:     linkStateCookie,
+		Value:    state,
+		Path:     "/api/v1",
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		SameSite: sameSite,
+	})
+}
+
+// takeLinkCookie reports whether the request carries the cookie
+// LinkConsentURL set for state, and clears it.
+func (h *AuthHandler) takeLinkCookie(c *drift.Context, state string) bool {
+	value, err := c.Cookie(linkStateCookie)
+	if err != nil {
+		return false
+	}
+	h.setLinkCookie(c, "", -1)
+	return subtle.ConstantTimeCompare([]byte(value), []byte(state)) == 1
+}
+
+// completeLogin signs in the user an identity provider vouched for. It issues
+// a short-lived auth code and redirects to the frontend, which trades the
+// code for tokens at ExchangeCode. Users with two-factor authentication are
+// redirected with a two_factor challenge instead, which VerifyTwoFactor
+// trades for the auth code.
+func (h *AuthHandler) completeLogin(ctx context.Context, c *drift.Context, userInfo *oauth.UserInfo) {
 	user, err := h.userService.FindOrCreateFromOAuth(ctx, userInfo)
 	if err != nil {
+		if errors.Is(err, services.ErrEmailInUse) {
+			h.redirectWithError(c, "an account with this email already exists; sign in and link "+userInfo.Provider+" from your account")
+			return
+		}
 		h.redirectWithError(c, "failed to create user")
 		return
 	}
 
-	authCode, err := oauth.GenerateState()
+	challenge, required, err := h.startTwoFactor(ctx, user.ID, "")
 	if err != nil {
-		h.redirectWithError(c, "failed to generate auth code")
+		h.redirectWithError(c, "failed to check two-factor authentication")
+		return
+	}
+	if required {
+		c.Redirect(302, fmt.Sprintf("%s?two_factor=%s",
+			h.cfg.FrontendCallbackURL,
+			url.QueryEscape(challenge),
+		))
 		return
 	}
 
-	h.authCodes.Store(authCode, authCodeData{
-		userID:    user.ID,
-		expiresAt: time.Now().Add(30 * time.Second),
-	})
+	authCode, err := h.issueAuthCode(ctx, user.ID)
+	if err != nil {
+		h.redirectWithError(c, "failed to generate auth code")
+		return
+	}
 
 	redirectURL := fmt.Sprintf("%s?code=%s",
 		h.cfg.FrontendCallbackURL,
@@ -172,6 +379,39 @@ func (h *AuthHandler) Callback(c *drift.Context) {
 	c.Redirect(302, redirectURL)
 }
 
+// issueAuthCode stores a single-use code the frontend trades for tokens
+func (h *AuthHandler) issueAuthCode(ctx context.Context, userID uuid.UUID) (string, error) {
+	authCode, err := oauth.GenerateState()
+	if err != nil {
+		return "", err
+	}
+
+	if err := services.PutJSON(ctx, h.store, authCodeKeyPrefix+authCode, authCodeData{UserID: userID}, authCodeTTL); err != nil {
+		return "", err
+	}
+	return authCode, nil
+}
+
+// completeLink adds the identity a provider vouched for to the user who
+// started linking, then redirects to the frontend with linked=<provider>.
+func (h *AuthHandler) completeLink(ctx context.Context, c *drift.Context, userID uuid.UUID, userInfo *oauth.UserInfo) {
+	if _, err := h.userService.LinkIdentity(ctx, userID, userInfo); err != nil {
+		if errors.Is(err, services.ErrIdentityLinked) {
+			h.redirectWithError(c, "this "+userInfo.Provider+" account is linked to another user")
+			return
+		}
+		h.redirectWithError(c, "failed to link identity")
+		return
+	}
+
+	redirectURL := fmt.Sprintf("%s?linked=%s",
+		h.cfg.FrontendCallbackURL,
+		url.QueryEscape(userInfo.Provider),
+	)
+
+	c.Redirect(302, redirectURL)
+}
+
 func (h *AuthHandler) ExchangeCode(c *drift.Context) {
 	var req dto.ExchangeCodeRequest
 	if err := c.BindJSON(&req); err != nil {
@@ -184,27 +424,37 @@ func (h *AuthHandler) ExchangeCode(c *drift.Context) {
 		return
 	}
 
-	acd, ok := h.authCodes.LoadAndDelete(req.Code)
-	if !ok {
-		c.Unauthorized("invalid or expired code")
+	ctx := context.Background()
+
+	var codeData authCodeData
+	if err := services.TakeJSON(ctx, h.store, authCodeKeyPrefix+req.Code, &codeData); err != nil {
+		if errors.Is(err, services.ErrEphemeralValueNotFound) {
+			c.Unauthorized("invalid or expired code")
+			return
+		}
+		c.InternalServerError("failed to load code")
 		return
 	}
 
-	codeData, ok := acd.(authCodeData)
-	if !ok || time.Now().After(codeData.expiresAt) {
-		c.Unauthorized("code expired")
+	user, err := h.userService.GetByID(ctx, codeData.UserID)
+	if err != nil {
+		c.Unauthorized("user not found")
 		return
 	}
 
-	ctx := context.Background()
+	h.issueTokens(ctx, c, user, req.DeviceName)
+}
 
-	user, err := h.userService.GetByID(ctx, codeData.userID)
+// issueTokens starts a session for a user who just signed in and responds
+// with its first token pair.
+func (h *AuthHandler) issueTokens(ctx context.Context, c *drift.Context, user *models.User, deviceName string) {
+	session, err := h.tokenService.CreateSession(ctx, user.ID, sessionDeviceName(deviceName), c.GetHeader("User-Agent"), middleware.ClientAddr(c))
 	if err != nil {
-		c.Unauthorized("user not found")
+		c.InternalServerError("failed to create session")
 		return
 	}
 
-	tokenPair, err := h.jwtService.GenerateTokenPair(user.ID, user.Email, user.GlobalRole)
+	tokenPair, err := h.jwtService.GenerateTokenPair(user.ID, session.ID, user.Email, user.GlobalRole)
 	if err != nil {
 		c.InternalServerError("failed to generate tokens")
 		return
@@ -212,7 +462,7 @@ func (h *AuthHandler) ExchangeCode(c *drift.Context) {
 
 	tokenHash := services.HashToken(tokenPair.RefreshToken)
 	expiresAt := time.Now().Add(h.jwtService.RefreshExpiry())
-	if err := h.tokenService.StoreRefreshToken(ctx, user.ID, tokenHash, expiresAt); err != nil {
+	if err := h.tokenService.StoreRefreshToken(ctx, user.ID, session.ID, tokenHash, expiresAt); err != nil {
 		c.InternalServerError("failed to store refresh token")
 		return
 	}
@@ -245,7 +495,11 @@ func (h *AuthHandler) RefreshToken(c *drift.Context) {
 	tokenHash := services.HashToken(req.RefreshToken)
 	ctx := context.Background()
 
-	storedUserID, err := h.tokenService.ValidateRefreshToken(ctx, tokenHash)
+	storedUserID, sessionID, err := h.tokenService.ValidateRefreshToken(ctx, tokenHash)
+	if errors.Is(err, services.ErrRefreshTokenReused) {
+		h.refreshTokenReused(ctx, c, storedUserID, sessionID)
+		return
+	}
 	if err != nil || storedUserID != userID {
 		c.Unauthorized("refresh token not found or expired")
 		return
@@ -257,12 +511,7 @@ func (h *AuthHandler) RefreshToken(c *drift.Context) {
 		return
 	}
 
-	if err := h.tokenService.RevokeRefreshToken(ctx, tokenHash); err != nil {
-		c.InternalServerError("failed to revoke old token")
-		return
-	}
-
-	tokenPair, err := h.jwtService.GenerateTokenPair(user.ID, user.Email, user.GlobalRole)
+	tokenPair, err := h.jwtService.GenerateTokenPair(user.ID, sessionID, user.Email, user.GlobalRole)
 	if err != nil {
 		c.InternalServerError("failed to generate tokens")
 		return
@@ -270,11 +519,21 @@ func (h *AuthHandler) RefreshToken(c *drift.Context) {
 
 	newTokenHash := services.HashToken(tokenPair.RefreshToken)
 	expiresAt := time.Now().Add(h.jwtService.RefreshExpiry())
-	if err := h.tokenService.StoreRefreshToken(ctx, user.ID, newTokenHash, expiresAt); err != nil {
+	if err := h.tokenService.RotateRefreshToken(ctx, user.ID, sessionID, tokenHash, newTokenHash, expiresAt); err != nil {
+		if errors.Is(err, services.ErrRefreshTokenReused) {
+			h.refreshTokenReused(ctx, c, user.ID, sessionID)
+			return
+		}
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.Unauthorized("refresh token not found or expired")
+			return
+		}
 		c.InternalServerError("failed to store refresh token")
 		return
 	}
 
+	_ = h.tokenService.TouchSession(ctx, sessionID, c.GetHeader("User-Agent"), middleware.ClientAddr(c))
+
 	_ = c.JSON(200, dto.TokenResponse{
 		AccessToken:  tokenPair.AccessToken,
 		RefreshToken: tokenPair.RefreshToken,
@@ -282,6 +541,26 @@ func (h *AuthHandler) RefreshToken(c *drift.Context) {
 	})
 }
 
+// refreshTokenReused answers a refresh with a token that was already rotated.
+// The token service has revoked its session, since either the client or an
+// attacker holds a stolen copy, so its sockets are closed and the user is
+// told by email.
+func (h *AuthHandler) refreshTokenReused(ctx context.Context, c *drift.Context, userID, sessionID uuid.UUID) {
+	h.hub.DisconnectSession(sessionID)
+
+	if user, err := h.userService.GetByID(ctx, userID); err == nil {
+		_ = h.emailService.SendRefreshTokenReuse(user.Email, time.Now())
+	}
+	c.Unauthorized("refresh token reused; session revoked")
+}
+
+// JWKS publishes the public keys access tokens are signed with, so other
+// services can verify them without sharing a secret.
+func (h *AuthHandler) JWKS(c *drift.Context) {
+	c.Response.Header().Set("Cache-Control", "public, max-age=300")
+	_ = c.JSON(200, h.jwtService.JWKS())
+}
+
 func (h *AuthHandler) Logout(c *drift.Context) {
 	var req dto.RefreshTokenRequest
 	if err := c.BindJSON(&req); err != nil {
@@ -291,7 +570,9 @@ func (h *AuthHandler) Logout(c *drift.Context) {
 
 	if req.RefreshToken != "" {
 		tokenHash := services.HashToken(req.RefreshToken)
-		_ = h.tokenService.RevokeRefreshToken(context.Background(), tokenHash)
+		if sessionID, err := h.tokenService.RevokeSessionByToken(context.Background(), tokenHash); err == nil {
+			h.hub.DisconnectSession(sessionID)
+		}
 	}
 
 	_ = c.JSON(200, map[string]string{"message": "logged out"})
@@ -304,11 +585,16 @@ func (h *AuthHandler) LogoutAll(c *drift.Context) {
 		return
 	}
 
-	if err := h.tokenService.RevokeAllUserTokens(context.Background(), userID); err != nil {
+	sessionIDs, err := h.tokenService.RevokeAllUserTokens(context.Background(), userID)
+	if err != nil {
 		c.InternalServerError("failed to revoke tokens")
 		return
 	}
 
+	for _, sessionID := range sessionIDs {
+		h.hub.DisconnectSession(sessionID)
+	}
+
 	_ = c.JSON(200, map[string]string{"message": "all sessions logged out"})
 }
 
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"net/http"
@@ -30,21 +31,57 @@ func setupAuthTest(t *testing.T) (*testutil.MockUserService, *testutil.MockToken
 	mockTokenService := new(testutil.MockTokenService)
 	mockJWTService := new(testutil.MockJWTService)
 
+	// Users have no second factor unless a test replaces the service
+	mockTwoFactorService := new(testutil.MockTwoFactorService)
+	mockTwoFactorService.On("IsEnabled", mock.Anything, mock.Anything).Return(false, nil).Maybe()
+
 	cfg := &config.Config{
 		FrontendCallbackURL: "http://localhost:3000/auth/callback",
 	}
 
 	handler := &AuthHandler{
-		cfg:          cfg,
-		providers:    make(map[string]oauth.Provider),
-		userService:  mockUserService,
-		tokenService: mockTokenService,
-		jwtService:   mockJWTService,
+		cfg:           cfg,
+		providers:     make(map[string]oauth.Provider),
+		samlProviders: make(map[string]SAMLProviderInterface),
+		userService:   mockUserService,
+		tokenService:  mockTokenService,
+		jwtService:    mockJWTService,
+		store:         services.NewMemoryEphemeralStore(),
+		hub:           new(testutil.MockHub),
+
+		twoFactorService:      mockTwoFactorService,
+		twoFactorLimiter:      services.NewTokenBucketLimiter(),
+		magicLinkEmailLimiter: services.NewTokenBucketLimiter(),
+		magicLinkIPLimiter:    services.NewTokenBucketLimiter(),
+		deviceCodeLimiter:     services.NewTokenBucketLimiter(),
+		deviceVerifyLimiter:   services.NewTokenBucketLimiter(),
 	}
 
 	return mockUserService, mockTokenService, mockJWTService, handler, cfg
 }
 
+func storeState(t *testing.T, handler *AuthHandler, state string, sd stateData, ttl time.Duration) {
+	t.Helper()
+	require.NoError(t, services.PutJSON(context.Background(), handler.store, stateKeyPrefix+state, sd, ttl))
+}
+
+func loadState(handler *AuthHandler, state string) (stateData, bool) {
+	var sd stateData
+	err := services.GetJSON(context.Background(), handler.store, stateKeyPrefix+state, &sd)
+	return sd, err == nil
+}
+
+func storeAuthCode(t *testing.T, handler *AuthHandler, code string, userID uuid.UUID, ttl time.Duration) {
+	t.Helper()
+	require.NoError(t, services.PutJSON(context.Background(), handler.store, authCodeKeyPrefix+code, authCodeData{UserID: userID}, ttl))
+}
+
+func loadAuthCode(handler *AuthHandler, code string) (authCodeData, bool) {
+	var acd authCodeData
+	err := services.GetJSON(context.Background(), handler.store, authCodeKeyPrefix+code, &acd)
+	return acd, err == nil
+}
+
 func TestAuthHandler_ExchangeCode_Success(t *testing.T) {
 	mockUserService, mockTokenService, mockJWTService, handler, _ := setupAuthTest(t)
 
@@ -64,25 +101,26 @@ func TestAuthHandler_ExchangeCode_Success(t *testing.T) {
 
 	// Store an auth code
 	authCode := "test-auth-code"
-	handler.authCodes.Store(authCode, authCodeData{
-		userID:    userID,
-		expiresAt: time.Now().Add(30 * time.Second),
-	})
+	storeAuthCode(t, handler, authCode, userID, 30*time.Second)
 
+	sessionID := uuid.New()
 	mockUserService.On("GetByID", mock.Anything, userID).Return(user, nil)
-	mockJWTService.On("GenerateTokenPair", userID, "test@example.com", mock.Anything).Return(tokenPair, nil)
+	mockTokenService.On("CreateSession", mock.Anything, userID, "Ada's laptop", "Nikode/1.4 Electron", "192.0.2.1").
+		Return(&models.Session{ID: sessionID, UserID: userID}, nil)
+	mockJWTService.On("GenerateTokenPair", userID, sessionID, "test@example.com", mock.Anything).Return(tokenPair, nil)
 	mockJWTService.On("RefreshExpiry").Return(7 * 24 * time.Hour)
-	mockTokenService.On("StoreRefreshToken", mock.Anything, userID, mock.Anything, mock.Anything).Return(nil)
+	mockTokenService.On("StoreRefreshToken", mock.Anything, userID, sessionID, mock.Anything, mock.Anything).Return(nil)
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
 	app.Post("/auth/exchange", handler.ExchangeCode)
 
-	body := dto.ExchangeCodeRequest{Code: authCode}
+	body := dto.ExchangeCodeRequest{Code: authCode, DeviceName: "  Ada's laptop "}
 	jsonBody, _ := json.Marshal(body)
 
 	req := httptest.NewRequest(http.MethodPost, "/auth/exchange", bytes.NewReader(jsonBody))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Nikode/1.4 Electron")
 	rec := httptest.NewRecorder()
 
 	app.ServeHTTP(rec, req)
@@ -129,10 +167,7 @@ func TestAuthHandler_ExchangeCode_ExpiredCode(t *testing.T) {
 	authCode := "expired-auth-code"
 
 	// Store an expired auth code
-	handler.authCodes.Store(authCode, authCodeData{
-		userID:    userID,
-		expiresAt: time.Now().Add(-1 * time.Second), // Already expired
-	})
+	storeAuthCode(t, handler, authCode, userID, -1*time.Second) // Already expired
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
@@ -148,7 +183,7 @@ func TestAuthHandler_ExchangeCode_ExpiredCode(t *testing.T) {
 	app.ServeHTTP(rec, req)
 
 	assert.Equal(t, http.StatusUnauthorized, rec.Code)
-	assert.Contains(t, rec.Body.String(), "code expired")
+	assert.Contains(t, rec.Body.String(), "invalid or expired code")
 }
 
 func TestAuthHandler_ExchangeCode_MissingCode(t *testing.T) {
@@ -190,12 +225,13 @@ func TestAuthHandler_RefreshToken_Success(t *testing.T) {
 	}
 
 	mockJWTService.On("ValidateRefreshToken", oldRefreshToken).Return(userID, nil)
-	mockTokenService.On("ValidateRefreshToken", mock.Anything, mock.Anything).Return(userID, nil)
+	sessionID := uuid.New()
+	mockTokenService.On("ValidateRefreshToken", mock.Anything, mock.Anything).Return(userID, sessionID, nil)
 	mockUserService.On("GetByID", mock.Anything, userID).Return(user, nil)
-	mockTokenService.On("RevokeRefreshToken", mock.Anything, mock.Anything).Return(nil)
-	mockJWTService.On("GenerateTokenPair", userID, "test@example.com", mock.Anything).Return(newTokenPair, nil)
+	mockJWTService.On("GenerateTokenPair", userID, sessionID, "test@example.com", mock.Anything).Return(newTokenPair, nil)
 	mockJWTService.On("RefreshExpiry").Return(7 * 24 * time.Hour)
-	mockTokenService.On("StoreRefreshToken", mock.Anything, userID, mock.Anything, mock.Anything).Return(nil)
+	mockTokenService.On("RotateRefreshToken", mock.Anything, userID, sessionID, services.HashToken(oldRefreshToken), services.HashToken("new-refresh-token"), mock.Anything).Return(nil)
+	mockTokenService.On("TouchSession", mock.Anything, sessionID, mock.Anything, mock.Anything).Return(nil)
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
@@ -224,6 +260,42 @@ func TestAuthHandler_RefreshToken_Success(t *testing.T) {
 	mockTokenService.AssertExpectations(t)
 }
 
+func TestAuthHandler_RefreshToken_Reused(t *testing.T) {
+	mockUserService, mockTokenService, mockJWTService, handler, _ := setupAuthTest(t)
+	mockEmailService := new(testutil.MockEmailService)
+	handler.emailService = mockEmailService
+
+	userID := uuid.New()
+	sessionID := uuid.New()
+	user := &models.User{ID: userID, Email: "test@example.com"}
+
+	mockJWTService.On("ValidateRefreshToken", "rotated-token").Return(userID, nil)
+	mockTokenService.On("ValidateRefreshToken", mock.Anything, services.HashToken("rotated-token")).Return(userID, sessionID, services.ErrRefreshTokenReused)
+	mockUserService.On("GetByID", mock.Anything, userID).Return(user, nil)
+	mockEmailService.On("SendRefreshTokenReuse", "test@example.com", mock.Anything).Return(nil)
+	mockHub := handler.hub.(*testutil.MockHub)
+	mockHub.On("DisconnectSession", sessionID).Return(1)
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Post("/auth/refresh", handler.RefreshToken)
+
+	body := dto.RefreshTokenRequest{RefreshToken: "rotated-token"}
+	jsonBody, _ := json.Marshal(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/refresh", bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "refresh token reused")
+	mockJWTService.AssertNotCalled(t, "GenerateTokenPair", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockEmailService.AssertExpectations(t)
+	mockHub.AssertExpectations(t)
+}
+
 func TestAuthHandler_RefreshToken_InvalidToken(t *testing.T) {
 	_, _, mockJWTService, handler, _ := setupAuthTest(t)
 
@@ -271,7 +343,10 @@ func TestAuthHandler_RefreshToken_MissingToken(t *testing.T) {
 func TestAuthHandler_Logout_Success(t *testing.T) {
 	_, mockTokenService, _, handler, _ := setupAuthTest(t)
 
-	mockTokenService.On("RevokeRefreshToken", mock.Anything, mock.Anything).Return(nil)
+	sessionID := uuid.New()
+	mockTokenService.On("RevokeSessionByToken", mock.Anything, services.HashToken("some-refresh-token")).Return(sessionID, nil)
+	mockHub := handler.hub.(*testutil.MockHub)
+	mockHub.On("DisconnectSession", sessionID).Return(1)
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
@@ -290,6 +365,7 @@ func TestAuthHandler_Logout_Success(t *testing.T) {
 	assert.Contains(t, rec.Body.String(), "logged out")
 
 	mockTokenService.AssertExpectations(t)
+	mockHub.AssertExpectations(t)
 }
 
 func TestAuthHandler_Logout_EmptyToken(t *testing.T) {
@@ -313,6 +389,28 @@ func TestAuthHandler_Logout_EmptyToken(t *testing.T) {
 	assert.Contains(t, rec.Body.String(), "logged out")
 }
 
+func TestAuthHandler_JWKS(t *testing.T) {
+	_, _, mockJWTService, handler, _ := setupAuthTest(t)
+
+	jwks := services.JWKSet{Keys: []services.JWK{{KeyType: "OKP", KeyID: "key-1", Algorithm: "EdDSA", Use: "sig", Curve: "Ed25519", X: "abc"}}}
+	mockJWTService.On("JWKS").Return(jwks)
+
+	app := drift.New()
+	app.Get("/.well-known/jwks.json", handler.JWKS)
+
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Cache-Control"), "max-age=300")
+
+	var response services.JWKSet
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, jwks, response)
+}
+
 func TestAuthHandler_LogoutAll_Success(t *testing.T) {
 	_, mockTokenService, _, handler, _ := setupAuthTest(t)
 	jwtSvc := services.NewJWTService("test-secret-key", 15*time.Minute, 24*time.Hour)
@@ -320,7 +418,11 @@ func TestAuthHandler_LogoutAll_Success(t *testing.T) {
 	userID := uuid.New()
 	email := "test@example.com"
 
-	mockTokenService.On("RevokeAllUserTokens", mock.Anything, userID).Return(nil)
+	sessionIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	mockTokenService.On("RevokeAllUserTokens", mock.Anything, userID).Return(sessionIDs, nil)
+	mockHub := handler.hub.(*testutil.MockHub)
+	mockHub.On("DisconnectSession", sessionIDs[0]).Return(1)
+	mockHub.On("DisconnectSession", sessionIDs[1]).Return(0)
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
@@ -338,6 +440,7 @@ func TestAuthHandler_LogoutAll_Success(t *testing.T) {
 	assert.Contains(t, rec.Body.String(), "all sessions logged out")
 
 	mockTokenService.AssertExpectations(t)
+	mockHub.AssertExpectations(t)
 }
 
 func TestAuthHandler_LogoutAll_NotAuthenticated(t *testing.T) {
@@ -467,7 +570,7 @@ func TestAuthHandler_Callback_ExpiredState(t *testing.T) {
 
 	// Store an expired state
 	state := "expired-state"
-	handler.states.Store(state, stateData{expiresAt: time.Now().Add(-1 * time.Minute)})
+	storeState(t, handler, state, stateData{}, -1*time.Minute)
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
@@ -480,7 +583,7 @@ func TestAuthHandler_Callback_ExpiredState(t *testing.T) {
 
 	assert.Equal(t, http.StatusFound, rec.Code)
 	location := rec.Header().Get("Location")
-	assert.Contains(t, location, "error=state+expired")
+	assert.Contains(t, location, "error=invalid+or+expired+state")
 }
 
 func TestAuthHandler_Callback_MissingCode(t *testing.T) {
@@ -491,7 +594,7 @@ func TestAuthHandler_Callback_MissingCode(t *testing.T) {
 
 	// Store a valid state
 	state := "valid-state"
-	handler.states.Store(state, stateData{expiresAt: time.Now().Add(10 * time.Minute)})
+	storeState(t, handler, state, stateData{}, 10*time.Minute)
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
@@ -516,7 +619,7 @@ func TestAuthHandler_Callback_ExchangeCodeError(t *testing.T) {
 
 	// Store a valid state
 	state := "valid-state"
-	handler.states.Store(state, stateData{expiresAt: time.Now().Add(10 * time.Minute)})
+	storeState(t, handler, state, stateData{}, 10*time.Minute)
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
@@ -551,7 +654,7 @@ func TestAuthHandler_Callback_UserCreationError(t *testing.T) {
 
 	// Store a valid state
 	state := "valid-state"
-	handler.states.Store(state, stateData{expiresAt: time.Now().Add(10 * time.Minute)})
+	storeState(t, handler, state, stateData{}, 10*time.Minute)
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
@@ -593,7 +696,7 @@ func TestAuthHandler_Callback_Success(t *testing.T) {
 
 	// Store a valid state
 	state := "valid-state"
-	handler.states.Store(state, stateData{expiresAt: time.Now().Add(10 * time.Minute)})
+	storeState(t, handler, state, stateData{}, 10*time.Minute)
 
 	app := drift.New()
 	app.Use(driftmw.BodyParser())
@@ -613,3 +716,155 @@ func TestAuthHandler_Callback_Success(t *testing.T) {
 	mockProvider.AssertExpectations(t)
 	mockUserService.AssertExpectations(t)
 }
+
+func TestAuthHandler_Callback_EmailInUse(t *testing.T) {
+	mockUserService, _, _, handler, _ := setupAuthTest(t)
+
+	mockProvider := new(testutil.MockOAuthProvider)
+	userInfo := &oauth.UserInfo{
+		Email:    "test@example.com",
+		Name:     "Test User",
+		ID:       "12345",
+		Provider: "google",
+	}
+	mockProvider.On("ExchangeCode", mock.Anything, "test-code").Return(userInfo, nil)
+	handler.providers["google"] = mockProvider
+
+	mockUserService.On("FindOrCreateFromOAuth", mock.Anything, userInfo).Return(nil, services.ErrEmailInUse)
+
+	state := "valid-state"
+	storeState(t, handler, state, stateData{}, 10*time.Minute)
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Get("/auth/:provider/callback", handler.Callback)
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=test-code&state="+state, nil)
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	location := rec.Header().Get("Location")
+	assert.Contains(t, location, "error=an+account+with+this+email+already+exists")
+	assert.NotContains(t, location, "code=")
+
+	mockUserService.AssertExpectations(t)
+}
+
+func TestAuthHandler_LinkConsentURL(t *testing.T) {
+	_, _, _, handler, _ := setupAuthTest(t)
+	jwtSvc := services.NewJWTService("test-secret-key", 15*time.Minute, 24*time.Hour)
+	userID := uuid.New()
+
+	mockProvider := new(testutil.MockOAuthProvider)
+	mockProvider.On("GetConsentURL", mock.AnythingOfType("string")).Return("https://accounts.google.com/o/oauth2/auth?state=x")
+	handler.providers["google"] = mockProvider
+
+	app := drift.New()
+	app.Use(middleware.Auth(jwtSvc))
+	app.Get("/users/me/identities/:provider/consent", handler.LinkConsentURL)
+
+	token := generateTestToken(t, jwtSvc, userID, "test@example.com")
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/identities/google/consent", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// The state remembers who is linking, and the browser is bound to it
+	state := mockProvider.Calls[0].Arguments.String(0)
+	sd, ok := loadState(handler, state)
+	require.True(t, ok)
+	assert.Equal(t, userID, sd.LinkUserID)
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, linkStateCookie, cookies[0].Name)
+	assert.Equal(t, state, cookies[0].Value)
+	assert.True(t, cookies[0].HttpOnly)
+
+	req = httptest.NewRequest(http.MethodGet, "/users/me/identities/unknown/consent", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAuthHandler_Callback_LinkFromAnotherBrowser(t *testing.T) {
+	for _, cookie := range []string{"", "other-state"} {
+		mockUserService, _, _, handler, _ := setupAuthTest(t)
+
+		mockProvider := new(testutil.MockOAuthProvider)
+		handler.providers["google"] = mockProvider
+
+		state := "link-state"
+		storeState(t, handler, state, stateData{LinkUserID: uuid.New()}, 10*time.Minute)
+
+		app := drift.New()
+		app.Get("/auth/:provider/callback", handler.Callback)
+
+		req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=test-code&state="+state, nil)
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: linkStateCookie, Value: cookie})
+		}
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusFound, rec.Code)
+		assert.Contains(t, rec.Header().Get("Location"), "error=linking+was+started+in+another+browser")
+		mockProvider.AssertNotCalled(t, "ExchangeCode", mock.Anything, mock.Anything)
+		mockUserService.AssertNotCalled(t, "LinkIdentity", mock.Anything, mock.Anything, mock.Anything)
+	}
+}
+
+func TestAuthHandler_Callback_Link(t *testing.T) {
+	tests := []struct {
+		name     string
+		linkErr  error
+		location string
+	}{
+		{"linked", nil, "linked=google"},
+		{"linked to another user", services.ErrIdentityLinked, "error=this+google+account+is+linked+to+another+user"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUserService, _, _, handler, _ := setupAuthTest(t)
+			userID := uuid.New()
+
+			mockProvider := new(testutil.MockOAuthProvider)
+			userInfo := &oauth.UserInfo{Email: "test@example.com", ID: "12345", Provider: "google"}
+			mockProvider.On("ExchangeCode", mock.Anything, "test-code").Return(userInfo, nil)
+			handler.providers["google"] = mockProvider
+
+			if tt.linkErr != nil {
+				mockUserService.On("LinkIdentity", mock.Anything, userID, userInfo).Return(nil, tt.linkErr)
+			} else {
+				mockUserService.On("LinkIdentity", mock.Anything, userID, userInfo).Return(&models.UserIdentity{ID: uuid.New()}, nil)
+			}
+
+			state := "link-state"
+			storeState(t, handler, state, stateData{LinkUserID: userID}, 10*time.Minute)
+
+			app := drift.New()
+			app.Get("/auth/:provider/callback", handler.Callback)
+
+			req := httptest.NewRequest(http.MethodGet, "/auth/google/callback?code=test-code&state="+state, nil)
+			req.AddCookie(&http.Cookie{Name: linkStateCookie, Value: state})
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusFound, rec.Code)
+			location := rec.Header().Get("Location")
+			assert.Contains(t, location, tt.location)
+			assert.NotContains(t, location, "code=")
+
+			// Linking never signs in
+			mockUserService.AssertNotCalled(t, "FindOrCreateFromOAuth", mock.Anything, mock.Anything)
+			mockUserService.AssertExpectations(t)
+		})
+	}
+}
@@ -6,9 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
+	"path"
+	"strconv"
 	"strings"
 
+	"github.com/dimitrije/nikode-api/internal/hub"
 	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/dimitrije/nikode-api/internal/services"
 	"github.com/dimitrije/nikode-api/pkg/dto"
 	"github.com/google/uuid"
@@ -17,19 +22,134 @@ import (
 
 type AutomationHandler struct {
 	collectionService CollectionServiceInterface
-	openAPIService    OpenAPIServiceInterface
+	importService     ImportServiceInterface
+	exportService     ExportServiceInterface
+	hub               HubInterface
 }
 
-func NewAutomationHandler(collectionService CollectionServiceInterface, openAPIService OpenAPIServiceInterface) *AutomationHandler {
+func NewAutomationHandler(
+	collectionService CollectionServiceInterface,
+	importService ImportServiceInterface,
+	exportService ExportServiceInterface,
+	hub HubInterface,
+) *AutomationHandler {
 	return &AutomationHandler{
 		collectionService: collectionService,
-		openAPIService:    openAPIService,
+		importService:     importService,
+		exportService:     exportService,
+		hub:               hub,
 	}
 }
 
+// ListCollections lists the workspace's collections the API key can access.
+func (h *AutomationHandler) ListCollections(c *drift.Context) {
+	apiKey := middleware.GetAPIKey(c)
+	if apiKey == nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	collections, err := h.collectionService.GetByWorkspace(context.Background(), apiKey.WorkspaceID)
+	if err != nil {
+		c.InternalServerError("failed to get collections")
+		return
+	}
+
+	response := make([]dto.CollectionResponse, 0, len(collections))
+	for _, col := range collections {
+		if !services.APIKeyAllowsCollection(apiKey, col.ID) {
+			continue
+		}
+		response = append(response, collectionResponse(&col))
+	}
+
+	_ = c.JSON(200, response)
+}
+
+func (h *AutomationHandler) GetCollection(c *drift.Context) {
+	collection, ok := h.workspaceCollection(c)
+	if !ok {
+		return
+	}
+
+	_ = c.JSON(200, collectionResponse(collection))
+}
+
+// GetEnvironment returns the collection's active environment, or the one
+// named by the environment query parameter (ID or name).
+func (h *AutomationHandler) GetEnvironment(c *drift.Context) {
+	collection, ok := h.workspaceCollection(c)
+	if !ok {
+		return
+	}
+
+	env, err := services.SelectEnvironment(collection.Data, c.QueryParam("environment"))
+	if err != nil {
+		if errors.Is(err, services.ErrEnvironmentNotFound) {
+			c.NotFound("environment not found")
+			return
+		}
+		c.InternalServerError("failed to read collection data")
+		return
+	}
+
+	variables := make([]dto.EnvironmentVariable, len(env.Variables))
+	for i, v := range env.Variables {
+		variables[i] = dto.EnvironmentVariable{
+			Key:     v.Key,
+			Value:   v.Value,
+			Enabled: v.Enabled,
+			Secret:  v.Secret,
+		}
+	}
+
+	_ = c.JSON(200, dto.EnvironmentResponse{
+		CollectionID: collection.ID,
+		ID:           env.ID,
+		Name:         env.Name,
+		Variables:    variables,
+	})
+}
+
+// ExportCollection streams the collection in the format selected by the
+// format query parameter, like the user-facing export endpoint.
+func (h *AutomationHandler) ExportCollection(c *drift.Context) {
+	collection, ok := h.workspaceCollection(c)
+	if !ok {
+		return
+	}
+
+	writeExport(c, h.exportService, collection)
+}
+
+// workspaceCollection loads the collection from the collectionId path
+// parameter. Collections outside the API key's workspace or collection
+// restriction are reported as not found.
+func (h *AutomationHandler) workspaceCollection(c *drift.Context) (*models.Collection, bool) {
+	apiKey := middleware.GetAPIKey(c)
+	if apiKey == nil {
+		c.Unauthorized("not authenticated")
+		return nil, false
+	}
+
+	collectionID, err := uuid.Parse(c.Param("collectionId"))
+	if err != nil {
+		c.BadRequest("invalid collection id")
+		return nil, false
+	}
+
+	collection, err := h.collectionService.GetByID(context.Background(), collectionID)
+	if err != nil || collection.WorkspaceID != apiKey.WorkspaceID || !services.APIKeyAllowsCollection(apiKey, collection.ID) {
+		c.NotFound("collection not found")
+		return nil, false
+	}
+
+	return collection, true
+}
+
 func (h *AutomationHandler) UpsertCollection(c *drift.Context) {
-	workspaceID := middleware.GetAPIKeyWorkspaceID(c)
-	if workspaceID == uuid.Nil {
+	apiKey := middleware.GetAPIKey(c)
+	if apiKey == nil {
 		c.Unauthorized("not authenticated")
 		return
 	}
@@ -37,13 +157,8 @@ func (h *AutomationHandler) UpsertCollection(c *drift.Context) {
 	var req dto.UpsertCollectionRequest
 	var specBytes []byte
 
-	contentType := c.GetHeader("Content-Type")
-	isYAML := strings.Contains(contentType, "application/yaml") ||
-		strings.Contains(contentType, "text/yaml") ||
-		strings.Contains(contentType, "application/x-yaml")
-
-	if isYAML {
-		// Raw YAML body — the body IS the OpenAPI spec
+	if isRawSpecContentType(c.GetHeader("Content-Type")) {
+		// Raw YAML or GraphQL SDL body — the body IS the spec
 		body, err := io.ReadAll(c.Request.Body)
 		if err != nil {
 			c.BadRequest("failed to read request body")
@@ -55,6 +170,13 @@ func (h *AutomationHandler) UpsertCollection(c *drift.Context) {
 		req.Name = c.QueryParam("name")
 		req.CollectionID = c.QueryParam("collection_id")
 		req.Resolution = c.QueryParam("resolution")
+		if depth := c.QueryParam("selection_depth"); depth != "" {
+			req.SelectionDepth, err = strconv.Atoi(depth)
+			if err != nil {
+				c.BadRequest("invalid selection_depth")
+				return
+			}
+		}
 	} else {
 		// JSON body
 		if err := c.BindJSON(&req); err != nil {
@@ -67,173 +189,464 @@ func (h *AutomationHandler) UpsertCollection(c *drift.Context) {
 			return
 		}
 
-		// Check if spec is a string (YAML) or JSON object
-		var yamlStr string
-		if err := json.Unmarshal(req.Spec, &yamlStr); err == nil {
-			specBytes = []byte(yamlStr)
-		} else {
-			specBytes = req.Spec
-		}
+		specBytes = decodeSpecField(req.Spec)
 	}
 
-	// Default resolution to "force"
-	if req.Resolution == "" {
-		req.Resolution = "force"
+	ctx := context.Background()
+
+	result, uerr := h.convertSpec(&req, specBytes)
+	if uerr != nil {
+		writeUpsertError(c, uerr)
+		return
 	}
 
-	if req.Resolution != "force" && req.Resolution != "clone" && req.Resolution != "fail" {
-		c.BadRequest("resolution must be one of: force, clone, fail")
+	plan, uerr := h.planUpsert(ctx, apiKey, &req, result, nil)
+	if uerr != nil {
+		writeUpsertError(c, uerr)
 		return
 	}
 
-	if len(specBytes) == 0 {
-		c.BadRequest("spec is required")
+	actor := models.APIKeyActor(apiKey)
+
+	if plan.existing == nil {
+		newCollection, err := h.collectionService.CreateAs(ctx, apiKey.WorkspaceID, plan.name, plan.data, actor)
+		if err != nil {
+			if req.Resolution == "clone" {
+				c.InternalServerError("failed to clone collection")
+				return
+			}
+			c.InternalServerError("failed to create collection")
+			return
+		}
+
+		h.hub.BroadcastCollectionCreateAs(newCollection.WorkspaceID, newCollection.ID, actor, newCollection.Name, newCollection.Version)
+
+		_ = c.JSON(201, dto.UpsertCollectionResponse{
+			ID:          newCollection.ID,
+			WorkspaceID: newCollection.WorkspaceID,
+			Name:        newCollection.Name,
+			Version:     newCollection.Version,
+			Created:     true,
+		})
 		return
 	}
 
-	// Parse the OpenAPI spec (auto-detects JSON/YAML)
-	spec, err := h.openAPIService.ParseOpenAPI(specBytes)
+	updated, err := h.collectionService.ForceUpdate(ctx, plan.existing.ID, plan.name, plan.data, actor)
 	if err != nil {
-		c.BadRequest("invalid openapi spec: " + err.Error())
+		c.InternalServerError("failed to update collection")
 		return
 	}
 
-	// Convert to Nikode format
-	data, err := h.openAPIService.ConvertToNikode(spec)
+	h.hub.BroadcastCollectionUpdateAs(updated.WorkspaceID, updated.ID, actor, updated.Name, updated.Version)
+
+	_ = c.JSON(200, dto.UpsertCollectionResponse{
+		ID:          updated.ID,
+		WorkspaceID: updated.WorkspaceID,
+		Name:        updated.Name,
+		Version:     updated.Version,
+		Created:     false,
+	})
+}
+
+// UpsertCollections upserts many specs in one transaction. Specs come from a
+// multipart upload (files in "specs", an optional JSON "manifest" field) or a
+// tar archive, optionally gzip-compressed, with an optional manifest.json.
+// Without a manifest every file is a spec. Specs without a name or
+// collection_id are named after their title, or else their file name. When
+// any spec is rejected nothing is written.
+func (h *AutomationHandler) UpsertCollections(c *drift.Context) {
+	apiKey := middleware.GetAPIKey(c)
+	if apiKey == nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	var files []services.SpecFile
+	var manifest []byte
+
+	if strings.HasPrefix(c.GetHeader("Content-Type"), "multipart/") {
+		form, err := c.MultipartForm()
+		if err != nil {
+			c.BadRequest("invalid multipart body")
+			return
+		}
+		if len(form.File["specs"]) > services.MaxSpecBundleFiles {
+			c.BadRequest(fmt.Sprintf("at most %d specs are allowed", services.MaxSpecBundleFiles))
+			return
+		}
+		for _, fh := range form.File["specs"] {
+			content, err := readFormFile(fh)
+			if err != nil {
+				c.BadRequest("failed to read " + fh.Filename)
+				return
+			}
+			files = append(files, services.SpecFile{Name: fh.Filename, Content: content})
+		}
+		if values := form.Value["manifest"]; len(values) > 0 {
+			manifest = []byte(values[0])
+		}
+	} else {
+		archive, err := services.ReadSpecArchive(c.Request.Body)
+		if err != nil {
+			c.BadRequest(err.Error())
+			return
+		}
+		for _, f := range archive {
+			if f.Name == services.SpecBundleManifest {
+				manifest = f.Content
+				continue
+			}
+			files = append(files, f)
+		}
+	}
+
+	specs, err := batchSpecs(files, manifest)
 	if err != nil {
-		c.InternalServerError("failed to convert openapi spec")
+		c.BadRequest(err.Error())
 		return
 	}
 
 	ctx := context.Background()
+	response := dto.BatchUpsertResponse{
+		WorkspaceID: apiKey.WorkspaceID,
+		Results:     make([]dto.BatchUpsertResult, len(specs)),
+	}
+	upserts := make([]services.CollectionUpsert, len(specs))
+	targets := make(map[string]bool)
+	rejected := false
 
-	// Resolve existing collection: by ID first, then by name
-	var existing *struct {
-		ID      uuid.UUID
-		Name    string
-		Version int
+	for i, spec := range specs {
+		result := &response.Results[i]
+		result.File = spec.file
+
+		plan, uerr := h.planBatchSpec(ctx, apiKey, &spec, targets)
+		if uerr != nil {
+			result.Status, result.Error = uerr.status, uerr.message
+			rejected = true
+			continue
+		}
+
+		result.Name = plan.name
+		result.Created = plan.existing == nil
+		upserts[i] = services.CollectionUpsert{Name: plan.name, Data: plan.data}
+		if plan.existing != nil {
+			upserts[i].CollectionID = plan.existing.ID
+		}
+	}
+
+	if rejected {
+		_ = c.JSON(422, response)
+		return
 	}
 
+	actor := models.APIKeyActor(apiKey)
+	collections, err := h.collectionService.UpsertBatch(ctx, apiKey.WorkspaceID, upserts, actor)
+	if err != nil {
+		var upsertErr *services.CollectionUpsertError
+		if errors.As(err, &upsertErr) && errors.Is(err, services.ErrCollectionNotFound) {
+			// Deleted after the batch was planned
+			response.Results[upsertErr.Index].Status = 404
+			response.Results[upsertErr.Index].Error = "collection not found"
+			_ = c.JSON(422, response)
+			return
+		}
+		c.InternalServerError("failed to upsert collections")
+		return
+	}
+
+	items := make([]hub.CollectionBatchItem, len(collections))
+	for i, col := range collections {
+		result := &response.Results[i]
+		result.ID = &col.ID
+		result.Name = col.Name
+		result.Version = col.Version
+		items[i] = hub.CollectionBatchItem{
+			CollectionID: col.ID,
+			Name:         col.Name,
+			Version:      col.Version,
+			Created:      result.Created,
+		}
+	}
+	response.Applied = true
+
+	h.hub.BroadcastCollectionsBatch(apiKey.WorkspaceID, actor, items)
+
+	_ = c.JSON(200, response)
+}
+
+// upsertPlan is the write an upsert resolves to. A nil existing creates a
+// collection.
+type upsertPlan struct {
+	existing *models.Collection
+	name     string
+	data     json.RawMessage
+}
+
+// upsertError is a rejected upsert and the status it is reported with.
+type upsertError struct {
+	status  int
+	message string
+}
+
+func writeUpsertError(c *drift.Context, err *upsertError) {
+	switch err.status {
+	case 400:
+		c.BadRequest(err.message)
+	case 403:
+		c.Forbidden(err.message)
+	case 404:
+		c.NotFound(err.message)
+	case 409:
+		_ = c.JSON(409, map[string]string{
+			"error":   "collection exists",
+			"message": err.message,
+		})
+	default:
+		c.InternalServerError(err.message)
+	}
+}
+
+// convertSpec validates the upsert options and converts the spec to Nikode
+// format.
+func (h *AutomationHandler) convertSpec(req *dto.UpsertCollectionRequest, specBytes []byte) (*services.ImportResult, *upsertError) {
+	// Default resolution to "force"
+	if req.Resolution == "" {
+		req.Resolution = "force"
+	}
+
+	if req.Resolution != "force" && req.Resolution != "clone" && req.Resolution != "fail" {
+		return nil, &upsertError{400, "resolution must be one of: force, clone, fail"}
+	}
+
+	if len(specBytes) == 0 {
+		return nil, &upsertError{400, "spec is required"}
+	}
+
+	if req.SelectionDepth < 0 || req.SelectionDepth > services.MaxGraphQLSelectionDepth {
+		return nil, &upsertError{400, fmt.Sprintf("selection_depth must be between 0 (the default) and %d", services.MaxGraphQLSelectionDepth)}
+	}
+
+	// Detect the format (OpenAPI, AsyncAPI, GraphQL, Postman, Insomnia, HAR)
+	// and convert to Nikode format
+	result, err := h.importService.Import(specBytes, services.ImportOptions{SelectionDepth: req.SelectionDepth})
+	if err != nil {
+		var parseErr *services.SpecParseError
+		if errors.As(err, &parseErr) {
+			return nil, &upsertError{400, parseErr.Error()}
+		}
+		return nil, &upsertError{500, "failed to convert spec"}
+	}
+	return result, nil
+}
+
+// planUpsert resolves which collection a converted spec writes to. In a
+// batch, targets holds the collections already claimed by earlier specs so
+// two specs cannot write the same collection.
+func (h *AutomationHandler) planUpsert(ctx context.Context, apiKey *models.WorkspaceAPIKey, req *dto.UpsertCollectionRequest, result *services.ImportResult, targets map[string]bool) (*upsertPlan, *upsertError) {
+	workspaceID := apiKey.WorkspaceID
+	data := result.Data
+
+	// Resolve existing collection: by ID first, then by name
+	var existing *models.Collection
+
 	if req.CollectionID != "" {
 		collectionID, err := uuid.Parse(req.CollectionID)
 		if err != nil {
-			c.BadRequest("invalid collection_id")
-			return
+			return nil, &upsertError{400, "invalid collection_id"}
 		}
 
 		col, err := h.collectionService.GetByID(ctx, collectionID)
 		if err != nil {
 			if errors.Is(err, services.ErrCollectionNotFound) {
-				c.NotFound("collection not found")
-				return
+				return nil, &upsertError{404, "collection not found"}
 			}
-			c.InternalServerError("failed to look up collection")
-			return
+			return nil, &upsertError{500, "failed to look up collection"}
 		}
 
-		// Verify the collection belongs to this workspace
-		if col.WorkspaceID != workspaceID {
-			c.NotFound("collection not found")
-			return
+		// Verify the collection belongs to this workspace and the key
+		if col.WorkspaceID != workspaceID || !services.APIKeyAllowsCollection(apiKey, col.ID) {
+			return nil, &upsertError{404, "collection not found"}
 		}
 
-		existing = &struct {
-			ID      uuid.UUID
-			Name    string
-			Version int
-		}{col.ID, col.Name, col.Version}
+		existing = col
 	} else {
 		// Require name when no collection_id
 		if strings.TrimSpace(req.Name) == "" {
-			c.BadRequest("name or collection_id is required")
-			return
+			return nil, &upsertError{400, "name or collection_id is required"}
 		}
 
 		col, err := h.collectionService.GetByWorkspaceAndName(ctx, workspaceID, req.Name)
 		if err != nil && !errors.Is(err, services.ErrCollectionNotFound) {
-			c.InternalServerError("failed to check existing collection")
-			return
+			return nil, &upsertError{500, "failed to check existing collection"}
 		}
 		if col != nil {
-			existing = &struct {
-				ID      uuid.UUID
-				Name    string
-				Version int
-			}{col.ID, col.Name, col.Version}
+			if !services.APIKeyAllowsCollection(apiKey, col.ID) {
+				return nil, &upsertError{403, "api key cannot access this collection"}
+			}
+			existing = col
 		}
 	}
 
+	// Keys restricted to specific collections can only update them
+	createsCollection := existing == nil || req.Resolution == "clone"
+	if createsCollection && result.Environment == nil && len(apiKey.CollectionIDs) > 0 {
+		return nil, &upsertError{403, "api key is restricted to specific collections"}
+	}
+
+	// Postman environment files add an environment to an existing collection
+	if result.Environment != nil {
+		if existing == nil {
+			return nil, &upsertError{404, "collection not found"}
+		}
+
+		merged, err := services.MergeEnvironment(existing.Data, *result.Environment)
+		if err != nil {
+			return nil, &upsertError{500, "failed to merge environment"}
+		}
+		return claimUpsert(targets, &upsertPlan{existing: existing, name: existing.Name, data: merged})
+	}
+
 	// Use existing name as fallback if name not provided
 	name := strings.TrimSpace(req.Name)
 	if name == "" && existing != nil {
 		name = existing.Name
 	}
 
-	var response dto.UpsertCollectionResponse
-
 	if existing != nil {
 		switch req.Resolution {
 		case "fail":
-			_ = c.JSON(409, map[string]string{
-				"error":   "collection exists",
-				"message": fmt.Sprintf("collection %q already exists, use resolution=force or resolution=clone", existing.Name),
-			})
-			return
+			return nil, &upsertError{409, fmt.Sprintf("collection %q already exists, use resolution=force or resolution=clone", existing.Name)}
 
 		case "clone":
 			// Create a new collection with a suffixed name
-			cloneName := name + " (copy)"
-			newCollection, err := h.collectionService.Create(ctx, workspaceID, cloneName, data, uuid.Nil)
-			if err != nil {
-				c.InternalServerError("failed to clone collection")
-				return
-			}
-			response = dto.UpsertCollectionResponse{
-				ID:          newCollection.ID,
-				WorkspaceID: newCollection.WorkspaceID,
-				Name:        newCollection.Name,
-				Version:     newCollection.Version,
-				Created:     true,
-			}
-			_ = c.JSON(201, response)
-			return
+			return claimUpsert(targets, &upsertPlan{name: name + " (copy)", data: data})
 
 		case "force":
-			updated, err := h.collectionService.ForceUpdate(ctx, existing.ID, name, data)
-			if err != nil {
-				c.InternalServerError("failed to update collection")
-				return
-			}
-			response = dto.UpsertCollectionResponse{
-				ID:          updated.ID,
-				WorkspaceID: updated.WorkspaceID,
-				Name:        updated.Name,
-				Version:     updated.Version,
-				Created:     false,
-			}
-			_ = c.JSON(200, response)
-			return
+			// Keep the environment the team had selected and the values
+			// they entered if the environments still exist
+			data = services.PreserveEnvironments(existing.Data, data)
+			return claimUpsert(targets, &upsertPlan{existing: existing, name: name, data: data})
 		}
 	}
 
 	// Collection doesn't exist — create
 	if name == "" {
-		c.BadRequest("name is required when creating a new collection")
-		return
+		return nil, &upsertError{400, "name is required when creating a new collection"}
 	}
 
-	newCollection, err := h.collectionService.Create(ctx, workspaceID, name, data, uuid.Nil)
-	if err != nil {
-		c.InternalServerError("failed to create collection")
-		return
+	return claimUpsert(targets, &upsertPlan{name: name, data: data})
+}
+
+// claimUpsert records the plan's target in targets, rejecting a second write
+// to the same collection or a second collection with the same name.
+func claimUpsert(targets map[string]bool, plan *upsertPlan) (*upsertPlan, *upsertError) {
+	if targets == nil {
+		return plan, nil
+	}
+
+	key := "name:" + plan.name
+	if plan.existing != nil {
+		key = "id:" + plan.existing.ID.String()
+	}
+	if targets[key] {
+		return nil, &upsertError{409, fmt.Sprintf("collection %q is written by more than one spec in the batch", plan.name)}
+	}
+	targets[key] = true
+	return plan, nil
+}
+
+// planBatchSpec converts and plans one spec of a batch. Specs without a name
+// or collection_id are named after the converted document, or else the file.
+func (h *AutomationHandler) planBatchSpec(ctx context.Context, apiKey *models.WorkspaceAPIKey, spec *batchSpec, targets map[string]bool) (*upsertPlan, *upsertError) {
+	result, uerr := h.convertSpec(&spec.req, spec.content)
+	if uerr != nil {
+		return nil, uerr
+	}
+
+	if strings.TrimSpace(spec.req.Name) == "" && spec.req.CollectionID == "" {
+		spec.req.Name = result.Name
+		if strings.TrimSpace(spec.req.Name) == "" {
+			spec.req.Name = fileBaseName(spec.file)
+		}
+	}
+
+	return h.planUpsert(ctx, apiKey, &spec.req, result, targets)
+}
+
+// batchSpec is one spec of a batch upsert.
+type batchSpec struct {
+	file    string
+	req     dto.UpsertCollectionRequest
+	content []byte
+}
+
+// batchSpecs pairs the uploaded files with their manifest entries. Without a
+// manifest every file is a spec, named when it is converted.
+func batchSpecs(files []services.SpecFile, manifest []byte) ([]batchSpec, error) {
+	byName := make(map[string][]byte, len(files))
+	for _, f := range files {
+		if _, ok := byName[f.Name]; ok {
+			return nil, fmt.Errorf("duplicate file %q", f.Name)
+		}
+		byName[f.Name] = f.Content
+	}
+
+	if manifest == nil {
+		if len(files) == 0 {
+			return nil, errors.New("at least one spec is required")
+		}
+		if len(files) > services.MaxSpecBundleFiles {
+			return nil, fmt.Errorf("at most %d specs are allowed", services.MaxSpecBundleFiles)
+		}
+		specs := make([]batchSpec, len(files))
+		for i, f := range files {
+			specs[i] = batchSpec{file: f.Name, content: f.Content}
+		}
+		return specs, nil
 	}
 
-	response = dto.UpsertCollectionResponse{
-		ID:          newCollection.ID,
-		WorkspaceID: newCollection.WorkspaceID,
-		Name:        newCollection.Name,
-		Version:     newCollection.Version,
-		Created:     true,
+	var entries []dto.BatchUpsertSpec
+	if err := json.Unmarshal(manifest, &entries); err != nil {
+		return nil, errors.New("invalid manifest: expected a JSON array of specs")
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("manifest lists no specs")
+	}
+	if len(entries) > services.MaxSpecBundleFiles {
+		return nil, fmt.Errorf("at most %d specs are allowed", services.MaxSpecBundleFiles)
+	}
+
+	specs := make([]batchSpec, len(entries))
+	for i, entry := range entries {
+		content, ok := byName[entry.File]
+		if !ok {
+			return nil, fmt.Errorf("manifest references missing file %q", entry.File)
+		}
+		specs[i] = batchSpec{
+			file: entry.File,
+			req: dto.UpsertCollectionRequest{
+				Name:           entry.Name,
+				CollectionID:   entry.CollectionID,
+				Resolution:     entry.Resolution,
+				SelectionDepth: entry.SelectionDepth,
+			},
+			content: content,
+		}
+	}
+	return specs, nil
+}
+
+// fileBaseName returns the file name without directories or extension.
+func fileBaseName(name string) string {
+	base := path.Base(name)
+	return strings.TrimSuffix(base, path.Ext(base))
+}
+
+func readFormFile(fh *multipart.FileHeader) ([]byte, error) {
+	file, err := fh.Open()
+	if err != nil {
+		return nil, err
 	}
-	_ = c.JSON(201, response)
+	defer func() { _ = file.Close() }()
+	return io.ReadAll(file)
 }
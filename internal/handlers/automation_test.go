@@ -0,0 +1,423 @@
+package handlers
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dimitrije/nikode-api/internal/hub"
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testAutomationCollectionData = `{
+	"activeEnvironmentId": "env-staging",
+	"environments": [
+		{"id": "env-local", "name": "Local", "variables": [{"key": "baseUrl", "value": "http://localhost:3000", "enabled": true}]},
+		{"id": "env-staging", "name": "Staging", "variables": [
+			{"key": "baseUrl", "value": "https://staging.example.com", "enabled": true},
+			{"key": "token", "value": "s3cret", "enabled": true, "secret": true}
+		]}
+	],
+	"items": [{"id": "r1", "type": "request", "name": "Ping", "method": "GET", "url": "{{baseUrl}}/ping"}]
+}`
+
+// setupAutomationTest authenticates every request as an unrestricted API key
+// of workspaceID.
+func setupAutomationTest(t *testing.T, workspaceID uuid.UUID) (*testutil.MockCollectionService, *drift.Engine) {
+	t.Helper()
+	return setupAutomationTestWithKey(t, &models.WorkspaceAPIKey{ID: uuid.New(), WorkspaceID: workspaceID, Scopes: models.DefaultAPIKeyScopes})
+}
+
+func setupAutomationTestWithKey(t *testing.T, apiKey *models.WorkspaceAPIKey) (*testutil.MockCollectionService, *drift.Engine) {
+	t.Helper()
+	mockCollectionService, _, app := setupAutomationTestWithHub(t, apiKey)
+	return mockCollectionService, app
+}
+
+func setupAutomationTestWithHub(t *testing.T, apiKey *models.WorkspaceAPIKey) (*testutil.MockCollectionService, *testutil.MockHub, *drift.Engine) {
+	t.Helper()
+	mockCollectionService := new(testutil.MockCollectionService)
+	mockHub := new(testutil.MockHub)
+	handler := NewAutomationHandler(mockCollectionService, services.NewImportService(
+		services.NewOpenAPIService(),
+		services.NewAsyncAPIService(),
+		services.NewGraphQLService(),
+		services.NewPostmanService(),
+		services.NewInsomniaService(),
+		services.NewHARService(),
+	), services.NewExportService(), mockHub)
+
+	app := drift.New()
+	app.Use(func(c *drift.Context) {
+		c.Set(middleware.APIKeyKey, apiKey)
+		c.Next()
+	})
+	app.Put("/automation/collections", handler.UpsertCollection)
+	app.Put("/automation/collections/batch", handler.UpsertCollections)
+	app.Get("/automation/collections", handler.ListCollections)
+	app.Get("/automation/collections/:collectionId", handler.GetCollection)
+	app.Get("/automation/collections/:collectionId/environment", handler.GetEnvironment)
+	app.Get("/automation/collections/:collectionId/export", handler.ExportCollection)
+
+	return mockCollectionService, mockHub, app
+}
+
+func getAutomation(app *drift.Engine, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAutomationHandler_ListCollections(t *testing.T) {
+	workspaceID := uuid.New()
+	mockCollectionService, app := setupAutomationTest(t, workspaceID)
+
+	collections := []models.Collection{
+		{ID: uuid.New(), WorkspaceID: workspaceID, Name: "First", Data: json.RawMessage(`{}`), Version: 1},
+		{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Second", Data: json.RawMessage(`{}`), Version: 4},
+	}
+	mockCollectionService.On("GetByWorkspace", mock.Anything, workspaceID).Return(collections, nil)
+
+	rec := getAutomation(app, "/automation/collections")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response []dto.CollectionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response, 2)
+	assert.Equal(t, "Second", response[1].Name)
+	assert.Equal(t, 4, response[1].Version)
+}
+
+func TestAutomationHandler_GetCollection(t *testing.T) {
+	workspaceID := uuid.New()
+	mockCollectionService, app := setupAutomationTest(t, workspaceID)
+
+	collection := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Partner API", Data: json.RawMessage(testAutomationCollectionData), Version: 2}
+	mockCollectionService.On("GetByID", mock.Anything, collection.ID).Return(collection, nil)
+
+	rec := getAutomation(app, "/automation/collections/"+collection.ID.String())
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response dto.CollectionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, collection.ID, response.ID)
+	assert.Equal(t, "Partner API", response.Name)
+	assert.JSONEq(t, testAutomationCollectionData, string(response.Data))
+}
+
+func TestAutomationHandler_GetCollection_OtherWorkspace(t *testing.T) {
+	mockCollectionService, app := setupAutomationTest(t, uuid.New())
+
+	collection := &models.Collection{ID: uuid.New(), WorkspaceID: uuid.New(), Name: "Private", Data: json.RawMessage(`{}`)}
+	mockCollectionService.On("GetByID", mock.Anything, collection.ID).Return(collection, nil)
+
+	for _, suffix := range []string{"", "/environment", "/export"} {
+		rec := getAutomation(app, "/automation/collections/"+collection.ID.String()+suffix)
+		assert.Equal(t, http.StatusNotFound, rec.Code, suffix)
+	}
+}
+
+func TestAutomationHandler_GetEnvironment(t *testing.T) {
+	workspaceID := uuid.New()
+	mockCollectionService, app := setupAutomationTest(t, workspaceID)
+
+	collection := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Partner API", Data: json.RawMessage(testAutomationCollectionData)}
+	mockCollectionService.On("GetByID", mock.Anything, collection.ID).Return(collection, nil)
+
+	t.Run("active", func(t *testing.T) {
+		rec := getAutomation(app, "/automation/collections/"+collection.ID.String()+"/environment")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response dto.EnvironmentResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, collection.ID, response.CollectionID)
+		assert.Equal(t, "env-staging", response.ID)
+		assert.Equal(t, []dto.EnvironmentVariable{
+			{Key: "baseUrl", Value: "https://staging.example.com", Enabled: true},
+			{Key: "token", Value: "s3cret", Enabled: true, Secret: true},
+		}, response.Variables)
+	})
+
+	t.Run("by name", func(t *testing.T) {
+		rec := getAutomation(app, "/automation/collections/"+collection.ID.String()+"/environment?environment=Local")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response dto.EnvironmentResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		assert.Equal(t, "env-local", response.ID)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		rec := getAutomation(app, "/automation/collections/"+collection.ID.String()+"/environment?environment=Production")
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestAutomationHandler_ExportCollection(t *testing.T) {
+	workspaceID := uuid.New()
+	mockCollectionService, app := setupAutomationTest(t, workspaceID)
+
+	collection := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Partner API", Data: json.RawMessage(testAutomationCollectionData)}
+	mockCollectionService.On("GetByID", mock.Anything, collection.ID).Return(collection, nil)
+
+	rec := getAutomation(app, "/automation/collections/"+collection.ID.String()+"/export?format=har")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `attachment; filename="partner-api.har"`, rec.Header().Get("Content-Disposition"))
+	assert.Contains(t, rec.Body.String(), `"url": "https://staging.example.com/ping"`)
+}
+
+func TestAutomationHandler_CollectionRestriction(t *testing.T) {
+	workspaceID := uuid.New()
+	allowed := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Allowed", Data: json.RawMessage(`{}`)}
+	other := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Other", Data: json.RawMessage(`{}`)}
+	apiKey := &models.WorkspaceAPIKey{
+		ID:            uuid.New(),
+		WorkspaceID:   workspaceID,
+		Scopes:        models.DefaultAPIKeyScopes,
+		CollectionIDs: []uuid.UUID{allowed.ID},
+	}
+	mockCollectionService, app := setupAutomationTestWithKey(t, apiKey)
+	mockCollectionService.On("GetByWorkspace", mock.Anything, workspaceID).Return([]models.Collection{*allowed, *other}, nil)
+	mockCollectionService.On("GetByID", mock.Anything, other.ID).Return(other, nil)
+	mockCollectionService.On("GetByWorkspaceAndName", mock.Anything, workspaceID, "Other").Return(other, nil)
+	mockCollectionService.On("GetByWorkspaceAndName", mock.Anything, workspaceID, "New").Return(nil, services.ErrCollectionNotFound)
+
+	t.Run("list", func(t *testing.T) {
+		rec := getAutomation(app, "/automation/collections")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		var response []dto.CollectionResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+		require.Len(t, response, 1)
+		assert.Equal(t, allowed.ID, response[0].ID)
+	})
+
+	t.Run("get", func(t *testing.T) {
+		rec := getAutomation(app, "/automation/collections/"+other.ID.String())
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	spec := `{"openapi": "3.0.0", "info": {"title": "T", "version": "1"}, "paths": {}}`
+	// Neither updating another collection nor creating one is allowed
+	for _, name := range []string{"Other", "New"} {
+		t.Run("upsert "+name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]any{"name": name, "spec": json.RawMessage(spec)})
+			req := httptest.NewRequest(http.MethodPut, "/automation/collections", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		})
+	}
+
+	mockCollectionService.AssertNotCalled(t, "CreateAs", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockCollectionService.AssertNotCalled(t, "ForceUpdate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func testOpenAPISpec(title string) string {
+	return `{"openapi": "3.0.0", "info": {"title": "` + title + `", "version": "1"}, "paths": {}}`
+}
+
+func putBatch(app *drift.Engine, contentType string, body []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPut, "/automation/collections/batch", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAutomationHandler_UpsertCollection_Create(t *testing.T) {
+	workspaceID := uuid.New()
+	apiKey := &models.WorkspaceAPIKey{ID: uuid.New(), WorkspaceID: workspaceID, Name: "CI", Scopes: models.DefaultAPIKeyScopes}
+	mockCollectionService, mockHub, app := setupAutomationTestWithHub(t, apiKey)
+	actor := models.Actor{Type: models.ActorTypeAPIKey, ID: apiKey.ID, Name: "CI"}
+	created := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Users", Version: 1}
+	mockCollectionService.On("GetByWorkspaceAndName", mock.Anything, workspaceID, "Users").Return(nil, services.ErrCollectionNotFound)
+	mockCollectionService.On("CreateAs", mock.Anything, workspaceID, "Users", mock.Anything, actor).Return(created, nil)
+	mockHub.On("BroadcastCollectionCreateAs", workspaceID, created.ID, actor, "Users", 1).Return()
+
+	body, _ := json.Marshal(map[string]any{"name": "Users", "spec": json.RawMessage(testOpenAPISpec("Users"))})
+	req := httptest.NewRequest(http.MethodPut, "/automation/collections", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var response dto.UpsertCollectionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, created.ID, response.ID)
+	assert.True(t, response.Created)
+	mockHub.AssertExpectations(t)
+}
+
+func TestAutomationHandler_UpsertCollection_ForceUpdate(t *testing.T) {
+	workspaceID := uuid.New()
+	apiKey := &models.WorkspaceAPIKey{ID: uuid.New(), WorkspaceID: workspaceID, Name: "CI", Scopes: models.DefaultAPIKeyScopes}
+	mockCollectionService, mockHub, app := setupAutomationTestWithHub(t, apiKey)
+	actor := models.APIKeyActor(apiKey)
+	existing := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Users", Data: json.RawMessage(`{}`), Version: 2}
+	updated := &models.Collection{ID: existing.ID, WorkspaceID: workspaceID, Name: "Users", Version: 3}
+	mockCollectionService.On("GetByWorkspaceAndName", mock.Anything, workspaceID, "Users").Return(existing, nil)
+	mockCollectionService.On("ForceUpdate", mock.Anything, existing.ID, "Users", mock.Anything, actor).Return(updated, nil)
+	mockHub.On("BroadcastCollectionUpdateAs", workspaceID, existing.ID, actor, "Users", 3).Return()
+
+	body, _ := json.Marshal(map[string]any{"name": "Users", "spec": json.RawMessage(testOpenAPISpec("Users"))})
+	req := httptest.NewRequest(http.MethodPut, "/automation/collections", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockHub.AssertExpectations(t)
+}
+
+func TestAutomationHandler_GetCollection_UpdatedByAPIKey(t *testing.T) {
+	workspaceID := uuid.New()
+	mockCollectionService, app := setupAutomationTest(t, workspaceID)
+	keyID := uuid.New()
+	keyName := "Deploy"
+	collection := &models.Collection{
+		ID:                  uuid.New(),
+		WorkspaceID:         workspaceID,
+		Name:                "Users",
+		Data:                json.RawMessage(`{}`),
+		Version:             3,
+		UpdatedByAPIKey:     &keyID,
+		UpdatedByAPIKeyName: &keyName,
+	}
+	mockCollectionService.On("GetByID", mock.Anything, collection.ID).Return(collection, nil)
+
+	rec := getAutomation(app, "/automation/collections/"+collection.ID.String())
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response dto.CollectionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Nil(t, response.UpdatedBy)
+	assert.Equal(t, &dto.Actor{Type: "api_key", ID: keyID, Name: "Deploy"}, response.UpdatedByActor)
+}
+
+func TestAutomationHandler_UpsertCollections_Multipart(t *testing.T) {
+	workspaceID := uuid.New()
+	apiKey := &models.WorkspaceAPIKey{ID: uuid.New(), WorkspaceID: workspaceID, Name: "CI", Scopes: models.DefaultAPIKeyScopes}
+	mockCollectionService, mockHub, app := setupAutomationTestWithHub(t, apiKey)
+	actor := models.APIKeyActor(apiKey)
+
+	existing := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Users API", Data: json.RawMessage(`{}`), Version: 3}
+	mockCollectionService.On("GetByWorkspaceAndName", mock.Anything, workspaceID, "Users API").Return(existing, nil)
+	mockCollectionService.On("GetByWorkspaceAndName", mock.Anything, workspaceID, "Billing").Return(nil, services.ErrCollectionNotFound)
+
+	createdID := uuid.New()
+	mockCollectionService.On("UpsertBatch", mock.Anything, workspaceID, mock.MatchedBy(func(upserts []services.CollectionUpsert) bool {
+		return len(upserts) == 2 &&
+			upserts[0].CollectionID == existing.ID && upserts[0].Name == "Users API" &&
+			upserts[1].CollectionID == uuid.Nil && upserts[1].Name == "Billing"
+	}), actor).Return([]models.Collection{
+		{ID: existing.ID, WorkspaceID: workspaceID, Name: "Users API", Version: 4},
+		{ID: createdID, WorkspaceID: workspaceID, Name: "Billing", Version: 1},
+	}, nil)
+	mockHub.On("BroadcastCollectionsBatch", workspaceID, actor, []hub.CollectionBatchItem{
+		{CollectionID: existing.ID, Name: "Users API", Version: 4, Created: false},
+		{CollectionID: createdID, Name: "Billing", Version: 1, Created: true},
+	}).Return()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("manifest", `[
+		{"file": "users.json", "name": "Users API"},
+		{"file": "billing.json", "name": "Billing", "resolution": "fail"}
+	]`))
+	for name, title := range map[string]string{"users.json": "Users", "billing.json": "Billing"} {
+		part, err := mw.CreateFormFile("specs", name)
+		require.NoError(t, err)
+		_, _ = part.Write([]byte(testOpenAPISpec(title)))
+	}
+	require.NoError(t, mw.Close())
+
+	rec := putBatch(app, mw.FormDataContentType(), body.Bytes())
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var response dto.BatchUpsertResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.True(t, response.Applied)
+	require.Len(t, response.Results, 2)
+	assert.Equal(t, "users.json", response.Results[0].File)
+	assert.Equal(t, 4, response.Results[0].Version)
+	assert.False(t, response.Results[0].Created)
+	assert.Equal(t, &createdID, response.Results[1].ID)
+	assert.True(t, response.Results[1].Created)
+	mockHub.AssertExpectations(t)
+}
+
+func TestAutomationHandler_UpsertCollections_Rejected(t *testing.T) {
+	workspaceID := uuid.New()
+	apiKey := &models.WorkspaceAPIKey{ID: uuid.New(), WorkspaceID: workspaceID, Scopes: models.DefaultAPIKeyScopes}
+	mockCollectionService, mockHub, app := setupAutomationTestWithHub(t, apiKey)
+
+	existing := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Users", Data: json.RawMessage(`{}`), Version: 3}
+	mockCollectionService.On("GetByWorkspaceAndName", mock.Anything, workspaceID, "Users").Return(existing, nil)
+	mockCollectionService.On("GetByWorkspaceAndName", mock.Anything, workspaceID, "Orders").Return(nil, services.ErrCollectionNotFound)
+
+	// Specs without a name are named after their title, so both Orders
+	// specs would create the same collection.
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	for _, f := range []struct{ name, content string }{
+		{"manifest.json", `[{"file": "users.json", "resolution": "fail", "name": "Users"}, {"file": "orders.json"}, {"file": "orders-v2.json"}]`},
+		{"users.json", testOpenAPISpec("Users")},
+		{"orders.json", testOpenAPISpec("Orders")},
+		{"orders-v2.json", testOpenAPISpec("Orders")},
+	} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.content))}))
+		_, _ = tw.Write([]byte(f.content))
+	}
+	require.NoError(t, tw.Close())
+
+	rec := putBatch(app, "application/x-tar", archive.Bytes())
+
+	require.Equal(t, http.StatusUnprocessableEntity, rec.Code, rec.Body.String())
+	var response dto.BatchUpsertResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.False(t, response.Applied)
+	require.Len(t, response.Results, 3)
+	assert.Equal(t, http.StatusConflict, response.Results[0].Status)
+	assert.Contains(t, response.Results[0].Error, "already exists")
+	assert.Zero(t, response.Results[1].Status)
+	assert.Equal(t, "Orders", response.Results[1].Name)
+	assert.Equal(t, http.StatusConflict, response.Results[2].Status)
+	assert.Contains(t, response.Results[2].Error, "more than one spec")
+
+	mockCollectionService.AssertNotCalled(t, "UpsertBatch", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockHub.AssertNotCalled(t, "BroadcastCollectionsBatch", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAutomationHandler_UpsertCollections_InvalidManifest(t *testing.T) {
+	_, app := setupAutomationTest(t, uuid.New())
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("manifest", `[{"file": "missing.json"}]`))
+	part, err := mw.CreateFormFile("specs", "users.json")
+	require.NoError(t, err)
+	_, _ = part.Write([]byte(testOpenAPISpec("Users")))
+	require.NoError(t, mw.Close())
+
+	rec := putBatch(app, mw.FormDataContentType(), body.Bytes())
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "missing.json")
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/dimitrije/nikode-api/internal/services"
 	"github.com/dimitrije/nikode-api/pkg/dto"
 	"github.com/google/uuid"
@@ -69,14 +70,7 @@ func (h *CollectionHandler) Create(c *drift.Context) {
 
 	h.hub.BroadcastCollectionCreate(collection.WorkspaceID, collection.ID, userID, collection.Name, collection.Version)
 
-	_ = c.JSON(201, dto.CollectionResponse{
-		ID:          collection.ID,
-		WorkspaceID: collection.WorkspaceID,
-		Name:        collection.Name,
-		Data:        collection.Data,
-		Version:     collection.Version,
-		UpdatedBy:   collection.UpdatedBy,
-	})
+	_ = c.JSON(201, collectionResponse(collection))
 }
 
 func (h *CollectionHandler) List(c *drift.Context) {
@@ -108,14 +102,7 @@ func (h *CollectionHandler) List(c *drift.Context) {
 
 	response := make([]dto.CollectionResponse, len(collections))
 	for i, col := range collections {
-		response[i] = dto.CollectionResponse{
-			ID:          col.ID,
-			WorkspaceID: col.WorkspaceID,
-			Name:        col.Name,
-			Data:        col.Data,
-			Version:     col.Version,
-			UpdatedBy:   col.UpdatedBy,
-		}
+		response[i] = collectionResponse(&col)
 	}
 
 	_ = c.JSON(200, response)
@@ -148,14 +135,7 @@ func (h *CollectionHandler) Get(c *drift.Context) {
 		return
 	}
 
-	_ = c.JSON(200, dto.CollectionResponse{
-		ID:          collection.ID,
-		WorkspaceID: collection.WorkspaceID,
-		Name:        collection.Name,
-		Data:        collection.Data,
-		Version:     collection.Version,
-		UpdatedBy:   collection.UpdatedBy,
-	})
+	_ = c.JSON(200, collectionResponse(collection))
 }
 
 func (h *CollectionHandler) Update(c *drift.Context) {
@@ -224,14 +204,7 @@ func (h *CollectionHandler) Update(c *drift.Context) {
 
 	h.hub.BroadcastCollectionUpdate(collection.WorkspaceID, collection.ID, userID, collection.Name, collection.Version)
 
-	_ = c.JSON(200, dto.CollectionResponse{
-		ID:          collection.ID,
-		WorkspaceID: collection.WorkspaceID,
-		Name:        collection.Name,
-		Data:        collection.Data,
-		Version:     collection.Version,
-		UpdatedBy:   collection.UpdatedBy,
-	})
+	_ = c.JSON(200, collectionResponse(collection))
 }
 
 func (h *CollectionHandler) Delete(c *drift.Context) {
@@ -270,3 +243,18 @@ func (h *CollectionHandler) Delete(c *drift.Context) {
 
 	_ = c.JSON(200, map[string]string{"message": "collection deleted"})
 }
+
+func collectionResponse(col *models.Collection) dto.CollectionResponse {
+	response := dto.CollectionResponse{
+		ID:          col.ID,
+		WorkspaceID: col.WorkspaceID,
+		Name:        col.Name,
+		Data:        col.Data,
+		Version:     col.Version,
+		UpdatedBy:   col.UpdatedBy,
+	}
+	if actor := col.UpdatedByActor(); actor != nil {
+		response.UpdatedByActor = &dto.Actor{Type: actor.Type, ID: actor.ID, Name: actor.Name}
+	}
+	return response
+}
@@ -0,0 +1,640 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"math"
+	"math/big"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+)
+
+// Device authorization flow (RFC 8628) for clients without a browser, such
+// as the CLI runner. The device requests a code pair, the user enters the
+// user code at the verification page and signs in with a provider, and the
+// device polls DeviceToken until the login is approved.
+const (
+	deviceCodeTTL      = 10 * time.Minute
+	devicePollInterval = 5 * time.Second
+
+	// Pending logins stay in the store this long past expiry, so late
+	// polls learn that the code expired
+	deviceExpiredGrace = time.Minute
+
+	// deviceUserCodeAttempts bounds retries when a new user code collides
+	// with a pending one
+	deviceUserCodeAttempts = 5
+
+	// deviceUserCodeChars avoids vowels and look-alike characters, so codes
+	// are easy to type and never spell words
+	deviceUserCodeChars  = "BCDFGHJKLMNPQRSTVWXZ"
+	deviceUserCodeLength = 8
+
+	// User code lookups are throttled per client IP, which keeps guessing
+	// a pending code impractical
+	deviceVerifyPerMinute = 10
+	deviceVerifyBurst     = 20
+
+	// Device codes are throttled per client network, and the number one
+	// network has pending at once is capped, since each one is a user code
+	// to guess. IPv6 clients are grouped by /64, which one host can rotate
+	// through freely
+	deviceCodePerMinute            = 5
+	deviceCodeBurst                = 10
+	maxPendingDeviceCodesPerClient = 20
+	deviceCodeRetryAfter           = time.Minute
+	deviceClientIPv6Bits           = 64
+)
+
+// deviceAuthorization is a pending device login. It is stored under its
+// device code until the device collects its tokens.
+type deviceAuthorization struct {
+	UserCode  string    `json:"user_code"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// ClientAddr and UserAgent describe the device that asked for the code,
+	// so the user can tell it apart from one a phisher started
+	ClientAddr string `json:"client_addr"`
+	UserAgent  string `json:"user_agent"`
+}
+
+// devicePollState tracks how often the device polls. Interval is the minimum
+// time between polls; it grows when the device polls too fast.
+type devicePollState struct {
+	Interval   time.Duration `json:"interval"`
+	LastPollAt time.Time     `json:"last_poll_at"`
+}
+
+// deviceApproval is stored once the user approves or denies a device login
+type deviceApproval struct {
+	UserID uuid.UUID `json:"user_id"`
+	Denied bool      `json:"denied,omitempty"`
+}
+
+// deviceConfirmation is a signed-in user's pending decision on a device
+// login. Its token is only shown on the confirmation page, so another site
+// can't post the approval for the user.
+type deviceConfirmation struct {
+	UserID     uuid.UUID `json:"user_id"`
+	DeviceCode string    `json:"device_code"`
+}
+
+type devicePage struct {
+	UserCode  string
+	Providers []string
+	Error     string
+	Approved  bool
+	Denied    bool
+	// TwoFactorToken asks for a second factor before approving
+	TwoFactorToken string
+	// ConfirmToken asks the signed-in user to approve the device described
+	// by ClientAddr and UserAgent
+	ConfirmToken string
+	ClientAddr   string
+	UserAgent    string
+}
+
+var devicePageTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Nikode - Sign in on your device</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; background: #f5f5f5; color: #333; display: flex; justify-content: center; padding: 60px 20px; margin: 0; }
+main { background: #fff; border-radius: 8px; padding: 32px; max-width: 400px; width: 100%; box-shadow: 0 1px 3px rgba(0,0,0,.1); }
+h1 { font-size: 22px; margin-top: 0; }
+input { font-size: 20px; letter-spacing: 2px; text-transform: uppercase; width: 100%; padding: 8px; box-sizing: border-box; margin: 8px 0 16px; }
+button { display: block; width: 100%; padding: 10px; margin-top: 8px; font-size: 15px; cursor: pointer; }
+.code { font-size: 24px; letter-spacing: 2px; font-weight: bold; }
+.error { color: #b00020; }
+.hint { color: #666; font-size: 14px; }
+</style>
+</head>
+<body>
+<main>
+{{if .Approved}}
+<h1>Device approved</h1>
+<p>You're signed in. Return to your device to continue.</p>
+{{else if .Denied}}
+<h1>Sign-in cancelled</h1>
+<p>The device was not signed in. You can close this page.</p>
+{{else if .ConfirmToken}}
+<h1>Approve this device?</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<p>A device is asking to sign in to your account with the code:</p>
+<p class="code">{{.UserCode}}</p>
+<p class="hint">Requested from {{if .ClientAddr}}{{.ClientAddr}}{{else}}an unknown address{{end}}{{if .UserAgent}} by {{.UserAgent}}{{end}}.</p>
+<p class="hint">Only approve if this code is shown on a device you're signing in on right now. If someone sent you this link, cancel.</p>
+<form method="post" action="/api/v1/device/approve">
+<input type="hidden" name="token" value="{{.ConfirmToken}}">
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Cancel</button>
+</form>
+{{else if .TwoFactorToken}}
+<h1>Two-factor authentication</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="post" action="/api/v1/device/2fa">
+<input type="hidden" name="token" value="{{.TwoFactorToken}}">
+<label for="code">Enter the code from your authenticator app or a recovery code</label>
+<input id="code" name="code" autocomplete="one-time-code" autofocus required>
+<button type="submit">Verify</button>
+</form>
+{{else}}
+<h1>Sign in on your device</h1>
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+<form method="get">
+<label for="user_code">Enter the code shown on your device</label>
+<input id="user_code" name="user_code" value="{{.UserCode}}" autocomplete="off" autofocus required>
+<p class="hint">Only continue if you started this sign-in yourself.</p>
+{{range .Providers}}<button type="submit" formaction="/api/v1/device/{{.}}">Continue with {{.}}</button>
+{{else}}<p class="error">No sign-in providers are configured.</p>
+{{end}}
+</form>
+{{end}}
+</main>
+</body>
+</html>
+`))
+
+// RequestDeviceCode starts a device login.
+func (h *AuthHandler) RequestDeviceCode(c *drift.Context) {
+	client := deviceClient(middleware.ClientAddr(c))
+	ok, retryAfter := h.deviceCodeLimiter.Allow(client, deviceCodePerMinute, deviceCodeBurst)
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.TooManyRequests("too many device code requests")
+		return
+	}
+
+	ctx := context.Background()
+
+	// Codes are counted per client across instances, so one client flooding
+	// them can't crowd out the store or other users' device logins
+	clientPrefix := deviceClientKeyPrefix + client.String() + ":"
+	pending, err := h.store.Count(ctx, clientPrefix)
+	if err != nil {
+		c.InternalServerError("failed to count device codes")
+		return
+	}
+	if pending >= maxPendingDeviceCodesPerClient {
+		c.Header("Retry-After", strconv.Itoa(int(deviceCodeRetryAfter.Seconds())))
+		c.TooManyRequests("too many pending device logins")
+		return
+	}
+
+	deviceCode, err := oauth.GenerateState()
+	if err != nil {
+		c.InternalServerError("failed to generate device code")
+		return
+	}
+
+	da := deviceAuthorization{
+		ExpiresAt:  time.Now().Add(deviceCodeTTL),
+		ClientAddr: middleware.ClientAddr(c),
+		UserAgent:  sessionDeviceName(c.GetHeader("User-Agent")),
+	}
+
+	for attempt := 0; da.UserCode == ""; attempt++ {
+		if attempt == deviceUserCodeAttempts {
+			c.InternalServerError("failed to generate user code")
+			return
+		}
+		userCode, err := generateUserCode()
+		if err != nil {
+			c.InternalServerError("failed to generate user code")
+			return
+		}
+		err = h.store.Add(ctx, deviceUserCodeKeyPrefix+userCode, []byte(deviceCode), deviceCodeTTL)
+		if errors.Is(err, services.ErrEphemeralValueExists) {
+			continue
+		}
+		if err != nil {
+			c.InternalServerError("failed to store device code")
+			return
+		}
+		da.UserCode = userCode
+	}
+
+	if err := services.PutJSON(ctx, h.store, deviceCodeKeyPrefix+deviceCode, da, deviceCodeTTL+deviceExpiredGrace); err != nil {
+		c.InternalServerError("failed to store device code")
+		return
+	}
+	if err := h.store.Put(ctx, clientPrefix+deviceCode, []byte{}, deviceCodeTTL); err != nil {
+		c.InternalServerError("failed to store device code")
+		return
+	}
+
+	userCode := formatUserCode(da.UserCode)
+	verificationURI := h.cfg.BaseURL + "/api/v1/device"
+
+	_ = c.JSON(200, dto.DeviceCodeResponse{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + userCode,
+		ExpiresIn:               int64(deviceCodeTTL.Seconds()),
+		Interval:                int64(devicePollInterval.Seconds()),
+	})
+}
+
+// DeviceToken is polled by the device. It answers with an RFC 8628 error
+// code until the user approves, then issues tokens once.
+func (h *AuthHandler) DeviceToken(c *drift.Context) {
+	var req dto.DeviceTokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.BadRequest("invalid request body")
+		return
+	}
+
+	if req.DeviceCode == "" {
+		c.BadRequest("device_code is required")
+		return
+	}
+
+	ctx := context.Background()
+
+	da, ok, err := h.loadDeviceAuth(ctx, req.DeviceCode)
+	if err != nil {
+		c.InternalServerError("failed to load device code")
+		return
+	}
+	if !ok {
+		deviceTokenError(c, "invalid_grant", "invalid device code")
+		return
+	}
+
+	now := time.Now()
+	if now.After(da.ExpiresAt) {
+		h.takeDeviceAuth(ctx, req.DeviceCode)
+		deviceTokenError(c, "expired_token", "device code expired")
+		return
+	}
+
+	var approval deviceApproval
+	err = services.GetJSON(ctx, h.store, deviceApprovalKeyPrefix+req.DeviceCode, &approval)
+	if errors.Is(err, services.ErrEphemeralValueNotFound) {
+		h.devicePending(ctx, c, req.DeviceCode, da, now)
+		return
+	}
+	if err != nil {
+		c.InternalServerError("failed to load device code")
+		return
+	}
+
+	// Of concurrent polls only the one that takes the login gets tokens
+	if !h.takeDeviceAuth(ctx, req.DeviceCode) {
+		deviceTokenError(c, "invalid_grant", "invalid device code")
+		return
+	}
+
+	if approval.Denied {
+		deviceTokenError(c, "access_denied", "the user denied the login")
+		return
+	}
+
+	userID := approval.UserID
+	user, err := h.userService.GetByID(ctx, userID)
+	if err != nil {
+		c.Unauthorized("user not found")
+		return
+	}
+
+	h.issueTokens(ctx, c, user, req.DeviceName)
+}
+
+// devicePending answers a poll for a login the user hasn't approved yet, and
+// asks the device to slow down if it polls too fast.
+func (h *AuthHandler) devicePending(ctx context.Context, c *drift.Context, deviceCode string, da deviceAuthorization, now time.Time) {
+	ps := devicePollState{Interval: devicePollInterval}
+	err := services.GetJSON(ctx, h.store, devicePollKeyPrefix+deviceCode, &ps)
+	if err != nil && !errors.Is(err, services.ErrEphemeralValueNotFound) {
+		c.InternalServerError("failed to load device code")
+		return
+	}
+
+	tooFast := now.Sub(ps.LastPollAt) < ps.Interval
+	if tooFast {
+		ps.Interval += devicePollInterval
+	}
+	ps.LastPollAt = now
+	if err := services.PutJSON(ctx, h.store, devicePollKeyPrefix+deviceCode, ps, da.ExpiresAt.Sub(now)); err != nil {
+		c.InternalServerError("failed to store device code")
+		return
+	}
+
+	if tooFast {
+		deviceTokenError(c, "slow_down", "polling too frequently")
+		return
+	}
+	deviceTokenError(c, "authorization_pending", "waiting for the user to approve the login")
+}
+
+// DevicePage is the verification page where the user enters the user code
+// and picks a provider to sign in with.
+func (h *AuthHandler) DevicePage(c *drift.Context) {
+	h.renderDevicePage(c, 200, devicePage{UserCode: c.QueryParam("user_code")})
+}
+
+// DeviceLogin checks the user code and sends the user to the provider. The
+// provider redirects back to the usual callback, which asks the user to
+// approve the device instead of signing in the browser.
+func (h *AuthHandler) DeviceLogin(c *drift.Context) {
+	provider := c.Param("provider")
+	rawUserCode := c.QueryParam("user_code")
+
+	ok, retryAfter := h.deviceVerifyLimiter.Allow(uuid.NewSHA1(uuid.NameSpaceOID, []byte(middleware.ClientAddr(c))), deviceVerifyPerMinute, deviceVerifyBurst)
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		h.renderDevicePage(c, 429, devicePage{UserCode: rawUserCode, Error: "Too many attempts. Wait a minute and try again."})
+		return
+	}
+
+	ctx := context.Background()
+
+	deviceCode, ok, err := h.lookupUserCode(ctx, normalizeUserCode(rawUserCode))
+	if err != nil {
+		c.InternalServerError("failed to load device code")
+		return
+	}
+	if !ok {
+		h.renderDevicePage(c, 400, devicePage{UserCode: rawUserCode, Error: "That code is invalid or has expired."})
+		return
+	}
+
+	state, err := oauth.GenerateState()
+	if err != nil {
+		c.InternalServerError("failed to generate state")
+		return
+	}
+
+	sd := stateData{DeviceCode: deviceCode}
+
+	var consentURL string
+	if p, ok := h.providers[provider]; ok {
+		consentURL = p.GetConsentURL(state)
+	} else if p, ok := h.samlProviders[provider]; ok {
+		consentURL, sd.SAMLRequestID, err = p.AuthnRequestURL(state)
+		if err != nil {
+			c.InternalServerError("failed to create SAML request")
+			return
+		}
+	} else {
+		h.renderDevicePage(c, 400, devicePage{UserCode: rawUserCode, Error: "Unsupported provider: " + provider})
+		return
+	}
+
+	if err := h.putState(ctx, state, sd); err != nil {
+		c.InternalServerError("failed to store state")
+		return
+	}
+
+	c.Redirect(302, consentURL)
+}
+
+// completeDevice approves a pending device login for the user an identity
+// provider vouched for.
+func (h *AuthHandler) completeDevice(ctx context.Context, c *drift.Context, deviceCode string, userInfo *oauth.UserInfo) {
+	user, err := h.userService.FindOrCreateFromOAuth(ctx, userInfo)
+	if err != nil {
+		if errors.Is(err, services.ErrEmailInUse) {
+			h.deviceError(c, "An account with this email already exists; sign in with your usual provider.")
+			return
+		}
+		h.deviceError(c, "Failed to sign in.")
+		return
+	}
+
+	challenge, required, err := h.startTwoFactor(ctx, user.ID, deviceCode)
+	if err != nil {
+		h.deviceError(c, "Failed to sign in.")
+		return
+	}
+	if required {
+		h.renderDevicePage(c, 200, devicePage{TwoFactorToken: challenge})
+		return
+	}
+
+	h.confirmDevice(ctx, c, deviceCode, user.ID)
+}
+
+// confirmDevice shows the signed-in user which device asked to sign in, and
+// asks them to approve it. Signing in alone never approves a device, so a
+// link with someone else's user code can't sign their device in unnoticed.
+func (h *AuthHandler) confirmDevice(ctx context.Context, c *drift.Context, deviceCode string, userID uuid.UUID) {
+	da, ok, err := h.loadDeviceAuth(ctx, deviceCode)
+	if err != nil {
+		h.deviceError(c, "Failed to sign in.")
+		return
+	}
+	if !ok || !time.Now().Before(da.ExpiresAt) {
+		h.deviceError(c, "That code has expired. Start the sign-in again on your device.")
+		return
+	}
+
+	token, err := oauth.GenerateState()
+	if err != nil {
+		h.deviceError(c, "Failed to sign in.")
+		return
+	}
+	dc := deviceConfirmation{UserID: userID, DeviceCode: deviceCode}
+	if err := services.PutJSON(ctx, h.store, deviceConfirmKeyPrefix+token, dc, time.Until(da.ExpiresAt)); err != nil {
+		h.deviceError(c, "Failed to sign in.")
+		return
+	}
+
+	h.renderDevicePage(c, 200, devicePage{
+		ConfirmToken: token,
+		UserCode:     formatUserCode(da.UserCode),
+		ClientAddr:   da.ClientAddr,
+		UserAgent:    da.UserAgent,
+	})
+}
+
+// ApproveDevice records the user's decision from the confirmation page.
+func (h *AuthHandler) ApproveDevice(c *drift.Context) {
+	ctx := context.Background()
+
+	var dc deviceConfirmation
+	if err := services.TakeJSON(ctx, h.store, deviceConfirmKeyPrefix+c.PostForm("token"), &dc); err != nil {
+		h.deviceError(c, "That sign-in has expired. Start the sign-in again on your device.")
+		return
+	}
+
+	approval := deviceApproval{UserID: dc.UserID, Denied: c.PostForm("action") != "approve"}
+	h.approveDevice(ctx, c, dc.DeviceCode, approval)
+}
+
+// approveDevice lets the device poll for tokens of the user, or tells it the
+// user refused
+func (h *AuthHandler) approveDevice(ctx context.Context, c *drift.Context, deviceCode string, approval deviceApproval) {
+	da, ok, err := h.loadDeviceAuth(ctx, deviceCode)
+	if err != nil {
+		h.deviceError(c, "Failed to sign in.")
+		return
+	}
+	if !ok || !time.Now().Before(da.ExpiresAt) {
+		h.deviceError(c, "That code has expired. Start the sign-in again on your device.")
+		return
+	}
+
+	value, err := json.Marshal(approval)
+	if err != nil {
+		h.deviceError(c, "Failed to sign in.")
+		return
+	}
+
+	// A login is decided once; a second approval can't swap the user
+	err = h.store.Add(ctx, deviceApprovalKeyPrefix+deviceCode, value, time.Until(da.ExpiresAt))
+	if errors.Is(err, services.ErrEphemeralValueExists) {
+		h.deviceError(c, "That code has already been used. Start the sign-in again on your device.")
+		return
+	}
+	if err != nil {
+		h.deviceError(c, "Failed to sign in.")
+		return
+	}
+
+	h.renderDevicePage(c, 200, devicePage{Approved: !approval.Denied, Denied: approval.Denied})
+}
+
+// deviceError shows a failed device approval on the verification page
+func (h *AuthHandler) deviceError(c *drift.Context, errMsg string) {
+	h.renderDevicePage(c, 400, devicePage{Error: errMsg})
+}
+
+func (h *AuthHandler) renderDevicePage(c *drift.Context, status int, page devicePage) {
+	if !page.Approved && !page.Denied && page.ConfirmToken == "" {
+		for name := range h.providers {
+			page.Providers = append(page.Providers, name)
+		}
+		for name := range h.samlProviders {
+			page.Providers = append(page.Providers, name)
+		}
+		sort.Strings(page.Providers)
+	}
+
+	var b strings.Builder
+	if err := devicePageTemplate.Execute(&b, page); err != nil {
+		c.InternalServerError("failed to render page")
+		return
+	}
+
+	// The page approves logins; don't let other sites frame it or learn
+	// its tokens through the referrer
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Referrer-Policy", "no-referrer")
+	_ = c.HTML(status, b.String())
+}
+
+// loadDeviceAuth returns a device login; it reports false if the device code
+// is unknown
+func (h *AuthHandler) loadDeviceAuth(ctx context.Context, deviceCode string) (deviceAuthorization, bool, error) {
+	var da deviceAuthorization
+	err := services.GetJSON(ctx, h.store, deviceCodeKeyPrefix+deviceCode, &da)
+	if errors.Is(err, services.ErrEphemeralValueNotFound) {
+		return deviceAuthorization{}, false, nil
+	}
+	if err != nil {
+		return deviceAuthorization{}, false, err
+	}
+	return da, true, nil
+}
+
+// lookupUserCode returns the device code of a pending login the user can
+// still approve
+func (h *AuthHandler) lookupUserCode(ctx context.Context, userCode string) (string, bool, error) {
+	value, err := h.store.Get(ctx, deviceUserCodeKeyPrefix+userCode)
+	if errors.Is(err, services.ErrEphemeralValueNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	deviceCode := string(value)
+
+	da, ok, err := h.loadDeviceAuth(ctx, deviceCode)
+	if err != nil || !ok || !time.Now().Before(da.ExpiresAt) {
+		return "", false, err
+	}
+
+	_, err = h.store.Get(ctx, deviceApprovalKeyPrefix+deviceCode)
+	if errors.Is(err, services.ErrEphemeralValueNotFound) {
+		return deviceCode, true, nil
+	}
+	return "", false, err
+}
+
+// takeDeviceAuth removes a device login with its user code, approval and
+// poll state. Pending confirmations fail once the login is gone. It reports false if another request removed it first.
+func (h *AuthHandler) takeDeviceAuth(ctx context.Context, deviceCode string) bool {
+	var da deviceAuthorization
+	if err := services.TakeJSON(ctx, h.store, deviceCodeKeyPrefix+deviceCode, &da); err != nil {
+		return false
+	}
+	_, _ = h.store.Take(ctx, deviceUserCodeKeyPrefix+da.UserCode)
+	_, _ = h.store.Take(ctx, deviceApprovalKeyPrefix+deviceCode)
+	_, _ = h.store.Take(ctx, devicePollKeyPrefix+deviceCode)
+	_, _ = h.store.Take(ctx, deviceClientKeyPrefix+deviceClient(da.ClientAddr).String()+":"+deviceCode)
+	return true
+}
+
+// deviceClient identifies the client network a device login comes from: the
+// address for IPv4 and its /64 for IPv6.
+func deviceClient(addr string) uuid.UUID {
+	if ip, err := netip.ParseAddr(addr); err == nil {
+		ip = ip.Unmap()
+		addr = ip.String()
+		if ip.Is6() {
+			prefix, _ := ip.Prefix(deviceClientIPv6Bits)
+			addr = prefix.String()
+		}
+	}
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(addr))
+}
+
+func deviceTokenError(c *drift.Context, code, message string) {
+	_ = c.JSON(400, map[string]string{"error": code, "message": message})
+}
+
+func generateUserCode() (string, error) {
+	alphabet := big.NewInt(int64(len(deviceUserCodeChars)))
+	code := make([]byte, deviceUserCodeLength)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, alphabet)
+		if err != nil {
+			return "", err
+		}
+		code[i] = deviceUserCodeChars[n.Int64()]
+	}
+	return string(code), nil
+}
+
+// formatUserCode splits a user code in two halves for readability
+func formatUserCode(code string) string {
+	return code[:len(code)/2] + "-" + code[len(code)/2:]
+}
+
+// normalizeUserCode accepts codes typed in any case, with or without the
+// separator
+func normalizeUserCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
@@ -0,0 +1,410 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	driftmw "github.com/m1z23r/drift/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupDeviceTest(t *testing.T) (*testutil.MockUserService, *testutil.MockTokenService, *testutil.MockJWTService, *testutil.MockOAuthProvider, *AuthHandler, *drift.Engine) {
+	t.Helper()
+	mockUserService, mockTokenService, mockJWTService, handler, cfg := setupAuthTest(t)
+	cfg.BaseURL = "https://api.example.com"
+
+	mockProvider := new(testutil.MockOAuthProvider)
+	handler.providers["github"] = mockProvider
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Post("/auth/device/code", handler.RequestDeviceCode)
+	app.Post("/auth/device/token", handler.DeviceToken)
+	app.Get("/auth/:provider/callback", handler.Callback)
+	app.Get("/device", handler.DevicePage)
+	app.Get("/device/:provider", handler.DeviceLogin)
+	app.Post("/device/approve", handler.ApproveDevice)
+
+	return mockUserService, mockTokenService, mockJWTService, mockProvider, handler, app
+}
+
+func storeDeviceAuth(t *testing.T, handler *AuthHandler, deviceCode string, da deviceAuthorization) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, services.PutJSON(ctx, handler.store, deviceCodeKeyPrefix+deviceCode, da, time.Minute))
+	require.NoError(t, handler.store.Put(ctx, deviceUserCodeKeyPrefix+da.UserCode, []byte(deviceCode), time.Minute))
+}
+
+func loadDeviceApproval(handler *AuthHandler, deviceCode string) (uuid.UUID, bool) {
+	var approval deviceApproval
+	err := services.GetJSON(context.Background(), handler.store, deviceApprovalKeyPrefix+deviceCode, &approval)
+	return approval.UserID, err == nil
+}
+
+// confirmToken returns the token of the device confirmation page
+func confirmToken(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	match := regexp.MustCompile(`name="token" value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	require.Len(t, match, 2)
+	return match[1]
+}
+
+func postDeviceDecision(app *drift.Engine, token, action string) *httptest.ResponseRecorder {
+	form := url.Values{"token": {token}, "action": {action}}
+	req := httptest.NewRequest(http.MethodPost, "/device/approve", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func requestDeviceCode(t *testing.T, app *drift.Engine) dto.DeviceCodeResponse {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/auth/device/code", nil)
+	req.Header.Set("User-Agent", "nikode-cli/1.0")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var response dto.DeviceCodeResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response
+}
+
+func pollDeviceToken(app *drift.Engine, deviceCode string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(dto.DeviceTokenRequest{DeviceCode: deviceCode})
+	req := httptest.NewRequest(http.MethodPost, "/auth/device/token", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func deviceErrorCode(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	var response map[string]string
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	return response["error"]
+}
+
+func TestAuthHandler_RequestDeviceCode(t *testing.T) {
+	_, _, _, _, _, app := setupDeviceTest(t)
+
+	response := requestDeviceCode(t, app)
+
+	assert.NotEmpty(t, response.DeviceCode)
+	assert.Regexp(t, `^[BCDFGHJKLMNPQRSTVWXZ]{4}-[BCDFGHJKLMNPQRSTVWXZ]{4}$`, response.UserCode)
+	assert.Equal(t, "https://api.example.com/api/v1/device", response.VerificationURI)
+	assert.Equal(t, response.VerificationURI+"?user_code="+response.UserCode, response.VerificationURIComplete)
+	assert.Equal(t, int64(600), response.ExpiresIn)
+	assert.Equal(t, int64(5), response.Interval)
+}
+
+func TestAuthHandler_RequestDeviceCode_Throttled(t *testing.T) {
+	_, _, _, _, _, app := setupDeviceTest(t)
+
+	// A rotating X-Forwarded-For from an untrusted peer doesn't reset the limit
+	var rec *httptest.ResponseRecorder
+	for i := range deviceCodeBurst + 1 {
+		req := httptest.NewRequest(http.MethodPost, "/auth/device/code", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113."+strconv.Itoa(i))
+		rec = httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestAuthHandler_RequestDeviceCode_PendingCap(t *testing.T) {
+	_, _, _, _, handler, app := setupDeviceTest(t)
+
+	// httptest requests come from 192.0.2.1
+	clientPrefix := deviceClientKeyPrefix + deviceClient("192.0.2.1").String() + ":"
+	for i := range maxPendingDeviceCodesPerClient {
+		require.NoError(t, handler.store.Put(context.Background(), clientPrefix+strconv.Itoa(i), []byte{}, time.Minute))
+	}
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/device/code", nil))
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("Retry-After"))
+
+	// Other clients can still start device logins
+	req := httptest.NewRequest(http.MethodPost, "/auth/device/code", nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestDeviceClient(t *testing.T) {
+	assert.Equal(t, deviceClient("2001:db8::1"), deviceClient("2001:db8::ffff"), "IPv6 clients are grouped by /64")
+	assert.NotEqual(t, deviceClient("2001:db8::1"), deviceClient("2001:db8:0:1::1"))
+	assert.NotEqual(t, deviceClient("192.0.2.1"), deviceClient("192.0.2.2"))
+	assert.Equal(t, deviceClient("192.0.2.1"), deviceClient("::ffff:192.0.2.1"))
+}
+
+func TestAuthHandler_DeviceFlow(t *testing.T) {
+	mockUserService, mockTokenService, mockJWTService, mockProvider, handler, app := setupDeviceTest(t)
+	code := requestDeviceCode(t, app)
+
+	// The device polls before the user approves
+	rec := pollDeviceToken(app, code.DeviceCode)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "authorization_pending", deviceErrorCode(t, rec))
+
+	// The user enters the code in lowercase and picks GitHub
+	var state string
+	mockProvider.On("GetConsentURL", mock.Anything).Run(func(args mock.Arguments) {
+		state = args.String(0)
+	}).Return("https://github.com/login/oauth/authorize")
+
+	rec = httptest.NewRecorder()
+	userCode := strings.ToLower(strings.ReplaceAll(code.UserCode, "-", ""))
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/device/github?user_code="+userCode, nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://github.com/login/oauth/authorize", rec.Header().Get("Location"))
+
+	// GitHub redirects back to the callback, which asks the user to confirm
+	// the device instead of approving it
+	userID := uuid.New()
+	userInfo := &oauth.UserInfo{Email: "ada@example.com", ID: "1", Provider: "github"}
+	mockProvider.On("ExchangeCode", mock.Anything, "gh-code").Return(userInfo, nil)
+	mockUserService.On("FindOrCreateFromOAuth", mock.Anything, userInfo).Return(&models.User{ID: userID}, nil)
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/github/callback?code=gh-code&state="+state, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Approve this device?")
+	assert.Contains(t, rec.Body.String(), code.UserCode)
+	assert.Contains(t, rec.Body.String(), "Requested from 192.0.2.1 by nikode-cli/1.0.")
+	assert.NotContains(t, rec.Body.String(), "Device approved")
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	_, approved := loadDeviceApproval(handler, code.DeviceCode)
+	assert.False(t, approved)
+
+	// The user approves on the confirmation page
+	token := confirmToken(t, rec)
+	rec = postDeviceDecision(app, token, "approve")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Device approved")
+
+	// The next poll receives tokens, exactly once
+	user := &models.User{ID: userID, Email: "ada@example.com", GlobalRole: "user"}
+	mockUserService.On("GetByID", mock.Anything, userID).Return(user, nil)
+	sessionID := uuid.New()
+	mockTokenService.On("CreateSession", mock.Anything, userID, "", mock.Anything, mock.Anything).
+		Return(&models.Session{ID: sessionID, UserID: userID}, nil)
+	mockJWTService.On("GenerateTokenPair", userID, sessionID, "ada@example.com", "user").Return(&services.TokenPair{
+		AccessToken: "access", RefreshToken: "refresh", ExpiresIn: 900,
+	}, nil)
+	mockJWTService.On("RefreshExpiry").Return(7 * 24 * time.Hour)
+	mockTokenService.On("StoreRefreshToken", mock.Anything, userID, sessionID, services.HashToken("refresh"), mock.Anything).Return(nil)
+
+	rec = pollDeviceToken(app, code.DeviceCode)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var tokens dto.TokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &tokens))
+	assert.Equal(t, "access", tokens.AccessToken)
+	assert.Equal(t, "refresh", tokens.RefreshToken)
+
+	rec = pollDeviceToken(app, code.DeviceCode)
+	assert.Equal(t, "invalid_grant", deviceErrorCode(t, rec))
+	_, err := handler.store.Get(context.Background(), deviceUserCodeKeyPrefix+normalizeUserCode(code.UserCode))
+	assert.ErrorIs(t, err, services.ErrEphemeralValueNotFound)
+	mockProvider.AssertExpectations(t)
+	mockTokenService.AssertExpectations(t)
+}
+
+func TestAuthHandler_DeviceToken_SlowDown(t *testing.T) {
+	_, _, _, _, handler, app := setupDeviceTest(t)
+	code := requestDeviceCode(t, app)
+
+	assert.Equal(t, "authorization_pending", deviceErrorCode(t, pollDeviceToken(app, code.DeviceCode)))
+	assert.Equal(t, "slow_down", deviceErrorCode(t, pollDeviceToken(app, code.DeviceCode)))
+
+	var ps devicePollState
+	require.NoError(t, services.GetJSON(context.Background(), handler.store, devicePollKeyPrefix+code.DeviceCode, &ps))
+	assert.Equal(t, 10*time.Second, ps.Interval)
+}
+
+func TestAuthHandler_DeviceToken_Expired(t *testing.T) {
+	_, _, _, _, handler, app := setupDeviceTest(t)
+	storeDeviceAuth(t, handler, "device-code", deviceAuthorization{UserCode: "BCDFGHJK", ExpiresAt: time.Now().Add(-time.Second)})
+
+	rec := pollDeviceToken(app, "device-code")
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "expired_token", deviceErrorCode(t, rec))
+	assert.Equal(t, "invalid_grant", deviceErrorCode(t, pollDeviceToken(app, "device-code")))
+}
+
+func TestAuthHandler_DeviceToken_OtherInstance(t *testing.T) {
+	_, _, _, _, handler, app := setupDeviceTest(t)
+	_, _, _, _, other, otherApp := setupDeviceTest(t)
+	other.store = handler.store
+
+	// The device code is issued by one instance and polled on another
+	code := requestDeviceCode(t, app)
+
+	assert.Equal(t, "authorization_pending", deviceErrorCode(t, pollDeviceToken(otherApp, code.DeviceCode)))
+	assert.Equal(t, "slow_down", deviceErrorCode(t, pollDeviceToken(app, code.DeviceCode)))
+}
+
+func TestAuthHandler_ApproveDevice_Once(t *testing.T) {
+	_, _, _, _, handler, _ := setupDeviceTest(t)
+	storeDeviceAuth(t, handler, "device-code", deviceAuthorization{UserCode: "BCDFGHJK", ExpiresAt: time.Now().Add(time.Minute)})
+	userID := uuid.New()
+
+	app := drift.New()
+	app.Get("/approve/:user", func(c *drift.Context) {
+		handler.approveDevice(context.Background(), c, "device-code", deviceApproval{UserID: uuid.MustParse(c.Param("user"))})
+	})
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/approve/"+userID.String(), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// A second approval can't swap the user, and the code can't be entered again
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/approve/"+uuid.New().String(), nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	approvedID, _ := loadDeviceApproval(handler, "device-code")
+	assert.Equal(t, userID, approvedID)
+
+	_, ok, err := handler.lookupUserCode(context.Background(), "BCDFGHJK")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestAuthHandler_ApproveDevice_Denied(t *testing.T) {
+	_, _, _, _, handler, app := setupDeviceTest(t)
+	code := requestDeviceCode(t, app)
+	require.NoError(t, services.PutJSON(context.Background(), handler.store, deviceConfirmKeyPrefix+"confirm",
+		deviceConfirmation{UserID: uuid.New(), DeviceCode: code.DeviceCode}, time.Minute))
+
+	rec := postDeviceDecision(app, "confirm", "deny")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Sign-in cancelled")
+
+	assert.Equal(t, "access_denied", deviceErrorCode(t, pollDeviceToken(app, code.DeviceCode)))
+	assert.Equal(t, "invalid_grant", deviceErrorCode(t, pollDeviceToken(app, code.DeviceCode)))
+}
+
+func TestAuthHandler_ApproveDevice_InvalidToken(t *testing.T) {
+	_, _, _, _, handler, app := setupDeviceTest(t)
+	code := requestDeviceCode(t, app)
+	require.NoError(t, services.PutJSON(context.Background(), handler.store, deviceConfirmKeyPrefix+"confirm",
+		deviceConfirmation{UserID: uuid.New(), DeviceCode: code.DeviceCode}, time.Minute))
+
+	// A cross-site post doesn't know the token of the user's page
+	rec := postDeviceDecision(app, "forged", "approve")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "authorization_pending", deviceErrorCode(t, pollDeviceToken(app, code.DeviceCode)))
+
+	// The token is single-use
+	assert.Equal(t, http.StatusOK, postDeviceDecision(app, "confirm", "approve").Code)
+	assert.Equal(t, http.StatusBadRequest, postDeviceDecision(app, "confirm", "approve").Code)
+}
+
+func TestAuthHandler_DeviceToken_MissingCode(t *testing.T) {
+	_, _, _, _, _, app := setupDeviceTest(t)
+
+	rec := pollDeviceToken(app, "")
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "device_code is required")
+}
+
+func TestAuthHandler_DevicePage(t *testing.T) {
+	_, _, _, _, _, app := setupDeviceTest(t)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, `/device?user_code="><script>`, nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, rec.Body.String(), `formaction="/api/v1/device/github"`)
+	assert.NotContains(t, rec.Body.String(), "<script>")
+}
+
+func TestAuthHandler_DeviceLogin_InvalidCode(t *testing.T) {
+	_, _, _, mockProvider, _, app := setupDeviceTest(t)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/device/github?user_code=BCDF-GHJK", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid or has expired")
+	mockProvider.AssertNotCalled(t, "GetConsentURL", mock.Anything)
+}
+
+func TestAuthHandler_DeviceLogin_Throttled(t *testing.T) {
+	_, _, _, _, _, app := setupDeviceTest(t)
+
+	var rec *httptest.ResponseRecorder
+	for range deviceVerifyBurst + 1 {
+		rec = httptest.NewRecorder()
+		app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/device/github?user_code=BCDF-GHJK", nil))
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestAuthHandler_DeviceLogin_ForwardedForIgnored(t *testing.T) {
+	_, _, _, _, _, app := setupDeviceTest(t)
+
+	// A rotating X-Forwarded-For from an untrusted peer doesn't reset the limit
+	var rec *httptest.ResponseRecorder
+	for i := range deviceVerifyBurst + 1 {
+		req := httptest.NewRequest(http.MethodGet, "/device/github?user_code=BCDF-GHJK", nil)
+		req.Header.Set("X-Forwarded-For", "203.0.113."+strconv.Itoa(i))
+		rec = httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+}
+
+func TestAuthHandler_Callback_DeviceExchangeError(t *testing.T) {
+	_, _, _, mockProvider, handler, app := setupDeviceTest(t)
+	code := requestDeviceCode(t, app)
+	storeState(t, handler, "device-state", stateData{DeviceCode: code.DeviceCode}, time.Minute)
+	mockProvider.On("ExchangeCode", mock.Anything, "bad-code").Return(nil, assert.AnError)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/github/callback?code=bad-code&state=device-state", nil))
+
+	// Device approvals report errors on the page, not through the app's deep link
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "failed to exchange code")
+	assert.Equal(t, "authorization_pending", deviceErrorCode(t, pollDeviceToken(app, code.DeviceCode)))
+}
+
+func TestNormalizeUserCode(t *testing.T) {
+	assert.Equal(t, "BCDFGHJK", normalizeUserCode("bcdf-ghjk"))
+	assert.Equal(t, "BCDFGHJK", normalizeUserCode(" BCDF GHJK "))
+	assert.Equal(t, "BCDF-GHJK", formatUserCode("BCDFGHJK"))
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+)
+
+type ExportHandler struct {
+	exportService     ExportServiceInterface
+	collectionService CollectionServiceInterface
+	workspaceService  WorkspaceServiceInterface
+}
+
+func NewExportHandler(
+	exportService ExportServiceInterface,
+	collectionService CollectionServiceInterface,
+	workspaceService WorkspaceServiceInterface,
+) *ExportHandler {
+	return &ExportHandler{
+		exportService:     exportService,
+		collectionService: collectionService,
+		workspaceService:  workspaceService,
+	}
+}
+
+// Export renders a collection as OpenAPI, Postman, curl or HAR and streams it
+// as a download.
+func (h *ExportHandler) Export(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	workspaceID, err := uuid.Parse(c.Param("workspaceId"))
+	if err != nil {
+		c.BadRequest("invalid workspace id")
+		return
+	}
+
+	collectionID, err := uuid.Parse(c.Param("collectionId"))
+	if err != nil {
+		c.BadRequest("invalid collection id")
+		return
+	}
+
+	ctx := context.Background()
+
+	collection, err := h.collectionService.GetByID(ctx, collectionID)
+	if err != nil || collection.WorkspaceID != workspaceID {
+		c.NotFound("collection not found")
+		return
+	}
+
+	canAccess, err := h.workspaceService.CanAccess(ctx, workspaceID, userID)
+	if err != nil || !canAccess {
+		c.NotFound("collection not found")
+		return
+	}
+
+	writeExport(c, h.exportService, collection)
+}
+
+// writeExport renders collection with the options from the query string and
+// streams the result.
+func writeExport(c *drift.Context, exportService ExportServiceInterface, collection *models.Collection) {
+	opts := services.ExportOptions{
+		Format:      services.ExportFormat(c.DefaultQuery("format", string(services.ExportFormatOpenAPI))),
+		Environment: c.QueryParam("environment"),
+		Variables:   services.VariableMode(c.QueryParam("variables")),
+	}
+
+	result, err := exportService.Export(collection.Name, collection.Data, opts)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUnsupportedExportFormat):
+			c.BadRequest("format must be one of: openapi, postman, curl, har")
+		case errors.Is(err, services.ErrInvalidVariableMode):
+			c.BadRequest("variables must be one of: keep, substitute")
+		case errors.Is(err, services.ErrEnvironmentNotFound):
+			c.NotFound("environment not found")
+		default:
+			c.InternalServerError("failed to export collection")
+		}
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, result.Filename))
+	_ = c.Stream(200, result.ContentType, bytes.NewReader(result.Body))
+}
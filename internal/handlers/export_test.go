@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupExportTest(t *testing.T) (*testutil.MockCollectionService, *testutil.MockWorkspaceService, *drift.Engine, *services.JWTService) {
+	t.Helper()
+	mockCollectionService := new(testutil.MockCollectionService)
+	mockWorkspaceService := new(testutil.MockWorkspaceService)
+	handler := NewExportHandler(services.NewExportService(), mockCollectionService, mockWorkspaceService)
+	jwtSvc := services.NewJWTService("test-secret-key", 15*time.Minute, 24*time.Hour)
+
+	app := drift.New()
+	app.Use(middleware.Auth(jwtSvc))
+	app.Get("/workspaces/:workspaceId/collections/:collectionId/export", handler.Export)
+
+	return mockCollectionService, mockWorkspaceService, app, jwtSvc
+}
+
+func getExport(t *testing.T, app *drift.Engine, token string, workspaceID, collectionID uuid.UUID, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/workspaces/"+workspaceID.String()+"/collections/"+collectionID.String()+"/export"+query, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestExportHandler_Export_Curl(t *testing.T) {
+	mockCollectionService, mockWorkspaceService, app, jwtSvc := setupExportTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	collection := &models.Collection{
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		Name:        "Partner API",
+		Data: json.RawMessage(`{
+			"activeEnvironmentId": "env-default",
+			"environments": [{"id": "env-default", "name": "Default", "variables": [{"key": "baseUrl", "value": "https://api.example.com", "enabled": true}]}],
+			"items": [{"id": "r1", "type": "request", "name": "Ping", "method": "GET", "url": "{{baseUrl}}/ping"}]
+		}`),
+		Version: 3,
+	}
+
+	mockCollectionService.On("GetByID", mock.Anything, collection.ID).Return(collection, nil)
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	rec := getExport(t, app, generateTestToken(t, jwtSvc, userID, "test@example.com"), workspaceID, collection.ID, "?format=curl&variables=substitute")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/x-sh", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="partner-api.sh"`, rec.Header().Get("Content-Disposition"))
+	assert.Contains(t, rec.Body.String(), "# Ping\ncurl \"https://api.example.com/ping\"\n")
+}
+
+func TestExportHandler_Export_DefaultsToOpenAPI(t *testing.T) {
+	mockCollectionService, mockWorkspaceService, app, jwtSvc := setupExportTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	collection := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Partner API", Data: json.RawMessage(`{"items": []}`)}
+
+	mockCollectionService.On("GetByID", mock.Anything, collection.ID).Return(collection, nil)
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	rec := getExport(t, app, generateTestToken(t, jwtSvc, userID, "test@example.com"), workspaceID, collection.ID, "")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/vnd.oai.openapi+json", rec.Header().Get("Content-Type"))
+
+	var doc map[string]any
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc["openapi"])
+}
+
+func TestExportHandler_Export_InvalidOptions(t *testing.T) {
+	mockCollectionService, mockWorkspaceService, app, jwtSvc := setupExportTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	collection := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Partner API", Data: json.RawMessage(`{"items": []}`)}
+
+	mockCollectionService.On("GetByID", mock.Anything, collection.ID).Return(collection, nil)
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(true, nil)
+	token := generateTestToken(t, jwtSvc, userID, "test@example.com")
+
+	rec := getExport(t, app, token, workspaceID, collection.ID, "?format=wsdl")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "format must be one of")
+
+	rec = getExport(t, app, token, workspaceID, collection.ID, "?format=postman&environment=staging")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "environment not found")
+}
+
+func TestExportHandler_Export_OtherWorkspace(t *testing.T) {
+	mockCollectionService, _, app, jwtSvc := setupExportTest(t)
+
+	userID := uuid.New()
+	collection := &models.Collection{ID: uuid.New(), WorkspaceID: uuid.New(), Name: "Partner API"}
+	mockCollectionService.On("GetByID", mock.Anything, collection.ID).Return(collection, nil)
+
+	rec := getExport(t, app, generateTestToken(t, jwtSvc, userID, "test@example.com"), uuid.New(), collection.ID, "?format=har")
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
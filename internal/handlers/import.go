@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+)
+
+type ImportHandler struct {
+	importService     ImportServiceInterface
+	collectionService CollectionServiceInterface
+	workspaceService  WorkspaceServiceInterface
+	hub               HubInterface
+}
+
+func NewImportHandler(
+	importService ImportServiceInterface,
+	collectionService CollectionServiceInterface,
+	workspaceService WorkspaceServiceInterface,
+	hub HubInterface,
+) *ImportHandler {
+	return &ImportHandler{
+		importService:     importService,
+		collectionService: collectionService,
+		workspaceService:  workspaceService,
+		hub:               hub,
+	}
+}
+
+// Import converts an uploaded document into a new collection. Postman
+// environment files are merged into the collection given by collection_id.
+func (h *ImportHandler) Import(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	workspaceID, err := uuid.Parse(c.Param("workspaceId"))
+	if err != nil {
+		c.BadRequest("invalid workspace id")
+		return
+	}
+
+	ctx := context.Background()
+
+	canAccess, err := h.workspaceService.CanAccess(ctx, workspaceID, userID)
+	if err != nil || !canAccess {
+		c.NotFound("workspace not found")
+		return
+	}
+
+	var req dto.ImportCollectionRequest
+	var specBytes []byte
+
+	if isRawSpecContentType(c.GetHeader("Content-Type")) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.BadRequest("failed to read request body")
+			return
+		}
+		specBytes = body
+
+		req.Name = c.QueryParam("name")
+		req.CollectionID = c.QueryParam("collection_id")
+		if depth := c.QueryParam("selection_depth"); depth != "" {
+			req.SelectionDepth, err = strconv.Atoi(depth)
+			if err != nil {
+				c.BadRequest("invalid selection_depth")
+				return
+			}
+		}
+	} else {
+		if err := c.BindJSON(&req); err != nil {
+			c.BadRequest("invalid request body")
+			return
+		}
+		specBytes = decodeSpecField(req.Spec)
+	}
+
+	if len(specBytes) == 0 {
+		c.BadRequest("spec is required")
+		return
+	}
+
+	if req.SelectionDepth < 0 || req.SelectionDepth > services.MaxGraphQLSelectionDepth {
+		c.BadRequest(fmt.Sprintf("selection_depth must be between 0 (the default) and %d", services.MaxGraphQLSelectionDepth))
+		return
+	}
+
+	result, err := h.importService.Import(specBytes, services.ImportOptions{SelectionDepth: req.SelectionDepth})
+	if err != nil {
+		writeImportError(c, err)
+		return
+	}
+
+	if result.Environment != nil {
+		h.importEnvironment(c, workspaceID, userID, req.CollectionID, *result.Environment)
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = strings.TrimSpace(result.Name)
+	}
+	if name == "" {
+		c.BadRequest("name is required")
+		return
+	}
+
+	collection, err := h.collectionService.Create(ctx, workspaceID, name, result.Data, userID)
+	if err != nil {
+		c.InternalServerError("failed to create collection")
+		return
+	}
+
+	h.hub.BroadcastCollectionCreate(collection.WorkspaceID, collection.ID, userID, collection.Name, collection.Version)
+
+	_ = c.JSON(201, collectionResponse(collection))
+}
+
+func (h *ImportHandler) importEnvironment(c *drift.Context, workspaceID, userID uuid.UUID, rawCollectionID string, env services.Environment) {
+	if rawCollectionID == "" {
+		c.BadRequest("collection_id is required when importing an environment")
+		return
+	}
+	collectionID, err := uuid.Parse(rawCollectionID)
+	if err != nil {
+		c.BadRequest("invalid collection_id")
+		return
+	}
+
+	ctx := context.Background()
+
+	existing, err := h.collectionService.GetByID(ctx, collectionID)
+	if err != nil || existing.WorkspaceID != workspaceID {
+		c.NotFound("collection not found")
+		return
+	}
+
+	merged, err := services.MergeEnvironment(existing.Data, env)
+	if err != nil {
+		c.InternalServerError("failed to merge environment")
+		return
+	}
+
+	collection, err := h.collectionService.Update(ctx, collectionID, nil, merged, existing.Version, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrVersionConflict) {
+			_ = c.JSON(409, map[string]any{
+				"code":    "VERSION_CONFLICT",
+				"message": "collection has been modified by another user",
+			})
+			return
+		}
+		c.InternalServerError("failed to update collection")
+		return
+	}
+
+	h.hub.BroadcastCollectionUpdate(collection.WorkspaceID, collection.ID, userID, collection.Name, collection.Version)
+
+	_ = c.JSON(200, collectionResponse(collection))
+}
+
+// isRawSpecContentType reports whether the request body is the document
+// itself (YAML or GraphQL SDL) rather than a JSON request envelope.
+func isRawSpecContentType(contentType string) bool {
+	return strings.Contains(contentType, "application/yaml") ||
+		strings.Contains(contentType, "text/yaml") ||
+		strings.Contains(contentType, "application/x-yaml") ||
+		strings.Contains(contentType, "application/graphql")
+}
+
+// decodeSpecField returns the document from a JSON "spec" field, which holds
+// either a string (YAML, SDL) or an embedded JSON document.
+func decodeSpecField(spec json.RawMessage) []byte {
+	var text string
+	if err := json.Unmarshal(spec, &text); err == nil {
+		return []byte(text)
+	}
+	return spec
+}
+
+func writeImportError(c *drift.Context, err error) {
+	var parseErr *services.SpecParseError
+	if errors.As(err, &parseErr) {
+		c.BadRequest(parseErr.Error())
+		return
+	}
+	c.InternalServerError("failed to convert spec")
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	driftmw "github.com/m1z23r/drift/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupImportTest(t *testing.T) (*testutil.MockCollectionService, *testutil.MockWorkspaceService, *testutil.MockHub, *drift.Engine, *services.JWTService) {
+	t.Helper()
+	mockCollectionService := new(testutil.MockCollectionService)
+	mockWorkspaceService := new(testutil.MockWorkspaceService)
+	mockHub := new(testutil.MockHub)
+	importService := services.NewImportService(
+		services.NewOpenAPIService(),
+		services.NewAsyncAPIService(),
+		services.NewGraphQLService(),
+		services.NewPostmanService(),
+		services.NewInsomniaService(),
+		services.NewHARService(),
+	)
+	handler := NewImportHandler(importService, mockCollectionService, mockWorkspaceService, mockHub)
+	jwtSvc := services.NewJWTService("test-secret-key", 15*time.Minute, 24*time.Hour)
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Use(middleware.Auth(jwtSvc))
+	app.Post("/workspaces/:workspaceId/collections/import", handler.Import)
+
+	return mockCollectionService, mockWorkspaceService, mockHub, app, jwtSvc
+}
+
+func postImport(t *testing.T, app *drift.Engine, token string, workspaceID uuid.UUID, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	jsonBody, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/workspaces/"+workspaceID.String()+"/collections/import", bytes.NewReader(jsonBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestImportHandler_Import_PostmanCollection(t *testing.T) {
+	mockCollectionService, mockWorkspaceService, mockHub, app, jwtSvc := setupImportTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	collection := &models.Collection{ID: uuid.New(), WorkspaceID: workspaceID, Name: "Pets", Version: 1, UpdatedBy: &userID}
+
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(true, nil)
+	mockCollectionService.On("Create", mock.Anything, workspaceID, "Pets", mock.MatchedBy(func(data json.RawMessage) bool {
+		var c services.NikodeCollection
+		return json.Unmarshal(data, &c) == nil && len(c.Items) == 1 && c.Items[0].URL == "{{baseUrl}}/pets"
+	}), userID).Return(collection, nil)
+	mockHub.On("BroadcastCollectionCreate", workspaceID, collection.ID, userID, "Pets", 1).Return()
+
+	rec := postImport(t, app, generateTestToken(t, jwtSvc, userID, "test@example.com"), workspaceID, dto.ImportCollectionRequest{
+		Spec: json.RawMessage(`{
+			"info": {"name": "Pets", "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},
+			"item": [{"name": "List", "request": {"method": "GET", "url": "{{baseUrl}}/pets"}}]
+		}`),
+	})
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var response dto.CollectionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, collection.ID, response.ID)
+
+	mockCollectionService.AssertExpectations(t)
+	mockHub.AssertExpectations(t)
+}
+
+func TestImportHandler_Import_PostmanEnvironment(t *testing.T) {
+	mockCollectionService, mockWorkspaceService, mockHub, app, jwtSvc := setupImportTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	existing := &models.Collection{
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		Name:        "Pets",
+		Data:        json.RawMessage(`{"environments": [{"id": "env-default", "name": "Default", "variables": []}], "activeEnvironmentId": "env-default"}`),
+		Version:     4,
+	}
+	updated := &models.Collection{ID: existing.ID, WorkspaceID: workspaceID, Name: "Pets", Version: 5, UpdatedBy: &userID}
+
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(true, nil)
+	mockCollectionService.On("GetByID", mock.Anything, existing.ID).Return(existing, nil)
+	mockCollectionService.On("Update", mock.Anything, existing.ID, (*string)(nil), mock.MatchedBy(func(data json.RawMessage) bool {
+		var c services.NikodeCollection
+		return json.Unmarshal(data, &c) == nil && len(c.Environments) == 2 && c.Environments[1].Name == "Staging"
+	}), 4, userID).Return(updated, nil)
+	mockHub.On("BroadcastCollectionUpdate", workspaceID, existing.ID, userID, "Pets", 5).Return()
+
+	rec := postImport(t, app, generateTestToken(t, jwtSvc, userID, "test@example.com"), workspaceID, dto.ImportCollectionRequest{
+		CollectionID: existing.ID.String(),
+		Spec:         json.RawMessage(`{"name": "Staging", "values": [{"key": "baseUrl", "value": "https://stage"}], "_postman_variable_scope": "environment"}`),
+	})
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockCollectionService.AssertExpectations(t)
+	mockHub.AssertExpectations(t)
+}
+
+func TestImportHandler_Import_EnvironmentRequiresCollection(t *testing.T) {
+	_, mockWorkspaceService, _, app, jwtSvc := setupImportTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	rec := postImport(t, app, generateTestToken(t, jwtSvc, userID, "test@example.com"), workspaceID, dto.ImportCollectionRequest{
+		Spec: json.RawMessage(`{"name": "Staging", "values": [], "_postman_variable_scope": "environment"}`),
+	})
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "collection_id is required")
+}
+
+func TestImportHandler_Import_InvalidDocument(t *testing.T) {
+	_, mockWorkspaceService, _, app, jwtSvc := setupImportTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	rec := postImport(t, app, generateTestToken(t, jwtSvc, userID, "test@example.com"), workspaceID, dto.ImportCollectionRequest{
+		Spec: json.RawMessage(`{"log": {"entries": {"first": {}}}}`),
+	})
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid har archive")
+}
+
+func TestImportHandler_Import_SelectionDepthOutOfRange(t *testing.T) {
+	_, mockWorkspaceService, _, app, jwtSvc := setupImportTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(true, nil)
+
+	rec := postImport(t, app, generateTestToken(t, jwtSvc, userID, "test@example.com"), workspaceID, dto.ImportCollectionRequest{
+		Spec:           json.RawMessage(`"type Query { ping: String }"`),
+		SelectionDepth: services.MaxGraphQLSelectionDepth + 1,
+	})
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "selection_depth must be between 0 (the default) and 10")
+}
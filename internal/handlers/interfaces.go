@@ -18,6 +18,17 @@ type UserServiceInterface interface {
 	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
 	GetByEmail(ctx context.Context, email string) (*models.User, error)
 	Update(ctx context.Context, id uuid.UUID, name string) (*models.User, error)
+	ListIdentities(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error)
+	LinkIdentity(ctx context.Context, userID uuid.UUID, info *oauth.UserInfo) (*models.UserIdentity, error)
+	UnlinkIdentity(ctx context.Context, userID, identityID uuid.UUID) error
+}
+
+// SAMLProviderInterface defines the methods used by handlers from saml.ServiceProvider
+type SAMLProviderInterface interface {
+	Metadata() []byte
+	AuthnRequestURL(relayState string) (string, string, error)
+	ParseResponse(ctx context.Context, encoded, requestID string) (*oauth.UserInfo, error)
+	AllowIdPInitiated() bool
 }
 
 // WorkspaceServiceInterface defines the methods used by handlers from WorkspaceService
@@ -26,15 +37,16 @@ type WorkspaceServiceInterface interface {
 	GetByID(ctx context.Context, workspaceID uuid.UUID) (*models.Workspace, error)
 	GetUserWorkspaces(ctx context.Context, userID uuid.UUID) ([]models.Workspace, []string, error)
 	Update(ctx context.Context, workspaceID uuid.UUID, name string) (*models.Workspace, error)
+	SetRequireTwoFactor(ctx context.Context, workspaceID uuid.UUID, require bool) (*models.Workspace, error)
 	Delete(ctx context.Context, workspaceID uuid.UUID) error
 	IsOwner(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error)
-	IsMember(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error)
 	CanAccess(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error)
 	CanModify(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error)
 	GetMembers(ctx context.Context, workspaceID uuid.UUID) ([]models.WorkspaceMember, error)
 	AddMember(ctx context.Context, workspaceID, userID uuid.UUID) error
 	RemoveMember(ctx context.Context, workspaceID, userID uuid.UUID) error
 	CreateInvite(ctx context.Context, workspaceID, inviterID, inviteeID uuid.UUID) (*models.WorkspaceInvite, error)
+	CreateEmailInvite(ctx context.Context, workspaceID, inviterID uuid.UUID, email string) (*models.WorkspaceInvite, error)
 	GetInviteByID(ctx context.Context, inviteID uuid.UUID) (*models.WorkspaceInvite, error)
 	GetInviteWithDetails(ctx context.Context, inviteID uuid.UUID) (*models.WorkspaceInvite, error)
 	GetUserPendingInvites(ctx context.Context, userID uuid.UUID) ([]models.WorkspaceInvite, error)
@@ -47,27 +59,43 @@ type WorkspaceServiceInterface interface {
 // CollectionServiceInterface defines the methods used by handlers from CollectionService
 type CollectionServiceInterface interface {
 	Create(ctx context.Context, workspaceID uuid.UUID, name string, data json.RawMessage, userID uuid.UUID) (*models.Collection, error)
+	CreateAs(ctx context.Context, workspaceID uuid.UUID, name string, data json.RawMessage, actor models.Actor) (*models.Collection, error)
 	GetByID(ctx context.Context, collectionID uuid.UUID) (*models.Collection, error)
 	GetByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]models.Collection, error)
 	GetByWorkspaceAndName(ctx context.Context, workspaceID uuid.UUID, name string) (*models.Collection, error)
 	Update(ctx context.Context, collectionID uuid.UUID, name *string, data json.RawMessage, expectedVersion int, userID uuid.UUID) (*models.Collection, error)
-	ForceUpdate(ctx context.Context, collectionID uuid.UUID, name string, data json.RawMessage) (*models.Collection, error)
+	ForceUpdate(ctx context.Context, collectionID uuid.UUID, name string, data json.RawMessage, actor models.Actor) (*models.Collection, error)
+	UpsertBatch(ctx context.Context, workspaceID uuid.UUID, upserts []services.CollectionUpsert, actor models.Actor) ([]models.Collection, error)
 	Delete(ctx context.Context, collectionID uuid.UUID) error
 }
 
 // TokenServiceInterface defines the methods used by handlers from TokenService
 type TokenServiceInterface interface {
-	StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error
-	ValidateRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, error)
-	RevokeRefreshToken(ctx context.Context, tokenHash string) error
-	RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) error
+	CreateSession(ctx context.Context, userID uuid.UUID, deviceName, userAgent, ipAddress string) (*models.Session, error)
+	TouchSession(ctx context.Context, sessionID uuid.UUID, userAgent, ipAddress string) error
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	RevokeSessionByToken(ctx context.Context, tokenHash string) (uuid.UUID, error)
+	IsSessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error)
+	StoreRefreshToken(ctx context.Context, userID, sessionID uuid.UUID, tokenHash string, expiresAt time.Time) error
+	ValidateRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, uuid.UUID, error)
+	RotateRefreshToken(ctx context.Context, userID, sessionID uuid.UUID, oldTokenHash, newTokenHash string, expiresAt time.Time) error
+	RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
 }
 
 // JWTServiceInterface defines the methods used by handlers from JWTService
 type JWTServiceInterface interface {
-	GenerateTokenPair(userID uuid.UUID, email, globalRole string) (*services.TokenPair, error)
+	GenerateTokenPair(userID, sessionID uuid.UUID, email, globalRole string) (*services.TokenPair, error)
 	ValidateRefreshToken(token string) (uuid.UUID, error)
 	RefreshExpiry() time.Duration
+	JWKS() services.JWKSet
+}
+
+// MagicLinkServiceInterface defines the methods used by handlers from MagicLinkService
+type MagicLinkServiceInterface interface {
+	Create(ctx context.Context, email string) (string, error)
+	Consume(ctx context.Context, token string) (string, error)
+	TTL() time.Duration
 }
 
 // HubInterface defines the methods used by handlers from the Hub
@@ -78,6 +106,9 @@ type HubInterface interface {
 	UnsubscribeFromWorkspace(clientID string, workspaceID uuid.UUID)
 	BroadcastCollectionCreate(workspaceID, collectionID, createdBy uuid.UUID, name string, version int)
 	BroadcastCollectionUpdate(workspaceID, collectionID, updatedBy uuid.UUID, name string, version int)
+	BroadcastCollectionCreateAs(workspaceID, collectionID uuid.UUID, actor models.Actor, name string, version int)
+	BroadcastCollectionUpdateAs(workspaceID, collectionID uuid.UUID, actor models.Actor, name string, version int)
+	BroadcastCollectionsBatch(workspaceID uuid.UUID, actor models.Actor, collections []hub.CollectionBatchItem)
 	BroadcastCollectionDelete(workspaceID, collectionID, deletedBy uuid.UUID)
 	BroadcastWorkspaceUpdate(workspaceID, updatedBy uuid.UUID, name string)
 	BroadcastMemberJoined(workspaceID, userID uuid.UUID, userName string, avatarURL *string)
@@ -94,19 +125,49 @@ type HubInterface interface {
 	GetWorkspacePublicKeys(workspaceID uuid.UUID) []hub.PublicKeyInfo
 	RelayEncryptedKey(targetUserID uuid.UUID, fromUserID uuid.UUID, workspaceID uuid.UUID, encryptedKey string)
 	MarkKeyReady(userID uuid.UUID, workspaceID uuid.UUID)
+
+	// Sessions
+	TrackSession(client *hub.Client)
+	UntrackSession(client *hub.Client)
+	DisconnectSession(sessionID uuid.UUID) int
 }
 
 // EmailServiceInterface defines the methods used by handlers from EmailService
 type EmailServiceInterface interface {
 	SendWorkspaceInvite(to, workspaceName, inviterName, inviteURL string) error
+	SendWorkspaceEmailInvite(to, workspaceName, inviterName string) error
+	SendMagicLink(to, link string, ttl time.Duration) error
+	SendRefreshTokenReuse(to string, detectedAt time.Time) error
 }
 
 // APIKeyServiceInterface defines the methods used by handlers from APIKeyService
 type APIKeyServiceInterface interface {
-	Create(ctx context.Context, workspaceID uuid.UUID, name string, createdBy uuid.UUID, expiresAt *time.Time) (*models.WorkspaceAPIKey, string, error)
-	ValidateAndGetWorkspace(ctx context.Context, key string) (uuid.UUID, error)
+	Create(ctx context.Context, workspaceID uuid.UUID, name string, createdBy uuid.UUID, expiresAt *time.Time, restrictions services.APIKeyRestrictions) (*models.WorkspaceAPIKey, string, error)
+	Authenticate(ctx context.Context, key string) (*models.WorkspaceAPIKey, error)
 	List(ctx context.Context, workspaceID uuid.UUID) ([]models.WorkspaceAPIKey, error)
 	Revoke(ctx context.Context, keyID, workspaceID uuid.UUID) error
+	Rotate(ctx context.Context, keyID, workspaceID, rotatedBy uuid.UUID, gracePeriod time.Duration) (*services.APIKeyRotation, error)
+	Get(ctx context.Context, keyID, workspaceID uuid.UUID) (*models.WorkspaceAPIKey, error)
+	UpdateRateLimit(ctx context.Context, keyID, workspaceID uuid.UUID, perMinute, burst int) (*models.WorkspaceAPIKey, error)
+	Usage(ctx context.Context, keyID uuid.UUID, limit int) ([]models.APIKeyUsage, error)
+}
+
+// PersonalAccessTokenServiceInterface defines the methods used by handlers from PersonalAccessTokenService
+type PersonalAccessTokenServiceInterface interface {
+	Create(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error)
+	List(ctx context.Context, userID uuid.UUID) ([]models.PersonalAccessToken, error)
+	Revoke(ctx context.Context, userID, tokenID uuid.UUID) error
+}
+
+// TwoFactorServiceInterface defines the methods used by handlers from TwoFactorService
+type TwoFactorServiceInterface interface {
+	BeginEnrollment(ctx context.Context, userID uuid.UUID, accountName string) (*services.TwoFactorEnrollment, error)
+	ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	IsEnabled(ctx context.Context, userID uuid.UUID) (bool, error)
+	Status(ctx context.Context, userID uuid.UUID) (*services.TwoFactorStatus, error)
+	Verify(ctx context.Context, userID uuid.UUID, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error)
+	Disable(ctx context.Context, userID uuid.UUID, code string) error
 }
 
 // VaultServiceInterface defines the methods used by handlers from VaultService
@@ -120,10 +181,14 @@ type VaultServiceInterface interface {
 	DeleteItem(ctx context.Context, itemID, vaultID uuid.UUID) error
 }
 
-// OpenAPIServiceInterface defines the methods used by handlers from OpenAPIService
-type OpenAPIServiceInterface interface {
-	ParseOpenAPI(content []byte) (any, error)
-	ConvertToNikode(spec any) (json.RawMessage, error)
+// ImportServiceInterface defines the methods used by handlers from ImportService
+type ImportServiceInterface interface {
+	Import(content []byte, opts services.ImportOptions) (*services.ImportResult, error)
+}
+
+// ExportServiceInterface defines the methods used by handlers from ExportService
+type ExportServiceInterface interface {
+	Export(name string, data json.RawMessage, opts services.ExportOptions) (*services.ExportResult, error)
 }
 
 // TemplateServiceInterface defines the methods used by handlers from TemplateService
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"math"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+)
+
+// Sign-in link requests are throttled per address, so an inbox can't be
+// flooded, and per client IP, so addresses can't be sprayed.
+const (
+	magicLinkEmailPerMinute = 1
+	magicLinkEmailBurst     = 3
+	magicLinkIPPerMinute    = 5
+	magicLinkIPBurst        = 10
+)
+
+// magicLinkProvider is the identity provider name of email sign-ins
+const magicLinkProvider = "email"
+
+// RequestMagicLink emails a single-use sign-in link. The response is the
+// same whether or not the address has an account.
+func (h *AuthHandler) RequestMagicLink(c *drift.Context) {
+	if !h.cfg.MagicLinkEnabled {
+		c.NotFound("email sign-in is not enabled")
+		return
+	}
+
+	var req dto.MagicLinkRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.BadRequest("invalid request body")
+		return
+	}
+
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil || addr.Address != strings.TrimSpace(req.Email) {
+		c.BadRequest("invalid email")
+		return
+	}
+	email := services.NormalizeEmail(addr.Address)
+
+	if !h.allowMagicLink(c, h.magicLinkIPLimiter, middleware.ClientAddr(c), magicLinkIPPerMinute, magicLinkIPBurst) ||
+		!h.allowMagicLink(c, h.magicLinkEmailLimiter, email, magicLinkEmailPerMinute, magicLinkEmailBurst) {
+		return
+	}
+
+	ctx := context.Background()
+
+	token, err := h.magicLinkService.Create(ctx, email)
+	if err != nil {
+		c.InternalServerError("failed to create sign-in link")
+		return
+	}
+
+	link := h.cfg.BaseURL + "/api/v1/magic-link/verify?token=" + url.QueryEscape(token)
+	if err := h.emailService.SendMagicLink(email, link, h.magicLinkService.TTL()); err != nil {
+		c.InternalServerError("failed to send sign-in link")
+		return
+	}
+
+	_ = c.JSON(200, map[string]string{"message": "check your email for a sign-in link"})
+}
+
+func (h *AuthHandler) allowMagicLink(c *drift.Context, limiter *services.TokenBucketLimiter, key string, perMinute, burst int) bool {
+	ok, retryAfter := limiter.Allow(uuid.NewSHA1(uuid.NameSpaceOID, []byte(key)), perMinute, burst)
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.TooManyRequests("too many sign-in link requests")
+	}
+	return ok
+}
+
+var magicLinkPageTemplate = template.Must(template.New("magic-link").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Nikode - Sign in</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; background: #f5f5f5; color: #333; display: flex; justify-content: center; padding: 60px 20px; margin: 0; }
+main { background: #fff; border-radius: 8px; padding: 32px; max-width: 400px; width: 100%; box-shadow: 0 1px 3px rgba(0,0,0,.1); }
+h1 { font-size: 22px; margin-top: 0; }
+button { display: block; width: 100%; padding: 10px; margin-top: 8px; font-size: 15px; cursor: pointer; }
+</style>
+</head>
+<body>
+<main>
+<h1>Sign in to Nikode</h1>
+<form method="post" action="/api/v1/magic-link/verify">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit" autofocus>Continue</button>
+</form>
+</main>
+</body>
+</html>
+`))
+
+// MagicLinkPage is the link target. It only shows a button that posts the
+// token to MagicLinkCallback, so mail scanners that follow links don't use
+// it up.
+func (h *AuthHandler) MagicLinkPage(c *drift.Context) {
+	if !h.cfg.MagicLinkEnabled {
+		h.redirectWithError(c, "email sign-in is not enabled")
+		return
+	}
+
+	token := c.QueryParam("token")
+	if token == "" {
+		h.redirectWithError(c, "missing sign-in token")
+		return
+	}
+
+	var b strings.Builder
+	if err := magicLinkPageTemplate.Execute(&b, token); err != nil {
+		c.InternalServerError("failed to render page")
+		return
+	}
+
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "frame-ancestors 'none'")
+	c.Header("Referrer-Policy", "no-referrer")
+	_ = c.HTML(200, b.String())
+}
+
+// MagicLinkCallback redeems a sign-in link and, like Callback, redirects to
+// the frontend with an auth code.
+func (h *AuthHandler) MagicLinkCallback(c *drift.Context) {
+	if !h.cfg.MagicLinkEnabled {
+		h.redirectWithError(c, "email sign-in is not enabled")
+		return
+	}
+
+	token := c.PostForm("token")
+	if token == "" {
+		h.redirectWithError(c, "missing sign-in token")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	email, err := h.magicLinkService.Consume(ctx, token)
+	if err != nil {
+		if errors.Is(err, services.ErrMagicLinkInvalid) {
+			h.redirectWithError(c, err.Error())
+			return
+		}
+		h.redirectWithError(c, "failed to verify sign-in link")
+		return
+	}
+
+	// Receiving the link proves the address, so it counts as verified
+	h.completeLogin(ctx, c, &oauth.UserInfo{
+		Email:         email,
+		ID:            email,
+		Provider:      magicLinkProvider,
+		EmailVerified: true,
+	})
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	driftmw "github.com/m1z23r/drift/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func setupMagicLinkTest(t *testing.T) (*testutil.MockUserService, *testutil.MockMagicLinkService, *testutil.MockEmailService, *drift.Engine) {
+	t.Helper()
+	mockUserService, _, _, handler, cfg := setupAuthTest(t)
+	cfg.MagicLinkEnabled = true
+	cfg.BaseURL = "https://api.example.com"
+
+	mockMagicLinkService := new(testutil.MockMagicLinkService)
+	mockEmailService := new(testutil.MockEmailService)
+	handler.magicLinkService = mockMagicLinkService
+	handler.emailService = mockEmailService
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Post("/magic-link", handler.RequestMagicLink)
+	app.Get("/magic-link/verify", handler.MagicLinkPage)
+	app.Post("/magic-link/verify", handler.MagicLinkCallback)
+
+	return mockUserService, mockMagicLinkService, mockEmailService, app
+}
+
+func requestMagicLink(app *drift.Engine, body, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/magic-link", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":1234"
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthHandler_RequestMagicLink(t *testing.T) {
+	_, mockMagicLinkService, mockEmailService, app := setupMagicLinkTest(t)
+
+	mockMagicLinkService.On("Create", mock.Anything, "ada@example.com").Return("nonce.sig", nil)
+	mockEmailService.On("SendMagicLink", "ada@example.com", "https://api.example.com/api/v1/magic-link/verify?token=nonce.sig", 15*time.Minute).Return(nil)
+
+	rec := requestMagicLink(app, `{"email": "Ada@Example.com"}`, "192.0.2.1")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockMagicLinkService.AssertExpectations(t)
+	mockEmailService.AssertExpectations(t)
+}
+
+func TestAuthHandler_RequestMagicLink_InvalidEmail(t *testing.T) {
+	_, mockMagicLinkService, _, app := setupMagicLinkTest(t)
+
+	for _, body := range []string{`{}`, `{"email": "not-an-email"}`, `{"email": "Ada <ada@example.com>"}`} {
+		rec := requestMagicLink(app, body, "192.0.2.1")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, body)
+	}
+	mockMagicLinkService.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+}
+
+func TestAuthHandler_RequestMagicLink_Disabled(t *testing.T) {
+	_, _, _, handler, _ := setupAuthTest(t)
+
+	app := drift.New()
+	app.Post("/magic-link", handler.RequestMagicLink)
+
+	rec := requestMagicLink(app, `{"email": "ada@example.com"}`, "192.0.2.1")
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAuthHandler_RequestMagicLink_ThrottledPerEmail(t *testing.T) {
+	_, mockMagicLinkService, mockEmailService, app := setupMagicLinkTest(t)
+	mockMagicLinkService.On("Create", mock.Anything, mock.Anything).Return("nonce.sig", nil)
+	mockEmailService.On("SendMagicLink", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// Each request comes from a different client
+	for i := range magicLinkEmailBurst {
+		rec := requestMagicLink(app, `{"email": "ada@example.com"}`, "192.0.2."+string(rune('1'+i)))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	rec := requestMagicLink(app, `{"email": "ada@example.com"}`, "198.51.100.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+
+	// Other addresses are unaffected
+	rec = requestMagicLink(app, `{"email": "grace@example.com"}`, "198.51.100.1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	mockEmailService.AssertNumberOfCalls(t, "SendMagicLink", magicLinkEmailBurst+1)
+}
+
+func TestAuthHandler_RequestMagicLink_ThrottledPerIP(t *testing.T) {
+	_, mockMagicLinkService, mockEmailService, app := setupMagicLinkTest(t)
+	mockMagicLinkService.On("Create", mock.Anything, mock.Anything).Return("nonce.sig", nil)
+	mockEmailService.On("SendMagicLink", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	for i := range magicLinkIPBurst {
+		rec := requestMagicLink(app, `{"email": "user`+string(rune('a'+i))+`@example.com"}`, "192.0.2.1")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	rec := requestMagicLink(app, `{"email": "another@example.com"}`, "192.0.2.1")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	mockMagicLinkService.AssertNotCalled(t, "Create", mock.Anything, "another@example.com")
+}
+
+func TestAuthHandler_RequestMagicLink_ForwardedForIgnored(t *testing.T) {
+	_, mockMagicLinkService, mockEmailService, app := setupMagicLinkTest(t)
+	mockMagicLinkService.On("Create", mock.Anything, mock.Anything).Return("nonce.sig", nil)
+	mockEmailService.On("SendMagicLink", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	// Without a trusted proxy, a new X-Forwarded-For per request is still
+	// the same client
+	var rec *httptest.ResponseRecorder
+	for i := range magicLinkIPBurst + 1 {
+		req := httptest.NewRequest(http.MethodPost, "/magic-link", bytes.NewBufferString(`{"email": "user`+string(rune('a'+i))+`@example.com"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", "198.51.100."+strconv.Itoa(i+1))
+		rec = httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+	}
+
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+}
+
+func redeemMagicLink(app *drift.Engine, token string) *httptest.ResponseRecorder {
+	form := url.Values{"token": {token}}
+	req := httptest.NewRequest(http.MethodPost, "/magic-link/verify", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthHandler_MagicLinkPage_DoesNotConsume(t *testing.T) {
+	_, mockMagicLinkService, _, app := setupMagicLinkTest(t)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/magic-link/verify?token=nonce.sig", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `name="token" value="nonce.sig"`)
+	assert.Contains(t, rec.Body.String(), `method="post"`)
+	assert.Equal(t, "DENY", rec.Header().Get("X-Frame-Options"))
+	mockMagicLinkService.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything)
+}
+
+func TestAuthHandler_MagicLinkCallback(t *testing.T) {
+	mockUserService, mockMagicLinkService, _, app := setupMagicLinkTest(t)
+
+	mockMagicLinkService.On("Consume", mock.Anything, "nonce.sig").Return("ada@example.com", nil)
+	userInfo := &oauth.UserInfo{Email: "ada@example.com", ID: "ada@example.com", Provider: "email", EmailVerified: true}
+	mockUserService.On("FindOrCreateFromOAuth", mock.Anything, userInfo).Return(&models.User{ID: uuid.New()}, nil)
+
+	rec := redeemMagicLink(app, "nonce.sig")
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	location := rec.Header().Get("Location")
+	assert.Contains(t, location, "code=")
+	assert.NotContains(t, location, "error=")
+	mockUserService.AssertExpectations(t)
+}
+
+func TestAuthHandler_MagicLinkCallback_InvalidToken(t *testing.T) {
+	mockUserService, mockMagicLinkService, _, app := setupMagicLinkTest(t)
+	mockMagicLinkService.On("Consume", mock.Anything, "used.sig").Return("", services.ErrMagicLinkInvalid)
+
+	rec := redeemMagicLink(app, "used.sig")
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Contains(t, rec.Header().Get("Location"), "error=invalid+or+expired+sign-in+link")
+	mockUserService.AssertNotCalled(t, "FindOrCreateFromOAuth", mock.Anything, mock.Anything)
+}
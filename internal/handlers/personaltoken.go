@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+)
+
+// maxTokenNameLength matches personal_access_tokens.name
+const maxTokenNameLength = 255
+
+type PersonalAccessTokenHandler struct {
+	tokenService PersonalAccessTokenServiceInterface
+}
+
+func NewPersonalAccessTokenHandler(tokenService PersonalAccessTokenServiceInterface) *PersonalAccessTokenHandler {
+	return &PersonalAccessTokenHandler{tokenService: tokenService}
+}
+
+func (h *PersonalAccessTokenHandler) Create(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	var req dto.CreatePersonalAccessTokenRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.BadRequest("invalid request body")
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.BadRequest("name is required")
+		return
+	}
+	if len([]rune(name)) > maxTokenNameLength {
+		c.BadRequest("name is too long")
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		c.BadRequest("expires_at must be in the future")
+		return
+	}
+
+	scopes, err := services.NormalizePersonalAccessTokenScopes(req.Scopes)
+	if err != nil {
+		c.BadRequest(err.Error() + ", expected one of: " + strings.Join(models.PersonalAccessTokenScopes, ", "))
+		return
+	}
+
+	token, plainToken, err := h.tokenService.Create(context.Background(), userID, name, scopes, req.ExpiresAt)
+	if err != nil {
+		c.InternalServerError("failed to create token")
+		return
+	}
+
+	_ = c.JSON(201, dto.PersonalAccessTokenCreatedResponse{
+		PersonalAccessTokenResponse: personalAccessTokenResponse(token),
+		Token:                       plainToken,
+	})
+}
+
+func (h *PersonalAccessTokenHandler) List(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	tokens, err := h.tokenService.List(context.Background(), userID)
+	if err != nil {
+		c.InternalServerError("failed to list tokens")
+		return
+	}
+
+	response := make([]dto.PersonalAccessTokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		response = append(response, personalAccessTokenResponse(&t))
+	}
+
+	_ = c.JSON(200, response)
+}
+
+func (h *PersonalAccessTokenHandler) Revoke(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	tokenID, err := uuid.Parse(c.Param("tokenId"))
+	if err != nil {
+		c.BadRequest("invalid token id")
+		return
+	}
+
+	if err := h.tokenService.Revoke(context.Background(), userID, tokenID); err != nil {
+		if errors.Is(err, services.ErrPersonalAccessTokenNotFound) {
+			c.NotFound("token not found")
+			return
+		}
+		c.InternalServerError("failed to revoke token")
+		return
+	}
+
+	_ = c.JSON(200, map[string]string{"message": "token revoked"})
+}
+
+func personalAccessTokenResponse(t *models.PersonalAccessToken) dto.PersonalAccessTokenResponse {
+	response := dto.PersonalAccessTokenResponse{
+		ID:          t.ID,
+		Name:        t.Name,
+		TokenPrefix: t.TokenPrefix,
+		Scopes:      t.Scopes,
+		CreatedAt:   t.CreatedAt.Format(time.RFC3339),
+	}
+	if t.ExpiresAt != nil {
+		formatted := t.ExpiresAt.Format(time.RFC3339)
+		response.ExpiresAt = &formatted
+	}
+	if t.LastUsedAt != nil {
+		formatted := t.LastUsedAt.Format(time.RFC3339)
+		response.LastUsedAt = &formatted
+	}
+	return response
+}
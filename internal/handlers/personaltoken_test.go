@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	driftmw "github.com/m1z23r/drift/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPersonalAccessTokenTest(t *testing.T) (*testutil.MockPersonalAccessTokenService, *services.JWTService, *drift.Engine) {
+	t.Helper()
+	mockTokenService := new(testutil.MockPersonalAccessTokenService)
+	handler := NewPersonalAccessTokenHandler(mockTokenService)
+	jwtSvc := newTestJWTService()
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Use(middleware.Auth(jwtSvc))
+	app.Get("/users/me/tokens", handler.List)
+	app.Post("/users/me/tokens", handler.Create)
+	app.Delete("/users/me/tokens/:tokenId", handler.Revoke)
+
+	return mockTokenService, jwtSvc, app
+}
+
+func TestPersonalAccessTokenHandler_Create(t *testing.T) {
+	mockTokenService, jwtSvc, app := setupPersonalAccessTokenTest(t)
+	userID := uuid.New()
+	scopes := []string{models.PersonalAccessTokenScopeRead, models.PersonalAccessTokenScopeWrite}
+
+	mockTokenService.On("Create", mock.Anything, userID, "sync script", scopes, (*time.Time)(nil)).Return(&models.PersonalAccessToken{
+		ID: uuid.New(), UserID: userID, Name: "sync script", TokenPrefix: "nikp_abcd1234...", Scopes: scopes, CreatedAt: time.Now(),
+	}, "nikp_abcd1234secret", nil)
+
+	body, _ := json.Marshal(dto.CreatePersonalAccessTokenRequest{Name: " sync script ", Scopes: []string{"read", "write"}})
+	req := httptest.NewRequest(http.MethodPost, "/users/me/tokens", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "test@example.com"))
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var response dto.PersonalAccessTokenCreatedResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "nikp_abcd1234secret", response.Token)
+	assert.Equal(t, "nikp_abcd1234...", response.TokenPrefix)
+	assert.Equal(t, scopes, response.Scopes)
+	mockTokenService.AssertExpectations(t)
+}
+
+func TestPersonalAccessTokenHandler_Create_Invalid(t *testing.T) {
+	_, jwtSvc, app := setupPersonalAccessTokenTest(t)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		req  dto.CreatePersonalAccessTokenRequest
+		want string
+	}{
+		{"missing name", dto.CreatePersonalAccessTokenRequest{}, "name is required"},
+		{"unknown scope", dto.CreatePersonalAccessTokenRequest{Name: "ci", Scopes: []string{"admin"}}, "invalid personal access token scope"},
+		{"expired", dto.CreatePersonalAccessTokenRequest{Name: "ci", ExpiresAt: &past}, "expires_at must be in the future"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(tt.req)
+			req := httptest.NewRequest(http.MethodPost, "/users/me/tokens", bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, uuid.New(), "test@example.com"))
+			rec := httptest.NewRecorder()
+
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.want)
+		})
+	}
+}
+
+func TestPersonalAccessTokenHandler_List(t *testing.T) {
+	mockTokenService, jwtSvc, app := setupPersonalAccessTokenTest(t)
+	userID := uuid.New()
+	lastUsed := time.Now()
+
+	mockTokenService.On("List", mock.Anything, userID).Return([]models.PersonalAccessToken{
+		{ID: uuid.New(), UserID: userID, Name: "sync script", TokenPrefix: "nikp_abcd1234...", Scopes: []string{"read"}, LastUsedAt: &lastUsed, CreatedAt: time.Now()},
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/tokens", nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "test@example.com"))
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "token_hash")
+	var response []dto.PersonalAccessTokenResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response, 1)
+	assert.Equal(t, "sync script", response[0].Name)
+	assert.NotNil(t, response[0].LastUsedAt)
+}
+
+func TestPersonalAccessTokenHandler_Revoke_NotFound(t *testing.T) {
+	mockTokenService, jwtSvc, app := setupPersonalAccessTokenTest(t)
+	userID := uuid.New()
+	tokenID := uuid.New()
+
+	mockTokenService.On("Revoke", mock.Anything, userID, tokenID).Return(services.ErrPersonalAccessTokenNotFound)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/me/tokens/"+tokenID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "test@example.com"))
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
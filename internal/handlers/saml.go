@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/saml"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+)
+
+// SAMLMetadata serves the SP metadata document to register with the IdP.
+func (h *AuthHandler) SAMLMetadata(c *drift.Context) {
+	provider := c.Param("provider")
+
+	p, ok := h.samlProviders[provider]
+	if !ok {
+		c.NotFound("unknown SAML provider: " + provider)
+		return
+	}
+
+	_ = c.Data(200, "application/samlmetadata+xml", p.Metadata())
+}
+
+// SAMLConsentURL starts an SP-initiated login. Like GetConsentURL it returns
+// the IdP URL to open in the browser.
+func (h *AuthHandler) SAMLConsentURL(c *drift.Context) {
+	provider := c.Param("provider")
+
+	p, ok := h.samlProviders[provider]
+	if !ok {
+		c.BadRequest("unsupported provider: " + provider)
+		return
+	}
+
+	state, err := oauth.GenerateState()
+	if err != nil {
+		c.InternalServerError("failed to generate state")
+		return
+	}
+
+	redirectURL, requestID, err := p.AuthnRequestURL(state)
+	if err != nil {
+		c.InternalServerError("failed to create SAML request")
+		return
+	}
+
+	if err := h.putState(context.Background(), state, stateData{SAMLRequestID: requestID}); err != nil {
+		c.InternalServerError("failed to store state")
+		return
+	}
+
+	_ = c.JSON(200, dto.ConsentURLResponse{
+		URL: redirectURL,
+	})
+}
+
+// SAMLACS is the assertion consumer service the IdP posts its response to.
+// A RelayState issued by SAMLConsentURL ties the response to our request;
+// without one the login is IdP-initiated, which the provider must allow.
+func (h *AuthHandler) SAMLACS(c *drift.Context) {
+	provider := c.Param("provider")
+
+	p, ok := h.samlProviders[provider]
+	if !ok {
+		h.redirectWithError(c, "unsupported provider")
+		return
+	}
+
+	samlResponse := c.PostForm("SAMLResponse")
+	if samlResponse == "" {
+		h.redirectWithError(c, "missing SAML response")
+		return
+	}
+
+	requestID := ""
+	linkUserID := uuid.Nil
+	deviceCode := ""
+	if relayState := c.PostForm("RelayState"); relayState != "" {
+		sd, ok, err := h.takeState(context.Background(), relayState)
+		if err != nil {
+			h.redirectWithError(c, "failed to load state")
+			return
+		}
+		if ok {
+			if sd.SAMLRequestID == "" {
+				h.redirectWithError(c, "state expired")
+				return
+			}
+			requestID = sd.SAMLRequestID
+			linkUserID = sd.LinkUserID
+			deviceCode = sd.DeviceCode
+		}
+	}
+	if linkUserID != uuid.Nil && !h.takeLinkCookie(c, c.PostForm("RelayState")) {
+		h.redirectWithError(c, "linking was started in another browser")
+		return
+	}
+	if requestID == "" && !p.AllowIdPInitiated() {
+		h.redirectWithError(c, "invalid or expired state")
+		return
+	}
+
+	userInfo, err := p.ParseResponse(context.Background(), samlResponse, requestID)
+	if err != nil {
+		errMsg := "failed to read SAML response"
+		if errors.Is(err, saml.ErrInvalidSignature) || errors.Is(err, saml.ErrInvalidResponse) {
+			errMsg = err.Error()
+		}
+		if deviceCode != "" {
+			h.deviceError(c, errMsg)
+			return
+		}
+		h.redirectWithError(c, errMsg)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if deviceCode != "" {
+		h.completeDevice(ctx, c, deviceCode, userInfo)
+		return
+	}
+	if linkUserID != uuid.Nil {
+		h.completeLink(ctx, c, linkUserID, userInfo)
+		return
+	}
+	h.completeLogin(ctx, c, userInfo)
+}
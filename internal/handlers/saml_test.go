@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/saml"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	driftmw "github.com/m1z23r/drift/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSAMLTest(t *testing.T) (*testutil.MockUserService, *testutil.MockSAMLProvider, *AuthHandler, *drift.Engine) {
+	t.Helper()
+	mockUserService, _, _, handler, _ := setupAuthTest(t)
+
+	mockProvider := new(testutil.MockSAMLProvider)
+	handler.samlProviders["corp"] = mockProvider
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Get("/saml/:provider/metadata", handler.SAMLMetadata)
+	app.Get("/saml/:provider/consent", handler.SAMLConsentURL)
+	app.Post("/saml/:provider/acs", handler.SAMLACS)
+
+	return mockUserService, mockProvider, handler, app
+}
+
+func postACS(app *drift.Engine, provider string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/saml/"+provider+"/acs", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthHandler_SAMLMetadata(t *testing.T) {
+	_, mockProvider, _, app := setupSAMLTest(t)
+	mockProvider.On("Metadata").Return([]byte(`<EntityDescriptor/>`))
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/saml/corp/metadata", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/samlmetadata+xml", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `<EntityDescriptor/>`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/saml/unknown/metadata", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAuthHandler_SAMLConsentURL(t *testing.T) {
+	_, mockProvider, handler, app := setupSAMLTest(t)
+	mockProvider.On("AuthnRequestURL", mock.AnythingOfType("string")).Return("https://idp.example.com/sso?SAMLRequest=x", "_request1", nil)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/saml/corp/consent", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response dto.ConsentURLResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "https://idp.example.com/sso?SAMLRequest=x", response.URL)
+
+	// The relay state passed to the IdP remembers the request ID
+	state := mockProvider.Calls[0].Arguments.String(0)
+	sd, ok := loadState(handler, state)
+	require.True(t, ok)
+	assert.Equal(t, "_request1", sd.SAMLRequestID)
+}
+
+func TestAuthHandler_SAMLACS_SPInitiated(t *testing.T) {
+	mockUserService, mockProvider, handler, app := setupSAMLTest(t)
+
+	userInfo := &oauth.UserInfo{Email: "ada@corp.example", Name: "Ada", ID: "ada@corp.example", Provider: "corp"}
+	mockProvider.On("ParseResponse", mock.Anything, "encoded-response", "_request1").Return(userInfo, nil)
+	mockUserService.On("FindOrCreateFromOAuth", mock.Anything, userInfo).Return(&models.User{ID: uuid.New()}, nil)
+	storeState(t, handler, "relay-state", stateData{SAMLRequestID: "_request1"}, time.Minute)
+
+	rec := postACS(app, "corp", url.Values{"SAMLResponse": {"encoded-response"}, "RelayState": {"relay-state"}})
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	location := rec.Header().Get("Location")
+	assert.Contains(t, location, "code=")
+	assert.NotContains(t, location, "error=")
+
+	// The relay state is single use
+	_, ok := loadState(handler, "relay-state")
+	assert.False(t, ok)
+	mockProvider.AssertExpectations(t)
+	mockUserService.AssertExpectations(t)
+}
+
+func TestAuthHandler_SAMLACS_IdPInitiated(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed bool
+	}{
+		{"allowed", true},
+		{"not allowed", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUserService, mockProvider, _, app := setupSAMLTest(t)
+			mockProvider.On("AllowIdPInitiated").Return(tt.allowed)
+			userInfo := &oauth.UserInfo{Email: "ada@corp.example", ID: "ada@corp.example", Provider: "corp"}
+			mockProvider.On("ParseResponse", mock.Anything, "encoded-response", "").Return(userInfo, nil).Maybe()
+			mockUserService.On("FindOrCreateFromOAuth", mock.Anything, userInfo).Return(&models.User{ID: uuid.New()}, nil).Maybe()
+
+			// An unknown relay state is treated as IdP-initiated
+			rec := postACS(app, "corp", url.Values{"SAMLResponse": {"encoded-response"}, "RelayState": {"/dashboard"}})
+
+			assert.Equal(t, http.StatusFound, rec.Code)
+			location := rec.Header().Get("Location")
+			if tt.allowed {
+				assert.Contains(t, location, "code=")
+			} else {
+				assert.Contains(t, location, "error=invalid+or+expired+state")
+				mockProvider.AssertNotCalled(t, "ParseResponse", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestAuthHandler_SAMLACS_OAuthState(t *testing.T) {
+	_, mockProvider, handler, app := setupSAMLTest(t)
+	storeState(t, handler, "oauth-state", stateData{}, time.Minute)
+
+	rec := postACS(app, "corp", url.Values{"SAMLResponse": {"encoded-response"}, "RelayState": {"oauth-state"}})
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Contains(t, rec.Header().Get("Location"), "error=state+expired")
+	mockProvider.AssertNotCalled(t, "ParseResponse", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAuthHandler_SAMLACS_InvalidResponse(t *testing.T) {
+	_, mockProvider, handler, app := setupSAMLTest(t)
+	mockProvider.On("ParseResponse", mock.Anything, "encoded-response", "_request1").Return(nil, fmt.Errorf("%w: assertion expired", saml.ErrInvalidResponse))
+	storeState(t, handler, "relay-state", stateData{SAMLRequestID: "_request1"}, time.Minute)
+
+	rec := postACS(app, "corp", url.Values{"SAMLResponse": {"encoded-response"}, "RelayState": {"relay-state"}})
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Contains(t, rec.Header().Get("Location"), "error=invalid+SAML+response")
+}
+
+func TestAuthHandler_SAMLACS_MissingResponse(t *testing.T) {
+	_, _, _, app := setupSAMLTest(t)
+
+	rec := postACS(app, "corp", url.Values{})
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Contains(t, rec.Header().Get("Location"), "error=missing+SAML+response")
+}
+
+func TestAuthHandler_SAMLACS_Link(t *testing.T) {
+	mockUserService, mockProvider, handler, app := setupSAMLTest(t)
+	userID := uuid.New()
+
+	userInfo := &oauth.UserInfo{Email: "ada@corp.example", ID: "ada@corp.example", Provider: "corp"}
+	mockProvider.On("ParseResponse", mock.Anything, "encoded-response", "_request1").Return(userInfo, nil)
+	mockUserService.On("LinkIdentity", mock.Anything, userID, userInfo).Return(&models.UserIdentity{ID: uuid.New()}, nil)
+	storeState(t, handler, "relay-state", stateData{SAMLRequestID: "_request1", LinkUserID: userID}, time.Minute)
+
+	// Without the cookie from LinkConsentURL the response is refused
+	rec := postACS(app, "corp", url.Values{"SAMLResponse": {"encoded-response"}, "RelayState": {"relay-state"}})
+	assert.Contains(t, rec.Header().Get("Location"), "error=linking+was+started+in+another+browser")
+	mockUserService.AssertNotCalled(t, "LinkIdentity", mock.Anything, mock.Anything, mock.Anything)
+
+	storeState(t, handler, "relay-state", stateData{SAMLRequestID: "_request1", LinkUserID: userID}, time.Minute)
+	rec = postACS(app, "corp", url.Values{"SAMLResponse": {"encoded-response"}, "RelayState": {"relay-state"}},
+		&http.Cookie{Name: linkStateCookie, Value: "relay-state"})
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Contains(t, rec.Header().Get("Location"), "linked=corp")
+	mockUserService.AssertNotCalled(t, "FindOrCreateFromOAuth", mock.Anything, mock.Anything)
+	mockUserService.AssertExpectations(t)
+}
+
+func TestAuthHandler_SAMLACS_Device(t *testing.T) {
+	mockUserService, mockProvider, handler, app := setupSAMLTest(t)
+	userID := uuid.New()
+
+	storeDeviceAuth(t, handler, "device-code", deviceAuthorization{UserCode: "BCDFGHJK", ExpiresAt: time.Now().Add(time.Minute)})
+
+	userInfo := &oauth.UserInfo{Email: "ada@corp.example", ID: "ada@corp.example", Provider: "corp"}
+	mockProvider.On("ParseResponse", mock.Anything, "encoded-response", "_request1").Return(userInfo, nil)
+	mockUserService.On("FindOrCreateFromOAuth", mock.Anything, userInfo).Return(&models.User{ID: userID}, nil)
+	storeState(t, handler, "relay-state", stateData{SAMLRequestID: "_request1", DeviceCode: "device-code"}, time.Minute)
+
+	rec := postACS(app, "corp", url.Values{"SAMLResponse": {"encoded-response"}, "RelayState": {"relay-state"}})
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Approve this device?")
+	_, ok := loadDeviceApproval(handler, "device-code")
+	assert.False(t, ok)
+
+	app.Post("/device/approve", handler.ApproveDevice)
+	rec = postDeviceDecision(app, confirmToken(t, rec), "approve")
+	assert.Contains(t, rec.Body.String(), "Device approved")
+	approvedID, ok := loadDeviceApproval(handler, "device-code")
+	assert.True(t, ok)
+	assert.Equal(t, userID, approvedID)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+)
+
+// maxDeviceNameLength matches sessions.device_name
+const maxDeviceNameLength = 255
+
+type SessionHandler struct {
+	tokenService TokenServiceInterface
+	hub          HubInterface
+}
+
+func NewSessionHandler(tokenService TokenServiceInterface, hub HubInterface) *SessionHandler {
+	return &SessionHandler{
+		tokenService: tokenService,
+		hub:          hub,
+	}
+}
+
+func (h *SessionHandler) List(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	sessions, err := h.tokenService.ListSessions(context.Background(), userID)
+	if err != nil {
+		c.InternalServerError("failed to list sessions")
+		return
+	}
+
+	currentID := middleware.GetSessionID(c)
+	response := make([]dto.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		response = append(response, sessionResponse(session, currentID))
+	}
+
+	_ = c.JSON(200, response)
+}
+
+// Revoke signs a device out and closes its live connections.
+func (h *SessionHandler) Revoke(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("sessionId"))
+	if err != nil {
+		c.BadRequest("invalid session id")
+		return
+	}
+
+	if err := h.tokenService.RevokeSession(context.Background(), userID, sessionID); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			c.NotFound("session not found")
+			return
+		}
+		c.InternalServerError("failed to revoke session")
+		return
+	}
+
+	h.hub.DisconnectSession(sessionID)
+
+	_ = c.JSON(200, map[string]string{"message": "session revoked"})
+}
+
+func sessionResponse(session models.Session, currentID uuid.UUID) dto.SessionResponse {
+	return dto.SessionResponse{
+		ID:         session.ID,
+		DeviceName: session.DeviceName,
+		UserAgent:  session.UserAgent,
+		IPAddress:  session.IPAddress,
+		CreatedAt:  session.CreatedAt.Format(time.RFC3339),
+		LastUsedAt: session.LastUsedAt.Format(time.RFC3339),
+		Current:    session.ID == currentID,
+	}
+}
+
+// sessionDeviceName cleans up the device name a client reported at sign-in
+func sessionDeviceName(name string) string {
+	name = strings.TrimSpace(name)
+	if runes := []rune(name); len(runes) > maxDeviceNameLength {
+		name = string(runes[:maxDeviceNameLength])
+	}
+	return name
+}
+
+// sessionRevoked reports whether the session an access token was issued to
+// has been signed out. WebSockets check it on connect, since a revoked
+// session's access tokens stay valid until they expire. Tokens issued
+// before sessions existed have no session.
+func sessionRevoked(tokenService TokenServiceInterface, claims *services.Claims) bool {
+	if claims.SessionID == uuid.Nil {
+		return false
+	}
+	active, err := tokenService.IsSessionActive(context.Background(), claims.SessionID)
+	return err != nil || !active
+}
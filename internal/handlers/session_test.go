@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSessionTest(t *testing.T) (*testutil.MockTokenService, *testutil.MockHub, *services.JWTService, *drift.Engine) {
+	t.Helper()
+	mockTokenService := new(testutil.MockTokenService)
+	mockHub := new(testutil.MockHub)
+	handler := NewSessionHandler(mockTokenService, mockHub)
+	jwtSvc := newTestJWTService()
+
+	app := drift.New()
+	app.Use(middleware.Auth(jwtSvc))
+	app.Get("/users/me/sessions", handler.List)
+	app.Delete("/users/me/sessions/:sessionId", handler.Revoke)
+
+	return mockTokenService, mockHub, jwtSvc, app
+}
+
+func TestSessionHandler_List(t *testing.T) {
+	mockTokenService, _, jwtSvc, app := setupSessionTest(t)
+	userID := uuid.New()
+	currentID := uuid.New()
+	now := time.Now()
+
+	mockTokenService.On("ListSessions", mock.Anything, userID).Return([]models.Session{
+		{ID: currentID, UserID: userID, DeviceName: "Laptop", UserAgent: "Electron", IPAddress: "192.0.2.1", CreatedAt: now, LastUsedAt: now},
+		{ID: uuid.New(), UserID: userID, UserAgent: "nikode-cli/1.0", IPAddress: "198.51.100.7", CreatedAt: now, LastUsedAt: now},
+	}, nil)
+
+	pair, err := jwtSvc.GenerateTokenPair(userID, currentID, "test@example.com", "user")
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/users/me/sessions", nil)
+	req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response []dto.SessionResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response, 2)
+	assert.Equal(t, "Laptop", response[0].DeviceName)
+	assert.True(t, response[0].Current)
+	assert.False(t, response[1].Current)
+	mockTokenService.AssertExpectations(t)
+}
+
+func TestSessionHandler_Revoke(t *testing.T) {
+	mockTokenService, mockHub, jwtSvc, app := setupSessionTest(t)
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	mockTokenService.On("RevokeSession", mock.Anything, userID, sessionID).Return(nil)
+	mockHub.On("DisconnectSession", sessionID).Return(1)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/me/sessions/"+sessionID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "test@example.com"))
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "session revoked")
+	mockTokenService.AssertExpectations(t)
+	mockHub.AssertExpectations(t)
+}
+
+func TestSessionHandler_Revoke_NotFound(t *testing.T) {
+	mockTokenService, mockHub, jwtSvc, app := setupSessionTest(t)
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	mockTokenService.On("RevokeSession", mock.Anything, userID, sessionID).Return(services.ErrSessionNotFound)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/me/sessions/"+sessionID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "test@example.com"))
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockHub.AssertNotCalled(t, "DisconnectSession", mock.Anything)
+}
+
+func TestSessionHandler_Revoke_InvalidID(t *testing.T) {
+	_, _, jwtSvc, app := setupSessionTest(t)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/me/sessions/not-a-uuid", nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, uuid.New(), "test@example.com"))
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid session id")
+}
+
+func TestSessionDeviceName(t *testing.T) {
+	assert.Equal(t, "Laptop", sessionDeviceName("  Laptop\n"))
+	assert.Len(t, []rune(sessionDeviceName(strings.Repeat("é", 300))), maxDeviceNameLength)
+}
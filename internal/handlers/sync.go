@@ -38,14 +38,16 @@ type SyncHandler struct {
 	hub              HubInterface
 	workspaceService WorkspaceServiceInterface
 	userService      UserServiceInterface
+	tokenService     TokenServiceInterface
 	jwtService       *services.JWTService
 }
 
-func NewSyncHandler(hub HubInterface, workspaceService WorkspaceServiceInterface, userService UserServiceInterface, jwtService *services.JWTService) *SyncHandler {
+func NewSyncHandler(hub HubInterface, workspaceService WorkspaceServiceInterface, userService UserServiceInterface, tokenService TokenServiceInterface, jwtService *services.JWTService) *SyncHandler {
 	return &SyncHandler{
 		hub:              hub,
 		workspaceService: workspaceService,
 		userService:      userService,
+		tokenService:     tokenService,
 		jwtService:       jwtService,
 	}
 }
@@ -64,6 +66,11 @@ func (h *SyncHandler) Connect(c *drift.Context) {
 		return
 	}
 
+	if sessionRevoked(h.tokenService, claims) {
+		c.Unauthorized("session revoked")
+		return
+	}
+
 	// Look up user for name/avatar
 	user, err := h.userService.GetByID(context.Background(), claims.UserID)
 	if err != nil {
@@ -86,9 +93,12 @@ func (h *SyncHandler) Connect(c *drift.Context) {
 		AvatarURL:  user.AvatarURL,
 		Workspaces: make(map[uuid.UUID]bool),
 		Send:       make(chan []byte, 256),
+		SessionID:  claims.SessionID,
+		Disconnect: make(chan struct{}),
 	}
 
 	h.hub.Register(client)
+	h.hub.TrackSession(client)
 
 	// Send connected message
 	_ = conn.WriteJSON(map[string]string{
@@ -122,6 +132,10 @@ func (h *SyncHandler) Connect(c *drift.Context) {
 				if err := conn.Ping(nil); err != nil {
 					return
 				}
+			case <-client.Disconnect:
+				_ = conn.SetWriteDeadline(time.Now().Add(syncWriteTimeout))
+				_ = conn.WriteJSON(map[string]string{"type": "session_revoked"})
+				return
 			case <-done:
 				return
 			}
@@ -132,6 +146,7 @@ func (h *SyncHandler) Connect(c *drift.Context) {
 	func() {
 		defer func() {
 			close(done)
+			h.hub.UntrackSession(client)
 			h.hub.Unregister(client)
 		}()
 
@@ -36,14 +36,16 @@ type TunnelMessage struct {
 }
 
 type TunnelHandler struct {
-	hub        *hub.Hub
-	jwtService *services.JWTService
+	hub          *hub.Hub
+	tokenService TokenServiceInterface
+	jwtService   *services.JWTService
 }
 
-func NewTunnelHandler(h *hub.Hub, jwtService *services.JWTService) *TunnelHandler {
+func NewTunnelHandler(h *hub.Hub, tokenService TokenServiceInterface, jwtService *services.JWTService) *TunnelHandler {
 	return &TunnelHandler{
-		hub:        h,
-		jwtService: jwtService,
+		hub:          h,
+		tokenService: tokenService,
+		jwtService:   jwtService,
 	}
 }
 
@@ -61,6 +63,11 @@ func (h *TunnelHandler) Connect(c *drift.Context) {
 		return
 	}
 
+	if sessionRevoked(h.tokenService, claims) {
+		c.Unauthorized("session revoked")
+		return
+	}
+
 	// Upgrade to WebSocket
 	conn, err := websocket.Upgrade(c)
 	if err != nil {
@@ -74,7 +81,10 @@ func (h *TunnelHandler) Connect(c *drift.Context) {
 		UserID:     claims.UserID,
 		Workspaces: make(map[uuid.UUID]bool),
 		Send:       make(chan []byte, 256),
+		SessionID:  claims.SessionID,
+		Disconnect: make(chan struct{}),
 	}
+	h.hub.TrackSession(client)
 
 	// Send connected message
 	_ = conn.WriteJSON(map[string]string{
@@ -108,6 +118,10 @@ func (h *TunnelHandler) Connect(c *drift.Context) {
 				if err := conn.Ping(nil); err != nil {
 					return
 				}
+			case <-client.Disconnect:
+				_ = conn.SetWriteDeadline(time.Now().Add(tunnelWriteTimeout))
+				_ = conn.WriteJSON(map[string]string{"type": "session_revoked"})
+				return
 			case <-done:
 				return
 			}
@@ -118,6 +132,7 @@ func (h *TunnelHandler) Connect(c *drift.Context) {
 	func() {
 		defer func() {
 			close(done)
+			h.hub.UntrackSession(client)
 			close(client.Send)
 			// Clean up all tunnels for this client
 			h.hub.UnregisterClientTunnels(clientID)
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+)
+
+const (
+	twoFactorChallengeTTL = 5 * time.Minute
+
+	// Codes are throttled per user, which keeps guessing one of the million
+	// TOTP codes impractical even across challenges
+	twoFactorVerifyPerMinute = 5
+	twoFactorVerifyBurst     = 5
+)
+
+// twoFactorChallenge is a login held back until the user enters a second
+// factor
+type twoFactorChallenge struct {
+	UserID uuid.UUID `json:"user_id"`
+	// DeviceCode is set when the login approves a device
+	DeviceCode string `json:"device_code,omitempty"`
+}
+
+// startTwoFactor holds back a login if the user has a second factor. It
+// reports whether one is required and returns the challenge token.
+func (h *AuthHandler) startTwoFactor(ctx context.Context, userID uuid.UUID, deviceCode string) (string, bool, error) {
+	enabled, err := h.twoFactorService.IsEnabled(ctx, userID)
+	if err != nil || !enabled {
+		return "", false, err
+	}
+
+	challenge, err := oauth.GenerateState()
+	if err != nil {
+		return "", true, err
+	}
+
+	tfc := twoFactorChallenge{UserID: userID, DeviceCode: deviceCode}
+	if err := services.PutJSON(ctx, h.store, twoFactorChallengeKeyPrefix+challenge, tfc, twoFactorChallengeTTL); err != nil {
+		return "", true, err
+	}
+	return challenge, true, nil
+}
+
+// loadTwoFactorChallenge returns a pending challenge of the given kind. It
+// stays pending until takeTwoFactorChallenge, so a mistyped code can be
+// retried.
+func (h *AuthHandler) loadTwoFactorChallenge(ctx context.Context, token string, device bool) (twoFactorChallenge, bool) {
+	var tfc twoFactorChallenge
+	if token == "" || services.GetJSON(ctx, h.store, twoFactorChallengeKeyPrefix+token, &tfc) != nil {
+		return twoFactorChallenge{}, false
+	}
+	if (tfc.DeviceCode != "") != device {
+		return twoFactorChallenge{}, false
+	}
+	return tfc, true
+}
+
+// takeTwoFactorChallenge completes a challenge; it reports false if another
+// request completed it first
+func (h *AuthHandler) takeTwoFactorChallenge(ctx context.Context, token string) bool {
+	_, err := h.store.Take(ctx, twoFactorChallengeKeyPrefix+token)
+	return err == nil
+}
+
+// VerifyTwoFactor checks the second factor of a login that redirected with a
+// two_factor challenge and responds with the auth code for ExchangeCode.
+func (h *AuthHandler) VerifyTwoFactor(c *drift.Context) {
+	var req dto.VerifyTwoFactorRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.BadRequest("invalid request body")
+		return
+	}
+
+	if req.Token == "" || req.Code == "" {
+		c.BadRequest("token and code are required")
+		return
+	}
+
+	ctx := context.Background()
+
+	tfc, ok := h.loadTwoFactorChallenge(ctx, req.Token, false)
+	if !ok {
+		c.Unauthorized("invalid or expired challenge")
+		return
+	}
+
+	ok, retryAfter := h.twoFactorLimiter.Allow(tfc.UserID, twoFactorVerifyPerMinute, twoFactorVerifyBurst)
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.TooManyRequests("too many attempts")
+		return
+	}
+
+	if err := h.twoFactorService.Verify(ctx, tfc.UserID, req.Code); err != nil {
+		if errors.Is(err, services.ErrTwoFactorInvalidCode) {
+			c.Unauthorized("invalid code")
+			return
+		}
+		c.InternalServerError("failed to verify code")
+		return
+	}
+
+	// Each challenge completes one login
+	if !h.takeTwoFactorChallenge(ctx, req.Token) {
+		c.Unauthorized("invalid or expired challenge")
+		return
+	}
+
+	authCode, err := h.issueAuthCode(ctx, tfc.UserID)
+	if err != nil {
+		c.InternalServerError("failed to generate auth code")
+		return
+	}
+
+	_ = c.JSON(200, dto.VerifyTwoFactorResponse{Code: authCode})
+}
+
+// DeviceTwoFactor checks the second factor entered on the device
+// verification page and asks the user to approve the device.
+func (h *AuthHandler) DeviceTwoFactor(c *drift.Context) {
+	token := c.PostForm("token")
+	code := c.PostForm("code")
+
+	ctx := context.Background()
+
+	tfc, ok := h.loadTwoFactorChallenge(ctx, token, true)
+	if !ok {
+		h.deviceError(c, "That sign-in has expired. Start the sign-in again on your device.")
+		return
+	}
+
+	ok, retryAfter := h.twoFactorLimiter.Allow(tfc.UserID, twoFactorVerifyPerMinute, twoFactorVerifyBurst)
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		h.renderDevicePage(c, 429, devicePage{TwoFactorToken: token, Error: "Too many attempts. Wait a minute and try again."})
+		return
+	}
+
+	if err := h.twoFactorService.Verify(ctx, tfc.UserID, code); err != nil {
+		if errors.Is(err, services.ErrTwoFactorInvalidCode) {
+			h.renderDevicePage(c, 400, devicePage{TwoFactorToken: token, Error: "That code is incorrect."})
+			return
+		}
+		h.deviceError(c, "Failed to verify the code.")
+		return
+	}
+
+	if !h.takeTwoFactorChallenge(ctx, token) {
+		h.deviceError(c, "That sign-in has expired. Start the sign-in again on your device.")
+		return
+	}
+
+	h.confirmDevice(ctx, c, tfc.DeviceCode, tfc.UserID)
+}
+
+// TwoFactorHandler lets users manage their own second factor.
+type TwoFactorHandler struct {
+	twoFactorService TwoFactorServiceInterface
+
+	// twoFactorLimiter throttles codes per user, so a stolen session can't
+	// guess its way to disabling the second factor
+	twoFactorLimiter *services.TokenBucketLimiter
+}
+
+func NewTwoFactorHandler(twoFactorService TwoFactorServiceInterface) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorService: twoFactorService,
+		twoFactorLimiter: services.NewTokenBucketLimiter(),
+	}
+}
+
+// allowCode throttles the codes a user checks; it answers 429 when they
+// checked too many
+func (h *TwoFactorHandler) allowCode(c *drift.Context, userID uuid.UUID) bool {
+	ok, retryAfter := h.twoFactorLimiter.Allow(userID, twoFactorVerifyPerMinute, twoFactorVerifyBurst)
+	if !ok {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.TooManyRequests("too many attempts")
+	}
+	return ok
+}
+
+func (h *TwoFactorHandler) Status(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	status, err := h.twoFactorService.Status(context.Background(), userID)
+	if err != nil {
+		c.InternalServerError("failed to get two-factor status")
+		return
+	}
+
+	_ = c.JSON(200, dto.TwoFactorStatusResponse{
+		Enabled:           status.Enabled,
+		RecoveryCodesLeft: status.RecoveryCodesLeft,
+	})
+}
+
+// BeginEnrollment creates a TOTP secret for the user's authenticator app.
+// It is enabled once ConfirmEnrollment sees a code generated from it.
+func (h *TwoFactorHandler) BeginEnrollment(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	enrollment, err := h.twoFactorService.BeginEnrollment(context.Background(), userID, middleware.GetUserEmail(c))
+	if err != nil {
+		if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+			c.Conflict("two-factor authentication is already enabled")
+			return
+		}
+		c.InternalServerError("failed to start enrollment")
+		return
+	}
+
+	_ = c.JSON(201, dto.TwoFactorEnrollmentResponse{
+		Secret:     enrollment.Secret,
+		OTPAuthURL: enrollment.OTPAuthURL,
+	})
+}
+
+func (h *TwoFactorHandler) ConfirmEnrollment(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	code, ok := bindTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.twoFactorService.ConfirmEnrollment(context.Background(), userID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTwoFactorInvalidCode):
+			c.BadRequest("invalid code")
+		case errors.Is(err, services.ErrTwoFactorNotEnrolling):
+			c.BadRequest("start enrollment first")
+		case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+			c.Conflict("two-factor authentication is already enabled")
+		default:
+			c.InternalServerError("failed to enable two-factor authentication")
+		}
+		return
+	}
+
+	_ = c.JSON(200, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	code, ok := bindTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	if !h.allowCode(c, userID) {
+		return
+	}
+
+	codes, err := h.twoFactorService.RegenerateRecoveryCodes(context.Background(), userID, code)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrTwoFactorInvalidCode):
+			c.BadRequest("invalid code")
+		case errors.Is(err, services.ErrTwoFactorNotEnabled):
+			c.BadRequest("two-factor authentication is not enabled")
+		default:
+			c.InternalServerError("failed to regenerate recovery codes")
+		}
+		return
+	}
+
+	_ = c.JSON(200, dto.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+func (h *TwoFactorHandler) Disable(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	code, ok := bindTwoFactorCode(c)
+	if !ok {
+		return
+	}
+
+	if !h.allowCode(c, userID) {
+		return
+	}
+
+	if err := h.twoFactorService.Disable(context.Background(), userID, code); err != nil {
+		switch {
+		case errors.Is(err, services.ErrTwoFactorRequired):
+			_ = c.JSON(409, map[string]string{
+				"error":   "two-factor authentication is required",
+				"message": "leave the workspaces that require it before disabling it",
+			})
+		case errors.Is(err, services.ErrTwoFactorInvalidCode):
+			c.BadRequest("invalid code")
+		case errors.Is(err, services.ErrTwoFactorNotEnabled):
+			c.BadRequest("two-factor authentication is not enabled")
+		default:
+			c.InternalServerError("failed to disable two-factor authentication")
+		}
+		return
+	}
+
+	_ = c.JSON(200, map[string]string{"message": "two-factor authentication disabled"})
+}
+
+func bindTwoFactorCode(c *drift.Context) (string, bool) {
+	var req dto.TwoFactorCodeRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.BadRequest("invalid request body")
+		return "", false
+	}
+	if req.Code == "" {
+		c.BadRequest("code is required")
+		return "", false
+	}
+	return req.Code, true
+}
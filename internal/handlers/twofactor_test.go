@@ -0,0 +1,332 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/dimitrije/nikode-api/pkg/dto"
+	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	driftmw "github.com/m1z23r/drift/pkg/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// withTwoFactor gives the user a second factor
+func withTwoFactor(handler *AuthHandler, userID uuid.UUID) *testutil.MockTwoFactorService {
+	mockTwoFactorService := new(testutil.MockTwoFactorService)
+	mockTwoFactorService.On("IsEnabled", mock.Anything, userID).Return(true, nil)
+	handler.twoFactorService = mockTwoFactorService
+	return mockTwoFactorService
+}
+
+func postTwoFactorVerify(app *drift.Engine, token, code string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(dto.VerifyTwoFactorRequest{Token: token, Code: code})
+	req := httptest.NewRequest(http.MethodPost, "/auth/2fa/verify", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthHandler_Callback_TwoFactor(t *testing.T) {
+	mockUserService, _, _, handler, cfg := setupAuthTest(t)
+	userID := uuid.New()
+	mockTwoFactorService := withTwoFactor(handler, userID)
+
+	mockProvider := new(testutil.MockOAuthProvider)
+	userInfo := &oauth.UserInfo{Email: "ada@example.com", ID: "1", Provider: "github"}
+	mockProvider.On("ExchangeCode", mock.Anything, "gh-code").Return(userInfo, nil)
+	handler.providers["github"] = mockProvider
+	mockUserService.On("FindOrCreateFromOAuth", mock.Anything, userInfo).Return(&models.User{ID: userID}, nil)
+	storeState(t, handler, "state", stateData{}, 10*time.Minute)
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Get("/auth/:provider/callback", handler.Callback)
+	app.Post("/auth/2fa/verify", handler.VerifyTwoFactor)
+
+	// The callback asks for a second factor instead of issuing an auth code
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/github/callback?code=gh-code&state=state", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(location.String(), cfg.FrontendCallbackURL))
+	assert.Empty(t, location.Query().Get("code"))
+	challenge := location.Query().Get("two_factor")
+	require.NotEmpty(t, challenge)
+
+	// A wrong code keeps the challenge open
+	mockTwoFactorService.On("Verify", mock.Anything, userID, "000000").Return(services.ErrTwoFactorInvalidCode).Once()
+	rec = postTwoFactorVerify(app, challenge, "000000")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	// The right code is traded for an auth code, once
+	mockTwoFactorService.On("Verify", mock.Anything, userID, "123456").Return(nil).Once()
+	rec = postTwoFactorVerify(app, challenge, "123456")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response dto.VerifyTwoFactorResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	acd, ok := loadAuthCode(handler, response.Code)
+	require.True(t, ok)
+	assert.Equal(t, userID, acd.UserID)
+
+	rec = postTwoFactorVerify(app, challenge, "123456")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	mockTwoFactorService.AssertExpectations(t)
+}
+
+func storeTwoFactorChallenge(t *testing.T, handler *AuthHandler, token string, tfc twoFactorChallenge) {
+	t.Helper()
+	require.NoError(t, services.PutJSON(context.Background(), handler.store, twoFactorChallengeKeyPrefix+token, tfc, time.Minute))
+}
+
+func TestAuthHandler_VerifyTwoFactor_Throttled(t *testing.T) {
+	_, _, _, handler, _ := setupAuthTest(t)
+	userID := uuid.New()
+	mockTwoFactorService := withTwoFactor(handler, userID)
+	mockTwoFactorService.On("Verify", mock.Anything, userID, "000000").Return(services.ErrTwoFactorInvalidCode)
+	storeTwoFactorChallenge(t, handler, "challenge", twoFactorChallenge{UserID: userID})
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Post("/auth/2fa/verify", handler.VerifyTwoFactor)
+
+	for range twoFactorVerifyBurst {
+		rec := postTwoFactorVerify(app, "challenge", "000000")
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+
+	rec := postTwoFactorVerify(app, "challenge", "000000")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+}
+
+func TestAuthHandler_VerifyTwoFactor_DeviceChallenge(t *testing.T) {
+	_, _, _, handler, _ := setupAuthTest(t)
+	storeTwoFactorChallenge(t, handler, "challenge", twoFactorChallenge{UserID: uuid.New(), DeviceCode: "device"})
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Post("/auth/2fa/verify", handler.VerifyTwoFactor)
+
+	rec := postTwoFactorVerify(app, "challenge", "123456")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAuthHandler_DeviceFlow_TwoFactor(t *testing.T) {
+	mockUserService, _, _, mockProvider, handler, app := setupDeviceTest(t)
+	app.Post("/device/2fa", handler.DeviceTwoFactor)
+	code := requestDeviceCode(t, app)
+
+	var state string
+	mockProvider.On("GetConsentURL", mock.Anything).Run(func(args mock.Arguments) {
+		state = args.String(0)
+	}).Return("https://github.com/login/oauth/authorize")
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/device/github?user_code="+code.UserCode, nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	userID := uuid.New()
+	mockTwoFactorService := withTwoFactor(handler, userID)
+	userInfo := &oauth.UserInfo{Email: "ada@example.com", ID: "1", Provider: "github"}
+	mockProvider.On("ExchangeCode", mock.Anything, "gh-code").Return(userInfo, nil)
+	mockUserService.On("FindOrCreateFromOAuth", mock.Anything, userInfo).Return(&models.User{ID: userID}, nil)
+
+	// The callback asks for a second factor before approving
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/github/callback?code=gh-code&state="+state, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Two-factor authentication")
+	assert.NotContains(t, rec.Body.String(), "Device approved")
+
+	match := regexp.MustCompile(`name="token" value="([^"]+)"`).FindStringSubmatch(rec.Body.String())
+	require.Len(t, match, 2)
+	challenge := match[1]
+
+	postCode := func(value string) *httptest.ResponseRecorder {
+		form := url.Values{"token": {challenge}, "code": {value}}
+		req := httptest.NewRequest(http.MethodPost, "/device/2fa", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	mockTwoFactorService.On("Verify", mock.Anything, userID, "000000").Return(services.ErrTwoFactorInvalidCode).Once()
+	rec = postCode("000000")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "That code is incorrect.")
+	assert.Equal(t, "authorization_pending", deviceErrorCode(t, pollDeviceToken(app, code.DeviceCode)))
+
+	mockTwoFactorService.On("Verify", mock.Anything, userID, "123456").Return(nil).Once()
+	rec = postCode("123456")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Approve this device?")
+
+	rec = postDeviceDecision(app, confirmToken(t, rec), "approve")
+	assert.Contains(t, rec.Body.String(), "Device approved")
+
+	approvedID, ok := loadDeviceApproval(handler, code.DeviceCode)
+	assert.True(t, ok)
+	assert.Equal(t, userID, approvedID)
+	mockTwoFactorService.AssertExpectations(t)
+}
+
+func setupTwoFactorTest(t *testing.T) (*testutil.MockTwoFactorService, *services.JWTService, *drift.Engine) {
+	t.Helper()
+	mockTwoFactorService := new(testutil.MockTwoFactorService)
+	handler := NewTwoFactorHandler(mockTwoFactorService)
+	jwtSvc := newTestJWTService()
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Use(middleware.Auth(jwtSvc))
+	app.Get("/users/me/2fa", handler.Status)
+	app.Post("/users/me/2fa/totp", handler.BeginEnrollment)
+	app.Post("/users/me/2fa/totp/confirm", handler.ConfirmEnrollment)
+	app.Post("/users/me/2fa/recovery-codes", handler.RegenerateRecoveryCodes)
+	app.Post("/users/me/2fa/disable", handler.Disable)
+
+	return mockTwoFactorService, jwtSvc, app
+}
+
+func twoFactorRequest(t *testing.T, jwtSvc *services.JWTService, userID uuid.UUID, method, path string, body any) *http.Request {
+	t.Helper()
+	jsonBody, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewReader(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "ada@example.com"))
+	return req
+}
+
+func TestTwoFactorHandler_Enrollment(t *testing.T) {
+	mockTwoFactorService, jwtSvc, app := setupTwoFactorTest(t)
+	userID := uuid.New()
+
+	mockTwoFactorService.On("BeginEnrollment", mock.Anything, userID, "ada@example.com").Return(&services.TwoFactorEnrollment{
+		Secret:     "JBSWY3DPEHPK3PXP",
+		OTPAuthURL: "otpauth://totp/Nikode:ada%40example.com?secret=JBSWY3DPEHPK3PXP",
+	}, nil)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, twoFactorRequest(t, jwtSvc, userID, http.MethodPost, "/users/me/2fa/totp", nil))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	var enrollment dto.TwoFactorEnrollmentResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &enrollment))
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", enrollment.Secret)
+	assert.Contains(t, enrollment.OTPAuthURL, "otpauth://totp/")
+
+	codes := []string{"k3m9p-x7q2r", "a2b3c-d4e5f"}
+	mockTwoFactorService.On("ConfirmEnrollment", mock.Anything, userID, "123456").Return(codes, nil)
+
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, twoFactorRequest(t, jwtSvc, userID, http.MethodPost, "/users/me/2fa/totp/confirm", dto.TwoFactorCodeRequest{Code: "123456"}))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response dto.RecoveryCodesResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, codes, response.RecoveryCodes)
+	mockTwoFactorService.AssertExpectations(t)
+}
+
+func TestTwoFactorHandler_Throttled(t *testing.T) {
+	for _, tc := range []struct{ path, method string }{
+		{"/users/me/2fa/disable", "Disable"},
+		{"/users/me/2fa/recovery-codes", "RegenerateRecoveryCodes"},
+	} {
+		t.Run(tc.method, func(t *testing.T) {
+			mockTwoFactorService, jwtSvc, app := setupTwoFactorTest(t)
+			userID := uuid.New()
+			if tc.method == "Disable" {
+				mockTwoFactorService.On(tc.method, mock.Anything, userID, "000000").Return(services.ErrTwoFactorInvalidCode)
+			} else {
+				mockTwoFactorService.On(tc.method, mock.Anything, userID, "000000").Return(nil, services.ErrTwoFactorInvalidCode)
+			}
+
+			var rec *httptest.ResponseRecorder
+			for range twoFactorVerifyBurst + 1 {
+				rec = httptest.NewRecorder()
+				app.ServeHTTP(rec, twoFactorRequest(t, jwtSvc, userID, http.MethodPost, tc.path, dto.TwoFactorCodeRequest{Code: "000000"}))
+			}
+
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+			assert.NotEmpty(t, rec.Header().Get("Retry-After"))
+			mockTwoFactorService.AssertNumberOfCalls(t, tc.method, twoFactorVerifyBurst)
+		})
+	}
+}
+
+func TestTwoFactorHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		method string
+		err    error
+		status int
+	}{
+		{"already enabled", "/users/me/2fa/totp", "BeginEnrollment", services.ErrTwoFactorAlreadyEnabled, http.StatusConflict},
+		{"wrong confirmation code", "/users/me/2fa/totp/confirm", "ConfirmEnrollment", services.ErrTwoFactorInvalidCode, http.StatusBadRequest},
+		{"not enrolling", "/users/me/2fa/totp/confirm", "ConfirmEnrollment", services.ErrTwoFactorNotEnrolling, http.StatusBadRequest},
+		{"regenerate without 2FA", "/users/me/2fa/recovery-codes", "RegenerateRecoveryCodes", services.ErrTwoFactorNotEnabled, http.StatusBadRequest},
+		{"disable required by workspace", "/users/me/2fa/disable", "Disable", services.ErrTwoFactorRequired, http.StatusConflict},
+		{"disable with wrong code", "/users/me/2fa/disable", "Disable", services.ErrTwoFactorInvalidCode, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockTwoFactorService, jwtSvc, app := setupTwoFactorTest(t)
+			userID := uuid.New()
+
+			switch tt.method {
+			case "BeginEnrollment":
+				mockTwoFactorService.On(tt.method, mock.Anything, userID, mock.Anything).Return(nil, tt.err)
+			case "Disable":
+				mockTwoFactorService.On(tt.method, mock.Anything, userID, "123456").Return(tt.err)
+			default:
+				mockTwoFactorService.On(tt.method, mock.Anything, userID, "123456").Return(nil, tt.err)
+			}
+
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, twoFactorRequest(t, jwtSvc, userID, http.MethodPost, tt.path, dto.TwoFactorCodeRequest{Code: "123456"}))
+			assert.Equal(t, tt.status, rec.Code)
+			mockTwoFactorService.AssertExpectations(t)
+		})
+	}
+}
+
+func TestTwoFactorHandler_MissingCode(t *testing.T) {
+	_, jwtSvc, app := setupTwoFactorTest(t)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, twoFactorRequest(t, jwtSvc, uuid.New(), http.MethodPost, "/users/me/2fa/disable", dto.TwoFactorCodeRequest{}))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestTwoFactorHandler_Status(t *testing.T) {
+	mockTwoFactorService, jwtSvc, app := setupTwoFactorTest(t)
+	userID := uuid.New()
+	mockTwoFactorService.On("Status", mock.Anything, userID).Return(&services.TwoFactorStatus{Enabled: true, RecoveryCodesLeft: 8}, nil)
+
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, twoFactorRequest(t, jwtSvc, userID, http.MethodGet, "/users/me/2fa", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response dto.TwoFactorStatusResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.True(t, response.Enabled)
+	assert.Equal(t, 8, response.RecoveryCodesLeft)
+}
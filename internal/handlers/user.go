@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
 	"github.com/dimitrije/nikode-api/pkg/dto"
 	"github.com/google/uuid"
 	"github.com/m1z23r/drift/pkg/drift"
@@ -73,3 +77,66 @@ func (h *UserHandler) UpdateMe(c *drift.Context) {
 		GlobalRole: user.GlobalRole,
 	})
 }
+
+func (h *UserHandler) ListIdentities(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	identities, err := h.userService.ListIdentities(context.Background(), userID)
+	if err != nil {
+		c.InternalServerError("failed to list identities")
+		return
+	}
+
+	response := make([]dto.UserIdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		response = append(response, userIdentityResponse(identity))
+	}
+
+	_ = c.JSON(200, response)
+}
+
+func (h *UserHandler) UnlinkIdentity(c *drift.Context) {
+	userID := middleware.GetUserID(c)
+	if userID == uuid.Nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	identityID, err := uuid.Parse(c.Param("identityId"))
+	if err != nil {
+		c.BadRequest("invalid identity ID")
+		return
+	}
+
+	if err := h.userService.UnlinkIdentity(context.Background(), userID, identityID); err != nil {
+		switch {
+		case errors.Is(err, services.ErrIdentityNotFound):
+			c.NotFound("identity not found")
+		case errors.Is(err, services.ErrLastIdentity):
+			_ = c.JSON(409, map[string]string{
+				"error":   "cannot unlink the last identity",
+				"message": "link another provider before removing this one",
+			})
+		default:
+			c.InternalServerError("failed to unlink identity")
+		}
+		return
+	}
+
+	_ = c.JSON(200, map[string]string{"message": "identity unlinked"})
+}
+
+func userIdentityResponse(identity models.UserIdentity) dto.UserIdentityResponse {
+	return dto.UserIdentityResponse{
+		ID:            identity.ID,
+		Provider:      identity.Provider,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		CreatedAt:     identity.CreatedAt.Format(time.RFC3339),
+		LastUsedAt:    identity.LastUsedAt.Format(time.RFC3339),
+	}
+}
@@ -28,7 +28,7 @@ func newTestJWTService() *services.JWTService {
 
 func generateTestToken(t *testing.T, jwtSvc *services.JWTService, userID uuid.UUID, email string) string {
 	t.Helper()
-	pair, err := jwtSvc.GenerateTokenPair(userID, email, "user")
+	pair, err := jwtSvc.GenerateTokenPair(userID, uuid.Nil, email, "user")
 	require.NoError(t, err)
 	return pair.AccessToken
 }
@@ -273,3 +273,71 @@ func TestUserHandler_UpdateMe_ServiceError(t *testing.T) {
 
 	mockUserService.AssertExpectations(t)
 }
+
+func TestUserHandler_ListIdentities(t *testing.T) {
+	mockUserService := new(testutil.MockUserService)
+	handler := NewUserHandler(mockUserService)
+	jwtSvc := newTestJWTService()
+	userID := uuid.New()
+	now := time.Now()
+
+	mockUserService.On("ListIdentities", mock.Anything, userID).Return([]models.UserIdentity{
+		{ID: uuid.New(), UserID: userID, Provider: "github", ProviderID: "gh-1", Email: "test@example.com", EmailVerified: true, CreatedAt: now, LastUsedAt: now},
+	}, nil)
+
+	app := drift.New()
+	app.Use(middleware.Auth(jwtSvc))
+	app.Get("/users/me/identities", handler.ListIdentities)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/identities", nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "test@example.com"))
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	var response []dto.UserIdentityResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response, 1)
+	assert.Equal(t, "github", response[0].Provider)
+	assert.True(t, response[0].EmailVerified)
+	assert.NotContains(t, rec.Body.String(), "gh-1")
+
+	mockUserService.AssertExpectations(t)
+}
+
+func TestUserHandler_UnlinkIdentity(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"unlinked", nil, http.StatusOK},
+		{"not found", services.ErrIdentityNotFound, http.StatusNotFound},
+		{"last identity", services.ErrLastIdentity, http.StatusConflict},
+		{"service error", errors.New("db error"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUserService := new(testutil.MockUserService)
+			handler := NewUserHandler(mockUserService)
+			jwtSvc := newTestJWTService()
+			userID := uuid.New()
+			identityID := uuid.New()
+
+			mockUserService.On("UnlinkIdentity", mock.Anything, userID, identityID).Return(tt.err)
+
+			app := drift.New()
+			app.Use(middleware.Auth(jwtSvc))
+			app.Delete("/users/me/identities/:identityId", handler.UnlinkIdentity)
+
+			req := httptest.NewRequest(http.MethodDelete, "/users/me/identities/"+identityID.String(), nil)
+			req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "test@example.com"))
+			rec := httptest.NewRecorder()
+			app.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			mockUserService.AssertExpectations(t)
+		})
+	}
+}
@@ -388,3 +388,69 @@ func (h *VaultHandler) DeleteItem(c *drift.Context) {
 
 	_ = c.JSON(200, map[string]string{"message": "vault item deleted"})
 }
+
+// GetVaultForAPIKey returns the vault of the API key's workspace. The salt
+// and verification let automation derive the vault key locally.
+func (h *VaultHandler) GetVaultForAPIKey(c *drift.Context) {
+	apiKey := middleware.GetAPIKey(c)
+	if apiKey == nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	vault, err := h.vaultService.GetByWorkspaceID(context.Background(), apiKey.WorkspaceID)
+	if err != nil {
+		if err == services.ErrVaultNotFound {
+			c.NotFound("vault not found")
+			return
+		}
+		c.InternalServerError("failed to get vault")
+		return
+	}
+
+	_ = c.JSON(200, dto.VaultResponse{
+		ID:           vault.ID,
+		Salt:         vault.Salt,
+		Verification: vault.Verification,
+		CreatedAt:    vault.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    vault.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+// ListItemsForAPIKey returns the encrypted items of the API key's workspace
+// vault. Items are only ever returned as ciphertext.
+func (h *VaultHandler) ListItemsForAPIKey(c *drift.Context) {
+	apiKey := middleware.GetAPIKey(c)
+	if apiKey == nil {
+		c.Unauthorized("not authenticated")
+		return
+	}
+
+	vault, err := h.vaultService.GetByWorkspaceID(context.Background(), apiKey.WorkspaceID)
+	if err != nil {
+		if err == services.ErrVaultNotFound {
+			c.NotFound("vault not found")
+			return
+		}
+		c.InternalServerError("failed to get vault")
+		return
+	}
+
+	items, err := h.vaultService.ListItems(context.Background(), vault.ID)
+	if err != nil {
+		c.InternalServerError("failed to list vault items")
+		return
+	}
+
+	response := make([]dto.VaultItemResponse, 0, len(items))
+	for _, item := range items {
+		response = append(response, dto.VaultItemResponse{
+			ID:        item.ID,
+			Data:      item.Data,
+			CreatedAt: item.CreatedAt.Format(time.RFC3339),
+			UpdatedAt: item.UpdatedAt.Format(time.RFC3339),
+		})
+	}
+
+	_ = c.JSON(200, response)
+}
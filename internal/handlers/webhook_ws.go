@@ -15,14 +15,16 @@ import (
 )
 
 type WebhookWSHandler struct {
-	hub        *hub.Hub
-	jwtService *services.JWTService
+	hub          *hub.Hub
+	tokenService TokenServiceInterface
+	jwtService   *services.JWTService
 }
 
-func NewWebhookWSHandler(h *hub.Hub, jwtService *services.JWTService) *WebhookWSHandler {
+func NewWebhookWSHandler(h *hub.Hub, tokenService TokenServiceInterface, jwtService *services.JWTService) *WebhookWSHandler {
 	return &WebhookWSHandler{
-		hub:        h,
-		jwtService: jwtService,
+		hub:          h,
+		tokenService: tokenService,
+		jwtService:   jwtService,
 	}
 }
 
@@ -39,6 +41,11 @@ func (h *WebhookWSHandler) Connect(c *drift.Context) {
 		return
 	}
 
+	if sessionRevoked(h.tokenService, claims) {
+		c.Unauthorized("session revoked")
+		return
+	}
+
 	conn, err := websocket.Upgrade(c)
 	if err != nil {
 		log.Printf("Webhook WebSocket upgrade failed: %v", err)
@@ -51,7 +58,10 @@ func (h *WebhookWSHandler) Connect(c *drift.Context) {
 		UserID:     claims.UserID,
 		Workspaces: make(map[uuid.UUID]bool),
 		Send:       make(chan []byte, 256),
+		SessionID:  claims.SessionID,
+		Disconnect: make(chan struct{}),
 	}
+	h.hub.TrackSession(client)
 
 	_ = conn.WriteJSON(map[string]string{
 		"type":      "connected",
@@ -83,6 +93,10 @@ func (h *WebhookWSHandler) Connect(c *drift.Context) {
 				if err := conn.Ping(nil); err != nil {
 					return
 				}
+			case <-client.Disconnect:
+				_ = conn.SetWriteDeadline(time.Now().Add(tunnelWriteTimeout))
+				_ = conn.WriteJSON(map[string]string{"type": "session_revoked"})
+				return
 			case <-done:
 				return
 			}
@@ -92,6 +106,7 @@ func (h *WebhookWSHandler) Connect(c *drift.Context) {
 	func() {
 		defer func() {
 			close(done)
+			h.hub.UntrackSession(client)
 			close(client.Send)
 			h.hub.UnregisterClientTunnels(clientID)
 		}()
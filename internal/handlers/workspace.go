@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net/mail"
+	"strings"
 
 	"github.com/dimitrije/nikode-api/internal/hub"
 	"github.com/dimitrije/nikode-api/internal/middleware"
+	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/dimitrije/nikode-api/internal/services"
 	"github.com/dimitrije/nikode-api/pkg/dto"
 	"github.com/google/uuid"
@@ -20,15 +23,20 @@ type WorkspaceHandler struct {
 	emailService     EmailServiceInterface
 	hub              HubInterface
 	baseURL          string
+	emailInvites     bool
 }
 
-func NewWorkspaceHandler(workspaceService WorkspaceServiceInterface, userService UserServiceInterface, emailService EmailServiceInterface, hub HubInterface, baseURL string) *WorkspaceHandler {
+// NewWorkspaceHandler creates the workspace handler. With emailInvites,
+// people without an account can be invited by email; they get the invite
+// when they first sign in with that address.
+func NewWorkspaceHandler(workspaceService WorkspaceServiceInterface, userService UserServiceInterface, emailService EmailServiceInterface, hub HubInterface, baseURL string, emailInvites bool) *WorkspaceHandler {
 	return &WorkspaceHandler{
 		workspaceService: workspaceService,
 		userService:      userService,
 		emailService:     emailService,
 		hub:              hub,
 		baseURL:          baseURL,
+		emailInvites:     emailInvites,
 	}
 }
 
@@ -58,10 +66,11 @@ func (h *WorkspaceHandler) Create(c *drift.Context) {
 	}
 
 	_ = c.JSON(201, dto.WorkspaceResponse{
-		ID:      workspace.ID,
-		Name:    workspace.Name,
-		OwnerID: workspace.OwnerID,
-		Role:    "owner",
+		ID:               workspace.ID,
+		Name:             workspace.Name,
+		OwnerID:          workspace.OwnerID,
+		RequireTwoFactor: workspace.RequireTwoFactor,
+		Role:             "owner",
 	})
 }
 
@@ -81,10 +90,11 @@ func (h *WorkspaceHandler) List(c *drift.Context) {
 	response := make([]dto.WorkspaceResponse, len(workspaces))
 	for i, w := range workspaces {
 		response[i] = dto.WorkspaceResponse{
-			ID:      w.ID,
-			Name:    w.Name,
-			OwnerID: w.OwnerID,
-			Role:    roles[i],
+			ID:               w.ID,
+			Name:             w.Name,
+			OwnerID:          w.OwnerID,
+			RequireTwoFactor: w.RequireTwoFactor,
+			Role:             roles[i],
 		}
 	}
 
@@ -124,10 +134,11 @@ func (h *WorkspaceHandler) Get(c *drift.Context) {
 	}
 
 	_ = c.JSON(200, dto.WorkspaceResponse{
-		ID:      workspace.ID,
-		Name:    workspace.Name,
-		OwnerID: workspace.OwnerID,
-		Role:    role,
+		ID:               workspace.ID,
+		Name:             workspace.Name,
+		OwnerID:          workspace.OwnerID,
+		RequireTwoFactor: workspace.RequireTwoFactor,
+		Role:             role,
 	})
 }
 
@@ -158,24 +169,41 @@ func (h *WorkspaceHandler) Update(c *drift.Context) {
 		return
 	}
 
-	if req.Name == "" {
+	if req.Name == "" && req.RequireTwoFactor == nil {
 		c.BadRequest("name is required")
 		return
 	}
 
-	workspace, err := h.workspaceService.Update(ctx, workspaceID, req.Name)
-	if err != nil {
-		c.InternalServerError("failed to update workspace")
-		return
+	var workspace *models.Workspace
+	if req.RequireTwoFactor != nil {
+		workspace, err = h.workspaceService.SetRequireTwoFactor(ctx, workspaceID, *req.RequireTwoFactor)
+		if errors.Is(err, services.ErrTwoFactorRequired) {
+			_ = c.JSON(409, map[string]string{
+				"error": "enable two-factor authentication before requiring it",
+			})
+			return
+		}
+		if err != nil {
+			c.InternalServerError("failed to update workspace")
+			return
+		}
 	}
 
-	h.hub.BroadcastWorkspaceUpdate(workspaceID, userID, workspace.Name)
+	if req.Name != "" {
+		workspace, err = h.workspaceService.Update(ctx, workspaceID, req.Name)
+		if err != nil {
+			c.InternalServerError("failed to update workspace")
+			return
+		}
+		h.hub.BroadcastWorkspaceUpdate(workspaceID, userID, workspace.Name)
+	}
 
 	_ = c.JSON(200, dto.WorkspaceResponse{
-		ID:      workspace.ID,
-		Name:    workspace.Name,
-		OwnerID: workspace.OwnerID,
-		Role:    "owner",
+		ID:               workspace.ID,
+		Name:             workspace.Name,
+		OwnerID:          workspace.OwnerID,
+		RequireTwoFactor: workspace.RequireTwoFactor,
+		Role:             "owner",
 	})
 }
 
@@ -232,8 +260,8 @@ func (h *WorkspaceHandler) GetMembers(c *drift.Context) {
 		return
 	}
 
-	isMember, err := h.workspaceService.IsMember(context.Background(), workspaceID, userID)
-	if err != nil || !isMember {
+	canAccess, err := h.workspaceService.CanAccess(context.Background(), workspaceID, userID)
+	if err != nil || !canAccess {
 		c.NotFound("workspace not found")
 		return
 	}
@@ -296,6 +324,10 @@ func (h *WorkspaceHandler) InviteMember(c *drift.Context) {
 
 	invitee, err := h.userService.GetByEmail(context.Background(), req.Email)
 	if err != nil {
+		if h.emailInvites {
+			h.inviteByEmail(c, workspaceID, userID, req.Email)
+			return
+		}
 		c.NotFound("user with this email not found")
 		return
 	}
@@ -331,6 +363,36 @@ func (h *WorkspaceHandler) InviteMember(c *drift.Context) {
 	})
 }
 
+// inviteByEmail invites an address that has no account yet.
+func (h *WorkspaceHandler) inviteByEmail(c *drift.Context, workspaceID, inviterID uuid.UUID, email string) {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != strings.TrimSpace(email) {
+		c.BadRequest("invalid email")
+		return
+	}
+	email = services.NormalizeEmail(addr.Address)
+
+	invite, err := h.workspaceService.CreateEmailInvite(context.Background(), workspaceID, inviterID, email)
+	if err != nil {
+		c.InternalServerError("failed to create invite")
+		return
+	}
+
+	workspace, _ := h.workspaceService.GetByID(context.Background(), workspaceID)
+	inviter, _ := h.userService.GetByID(context.Background(), inviterID)
+	if workspace != nil && inviter != nil {
+		_ = h.emailService.SendWorkspaceEmailInvite(email, workspace.Name, inviter.Name)
+	}
+
+	_ = c.JSON(201, dto.WorkspaceInviteResponse{
+		ID:           invite.ID,
+		WorkspaceID:  invite.WorkspaceID,
+		Status:       invite.Status,
+		CreatedAt:    invite.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		InviteeEmail: invite.InviteeEmail,
+	})
+}
+
 func (h *WorkspaceHandler) RemoveMember(c *drift.Context) {
 	userID := middleware.GetUserID(c)
 	if userID == uuid.Nil {
@@ -444,10 +506,11 @@ func (h *WorkspaceHandler) GetWorkspaceInvites(c *drift.Context) {
 	response := make([]dto.WorkspaceInviteResponse, len(invites))
 	for i, inv := range invites {
 		response[i] = dto.WorkspaceInviteResponse{
-			ID:          inv.ID,
-			WorkspaceID: inv.WorkspaceID,
-			Status:      inv.Status,
-			CreatedAt:   inv.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			ID:           inv.ID,
+			WorkspaceID:  inv.WorkspaceID,
+			Status:       inv.Status,
+			CreatedAt:    inv.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			InviteeEmail: inv.InviteeEmail,
 		}
 		if inv.Invitee != nil {
 			response[i].Invitee = &dto.UserResponse{
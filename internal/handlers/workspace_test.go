@@ -28,7 +28,7 @@ func setupWorkspaceTest(t *testing.T) (*testutil.MockWorkspaceService, *testutil
 	mockUserService := new(testutil.MockUserService)
 	mockEmailService := new(testutil.MockEmailService)
 	mockHub := new(testutil.MockHub)
-	handler := NewWorkspaceHandler(mockWorkspaceService, mockUserService, mockEmailService, mockHub, "http://localhost")
+	handler := NewWorkspaceHandler(mockWorkspaceService, mockUserService, mockEmailService, mockHub, "http://localhost", false)
 	jwtSvc := services.NewJWTService("test-secret-key", 15*time.Minute, 24*time.Hour)
 	return mockWorkspaceService, mockUserService, mockEmailService, mockHub, handler, jwtSvc
 }
@@ -249,6 +249,77 @@ func TestWorkspaceHandler_Update_Success(t *testing.T) {
 	mockHub.AssertExpectations(t)
 }
 
+func TestWorkspaceHandler_Update_RequireTwoFactor(t *testing.T) {
+	mockWorkspaceService, _, _, mockHub, handler, jwtSvc := setupWorkspaceTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	updatedWorkspace := &models.Workspace{
+		ID:               workspaceID,
+		Name:             "Secure",
+		OwnerID:          userID,
+		RequireTwoFactor: true,
+	}
+
+	mockWorkspaceService.On("CanModify", mock.Anything, workspaceID, userID).Return(true, nil)
+	mockWorkspaceService.On("SetRequireTwoFactor", mock.Anything, workspaceID, true).Return(updatedWorkspace, nil)
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Use(middleware.Auth(jwtSvc))
+	app.Patch("/workspaces/:workspaceId", handler.Update)
+
+	require2FA := true
+	jsonBody, _ := json.Marshal(dto.UpdateWorkspaceRequest{RequireTwoFactor: &require2FA})
+
+	token := generateTestToken(t, jwtSvc, userID, "test@example.com")
+	req := httptest.NewRequest(http.MethodPatch, "/workspaces/"+workspaceID.String(), bytes.NewReader(jsonBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var response dto.WorkspaceResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.True(t, response.RequireTwoFactor)
+
+	mockWorkspaceService.AssertExpectations(t)
+	mockWorkspaceService.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	mockHub.AssertNotCalled(t, "BroadcastWorkspaceUpdate", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWorkspaceHandler_Update_RequireTwoFactor_OwnerWithoutTwoFactor(t *testing.T) {
+	mockWorkspaceService, _, _, _, handler, jwtSvc := setupWorkspaceTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+
+	mockWorkspaceService.On("CanModify", mock.Anything, workspaceID, userID).Return(true, nil)
+	mockWorkspaceService.On("SetRequireTwoFactor", mock.Anything, workspaceID, true).Return(nil, services.ErrTwoFactorRequired)
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Use(middleware.Auth(jwtSvc))
+	app.Patch("/workspaces/:workspaceId", handler.Update)
+
+	require2FA := true
+	jsonBody, _ := json.Marshal(dto.UpdateWorkspaceRequest{RequireTwoFactor: &require2FA})
+
+	token := generateTestToken(t, jwtSvc, userID, "test@example.com")
+	req := httptest.NewRequest(http.MethodPatch, "/workspaces/"+workspaceID.String(), bytes.NewReader(jsonBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	mockWorkspaceService.AssertExpectations(t)
+}
+
 func TestWorkspaceHandler_Update_Forbidden(t *testing.T) {
 	mockWorkspaceService, _, _, _, handler, jwtSvc := setupWorkspaceTest(t)
 
@@ -280,6 +351,58 @@ func TestWorkspaceHandler_Update_Forbidden(t *testing.T) {
 	mockWorkspaceService.AssertExpectations(t)
 }
 
+func TestWorkspaceHandler_GetMembers_Success(t *testing.T) {
+	mockWorkspaceService, _, _, _, handler, jwtSvc := setupWorkspaceTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(true, nil)
+	mockWorkspaceService.On("GetMembers", mock.Anything, workspaceID).Return([]models.WorkspaceMember{
+		{UserID: userID, Role: models.RoleOwner, User: &models.User{ID: userID, Email: "test@example.com"}},
+	}, nil)
+
+	app := drift.New()
+	app.Use(middleware.Auth(jwtSvc))
+	app.Get("/workspaces/:workspaceId/members", handler.GetMembers)
+
+	req := httptest.NewRequest(http.MethodGet, "/workspaces/"+workspaceID.String()+"/members", nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "test@example.com"))
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var response []dto.WorkspaceMemberResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	require.Len(t, response, 1)
+	assert.Equal(t, "test@example.com", response[0].User.Email)
+	mockWorkspaceService.AssertExpectations(t)
+}
+
+func TestWorkspaceHandler_GetMembers_NoAccess(t *testing.T) {
+	mockWorkspaceService, _, _, _, handler, jwtSvc := setupWorkspaceTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+
+	// Members without the second factor a workspace requires can't list it
+	mockWorkspaceService.On("CanAccess", mock.Anything, workspaceID, userID).Return(false, nil)
+
+	app := drift.New()
+	app.Use(middleware.Auth(jwtSvc))
+	app.Get("/workspaces/:workspaceId/members", handler.GetMembers)
+
+	req := httptest.NewRequest(http.MethodGet, "/workspaces/"+workspaceID.String()+"/members", nil)
+	req.Header.Set("Authorization", "Bearer "+generateTestToken(t, jwtSvc, userID, "test@example.com"))
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockWorkspaceService.AssertNotCalled(t, "GetMembers", mock.Anything, mock.Anything)
+}
+
 func TestWorkspaceHandler_Delete_Success(t *testing.T) {
 	mockWorkspaceService, _, _, mockHub, handler, jwtSvc := setupWorkspaceTest(t)
 
@@ -393,3 +516,73 @@ func TestWorkspaceHandler_NotAuthenticated(t *testing.T) {
 	app.ServeHTTP(rec, req)
 	assert.Equal(t, http.StatusUnauthorized, rec.Code)
 }
+
+func TestWorkspaceHandler_InviteMember_ByEmail(t *testing.T) {
+	mockWorkspaceService, mockUserService, mockEmailService, _, handler, jwtSvc := setupWorkspaceTest(t)
+	handler.emailInvites = true
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	invite := &models.WorkspaceInvite{
+		ID:           uuid.New(),
+		WorkspaceID:  workspaceID,
+		InviterID:    userID,
+		InviteeEmail: "grace@example.com",
+		Status:       models.InviteStatusPending,
+		CreatedAt:    time.Now(),
+	}
+
+	mockWorkspaceService.On("IsOwner", mock.Anything, workspaceID, userID).Return(true, nil)
+	mockUserService.On("GetByEmail", mock.Anything, "Grace@Example.com").Return(nil, errors.New("not found"))
+	mockWorkspaceService.On("CreateEmailInvite", mock.Anything, workspaceID, userID, "grace@example.com").Return(invite, nil)
+	mockWorkspaceService.On("GetByID", mock.Anything, workspaceID).Return(&models.Workspace{ID: workspaceID, Name: "Team"}, nil)
+	mockUserService.On("GetByID", mock.Anything, userID).Return(&models.User{ID: userID, Name: "Ada"}, nil)
+	mockEmailService.On("SendWorkspaceEmailInvite", "grace@example.com", "Team", "Ada").Return(nil)
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Use(middleware.Auth(jwtSvc))
+	app.Post("/workspaces/:workspaceId/members", handler.InviteMember)
+
+	jsonBody, _ := json.Marshal(dto.InviteMemberRequest{Email: "Grace@Example.com"})
+	token := generateTestToken(t, jwtSvc, userID, "ada@example.com")
+	req := httptest.NewRequest(http.MethodPost, "/workspaces/"+workspaceID.String()+"/members", bytes.NewReader(jsonBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var response dto.WorkspaceInviteResponse
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &response))
+	assert.Equal(t, "grace@example.com", response.InviteeEmail)
+	mockWorkspaceService.AssertExpectations(t)
+	mockEmailService.AssertExpectations(t)
+}
+
+func TestWorkspaceHandler_InviteMember_UnknownEmailWithoutEmailInvites(t *testing.T) {
+	mockWorkspaceService, mockUserService, _, _, handler, jwtSvc := setupWorkspaceTest(t)
+
+	userID := uuid.New()
+	workspaceID := uuid.New()
+	mockWorkspaceService.On("IsOwner", mock.Anything, workspaceID, userID).Return(true, nil)
+	mockUserService.On("GetByEmail", mock.Anything, "grace@example.com").Return(nil, errors.New("not found"))
+
+	app := drift.New()
+	app.Use(driftmw.BodyParser())
+	app.Use(middleware.Auth(jwtSvc))
+	app.Post("/workspaces/:workspaceId/members", handler.InviteMember)
+
+	jsonBody, _ := json.Marshal(dto.InviteMemberRequest{Email: "grace@example.com"})
+	token := generateTestToken(t, jwtSvc, userID, "ada@example.com")
+	req := httptest.NewRequest(http.MethodPost, "/workspaces/"+workspaceID.String()+"/members", bytes.NewReader(jsonBody))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	app.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	mockWorkspaceService.AssertNotCalled(t, "CreateEmailInvite", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/google/uuid"
 )
 
@@ -58,18 +59,37 @@ type Event struct {
 	Data        any        `json:"data,omitempty"`
 }
 
+// CreatedBy and UpdatedBy hold the user who made the change, or uuid.Nil
+// when it was made with an API key. Actor identifies either.
 type CollectionCreatedData struct {
-	CollectionID uuid.UUID `json:"collection_id"`
-	Name         string    `json:"name"`
-	Version      int       `json:"version"`
-	CreatedBy    uuid.UUID `json:"created_by"`
+	CollectionID uuid.UUID    `json:"collection_id"`
+	Name         string       `json:"name"`
+	Version      int          `json:"version"`
+	CreatedBy    uuid.UUID    `json:"created_by"`
+	Actor        models.Actor `json:"actor"`
 }
 
 type CollectionUpdatedData struct {
+	CollectionID uuid.UUID    `json:"collection_id"`
+	Name         string       `json:"name"`
+	Version      int          `json:"version"`
+	UpdatedBy    uuid.UUID    `json:"updated_by"`
+	Actor        models.Actor `json:"actor"`
+}
+
+// CollectionsBatchData announces the collections written by one batch
+// upsert, so clients refresh once instead of per collection.
+type CollectionsBatchData struct {
+	Collections []CollectionBatchItem `json:"collections"`
+	UpdatedBy   uuid.UUID             `json:"updated_by"`
+	Actor       models.Actor          `json:"actor"`
+}
+
+type CollectionBatchItem struct {
 	CollectionID uuid.UUID `json:"collection_id"`
 	Name         string    `json:"name"`
 	Version      int       `json:"version"`
-	UpdatedBy    uuid.UUID `json:"updated_by"`
+	Created      bool      `json:"created"`
 }
 
 type CollectionDeletedData struct {
@@ -110,6 +130,11 @@ type Client struct {
 	Workspaces map[uuid.UUID]bool
 	Send       chan []byte
 	PublicKey  string // E2E encryption public key
+
+	// SessionID is the session of the access token the client connected
+	// with. Disconnect is closed when that session is revoked
+	SessionID  uuid.UUID
+	Disconnect chan struct{}
 }
 
 // ChatMessage represents an encrypted chat message stored in memory
@@ -262,6 +287,10 @@ type Hub struct {
 	tunnels         map[string]*TunnelInfo          // subdomain -> tunnel info
 	pendingRequests map[string]chan *TunnelResponse // requestID -> response channel
 	tunnelMu        sync.RWMutex
+
+	// Sessions
+	sessionClients map[uuid.UUID]map[string]*Client // sessionID -> clientID -> client
+	sessionMu      sync.Mutex
 }
 
 type WorkspaceMessage struct {
@@ -293,6 +322,7 @@ func NewHub() *Hub {
 		workspaceKeyHolders: make(map[uuid.UUID]map[uuid.UUID]bool),
 		tunnels:             make(map[string]*TunnelInfo),
 		pendingRequests:     make(map[string]chan *TunnelResponse),
+		sessionClients:      make(map[uuid.UUID]map[string]*Client),
 	}
 }
 
@@ -421,6 +451,12 @@ func (h *Hub) UnsubscribeFromWorkspace(clientID string, workspaceID uuid.UUID) {
 }
 
 func (h *Hub) BroadcastCollectionCreate(workspaceID, collectionID, createdBy uuid.UUID, name string, version int) {
+	h.BroadcastCollectionCreateAs(workspaceID, collectionID, models.UserActor(createdBy), name, version)
+}
+
+// BroadcastCollectionCreateAs announces a collection created by a user or an
+// API key.
+func (h *Hub) BroadcastCollectionCreateAs(workspaceID, collectionID uuid.UUID, actor models.Actor, name string, version int) {
 	h.broadcast <- &WorkspaceMessage{
 		WorkspaceID: workspaceID,
 		Event: Event{
@@ -430,13 +466,20 @@ func (h *Hub) BroadcastCollectionCreate(workspaceID, collectionID, createdBy uui
 				CollectionID: collectionID,
 				Name:         name,
 				Version:      version,
-				CreatedBy:    createdBy,
+				CreatedBy:    actorUserID(actor),
+				Actor:        actor,
 			},
 		},
 	}
 }
 
 func (h *Hub) BroadcastCollectionUpdate(workspaceID, collectionID, updatedBy uuid.UUID, name string, version int) {
+	h.BroadcastCollectionUpdateAs(workspaceID, collectionID, models.UserActor(updatedBy), name, version)
+}
+
+// BroadcastCollectionUpdateAs announces a collection updated by a user or an
+// API key.
+func (h *Hub) BroadcastCollectionUpdateAs(workspaceID, collectionID uuid.UUID, actor models.Actor, name string, version int) {
 	h.broadcast <- &WorkspaceMessage{
 		WorkspaceID: workspaceID,
 		Event: Event{
@@ -446,12 +489,36 @@ func (h *Hub) BroadcastCollectionUpdate(workspaceID, collectionID, updatedBy uui
 				CollectionID: collectionID,
 				Name:         name,
 				Version:      version,
-				UpdatedBy:    updatedBy,
+				UpdatedBy:    actorUserID(actor),
+				Actor:        actor,
+			},
+		},
+	}
+}
+
+func (h *Hub) BroadcastCollectionsBatch(workspaceID uuid.UUID, actor models.Actor, collections []CollectionBatchItem) {
+	h.broadcast <- &WorkspaceMessage{
+		WorkspaceID: workspaceID,
+		Event: Event{
+			Type:        "collections_batch_updated",
+			WorkspaceID: &workspaceID,
+			Data: CollectionsBatchData{
+				Collections: collections,
+				UpdatedBy:   actorUserID(actor),
+				Actor:       actor,
 			},
 		},
 	}
 }
 
+// actorUserID returns the user behind actor, or uuid.Nil for API keys.
+func actorUserID(actor models.Actor) uuid.UUID {
+	if actor.Type == models.ActorTypeUser {
+		return actor.ID
+	}
+	return uuid.Nil
+}
+
 func (h *Hub) BroadcastCollectionDelete(workspaceID, collectionID, deletedBy uuid.UUID) {
 	h.broadcast <- &WorkspaceMessage{
 		WorkspaceID: workspaceID,
@@ -923,3 +990,44 @@ func (h *Hub) HandleTunnelResponse(resp *TunnelResponse) {
 		}
 	}
 }
+
+// TrackSession records a connection so it is closed when its session is
+// revoked. Connections call UntrackSession when they end.
+func (h *Hub) TrackSession(client *Client) {
+	if client.SessionID == uuid.Nil || client.Disconnect == nil {
+		return
+	}
+
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+	if h.sessionClients[client.SessionID] == nil {
+		h.sessionClients[client.SessionID] = make(map[string]*Client)
+	}
+	h.sessionClients[client.SessionID][client.ID] = client
+}
+
+// UntrackSession forgets a connection recorded by TrackSession
+func (h *Hub) UntrackSession(client *Client) {
+	h.sessionMu.Lock()
+	defer h.sessionMu.Unlock()
+	if clients, ok := h.sessionClients[client.SessionID]; ok {
+		delete(clients, client.ID)
+		if len(clients) == 0 {
+			delete(h.sessionClients, client.SessionID)
+		}
+	}
+}
+
+// DisconnectSession closes all connections of a revoked session and returns
+// how many there were.
+func (h *Hub) DisconnectSession(sessionID uuid.UUID) int {
+	h.sessionMu.Lock()
+	clients := h.sessionClients[sessionID]
+	delete(h.sessionClients, sessionID)
+	h.sessionMu.Unlock()
+
+	for _, client := range clients {
+		close(client.Disconnect)
+	}
+	return len(clients)
+}
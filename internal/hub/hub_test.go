@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -190,6 +191,46 @@ func TestHub_BroadcastCollectionUpdate_ToSubscribedClient(t *testing.T) {
 	}
 }
 
+func TestHub_BroadcastCollectionUpdateAs_APIKeyActor(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+
+	workspaceID := uuid.New()
+	collectionID := uuid.New()
+	actor := models.Actor{Type: models.ActorTypeAPIKey, ID: uuid.New(), Name: "CI"}
+
+	client := &Client{
+		ID:         "client-1",
+		UserID:     uuid.New(),
+		UserName:   "Test User",
+		Workspaces: map[uuid.UUID]bool{workspaceID: true},
+		Send:       make(chan []byte, 256),
+	}
+
+	hub.Register(client)
+	time.Sleep(10 * time.Millisecond)
+
+	hub.BroadcastCollectionUpdateAs(workspaceID, collectionID, actor, "My Collection", 3)
+
+	select {
+	case msg := <-client.Send:
+		var event Event
+		err := json.Unmarshal(msg, &event)
+		require.NoError(t, err)
+
+		dataBytes, _ := json.Marshal(event.Data)
+		var updateData CollectionUpdatedData
+		err = json.Unmarshal(dataBytes, &updateData)
+		require.NoError(t, err)
+
+		assert.Equal(t, uuid.Nil, updateData.UpdatedBy)
+		assert.Equal(t, actor, updateData.Actor)
+
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("did not receive message")
+	}
+}
+
 func TestHub_BroadcastCollectionUpdate_NotToUnsubscribedClient(t *testing.T) {
 	hub := NewHub()
 	go hub.Run()
@@ -813,3 +854,53 @@ func TestHub_RegisterTunnel_StillPushesTunnelRequestType(t *testing.T) {
 		t.Fatal("expected a tunnel_request to be pushed to the client")
 	}
 }
+
+func TestHub_DisconnectSession(t *testing.T) {
+	hub := NewHub()
+	sessionID := uuid.New()
+
+	desktop := &Client{ID: "desktop", SessionID: sessionID, Disconnect: make(chan struct{})}
+	tunnel := &Client{ID: "tunnel", SessionID: sessionID, Disconnect: make(chan struct{})}
+	other := &Client{ID: "other", SessionID: uuid.New(), Disconnect: make(chan struct{})}
+	hub.TrackSession(desktop)
+	hub.TrackSession(tunnel)
+	hub.TrackSession(other)
+
+	assert.Equal(t, 2, hub.DisconnectSession(sessionID))
+
+	for _, client := range []*Client{desktop, tunnel} {
+		select {
+		case <-client.Disconnect:
+		default:
+			t.Fatalf("expected %s to be disconnected", client.ID)
+		}
+	}
+	select {
+	case <-other.Disconnect:
+		t.Fatal("other session should stay connected")
+	default:
+	}
+
+	// Revoking again finds nothing left to close
+	assert.Equal(t, 0, hub.DisconnectSession(sessionID))
+}
+
+func TestHub_UntrackSession(t *testing.T) {
+	hub := NewHub()
+	sessionID := uuid.New()
+
+	client := &Client{ID: "client-1", SessionID: sessionID, Disconnect: make(chan struct{})}
+	hub.TrackSession(client)
+	hub.UntrackSession(client)
+
+	assert.Equal(t, 0, hub.DisconnectSession(sessionID))
+	assert.Empty(t, hub.sessionClients)
+}
+
+func TestHub_TrackSession_IgnoresClientsWithoutSession(t *testing.T) {
+	hub := NewHub()
+
+	hub.TrackSession(&Client{ID: "legacy", Disconnect: make(chan struct{})})
+
+	assert.Empty(t, hub.sessionClients)
+}
@@ -2,23 +2,60 @@ package middleware
 
 import (
 	"context"
+	"math"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
 	"github.com/google/uuid"
 	"github.com/m1z23r/drift/pkg/drift"
 )
 
 const (
-	APIKeyWorkspaceIDKey = "api_key_workspace_id"
+	APIKeyKey = "api_key"
 )
 
 // APIKeyServiceInterface defines the methods needed by the API key middleware
 type APIKeyServiceInterface interface {
-	ValidateAndGetWorkspace(ctx context.Context, key string) (uuid.UUID, error)
+	Authenticate(ctx context.Context, key string) (*models.WorkspaceAPIKey, error)
+	Allow(key *models.WorkspaceAPIKey) (bool, time.Duration)
+	LogUsage(usage models.APIKeyUsage)
 }
 
-// APIKeyAuth creates middleware that authenticates requests using API keys
-func APIKeyAuth(apiKeyService APIKeyServiceInterface) drift.HandlerFunc {
+// APIKeyCreatorLookup loads the user who created an API key
+type APIKeyCreatorLookup interface {
+	GetByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+}
+
+// APIKeyCreatorSuperAdmin runs after APIKeyAuth on routes that need super
+// admin rights. A key only carries them while the user who created it is
+// still a super admin.
+func APIKeyCreatorSuperAdmin(users APIKeyCreatorLookup) drift.HandlerFunc {
+	return func(c *drift.Context) {
+		apiKey := GetAPIKey(c)
+		if apiKey == nil {
+			c.Unauthorized("not authenticated")
+			return
+		}
+
+		creator, err := users.GetByID(context.Background(), apiKey.CreatedBy)
+		if err != nil || creator.GlobalRole != models.GlobalRoleSuperAdmin {
+			c.Forbidden("api key creator is not a super admin")
+			return
+		}
+		c.Next()
+	}
+}
+
+// APIKeyAuth creates middleware that authenticates requests using API keys.
+// The key must hold every scope in requiredScopes, be used from an allowed
+// address and, on routes with a :collectionId parameter, be allowed to access
+// that collection. Every authenticated request is logged to the key's usage
+// log, and requests over the key's rate limit are rejected with 429.
+func APIKeyAuth(apiKeyService APIKeyServiceInterface, requiredScopes ...string) drift.HandlerFunc {
 	return func(c *drift.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -40,23 +77,83 @@ func APIKeyAuth(apiKeyService APIKeyServiceInterface) drift.HandlerFunc {
 			return
 		}
 
-		workspaceID, err := apiKeyService.ValidateAndGetWorkspace(context.Background(), token)
+		apiKey, err := apiKeyService.Authenticate(context.Background(), token)
 		if err != nil {
 			c.Unauthorized("invalid or expired api key")
 			return
 		}
 
-		c.Set(APIKeyWorkspaceIDKey, workspaceID)
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: c.Response, status: http.StatusOK}
+		c.Response = recorder
+		defer func() {
+			apiKeyService.LogUsage(models.APIKeyUsage{
+				APIKeyID:  apiKey.ID,
+				Method:    c.Request.Method,
+				Path:      c.Request.URL.Path,
+				Status:    recorder.status,
+				IP:        ClientAddr(c),
+				LatencyMs: int(time.Since(start).Milliseconds()),
+			})
+		}()
+
+		if ok, retryAfter := apiKeyService.Allow(apiKey); !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.TooManyRequests("rate limit exceeded")
+			return
+		}
+
+		if len(apiKey.AllowedCIDRs) > 0 {
+			addr, ok := requestAddr(c)
+			if !ok || !services.APIKeyAllowsIP(apiKey, addr) {
+				c.Forbidden("api key cannot be used from this address")
+				return
+			}
+		}
+
+		for _, scope := range requiredScopes {
+			if !services.APIKeyHasScope(apiKey, scope) {
+				c.Forbidden("api key is missing the " + scope + " scope")
+				return
+			}
+		}
+
+		if param := c.Param("collectionId"); param != "" {
+			if collectionID, err := uuid.Parse(param); err == nil && !services.APIKeyAllowsCollection(apiKey, collectionID) {
+				c.NotFound("collection not found")
+				return
+			}
+		}
+
+		c.Set(APIKeyKey, apiKey)
 		c.Next()
 	}
 }
 
-// GetAPIKeyWorkspaceID retrieves the workspace ID from context (set by API key auth)
-func GetAPIKeyWorkspaceID(c *drift.Context) uuid.UUID {
-	if id, ok := c.Get(APIKeyWorkspaceIDKey); ok {
-		if uid, ok := id.(uuid.UUID); ok {
-			return uid
+// statusRecorder captures the response status for the usage log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Flush keeps streamed exports working through the recorder.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// GetAPIKey retrieves the API key from context (set by API key auth)
+func GetAPIKey(c *drift.Context) *models.WorkspaceAPIKey {
+	if key, ok := c.Get(APIKeyKey); ok {
+		if apiKey, ok := key.(*models.WorkspaceAPIKey); ok {
+			return apiKey
 		}
 	}
-	return uuid.Nil
+	return nil
 }
@@ -0,0 +1,230 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeAPIKeyService struct {
+	keys    map[string]*models.WorkspaceAPIKey
+	limiter *services.TokenBucketLimiter
+	usage   chan models.APIKeyUsage
+}
+
+func (f *fakeAPIKeyService) Authenticate(ctx context.Context, key string) (*models.WorkspaceAPIKey, error) {
+	if apiKey, ok := f.keys[key]; ok {
+		return apiKey, nil
+	}
+	return nil, services.ErrAPIKeyInvalid
+}
+
+func (f *fakeAPIKeyService) Allow(key *models.WorkspaceAPIKey) (bool, time.Duration) {
+	return f.limiter.Allow(key.ID, key.RateLimitPerMinute, key.RateLimitBurst)
+}
+
+func (f *fakeAPIKeyService) LogUsage(usage models.APIKeyUsage) {
+	f.usage <- usage
+}
+
+func newFakeAPIKeyService(apiKey *models.WorkspaceAPIKey) *fakeAPIKeyService {
+	return &fakeAPIKeyService{
+		keys:    map[string]*models.WorkspaceAPIKey{"nik_test_key": apiKey},
+		limiter: services.NewTokenBucketLimiter(),
+		usage:   make(chan models.APIKeyUsage, 100),
+	}
+}
+
+// testProxy is the address httptest requests come from
+var testProxy = netip.MustParsePrefix("192.0.2.1/32")
+
+func setupAPIKeyAuthTest(apiKey *models.WorkspaceAPIKey, trustedProxies ...netip.Prefix) *drift.Engine {
+	svc := newFakeAPIKeyService(apiKey)
+	app := drift.New()
+	app.Use(RealIP(trustedProxies))
+
+	ok := func(c *drift.Context) {
+		_ = c.JSON(http.StatusOK, map[string]string{"workspace_id": GetAPIKey(c).WorkspaceID.String()})
+	}
+
+	read := app.Group("/automation")
+	read.Use(APIKeyAuth(svc, models.APIKeyScopeCollectionsRead))
+	read.Get("/collections", ok)
+	read.Get("/collections/:collectionId", ok)
+
+	vault := app.Group("/automation")
+	vault.Use(APIKeyAuth(svc, models.APIKeyScopeVaultReadCiphertext))
+	vault.Get("/vault", ok)
+
+	return app
+}
+
+func serveAPIKeyRequest(app *drift.Engine, path, token, forwardedFor string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIKeyAuth_InvalidKey(t *testing.T) {
+	app := setupAPIKeyAuthTest(&models.WorkspaceAPIKey{WorkspaceID: uuid.New(), Scopes: models.DefaultAPIKeyScopes})
+
+	rec := serveAPIKeyRequest(app, "/automation/collections", "nik_unknown", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	rec = serveAPIKeyRequest(app, "/automation/collections", "not-an-api-key", "")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Contains(t, rec.Body.String(), "invalid api key format")
+}
+
+func TestAPIKeyAuth_Scopes(t *testing.T) {
+	workspaceID := uuid.New()
+	app := setupAPIKeyAuthTest(&models.WorkspaceAPIKey{WorkspaceID: workspaceID, Scopes: []string{models.APIKeyScopeCollectionsRead}})
+
+	rec := serveAPIKeyRequest(app, "/automation/collections", "nik_test_key", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), workspaceID.String())
+
+	rec = serveAPIKeyRequest(app, "/automation/vault", "nik_test_key", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "vault:read-ciphertext")
+}
+
+func TestAPIKeyAuth_CollectionRestriction(t *testing.T) {
+	allowedID := uuid.New()
+	app := setupAPIKeyAuthTest(&models.WorkspaceAPIKey{
+		WorkspaceID:   uuid.New(),
+		Scopes:        models.DefaultAPIKeyScopes,
+		CollectionIDs: []uuid.UUID{allowedID},
+	})
+
+	rec := serveAPIKeyRequest(app, "/automation/collections/"+allowedID.String(), "nik_test_key", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serveAPIKeyRequest(app, "/automation/collections/"+uuid.New().String(), "nik_test_key", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAPIKeyAuth_AllowedCIDRs(t *testing.T) {
+	apiKey := &models.WorkspaceAPIKey{
+		WorkspaceID:  uuid.New(),
+		Scopes:       models.DefaultAPIKeyScopes,
+		AllowedCIDRs: []string{"203.0.113.0/24"},
+	}
+	app := setupAPIKeyAuthTest(apiKey, testProxy)
+
+	rec := serveAPIKeyRequest(app, "/automation/collections", "nik_test_key", "203.0.113.9")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Only the hop added by the trusted proxy counts
+	rec = serveAPIKeyRequest(app, "/automation/collections", "nik_test_key", "198.51.100.1, 203.0.113.9")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serveAPIKeyRequest(app, "/automation/collections", "nik_test_key", "203.0.113.9, 198.51.100.1")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = serveAPIKeyRequest(app, "/automation/collections", "nik_test_key", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	// Without a trusted proxy the header is ignored
+	app = setupAPIKeyAuthTest(apiKey)
+	rec = serveAPIKeyRequest(app, "/automation/collections", "nik_test_key", "203.0.113.9")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestAPIKeyAuth_RateLimit(t *testing.T) {
+	apiKey := &models.WorkspaceAPIKey{
+		ID:                 uuid.New(),
+		WorkspaceID:        uuid.New(),
+		Scopes:             models.DefaultAPIKeyScopes,
+		RateLimitPerMinute: 60,
+		RateLimitBurst:     2,
+	}
+	svc := newFakeAPIKeyService(apiKey)
+	app := drift.New()
+	app.Use(RealIP([]netip.Prefix{testProxy}))
+	group := app.Group("/automation")
+	group.Use(APIKeyAuth(svc, models.APIKeyScopeCollectionsRead))
+	group.Get("/collections", func(c *drift.Context) {
+		_ = c.JSON(http.StatusOK, map[string]string{})
+	})
+
+	for range 2 {
+		rec := serveAPIKeyRequest(app, "/automation/collections", "nik_test_key", "203.0.113.7")
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	rec := serveAPIKeyRequest(app, "/automation/collections", "nik_test_key", "203.0.113.7")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	statuses := make([]int, 0, 3)
+	for range 3 {
+		select {
+		case usage := <-svc.usage:
+			assert.Equal(t, apiKey.ID, usage.APIKeyID)
+			assert.Equal(t, http.MethodGet, usage.Method)
+			assert.Equal(t, "/automation/collections", usage.Path)
+			assert.Equal(t, "203.0.113.7", usage.IP)
+			statuses = append(statuses, usage.Status)
+		case <-time.After(time.Second):
+			t.Fatal("usage was not recorded")
+		}
+	}
+	assert.ElementsMatch(t, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}, statuses)
+}
+
+type fakeCreatorLookup map[uuid.UUID]*models.User
+
+func (f fakeCreatorLookup) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if user, ok := f[id]; ok {
+		return user, nil
+	}
+	return nil, errors.New("user not found")
+}
+
+func TestAPIKeyCreatorSuperAdmin(t *testing.T) {
+	creatorID := uuid.New()
+	apiKey := &models.WorkspaceAPIKey{
+		ID:          uuid.New(),
+		WorkspaceID: uuid.New(),
+		CreatedBy:   creatorID,
+		Scopes:      []string{models.APIKeyScopeTemplatesPublish},
+	}
+	creator := &models.User{ID: creatorID, GlobalRole: models.GlobalRoleSuperAdmin}
+
+	svc := newFakeAPIKeyService(apiKey)
+	app := drift.New()
+	group := app.Group("/automation")
+	group.Use(APIKeyAuth(svc, models.APIKeyScopeTemplatesPublish))
+	group.Use(APIKeyCreatorSuperAdmin(fakeCreatorLookup{creatorID: creator}))
+	group.Get("/templates", func(c *drift.Context) {
+		_ = c.JSON(http.StatusOK, map[string]string{})
+	})
+
+	rec := serveAPIKeyRequest(app, "/automation/templates", "nik_test_key", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Demoting the creator takes the right away from keys they made
+	creator.GlobalRole = models.GlobalRoleUser
+	rec = serveAPIKeyRequest(app, "/automation/templates", "nik_test_key", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	apiKey.CreatedBy = uuid.New()
+	rec = serveAPIKeyRequest(app, "/automation/templates", "nik_test_key", "")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
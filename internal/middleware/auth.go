@@ -1,6 +1,8 @@
 package middleware
 
 import (
+	"context"
+	"net/http"
 	"strings"
 
 	"github.com/dimitrije/nikode-api/internal/models"
@@ -13,9 +15,26 @@ const (
 	UserIDKey         = "user_id"
 	UserEmailKey      = "user_email"
 	UserGlobalRoleKey = "user_global_role"
+	SessionIDKey      = "session_id"
+	// PersonalAccessTokenKey is set when the request authenticated with a
+	// personal access token instead of a JWT
+	PersonalAccessTokenKey = "personal_access_token"
 )
 
+// PersonalAccessTokenAuthenticator defines the methods needed to accept
+// personal access tokens
+type PersonalAccessTokenAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*models.PersonalAccessToken, *models.User, error)
+}
+
 func Auth(jwtService *services.JWTService) drift.HandlerFunc {
+	return AuthWithPersonalAccessTokens(jwtService, nil)
+}
+
+// AuthWithPersonalAccessTokens is Auth that also accepts personal access
+// tokens. A token needs the read scope for GET and HEAD requests and the
+// write scope for anything else.
+func AuthWithPersonalAccessTokens(jwtService *services.JWTService, tokenService PersonalAccessTokenAuthenticator) drift.HandlerFunc {
 	return func(c *drift.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -29,6 +48,31 @@ func Auth(jwtService *services.JWTService) drift.HandlerFunc {
 			return
 		}
 
+		if tokenService != nil && services.IsPersonalAccessToken(parts[1]) {
+			token, user, err := tokenService.Authenticate(context.Background(), parts[1])
+			if err != nil {
+				c.Unauthorized("invalid or expired token")
+				return
+			}
+
+			scope := models.PersonalAccessTokenScopeWrite
+			if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+				scope = models.PersonalAccessTokenScopeRead
+			}
+			if !services.PersonalAccessTokenHasScope(token, scope) {
+				c.Forbidden("personal access token lacks required scope: " + scope)
+				return
+			}
+
+			c.Set(UserIDKey, user.ID)
+			c.Set(UserEmailKey, user.Email)
+			c.Set(UserGlobalRoleKey, user.GlobalRole)
+			c.Set(PersonalAccessTokenKey, token)
+
+			c.Next()
+			return
+		}
+
 		claims, err := jwtService.ValidateAccessToken(parts[1])
 		if err != nil {
 			c.Unauthorized("invalid or expired token")
@@ -38,7 +82,21 @@ func Auth(jwtService *services.JWTService) drift.HandlerFunc {
 		c.Set(UserIDKey, claims.UserID)
 		c.Set(UserEmailKey, claims.Email)
 		c.Set(UserGlobalRoleKey, claims.GlobalRole)
+		c.Set(SessionIDKey, claims.SessionID)
+
+		c.Next()
+	}
+}
 
+// RequireSession rejects personal access tokens, for routes that manage the
+// account itself such as sessions, identities and the tokens themselves, and
+// for workspace administration such as API keys and two-factor enforcement.
+func RequireSession() drift.HandlerFunc {
+	return func(c *drift.Context) {
+		if _, ok := c.Get(PersonalAccessTokenKey); ok {
+			c.Forbidden("personal access tokens cannot be used here")
+			return
+		}
 		c.Next()
 	}
 }
@@ -80,3 +138,12 @@ func GetUserGlobalRole(c *drift.Context) string {
 	}
 	return ""
 }
+
+func GetSessionID(c *drift.Context) uuid.UUID {
+	if id, ok := c.Get(SessionIDKey); ok {
+		if sid, ok := id.(uuid.UUID); ok {
+			return sid
+		}
+	}
+	return uuid.Nil
+}
@@ -19,7 +19,7 @@ func newTestJWTService() *services.JWTService {
 
 func generateTestToken(t *testing.T, jwtSvc *services.JWTService, userID uuid.UUID, email string) string {
 	t.Helper()
-	pair, err := jwtSvc.GenerateTokenPair(userID, email, "user")
+	pair, err := jwtSvc.GenerateTokenPair(userID, uuid.Nil, email, "user")
 	require.NoError(t, err)
 	return pair.AccessToken
 }
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/m1z23r/drift/pkg/drift"
+)
+
+const (
+	ClientAddrKey = "client_addr"
+)
+
+// RealIP resolves the client address once per request. X-Forwarded-For is
+// only honoured when the connection comes from one of trustedProxies, and
+// then the client is the right-most hop that isn't a trusted proxy, since
+// every hop to the left of it can be written by the client.
+func RealIP(trustedProxies []netip.Prefix) drift.HandlerFunc {
+	return func(c *drift.Context) {
+		if addr, ok := resolveClientAddr(c.Request, trustedProxies); ok {
+			c.Set(ClientAddrKey, addr)
+		}
+		c.Next()
+	}
+}
+
+func resolveClientAddr(r *http.Request, trustedProxies []netip.Prefix) (netip.Addr, bool) {
+	addr, ok := parseAddr(r.RemoteAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0 && isTrustedProxy(addr, trustedProxies); i-- {
+		hop, ok := parseAddr(hops[i])
+		if !ok {
+			break
+		}
+		addr = hop
+	}
+	return addr, true
+}
+
+func isTrustedProxy(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr parses an address with or without a port.
+func parseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// requestAddr returns the client address resolved by RealIP, or the
+// connection's address when RealIP didn't run.
+func requestAddr(c *drift.Context) (netip.Addr, bool) {
+	if value, ok := c.Get(ClientAddrKey); ok {
+		if addr, ok := value.(netip.Addr); ok {
+			return addr, true
+		}
+	}
+	return parseAddr(c.Request.RemoteAddr)
+}
+
+// ClientAddr returns the client address as text, or "" when it can't be
+// parsed.
+func ClientAddr(c *drift.Context) string {
+	addr, ok := requestAddr(c)
+	if !ok {
+		return ""
+	}
+	return addr.String()
+}
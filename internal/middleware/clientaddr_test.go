@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveClientAddr(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		want         string
+	}{
+		{"no proxy", "203.0.113.9:1234", nil, "203.0.113.9"},
+		{"untrusted proxy", "203.0.113.9:1234", []string{"198.51.100.1"}, "203.0.113.9"},
+		{"trusted proxy", "192.0.2.1:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hops", "192.0.2.1:1234", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"proxy chain", "192.0.2.1:1234", []string{"198.51.100.1, 10.0.0.5"}, "198.51.100.1"},
+		{"repeated headers", "192.0.2.1:1234", []string{"198.51.100.1", "10.0.0.5"}, "198.51.100.1"},
+		{"malformed hop", "192.0.2.1:1234", []string{"bogus"}, "192.0.2.1"},
+		{"mapped v4", "[::ffff:203.0.113.9]:1234", nil, "203.0.113.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, header := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", header)
+			}
+
+			addr, ok := resolveClientAddr(req, trusted)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, addr.String())
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/google/uuid"
+	"github.com/m1z23r/drift/pkg/drift"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakePersonalAccessTokenService struct {
+	tokens map[string]*models.PersonalAccessToken
+	user   *models.User
+}
+
+func (f *fakePersonalAccessTokenService) Authenticate(ctx context.Context, token string) (*models.PersonalAccessToken, *models.User, error) {
+	if t, ok := f.tokens[token]; ok {
+		return t, f.user, nil
+	}
+	return nil, nil, services.ErrPersonalAccessTokenInvalid
+}
+
+func setupPersonalAccessTokenAuthTest(t *testing.T) (*drift.Engine, *services.JWTService, uuid.UUID) {
+	t.Helper()
+	userID := uuid.New()
+	svc := &fakePersonalAccessTokenService{
+		tokens: map[string]*models.PersonalAccessToken{
+			"nikp_read":  {ID: uuid.New(), UserID: userID, Scopes: []string{models.PersonalAccessTokenScopeRead}},
+			"nikp_write": {ID: uuid.New(), UserID: userID, Scopes: []string{models.PersonalAccessTokenScopeRead, models.PersonalAccessTokenScopeWrite}},
+		},
+		user: &models.User{ID: userID, Email: "test@example.com", GlobalRole: models.GlobalRoleUser},
+	}
+	jwtSvc := newTestJWTService()
+
+	ok := func(c *drift.Context) {
+		_ = c.JSON(http.StatusOK, map[string]string{"user_id": GetUserID(c).String(), "email": GetUserEmail(c)})
+	}
+
+	app := drift.New()
+	protected := app.Group("")
+	protected.Use(AuthWithPersonalAccessTokens(jwtSvc, svc))
+	protected.Get("/workspaces", ok)
+	protected.Post("/workspaces", ok)
+
+	account := protected.Group("")
+	account.Use(RequireSession())
+	account.Get("/users/me/tokens", ok)
+
+	return app, jwtSvc, userID
+}
+
+func servePersonalAccessTokenRequest(app *drift.Engine, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthWithPersonalAccessTokens_Scopes(t *testing.T) {
+	app, _, userID := setupPersonalAccessTokenAuthTest(t)
+
+	rec := servePersonalAccessTokenRequest(app, http.MethodGet, "/workspaces", "nikp_read")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), userID.String())
+	assert.Contains(t, rec.Body.String(), "test@example.com")
+
+	rec = servePersonalAccessTokenRequest(app, http.MethodPost, "/workspaces", "nikp_read")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "write")
+
+	rec = servePersonalAccessTokenRequest(app, http.MethodPost, "/workspaces", "nikp_write")
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestAuthWithPersonalAccessTokens_InvalidToken(t *testing.T) {
+	app, _, _ := setupPersonalAccessTokenAuthTest(t)
+
+	rec := servePersonalAccessTokenRequest(app, http.MethodGet, "/workspaces", "nikp_unknown")
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAuthWithPersonalAccessTokens_AcceptsJWT(t *testing.T) {
+	app, jwtSvc, _ := setupPersonalAccessTokenAuthTest(t)
+	userID := uuid.New()
+
+	rec := servePersonalAccessTokenRequest(app, http.MethodGet, "/users/me/tokens", generateTestToken(t, jwtSvc, userID, "jwt@example.com"))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), userID.String())
+}
+
+func TestRequireSession_RejectsPersonalAccessToken(t *testing.T) {
+	app, _, _ := setupPersonalAccessTokenAuthTest(t)
+
+	rec := servePersonalAccessTokenRequest(app, http.MethodGet, "/users/me/tokens", "nikp_write")
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "personal access tokens cannot be used here")
+}
+
+func TestAuth_IgnoresPersonalAccessTokens(t *testing.T) {
+	app := drift.New()
+	app.Use(Auth(newTestJWTService()))
+	app.Get("/protected", func(c *drift.Context) {
+		_ = c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	rec := servePersonalAccessTokenRequest(app, http.MethodGet, "/protected", "nikp_read")
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
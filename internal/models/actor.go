@@ -0,0 +1,25 @@
+package models
+
+import "github.com/google/uuid"
+
+const (
+	ActorTypeUser   = "user"
+	ActorTypeAPIKey = "api_key"
+)
+
+// Actor identifies who made a change: a user, or a workspace API key used by
+// automation.
+type Actor struct {
+	Type string    `json:"type"`
+	ID   uuid.UUID `json:"id"`
+	// Name is the API key's name; users are looked up by ID
+	Name string `json:"name,omitempty"`
+}
+
+func UserActor(userID uuid.UUID) Actor {
+	return Actor{Type: ActorTypeUser, ID: userID}
+}
+
+func APIKeyActor(key *WorkspaceAPIKey) Actor {
+	return Actor{Type: ActorTypeAPIKey, ID: key.ID, Name: key.Name}
+}
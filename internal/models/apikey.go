@@ -17,4 +17,51 @@ type WorkspaceAPIKey struct {
 	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
 	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
+	// Scopes lists the permissions granted to the key
+	Scopes []string `json:"scopes"`
+	// CollectionIDs restricts the key to these collections; empty allows all
+	// collections in the workspace
+	CollectionIDs []uuid.UUID `json:"collection_ids,omitempty"`
+	// AllowedCIDRs restricts the addresses the key can be used from; empty
+	// allows any address
+	AllowedCIDRs []string `json:"allowed_cidrs,omitempty"`
+	// ReplacedBy is the key issued when this key was rotated
+	ReplacedBy *uuid.UUID `json:"replaced_by,omitempty"`
+	// RateLimitPerMinute and RateLimitBurst configure the key's token bucket
+	RateLimitPerMinute int `json:"rate_limit_per_minute"`
+	RateLimitBurst     int `json:"rate_limit_burst"`
+}
+
+// APIKeyUsage is one request made with an API key.
+type APIKeyUsage struct {
+	ID        int64     `json:"id"`
+	APIKeyID  uuid.UUID `json:"api_key_id"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Status    int       `json:"status"`
+	IP        string    `json:"ip"`
+	LatencyMs int       `json:"latency_ms"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const (
+	APIKeyScopeCollectionsRead     = "collections:read"
+	APIKeyScopeCollectionsWrite    = "collections:write"
+	APIKeyScopeVaultReadCiphertext = "vault:read-ciphertext"
+	APIKeyScopeTemplatesPublish    = "templates:publish"
+)
+
+// APIKeyScopes are the scopes an API key can be granted.
+var APIKeyScopes = []string{
+	APIKeyScopeCollectionsRead,
+	APIKeyScopeCollectionsWrite,
+	APIKeyScopeVaultReadCiphertext,
+	APIKeyScopeTemplatesPublish,
+}
+
+// DefaultAPIKeyScopes are granted when a key is created without scopes,
+// matching what keys could do before scopes existed.
+var DefaultAPIKeyScopes = []string{
+	APIKeyScopeCollectionsRead,
+	APIKeyScopeCollectionsWrite,
 }
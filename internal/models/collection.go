@@ -16,4 +16,24 @@ type Collection struct {
 	UpdatedBy   *uuid.UUID      `json:"updated_by,omitempty"`
 	CreatedAt   time.Time       `json:"created_at"`
 	UpdatedAt   time.Time       `json:"updated_at"`
+	// UpdatedByAPIKey is set instead of UpdatedBy when automation made the
+	// last change, with the key's name at the time
+	UpdatedByAPIKey     *uuid.UUID `json:"updated_by_api_key,omitempty"`
+	UpdatedByAPIKeyName *string    `json:"updated_by_api_key_name,omitempty"`
+}
+
+// UpdatedByActor returns who made the last change, or nil when unknown.
+func (c *Collection) UpdatedByActor() *Actor {
+	if c.UpdatedByAPIKey != nil {
+		actor := Actor{Type: ActorTypeAPIKey, ID: *c.UpdatedByAPIKey}
+		if c.UpdatedByAPIKeyName != nil {
+			actor.Name = *c.UpdatedByAPIKeyName
+		}
+		return &actor
+	}
+	if c.UpdatedBy != nil {
+		actor := UserActor(*c.UpdatedBy)
+		return &actor
+	}
+	return nil
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PersonalAccessToken lets scripts call the API as a user. Unlike workspace
+// API keys it reaches every workspace the user belongs to.
+type PersonalAccessToken struct {
+	ID          uuid.UUID  `json:"id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Name        string     `json:"name"`
+	TokenHash   string     `json:"-"`
+	TokenPrefix string     `json:"token_prefix"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+const (
+	// PersonalAccessTokenScopeRead allows GET requests
+	PersonalAccessTokenScopeRead = "read"
+	// PersonalAccessTokenScopeWrite allows requests that change data
+	PersonalAccessTokenScopeWrite = "write"
+)
+
+// PersonalAccessTokenScopes are the scopes a personal access token can be
+// granted.
+var PersonalAccessTokenScopes = []string{
+	PersonalAccessTokenScopeRead,
+	PersonalAccessTokenScopeWrite,
+}
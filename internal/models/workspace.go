@@ -12,6 +12,8 @@ type Workspace struct {
 	OwnerID   uuid.UUID `json:"owner_id"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// RequireTwoFactor keeps members without two-factor authentication out
+	RequireTwoFactor bool `json:"require_2fa"`
 }
 
 type WorkspaceMember struct {
@@ -24,16 +26,19 @@ type WorkspaceMember struct {
 }
 
 type WorkspaceInvite struct {
-	ID          uuid.UUID  `json:"id"`
-	WorkspaceID uuid.UUID  `json:"workspace_id"`
-	InviterID   uuid.UUID  `json:"inviter_id"`
-	InviteeID   uuid.UUID  `json:"invitee_id"`
-	Status      string     `json:"status"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
-	Workspace   *Workspace `json:"workspace,omitempty"`
-	Inviter     *User      `json:"inviter,omitempty"`
-	Invitee     *User      `json:"invitee,omitempty"`
+	ID          uuid.UUID `json:"id"`
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	InviterID   uuid.UUID `json:"inviter_id"`
+	InviteeID   uuid.UUID `json:"invitee_id"`
+	// InviteeEmail is set instead of InviteeID for people who have no
+	// account yet; the invite is theirs once they sign in with the email
+	InviteeEmail string     `json:"invitee_email,omitempty"`
+	Status       string     `json:"status"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+	Workspace    *Workspace `json:"workspace,omitempty"`
+	Inviter      *User      `json:"inviter,omitempty"`
+	Invitee      *User      `json:"invitee,omitempty"`
 }
 
 const (
@@ -5,30 +5,57 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/dimitrije/nikode-api/internal/config"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
 )
 
+const githubAPIURL = "https://api.github.com"
+
 type GitHubProvider struct {
 	config *oauth2.Config
+	name   string
+	apiURL string
 }
 
+// NewGitHubProvider creates a provider for github.com or, when cfg.BaseURL
+// is set, a GitHub Enterprise Server whose API is served under /api/v3.
 func NewGitHubProvider(cfg config.OAuthConfig) *GitHubProvider {
+	endpoint := github.Endpoint
+	apiURL := githubAPIURL
+	if baseURL := strings.TrimSuffix(cfg.BaseURL, "/"); baseURL != "" && baseURL != "https://github.com" {
+		endpoint = oauth2.Endpoint{
+			AuthURL:  baseURL + "/login/oauth/authorize",
+			TokenURL: baseURL + "/login/oauth/access_token",
+		}
+		apiURL = baseURL + "/api/v3"
+	}
+	if cfg.APIURL != "" {
+		apiURL = strings.TrimSuffix(cfg.APIURL, "/")
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = "github"
+	}
+
 	return &GitHubProvider{
 		config: &oauth2.Config{
 			ClientID:     cfg.ClientID,
 			ClientSecret: cfg.ClientSecret,
 			RedirectURL:  cfg.RedirectURL,
 			Scopes:       []string{"user:email", "read:user"},
-			Endpoint:     github.Endpoint,
+			Endpoint:     endpoint,
 		},
+		name:   name,
+		apiURL: apiURL,
 	}
 }
 
 func (p *GitHubProvider) Name() string {
-	return "github"
+	return p.name
 }
 
 func (p *GitHubProvider) GetConsentURL(state string) string {
@@ -43,7 +70,7 @@ func (p *GitHubProvider) ExchangeCode(ctx context.Context, code string) (*UserIn
 
 	client := p.config.Client(ctx, token)
 
-	userResp, err := client.Get("https://api.github.com/user")
+	userResp, err := client.Get(p.apiURL + "/user")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -65,12 +92,9 @@ func (p *GitHubProvider) ExchangeCode(ctx context.Context, code string) (*UserIn
 		return nil, fmt.Errorf("failed to decode user info: %w", err)
 	}
 
-	email := ghUser.Email
-	if email == "" {
-		email, err = p.getPrimaryEmail(ctx, client)
-		if err != nil {
-			return nil, err
-		}
+	email, verified, err := p.getEmail(client, ghUser.Email)
+	if err != nil {
+		return nil, err
 	}
 
 	name := ghUser.Name
@@ -79,46 +103,74 @@ func (p *GitHubProvider) ExchangeCode(ctx context.Context, code string) (*UserIn
 	}
 
 	return &UserInfo{
-		Email:     email,
-		Name:      name,
-		AvatarURL: ghUser.AvatarURL,
-		ID:        fmt.Sprintf("%d", ghUser.ID),
-		Provider:  "github",
+		Email:         email,
+		Name:          name,
+		AvatarURL:     ghUser.AvatarURL,
+		ID:            fmt.Sprintf("%d", ghUser.ID),
+		Provider:      p.name,
+		EmailVerified: verified,
 	}, nil
 }
 
-func (p *GitHubProvider) getPrimaryEmail(ctx context.Context, client *http.Client) (string, error) {
-	resp, err := client.Get("https://api.github.com/user/emails")
+// getEmail looks up the user's addresses to tell whether publicEmail is
+// verified. Without a public email it falls back to the primary verified one.
+func (p *GitHubProvider) getEmail(client *http.Client, publicEmail string) (string, bool, error) {
+	emails, err := p.getEmails(client)
 	if err != nil {
-		return "", fmt.Errorf("failed to get user emails: %w", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	var emails []struct {
-		Email    string `json:"email"`
-		Primary  bool   `json:"primary"`
-		Verified bool   `json:"verified"`
+		if publicEmail != "" {
+			return publicEmail, false, nil
+		}
+		return "", false, err
 	}
 
-	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
-		return "", fmt.Errorf("failed to decode emails: %w", err)
+	if publicEmail != "" {
+		for _, e := range emails {
+			if strings.EqualFold(e.Email, publicEmail) {
+				return publicEmail, e.Verified, nil
+			}
+		}
+		return publicEmail, false, nil
 	}
 
 	for _, e := range emails {
 		if e.Primary && e.Verified {
-			return e.Email, nil
+			return e.Email, true, nil
 		}
 	}
 
 	for _, e := range emails {
 		if e.Verified {
-			return e.Email, nil
+			return e.Email, true, nil
 		}
 	}
 
 	if len(emails) > 0 {
-		return emails[0].Email, nil
+		return emails[0].Email, false, nil
+	}
+
+	return "", false, fmt.Errorf("no email found")
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func (p *GitHubProvider) getEmails(client *http.Client) ([]githubEmail, error) {
+	resp, err := client.Get(p.apiURL + "/user/emails")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user emails: %w", err)
 	}
+	defer func() { _ = resp.Body.Close() }()
 
-	return "", fmt.Errorf("no email found")
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("github api returned status %d", resp.StatusCode)
+	}
+
+	var emails []githubEmail
+	if err := json.NewDecoder(resp.Body).Decode(&emails); err != nil {
+		return nil, fmt.Errorf("failed to decode emails: %w", err)
+	}
+	return emails, nil
 }
@@ -1,12 +1,14 @@
 package oauth
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/dimitrije/nikode-api/internal/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"golang.org/x/oauth2"
 )
 
@@ -128,6 +130,96 @@ func TestGitHubProvider_NameFallbackToLogin(t *testing.T) {
 	assert.NotNil(t, apiServer)
 }
 
-// Note: Testing getPrimaryEmail requires mocking the actual HTTP call to api.github.com
-// Since the function hardcodes the URL, these would be integration tests or require
-// dependency injection for the HTTP client. The tests above verify the provider configuration.
+func TestGitHubProvider_Enterprise(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			_, _ = w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer"}`))
+		case "/api/v3/user":
+			assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"id": 42, "login": "ada", "name": "", "email": "", "avatar_url": "` + server.URL + `/avatars/42"}`))
+		case "/api/v3/user/emails":
+			_, _ = w.Write([]byte(`[
+				{"email": "old@corp.example", "primary": false, "verified": true},
+				{"email": "ada@corp.example", "primary": true, "verified": true}
+			]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewGitHubProvider(config.OAuthConfig{
+		Name:     "github-corp",
+		ClientID: "test-client-id",
+		BaseURL:  server.URL + "/",
+	})
+
+	assert.Equal(t, "github-corp", provider.Name())
+	assert.Contains(t, provider.GetConsentURL("test-state"), server.URL+"/login/oauth/authorize?")
+
+	userInfo, err := provider.ExchangeCode(context.Background(), "test-code")
+	require.NoError(t, err)
+	assert.Equal(t, "42", userInfo.ID)
+	assert.Equal(t, "ada@corp.example", userInfo.Email)
+	assert.True(t, userInfo.EmailVerified)
+	assert.Equal(t, "ada", userInfo.Name)
+	assert.Equal(t, "github-corp", userInfo.Provider)
+}
+
+func TestGitHubProvider_PublicEmailVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		emails   string
+		verified bool
+	}{
+		{"verified", `[{"email": "Ada@Example.com", "primary": true, "verified": true}]`, true},
+		{"unverified", `[{"email": "ada@example.com", "primary": true, "verified": false}]`, false},
+		{"not listed", `[{"email": "other@example.com", "primary": true, "verified": true}]`, false},
+		{"emails unavailable", ``, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/login/oauth/access_token":
+					_, _ = w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer"}`))
+				case "/api/v3/user":
+					_, _ = w.Write([]byte(`{"id": 42, "login": "ada", "email": "ada@example.com"}`))
+				case "/api/v3/user/emails":
+					if tt.emails == "" {
+						w.WriteHeader(http.StatusForbidden)
+						return
+					}
+					_, _ = w.Write([]byte(tt.emails))
+				}
+			}))
+			defer server.Close()
+
+			provider := NewGitHubProvider(config.OAuthConfig{BaseURL: server.URL})
+
+			userInfo, err := provider.ExchangeCode(context.Background(), "test-code")
+			require.NoError(t, err)
+			assert.Equal(t, "ada@example.com", userInfo.Email)
+			assert.Equal(t, tt.verified, userInfo.EmailVerified)
+		})
+	}
+}
+
+func TestGitHubProvider_APIURLOverride(t *testing.T) {
+	provider := NewGitHubProvider(config.OAuthConfig{
+		BaseURL: "https://github.corp.example",
+		APIURL:  "https://api.github.corp.example/",
+	})
+
+	assert.Equal(t, "https://github.corp.example/login/oauth/access_token", provider.config.Endpoint.TokenURL)
+	assert.Equal(t, "https://api.github.corp.example", provider.apiURL)
+
+	// github.com as the base URL keeps the public API host
+	provider = NewGitHubProvider(config.OAuthConfig{BaseURL: "https://github.com"})
+	assert.Equal(t, "https://api.github.com", provider.apiURL)
+}
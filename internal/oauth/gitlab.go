@@ -5,34 +5,55 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/dimitrije/nikode-api/internal/config"
 	"golang.org/x/oauth2"
 )
 
-var gitlabEndpoint = oauth2.Endpoint{
-	AuthURL:  "https://gitlab.com/oauth/authorize",
-	TokenURL: "https://gitlab.com/oauth/token",
-}
+const gitlabBaseURL = "https://gitlab.com"
 
 type GitLabProvider struct {
 	config *oauth2.Config
+	name   string
+	apiURL string
 }
 
+// NewGitLabProvider creates a provider for gitlab.com or the self-hosted
+// instance at cfg.BaseURL.
 func NewGitLabProvider(cfg config.OAuthConfig) *GitLabProvider {
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = gitlabBaseURL
+	}
+	apiURL := baseURL + "/api/v4"
+	if cfg.APIURL != "" {
+		apiURL = strings.TrimSuffix(cfg.APIURL, "/")
+	}
+
+	name := cfg.Name
+	if name == "" {
+		name = "gitlab"
+	}
+
 	return &GitLabProvider{
 		config: &oauth2.Config{
 			ClientID:     cfg.ClientID,
 			ClientSecret: cfg.ClientSecret,
 			RedirectURL:  cfg.RedirectURL,
 			Scopes:       []string{"read_user"},
-			Endpoint:     gitlabEndpoint,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  baseURL + "/oauth/authorize",
+				TokenURL: baseURL + "/oauth/token",
+			},
 		},
+		name:   name,
+		apiURL: apiURL,
 	}
 }
 
 func (p *GitLabProvider) Name() string {
-	return "gitlab"
+	return p.name
 }
 
 func (p *GitLabProvider) GetConsentURL(state string) string {
@@ -47,7 +68,7 @@ func (p *GitLabProvider) ExchangeCode(ctx context.Context, code string) (*UserIn
 
 	client := p.config.Client(ctx, token)
 
-	resp, err := client.Get("https://gitlab.com/api/v4/user")
+	resp, err := client.Get(p.apiURL + "/user")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
@@ -63,6 +84,8 @@ func (p *GitLabProvider) ExchangeCode(ctx context.Context, code string) (*UserIn
 		Name      string `json:"name"`
 		Email     string `json:"email"`
 		AvatarURL string `json:"avatar_url"`
+		// ConfirmedAt is set once the user has confirmed their email
+		ConfirmedAt *string `json:"confirmed_at"`
 	}
 
 	if err := json.NewDecoder(resp.Body).Decode(&glUser); err != nil {
@@ -75,10 +98,11 @@ func (p *GitLabProvider) ExchangeCode(ctx context.Context, code string) (*UserIn
 	}
 
 	return &UserInfo{
-		Email:     glUser.Email,
-		Name:      name,
-		AvatarURL: glUser.AvatarURL,
-		ID:        fmt.Sprintf("%d", glUser.ID),
-		Provider:  "gitlab",
+		Email:         glUser.Email,
+		Name:          name,
+		AvatarURL:     glUser.AvatarURL,
+		ID:            fmt.Sprintf("%d", glUser.ID),
+		Provider:      p.name,
+		EmailVerified: glUser.ConfirmedAt != nil && *glUser.ConfirmedAt != "",
 	}, nil
 }
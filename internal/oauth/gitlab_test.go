@@ -1,10 +1,14 @@
 package oauth
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/dimitrije/nikode-api/internal/config"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestGitLabProvider_Name(t *testing.T) {
@@ -90,3 +94,45 @@ func TestGitLabProvider_RedirectURL(t *testing.T) {
 	assert.Contains(t, url, "redirect_uri=https")
 	assert.Contains(t, url, "myapp.com")
 }
+
+func TestGitLabProvider_SelfHosted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/gitlab/oauth/token":
+			_, _ = w.Write([]byte(`{"access_token":"test-token","token_type":"Bearer"}`))
+		case "/gitlab/api/v4/user":
+			assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+			_, _ = w.Write([]byte(`{"id": 7, "username": "ada", "name": "Ada", "email": "ada@corp.example", "confirmed_at": "2024-01-02T03:04:05Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewGitLabProvider(config.OAuthConfig{
+		Name:     "gitlab-corp",
+		ClientID: "test-client-id",
+		BaseURL:  server.URL + "/gitlab",
+	})
+
+	assert.Equal(t, "gitlab-corp", provider.Name())
+	assert.Equal(t, server.URL+"/gitlab/oauth/authorize", provider.config.Endpoint.AuthURL)
+
+	userInfo, err := provider.ExchangeCode(context.Background(), "test-code")
+	require.NoError(t, err)
+	assert.Equal(t, "7", userInfo.ID)
+	assert.Equal(t, "ada@corp.example", userInfo.Email)
+	assert.True(t, userInfo.EmailVerified)
+	assert.Equal(t, "gitlab-corp", userInfo.Provider)
+}
+
+func TestGitLabProvider_APIURLOverride(t *testing.T) {
+	provider := NewGitLabProvider(config.OAuthConfig{
+		BaseURL: "https://gitlab.corp.example",
+		APIURL:  "https://gitlab-api.corp.example/api/v4",
+	})
+
+	assert.Equal(t, "https://gitlab.corp.example/oauth/token", provider.config.Endpoint.TokenURL)
+	assert.Equal(t, "https://gitlab-api.corp.example/api/v4", provider.apiURL)
+}
@@ -69,10 +69,11 @@ func (p *GoogleProvider) ExchangeCode(ctx context.Context, code string) (*UserIn
 	}
 
 	return &UserInfo{
-		Email:     gUser.Email,
-		Name:      gUser.Name,
-		AvatarURL: gUser.Picture,
-		ID:        gUser.ID,
-		Provider:  "google",
+		Email:         gUser.Email,
+		Name:          gUser.Name,
+		AvatarURL:     gUser.Picture,
+		ID:            gUser.ID,
+		Provider:      "google",
+		EmailVerified: gUser.VerifiedEmail,
 	}, nil
 }
@@ -12,6 +12,9 @@ type UserInfo struct {
 	AvatarURL string
 	ID        string
 	Provider  string
+	// EmailVerified is true when the provider vouches that the user owns
+	// Email. Only verified emails are used to link accounts automatically.
+	EmailVerified bool
 }
 
 type Provider interface {
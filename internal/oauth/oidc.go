@@ -0,0 +1,380 @@
+package oauth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcDiscoverySuffix = "/.well-known/openid-configuration"
+	// jwksRefreshInterval limits how often an unknown kid triggers a JWKS
+	// refetch, so tokens with made up kids can't hammer the IdP
+	jwksRefreshInterval = time.Minute
+)
+
+// oidcSigningMethods are the ID token algorithms accepted. Symmetric and
+// unsigned tokens are never accepted.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+var ErrUnknownSigningKey = errors.New("id token signed with unknown key")
+
+type oidcDiscovery struct {
+	Issuer           string   `json:"issuer"`
+	AuthURL          string   `json:"authorization_endpoint"`
+	TokenURL         string   `json:"token_endpoint"`
+	UserInfoURL      string   `json:"userinfo_endpoint"`
+	JWKSURL          string   `json:"jwks_uri"`
+	SigningAlgValues []string `json:"id_token_signing_alg_values_supported"`
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// OIDCProvider signs users in with any OpenID Connect provider, such as
+// Keycloak, Okta or Azure AD. The ID token's signature is checked against the
+// provider's JWKS and its claims are mapped onto UserInfo.
+type OIDCProvider struct {
+	cfg       config.OIDCConfig
+	config    *oauth2.Config
+	discovery oidcDiscovery
+	client    *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// NewOIDCProvider fetches the discovery document and signing keys of the
+// provider described by cfg.
+func NewOIDCProvider(ctx context.Context, cfg config.OIDCConfig) (*OIDCProvider, error) {
+	return newOIDCProvider(ctx, cfg, &http.Client{Timeout: 10 * time.Second})
+}
+
+func newOIDCProvider(ctx context.Context, cfg config.OIDCConfig, client *http.Client) (*OIDCProvider, error) {
+	p := &OIDCProvider{cfg: cfg, client: client}
+
+	if err := p.getJSON(ctx, cfg.DiscoveryURL, &p.discovery); err != nil {
+		return nil, fmt.Errorf("failed to fetch discovery document: %w", err)
+	}
+	d := p.discovery
+	if d.Issuer == "" || d.AuthURL == "" || d.TokenURL == "" || d.JWKSURL == "" {
+		return nil, errors.New("discovery document is missing required endpoints")
+	}
+	if issuer, ok := strings.CutSuffix(cfg.DiscoveryURL, oidcDiscoverySuffix); ok && strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(d.Issuer, "/") {
+		return nil, fmt.Errorf("discovery issuer %q does not match %q", d.Issuer, issuer)
+	}
+
+	scopes := cfg.Scopes
+	if !slices.Contains(scopes, "openid") {
+		scopes = append([]string{"openid"}, scopes...)
+	}
+	p.config = &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Scopes:       scopes,
+		Endpoint:     oauth2.Endpoint{AuthURL: d.AuthURL, TokenURL: d.TokenURL},
+	}
+
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *OIDCProvider) GetConsentURL(state string) string {
+	return p.config.AuthCodeURL(state)
+}
+
+func (p *OIDCProvider) ExchangeCode(ctx context.Context, code string) (*UserInfo, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, p.client)
+
+	token, err := p.config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	claims, err := p.verifyIDToken(ctx, rawIDToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Some providers leave profile claims out of the ID token; the userinfo
+	// endpoint fills them in without overriding what the token says
+	if p.discovery.UserInfoURL != "" && (claimString(claims, p.cfg.EmailClaim) == "" || claimString(claims, p.cfg.NameClaim) == "") {
+		var userInfo map[string]any
+		if err := p.getJSON(ctx, p.discovery.UserInfoURL, &userInfo, token); err == nil && userInfo["sub"] == claims["sub"] {
+			for k, v := range userInfo {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+
+	return p.mapClaims(claims)
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, rawIDToken string) (jwt.MapClaims, error) {
+	// Accept what the provider advertises, minus anything not asymmetric
+	methods := slices.DeleteFunc(slices.Clone(p.discovery.SigningAlgValues), func(alg string) bool {
+		return !slices.Contains(oidcSigningMethods, alg)
+	})
+	if len(methods) == 0 {
+		methods = oidcSigningMethods
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(p.discovery.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	// With several audiences the token must have been issued to us
+	if azp, ok := claims["azp"].(string); ok && azp != p.cfg.ClientID {
+		return nil, errors.New("invalid id token: authorized party mismatch")
+	}
+	return claims, nil
+}
+
+// key returns the signing key with the given kid, refetching the JWKS once
+// when the kid is unknown in case the provider rotated its keys.
+func (p *OIDCProvider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, ErrUnknownSigningKey
+	}
+	if err := p.fetchKeys(ctx); err != nil {
+		return nil, err
+	}
+	if key := p.lookupKey(kid); key != nil {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// lookupKey finds kid in the cached keys. Tokens without a kid are accepted
+// only when the JWKS holds a single key.
+func (p *OIDCProvider) lookupKey(kid string) crypto.PublicKey {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key
+		}
+	}
+	return p.keys[kid]
+}
+
+func (p *OIDCProvider) refreshKeys(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fetchKeys(ctx)
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context) error {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.discovery.JWKSURL, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch signing keys: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// Skip key types we can't use rather than failing the whole set
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return errors.New("provider published no usable signing keys")
+	}
+
+	p.keys = keys
+	p.keysFetched = time.Now()
+	return nil
+}
+
+func (p *OIDCProvider) mapClaims(claims jwt.MapClaims) (*UserInfo, error) {
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("id token has no subject")
+	}
+
+	email := claimString(claims, p.cfg.EmailClaim)
+	if email == "" {
+		return nil, errors.New("no email claim in id token")
+	}
+
+	name := claimString(claims, p.cfg.NameClaim)
+	if name == "" {
+		name = claimString(claims, "preferred_username")
+	}
+	if name == "" {
+		name = email
+	}
+
+	return &UserInfo{
+		Email:         email,
+		Name:          name,
+		AvatarURL:     claimString(claims, p.cfg.AvatarClaim),
+		ID:            sub,
+		Provider:      p.cfg.Name,
+		EmailVerified: claimBool(claims, "email_verified"),
+	}, nil
+}
+
+// getJSON fetches url into v. A token, when given, is sent as a bearer token.
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v any, token ...*oauth2.Token) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	for _, t := range token {
+		t.SetAuthHeader(req)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", p.cfg.Name, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// claimString returns the string claim at path, where dots separate the keys
+// of nested objects.
+func claimString(claims map[string]any, path string) string {
+	if path == "" {
+		return ""
+	}
+	var value any = claims
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		value = obj[key]
+	}
+	s, _ := value.(string)
+	return s
+}
+
+// claimBool reads a boolean claim. Some providers send booleans as strings.
+func claimBool(claims map[string]any, key string) bool {
+	switch v := claims[key].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
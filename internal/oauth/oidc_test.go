@@ -0,0 +1,364 @@
+package oauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/config"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// oidcStandIn is an in-process OpenID Connect provider. It serves discovery,
+// JWKS, token and userinfo endpoints and signs ID tokens with an RSA key.
+type oidcStandIn struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	kid      string
+	issuer   string
+	claims   jwt.MapClaims
+	userInfo map[string]any
+	// signer overrides the key and kid used to sign the next ID token
+	signer func(claims jwt.MapClaims) string
+}
+
+func newOIDCStandIn(t *testing.T) *oidcStandIn {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	s := &oidcStandIn{key: key, kid: "key-1"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                s.issuer,
+			"authorization_endpoint":                s.server.URL + "/authorize",
+			"token_endpoint":                        s.server.URL + "/token",
+			"userinfo_endpoint":                     s.server.URL + "/userinfo",
+			"jwks_uri":                              s.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256", "EdDSA"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": s.kid,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		idToken := s.sign(s.claims)
+		if s.signer != nil {
+			idToken = s.signer(s.claims)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access-token",
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     idToken,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(s.userInfo)
+	})
+	s.server = httptest.NewServer(mux)
+	t.Cleanup(s.server.Close)
+	s.issuer = s.server.URL
+
+	s.claims = jwt.MapClaims{
+		"iss":            s.server.URL,
+		"aud":            "nikode",
+		"sub":            "user-123",
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"name":           "Ada Lovelace",
+		"picture":        "https://example.com/ada.png",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+	}
+	return s
+}
+
+func (s *oidcStandIn) sign(claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = s.kid
+	signed, _ := token.SignedString(s.key)
+	return signed
+}
+
+func (s *oidcStandIn) config() config.OIDCConfig {
+	return config.OIDCConfig{
+		OAuthConfig: config.OAuthConfig{
+			ClientID:     "nikode",
+			ClientSecret: "secret",
+			RedirectURL:  "http://localhost/api/v1/auth/corp/callback",
+			Name:         "corp",
+		},
+		DiscoveryURL: s.server.URL + "/.well-known/openid-configuration",
+		Scopes:       []string{"email", "profile"},
+		EmailClaim:   "email",
+		NameClaim:    "name",
+		AvatarClaim:  "picture",
+	}
+}
+
+func (s *oidcStandIn) provider(t *testing.T, cfg config.OIDCConfig) *OIDCProvider {
+	t.Helper()
+	provider, err := newOIDCProvider(context.Background(), cfg, s.server.Client())
+	require.NoError(t, err)
+	return provider
+}
+
+func TestOIDCProvider_GetConsentURL(t *testing.T) {
+	s := newOIDCStandIn(t)
+	provider := s.provider(t, s.config())
+
+	assert.Equal(t, "corp", provider.Name())
+
+	consent, err := url.Parse(provider.GetConsentURL("test-state"))
+	require.NoError(t, err)
+	assert.Equal(t, s.server.URL+"/authorize", consent.Scheme+"://"+consent.Host+consent.Path)
+	assert.Equal(t, "test-state", consent.Query().Get("state"))
+	assert.Equal(t, "nikode", consent.Query().Get("client_id"))
+	assert.Equal(t, "openid email profile", consent.Query().Get("scope"))
+}
+
+func TestOIDCProvider_ExchangeCode(t *testing.T) {
+	s := newOIDCStandIn(t)
+	provider := s.provider(t, s.config())
+
+	userInfo, err := provider.ExchangeCode(context.Background(), "good-code")
+	require.NoError(t, err)
+
+	assert.Equal(t, &UserInfo{
+		Email:         "ada@example.com",
+		Name:          "Ada Lovelace",
+		AvatarURL:     "https://example.com/ada.png",
+		ID:            "user-123",
+		Provider:      "corp",
+		EmailVerified: true,
+	}, userInfo)
+}
+
+func TestOIDCProvider_ExchangeCode_EmailVerified(t *testing.T) {
+	tests := []struct {
+		name     string
+		claim    any
+		verified bool
+	}{
+		{"bool", true, true},
+		{"string", "true", true},
+		{"false", false, false},
+		{"missing", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newOIDCStandIn(t)
+			if tt.claim == nil {
+				delete(s.claims, "email_verified")
+			} else {
+				s.claims["email_verified"] = tt.claim
+			}
+			provider := s.provider(t, s.config())
+
+			userInfo, err := provider.ExchangeCode(context.Background(), "good-code")
+			require.NoError(t, err)
+			assert.Equal(t, tt.verified, userInfo.EmailVerified)
+		})
+	}
+}
+
+func TestOIDCProvider_ExchangeCode_ClaimMapping(t *testing.T) {
+	s := newOIDCStandIn(t)
+	s.claims["upn"] = "ada@corp.example"
+	s.claims["profile"] = map[string]any{"display_name": "Ada L.", "avatar": "https://corp.example/ada.png"}
+
+	cfg := s.config()
+	cfg.EmailClaim = "upn"
+	cfg.NameClaim = "profile.display_name"
+	cfg.AvatarClaim = "profile.avatar"
+	provider := s.provider(t, cfg)
+
+	userInfo, err := provider.ExchangeCode(context.Background(), "good-code")
+	require.NoError(t, err)
+
+	assert.Equal(t, "ada@corp.example", userInfo.Email)
+	assert.Equal(t, "Ada L.", userInfo.Name)
+	assert.Equal(t, "https://corp.example/ada.png", userInfo.AvatarURL)
+}
+
+func TestOIDCProvider_ExchangeCode_UserInfoFallback(t *testing.T) {
+	s := newOIDCStandIn(t)
+	delete(s.claims, "email")
+	delete(s.claims, "name")
+	s.userInfo = map[string]any{"sub": "user-123", "email": "ada@example.com", "name": "Ada"}
+	provider := s.provider(t, s.config())
+
+	userInfo, err := provider.ExchangeCode(context.Background(), "good-code")
+	require.NoError(t, err)
+
+	assert.Equal(t, "ada@example.com", userInfo.Email)
+	assert.Equal(t, "Ada", userInfo.Name)
+}
+
+func TestOIDCProvider_ExchangeCode_UserInfoSubjectMismatch(t *testing.T) {
+	s := newOIDCStandIn(t)
+	delete(s.claims, "email")
+	s.userInfo = map[string]any{"sub": "someone-else", "email": "mallory@example.com"}
+	provider := s.provider(t, s.config())
+
+	_, err := provider.ExchangeCode(context.Background(), "good-code")
+	assert.ErrorContains(t, err, "no email claim")
+}
+
+func TestOIDCProvider_ExchangeCode_RejectsInvalidTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		modify func(s *oidcStandIn)
+	}{
+		{
+			name: "wrong audience",
+			modify: func(s *oidcStandIn) {
+				s.claims["aud"] = "another-client"
+			},
+		},
+		{
+			name: "wrong issuer",
+			modify: func(s *oidcStandIn) {
+				s.claims["iss"] = "https://evil.example"
+			},
+		},
+		{
+			name: "expired",
+			modify: func(s *oidcStandIn) {
+				s.claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			},
+		},
+		{
+			name: "authorized party mismatch",
+			modify: func(s *oidcStandIn) {
+				s.claims["aud"] = []string{"nikode", "another-client"}
+				s.claims["azp"] = "another-client"
+			},
+		},
+		{
+			name: "signed by another key",
+			modify: func(s *oidcStandIn) {
+				s.signer = func(claims jwt.MapClaims) string {
+					token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+					token.Header["kid"] = s.kid
+					signed, _ := token.SignedString(otherKey)
+					return signed
+				}
+			},
+		},
+		{
+			name: "unknown kid",
+			modify: func(s *oidcStandIn) {
+				s.signer = func(claims jwt.MapClaims) string {
+					token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+					token.Header["kid"] = "key-2"
+					signed, _ := token.SignedString(edKey)
+					return signed
+				}
+			},
+		},
+		{
+			name: "symmetric algorithm",
+			modify: func(s *oidcStandIn) {
+				s.signer = func(claims jwt.MapClaims) string {
+					token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+					token.Header["kid"] = s.kid
+					signed, _ := token.SignedString([]byte("client-secret"))
+					return signed
+				}
+			},
+		},
+		{
+			name: "unsigned",
+			modify: func(s *oidcStandIn) {
+				s.signer = func(claims jwt.MapClaims) string {
+					signed, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+					return signed
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newOIDCStandIn(t)
+			provider := s.provider(t, s.config())
+			tt.modify(s)
+
+			_, err := provider.ExchangeCode(context.Background(), "good-code")
+			assert.ErrorContains(t, err, "invalid id token")
+		})
+	}
+}
+
+func TestOIDCProvider_ExchangeCode_KeyRotation(t *testing.T) {
+	s := newOIDCStandIn(t)
+	provider := s.provider(t, s.config())
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	s.key, s.kid = newKey, "key-2"
+
+	// The new kid is only fetched once the refresh interval has passed
+	_, err = provider.ExchangeCode(context.Background(), "good-code")
+	assert.ErrorIs(t, err, ErrUnknownSigningKey)
+
+	provider.keysFetched = time.Now().Add(-jwksRefreshInterval)
+	userInfo, err := provider.ExchangeCode(context.Background(), "good-code")
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", userInfo.ID)
+}
+
+func TestOIDCProvider_ExchangeCode_InvalidCode(t *testing.T) {
+	s := newOIDCStandIn(t)
+	provider := s.provider(t, s.config())
+
+	_, err := provider.ExchangeCode(context.Background(), "bad-code")
+	assert.ErrorContains(t, err, "failed to exchange code")
+}
+
+func TestNewOIDCProvider_IssuerMismatch(t *testing.T) {
+	s := newOIDCStandIn(t)
+	s.issuer = "https://evil.example"
+
+	_, err := newOIDCProvider(context.Background(), s.config(), s.server.Client())
+	assert.ErrorContains(t, err, "does not match")
+}
@@ -0,0 +1,165 @@
+package saml
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	nsMetadata = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	bindingHTTPRedirect = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+	bindingHTTPPost     = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	nameIDFormatEmail   = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+)
+
+// maxMetadataSize bounds the IdP metadata document
+const maxMetadataSize = 1 << 20
+
+var metadataClient = &http.Client{Timeout: 10 * time.Second}
+
+// identityProvider is what the SP needs to know about its IdP.
+type identityProvider struct {
+	entityID string
+	ssoURL   string
+	certs    []*x509.Certificate
+}
+
+type entityDescriptor struct {
+	XMLName          xml.Name
+	EntityID         string              `xml:"entityID,attr"`
+	IDPSSODescriptor *idpSSODescriptor   `xml:"urn:oasis:names:tc:SAML:2.0:metadata IDPSSODescriptor"`
+	Entities         []*entityDescriptor `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+}
+
+type idpSSODescriptor struct {
+	KeyDescriptors []struct {
+		Use          string   `xml:"use,attr"`
+		Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:metadata KeyDescriptor"`
+	SingleSignOnServices []struct {
+		Binding  string `xml:"Binding,attr"`
+		Location string `xml:"Location,attr"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:metadata SingleSignOnService"`
+}
+
+// loadMetadata reads IdP metadata from a URL or a file path.
+func loadMetadata(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "https://") && !strings.HasPrefix(location, "http://") {
+		return os.ReadFile(location)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata URL returned status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxMetadataSize))
+}
+
+// parseIdPMetadata reads the entity ID, the HTTP-Redirect single sign-on URL
+// and the signing certificates from IdP metadata. An EntitiesDescriptor is
+// searched for its first IdP.
+func parseIdPMetadata(data []byte) (*identityProvider, error) {
+	if bytes.Contains(data, []byte("<!DOCTYPE")) {
+		return nil, errors.New("DTDs are not allowed in metadata")
+	}
+
+	var root entityDescriptor
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse IdP metadata: %w", err)
+	}
+	if root.XMLName.Space != nsMetadata {
+		return nil, errors.New("not a SAML metadata document")
+	}
+
+	entity := &root
+	if root.XMLName.Local == "EntitiesDescriptor" {
+		entity = nil
+		for _, e := range root.Entities {
+			if e.IDPSSODescriptor != nil {
+				entity = e
+				break
+			}
+		}
+	}
+	if entity == nil || entity.IDPSSODescriptor == nil {
+		return nil, errors.New("metadata has no IDPSSODescriptor")
+	}
+
+	idp := &identityProvider{entityID: entity.EntityID}
+	for _, sso := range entity.IDPSSODescriptor.SingleSignOnServices {
+		if sso.Binding == bindingHTTPRedirect {
+			idp.ssoURL = sso.Location
+			break
+		}
+	}
+	for _, kd := range entity.IDPSSODescriptor.KeyDescriptors {
+		if kd.Use != "" && kd.Use != "signing" {
+			continue
+		}
+		for _, encoded := range kd.Certificates {
+			der, err := decodeBase64(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("malformed IdP certificate: %w", err)
+			}
+			cert, err := x509.ParseCertificate(der)
+			if err != nil {
+				return nil, fmt.Errorf("malformed IdP certificate: %w", err)
+			}
+			idp.certs = append(idp.certs, cert)
+		}
+	}
+
+	if idp.entityID == "" || idp.ssoURL == "" || len(idp.certs) == 0 {
+		return nil, errors.New("metadata needs an entityID, an HTTP-Redirect SingleSignOnService and a signing certificate")
+	}
+	return idp, nil
+}
+
+type spMetadata struct {
+	XMLName  xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID string   `xml:"entityID,attr"`
+	SP       struct {
+		AuthnRequestsSigned        bool   `xml:"AuthnRequestsSigned,attr"`
+		WantAssertionsSigned       bool   `xml:"WantAssertionsSigned,attr"`
+		ProtocolSupportEnumeration string `xml:"protocolSupportEnumeration,attr"`
+		NameIDFormat               string `xml:"NameIDFormat"`
+		AssertionConsumerService   struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+			Index    int    `xml:"index,attr"`
+		} `xml:"AssertionConsumerService"`
+	} `xml:"SPSSODescriptor"`
+}
+
+// Metadata returns the SP metadata document to register with the IdP.
+func (sp *ServiceProvider) Metadata() []byte {
+	var m spMetadata
+	m.EntityID = sp.entityID
+	m.SP.WantAssertionsSigned = true
+	m.SP.ProtocolSupportEnumeration = nsProtocol
+	m.SP.NameIDFormat = nameIDFormatEmail
+	m.SP.AssertionConsumerService.Binding = bindingHTTPPost
+	m.SP.AssertionConsumerService.Location = sp.acsURL
+
+	out, _ := xml.MarshalIndent(m, "", "  ")
+	return append([]byte(xml.Header), out...)
+}
@@ -0,0 +1,381 @@
+// Package saml implements a SAML 2.0 service provider: SP-initiated login
+// over the HTTP-Redirect binding, IdP-initiated login, and validation of
+// signed responses posted to the assertion consumer service.
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/config"
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/services"
+)
+
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	statusSuccess      = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	confirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	// clockSkew is the tolerance applied to assertion validity windows
+	clockSkew = 2 * time.Minute
+	// maxResponseSize bounds the decoded SAMLResponse
+	maxResponseSize = 512 << 10
+
+	// seenAssertionKeyPrefix namespaces accepted assertion IDs in the store
+	seenAssertionKeyPrefix = "saml_assertion:"
+)
+
+var ErrInvalidResponse = errors.New("invalid SAML response")
+
+// ServiceProvider is this server's SAML SP for one IdP.
+type ServiceProvider struct {
+	cfg         config.SAMLConfig
+	idp         *identityProvider
+	entityID    string
+	acsURL      string
+	metadataURL string
+	now         func() time.Time
+
+	// seen holds the IDs of accepted assertions until they expire, so a
+	// captured response can't be replayed to any instance
+	seen services.EphemeralStore
+}
+
+// NewServiceProvider loads the IdP metadata named in cfg. baseURL is the
+// public URL of this server; the SP's endpoints live under
+// /api/v1/saml/<name>. seen must be shared by every instance.
+func NewServiceProvider(ctx context.Context, cfg config.SAMLConfig, baseURL string, seen services.EphemeralStore) (*ServiceProvider, error) {
+	metadata, err := loadMetadata(ctx, cfg.IdPMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load IdP metadata: %w", err)
+	}
+	return newServiceProvider(cfg, baseURL, metadata, seen)
+}
+
+func newServiceProvider(cfg config.SAMLConfig, baseURL string, metadata []byte, seen services.EphemeralStore) (*ServiceProvider, error) {
+	idp, err := parseIdPMetadata(metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(baseURL, "/") + "/api/v1/saml/" + cfg.Name
+	sp := &ServiceProvider{
+		cfg:         cfg,
+		idp:         idp,
+		entityID:    cfg.EntityID,
+		acsURL:      base + "/acs",
+		metadataURL: base + "/metadata",
+		now:         time.Now,
+		seen:        seen,
+	}
+	if sp.entityID == "" {
+		sp.entityID = sp.metadataURL
+	}
+	return sp, nil
+}
+
+func (sp *ServiceProvider) Name() string {
+	return sp.cfg.Name
+}
+
+// AllowIdPInitiated reports whether responses without a matching request
+// are accepted.
+func (sp *ServiceProvider) AllowIdPInitiated() bool {
+	return sp.cfg.AllowIdPInitiated
+}
+
+// AuthnRequestURL builds the IdP URL that starts an SP-initiated login. The
+// returned request ID must be passed to ParseResponse with the IdP's answer.
+func (sp *ServiceProvider) AuthnRequestURL(relayState string) (string, string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", "", err
+	}
+
+	var req bytes.Buffer
+	req.WriteString(`<samlp:AuthnRequest xmlns:samlp="` + nsProtocol + `" xmlns:saml="` + nsAssertion + `"`)
+	writeAttr(&req, "ID", id)
+	writeAttr(&req, "Version", "2.0")
+	writeAttr(&req, "IssueInstant", sp.now().UTC().Format(time.RFC3339))
+	writeAttr(&req, "Destination", sp.idp.ssoURL)
+	writeAttr(&req, "AssertionConsumerServiceURL", sp.acsURL)
+	writeAttr(&req, "ProtocolBinding", bindingHTTPPost)
+	req.WriteString(`><saml:Issuer>`)
+	_ = xml.EscapeText(&req, []byte(sp.entityID))
+	req.WriteString(`</saml:Issuer><samlp:NameIDPolicy AllowCreate="true"`)
+	writeAttr(&req, "Format", nameIDFormatEmail)
+	req.WriteString(`/></samlp:AuthnRequest>`)
+
+	var deflated bytes.Buffer
+	w, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	_, _ = w.Write(req.Bytes())
+	_ = w.Close()
+
+	u, err := url.Parse(sp.idp.ssoURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid IdP SSO URL: %w", err)
+	}
+	q := u.Query()
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	if relayState != "" {
+		q.Set("RelayState", relayState)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), id, nil
+}
+
+type samlResponse struct {
+	XMLName      xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol Response"`
+	ID           string   `xml:"ID,attr"`
+	InResponseTo string   `xml:"InResponseTo,attr"`
+	Destination  string   `xml:"Destination,attr"`
+	Issuer       string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Status       struct {
+		StatusCode struct {
+			Value string `xml:"Value,attr"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:protocol StatusCode"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:protocol Status"`
+	Assertions []samlAssertion `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+}
+
+type samlAssertion struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Assertion"`
+	ID      string   `xml:"ID,attr"`
+	Issuer  string   `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	Subject struct {
+		NameID        string `xml:"urn:oasis:names:tc:SAML:2.0:assertion NameID"`
+		Confirmations []struct {
+			Method string `xml:"Method,attr"`
+			Data   struct {
+				NotOnOrAfter time.Time `xml:"NotOnOrAfter,attr"`
+				Recipient    string    `xml:"Recipient,attr"`
+				InResponseTo string    `xml:"InResponseTo,attr"`
+			} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmationData"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion SubjectConfirmation"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Subject"`
+	Conditions struct {
+		NotBefore            time.Time `xml:"NotBefore,attr"`
+		NotOnOrAfter         time.Time `xml:"NotOnOrAfter,attr"`
+		AudienceRestrictions []struct {
+			Audiences []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion Audience"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AudienceRestriction"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Conditions"`
+	AttributeStatements []struct {
+		Attributes []struct {
+			Name         string   `xml:"Name,attr"`
+			FriendlyName string   `xml:"FriendlyName,attr"`
+			Values       []string `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeValue"`
+		} `xml:"urn:oasis:names:tc:SAML:2.0:assertion Attribute"`
+	} `xml:"urn:oasis:names:tc:SAML:2.0:assertion AttributeStatement"`
+}
+
+// ParseResponse validates a base64 encoded SAMLResponse posted to the ACS
+// and maps its assertion onto a user. requestID is the ID returned by
+// AuthnRequestURL, or empty for an IdP-initiated login.
+func (sp *ServiceProvider) ParseResponse(ctx context.Context, encoded, requestID string) (*oauth.UserInfo, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+	if err != nil || len(raw) > maxResponseSize {
+		return nil, fmt.Errorf("%w: malformed response", ErrInvalidResponse)
+	}
+
+	resp, assertion, err := sp.verify(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := sp.validate(ctx, resp, assertion, requestID); err != nil {
+		return nil, err
+	}
+	return sp.userInfo(assertion)
+}
+
+// verify checks the response or assertion signature and returns the
+// response and assertion as read from signed bytes. When only the assertion
+// is signed, the response envelope is read from the unsigned document.
+func (sp *ServiceProvider) verify(raw []byte) (*samlResponse, *samlAssertion, error) {
+	root, err := parseXML(raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if !root.is(nsProtocol, "Response") {
+		return nil, nil, fmt.Errorf("%w: not a Response", ErrInvalidResponse)
+	}
+	if err := checkUniqueIDs(root); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if len(root.childElements(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, nil, fmt.Errorf("%w: encrypted assertions are not supported", ErrInvalidResponse)
+	}
+	assertions := root.childElements(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, nil, fmt.Errorf("%w: expected one assertion", ErrInvalidResponse)
+	}
+
+	var resp samlResponse
+	if len(root.childElements(nsDSig, "Signature")) > 0 {
+		signed, err := verifySignature(root, sp.idp.certs)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := xml.Unmarshal(signed, &resp); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+		if len(resp.Assertions) != 1 {
+			return nil, nil, fmt.Errorf("%w: expected one assertion", ErrInvalidResponse)
+		}
+		return &resp, &resp.Assertions[0], nil
+	}
+
+	signed, err := verifySignature(assertions[0], sp.idp.certs)
+	if err != nil {
+		return nil, nil, err
+	}
+	var assertion samlAssertion
+	if err := xml.Unmarshal(signed, &assertion); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	if err := xml.Unmarshal(raw, &resp); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	return &resp, &assertion, nil
+}
+
+func (sp *ServiceProvider) validate(ctx context.Context, resp *samlResponse, a *samlAssertion, requestID string) error {
+	now := sp.now()
+
+	if resp.Status.StatusCode.Value != statusSuccess {
+		return fmt.Errorf("%w: IdP returned status %q", ErrInvalidResponse, resp.Status.StatusCode.Value)
+	}
+	if resp.Destination != "" && resp.Destination != sp.acsURL {
+		return fmt.Errorf("%w: wrong destination", ErrInvalidResponse)
+	}
+	if resp.InResponseTo != requestID {
+		return fmt.Errorf("%w: response does not answer our request", ErrInvalidResponse)
+	}
+	if resp.Issuer != "" && resp.Issuer != sp.idp.entityID {
+		return fmt.Errorf("%w: wrong issuer", ErrInvalidResponse)
+	}
+
+	if a.ID == "" || a.Issuer != sp.idp.entityID {
+		return fmt.Errorf("%w: wrong assertion issuer", ErrInvalidResponse)
+	}
+	if !a.Conditions.NotBefore.IsZero() && now.Add(clockSkew).Before(a.Conditions.NotBefore) {
+		return fmt.Errorf("%w: assertion not yet valid", ErrInvalidResponse)
+	}
+	if !a.Conditions.NotOnOrAfter.IsZero() && !now.Add(-clockSkew).Before(a.Conditions.NotOnOrAfter) {
+		return fmt.Errorf("%w: assertion expired", ErrInvalidResponse)
+	}
+
+	// Every audience restriction must name us
+	if len(a.Conditions.AudienceRestrictions) == 0 {
+		return fmt.Errorf("%w: assertion has no audience restriction", ErrInvalidResponse)
+	}
+	for _, restriction := range a.Conditions.AudienceRestrictions {
+		if !slices.Contains(restriction.Audiences, sp.entityID) {
+			return fmt.Errorf("%w: assertion is for another audience", ErrInvalidResponse)
+		}
+	}
+
+	var expiresAt time.Time
+	for _, c := range a.Subject.Confirmations {
+		if c.Method != confirmationBearer || c.Data.Recipient != sp.acsURL || c.Data.InResponseTo != requestID {
+			continue
+		}
+		if c.Data.NotOnOrAfter.IsZero() || !now.Add(-clockSkew).Before(c.Data.NotOnOrAfter) {
+			continue
+		}
+		expiresAt = c.Data.NotOnOrAfter.Add(clockSkew)
+		break
+	}
+	if expiresAt.IsZero() {
+		return fmt.Errorf("%w: no valid bearer subject confirmation", ErrInvalidResponse)
+	}
+
+	return sp.markSeen(ctx, a.ID, expiresAt.Sub(now))
+}
+
+// markSeen records an assertion ID until the assertion can no longer be
+// used. IDs are hashed to keep the keys short.
+func (sp *ServiceProvider) markSeen(ctx context.Context, assertionID string, ttl time.Duration) error {
+	sum := sha256.Sum256([]byte(assertionID))
+	key := seenAssertionKeyPrefix + sp.cfg.Name + ":" + hex.EncodeToString(sum[:])
+
+	err := sp.seen.Add(ctx, key, []byte{}, ttl)
+	if errors.Is(err, services.ErrEphemeralValueExists) {
+		return fmt.Errorf("%w: assertion already used", ErrInvalidResponse)
+	}
+	return err
+}
+
+func (sp *ServiceProvider) userInfo(a *samlAssertion) (*oauth.UserInfo, error) {
+	nameID := strings.TrimSpace(a.Subject.NameID)
+	if nameID == "" {
+		return nil, fmt.Errorf("%w: assertion has no NameID", ErrInvalidResponse)
+	}
+
+	email := a.attribute(sp.cfg.EmailAttribute)
+	if email == "" && strings.Contains(nameID, "@") {
+		email = nameID
+	}
+	if email == "" {
+		return nil, fmt.Errorf("%w: no email attribute in assertion", ErrInvalidResponse)
+	}
+
+	name := a.attribute(sp.cfg.NameAttribute)
+	if name == "" {
+		name = email
+	}
+
+	return &oauth.UserInfo{
+		Email:     email,
+		Name:      name,
+		AvatarURL: a.attribute(sp.cfg.AvatarAttribute),
+		ID:        nameID,
+		Provider:  sp.cfg.Name,
+	}, nil
+}
+
+// attribute returns the first value of the attribute with the given Name or
+// FriendlyName.
+func (a *samlAssertion) attribute(name string) string {
+	if name == "" {
+		return ""
+	}
+	for _, statement := range a.AttributeStatements {
+		for _, attr := range statement.Attributes {
+			if (attr.Name == name || attr.FriendlyName == name) && len(attr.Values) > 0 {
+				return strings.TrimSpace(attr.Values[0])
+			}
+		}
+	}
+	return ""
+}
+
+// newID returns a random SAML ID. IDs must not start with a digit.
+func newID() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "_" + hex.EncodeToString(b), nil
+}
+
+func writeAttr(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(" " + name + `="`)
+	escapeAttr(buf, value)
+	buf.WriteByte('"')
+}
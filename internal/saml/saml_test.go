@@ -0,0 +1,347 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/config"
+	"github.com/dimitrije/nikode-api/internal/oauth"
+	"github.com/dimitrije/nikode-api/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIdPEntityID = "https://idp.example.com/metadata"
+	testIdPSSOURL   = "https://idp.example.com/sso"
+	testBaseURL     = "https://nikode.example.com"
+	testACSURL      = testBaseURL + "/api/v1/saml/corp/acs"
+	testSPEntityID  = testBaseURL + "/api/v1/saml/corp/metadata"
+)
+
+// testIdP is an identity provider that signs assertions with its own key.
+type testIdP struct {
+	key  *rsa.PrivateKey
+	cert []byte
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return &testIdP{key: key, cert: cert}
+}
+
+func (idp *testIdP) metadata() []byte {
+	return []byte(`<?xml version="1.0"?>
+<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="` + testIdPEntityID + `">
+  <md:IDPSSODescriptor protocolSupportEnumeration="urn:oasis:names:tc:SAML:2.0:protocol">
+    <md:KeyDescriptor use="signing">
+      <ds:KeyInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">
+        <ds:X509Data><ds:X509Certificate>` + base64.StdEncoding.EncodeToString(idp.cert) + `</ds:X509Certificate></ds:X509Data>
+      </ds:KeyInfo>
+    </md:KeyDescriptor>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST" Location="https://idp.example.com/sso/post"/>
+    <md:SingleSignOnService Binding="urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect" Location="` + testIdPSSOURL + `"/>
+  </md:IDPSSODescriptor>
+</md:EntityDescriptor>`)
+}
+
+// sign inserts an enveloped signature after the first Issuer of doc.
+func (idp *testIdP) sign(t *testing.T, doc string) string {
+	t.Helper()
+
+	root, err := parseXML([]byte(doc))
+	require.NoError(t, err)
+	canonical, err := canonicalize(root, nil, nil)
+	require.NoError(t, err)
+	digest := sha256.Sum256(canonical)
+
+	signedInfo := `<ds:SignedInfo xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` +
+		`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#` + root.attr("ID") + `"><ds:Transforms>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2000/09/xmldsig#enveloped-signature"/>` +
+		`<ds:Transform Algorithm="http://www.w3.org/2001/10/xml-exc-c14n#"/>` +
+		`</ds:Transforms><ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+		`<ds:DigestValue>` + base64.StdEncoding.EncodeToString(digest[:]) + `</ds:DigestValue>` +
+		`</ds:Reference></ds:SignedInfo>`
+
+	siRoot, err := parseXML([]byte(signedInfo))
+	require.NoError(t, err)
+	canonicalSI, err := canonicalize(siRoot, nil, nil)
+	require.NoError(t, err)
+	hashed := sha256.Sum256(canonicalSI)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, hashed[:])
+	require.NoError(t, err)
+
+	signature := `<ds:Signature xmlns:ds="http://www.w3.org/2000/09/xmldsig#">` + signedInfo +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(sig) + `</ds:SignatureValue></ds:Signature>`
+	return strings.Replace(doc, "</saml:Issuer>", "</saml:Issuer>"+signature, 1)
+}
+
+type assertionOptions struct {
+	id           string
+	issuer       string
+	nameID       string
+	audience     string
+	recipient    string
+	inResponseTo string
+	notOnOrAfter time.Time
+	attributes   string
+}
+
+func defaultAssertion() assertionOptions {
+	return assertionOptions{
+		id:           "_assertion1",
+		issuer:       testIdPEntityID,
+		nameID:       "ada@corp.example",
+		audience:     testSPEntityID,
+		recipient:    testACSURL,
+		inResponseTo: "_request1",
+		notOnOrAfter: time.Now().Add(5 * time.Minute),
+		attributes: `<saml:Attribute Name="urn:oid:0.9.2342.19200300.100.1.3" FriendlyName="email"><saml:AttributeValue>ada@corp.example</saml:AttributeValue></saml:Attribute>` +
+			`<saml:Attribute Name="displayName"><saml:AttributeValue>Ada Lovelace</saml:AttributeValue></saml:Attribute>`,
+	}
+}
+
+func (o assertionOptions) xml() string {
+	notOnOrAfter := o.notOnOrAfter.UTC().Format(time.RFC3339)
+	return `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="` + o.id + `" Version="2.0" IssueInstant="` + time.Now().UTC().Format(time.RFC3339) + `">` +
+		`<saml:Issuer>` + o.issuer + `</saml:Issuer>` +
+		`<saml:Subject><saml:NameID Format="urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress">` + o.nameID + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="urn:oasis:names:tc:SAML:2.0:cm:bearer">` +
+		`<saml:SubjectConfirmationData NotOnOrAfter="` + notOnOrAfter + `" Recipient="` + o.recipient + `" InResponseTo="` + o.inResponseTo + `"/>` +
+		`</saml:SubjectConfirmation></saml:Subject>` +
+		`<saml:Conditions NotBefore="` + time.Now().Add(-time.Minute).UTC().Format(time.RFC3339) + `" NotOnOrAfter="` + notOnOrAfter + `">` +
+		`<saml:AudienceRestriction><saml:Audience>` + o.audience + `</saml:Audience></saml:AudienceRestriction></saml:Conditions>` +
+		`<saml:AttributeStatement>` + o.attributes + `</saml:AttributeStatement>` +
+		`</saml:Assertion>`
+}
+
+func response(inResponseTo, status string, assertions ...string) string {
+	return `<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_response1" Version="2.0"` +
+		` Destination="` + testACSURL + `" InResponseTo="` + inResponseTo + `">` +
+		`<saml:Issuer>` + testIdPEntityID + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="` + status + `"/></samlp:Status>` +
+		strings.Join(assertions, "") +
+		`</samlp:Response>`
+}
+
+func encode(doc string) string {
+	return base64.StdEncoding.EncodeToString([]byte(doc))
+}
+
+func newTestSP(t *testing.T, idp *testIdP) *ServiceProvider {
+	t.Helper()
+	sp, err := newServiceProvider(config.SAMLConfig{
+		Name:           "corp",
+		EmailAttribute: "email",
+		NameAttribute:  "displayName",
+	}, testBaseURL, idp.metadata(), services.NewMemoryEphemeralStore())
+	require.NoError(t, err)
+	return sp
+}
+
+func TestServiceProvider_Metadata(t *testing.T) {
+	sp := newTestSP(t, newTestIdP(t))
+
+	metadata := string(sp.Metadata())
+	assert.Contains(t, metadata, `entityID="`+testSPEntityID+`"`)
+	assert.Contains(t, metadata, `WantAssertionsSigned="true"`)
+	assert.Contains(t, metadata, `Location="`+testACSURL+`"`)
+	assert.Contains(t, metadata, `Binding="`+bindingHTTPPost+`"`)
+}
+
+func TestServiceProvider_AuthnRequestURL(t *testing.T) {
+	sp := newTestSP(t, newTestIdP(t))
+
+	redirect, requestID, err := sp.AuthnRequestURL("state-123")
+	require.NoError(t, err)
+
+	u, err := url.Parse(redirect)
+	require.NoError(t, err)
+	assert.Equal(t, testIdPSSOURL, u.Scheme+"://"+u.Host+u.Path)
+	assert.Equal(t, "state-123", u.Query().Get("RelayState"))
+
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	require.NoError(t, err)
+	request, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	require.NoError(t, err)
+
+	root, err := parseXML(request)
+	require.NoError(t, err)
+	assert.True(t, root.is(nsProtocol, "AuthnRequest"))
+	assert.Equal(t, requestID, root.attr("ID"))
+	assert.Equal(t, testACSURL, root.attr("AssertionConsumerServiceURL"))
+	assert.Equal(t, testSPEntityID, root.child(nsAssertion, "Issuer").text())
+}
+
+func TestServiceProvider_ParseResponse_SignedAssertion(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+
+	resp := response("_request1", statusSuccess, idp.sign(t, defaultAssertion().xml()))
+
+	userInfo, err := sp.ParseResponse(context.Background(), encode(resp), "_request1")
+	require.NoError(t, err)
+	assert.Equal(t, &oauth.UserInfo{
+		Email:    "ada@corp.example",
+		Name:     "Ada Lovelace",
+		ID:       "ada@corp.example",
+		Provider: "corp",
+	}, userInfo)
+}
+
+func TestServiceProvider_ParseResponse_SignedResponse(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+
+	resp := idp.sign(t, response("_request1", statusSuccess, defaultAssertion().xml()))
+
+	userInfo, err := sp.ParseResponse(context.Background(), encode(resp), "_request1")
+	require.NoError(t, err)
+	assert.Equal(t, "ada@corp.example", userInfo.Email)
+}
+
+func TestServiceProvider_ParseResponse_IdPInitiated(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+
+	o := defaultAssertion()
+	o.inResponseTo = ""
+	o.attributes = ""
+	resp := response("", statusSuccess, idp.sign(t, o.xml()))
+
+	userInfo, err := sp.ParseResponse(context.Background(), encode(resp), "")
+	require.NoError(t, err)
+	// Without attributes the email NameID is used for both
+	assert.Equal(t, "ada@corp.example", userInfo.Email)
+	assert.Equal(t, "ada@corp.example", userInfo.Name)
+}
+
+func TestServiceProvider_ParseResponse_Rejects(t *testing.T) {
+	idp := newTestIdP(t)
+	otherIdP := newTestIdP(t)
+
+	signed := func(modify func(o *assertionOptions)) func(t *testing.T) string {
+		return func(t *testing.T) string {
+			o := defaultAssertion()
+			modify(&o)
+			return response("_request1", statusSuccess, idp.sign(t, o.xml()))
+		}
+	}
+
+	tests := []struct {
+		name     string
+		response func(t *testing.T) string
+	}{
+		{"unsigned", func(t *testing.T) string {
+			return response("_request1", statusSuccess, defaultAssertion().xml())
+		}},
+		{"signed by another IdP", func(t *testing.T) string {
+			return response("_request1", statusSuccess, otherIdP.sign(t, defaultAssertion().xml()))
+		}},
+		{"tampered after signing", func(t *testing.T) string {
+			assertion := idp.sign(t, defaultAssertion().xml())
+			return response("_request1", statusSuccess, strings.Replace(assertion, "Ada Lovelace", "Mallory", 1))
+		}},
+		{"wrapped assertion", func(t *testing.T) string {
+			evil := defaultAssertion()
+			evil.id = "_evil"
+			evil.nameID = "mallory@corp.example"
+			return response("_request1", statusSuccess, evil.xml(), idp.sign(t, defaultAssertion().xml()))
+		}},
+		{"duplicate IDs", func(t *testing.T) string {
+			evil := defaultAssertion()
+			evil.nameID = "mallory@corp.example"
+			assertion := idp.sign(t, defaultAssertion().xml())
+			return response("_request1", statusSuccess, strings.Replace(assertion, "<saml:Subject>", evil.xml()+"<saml:Subject>", 1))
+		}},
+		{"failed status", func(t *testing.T) string {
+			return response("_request1", "urn:oasis:names:tc:SAML:2.0:status:Requester", idp.sign(t, defaultAssertion().xml()))
+		}},
+		{"response to another request", func(t *testing.T) string {
+			return response("_request2", statusSuccess, idp.sign(t, defaultAssertion().xml()))
+		}},
+		{"confirmation for another request", signed(func(o *assertionOptions) { o.inResponseTo = "_request2" })},
+		{"wrong issuer", signed(func(o *assertionOptions) { o.issuer = "https://evil.example.com" })},
+		{"wrong audience", signed(func(o *assertionOptions) { o.audience = "https://other-sp.example.com" })},
+		{"wrong recipient", signed(func(o *assertionOptions) { o.recipient = "https://other-sp.example.com/acs" })},
+		{"expired", signed(func(o *assertionOptions) { o.notOnOrAfter = time.Now().Add(-time.Hour) })},
+		{"encrypted assertion", func(t *testing.T) string {
+			return response("_request1", statusSuccess, `<saml:EncryptedAssertion/>`)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := newTestSP(t, idp)
+			_, err := sp.ParseResponse(context.Background(), encode(tt.response(t)), "_request1")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestServiceProvider_ParseResponse_Replay(t *testing.T) {
+	idp := newTestIdP(t)
+	sp := newTestSP(t, idp)
+
+	resp := encode(response("_request1", statusSuccess, idp.sign(t, defaultAssertion().xml())))
+
+	_, err := sp.ParseResponse(context.Background(), resp, "_request1")
+	require.NoError(t, err)
+
+	_, err = sp.ParseResponse(context.Background(), resp, "_request1")
+	assert.ErrorContains(t, err, "already used")
+}
+
+func TestServiceProvider_ParseResponse_ReplayToOtherInstance(t *testing.T) {
+	idp := newTestIdP(t)
+	cfg := config.SAMLConfig{Name: "corp", EmailAttribute: "email"}
+	store := services.NewMemoryEphemeralStore()
+	first, err := newServiceProvider(cfg, testBaseURL, idp.metadata(), store)
+	require.NoError(t, err)
+	second, err := newServiceProvider(cfg, testBaseURL, idp.metadata(), store)
+	require.NoError(t, err)
+
+	resp := encode(response("_request1", statusSuccess, idp.sign(t, defaultAssertion().xml())))
+
+	_, err = first.ParseResponse(context.Background(), resp, "_request1")
+	require.NoError(t, err)
+
+	_, err = second.ParseResponse(context.Background(), resp, "_request1")
+	assert.ErrorContains(t, err, "already used")
+}
+
+func TestParseIdPMetadata_Invalid(t *testing.T) {
+	_, err := parseIdPMetadata([]byte(`<md:EntityDescriptor xmlns:md="urn:oasis:names:tc:SAML:2.0:metadata" entityID="x"/>`))
+	assert.Error(t, err)
+
+	_, err = parseIdPMetadata([]byte(`<EntityDescriptor entityID="x"/>`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,504 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	nsXML   = "http://www.w3.org/XML/1998/namespace"
+	nsDSig  = "http://www.w3.org/2000/09/xmldsig#"
+	nsExcNS = "http://www.w3.org/2001/10/xml-exc-c14n#"
+
+	algExcC14N     = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA384   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha384"
+	algRSASHA512   = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algECDSASHA256 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	algECDSASHA384 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384"
+	algECDSASHA512 = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+	algSHA256      = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algSHA384      = "http://www.w3.org/2001/04/xmldsig-more#sha384"
+	algSHA512      = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+// SHA-1 based algorithms are deliberately not supported.
+var (
+	signatureHashes = map[string]crypto.Hash{
+		algRSASHA256:   crypto.SHA256,
+		algRSASHA384:   crypto.SHA384,
+		algRSASHA512:   crypto.SHA512,
+		algECDSASHA256: crypto.SHA256,
+		algECDSASHA384: crypto.SHA384,
+		algECDSASHA512: crypto.SHA512,
+	}
+	digestHashes = map[string]crypto.Hash{
+		algSHA256: crypto.SHA256,
+		algSHA384: crypto.SHA384,
+		algSHA512: crypto.SHA512,
+	}
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// element is a parsed XML element. Prefixes are kept as written so the
+// element can be canonicalized; namespaces are resolved on demand.
+type element struct {
+	parent   *element
+	prefix   string
+	local    string
+	nsDecls  []xml.Attr // Name.Local is the prefix, "" for the default namespace
+	attrs    []xml.Attr // Name.Space is the prefix
+	children []any      // *element, xml.CharData or xml.ProcInst
+}
+
+// parseXML parses a document into an element tree. Comments are dropped and
+// DTDs are rejected.
+func parseXML(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root, current *element
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if current == nil && root != nil {
+				return nil, errors.New("multiple root elements")
+			}
+			el := &element{parent: current, prefix: t.Name.Space, local: t.Name.Local}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					el.nsDecls = append(el.nsDecls, xml.Attr{Name: xml.Name{Local: ""}, Value: a.Value})
+				case a.Name.Space == "xmlns":
+					el.nsDecls = append(el.nsDecls, xml.Attr{Name: xml.Name{Local: a.Name.Local}, Value: a.Value})
+				default:
+					el.attrs = append(el.attrs, a)
+				}
+			}
+			if current == nil {
+				root = el
+			} else {
+				current.children = append(current.children, el)
+			}
+			current = el
+		case xml.EndElement:
+			if current == nil || current.prefix != t.Name.Space || current.local != t.Name.Local {
+				return nil, errors.New("mismatched end element")
+			}
+			current = current.parent
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, t.Copy())
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("text outside the root element")
+			}
+		case xml.ProcInst:
+			if current != nil {
+				current.children = append(current.children, t.Copy())
+			}
+		case xml.Directive:
+			return nil, errors.New("DTDs are not allowed")
+		}
+	}
+
+	if root == nil || current != nil {
+		return nil, errors.New("incomplete document")
+	}
+	return root, nil
+}
+
+// namespace resolves prefix in the element's scope.
+func (e *element) namespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return nsXML, true
+	}
+	for el := e; el != nil; el = el.parent {
+		for _, decl := range el.nsDecls {
+			if decl.Name.Local == prefix {
+				return decl.Value, true
+			}
+		}
+	}
+	return "", prefix == ""
+}
+
+func (e *element) is(ns, local string) bool {
+	uri, _ := e.namespace(e.prefix)
+	return e.local == local && uri == ns
+}
+
+func (e *element) attr(name string) string {
+	for _, a := range e.attrs {
+		if a.Name.Space == "" && a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (e *element) childElements(ns, local string) []*element {
+	var found []*element
+	for _, child := range e.children {
+		if el, ok := child.(*element); ok && el.is(ns, local) {
+			found = append(found, el)
+		}
+	}
+	return found
+}
+
+func (e *element) child(ns, local string) *element {
+	if children := e.childElements(ns, local); len(children) == 1 {
+		return children[0]
+	}
+	return nil
+}
+
+func (e *element) text() string {
+	var sb strings.Builder
+	for _, child := range e.children {
+		if text, ok := child.(xml.CharData); ok {
+			sb.Write(text)
+		}
+	}
+	return sb.String()
+}
+
+// checkUniqueIDs rejects documents that reuse an ID, which signature
+// wrapping attacks rely on to make a reference point at the wrong element.
+func checkUniqueIDs(root *element) error {
+	seen := make(map[string]bool)
+	var walk func(*element) error
+	walk = func(e *element) error {
+		if id := e.attr("ID"); id != "" {
+			if seen[id] {
+				return fmt.Errorf("duplicate ID %q", id)
+			}
+			seen[id] = true
+		}
+		for _, child := range e.children {
+			if el, ok := child.(*element); ok {
+				if err := walk(el); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	return walk(root)
+}
+
+// canonicalize serializes the subtree rooted at e with Exclusive XML
+// Canonicalization (without comments), leaving out exclude. inclusive lists
+// the prefixes of the InclusiveNamespaces PrefixList, "#default" standing
+// for the default namespace.
+func canonicalize(e, exclude *element, inclusive []string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := writeCanonical(&buf, e, exclude, inclusive, map[string]string{}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, e, exclude *element, inclusive []string, rendered map[string]string) error {
+	// Exclusive c14n declares the namespaces the element and its attributes
+	// use, plus those in the prefix list, unless an output ancestor already
+	// declared them with the same value
+	used := []string{e.prefix}
+	for _, a := range e.attrs {
+		if a.Name.Space != "" {
+			used = append(used, a.Name.Space)
+		}
+	}
+
+	type nsDecl struct{ prefix, uri string }
+	var decls []nsDecl
+	declare := func(prefix string, required bool) error {
+		if prefix == "xml" || slices.ContainsFunc(decls, func(d nsDecl) bool { return d.prefix == prefix }) {
+			return nil
+		}
+		uri, ok := e.namespace(prefix)
+		if !ok {
+			if required {
+				return fmt.Errorf("undeclared namespace prefix %q", prefix)
+			}
+			return nil
+		}
+		prev, seen := rendered[prefix]
+		if !seen && prefix == "" {
+			prev, seen = "", true
+		}
+		if seen && prev == uri {
+			return nil
+		}
+		decls = append(decls, nsDecl{prefix, uri})
+		return nil
+	}
+	for _, prefix := range used {
+		if err := declare(prefix, true); err != nil {
+			return err
+		}
+	}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		if err := declare(prefix, false); err != nil {
+			return err
+		}
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].prefix < decls[j].prefix })
+
+	if len(decls) > 0 {
+		next := make(map[string]string, len(rendered)+len(decls))
+		for k, v := range rendered {
+			next[k] = v
+		}
+		for _, d := range decls {
+			next[d.prefix] = d.uri
+		}
+		rendered = next
+	}
+
+	// Attributes are ordered by namespace URI, then local name
+	type attr struct {
+		uri  string
+		attr xml.Attr
+	}
+	attrs := make([]attr, 0, len(e.attrs))
+	for _, a := range e.attrs {
+		uri := ""
+		if a.Name.Space != "" {
+			uri, _ = e.namespace(a.Name.Space)
+		}
+		attrs = append(attrs, attr{uri, a})
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].uri != attrs[j].uri {
+			return attrs[i].uri < attrs[j].uri
+		}
+		return attrs[i].attr.Name.Local < attrs[j].attr.Name.Local
+	})
+
+	name := qualifiedName(e.prefix, e.local)
+	buf.WriteString("<" + name)
+	for _, d := range decls {
+		if d.prefix == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(` xmlns:` + d.prefix + `="`)
+		}
+		escapeAttr(buf, d.uri)
+		buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		buf.WriteString(" " + qualifiedName(a.attr.Name.Space, a.attr.Name.Local) + `="`)
+		escapeAttr(buf, a.attr.Value)
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('>')
+
+	for _, child := range e.children {
+		switch c := child.(type) {
+		case *element:
+			if c == exclude {
+				continue
+			}
+			if err := writeCanonical(buf, c, exclude, inclusive, rendered); err != nil {
+				return err
+			}
+		case xml.CharData:
+			escapeText(buf, string(c))
+		case xml.ProcInst:
+			buf.WriteString("<?" + c.Target)
+			if len(c.Inst) > 0 {
+				buf.WriteString(" " + string(c.Inst))
+			}
+			buf.WriteString("?>")
+		}
+	}
+
+	buf.WriteString("</" + name + ">")
+	return nil
+}
+
+func qualifiedName(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+var (
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+func escapeText(buf *bytes.Buffer, s string) {
+	_, _ = textEscaper.WriteString(buf, s)
+}
+
+func escapeAttr(buf *bytes.Buffer, s string) {
+	_, _ = attrEscaper.WriteString(buf, s)
+}
+
+// verifySignature checks the enveloped signature of e against certs and
+// returns the canonical form of e that the signature covers. Only data read
+// from the returned bytes is authenticated.
+func verifySignature(e *element, certs []*x509.Certificate) ([]byte, error) {
+	sigs := e.childElements(nsDSig, "Signature")
+	if len(sigs) != 1 {
+		return nil, fmt.Errorf("%w: expected one signature on %s", ErrInvalidSignature, e.local)
+	}
+	sig := sigs[0]
+
+	signedInfo := sig.child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return nil, fmt.Errorf("%w: missing SignedInfo", ErrInvalidSignature)
+	}
+
+	c14nMethod := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != algExcC14N {
+		return nil, fmt.Errorf("%w: unsupported canonicalization method", ErrInvalidSignature)
+	}
+
+	sigMethod := signedInfo.child(nsDSig, "SignatureMethod")
+	if sigMethod == nil {
+		return nil, fmt.Errorf("%w: missing SignatureMethod", ErrInvalidSignature)
+	}
+	sigHash, ok := signatureHashes[sigMethod.attr("Algorithm")]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported signature method %q", ErrInvalidSignature, sigMethod.attr("Algorithm"))
+	}
+
+	ref := signedInfo.child(nsDSig, "Reference")
+	if ref == nil {
+		return nil, fmt.Errorf("%w: expected one reference", ErrInvalidSignature)
+	}
+	id := e.attr("ID")
+	if id == "" || ref.attr("URI") != "#"+id {
+		return nil, fmt.Errorf("%w: reference does not point at the signed element", ErrInvalidSignature)
+	}
+
+	var enveloped, excC14N bool
+	var inclusive []string
+	if transforms := ref.child(nsDSig, "Transforms"); transforms != nil {
+		for _, transform := range transforms.childElements(nsDSig, "Transform") {
+			switch transform.attr("Algorithm") {
+			case algEnveloped:
+				enveloped = true
+			case algExcC14N:
+				excC14N = true
+				inclusive = prefixList(transform)
+			default:
+				return nil, fmt.Errorf("%w: unsupported transform %q", ErrInvalidSignature, transform.attr("Algorithm"))
+			}
+		}
+	}
+	if !enveloped || !excC14N {
+		return nil, fmt.Errorf("%w: expected enveloped signature and exclusive canonicalization transforms", ErrInvalidSignature)
+	}
+
+	digestMethod := ref.child(nsDSig, "DigestMethod")
+	if digestMethod == nil {
+		return nil, fmt.Errorf("%w: missing DigestMethod", ErrInvalidSignature)
+	}
+	digestHash, ok := digestHashes[digestMethod.attr("Algorithm")]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported digest method %q", ErrInvalidSignature, digestMethod.attr("Algorithm"))
+	}
+	digestValue := ref.child(nsDSig, "DigestValue")
+	if digestValue == nil {
+		return nil, fmt.Errorf("%w: missing DigestValue", ErrInvalidSignature)
+	}
+	expectedDigest, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed DigestValue", ErrInvalidSignature)
+	}
+
+	signed, err := canonicalize(e, sig, inclusive)
+	if err != nil {
+		return nil, err
+	}
+	h := digestHash.New()
+	h.Write(signed)
+	if subtle.ConstantTimeCompare(h.Sum(nil), expectedDigest) != 1 {
+		return nil, fmt.Errorf("%w: digest mismatch", ErrInvalidSignature)
+	}
+
+	canonicalSignedInfo, err := canonicalize(signedInfo, nil, prefixList(c14nMethod))
+	if err != nil {
+		return nil, err
+	}
+	sigValue := sig.child(nsDSig, "SignatureValue")
+	if sigValue == nil {
+		return nil, fmt.Errorf("%w: missing SignatureValue", ErrInvalidSignature)
+	}
+	signature, err := decodeBase64(sigValue.text())
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed SignatureValue", ErrInvalidSignature)
+	}
+
+	h = sigHash.New()
+	h.Write(canonicalSignedInfo)
+	hashed := h.Sum(nil)
+	for _, cert := range certs {
+		if verifyWithKey(cert.PublicKey, sigHash, hashed, signature) {
+			return signed, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: signature does not match any IdP certificate", ErrInvalidSignature)
+}
+
+func verifyWithKey(pub crypto.PublicKey, hash crypto.Hash, hashed, signature []byte) bool {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, hash, hashed, signature) == nil
+	case *ecdsa.PublicKey:
+		// XML signatures encode ECDSA as r and s concatenated
+		if len(signature)%2 != 0 {
+			return false
+		}
+		half := len(signature) / 2
+		r := new(big.Int).SetBytes(signature[:half])
+		s := new(big.Int).SetBytes(signature[half:])
+		return ecdsa.Verify(key, hashed, r, s)
+	default:
+		return false
+	}
+}
+
+// prefixList returns the InclusiveNamespaces PrefixList of a c14n method or
+// transform.
+func prefixList(e *element) []string {
+	if inclusive := e.child(nsExcNS, "InclusiveNamespaces"); inclusive != nil {
+		return strings.Fields(inclusive.attr("PrefixList"))
+	}
+	return nil
+}
+
+// decodeBase64 decodes base64 that may be wrapped over several lines.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
@@ -0,0 +1,86 @@
+package saml
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func canonicalChild(t *testing.T, doc string, inclusive []string, path ...string) string {
+	t.Helper()
+	root, err := parseXML([]byte(doc))
+	require.NoError(t, err)
+
+	el := root
+	for _, local := range path {
+		var next *element
+		for _, child := range el.children {
+			if c, ok := child.(*element); ok && c.local == local {
+				next = c
+				break
+			}
+		}
+		require.NotNil(t, next, "no %s element", local)
+		el = next
+	}
+
+	out, err := canonicalize(el, nil, inclusive)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestCanonicalize_Subtree(t *testing.T) {
+	// Example from the Exclusive XML Canonicalization spec: only the
+	// namespaces the subtree uses are carried over from its ancestors
+	doc := `<n0:local xmlns:n0="foo:bar" xmlns:n3="ftp://example.org"><n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"/></n1:elem2></n0:local>`
+
+	assert.Equal(t,
+		`<n1:elem2 xmlns:n1="http://example.net" xml:lang="en"><n3:stuff xmlns:n3="ftp://example.org"></n3:stuff></n1:elem2>`,
+		canonicalChild(t, doc, nil, "elem2"))
+}
+
+func TestCanonicalize_InheritedNamespaces(t *testing.T) {
+	doc := `<a xmlns="urn:default" xmlns:p="urn:p" xmlns:q="urn:q"><p:b q:attr="1"><c/></p:b></a>`
+
+	assert.Equal(t,
+		`<p:b xmlns:p="urn:p" xmlns:q="urn:q" q:attr="1"><c xmlns="urn:default"></c></p:b>`,
+		canonicalChild(t, doc, nil, "b"))
+
+	// Prefixes in the inclusive list are declared on the apex when in scope
+	assert.Equal(t,
+		`<p:b xmlns="urn:default" xmlns:p="urn:p" xmlns:q="urn:q" q:attr="1"><c></c></p:b>`,
+		canonicalChild(t, doc, []string{"#default", "missing"}, "b"))
+}
+
+func TestCanonicalize_OrderingAndEscaping(t *testing.T) {
+	doc := "<?xml version=\"1.0\"?>\n<!-- dropped --><r xmlns:z=\"urn:z\" b=\"2\" z:a=\"3\" a=\"&quot;x&#9;&amp;\"><!-- dropped -->t &lt; &amp; &gt;<![CDATA[<c>]]><x xmlns=\"\"/><?pi data?></r>"
+
+	assert.Equal(t,
+		`<r xmlns:z="urn:z" a="&quot;x&#x9;&amp;" b="2" z:a="3">t &lt; &amp; &gt;&lt;c&gt;<x></x><?pi data?></r>`,
+		canonicalChild(t, doc, nil))
+}
+
+func TestParseXML_Rejects(t *testing.T) {
+	tests := map[string]string{
+		"dtd":          `<!DOCTYPE r [<!ENTITY x "y">]><r>&x;</r>`,
+		"mismatched":   `<a><b></a></b>`,
+		"incomplete":   `<a><b></b>`,
+		"two roots":    `<a/><b/>`,
+		"text outside": `text<a/>`,
+	}
+	for name, doc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseXML([]byte(doc))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCanonicalize_UndeclaredPrefix(t *testing.T) {
+	root, err := parseXML([]byte(`<p:a/>`))
+	require.NoError(t, err)
+
+	_, err = canonicalize(root, nil, nil)
+	assert.Error(t, err)
+}
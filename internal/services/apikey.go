@@ -6,6 +6,10 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/dimitrije/nikode-api/internal/database"
@@ -14,23 +18,174 @@ import (
 )
 
 var (
-	ErrAPIKeyNotFound  = errors.New("api key not found")
-	ErrAPIKeyRevoked   = errors.New("api key has been revoked")
-	ErrAPIKeyExpired   = errors.New("api key has expired")
-	ErrAPIKeyInvalid   = errors.New("invalid api key")
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyRevoked  = errors.New("api key has been revoked")
+	ErrAPIKeyExpired  = errors.New("api key has expired")
+	ErrAPIKeyInvalid  = errors.New("invalid api key")
+
+	ErrInvalidAPIKeyScope             = errors.New("invalid api key scope")
+	ErrInvalidAPIKeyCIDR              = errors.New("invalid api key cidr")
+	ErrAPIKeyCollectionNotInWorkspace = errors.New("collection does not belong to the workspace")
+	ErrAPIKeyRotated                  = errors.New("api key has already been rotated")
 )
 
+const (
+	// DefaultAPIKeyGracePeriod keeps a rotated key valid long enough for
+	// pipelines to pick up the new secret
+	DefaultAPIKeyGracePeriod = 24 * time.Hour
+	MaxAPIKeyGracePeriod     = 30 * 24 * time.Hour
+	// APIKeyExpiryNoticeWindow is how long before expiry owners are emailed
+	APIKeyExpiryNoticeWindow = 7 * 24 * time.Hour
+
+	DefaultAPIKeyRateLimitPerMinute = 120
+	DefaultAPIKeyRateLimitBurst     = 60
+	MaxAPIKeyRateLimitPerMinute     = 6000
+	MaxAPIKeyRateLimitBurst         = 1000
+
+	// MaxAPIKeyUsageEntries bounds the usage log kept per key
+	MaxAPIKeyUsageEntries = 1000
+	// apiKeyUsageRetention is how long usage entries are kept
+	apiKeyUsageRetention = 30 * 24 * time.Hour
+	// apiKeyRetention is how long expired and revoked keys are kept
+	apiKeyRetention = 30 * 24 * time.Hour
+	// apiKeyUsageQueueSize bounds the usage entries waiting to be written;
+	// entries beyond it are dropped rather than slowing requests down
+	apiKeyUsageQueueSize = 1000
+)
+
+// APIKeyRotation is the result of rotating a key: the new key with its plain
+// secret, and the previous key with its shortened expiry.
+type APIKeyRotation struct {
+	Key      *models.WorkspaceAPIKey
+	PlainKey string
+	Previous *models.WorkspaceAPIKey
+}
+
+// APIKeyExpiryNotice is one owner to notify about an expiring key.
+type APIKeyExpiryNotice struct {
+	KeyID         uuid.UUID
+	KeyName       string
+	KeyPrefix     string
+	WorkspaceName string
+	OwnerEmail    string
+	ExpiresAt     time.Time
+}
+
+// APIKeyExpiryMailer sends expiry notices; implemented by EmailService.
+type APIKeyExpiryMailer interface {
+	SendAPIKeyExpiring(to, workspaceName, keyName, keyPrefix string, expiresAt time.Time) error
+}
+
+// APIKeyRestrictions limit what an API key can do. Empty CollectionIDs and
+// AllowedCIDRs leave the key unrestricted.
+type APIKeyRestrictions struct {
+	Scopes        []string
+	CollectionIDs []uuid.UUID
+	AllowedCIDRs  []string
+	// Zero rate limit values select the defaults
+	RateLimitPerMinute int
+	RateLimitBurst     int
+}
+
+// apiKeyColumns is the column list scanned by scanAPIKey.
+const apiKeyColumns = `id, workspace_id, name, key_hash, key_prefix, created_by, expires_at, revoked_at, last_used_at, created_at,
+	scopes, collection_ids, allowed_cidrs, replaced_by, rate_limit_per_minute, rate_limit_burst`
+
+type apiKeyRow interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row apiKeyRow, k *models.WorkspaceAPIKey) error {
+	return row.Scan(
+		&k.ID, &k.WorkspaceID, &k.Name, &k.KeyHash, &k.KeyPrefix,
+		&k.CreatedBy, &k.ExpiresAt, &k.RevokedAt, &k.LastUsedAt, &k.CreatedAt,
+		&k.Scopes, &k.CollectionIDs, &k.AllowedCIDRs, &k.ReplacedBy, &k.RateLimitPerMinute, &k.RateLimitBurst,
+	)
+}
+
+// NormalizeAPIKeyScopes validates scopes and removes duplicates. No scopes
+// selects the default scopes.
+func NormalizeAPIKeyScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return slices.Clone(models.DefaultAPIKeyScopes), nil
+	}
+
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(models.APIKeyScopes, scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidAPIKeyScope, scope)
+		}
+		if !slices.Contains(normalized, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+// NormalizeAPIKeyCIDRs validates an IP allowlist. Bare addresses are accepted
+// as single-host prefixes.
+func NormalizeAPIKeyCIDRs(cidrs []string) ([]string, error) {
+	normalized := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(cidr)
+			if addrErr != nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidAPIKeyCIDR, cidr)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		value := prefix.Masked().String()
+		if !slices.Contains(normalized, value) {
+			normalized = append(normalized, value)
+		}
+	}
+	return normalized, nil
+}
+
+// APIKeyAllowsIP reports whether key can be used from addr.
+func APIKeyAllowsIP(key *models.WorkspaceAPIKey, addr netip.Addr) bool {
+	if len(key.AllowedCIDRs) == 0 {
+		return true
+	}
+	addr = addr.Unmap()
+	for _, cidr := range key.AllowedCIDRs {
+		if prefix, err := netip.ParsePrefix(cidr); err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyHasScope reports whether key was granted scope.
+func APIKeyHasScope(key *models.WorkspaceAPIKey, scope string) bool {
+	return slices.Contains(key.Scopes, scope)
+}
+
+// APIKeyAllowsCollection reports whether key can access the collection.
+func APIKeyAllowsCollection(key *models.WorkspaceAPIKey, collectionID uuid.UUID) bool {
+	return len(key.CollectionIDs) == 0 || slices.Contains(key.CollectionIDs, collectionID)
+}
+
 const (
 	apiKeyPrefix    = "nik_"
 	apiKeyRandomLen = 32
 )
 
 type APIKeyService struct {
-	db *database.DB
+	db         *database.DB
+	limiter    *TokenBucketLimiter
+	usageQueue chan models.APIKeyUsage
 }
 
 func NewAPIKeyService(db *database.DB) *APIKeyService {
-	return &APIKeyService{db: db}
+	return &APIKeyService{
+		db:         db,
+		limiter:    NewTokenBucketLimiter(),
+		usageQueue: make(chan models.APIKeyUsage, apiKeyUsageQueueSize),
+	}
 }
 
 // GenerateAPIKey generates a new API key with the format: nik_<workspace_prefix_8chars>_<32_random_bytes_base62>
@@ -55,20 +210,54 @@ func (s *APIKeyService) GenerateAPIKey(workspaceID uuid.UUID) (plainKey, keyHash
 	return plainKey, keyHash, keyPrefix
 }
 
-// Create creates a new API key for a workspace
-func (s *APIKeyService) Create(ctx context.Context, workspaceID uuid.UUID, name string, createdBy uuid.UUID, expiresAt *time.Time) (*models.WorkspaceAPIKey, string, error) {
+// Create creates a new API key for a workspace. The restrictions are
+// expected to be normalized; collection IDs must belong to the workspace.
+func (s *APIKeyService) Create(ctx context.Context, workspaceID uuid.UUID, name string, createdBy uuid.UUID, expiresAt *time.Time, restrictions APIKeyRestrictions) (*models.WorkspaceAPIKey, string, error) {
+	scopes := restrictions.Scopes
+	if len(scopes) == 0 {
+		scopes = models.DefaultAPIKeyScopes
+	}
+	collectionIDs := restrictions.CollectionIDs
+	if collectionIDs == nil {
+		collectionIDs = []uuid.UUID{}
+	}
+	allowedCIDRs := restrictions.AllowedCIDRs
+	if allowedCIDRs == nil {
+		allowedCIDRs = []string{}
+	}
+	rateLimitPerMinute := restrictions.RateLimitPerMinute
+	if rateLimitPerMinute == 0 {
+		rateLimitPerMinute = DefaultAPIKeyRateLimitPerMinute
+	}
+	rateLimitBurst := restrictions.RateLimitBurst
+	if rateLimitBurst == 0 {
+		rateLimitBurst = DefaultAPIKeyRateLimitBurst
+	}
+
+	if len(collectionIDs) > 0 {
+		var count int
+		err := s.db.Pool.QueryRow(ctx, `
+			SELECT COUNT(*) FROM collections WHERE workspace_id = $1 AND id = ANY($2)
+		`, workspaceID, collectionIDs).Scan(&count)
+		if err != nil {
+			return nil, "", err
+		}
+		if count != len(collectionIDs) {
+			return nil, "", ErrAPIKeyCollectionNotInWorkspace
+		}
+	}
+
 	plainKey, keyHash, keyPrefix := s.GenerateAPIKey(workspaceID)
 
 	var apiKey models.WorkspaceAPIKey
-	err := s.db.Pool.QueryRow(ctx, `
-		INSERT INTO workspace_api_keys (workspace_id, name, key_hash, key_prefix, created_by, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, workspace_id, name, key_hash, key_prefix, created_by, expires_at, revoked_at, last_used_at, created_at
-	`, workspaceID, name, keyHash, keyPrefix, createdBy, expiresAt).Scan(
-		&apiKey.ID, &apiKey.WorkspaceID, &apiKey.Name, &apiKey.KeyHash,
-		&apiKey.KeyPrefix, &apiKey.CreatedBy, &apiKey.ExpiresAt,
-		&apiKey.RevokedAt, &apiKey.LastUsedAt, &apiKey.CreatedAt,
-	)
+	err := scanAPIKey(s.db.Pool.QueryRow(ctx, `
+		INSERT INTO workspace_api_keys (workspace_id, name, key_hash, key_prefix, created_by, expires_at, scopes, collection_ids, allowed_cidrs,
+			rate_limit_per_minute, rate_limit_burst)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+apiKeyColumns,
+		workspaceID, name, keyHash, keyPrefix, createdBy, expiresAt, scopes, collectionIDs, allowedCIDRs,
+		rateLimitPerMinute, rateLimitBurst,
+	), &apiKey)
 	if err != nil {
 		return nil, "", err
 	}
@@ -76,30 +265,30 @@ func (s *APIKeyService) Create(ctx context.Context, workspaceID uuid.UUID, name
 	return &apiKey, plainKey, nil
 }
 
-// ValidateAndGetWorkspace validates an API key and returns the workspace ID
-func (s *APIKeyService) ValidateAndGetWorkspace(ctx context.Context, key string) (uuid.UUID, error) {
+// Authenticate validates an API key and returns it with its restrictions
+func (s *APIKeyService) Authenticate(ctx context.Context, key string) (*models.WorkspaceAPIKey, error) {
 	// Hash the provided key
 	hash := sha256.Sum256([]byte(key))
 	keyHash := hex.EncodeToString(hash[:])
 
 	var apiKey models.WorkspaceAPIKey
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, workspace_id, expires_at, revoked_at
+	err := scanAPIKey(s.db.Pool.QueryRow(ctx, `
+		SELECT `+apiKeyColumns+`
 		FROM workspace_api_keys
 		WHERE key_hash = $1
-	`, keyHash).Scan(&apiKey.ID, &apiKey.WorkspaceID, &apiKey.ExpiresAt, &apiKey.RevokedAt)
+	`, keyHash), &apiKey)
 	if err != nil {
-		return uuid.Nil, ErrAPIKeyInvalid
+		return nil, ErrAPIKeyInvalid
 	}
 
 	// Check if revoked
 	if apiKey.RevokedAt != nil {
-		return uuid.Nil, ErrAPIKeyRevoked
+		return nil, ErrAPIKeyRevoked
 	}
 
 	// Check if expired
 	if apiKey.ExpiresAt != nil && apiKey.ExpiresAt.Before(time.Now()) {
-		return uuid.Nil, ErrAPIKeyExpired
+		return nil, ErrAPIKeyExpired
 	}
 
 	// Update last_used_at asynchronously
@@ -109,13 +298,13 @@ func (s *APIKeyService) ValidateAndGetWorkspace(ctx context.Context, key string)
 		`, apiKey.ID)
 	}()
 
-	return apiKey.WorkspaceID, nil
+	return &apiKey, nil
 }
 
 // List returns all API keys for a workspace (excluding revoked ones by default)
 func (s *APIKeyService) List(ctx context.Context, workspaceID uuid.UUID) ([]models.WorkspaceAPIKey, error) {
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, workspace_id, name, key_hash, key_prefix, created_by, expires_at, revoked_at, last_used_at, created_at
+		SELECT `+apiKeyColumns+`
 		FROM workspace_api_keys
 		WHERE workspace_id = $1 AND revoked_at IS NULL
 		ORDER BY created_at DESC
@@ -128,10 +317,7 @@ func (s *APIKeyService) List(ctx context.Context, workspaceID uuid.UUID) ([]mode
 	var keys []models.WorkspaceAPIKey
 	for rows.Next() {
 		var k models.WorkspaceAPIKey
-		if err := rows.Scan(
-			&k.ID, &k.WorkspaceID, &k.Name, &k.KeyHash, &k.KeyPrefix,
-			&k.CreatedBy, &k.ExpiresAt, &k.RevokedAt, &k.LastUsedAt, &k.CreatedAt,
-		); err != nil {
+		if err := scanAPIKey(rows, &k); err != nil {
 			return nil, err
 		}
 		keys = append(keys, k)
@@ -155,11 +341,265 @@ func (s *APIKeyService) Revoke(ctx context.Context, keyID, workspaceID uuid.UUID
 	return nil
 }
 
-// CleanupExpired removes expired API keys (can be called periodically)
+// Get returns an API key of the workspace, including rotated and revoked keys
+func (s *APIKeyService) Get(ctx context.Context, keyID, workspaceID uuid.UUID) (*models.WorkspaceAPIKey, error) {
+	var apiKey models.WorkspaceAPIKey
+	err := scanAPIKey(s.db.Pool.QueryRow(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM workspace_api_keys
+		WHERE id = $1 AND workspace_id = $2
+	`, keyID, workspaceID), &apiKey)
+	if err != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &apiKey, nil
+}
+
+// UpdateRateLimit changes the token bucket of an API key
+func (s *APIKeyService) UpdateRateLimit(ctx context.Context, keyID, workspaceID uuid.UUID, perMinute, burst int) (*models.WorkspaceAPIKey, error) {
+	var apiKey models.WorkspaceAPIKey
+	err := scanAPIKey(s.db.Pool.QueryRow(ctx, `
+		UPDATE workspace_api_keys
+		SET rate_limit_per_minute = $3, rate_limit_burst = $4
+		WHERE id = $1 AND workspace_id = $2 AND revoked_at IS NULL
+		RETURNING `+apiKeyColumns,
+		keyID, workspaceID, perMinute, burst,
+	), &apiKey)
+	if err != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &apiKey, nil
+}
+
+// Allow applies the key's rate limit to a request. When the limit is
+// exceeded it returns false and how long the client should wait. The bucket
+// lives in this instance, so the limit applies per instance.
+func (s *APIKeyService) Allow(key *models.WorkspaceAPIKey) (bool, time.Duration) {
+	return s.limiter.Allow(key.ID, key.RateLimitPerMinute, key.RateLimitBurst)
+}
+
+// LogUsage queues a request made with an API key for RunUsageLog to write.
+// It never blocks; when the queue is full the entry is dropped.
+func (s *APIKeyService) LogUsage(usage models.APIKeyUsage) {
+	select {
+	case s.usageQueue <- usage:
+	default:
+	}
+}
+
+// RunUsageLog writes queued usage entries one at a time.
+func (s *APIKeyService) RunUsageLog() {
+	for usage := range s.usageQueue {
+		_ = s.RecordUsage(context.Background(), usage)
+	}
+}
+
+// RecordUsage logs a request made with an API key
+func (s *APIKeyService) RecordUsage(ctx context.Context, usage models.APIKeyUsage) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO api_key_usage (api_key_id, method, path, status, ip, latency_ms)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, usage.APIKeyID, usage.Method, usage.Path, usage.Status, usage.IP, usage.LatencyMs)
+	return err
+}
+
+// Usage returns the most recent requests made with an API key, newest first
+func (s *APIKeyService) Usage(ctx context.Context, keyID uuid.UUID, limit int) ([]models.APIKeyUsage, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, api_key_id, method, path, status, ip, latency_ms, created_at
+		FROM api_key_usage
+		WHERE api_key_id = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, keyID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []models.APIKeyUsage{}
+	for rows.Next() {
+		var u models.APIKeyUsage
+		if err := rows.Scan(&u.ID, &u.APIKeyID, &u.Method, &u.Path, &u.Status, &u.IP, &u.LatencyMs, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// CleanupUsage removes usage entries past the retention period and keeps
+// only the most recent entries per key
+func (s *APIKeyService) CleanupUsage(ctx context.Context) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		DELETE FROM api_key_usage WHERE created_at < NOW() - $1 * INTERVAL '1 second'
+	`, apiKeyUsageRetention.Seconds())
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Pool.Exec(ctx, `
+		DELETE FROM api_key_usage
+		WHERE id IN (
+			SELECT id FROM (
+				SELECT id, ROW_NUMBER() OVER (PARTITION BY api_key_id ORDER BY id DESC) AS position
+				FROM api_key_usage
+			) ranked
+			WHERE position > $1
+		)
+	`, MaxAPIKeyUsageEntries)
+	return err
+}
+
+// Rotate issues a new key with the same name and restrictions as keyID and
+// keeps the old key valid for gracePeriod. A zero grace period revokes the
+// old key immediately. When the old key expires, the new key gets the same
+// lifetime starting now.
+func (s *APIKeyService) Rotate(ctx context.Context, keyID, workspaceID, rotatedBy uuid.UUID, gracePeriod time.Duration) (*APIKeyRotation, error) {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var previous models.WorkspaceAPIKey
+	err = scanAPIKey(tx.QueryRow(ctx, `
+		SELECT `+apiKeyColumns+`
+		FROM workspace_api_keys
+		WHERE id = $1 AND workspace_id = $2 AND revoked_at IS NULL
+		FOR UPDATE
+	`, keyID, workspaceID), &previous)
+	if err != nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	if previous.ReplacedBy != nil {
+		return nil, ErrAPIKeyRotated
+	}
+
+	var expiresAt *time.Time
+	if previous.ExpiresAt != nil {
+		renewed := time.Now().Add(previous.ExpiresAt.Sub(previous.CreatedAt))
+		expiresAt = &renewed
+	}
+
+	plainKey, keyHash, keyPrefix := s.GenerateAPIKey(workspaceID)
+
+	var key models.WorkspaceAPIKey
+	err = scanAPIKey(tx.QueryRow(ctx, `
+		INSERT INTO workspace_api_keys (workspace_id, name, key_hash, key_prefix, created_by, expires_at, scopes, collection_ids, allowed_cidrs,
+			rate_limit_per_minute, rate_limit_burst)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING `+apiKeyColumns,
+		workspaceID, previous.Name, keyHash, keyPrefix, rotatedBy, expiresAt,
+		previous.Scopes, previous.CollectionIDs, previous.AllowedCIDRs,
+		previous.RateLimitPerMinute, previous.RateLimitBurst,
+	), &key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	if gracePeriod <= 0 {
+		err = scanAPIKey(tx.QueryRow(ctx, `
+			UPDATE workspace_api_keys
+			SET revoked_at = NOW(), replaced_by = $2
+			WHERE id = $1
+			RETURNING `+apiKeyColumns,
+			keyID, key.ID,
+		), &previous)
+	} else {
+		err = scanAPIKey(tx.QueryRow(ctx, `
+			UPDATE workspace_api_keys
+			SET expires_at = LEAST(COALESCE(expires_at, 'infinity'), NOW() + $3 * INTERVAL '1 second'), replaced_by = $2
+			WHERE id = $1
+			RETURNING `+apiKeyColumns,
+			keyID, key.ID, gracePeriod.Seconds(),
+		), &previous)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update rotated api key: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &APIKeyRotation{Key: &key, PlainKey: plainKey, Previous: &previous}, nil
+}
+
+// ExpiringKeys returns one notice per owner of each key expiring within the
+// window. Rotated keys and keys whose owners were already notified are
+// skipped.
+func (s *APIKeyService) ExpiringKeys(ctx context.Context, within time.Duration) ([]APIKeyExpiryNotice, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT k.id, k.name, k.key_prefix, w.name, u.email, k.expires_at
+		FROM workspace_api_keys k
+		JOIN workspaces w ON w.id = k.workspace_id
+		JOIN workspace_members wm ON wm.workspace_id = k.workspace_id AND wm.role = $2
+		JOIN users u ON u.id = wm.user_id
+		WHERE k.revoked_at IS NULL
+		  AND k.replaced_by IS NULL
+		  AND k.expiry_notified_at IS NULL
+		  AND k.expires_at > NOW()
+		  AND k.expires_at <= NOW() + $1 * INTERVAL '1 second'
+		ORDER BY k.expires_at
+	`, within.Seconds(), models.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notices []APIKeyExpiryNotice
+	for rows.Next() {
+		var n APIKeyExpiryNotice
+		if err := rows.Scan(&n.KeyID, &n.KeyName, &n.KeyPrefix, &n.WorkspaceName, &n.OwnerEmail, &n.ExpiresAt); err != nil {
+			return nil, err
+		}
+		notices = append(notices, n)
+	}
+	return notices, rows.Err()
+}
+
+// SendExpiryNotices emails workspace owners about keys expiring within the
+// notice window. A key is marked as notified once all of its owners were
+// emailed, so failed sends are retried on the next run.
+func (s *APIKeyService) SendExpiryNotices(ctx context.Context, mailer APIKeyExpiryMailer) error {
+	notices, err := s.ExpiringKeys(ctx, APIKeyExpiryNoticeWindow)
+	if err != nil {
+		return err
+	}
+
+	failed := make(map[uuid.UUID]bool)
+	var keyIDs []uuid.UUID
+	for _, n := range notices {
+		if err := mailer.SendAPIKeyExpiring(n.OwnerEmail, n.WorkspaceName, n.KeyName, n.KeyPrefix, n.ExpiresAt); err != nil {
+			failed[n.KeyID] = true
+		}
+		if !slices.Contains(keyIDs, n.KeyID) {
+			keyIDs = append(keyIDs, n.KeyID)
+		}
+	}
+
+	for _, keyID := range keyIDs {
+		if failed[keyID] {
+			continue
+		}
+		if _, err := s.db.Pool.Exec(ctx, `
+			UPDATE workspace_api_keys SET expiry_notified_at = NOW() WHERE id = $1
+		`, keyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanupExpired removes API keys that expired or were revoked more than
+// apiKeyRetention ago. Until then they stay listed with their last use, so a
+// rotated key's grace period can be checked after it ends.
 func (s *APIKeyService) CleanupExpired(ctx context.Context) error {
 	_, err := s.db.Pool.Exec(ctx, `
 		DELETE FROM workspace_api_keys
-		WHERE expires_at < NOW() OR revoked_at IS NOT NULL AND revoked_at < NOW() - INTERVAL '30 days'
-	`)
+		WHERE expires_at < NOW() - $1 * INTERVAL '1 second'
+			OR revoked_at < NOW() - $1 * INTERVAL '1 second'
+	`, apiKeyRetention.Seconds())
 	return err
 }
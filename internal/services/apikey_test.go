@@ -0,0 +1,303 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAPIKeyService(t *testing.T) (*APIKeyService, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	t.Cleanup(func() { mock.Close() })
+
+	db := &database.DB{Pool: mock}
+	return NewAPIKeyService(db), mock
+}
+
+var apiKeyTestColumns = []string{
+	"id", "workspace_id", "name", "key_hash", "key_prefix", "created_by", "expires_at", "revoked_at", "last_used_at", "created_at",
+	"scopes", "collection_ids", "allowed_cidrs", "replaced_by", "rate_limit_per_minute", "rate_limit_burst",
+}
+
+func TestNormalizeAPIKeyScopes(t *testing.T) {
+	scopes, err := NormalizeAPIKeyScopes(nil)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultAPIKeyScopes, scopes)
+
+	scopes, err = NormalizeAPIKeyScopes([]string{"vault:read-ciphertext", " collections:read", "vault:read-ciphertext"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vault:read-ciphertext", "collections:read"}, scopes)
+
+	_, err = NormalizeAPIKeyScopes([]string{"collections:read", "collections:delete"})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyScope)
+	assert.Contains(t, err.Error(), "collections:delete")
+}
+
+func TestNormalizeAPIKeyCIDRs(t *testing.T) {
+	cidrs, err := NormalizeAPIKeyCIDRs([]string{"10.1.2.3/8", "192.0.2.7", "2001:db8::1/32", "10.0.0.0/8"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.0.2.7/32", "2001:db8::/32"}, cidrs)
+
+	_, err = NormalizeAPIKeyCIDRs([]string{"10.0.0.0/33"})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyCIDR)
+
+	_, err = NormalizeAPIKeyCIDRs([]string{"office"})
+	assert.ErrorIs(t, err, ErrInvalidAPIKeyCIDR)
+}
+
+func TestAPIKeyRestrictionChecks(t *testing.T) {
+	collectionID := uuid.New()
+	key := &models.WorkspaceAPIKey{
+		Scopes:        []string{models.APIKeyScopeCollectionsRead},
+		CollectionIDs: []uuid.UUID{collectionID},
+		AllowedCIDRs:  []string{"10.0.0.0/8", "2001:db8::/32"},
+	}
+
+	assert.True(t, APIKeyHasScope(key, models.APIKeyScopeCollectionsRead))
+	assert.False(t, APIKeyHasScope(key, models.APIKeyScopeCollectionsWrite))
+
+	assert.True(t, APIKeyAllowsCollection(key, collectionID))
+	assert.False(t, APIKeyAllowsCollection(key, uuid.New()))
+	assert.True(t, APIKeyAllowsCollection(&models.WorkspaceAPIKey{}, uuid.New()))
+
+	assert.True(t, APIKeyAllowsIP(key, netip.MustParseAddr("10.20.30.40")))
+	assert.True(t, APIKeyAllowsIP(key, netip.MustParseAddr("::ffff:10.0.0.1")))
+	assert.True(t, APIKeyAllowsIP(key, netip.MustParseAddr("2001:db8::5")))
+	assert.False(t, APIKeyAllowsIP(key, netip.MustParseAddr("192.0.2.1")))
+	assert.True(t, APIKeyAllowsIP(&models.WorkspaceAPIKey{}, netip.MustParseAddr("192.0.2.1")))
+}
+
+func TestAPIKeyService_Create_CollectionOutsideWorkspace(t *testing.T) {
+	svc, mock := setupAPIKeyService(t)
+	workspaceID := uuid.New()
+	collectionIDs := []uuid.UUID{uuid.New(), uuid.New()}
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM collections`).
+		WithArgs(workspaceID, collectionIDs).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(1))
+
+	_, _, err := svc.Create(context.Background(), workspaceID, "CI", uuid.New(), nil, APIKeyRestrictions{CollectionIDs: collectionIDs})
+
+	assert.ErrorIs(t, err, ErrAPIKeyCollectionNotInWorkspace)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyService_Create_DefaultScopes(t *testing.T) {
+	svc, mock := setupAPIKeyService(t)
+	workspaceID := uuid.New()
+	createdBy := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`INSERT INTO workspace_api_keys`).
+		WithArgs(workspaceID, "CI", pgxmock.AnyArg(), pgxmock.AnyArg(), createdBy, (*time.Time)(nil),
+			models.DefaultAPIKeyScopes, []uuid.UUID{}, []string{}, DefaultAPIKeyRateLimitPerMinute, DefaultAPIKeyRateLimitBurst).
+		WillReturnRows(pgxmock.NewRows(apiKeyTestColumns).AddRow(
+			uuid.New(), workspaceID, "CI", "hash", "nik_abc...", createdBy, nil, nil, nil, now,
+			models.DefaultAPIKeyScopes, []uuid.UUID{}, []string{}, nil, 120, 60,
+		))
+
+	apiKey, plainKey, err := svc.Create(context.Background(), workspaceID, "CI", createdBy, nil, APIKeyRestrictions{})
+
+	require.NoError(t, err)
+	assert.Contains(t, plainKey, "nik_")
+	assert.Equal(t, models.DefaultAPIKeyScopes, apiKey.Scopes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyService_Authenticate_Revoked(t *testing.T) {
+	svc, mock := setupAPIKeyService(t)
+	revokedAt := time.Now().Add(-time.Hour)
+
+	mock.ExpectQuery(`SELECT .* FROM workspace_api_keys`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(apiKeyTestColumns).AddRow(
+			uuid.New(), uuid.New(), "CI", "hash", "nik_abc...", uuid.New(), nil, &revokedAt, nil, time.Now(),
+			models.DefaultAPIKeyScopes, []uuid.UUID{}, []string{}, nil, 120, 60,
+		))
+
+	_, err := svc.Authenticate(context.Background(), "nik_abc_123")
+
+	assert.ErrorIs(t, err, ErrAPIKeyRevoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyService_Rotate(t *testing.T) {
+	svc, mock := setupAPIKeyService(t)
+	workspaceID := uuid.New()
+	keyID := uuid.New()
+	newID := uuid.New()
+	rotatedBy := uuid.New()
+	createdAt := time.Now().Add(-10 * 24 * time.Hour)
+	expiresAt := createdAt.Add(90 * 24 * time.Hour)
+	graceEnd := time.Now().Add(time.Hour)
+	scopes := []string{models.APIKeyScopeCollectionsRead}
+	collectionIDs := []uuid.UUID{uuid.New()}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .* FROM workspace_api_keys\s+WHERE id = \$1 AND workspace_id = \$2 AND revoked_at IS NULL\s+FOR UPDATE`).
+		WithArgs(keyID, workspaceID).
+		WillReturnRows(pgxmock.NewRows(apiKeyTestColumns).AddRow(
+			keyID, workspaceID, "CI", "old-hash", "nik_abc...", uuid.New(), &expiresAt, nil, nil, createdAt,
+			scopes, collectionIDs, []string{}, nil, 120, 60,
+		))
+	mock.ExpectQuery(`INSERT INTO workspace_api_keys`).
+		WithArgs(workspaceID, "CI", pgxmock.AnyArg(), pgxmock.AnyArg(), rotatedBy, pgxmock.AnyArg(), scopes, collectionIDs, []string{}, 120, 60).
+		WillReturnRows(pgxmock.NewRows(apiKeyTestColumns).AddRow(
+			newID, workspaceID, "CI", "new-hash", "nik_abc...", rotatedBy, nil, nil, nil, time.Now(),
+			scopes, collectionIDs, []string{}, nil, 120, 60,
+		))
+	mock.ExpectQuery(`UPDATE workspace_api_keys\s+SET expires_at = LEAST`).
+		WithArgs(keyID, newID, float64(3600)).
+		WillReturnRows(pgxmock.NewRows(apiKeyTestColumns).AddRow(
+			keyID, workspaceID, "CI", "old-hash", "nik_abc...", uuid.New(), &graceEnd, nil, nil, createdAt,
+			scopes, collectionIDs, []string{}, &newID, 120, 60,
+		))
+	mock.ExpectCommit()
+
+	rotation, err := svc.Rotate(context.Background(), keyID, workspaceID, rotatedBy, time.Hour)
+
+	require.NoError(t, err)
+	assert.Equal(t, newID, rotation.Key.ID)
+	assert.NotEmpty(t, rotation.PlainKey)
+	assert.Equal(t, &newID, rotation.Previous.ReplacedBy)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyService_Rotate_AlreadyRotated(t *testing.T) {
+	svc, mock := setupAPIKeyService(t)
+	keyID := uuid.New()
+	workspaceID := uuid.New()
+	replacedBy := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT .* FROM workspace_api_keys`).
+		WithArgs(keyID, workspaceID).
+		WillReturnRows(pgxmock.NewRows(apiKeyTestColumns).AddRow(
+			keyID, workspaceID, "CI", "hash", "nik_abc...", uuid.New(), nil, nil, nil, time.Now(),
+			models.DefaultAPIKeyScopes, []uuid.UUID{}, []string{}, &replacedBy, 120, 60,
+		))
+	mock.ExpectRollback()
+
+	_, err := svc.Rotate(context.Background(), keyID, workspaceID, uuid.New(), time.Hour)
+
+	assert.ErrorIs(t, err, ErrAPIKeyRotated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyService_RecordUsage(t *testing.T) {
+	svc, mock := setupAPIKeyService(t)
+	keyID := uuid.New()
+
+	mock.ExpectExec(`INSERT INTO api_key_usage`).
+		WithArgs(keyID, "PUT", "/api/v1/automation/collections", 201, "203.0.113.7", 42).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	err := svc.RecordUsage(context.Background(), models.APIKeyUsage{
+		APIKeyID:  keyID,
+		Method:    "PUT",
+		Path:      "/api/v1/automation/collections",
+		Status:    201,
+		IP:        "203.0.113.7",
+		LatencyMs: 42,
+	})
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyService_LogUsage_DropsWhenFull(t *testing.T) {
+	svc, _ := setupAPIKeyService(t)
+
+	for range apiKeyUsageQueueSize + 10 {
+		svc.LogUsage(models.APIKeyUsage{APIKeyID: uuid.New()})
+	}
+
+	assert.Len(t, svc.usageQueue, apiKeyUsageQueueSize)
+}
+
+func TestAPIKeyService_CleanupUsage(t *testing.T) {
+	svc, mock := setupAPIKeyService(t)
+
+	mock.ExpectExec(`DELETE FROM api_key_usage WHERE created_at <`).
+		WithArgs(apiKeyUsageRetention.Seconds()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+	mock.ExpectExec(`DELETE FROM api_key_usage\s+WHERE id IN .+PARTITION BY api_key_id`).
+		WithArgs(MaxAPIKeyUsageEntries).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	require.NoError(t, svc.CleanupUsage(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyService_CleanupExpired(t *testing.T) {
+	svc, mock := setupAPIKeyService(t)
+
+	// Expired keys are kept for the retention period like revoked ones
+	mock.ExpectExec(`DELETE FROM workspace_api_keys\s+WHERE expires_at < NOW\(\) - .+ OR revoked_at < NOW\(\) - `).
+		WithArgs(apiKeyRetention.Seconds()).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
+
+	require.NoError(t, svc.CleanupExpired(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIKeyService_Allow(t *testing.T) {
+	svc, _ := setupAPIKeyService(t)
+	key := &models.WorkspaceAPIKey{ID: uuid.New(), RateLimitPerMinute: 60, RateLimitBurst: 1}
+
+	ok, _ := svc.Allow(key)
+	assert.True(t, ok)
+
+	ok, retryAfter := svc.Allow(key)
+	assert.False(t, ok)
+	assert.Greater(t, retryAfter, time.Duration(0))
+}
+
+type fakeExpiryMailer struct {
+	sent   []string
+	failTo string
+}
+
+func (f *fakeExpiryMailer) SendAPIKeyExpiring(to, workspaceName, keyName, keyPrefix string, expiresAt time.Time) error {
+	if to == f.failTo {
+		return errors.New("smtp unavailable")
+	}
+	f.sent = append(f.sent, to+": "+keyName)
+	return nil
+}
+
+func TestAPIKeyService_SendExpiryNotices(t *testing.T) {
+	svc, mock := setupAPIKeyService(t)
+	deployKey := uuid.New()
+	ciKey := uuid.New()
+	expiresAt := time.Now().Add(3 * 24 * time.Hour)
+
+	mock.ExpectQuery(`SELECT k.id, k.name, k.key_prefix, w.name, u.email, k.expires_at`).
+		WithArgs(APIKeyExpiryNoticeWindow.Seconds(), models.RoleOwner).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "key_prefix", "workspace", "email", "expires_at"}).
+			AddRow(deployKey, "Deploy", "nik_a...", "Shop", "ada@example.com", expiresAt).
+			AddRow(ciKey, "CI", "nik_b...", "Shop", "ada@example.com", expiresAt).
+			AddRow(ciKey, "CI", "nik_b...", "Shop", "bob@example.com", expiresAt))
+	// CI stays unmarked because one of its owners could not be emailed
+	mock.ExpectExec(`UPDATE workspace_api_keys SET expiry_notified_at = NOW\(\)`).
+		WithArgs(deployKey).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	mailer := &fakeExpiryMailer{failTo: "bob@example.com"}
+	err := svc.SendExpiryNotices(context.Background(), mailer)
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ada@example.com: Deploy", "ada@example.com: CI"}, mailer.sent)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,700 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v3"
+)
+
+// AsyncAPIService converts AsyncAPI 2.x and 3.x documents into Nikode
+// collections with one websocket item per channel.
+type AsyncAPIService struct {
+	openapi *OpenAPIService
+}
+
+func NewAsyncAPIService() *AsyncAPIService {
+	return &AsyncAPIService{openapi: NewOpenAPIService()}
+}
+
+// asyncAPIDocument is a parsed AsyncAPI document. The spec is kept as generic
+// JSON-compatible values since 2.x and 3.x differ substantially in layout.
+type asyncAPIDocument struct {
+	raw          map[string]any
+	majorVersion int
+}
+
+// asyncChannel is a channel with its messages split by direction, seen from
+// the client connecting to it.
+type asyncChannel struct {
+	key         string
+	address     string
+	title       string
+	description string
+	tag         string
+	bindings    map[string]any
+	sends       []asyncMessage
+	receives    []asyncMessage
+}
+
+type asyncMessage struct {
+	key     string
+	message map[string]any
+}
+
+// ParseAsyncAPI parses AsyncAPI content (JSON or YAML) and returns the document
+func (s *AsyncAPIService) ParseAsyncAPI(content []byte) (any, error) {
+	var data any
+	if err := yaml.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse AsyncAPI spec: %w", err)
+	}
+
+	raw, ok := normalizeYAML(data).(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("failed to parse AsyncAPI spec: document is not an object")
+	}
+
+	version, _ := raw["asyncapi"].(string)
+	if version == "" {
+		return nil, fmt.Errorf("missing asyncapi version field")
+	}
+	major, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+	if err != nil || (major != 2 && major != 3) {
+		return nil, fmt.Errorf("unsupported AsyncAPI version %q, expected 2.x or 3.x", version)
+	}
+
+	return &asyncAPIDocument{raw: raw, majorVersion: major}, nil
+}
+
+// ConvertToNikode converts an AsyncAPI document to Nikode collection format
+func (s *AsyncAPIService) ConvertToNikode(specInterface any) (json.RawMessage, error) {
+	doc, ok := specInterface.(*asyncAPIDocument)
+	if !ok {
+		return nil, fmt.Errorf("invalid spec type, expected AsyncAPI document")
+	}
+
+	info := asMap(doc.raw["info"])
+	collection := NikodeCollection{
+		Name:         stringOr(info["title"], "Imported API"),
+		Version:      stringOr(info["version"], "1.0.0"),
+		Environments: s.openapi.createEnvironments(s.servers(doc), "ws://localhost:3000"),
+	}
+	collection.ActiveEnvironmentID = collection.Environments[0].ID
+
+	var channels []asyncChannel
+	if doc.majorVersion == 2 {
+		channels = s.channelsV2(doc)
+	} else {
+		channels = s.channelsV3(doc)
+	}
+	collection.Items = s.buildItems(doc, channels)
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// servers maps the document's servers onto OpenAPI server entries so the
+// environment naming rules are shared with OpenAPI imports. Only servers a
+// websocket client can reach (ws, wss, http, https) are kept.
+func (s *AsyncAPIService) servers(doc *asyncAPIDocument) openapi3.Servers {
+	serverMap := asMap(doc.raw["servers"])
+	names := sortedKeys(serverMap)
+
+	var servers openapi3.Servers
+	for _, name := range names {
+		server := asMap(doc.resolve(serverMap[name]))
+
+		scheme := websocketScheme(stringOr(server["protocol"], ""))
+		if scheme == "" {
+			continue
+		}
+
+		var address string
+		if doc.majorVersion == 2 {
+			address = stringOr(server["url"], "")
+		} else {
+			address = stringOr(server["host"], "") + stringOr(server["pathname"], "")
+		}
+		if address == "" {
+			continue
+		}
+		if i := strings.Index(address, "://"); i >= 0 {
+			address = address[i+3:]
+		}
+		address = strings.TrimSuffix(address, "/")
+
+		variables := make(map[string]*openapi3.ServerVariable)
+		for varName, v := range asMap(server["variables"]) {
+			variable := asMap(doc.resolve(v))
+			sv := &openapi3.ServerVariable{
+				Default:     stringOr(variable["default"], ""),
+				Description: stringOr(variable["description"], ""),
+			}
+			for _, e := range asSlice(variable["enum"]) {
+				sv.Enum = append(sv.Enum, fmt.Sprintf("%v", e))
+			}
+			variables[varName] = sv
+		}
+
+		description := stringOr(server["title"], stringOr(server["description"], ""))
+		if description == "" && len(names) > 1 {
+			description = name
+		}
+
+		servers = append(servers, &openapi3.Server{
+			URL:         scheme + "://" + address,
+			Description: description,
+			Variables:   variables,
+		})
+	}
+
+	return servers
+}
+
+func websocketScheme(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "ws", "http":
+		return "ws"
+	case "wss", "https":
+		return "wss"
+	}
+	return ""
+}
+
+// channelsV2 reads AsyncAPI 2.x channels. A "publish" operation describes
+// messages the client sends and "subscribe" messages it receives.
+func (s *AsyncAPIService) channelsV2(doc *asyncAPIDocument) []asyncChannel {
+	channelMap := asMap(doc.raw["channels"])
+
+	var channels []asyncChannel
+	for _, key := range sortedKeys(channelMap) {
+		channel := asMap(doc.resolve(channelMap[key]))
+		publish := asMap(doc.resolve(channel["publish"]))
+		subscribe := asMap(doc.resolve(channel["subscribe"]))
+
+		description := stringOr(channel["description"], "")
+		if description == "" {
+			description = stringOr(publish["description"], stringOr(subscribe["description"], ""))
+		}
+
+		tag := firstTagName(doc, publish)
+		if tag == "" {
+			tag = firstTagName(doc, subscribe)
+		}
+
+		channels = append(channels, asyncChannel{
+			key:         key,
+			address:     key,
+			title:       stringOr(publish["summary"], stringOr(subscribe["summary"], "")),
+			description: description,
+			tag:         tag,
+			bindings:    asMap(asMap(channel["bindings"])["ws"]),
+			sends:       s.operationMessagesV2(doc, publish),
+			receives:    s.operationMessagesV2(doc, subscribe),
+		})
+	}
+
+	return channels
+}
+
+func (s *AsyncAPIService) operationMessagesV2(doc *asyncAPIDocument, operation map[string]any) []asyncMessage {
+	message := asMap(doc.resolve(operation["message"]))
+	if message == nil {
+		return nil
+	}
+
+	if oneOf := asSlice(message["oneOf"]); len(oneOf) > 0 {
+		var messages []asyncMessage
+		for i, m := range oneOf {
+			resolved := asMap(doc.resolve(m))
+			if resolved != nil {
+				messages = append(messages, asyncMessage{key: refName(m, fmt.Sprintf("Message %d", i+1)), message: resolved})
+			}
+		}
+		return messages
+	}
+
+	return []asyncMessage{{key: refName(operation["message"], "Message"), message: message}}
+}
+
+// channelsV3 reads AsyncAPI 3.x channels and operations. An operation with
+// action "receive" means the application receives, so the client sends those
+// messages; "send" operations are what the client receives. Channels without
+// any operation offer all their messages for sending.
+func (s *AsyncAPIService) channelsV3(doc *asyncAPIDocument) []asyncChannel {
+	channelMap := asMap(doc.raw["channels"])
+	keys := sortedKeys(channelMap)
+
+	channels := make([]asyncChannel, 0, len(keys))
+	index := make(map[string]int, len(keys))
+	for _, key := range keys {
+		channel := asMap(doc.resolve(channelMap[key]))
+		address := key
+		if a, ok := channel["address"].(string); ok {
+			address = a
+		} else if _, present := channel["address"]; present {
+			// A null address means the channel address is not known upfront
+			address = ""
+		}
+
+		index[key] = len(channels)
+		channels = append(channels, asyncChannel{
+			key:         key,
+			address:     address,
+			title:       stringOr(channel["title"], ""),
+			description: stringOr(channel["description"], stringOr(channel["summary"], "")),
+			bindings:    asMap(asMap(channel["bindings"])["ws"]),
+		})
+	}
+
+	operationMap := asMap(doc.raw["operations"])
+	withOperations := make(map[string]bool)
+	for _, opKey := range sortedKeys(operationMap) {
+		operation := asMap(doc.resolve(operationMap[opKey]))
+		channelKey := channelKeyFromRef(asMap(operation["channel"]))
+		i, ok := index[channelKey]
+		if !ok {
+			continue
+		}
+		withOperations[channelKey] = true
+
+		var messages []asyncMessage
+		for _, ref := range asSlice(operation["messages"]) {
+			if resolved := asMap(doc.resolve(ref)); resolved != nil {
+				messages = append(messages, asyncMessage{key: refName(ref, "Message"), message: resolved})
+			}
+		}
+		if len(asSlice(operation["messages"])) == 0 {
+			messages = s.channelMessagesV3(doc, channelMap[channelKey])
+		}
+
+		channel := &channels[i]
+		switch operation["action"] {
+		case "receive":
+			channel.sends = append(channel.sends, messages...)
+		case "send":
+			channel.receives = append(channel.receives, messages...)
+		}
+		if channel.tag == "" {
+			channel.tag = firstTagName(doc, operation)
+		}
+		if channel.title == "" {
+			channel.title = stringOr(operation["title"], stringOr(operation["summary"], ""))
+		}
+		if channel.description == "" {
+			channel.description = stringOr(operation["description"], "")
+		}
+	}
+
+	for i := range channels {
+		if !withOperations[channels[i].key] {
+			channels[i].sends = s.channelMessagesV3(doc, channelMap[channels[i].key])
+		}
+	}
+
+	return channels
+}
+
+func (s *AsyncAPIService) channelMessagesV3(doc *asyncAPIDocument, channelRef any) []asyncMessage {
+	messageMap := asMap(asMap(doc.resolve(channelRef))["messages"])
+
+	var messages []asyncMessage
+	for _, key := range sortedKeys(messageMap) {
+		if resolved := asMap(doc.resolve(messageMap[key])); resolved != nil {
+			messages = append(messages, asyncMessage{key: key, message: resolved})
+		}
+	}
+	return messages
+}
+
+// buildItems creates one websocket item per channel, grouped into folders by
+// the first operation tag like OpenAPI imports.
+func (s *AsyncAPIService) buildItems(doc *asyncAPIDocument, channels []asyncChannel) []CollectionItem {
+	tagFolders := make(map[string]*CollectionItem)
+	var tagOrder []string
+	var rootItems []CollectionItem
+
+	for _, channel := range channels {
+		item := s.convertChannel(doc, channel)
+		if channel.tag == "" {
+			rootItems = append(rootItems, item)
+			continue
+		}
+
+		folder, exists := tagFolders[channel.tag]
+		if !exists {
+			folder = &CollectionItem{
+				ID:    s.openapi.generateID("folder", channel.tag),
+				Type:  "folder",
+				Name:  channel.tag,
+				Items: []CollectionItem{},
+			}
+			tagFolders[channel.tag] = folder
+			tagOrder = append(tagOrder, channel.tag)
+		}
+		folder.Items = append(folder.Items, item)
+	}
+
+	items := []CollectionItem{}
+	for _, tag := range tagOrder {
+		items = append(items, *tagFolders[tag])
+	}
+	items = append(items, rootItems...)
+
+	return items
+}
+
+func (s *AsyncAPIService) convertChannel(doc *asyncAPIDocument, channel asyncChannel) CollectionItem {
+	address := channel.address
+	if address != "" && !strings.HasPrefix(address, "/") {
+		address = "/" + address
+	}
+
+	name := channel.title
+	if name == "" {
+		name = channel.key
+	}
+
+	item := CollectionItem{
+		ID:          s.openapi.generateID("ws", channel.key),
+		Type:        "websocket",
+		Name:        name,
+		URL:         "{{baseUrl}}" + s.openapi.convertPathParams(address),
+		Params:      s.bindingEntries(doc, channel.bindings["query"]),
+		Headers:     s.bindingEntries(doc, channel.bindings["headers"]),
+		WsProtocols: []string{},
+		Docs:        s.buildDocs(doc, channel),
+	}
+
+	for _, m := range channel.sends {
+		item.WsSavedMessages = append(item.WsSavedMessages, s.savedMessages(doc, m)...)
+	}
+
+	return item
+}
+
+// bindingEntries turns a websocket binding query or headers schema into
+// key/value pairs using the example generator.
+func (s *AsyncAPIService) bindingEntries(doc *asyncAPIDocument, schemaNode any) []KeyValue {
+	schema := doc.schema(schemaNode)
+	if schema == nil {
+		return nil
+	}
+
+	example, _ := newExampleGenerator(exampleModeRequest).generate(schema, 0).(map[string]any)
+
+	var entries []KeyValue
+	for _, key := range sortedKeys(example) {
+		entries = append(entries, KeyValue{
+			Key:     key,
+			Value:   s.openapi.formatExampleValue(example[key]),
+			Enabled: true,
+		})
+	}
+	return entries
+}
+
+// savedMessages returns one saved message per message example, or a single
+// message generated from the payload schema when there are no examples.
+func (s *AsyncAPIService) savedMessages(doc *asyncAPIDocument, m asyncMessage) []WebSocketSavedMessage {
+	name := stringOr(m.message["title"], stringOr(m.message["name"], m.key))
+
+	var saved []WebSocketSavedMessage
+	for i, e := range asSlice(m.message["examples"]) {
+		example := asMap(e)
+		payload, ok := example["payload"]
+		if !ok {
+			continue
+		}
+		exampleName := name
+		if label := stringOr(example["name"], stringOr(example["summary"], "")); label != "" {
+			exampleName = name + " - " + label
+		} else if i > 0 {
+			exampleName = fmt.Sprintf("%s %d", name, i+1)
+		}
+		saved = append(saved, WebSocketSavedMessage{
+			ID:      s.openapi.generateID("msg", exampleName),
+			Name:    exampleName,
+			Type:    "text",
+			Content: messageContent(payload),
+		})
+	}
+	if len(saved) > 0 {
+		return saved
+	}
+
+	return []WebSocketSavedMessage{{
+		ID:      s.openapi.generateID("msg", name),
+		Name:    name,
+		Type:    "text",
+		Content: messageContent(s.payloadExample(doc, m.message)),
+	}}
+}
+
+func (s *AsyncAPIService) payloadExample(doc *asyncAPIDocument, message map[string]any) any {
+	payload := message["payload"]
+	// 3.x multi-format schema objects wrap the schema
+	if wrapped := asMap(payload); wrapped != nil {
+		if inner, ok := wrapped["schema"]; ok && wrapped["schemaFormat"] != nil {
+			format := strings.ToLower(stringOr(wrapped["schemaFormat"], ""))
+			if !strings.Contains(format, "asyncapi") && !strings.Contains(format, "json") {
+				return nil
+			}
+			payload = inner
+		}
+	}
+
+	schema := doc.schema(payload)
+	if schema == nil {
+		return nil
+	}
+	return newExampleGenerator(exampleModeRequest).generate(schema, 0)
+}
+
+func messageContent(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// buildDocs returns the channel description followed by the messages the
+// client can expect to receive on it.
+func (s *AsyncAPIService) buildDocs(doc *asyncAPIDocument, channel asyncChannel) string {
+	docs := channel.description
+	if len(channel.receives) == 0 {
+		return docs
+	}
+
+	var b strings.Builder
+	for _, m := range channel.receives {
+		for _, saved := range s.savedMessages(doc, m) {
+			b.WriteString("\n### " + saved.Name + "\n")
+			if summary := stringOr(m.message["summary"], ""); summary != "" {
+				b.WriteString("\n" + summary + "\n")
+			}
+			if saved.Content != "" {
+				b.WriteString("\n```json\n" + saved.Content + "\n```\n")
+			}
+		}
+	}
+
+	if docs != "" {
+		docs += "\n\n"
+	}
+	return docs + "## Received Messages\n" + b.String()
+}
+
+// schema converts a JSON Schema node into an OpenAPI schema for the example
+// generator. Local references are inlined; a reference back to a schema that
+// is already being inlined is replaced by an empty schema of the same type.
+func (d *asyncAPIDocument) schema(node any) *openapi3.Schema {
+	if node == nil {
+		return nil
+	}
+
+	inlined := d.inline(node, make(map[string]bool))
+	data, err := json.Marshal(inlined)
+	if err != nil {
+		return nil
+	}
+
+	var schema openapi3.Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil
+	}
+	return &schema
+}
+
+func (d *asyncAPIDocument) inline(node any, visiting map[string]bool) any {
+	switch v := node.(type) {
+	case map[string]any:
+		if ref, ok := v["$ref"].(string); ok {
+			target := asMap(d.lookup(ref))
+			if target == nil {
+				return map[string]any{}
+			}
+			if visiting[ref] {
+				if t, ok := target["type"]; ok {
+					return map[string]any{"type": t}
+				}
+				return map[string]any{}
+			}
+			visiting[ref] = true
+			defer delete(visiting, ref)
+			return d.inline(target, visiting)
+		}
+
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			out[key] = d.inline(value, visiting)
+		}
+		normalizeJSONSchema(out)
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, value := range v {
+			out[i] = d.inline(value, visiting)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// normalizeJSONSchema rewrites JSON Schema draft 7 keywords that OpenAPI
+// schemas express differently.
+func normalizeJSONSchema(schema map[string]any) {
+	for _, bound := range []string{"Minimum", "Maximum"} {
+		key := "exclusive" + bound
+		if value, ok := schema[key].(float64); ok {
+			schema[strings.ToLower(bound)] = value
+			schema[key] = true
+		} else if value, ok := schema[key].(int); ok {
+			schema[strings.ToLower(bound)] = value
+			schema[key] = true
+		}
+	}
+	if value, ok := schema["const"]; ok {
+		schema["enum"] = []any{value}
+		delete(schema, "const")
+	}
+	if examples := asSlice(schema["examples"]); len(examples) > 0 {
+		if _, ok := schema["example"]; !ok {
+			schema["example"] = examples[0]
+		}
+		delete(schema, "examples")
+	}
+}
+
+// resolve follows a local $ref, if any, and returns the referenced node.
+func (d *asyncAPIDocument) resolve(node any) any {
+	for range maxExampleDepth {
+		ref, ok := asMap(node)["$ref"].(string)
+		if !ok {
+			return node
+		}
+		node = d.lookup(ref)
+	}
+	return node
+}
+
+// lookup evaluates a local JSON pointer reference such as
+// "#/components/messages/chatMessage". External references are not supported.
+func (d *asyncAPIDocument) lookup(ref string) any {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+
+	var node any = d.raw
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		switch v := node.(type) {
+		case map[string]any:
+			node = v[part]
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			node = v[i]
+		default:
+			return nil
+		}
+	}
+	return node
+}
+
+// channelKeyFromRef extracts the channel key from a "#/channels/<key>" reference.
+func channelKeyFromRef(ref map[string]any) string {
+	value, _ := ref["$ref"].(string)
+	if !strings.HasPrefix(value, "#/channels/") {
+		return ""
+	}
+	key := strings.TrimPrefix(value, "#/channels/")
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~1", "/"), "~0", "~")
+}
+
+// refName returns the last segment of a $ref, or fallback for inline nodes.
+func refName(node any, fallback string) string {
+	ref, ok := asMap(node)["$ref"].(string)
+	if !ok {
+		return fallback
+	}
+	name := ref[strings.LastIndex(ref, "/")+1:]
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~1", "/"), "~0", "~")
+}
+
+func firstTagName(doc *asyncAPIDocument, operation map[string]any) string {
+	tags := asSlice(operation["tags"])
+	if len(tags) == 0 {
+		return ""
+	}
+	return stringOr(asMap(doc.resolve(tags[0]))["name"], "")
+}
+
+// normalizeYAML converts map[any]any values produced by the YAML decoder
+// into map[string]any so documents can be re-encoded as JSON.
+func normalizeYAML(node any) any {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = normalizeYAML(value)
+		}
+		return v
+	case map[any]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			out[fmt.Sprintf("%v", key)] = normalizeYAML(value)
+		}
+		return out
+	case []any:
+		for i, value := range v {
+			v[i] = normalizeYAML(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func asMap(node any) map[string]any {
+	m, _ := node.(map[string]any)
+	return m
+}
+
+func asSlice(node any) []any {
+	s, _ := node.([]any)
+	return s
+}
+
+func stringOr(node any, fallback string) string {
+	if s, ok := node.(string); ok && s != "" {
+		return s
+	}
+	return fallback
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func convertAsyncAPITestSpec(t *testing.T, spec string) NikodeCollection {
+	t.Helper()
+	svc := NewAsyncAPIService()
+
+	parsed, err := svc.ParseAsyncAPI([]byte(spec))
+	require.NoError(t, err)
+
+	data, err := svc.ConvertToNikode(parsed)
+	require.NoError(t, err)
+
+	var collection NikodeCollection
+	require.NoError(t, json.Unmarshal(data, &collection))
+	return collection
+}
+
+func TestAsyncAPIService_ParseAsyncAPI_UnsupportedVersion(t *testing.T) {
+	svc := NewAsyncAPIService()
+
+	_, err := svc.ParseAsyncAPI([]byte(`asyncapi: 1.2.0`))
+	assert.Error(t, err)
+
+	_, err = svc.ParseAsyncAPI([]byte(`openapi: 3.0.3`))
+	assert.Error(t, err)
+}
+
+func TestAsyncAPIService_ConvertToNikode_V2(t *testing.T) {
+	collection := convertAsyncAPITestSpec(t, `
+asyncapi: 2.6.0
+info:
+  title: Chat
+  version: 2.1.0
+servers:
+  production:
+    url: chat.example.com
+    protocol: wss
+    description: Production
+  local:
+    url: localhost:{port}
+    protocol: ws
+    variables:
+      port:
+        default: "8080"
+  broker:
+    url: kafka.example.com:9092
+    protocol: kafka
+channels:
+  /rooms/{roomId}:
+    description: Chat room
+    parameters:
+      roomId:
+        schema:
+          type: string
+    bindings:
+      ws:
+        query:
+          type: object
+          properties:
+            token:
+              type: string
+              example: abc
+    publish:
+      tags:
+        - name: Rooms
+      message:
+        oneOf:
+          - $ref: '#/components/messages/sendMessage'
+          - $ref: '#/components/messages/typing'
+    subscribe:
+      message:
+        $ref: '#/components/messages/newMessage'
+components:
+  messages:
+    sendMessage:
+      name: sendMessage
+      title: Send message
+      payload:
+        $ref: '#/components/schemas/Message'
+    typing:
+      name: typing
+      examples:
+        - name: started
+          payload:
+            type: typing
+            active: true
+    newMessage:
+      name: newMessage
+      summary: A message posted by another user
+      payload:
+        $ref: '#/components/schemas/Message'
+  schemas:
+    Message:
+      type: object
+      properties:
+        text:
+          type: string
+        sentAt:
+          type: string
+          format: date-time
+        replyTo:
+          $ref: '#/components/schemas/Message'
+`)
+
+	assert.Equal(t, "Chat", collection.Name)
+	assert.Equal(t, "2.1.0", collection.Version)
+
+	// The kafka server is skipped
+	require.Len(t, collection.Environments, 2)
+	local := collection.Environments[0]
+	assert.Equal(t, "local", local.Name)
+	assert.Equal(t, "ws://localhost:{{port}}", local.Variables[0].Value)
+	assert.Equal(t, "8080", findEnvVariable(local, "port").Value)
+	assert.Equal(t, "wss://chat.example.com", collection.Environments[1].Variables[0].Value)
+
+	require.Len(t, collection.Items, 1)
+	folder := collection.Items[0]
+	assert.Equal(t, "folder", folder.Type)
+	assert.Equal(t, "Rooms", folder.Name)
+	require.Len(t, folder.Items, 1)
+
+	item := folder.Items[0]
+	assert.Equal(t, "websocket", item.Type)
+	assert.Equal(t, "/rooms/{roomId}", item.Name)
+	assert.Equal(t, "{{baseUrl}}/rooms/{{roomId}}", item.URL)
+	assert.Equal(t, []KeyValue{{Key: "token", Value: "abc", Enabled: true}}, item.Params)
+
+	require.Len(t, item.WsSavedMessages, 2)
+	sent := item.WsSavedMessages[0]
+	assert.Equal(t, "Send message", sent.Name)
+	assert.Equal(t, "text", sent.Type)
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal([]byte(sent.Content), &payload))
+	assert.Equal(t, "string", payload["text"])
+	assert.Equal(t, "2024-01-01T12:00:00Z", payload["sentAt"])
+	assert.Equal(t, map[string]any{}, payload["replyTo"])
+
+	assert.Equal(t, "typing - started", item.WsSavedMessages[1].Name)
+	assert.JSONEq(t, `{"type": "typing", "active": true}`, item.WsSavedMessages[1].Content)
+
+	assert.Contains(t, item.Docs, "Chat room")
+	assert.Contains(t, item.Docs, "## Received Messages")
+	assert.Contains(t, item.Docs, "### newMessage")
+	assert.Contains(t, item.Docs, "A message posted by another user")
+}
+
+func TestAsyncAPIService_ConvertToNikode_V3(t *testing.T) {
+	collection := convertAsyncAPITestSpec(t, `{
+		"asyncapi": "3.0.0",
+		"info": {"title": "Prices", "version": "1.0.0"},
+		"servers": {
+			"production": {"host": "stream.example.com", "pathname": "/v1", "protocol": "wss"}
+		},
+		"channels": {
+			"prices": {
+				"address": "prices/{symbol}",
+				"title": "Price feed",
+				"messages": {
+					"subscribe": {"$ref": "#/components/messages/subscribe"},
+					"tick": {"$ref": "#/components/messages/tick"}
+				},
+				"bindings": {"ws": {"headers": {"type": "object", "properties": {"X-Client": {"type": "string", "const": "nikode"}}}}}
+			},
+			"status": {
+				"address": null,
+				"messages": {
+					"ping": {"name": "ping", "payload": {"type": "string", "examples": ["ping"]}}
+				}
+			}
+		},
+		"operations": {
+			"sendSubscribe": {
+				"action": "receive",
+				"channel": {"$ref": "#/channels/prices"},
+				"messages": [{"$ref": "#/channels/prices/messages/subscribe"}]
+			},
+			"publishTick": {
+				"action": "send",
+				"channel": {"$ref": "#/channels/prices"},
+				"messages": [{"$ref": "#/channels/prices/messages/tick"}]
+			}
+		},
+		"components": {
+			"messages": {
+				"subscribe": {
+					"payload": {
+						"type": "object",
+						"properties": {
+							"action": {"type": "string", "enum": ["subscribe"]},
+							"depth": {"type": "integer", "exclusiveMinimum": 0}
+						}
+					}
+				},
+				"tick": {
+					"payload": {
+						"schemaFormat": "application/vnd.aai.asyncapi+json;version=3.0.0",
+						"schema": {"type": "object", "properties": {"price": {"type": "number"}}}
+					}
+				}
+			}
+		}
+	}`)
+
+	require.Len(t, collection.Environments, 1)
+	assert.Equal(t, "env-default", collection.Environments[0].ID)
+	assert.Equal(t, "wss://stream.example.com/v1", collection.Environments[0].Variables[0].Value)
+
+	require.Len(t, collection.Items, 2)
+
+	prices := collection.Items[0]
+	assert.Equal(t, "Price feed", prices.Name)
+	assert.Equal(t, "{{baseUrl}}/prices/{{symbol}}", prices.URL)
+	assert.Equal(t, []KeyValue{{Key: "X-Client", Value: "nikode", Enabled: true}}, prices.Headers)
+	require.Len(t, prices.WsSavedMessages, 1)
+	assert.Equal(t, "subscribe", prices.WsSavedMessages[0].Name)
+	assert.JSONEq(t, `{"action": "subscribe", "depth": 1}`, prices.WsSavedMessages[0].Content)
+	assert.Contains(t, prices.Docs, "### tick")
+	assert.Contains(t, prices.Docs, `"price": 0`)
+
+	// Channels without operations offer their messages for sending
+	status := collection.Items[1]
+	assert.Equal(t, "status", status.Name)
+	assert.Equal(t, "{{baseUrl}}", status.URL)
+	require.Len(t, status.WsSavedMessages, 1)
+	assert.Equal(t, "ping", status.WsSavedMessages[0].Content)
+}
+
+func TestDetectSpecFormat(t *testing.T) {
+	assert.Equal(t, SpecFormatAsyncAPI, DetectSpecFormat([]byte(`asyncapi: 3.0.0`)))
+	assert.Equal(t, SpecFormatAsyncAPI, DetectSpecFormat([]byte(`{"asyncapi": "2.6.0"}`)))
+	assert.Equal(t, SpecFormatOpenAPI, DetectSpecFormat([]byte(`openapi: 3.0.3`)))
+	assert.Equal(t, SpecFormatOpenAPI, DetectSpecFormat([]byte(`not: [valid`)))
+}
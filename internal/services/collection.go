@@ -4,18 +4,45 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/dimitrije/nikode-api/internal/database"
 	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 var (
-	ErrVersionConflict  = errors.New("version conflict: collection has been modified")
+	ErrVersionConflict    = errors.New("version conflict: collection has been modified")
 	ErrCollectionNotFound = errors.New("collection not found")
-	ErrNoFieldsToUpdate = errors.New("no fields to update")
+	ErrNoFieldsToUpdate   = errors.New("no fields to update")
 )
 
+// collectionColumns lists the columns scanned by scanCollection, in order
+const collectionColumns = `id, workspace_id, name, data, version, updated_by, created_at, updated_at,
+	updated_by_api_key, updated_by_api_key_name`
+
+type collectionRow interface {
+	Scan(dest ...any) error
+}
+
+func scanCollection(row collectionRow, c *models.Collection) error {
+	return row.Scan(
+		&c.ID, &c.WorkspaceID, &c.Name, &c.Data, &c.Version,
+		&c.UpdatedBy, &c.CreatedAt, &c.UpdatedAt,
+		&c.UpdatedByAPIKey, &c.UpdatedByAPIKeyName,
+	)
+}
+
+// actorValues returns the updated_by, updated_by_api_key and
+// updated_by_api_key_name values recording actor. Only one of the IDs is set.
+func actorValues(actor models.Actor) (updatedBy, apiKeyID, apiKeyName any) {
+	if actor.Type == models.ActorTypeAPIKey {
+		return nil, actor.ID, actor.Name
+	}
+	return actor.ID, nil, nil
+}
+
 type CollectionService struct {
 	db *database.DB
 }
@@ -25,20 +52,24 @@ func NewCollectionService(db *database.DB) *CollectionService {
 }
 
 func (s *CollectionService) Create(ctx context.Context, workspaceID uuid.UUID, name string, data json.RawMessage, userID uuid.UUID) (*models.Collection, error) {
+	return s.CreateAs(ctx, workspaceID, name, data, models.UserActor(userID))
+}
+
+// CreateAs creates a collection on behalf of a user or an API key
+func (s *CollectionService) CreateAs(ctx context.Context, workspaceID uuid.UUID, name string, data json.RawMessage, actor models.Actor) (*models.Collection, error) {
 	if data == nil {
 		data = json.RawMessage("{}")
 	}
 
+	updatedBy, apiKeyID, apiKeyName := actorValues(actor)
+
 	var collection models.Collection
-	err := s.db.Pool.QueryRow(ctx, `
-		INSERT INTO collections (workspace_id, name, data, updated_by)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, workspace_id, name, data, version, updated_by, created_at, updated_at
-	`, workspaceID, name, data, userID).Scan(
-		&collection.ID, &collection.WorkspaceID, &collection.Name,
-		&collection.Data, &collection.Version, &collection.UpdatedBy,
-		&collection.CreatedAt, &collection.UpdatedAt,
-	)
+	err := scanCollection(s.db.Pool.QueryRow(ctx, `
+		INSERT INTO collections (workspace_id, name, data, updated_by, updated_by_api_key, updated_by_api_key_name)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+collectionColumns,
+		workspaceID, name, data, updatedBy, apiKeyID, apiKeyName,
+	), &collection)
 	if err != nil {
 		return nil, err
 	}
@@ -47,14 +78,10 @@ func (s *CollectionService) Create(ctx context.Context, workspaceID uuid.UUID, n
 
 func (s *CollectionService) GetByID(ctx context.Context, collectionID uuid.UUID) (*models.Collection, error) {
 	var collection models.Collection
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, workspace_id, name, data, version, updated_by, created_at, updated_at
+	err := scanCollection(s.db.Pool.QueryRow(ctx, `
+		SELECT `+collectionColumns+`
 		FROM collections WHERE id = $1
-	`, collectionID).Scan(
-		&collection.ID, &collection.WorkspaceID, &collection.Name,
-		&collection.Data, &collection.Version, &collection.UpdatedBy,
-		&collection.CreatedAt, &collection.UpdatedAt,
-	)
+	`, collectionID), &collection)
 	if err != nil {
 		return nil, err
 	}
@@ -63,7 +90,7 @@ func (s *CollectionService) GetByID(ctx context.Context, collectionID uuid.UUID)
 
 func (s *CollectionService) GetByWorkspace(ctx context.Context, workspaceID uuid.UUID) ([]models.Collection, error) {
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, workspace_id, name, data, version, updated_by, created_at, updated_at
+		SELECT `+collectionColumns+`
 		FROM collections WHERE workspace_id = $1
 		ORDER BY created_at DESC
 	`, workspaceID)
@@ -75,10 +102,7 @@ func (s *CollectionService) GetByWorkspace(ctx context.Context, workspaceID uuid
 	var collections []models.Collection
 	for rows.Next() {
 		var c models.Collection
-		if err := rows.Scan(
-			&c.ID, &c.WorkspaceID, &c.Name, &c.Data, &c.Version,
-			&c.UpdatedBy, &c.CreatedAt, &c.UpdatedAt,
-		); err != nil {
+		if err := scanCollection(rows, &c); err != nil {
 			return nil, err
 		}
 		collections = append(collections, c)
@@ -90,44 +114,38 @@ func (s *CollectionService) Update(ctx context.Context, collectionID uuid.UUID,
 	var collection models.Collection
 
 	if name != nil && data != nil {
-		err := s.db.Pool.QueryRow(ctx, `
+		err := scanCollection(s.db.Pool.QueryRow(ctx, `
 			UPDATE collections
-			SET name = $1, data = $2, version = version + 1, updated_by = $3, updated_at = NOW()
+			SET name = $1, data = $2, version = version + 1, updated_by = $3, updated_at = NOW(),
+				updated_by_api_key = NULL, updated_by_api_key_name = NULL
 			WHERE id = $4 AND version = $5
-			RETURNING id, workspace_id, name, data, version, updated_by, created_at, updated_at
-		`, *name, data, userID, collectionID, expectedVersion).Scan(
-			&collection.ID, &collection.WorkspaceID, &collection.Name,
-			&collection.Data, &collection.Version, &collection.UpdatedBy,
-			&collection.CreatedAt, &collection.UpdatedAt,
-		)
+			RETURNING `+collectionColumns,
+			*name, data, userID, collectionID, expectedVersion,
+		), &collection)
 		if err != nil {
 			return nil, s.checkVersionConflict(ctx, collectionID, expectedVersion, err)
 		}
 	} else if name != nil {
-		err := s.db.Pool.QueryRow(ctx, `
+		err := scanCollection(s.db.Pool.QueryRow(ctx, `
 			UPDATE collections
-			SET name = $1, version = version + 1, updated_by = $2, updated_at = NOW()
+			SET name = $1, version = version + 1, updated_by = $2, updated_at = NOW(),
+				updated_by_api_key = NULL, updated_by_api_key_name = NULL
 			WHERE id = $3 AND version = $4
-			RETURNING id, workspace_id, name, data, version, updated_by, created_at, updated_at
-		`, *name, userID, collectionID, expectedVersion).Scan(
-			&collection.ID, &collection.WorkspaceID, &collection.Name,
-			&collection.Data, &collection.Version, &collection.UpdatedBy,
-			&collection.CreatedAt, &collection.UpdatedAt,
-		)
+			RETURNING `+collectionColumns,
+			*name, userID, collectionID, expectedVersion,
+		), &collection)
 		if err != nil {
 			return nil, s.checkVersionConflict(ctx, collectionID, expectedVersion, err)
 		}
 	} else if data != nil {
-		err := s.db.Pool.QueryRow(ctx, `
+		err := scanCollection(s.db.Pool.QueryRow(ctx, `
 			UPDATE collections
-			SET data = $1, version = version + 1, updated_by = $2, updated_at = NOW()
+			SET data = $1, version = version + 1, updated_by = $2, updated_at = NOW(),
+				updated_by_api_key = NULL, updated_by_api_key_name = NULL
 			WHERE id = $3 AND version = $4
-			RETURNING id, workspace_id, name, data, version, updated_by, created_at, updated_at
-		`, data, userID, collectionID, expectedVersion).Scan(
-			&collection.ID, &collection.WorkspaceID, &collection.Name,
-			&collection.Data, &collection.Version, &collection.UpdatedBy,
-			&collection.CreatedAt, &collection.UpdatedAt,
-		)
+			RETURNING `+collectionColumns,
+			data, userID, collectionID, expectedVersion,
+		), &collection)
 		if err != nil {
 			return nil, s.checkVersionConflict(ctx, collectionID, expectedVersion, err)
 		}
@@ -158,14 +176,10 @@ func (s *CollectionService) Delete(ctx context.Context, collectionID uuid.UUID)
 // GetByWorkspaceAndName finds a collection by workspace ID and name
 func (s *CollectionService) GetByWorkspaceAndName(ctx context.Context, workspaceID uuid.UUID, name string) (*models.Collection, error) {
 	var collection models.Collection
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, workspace_id, name, data, version, updated_by, created_at, updated_at
+	err := scanCollection(s.db.Pool.QueryRow(ctx, `
+		SELECT `+collectionColumns+`
 		FROM collections WHERE workspace_id = $1 AND name = $2
-	`, workspaceID, name).Scan(
-		&collection.ID, &collection.WorkspaceID, &collection.Name,
-		&collection.Data, &collection.Version, &collection.UpdatedBy,
-		&collection.CreatedAt, &collection.UpdatedAt,
-	)
+	`, workspaceID, name), &collection)
 	if err != nil {
 		return nil, ErrCollectionNotFound
 	}
@@ -173,20 +187,93 @@ func (s *CollectionService) GetByWorkspaceAndName(ctx context.Context, workspace
 }
 
 // ForceUpdate updates a collection without version check (bypasses optimistic locking)
-func (s *CollectionService) ForceUpdate(ctx context.Context, collectionID uuid.UUID, name string, data json.RawMessage) (*models.Collection, error) {
+func (s *CollectionService) ForceUpdate(ctx context.Context, collectionID uuid.UUID, name string, data json.RawMessage, actor models.Actor) (*models.Collection, error) {
+	updatedBy, apiKeyID, apiKeyName := actorValues(actor)
+
 	var collection models.Collection
-	err := s.db.Pool.QueryRow(ctx, `
+	err := scanCollection(s.db.Pool.QueryRow(ctx, `
 		UPDATE collections
-		SET name = $1, data = $2, version = version + 1, updated_at = NOW()
+		SET name = $1, data = $2, version = version + 1, updated_at = NOW(),
+			updated_by = $4, updated_by_api_key = $5, updated_by_api_key_name = $6
 		WHERE id = $3
-		RETURNING id, workspace_id, name, data, version, updated_by, created_at, updated_at
-	`, name, data, collectionID).Scan(
-		&collection.ID, &collection.WorkspaceID, &collection.Name,
-		&collection.Data, &collection.Version, &collection.UpdatedBy,
-		&collection.CreatedAt, &collection.UpdatedAt,
-	)
+		RETURNING `+collectionColumns,
+		name, data, collectionID, updatedBy, apiKeyID, apiKeyName,
+	), &collection)
 	if err != nil {
 		return nil, ErrCollectionNotFound
 	}
 	return &collection, nil
 }
+
+// CollectionUpsert is one write of a batch upsert. A nil CollectionID creates
+// a collection, otherwise the collection is overwritten without a version
+// check, like ForceUpdate.
+type CollectionUpsert struct {
+	CollectionID uuid.UUID
+	Name         string
+	Data         json.RawMessage
+}
+
+// CollectionUpsertError reports which write of a batch failed.
+type CollectionUpsertError struct {
+	Index int
+	Err   error
+}
+
+func (e *CollectionUpsertError) Error() string {
+	return fmt.Sprintf("upsert %d: %v", e.Index, e.Err)
+}
+
+func (e *CollectionUpsertError) Unwrap() error {
+	return e.Err
+}
+
+// UpsertBatch applies the writes in one transaction, so either every
+// collection is written or none is. Collections are returned in the order of
+// upserts.
+func (s *CollectionService) UpsertBatch(ctx context.Context, workspaceID uuid.UUID, upserts []CollectionUpsert, actor models.Actor) ([]models.Collection, error) {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	updatedBy, apiKeyID, apiKeyName := actorValues(actor)
+
+	collections := make([]models.Collection, len(upserts))
+	for i, upsert := range upserts {
+		data := upsert.Data
+		if data == nil {
+			data = json.RawMessage("{}")
+		}
+
+		if upsert.CollectionID == uuid.Nil {
+			err = scanCollection(tx.QueryRow(ctx, `
+				INSERT INTO collections (workspace_id, name, data, updated_by, updated_by_api_key, updated_by_api_key_name)
+				VALUES ($1, $2, $3, $4, $5, $6)
+				RETURNING `+collectionColumns,
+				workspaceID, upsert.Name, data, updatedBy, apiKeyID, apiKeyName,
+			), &collections[i])
+		} else {
+			err = scanCollection(tx.QueryRow(ctx, `
+				UPDATE collections
+				SET name = $1, data = $2, version = version + 1, updated_at = NOW(),
+					updated_by = $5, updated_by_api_key = $6, updated_by_api_key_name = $7
+				WHERE id = $3 AND workspace_id = $4
+				RETURNING `+collectionColumns,
+				upsert.Name, data, upsert.CollectionID, workspaceID, updatedBy, apiKeyID, apiKeyName,
+			), &collections[i])
+			if errors.Is(err, pgx.ErrNoRows) {
+				err = ErrCollectionNotFound
+			}
+		}
+		if err != nil {
+			return nil, &CollectionUpsertError{Index: i, Err: err}
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return collections, nil
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"github.com/pashagolub/pgxmock/v4"
@@ -36,10 +37,11 @@ func TestCollectionService_Create(t *testing.T) {
 
 	rows := pgxmock.NewRows([]string{
 		"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at",
-	}).AddRow(collectionID, workspaceID, name, data, 1, &userID, now, now)
+		"updated_by_api_key", "updated_by_api_key_name",
+	}).AddRow(collectionID, workspaceID, name, data, 1, &userID, now, now, nil, nil)
 
 	mock.ExpectQuery(`INSERT INTO collections`).
-		WithArgs(workspaceID, name, data, userID).
+		WithArgs(workspaceID, name, data, userID, nil, nil).
 		WillReturnRows(rows)
 
 	col, err := svc.Create(ctx, workspaceID, name, data, userID)
@@ -63,10 +65,11 @@ func TestCollectionService_Create_NilData(t *testing.T) {
 
 	rows := pgxmock.NewRows([]string{
 		"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at",
-	}).AddRow(collectionID, workspaceID, name, emptyData, 1, &userID, now, now)
+		"updated_by_api_key", "updated_by_api_key_name",
+	}).AddRow(collectionID, workspaceID, name, emptyData, 1, &userID, now, now, nil, nil)
 
 	mock.ExpectQuery(`INSERT INTO collections`).
-		WithArgs(workspaceID, name, json.RawMessage(`{}`), userID).
+		WithArgs(workspaceID, name, json.RawMessage(`{}`), userID, nil, nil).
 		WillReturnRows(rows)
 
 	col, err := svc.Create(ctx, workspaceID, name, nil, userID)
@@ -87,7 +90,8 @@ func TestCollectionService_GetByID(t *testing.T) {
 
 	rows := pgxmock.NewRows([]string{
 		"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at",
-	}).AddRow(collectionID, workspaceID, "Test", data, 1, &userID, now, now)
+		"updated_by_api_key", "updated_by_api_key_name",
+	}).AddRow(collectionID, workspaceID, "Test", data, 1, &userID, now, now, nil, nil)
 
 	mock.ExpectQuery(`SELECT .+ FROM collections WHERE id`).
 		WithArgs(collectionID).
@@ -127,9 +131,10 @@ func TestCollectionService_GetByWorkspace(t *testing.T) {
 
 	rows := pgxmock.NewRows([]string{
 		"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at",
+		"updated_by_api_key", "updated_by_api_key_name",
 	}).
-		AddRow(col1ID, workspaceID, "Collection 1", data, 1, &userID, now, now).
-		AddRow(col2ID, workspaceID, "Collection 2", data, 2, &userID, now, now)
+		AddRow(col1ID, workspaceID, "Collection 1", data, 1, &userID, now, now, nil, nil).
+		AddRow(col2ID, workspaceID, "Collection 2", data, 2, &userID, now, now, nil, nil)
 
 	mock.ExpectQuery(`SELECT .+ FROM collections WHERE workspace_id`).
 		WithArgs(workspaceID).
@@ -155,7 +160,8 @@ func TestCollectionService_Update_NameAndData(t *testing.T) {
 
 	rows := pgxmock.NewRows([]string{
 		"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at",
-	}).AddRow(collectionID, workspaceID, name, data, 2, &userID, now, now)
+		"updated_by_api_key", "updated_by_api_key_name",
+	}).AddRow(collectionID, workspaceID, name, data, 2, &userID, now, now, nil, nil)
 
 	mock.ExpectQuery(`UPDATE collections SET name = .+, data = .+, version = version \+ 1`).
 		WithArgs(name, data, userID, collectionID, expectedVersion).
@@ -182,7 +188,8 @@ func TestCollectionService_Update_NameOnly(t *testing.T) {
 
 	rows := pgxmock.NewRows([]string{
 		"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at",
-	}).AddRow(collectionID, workspaceID, name, data, 2, &userID, now, now)
+		"updated_by_api_key", "updated_by_api_key_name",
+	}).AddRow(collectionID, workspaceID, name, data, 2, &userID, now, now, nil, nil)
 
 	mock.ExpectQuery(`UPDATE collections SET name = .+, version = version \+ 1`).
 		WithArgs(name, userID, collectionID, expectedVersion).
@@ -207,7 +214,8 @@ func TestCollectionService_Update_DataOnly(t *testing.T) {
 
 	rows := pgxmock.NewRows([]string{
 		"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at",
-	}).AddRow(collectionID, workspaceID, "Existing Name", data, 2, &userID, now, now)
+		"updated_by_api_key", "updated_by_api_key_name",
+	}).AddRow(collectionID, workspaceID, "Existing Name", data, 2, &userID, now, now, nil, nil)
 
 	mock.ExpectQuery(`UPDATE collections SET data = .+, version = version \+ 1`).
 		WithArgs(data, userID, collectionID, expectedVersion).
@@ -295,3 +303,91 @@ func TestCollectionService_Delete(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestCollectionService_UpsertBatch(t *testing.T) {
+	svc, mock := setupCollectionService(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	existingID := uuid.New()
+	createdID := uuid.New()
+	apiKey := &models.WorkspaceAPIKey{ID: uuid.New(), Name: "CI"}
+	now := time.Now()
+	columns := []string{"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at", "updated_by_api_key", "updated_by_api_key_name"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`UPDATE collections`).
+		WithArgs("Users", json.RawMessage(`{"a":1}`), existingID, workspaceID, nil, apiKey.ID, "CI").
+		WillReturnRows(pgxmock.NewRows(columns).AddRow(existingID, workspaceID, "Users", json.RawMessage(`{"a":1}`), 4, nil, now, now, &apiKey.ID, &apiKey.Name))
+	mock.ExpectQuery(`INSERT INTO collections`).
+		WithArgs(workspaceID, "Billing", json.RawMessage(`{}`), nil, apiKey.ID, "CI").
+		WillReturnRows(pgxmock.NewRows(columns).AddRow(createdID, workspaceID, "Billing", json.RawMessage(`{}`), 1, nil, now, now, &apiKey.ID, &apiKey.Name))
+	mock.ExpectCommit()
+
+	collections, err := svc.UpsertBatch(ctx, workspaceID, []CollectionUpsert{
+		{CollectionID: existingID, Name: "Users", Data: json.RawMessage(`{"a":1}`)},
+		{Name: "Billing"},
+	}, models.APIKeyActor(apiKey))
+
+	require.NoError(t, err)
+	require.Len(t, collections, 2)
+	assert.Equal(t, 4, collections[0].Version)
+	assert.Equal(t, createdID, collections[1].ID)
+	assert.Equal(t, &models.Actor{Type: models.ActorTypeAPIKey, ID: apiKey.ID, Name: "CI"}, collections[1].UpdatedByActor())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCollectionService_UpsertBatch_RollsBack(t *testing.T) {
+	svc, mock := setupCollectionService(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	missingID := uuid.New()
+	userID := uuid.New()
+	now := time.Now()
+	columns := []string{"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at", "updated_by_api_key", "updated_by_api_key_name"}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO collections`).
+		WithArgs(workspaceID, "Billing", json.RawMessage(`{}`), userID, nil, nil).
+		WillReturnRows(pgxmock.NewRows(columns).AddRow(uuid.New(), workspaceID, "Billing", json.RawMessage(`{}`), 1, nil, now, now, nil, nil))
+	mock.ExpectQuery(`UPDATE collections`).
+		WithArgs("Users", json.RawMessage(`{}`), missingID, workspaceID, userID, nil, nil).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectRollback()
+
+	_, err := svc.UpsertBatch(ctx, workspaceID, []CollectionUpsert{
+		{Name: "Billing", Data: json.RawMessage(`{}`)},
+		{CollectionID: missingID, Name: "Users", Data: json.RawMessage(`{}`)},
+	}, models.UserActor(userID))
+
+	var upsertErr *CollectionUpsertError
+	require.ErrorAs(t, err, &upsertErr)
+	assert.Equal(t, 1, upsertErr.Index)
+	assert.ErrorIs(t, err, ErrCollectionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCollectionService_ForceUpdate_APIKeyActor(t *testing.T) {
+	svc, mock := setupCollectionService(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	collectionID := uuid.New()
+	apiKey := &models.WorkspaceAPIKey{ID: uuid.New(), Name: "Deploy"}
+	data := json.RawMessage(`{"items":[]}`)
+	now := time.Now()
+
+	rows := pgxmock.NewRows([]string{
+		"id", "workspace_id", "name", "data", "version", "updated_by", "created_at", "updated_at",
+		"updated_by_api_key", "updated_by_api_key_name",
+	}).AddRow(collectionID, workspaceID, "Users", data, 5, nil, now, now, &apiKey.ID, &apiKey.Name)
+
+	mock.ExpectQuery(`UPDATE collections\s+SET name = \$1, data = \$2, version = version \+ 1, updated_at = NOW\(\),\s+updated_by = \$4, updated_by_api_key = \$5`).
+		WithArgs("Users", data, collectionID, nil, apiKey.ID, "Deploy").
+		WillReturnRows(rows)
+
+	col, err := svc.ForceUpdate(ctx, collectionID, "Users", data, models.APIKeyActor(apiKey))
+
+	require.NoError(t, err)
+	assert.Nil(t, col.UpdatedBy)
+	assert.Equal(t, &models.Actor{Type: models.ActorTypeAPIKey, ID: apiKey.ID, Name: "Deploy"}, col.UpdatedByActor())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
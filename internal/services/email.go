@@ -2,7 +2,9 @@ package services
 
 import (
 	"fmt"
+	"html"
 	"net/smtp"
+	"time"
 
 	"github.com/dimitrije/nikode-api/internal/config"
 )
@@ -48,3 +50,71 @@ func (s *EmailService) SendWorkspaceInvite(to, workspaceName, inviterName, invit
 
 	return s.Send(to, subject, body)
 }
+
+func (s *EmailService) SendAPIKeyExpiring(to, workspaceName, keyName, keyPrefix string, expiresAt time.Time) error {
+	subject := fmt.Sprintf("API key %q in %s expires soon", keyName, workspaceName)
+	body := fmt.Sprintf(`
+		<html>
+		<body>
+			<h2>API Key Expiring</h2>
+			<p>Hi,</p>
+			<p>The API key <strong>%s</strong> (<code>%s</code>) in the workspace <strong>%s</strong> expires on %s.</p>
+			<p>Rotate the key before then to keep automation that uses it working.</p>
+		</body>
+		</html>
+	`, html.EscapeString(keyName), html.EscapeString(keyPrefix), html.EscapeString(workspaceName), expiresAt.UTC().Format("January 2, 2006 15:04 MST"))
+
+	return s.Send(to, subject, body)
+}
+
+func (s *EmailService) SendMagicLink(to, link string, ttl time.Duration) error {
+	subject := "Your Nikode sign-in link"
+	body := fmt.Sprintf(`
+		<html>
+		<body>
+			<h2>Sign in to Nikode</h2>
+			<p>Hi,</p>
+			<p><a href="%s">Click here to sign in</a>. The link works once and expires in %d minutes.</p>
+			<p>If you didn't ask to sign in, you can ignore this email.</p>
+		</body>
+		</html>
+	`, html.EscapeString(link), int(ttl.Minutes()))
+
+	return s.Send(to, subject, body)
+}
+
+// SendWorkspaceEmailInvite invites someone who has no account yet. The
+// invite waits for them to sign in with this email address.
+func (s *EmailService) SendWorkspaceEmailInvite(to, workspaceName, inviterName string) error {
+	subject := fmt.Sprintf("You've been invited to join %s", workspaceName)
+	body := fmt.Sprintf(`
+		<html>
+		<body>
+			<h2>Workspace Invitation</h2>
+			<p>Hi,</p>
+			<p><strong>%s</strong> has invited you to join the workspace <strong>%s</strong>.</p>
+			<p>Sign in to Nikode with this email address to accept the invitation.</p>
+		</body>
+		</html>
+	`, html.EscapeString(inviterName), html.EscapeString(workspaceName))
+
+	return s.Send(to, subject, body)
+}
+
+// SendRefreshTokenReuse warns a user that a rotated refresh token was
+// presented again and its session was signed out.
+func (s *EmailService) SendRefreshTokenReuse(to string, detectedAt time.Time) error {
+	subject := "A Nikode session was signed out for your security"
+	body := fmt.Sprintf(`
+		<html>
+		<body>
+			<h2>Session Signed Out</h2>
+			<p>Hi,</p>
+			<p>On %s, an old sign-in token for one of your devices was used again. This can mean the token was copied from that device, so we signed the device out.</p>
+			<p>Sign in again on the device. If this keeps happening, review your sessions in Nikode and check the device for malware.</p>
+		</body>
+		</html>
+	`, detectedAt.UTC().Format("January 2, 2006 15:04 MST"))
+
+	return s.Send(to, subject, body)
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"testing"
+	"time"
 
 	"github.com/dimitrije/nikode-api/internal/config"
 	"github.com/stretchr/testify/assert"
@@ -89,3 +90,21 @@ func TestEmailService_SendWorkspaceInvite_NotConfigured(t *testing.T) {
 
 	assert.NoError(t, err)
 }
+
+func TestEmailService_SendWorkspaceEmailInvite_NotConfigured(t *testing.T) {
+	cfg := config.SMTPConfig{}
+	svc := NewEmailService(cfg)
+
+	err := svc.SendWorkspaceEmailInvite("to@example.com", "Test Workspace", "John Doe")
+
+	assert.NoError(t, err)
+}
+
+func TestEmailService_SendMagicLink_NotConfigured(t *testing.T) {
+	cfg := config.SMTPConfig{}
+	svc := NewEmailService(cfg)
+
+	err := svc.SendMagicLink("to@example.com", "http://example.com/api/v1/magic-link/verify?token=abc", 15*time.Minute)
+
+	assert.NoError(t, err)
+}
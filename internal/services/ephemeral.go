@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrEphemeralValueNotFound = errors.New("value not found or expired")
+	ErrEphemeralValueExists   = errors.New("value already exists")
+)
+
+// EphemeralStore keeps short-lived values, such as OAuth states and auth
+// codes, that a later request must find even if it lands on another
+// instance. Keys are namespaced by their callers.
+type EphemeralStore interface {
+	// Put stores value under key for ttl, replacing any previous value
+	Put(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Add stores value under key for ttl unless an unexpired value is
+	// already there, in which case it returns ErrEphemeralValueExists. Of
+	// concurrent callers only one succeeds.
+	Add(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Get returns the value under key, or ErrEphemeralValueNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Take returns and removes the value under key, or
+	// ErrEphemeralValueNotFound. Of concurrent callers only one gets it.
+	Take(ctx context.Context, key string) ([]byte, error)
+	// Count returns the number of unexpired values whose keys start with
+	// prefix
+	Count(ctx context.Context, prefix string) (int, error)
+	// CleanupExpired removes expired values
+	CleanupExpired(ctx context.Context) error
+}
+
+// PutJSON stores v encoded as JSON.
+func PutJSON(ctx context.Context, store EphemeralStore, key string, v any, ttl time.Duration) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return store.Put(ctx, key, value, ttl)
+}
+
+// GetJSON decodes the value under key into v.
+func GetJSON(ctx context.Context, store EphemeralStore, key string, v any) error {
+	value, err := store.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(value, v)
+}
+
+// TakeJSON removes the value under key and decodes it into v.
+func TakeJSON(ctx context.Context, store EphemeralStore, key string, v any) error {
+	value, err := store.Take(ctx, key)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(value, v)
+}
+
+// PostgresEphemeralStore shares values between instances through the
+// database. Expiry uses the database clock, so instances agree on it.
+type PostgresEphemeralStore struct {
+	db *database.DB
+}
+
+func NewPostgresEphemeralStore(db *database.DB) *PostgresEphemeralStore {
+	return &PostgresEphemeralStore{db: db}
+}
+
+func (s *PostgresEphemeralStore) Put(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO ephemeral_values (key, value, expires_at)
+		VALUES ($1, $2, NOW() + $3::float8 * INTERVAL '1 second')
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at
+	`, key, value, ttl.Seconds())
+	return err
+}
+
+func (s *PostgresEphemeralStore) Add(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO ephemeral_values (key, value, expires_at)
+		VALUES ($1, $2, NOW() + $3::float8 * INTERVAL '1 second')
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at
+		WHERE ephemeral_values.expires_at <= NOW()
+	`, key, value, ttl.Seconds())
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrEphemeralValueExists
+	}
+	return nil
+}
+
+func (s *PostgresEphemeralStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT value FROM ephemeral_values WHERE key = $1 AND expires_at > NOW()
+	`, key).Scan(&value)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrEphemeralValueNotFound
+	}
+	return value, err
+}
+
+func (s *PostgresEphemeralStore) Take(ctx context.Context, key string) ([]byte, error) {
+	var value []byte
+	var valid bool
+	err := s.db.Pool.QueryRow(ctx, `
+		DELETE FROM ephemeral_values WHERE key = $1
+		RETURNING value, expires_at > NOW()
+	`, key).Scan(&value, &valid)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !valid) {
+		return nil, ErrEphemeralValueNotFound
+	}
+	return value, err
+}
+
+func (s *PostgresEphemeralStore) Count(ctx context.Context, prefix string) (int, error) {
+	var count int
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM ephemeral_values WHERE starts_with(key, $1) AND expires_at > NOW()
+	`, prefix).Scan(&count)
+	return count, err
+}
+
+func (s *PostgresEphemeralStore) CleanupExpired(ctx context.Context) error {
+	_, err := s.db.Pool.Exec(ctx, `DELETE FROM ephemeral_values WHERE expires_at < NOW()`)
+	return err
+}
+
+// MemoryEphemeralStore keeps values in the process. It suits tests and
+// single-instance setups; values are lost on restart.
+type MemoryEphemeralStore struct {
+	mu     sync.Mutex
+	values map[string]memoryEphemeralValue
+}
+
+type memoryEphemeralValue struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+func NewMemoryEphemeralStore() *MemoryEphemeralStore {
+	return &MemoryEphemeralStore{values: make(map[string]memoryEphemeralValue)}
+}
+
+func (s *MemoryEphemeralStore) Put(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.values[key] = memoryEphemeralValue{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryEphemeralStore) Add(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.values[key]; ok && time.Now().Before(v.expiresAt) {
+		return ErrEphemeralValueExists
+	}
+	s.values[key] = memoryEphemeralValue{value: value, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryEphemeralStore) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	if !ok || !time.Now().Before(v.expiresAt) {
+		return nil, ErrEphemeralValueNotFound
+	}
+	return v.value, nil
+}
+
+func (s *MemoryEphemeralStore) Take(_ context.Context, key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	delete(s.values, key)
+	if !ok || !time.Now().Before(v.expiresAt) {
+		return nil, ErrEphemeralValueNotFound
+	}
+	return v.value, nil
+}
+
+func (s *MemoryEphemeralStore) Count(_ context.Context, prefix string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	count := 0
+	for key, v := range s.values {
+		if strings.HasPrefix(key, prefix) && now.Before(v.expiresAt) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *MemoryEphemeralStore) CleanupExpired(_ context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, v := range s.values {
+		if !now.Before(v.expiresAt) {
+			delete(s.values, key)
+		}
+	}
+	return nil
+}
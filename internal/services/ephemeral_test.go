@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupPostgresEphemeralStore(t *testing.T) (*PostgresEphemeralStore, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	t.Cleanup(func() { mock.Close() })
+
+	db := &database.DB{Pool: mock}
+	return NewPostgresEphemeralStore(db), mock
+}
+
+func TestMemoryEphemeralStore_TakeOnce(t *testing.T) {
+	store := NewMemoryEphemeralStore()
+	ctx := context.Background()
+
+	require.NoError(t, PutJSON(ctx, store, "key", map[string]string{"a": "b"}, time.Minute))
+
+	var v map[string]string
+	require.NoError(t, GetJSON(ctx, store, "key", &v))
+	assert.Equal(t, "b", v["a"])
+
+	require.NoError(t, TakeJSON(ctx, store, "key", &v))
+	assert.ErrorIs(t, TakeJSON(ctx, store, "key", &v), ErrEphemeralValueNotFound)
+	assert.ErrorIs(t, GetJSON(ctx, store, "key", &v), ErrEphemeralValueNotFound)
+}
+
+func TestMemoryEphemeralStore_Expired(t *testing.T) {
+	store := NewMemoryEphemeralStore()
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "expired", []byte("x"), -time.Second))
+	require.NoError(t, store.Put(ctx, "live", []byte("y"), time.Minute))
+
+	_, err := store.Get(ctx, "expired")
+	assert.ErrorIs(t, err, ErrEphemeralValueNotFound)
+
+	require.NoError(t, store.CleanupExpired(ctx))
+	assert.Len(t, store.values, 1)
+
+	value, err := store.Take(ctx, "live")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("y"), value)
+}
+
+func TestMemoryEphemeralStore_Add(t *testing.T) {
+	store := NewMemoryEphemeralStore()
+	ctx := context.Background()
+
+	require.NoError(t, store.Add(ctx, "key", nil, time.Minute))
+	assert.ErrorIs(t, store.Add(ctx, "key", nil, time.Minute), ErrEphemeralValueExists)
+
+	// An expired value can be replaced
+	require.NoError(t, store.Put(ctx, "expired", nil, -time.Second))
+	assert.NoError(t, store.Add(ctx, "expired", nil, time.Minute))
+}
+
+func TestMemoryEphemeralStore_Count(t *testing.T) {
+	store := NewMemoryEphemeralStore()
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, "a:1", []byte("x"), time.Minute))
+	require.NoError(t, store.Put(ctx, "a:2", []byte("x"), time.Minute))
+	require.NoError(t, store.Put(ctx, "a:3", []byte("x"), -time.Second))
+	require.NoError(t, store.Put(ctx, "b:1", []byte("x"), time.Minute))
+
+	count, err := store.Count(ctx, "a:")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestPostgresEphemeralStore_Count(t *testing.T) {
+	store, mock := setupPostgresEphemeralStore(t)
+
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM ephemeral_values WHERE starts_with\(key, \$1\) AND expires_at > NOW\(\)`).
+		WithArgs("a_b:").
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(3))
+
+	count, err := store.Count(context.Background(), "a_b:")
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresEphemeralStore_Add_Exists(t *testing.T) {
+	store, mock := setupPostgresEphemeralStore(t)
+
+	mock.ExpectExec(`INSERT INTO ephemeral_values .+ WHERE ephemeral_values.expires_at <= NOW\(\)`).
+		WithArgs("key", []byte(nil), float64(60)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+	assert.ErrorIs(t, store.Add(context.Background(), "key", nil, time.Minute), ErrEphemeralValueExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresEphemeralStore_Put(t *testing.T) {
+	store, mock := setupPostgresEphemeralStore(t)
+
+	mock.ExpectExec(`INSERT INTO ephemeral_values .+ ON CONFLICT \(key\) DO UPDATE`).
+		WithArgs("key", []byte("x"), float64(30)).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	assert.NoError(t, store.Put(context.Background(), "key", []byte("x"), 30*time.Second))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresEphemeralStore_Take(t *testing.T) {
+	store, mock := setupPostgresEphemeralStore(t)
+
+	mock.ExpectQuery(`DELETE FROM ephemeral_values WHERE key = \$1`).
+		WithArgs("key").
+		WillReturnRows(pgxmock.NewRows([]string{"value", "valid"}).AddRow([]byte("x"), true))
+
+	value, err := store.Take(context.Background(), "key")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("x"), value)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresEphemeralStore_Take_NotFound(t *testing.T) {
+	store, mock := setupPostgresEphemeralStore(t)
+
+	// An expired value is removed but not returned
+	mock.ExpectQuery(`DELETE FROM ephemeral_values WHERE key = \$1`).
+		WithArgs("expired").
+		WillReturnRows(pgxmock.NewRows([]string{"value", "valid"}).AddRow([]byte("x"), false))
+	mock.ExpectQuery(`DELETE FROM ephemeral_values WHERE key = \$1`).
+		WithArgs("missing").
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err := store.Take(context.Background(), "expired")
+	assert.ErrorIs(t, err, ErrEphemeralValueNotFound)
+	_, err = store.Take(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrEphemeralValueNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,1322 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+var (
+	ErrUnsupportedExportFormat = errors.New("unsupported export format")
+	ErrInvalidVariableMode     = errors.New("invalid variable mode")
+	ErrEnvironmentNotFound     = errors.New("environment not found")
+)
+
+// ExportFormat identifies the document produced by an export.
+type ExportFormat string
+
+const (
+	ExportFormatOpenAPI ExportFormat = "openapi"
+	ExportFormatPostman ExportFormat = "postman"
+	ExportFormatCurl    ExportFormat = "curl"
+	ExportFormatHAR     ExportFormat = "har"
+)
+
+// VariableMode controls what happens to {{var}} placeholders on export.
+type VariableMode string
+
+const (
+	VariablesKeep       VariableMode = "keep"
+	VariablesSubstitute VariableMode = "substitute"
+)
+
+// ExportOptions selects the export format and how variables are handled.
+type ExportOptions struct {
+	Format ExportFormat
+	// Environment is the ID or name of the environment providing variable
+	// values; empty selects the collection's active environment
+	Environment string
+	// Variables substitutes or keeps placeholders. Empty uses the format
+	// default: substitute for HAR, keep for everything else
+	Variables VariableMode
+}
+
+// ExportResult is a rendered export document.
+type ExportResult struct {
+	ContentType string
+	Filename    string
+	Body        []byte
+}
+
+// exportVariable matches {{var}} placeholders, allowing inner spaces.
+var exportVariable = regexp.MustCompile(`\{\{\s*([^{}\s]+)\s*\}\}`)
+
+// ExportService renders Nikode collections as OpenAPI documents, Postman
+// collections, curl scripts or HAR archives.
+type ExportService struct{}
+
+func NewExportService() *ExportService {
+	return &ExportService{}
+}
+
+// exportContext carries the collection and the selected environment through
+// an export.
+type exportContext struct {
+	name       string
+	collection NikodeCollection
+	env        *Environment
+	values     map[string]string
+	substitute bool
+}
+
+// exportRequest is a request item with the folders above it and the auth it
+// ends up using after inheritance.
+type exportRequest struct {
+	item    CollectionItem
+	folders []CollectionItem
+	auth    *Auth
+}
+
+// Export renders collection data in the requested format. name is the stored
+// collection name, which takes precedence over the name inside data.
+func (s *ExportService) Export(name string, data json.RawMessage, opts ExportOptions) (*ExportResult, error) {
+	switch opts.Format {
+	case ExportFormatOpenAPI, ExportFormatPostman, ExportFormatCurl, ExportFormatHAR:
+	default:
+		return nil, ErrUnsupportedExportFormat
+	}
+
+	mode := opts.Variables
+	if mode == "" {
+		mode = VariablesKeep
+		if opts.Format == ExportFormatHAR {
+			mode = VariablesSubstitute
+		}
+	}
+	if mode != VariablesKeep && mode != VariablesSubstitute {
+		return nil, ErrInvalidVariableMode
+	}
+
+	var collection NikodeCollection
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &collection); err != nil {
+			return nil, fmt.Errorf("failed to parse collection: %w", err)
+		}
+	}
+	if name == "" {
+		name = collection.Name
+	}
+
+	x := &exportContext{
+		name:       name,
+		collection: collection,
+		substitute: mode == VariablesSubstitute,
+	}
+
+	env, err := selectEnvironment(&x.collection, opts.Environment)
+	if err != nil && opts.Environment != "" {
+		return nil, err
+	}
+	x.env = env
+	x.values = environmentValues(x.env)
+
+	var requests []exportRequest
+	flattenExportRequests(collection.Items, nil, collection.Auth, &requests)
+
+	var body []byte
+	var extension string
+	result := &ExportResult{}
+	switch opts.Format {
+	case ExportFormatOpenAPI:
+		body, err = s.exportOpenAPI(x, requests)
+		result.ContentType = "application/vnd.oai.openapi+json"
+		extension = ".openapi.json"
+	case ExportFormatPostman:
+		body, err = s.exportPostman(x)
+		result.ContentType = "application/json"
+		extension = ".postman_collection.json"
+	case ExportFormatCurl:
+		body = s.exportCurl(x, requests)
+		result.ContentType = "application/x-sh"
+		extension = ".sh"
+	case ExportFormatHAR:
+		body, err = s.exportHAR(x, requests)
+		result.ContentType = "application/json"
+		extension = ".har"
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Body = body
+
+	result.Filename = slugifyText(name)
+	if result.Filename == "" {
+		result.Filename = "collection"
+	}
+	result.Filename += extension
+
+	return result, nil
+}
+
+// SelectEnvironment returns the environment of collection data matching ref
+// by ID or name. An empty ref selects the active environment, falling back to
+// the first one.
+func SelectEnvironment(data json.RawMessage, ref string) (*Environment, error) {
+	var collection NikodeCollection
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &collection); err != nil {
+			return nil, fmt.Errorf("failed to parse collection: %w", err)
+		}
+	}
+	return selectEnvironment(&collection, ref)
+}
+
+func selectEnvironment(collection *NikodeCollection, ref string) (*Environment, error) {
+	if ref != "" {
+		for i := range collection.Environments {
+			env := &collection.Environments[i]
+			if env.ID == ref || env.Name == ref {
+				return env, nil
+			}
+		}
+		return nil, ErrEnvironmentNotFound
+	}
+
+	for i := range collection.Environments {
+		if collection.Environments[i].ID == collection.ActiveEnvironmentID {
+			return &collection.Environments[i], nil
+		}
+	}
+	if len(collection.Environments) > 0 {
+		return &collection.Environments[0], nil
+	}
+	return nil, ErrEnvironmentNotFound
+}
+
+// flattenExportRequests collects HTTP and GraphQL requests depth first.
+// WebSocket items have no equivalent in the export formats and are skipped.
+func flattenExportRequests(items []CollectionItem, folders []CollectionItem, inherited *Auth, out *[]exportRequest) {
+	for _, item := range items {
+		auth := inherited
+		if item.Auth != nil {
+			auth = item.Auth
+		}
+
+		switch item.Type {
+		case "folder":
+			path := append(append([]CollectionItem{}, folders...), item)
+			flattenExportRequests(item.Items, path, auth, out)
+		case "websocket":
+		default:
+			*out = append(*out, exportRequest{item: item, folders: folders, auth: auth})
+		}
+	}
+}
+
+// resolve substitutes placeholders when the export substitutes variables.
+func (x *exportContext) resolve(value string) string {
+	if !x.substitute {
+		return value
+	}
+	return x.expand(value)
+}
+
+// expand replaces placeholders with the selected environment's values.
+func (x *exportContext) expand(value string) string {
+	return expandVariables(value, x.values)
+}
+
+// expandVariables replaces placeholders with values, following variables
+// that refer to other variables. Unknown placeholders are kept.
+func expandVariables(value string, values map[string]string) string {
+	for i := 0; i < 5 && strings.Contains(value, "{{"); i++ {
+		next := exportVariable.ReplaceAllStringFunc(value, func(match string) string {
+			if v, ok := values[exportVariable.FindStringSubmatch(match)[1]]; ok {
+				return v
+			}
+			return match
+		})
+		if next == value {
+			break
+		}
+		value = next
+	}
+	return value
+}
+
+// environmentValues returns the enabled variables of env.
+func environmentValues(env *Environment) map[string]string {
+	values := make(map[string]string)
+	if env != nil {
+		for _, v := range env.Variables {
+			if v.Enabled {
+				values[v.Key] = v.Value
+			}
+		}
+	}
+	return values
+}
+
+// method returns the HTTP method, which is always POST for GraphQL.
+func (r exportRequest) method() string {
+	if r.item.Type == "graphql" {
+		return "POST"
+	}
+	if r.item.Method == "" {
+		return "GET"
+	}
+	return strings.ToUpper(r.item.Method)
+}
+
+// graphQLBody returns the JSON body sent for a GraphQL item.
+func (r exportRequest) graphQLBody() map[string]any {
+	body := map[string]any{"query": r.item.GqlQuery}
+	var variables any
+	if err := json.Unmarshal([]byte(r.item.GqlVariables), &variables); err == nil && variables != nil {
+		body["variables"] = variables
+	}
+	if r.item.GqlOperationName != "" {
+		body["operationName"] = r.item.GqlOperationName
+	}
+	return body
+}
+
+// header returns the value of an enabled header.
+func (r exportRequest) header(name string) (string, bool) {
+	for _, h := range r.item.Headers {
+		if h.Enabled && strings.EqualFold(h.Key, name) {
+			return h.Value, true
+		}
+	}
+	return "", false
+}
+
+// folderPath returns the names of the enclosing folders.
+func (r exportRequest) folderPath() []string {
+	names := make([]string, len(r.folders))
+	for i, folder := range r.folders {
+		names[i] = folder.Name
+	}
+	return names
+}
+
+// splitExportURL splits a request URL into a server prefix (a leading
+// variable such as {{baseUrl}} or an absolute origin), a path and a query.
+func splitExportURL(raw string) (server, path, query string) {
+	raw, _, _ = strings.Cut(raw, "#")
+	raw, query, _ = strings.Cut(raw, "?")
+
+	if loc := exportVariable.FindStringIndex(raw); loc != nil && loc[0] == 0 {
+		server, path = raw[:loc[1]], raw[loc[1]:]
+	} else if i := strings.Index(raw, "://"); i >= 0 {
+		if j := strings.Index(raw[i+3:], "/"); j >= 0 {
+			server, path = raw[:i+3+j], raw[i+3+j:]
+		} else {
+			server = raw
+		}
+	} else {
+		path = raw
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return server, path, query
+}
+
+// urlQueryParams parses a query string kept in a request URL.
+func urlQueryParams(query string) []KeyValue {
+	var params []KeyValue
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if v, err := url.QueryUnescape(value); err == nil {
+			value = v
+		}
+		params = append(params, KeyValue{Key: key, Value: value, Enabled: true})
+	}
+	return params
+}
+
+// queryParams returns the URL's own query parameters followed by the
+// request's params.
+func (r exportRequest) queryParams() []KeyValue {
+	_, _, query := splitExportURL(r.item.URL)
+	return append(urlQueryParams(query), r.item.Params...)
+}
+
+// baseURL returns the request URL without its query string.
+func (r exportRequest) baseURL() string {
+	base, _, _ := strings.Cut(r.item.URL, "?")
+	return base
+}
+
+// encodeQuery builds a query string from enabled params, leaving
+// placeholders unescaped.
+func encodeQuery(params []KeyValue) string {
+	var pairs []string
+	for _, p := range params {
+		if p.Enabled {
+			pairs = append(pairs, queryEscapeKeepingVariables(p.Key)+"="+queryEscapeKeepingVariables(p.Value))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func queryEscapeKeepingVariables(value string) string {
+	var b strings.Builder
+	last := 0
+	for _, loc := range exportVariable.FindAllStringIndex(value, -1) {
+		b.WriteString(url.QueryEscape(value[last:loc[0]]))
+		b.WriteString(value[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(url.QueryEscape(value[last:]))
+	return b.String()
+}
+
+// appendQuery appends a query string to a URL that may already have one.
+func appendQuery(base, query string) string {
+	if query == "" {
+		return base
+	}
+	if strings.Contains(base, "?") {
+		return base + "&" + query
+	}
+	return base + "?" + query
+}
+
+// --- OpenAPI ---
+
+// openAPIExport accumulates the shared parts of an exported OpenAPI document.
+type openAPIExport struct {
+	x            *exportContext
+	doc          *openapi3.T
+	servers      map[string]*openapi3.Server
+	tags         map[string]bool
+	operationIDs map[string]bool
+	schemes      map[string]string
+}
+
+func (s *ExportService) exportOpenAPI(x *exportContext, requests []exportRequest) ([]byte, error) {
+	version := x.collection.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+
+	b := &openAPIExport{
+		x: x,
+		doc: &openapi3.T{
+			OpenAPI:    "3.0.3",
+			Info:       &openapi3.Info{Title: x.name, Version: version},
+			Paths:      openapi3.NewPaths(),
+			Components: &openapi3.Components{SecuritySchemes: openapi3.SecuritySchemes{}},
+		},
+		servers:      make(map[string]*openapi3.Server),
+		tags:         make(map[string]bool),
+		operationIDs: make(map[string]bool),
+		schemes:      make(map[string]string),
+	}
+
+	collectionAuth := x.collection.Auth
+	if requirement := b.securityRequirement(collectionAuth); requirement != nil {
+		b.doc.Security = openapi3.SecurityRequirements{requirement}
+	}
+
+	for _, r := range requests {
+		b.addOperation(r, collectionAuth)
+	}
+
+	if len(b.doc.Components.SecuritySchemes) == 0 {
+		b.doc.Components = nil
+	}
+
+	return json.MarshalIndent(b.doc, "", "  ")
+}
+
+func (b *openAPIExport) addOperation(r exportRequest, collectionAuth *Auth) {
+	server, rawPath, _ := splitExportURL(r.item.URL)
+
+	// Path variables become path parameters
+	var pathParams []string
+	path := exportVariable.ReplaceAllStringFunc(rawPath, func(match string) string {
+		name := exportVariable.FindStringSubmatch(match)[1]
+		pathParams = append(pathParams, name)
+		return "{" + name + "}"
+	})
+
+	method := r.method()
+	pathItem := b.doc.Paths.Value(path)
+	if pathItem == nil {
+		pathItem = &openapi3.PathItem{}
+		b.doc.Paths.Set(path, pathItem)
+	}
+	if pathItem.GetOperation(method) != nil {
+		// The first request for a method and path wins
+		return
+	}
+
+	op := openapi3.NewOperation()
+	op.Summary = r.item.Name
+	op.Description = r.item.Docs
+	op.OperationID = b.operationID(r.item.Name, method, path)
+	op.Responses = openapi3.NewResponses(openapi3.WithStatus(200, &openapi3.ResponseRef{
+		Value: openapi3.NewResponse().WithDescription("Successful response"),
+	}))
+
+	if len(r.folders) > 0 {
+		folder := r.folders[len(r.folders)-1]
+		op.Tags = []string{folder.Name}
+		if !b.tags[folder.Name] {
+			b.tags[folder.Name] = true
+			b.doc.Tags = append(b.doc.Tags, &openapi3.Tag{Name: folder.Name, Description: folder.Docs})
+		}
+	}
+
+	if server != "" {
+		url := b.serverURL(server)
+		if len(b.doc.Servers) == 0 {
+			b.doc.Servers = openapi3.Servers{b.server(server)}
+		} else if b.doc.Servers[0].URL != url {
+			op.Servers = &openapi3.Servers{b.server(server)}
+		}
+	}
+
+	seen := make(map[string]bool)
+	addParam := func(p *openapi3.Parameter) {
+		key := p.In + ":" + strings.ToLower(p.Name)
+		if !seen[key] {
+			seen[key] = true
+			op.AddParameter(p)
+		}
+	}
+
+	for _, name := range pathParams {
+		param := openapi3.NewPathParameter(name).WithSchema(openapi3.NewStringSchema())
+		if value, ok := b.x.values[name]; ok && value != "" {
+			param.Example = value
+		}
+		addParam(param)
+	}
+	for _, p := range r.queryParams() {
+		if p.Key == "" {
+			continue
+		}
+		param := openapi3.NewQueryParameter(p.Key).WithSchema(openapi3.NewStringSchema())
+		if value := b.x.resolve(p.Value); value != "" {
+			param.Example = value
+		}
+		addParam(param)
+	}
+
+	apiKeyHeader := ""
+	if r.auth != nil && r.auth.Type == "apikey" && r.auth.In == "header" {
+		apiKeyHeader = r.auth.Key
+	}
+	for _, h := range r.item.Headers {
+		switch {
+		case h.Key == "",
+			strings.EqualFold(h.Key, "Content-Type"),
+			strings.EqualFold(h.Key, "Authorization"),
+			strings.EqualFold(h.Key, apiKeyHeader):
+			continue
+		}
+		param := openapi3.NewHeaderParameter(h.Key).WithSchema(openapi3.NewStringSchema())
+		if value := b.x.resolve(h.Value); value != "" {
+			param.Example = value
+		}
+		addParam(param)
+	}
+
+	op.RequestBody = b.requestBody(r)
+
+	if r.auth != collectionAuth {
+		requirements := openapi3.SecurityRequirements{}
+		if requirement := b.securityRequirement(r.auth); requirement != nil {
+			requirements = append(requirements, requirement)
+		}
+		if len(requirements) > 0 || len(b.doc.Security) > 0 {
+			op.Security = &requirements
+		}
+	}
+
+	pathItem.SetOperation(method, op)
+}
+
+func (b *openAPIExport) operationID(name, method, path string) string {
+	words := strings.Split(slugifyText(name), "-")
+	if words[0] == "" {
+		words = strings.Split(slugifyText(method+" "+path), "-")
+	}
+	for i := 1; i < len(words); i++ {
+		if words[i] != "" {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+	}
+	base := strings.Join(words, "")
+
+	id := base
+	for n := 2; b.operationIDs[id]; n++ {
+		id = fmt.Sprintf("%s%d", base, n)
+	}
+	b.operationIDs[id] = true
+	return id
+}
+
+// serverURL converts a server prefix into an OpenAPI server URL, turning
+// remaining placeholders into server variables.
+func (b *openAPIExport) serverURL(prefix string) string {
+	return exportVariable.ReplaceAllString(b.x.resolve(prefix), "{$1}")
+}
+
+func (b *openAPIExport) server(prefix string) *openapi3.Server {
+	if server, ok := b.servers[prefix]; ok {
+		return server
+	}
+
+	server := &openapi3.Server{URL: b.serverURL(prefix)}
+	if b.x.env != nil {
+		server.Description = b.x.env.Name
+	}
+	for _, match := range exportVariable.FindAllStringSubmatch(b.x.resolve(prefix), -1) {
+		name := match[1]
+		if server.Variables == nil {
+			server.Variables = make(map[string]*openapi3.ServerVariable)
+		}
+		variable := &openapi3.ServerVariable{Default: b.x.expand(b.x.values[name])}
+
+		// Values from the other environments become the allowed values
+		enum := []string{}
+		seen := make(map[string]bool)
+		for i := range b.x.collection.Environments {
+			values := environmentValues(&b.x.collection.Environments[i])
+			if value := expandVariables(values[name], values); value != "" && !seen[value] {
+				seen[value] = true
+				enum = append(enum, value)
+			}
+		}
+		if len(enum) > 1 && seen[variable.Default] {
+			variable.Enum = enum
+		}
+		if variable.Default == "" && len(enum) > 0 {
+			variable.Default = enum[0]
+		}
+		server.Variables[name] = variable
+	}
+
+	b.servers[prefix] = server
+	return server
+}
+
+func (b *openAPIExport) requestBody(r exportRequest) *openapi3.RequestBodyRef {
+	var mediaType string
+	content := openapi3.NewMediaType()
+
+	if r.item.Type == "graphql" {
+		body := r.graphQLBody()
+		mediaType = "application/json"
+		content.Schema = schemaFromExample(body).NewRef()
+		content.Example = body
+		return &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithContent(openapi3.Content{mediaType: content})}
+	}
+
+	body := r.item.Body
+	if body == nil {
+		return nil
+	}
+
+	switch body.Type {
+	case "json":
+		mediaType = "application/json"
+		text := b.x.resolve(body.Content)
+		var example any
+		if err := json.Unmarshal([]byte(text), &example); err == nil {
+			content.Schema = schemaFromExample(example).NewRef()
+			content.Example = example
+		} else if text != "" {
+			// Usually unquoted placeholders, which are not valid JSON
+			content.Schema = openapi3.NewSchema().NewRef()
+			content.Example = text
+		}
+	case "x-www-form-urlencoded", "form-data":
+		mediaType = "application/x-www-form-urlencoded"
+		if body.Type == "form-data" {
+			mediaType = "multipart/form-data"
+		}
+		schema := openapi3.NewObjectSchema()
+		for _, entry := range body.Entries {
+			if entry.Key == "" {
+				continue
+			}
+			property := openapi3.NewStringSchema()
+			if value := b.x.resolve(entry.Value); value != "" {
+				property.Example = value
+			}
+			schema.WithProperty(entry.Key, property)
+		}
+		content.Schema = schema.NewRef()
+	case "raw":
+		mediaType = "text/plain"
+		if value, ok := r.header("Content-Type"); ok && value != "" {
+			mediaType = value
+		}
+		content.Schema = openapi3.NewStringSchema().NewRef()
+		if text := b.x.resolve(body.Content); text != "" {
+			content.Example = text
+		}
+	case "binary":
+		mediaType = "application/octet-stream"
+		content.Schema = openapi3.NewStringSchema().WithFormat("binary").NewRef()
+	default:
+		return nil
+	}
+
+	return &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithContent(openapi3.Content{mediaType: content})}
+}
+
+// schemaFromExample infers a schema from a JSON value.
+func schemaFromExample(value any) *openapi3.Schema {
+	switch v := value.(type) {
+	case map[string]any:
+		schema := openapi3.NewObjectSchema()
+		for _, key := range sortedKeys(v) {
+			schema.WithProperty(key, schemaFromExample(v[key]))
+		}
+		return schema
+	case []any:
+		items := openapi3.NewSchema()
+		if len(v) > 0 {
+			items = schemaFromExample(v[0])
+		}
+		return openapi3.NewArraySchema().WithItems(items)
+	case string:
+		return openapi3.NewStringSchema()
+	case float64:
+		if v == float64(int64(v)) {
+			return openapi3.NewIntegerSchema()
+		}
+		return openapi3.NewFloat64Schema()
+	case bool:
+		return openapi3.NewBoolSchema()
+	}
+	schema := openapi3.NewSchema()
+	schema.Nullable = true
+	return schema
+}
+
+// securityRequirement registers a security scheme for auth and returns the
+// requirement referencing it, or nil when auth is unset or "none".
+func (b *openAPIExport) securityRequirement(auth *Auth) openapi3.SecurityRequirement {
+	if auth == nil {
+		return nil
+	}
+
+	scheme := &openapi3.SecurityScheme{}
+	var base string
+	var scopes []string
+	switch auth.Type {
+	case "bearer":
+		base = "bearerAuth"
+		scheme.Type, scheme.Scheme = "http", "bearer"
+	case "basic":
+		base = "basicAuth"
+		scheme.Type, scheme.Scheme = "http", "basic"
+	case "apikey":
+		base = "apiKeyAuth"
+		in := auth.In
+		if in == "" {
+			in = "header"
+		}
+		scheme.Type, scheme.Name, scheme.In = "apiKey", b.x.resolve(auth.Key), in
+	case "oauth2":
+		if auth.OAuth2 == nil {
+			return nil
+		}
+		base = "oauth2Auth"
+		o := auth.OAuth2
+		scopeMap := map[string]string{}
+		scopes = strings.Fields(b.x.resolve(o.Scope))
+		for _, scope := range scopes {
+			scopeMap[scope] = ""
+		}
+		flow := &openapi3.OAuthFlow{
+			AuthorizationURL: b.x.resolve(o.AuthURL),
+			TokenURL:         b.x.resolve(o.TokenURL),
+			RefreshURL:       b.x.resolve(o.RefreshURL),
+			Scopes:           scopeMap,
+		}
+		flows := &openapi3.OAuthFlows{}
+		switch o.GrantType {
+		case "client_credentials":
+			flow.AuthorizationURL = ""
+			flows.ClientCredentials = flow
+		case "password":
+			flow.AuthorizationURL = ""
+			flows.Password = flow
+		case "implicit":
+			flow.TokenURL = ""
+			flows.Implicit = flow
+		default:
+			flows.AuthorizationCode = flow
+		}
+		scheme.Type, scheme.Flows = "oauth2", flows
+	default:
+		return nil
+	}
+
+	// Identical definitions share one scheme
+	encoded, _ := json.Marshal(scheme)
+	name, ok := b.schemes[string(encoded)]
+	if !ok {
+		name = base
+		for n := 2; b.doc.Components.SecuritySchemes[name] != nil; n++ {
+			name = fmt.Sprintf("%s%d", base, n)
+		}
+		b.schemes[string(encoded)] = name
+		b.doc.Components.SecuritySchemes[name] = &openapi3.SecuritySchemeRef{Value: scheme}
+	}
+
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return openapi3.SecurityRequirement{name: scopes}
+}
+
+// --- Postman ---
+
+const postmanCollectionSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+// exportPostman produces a Postman v2.1 collection. Placeholders already use
+// Postman's syntax, so kept variables become collection variables.
+func (s *ExportService) exportPostman(x *exportContext) ([]byte, error) {
+	info := map[string]any{
+		"name":   x.name,
+		"schema": postmanCollectionSchema,
+	}
+	if x.collection.Version != "" {
+		info["version"] = x.collection.Version
+	}
+
+	collection := map[string]any{
+		"info": info,
+		"item": s.postmanItems(x, x.collection.Items),
+	}
+	if auth := s.postmanAuth(x, x.collection.Auth); auth != nil {
+		collection["auth"] = auth
+	}
+
+	if !x.substitute && x.env != nil {
+		variables := []map[string]any{}
+		for _, v := range x.env.Variables {
+			variable := map[string]any{"key": v.Key, "value": v.Value, "type": "string"}
+			if v.Secret {
+				variable["type"] = "secret"
+			}
+			if !v.Enabled {
+				variable["disabled"] = true
+			}
+			variables = append(variables, variable)
+		}
+		collection["variable"] = variables
+	}
+
+	return json.MarshalIndent(collection, "", "  ")
+}
+
+func (s *ExportService) postmanItems(x *exportContext, items []CollectionItem) []map[string]any {
+	converted := []map[string]any{}
+	for _, item := range items {
+		switch item.Type {
+		case "folder":
+			folder := map[string]any{
+				"name": item.Name,
+				"item": s.postmanItems(x, item.Items),
+			}
+			if item.Docs != "" {
+				folder["description"] = item.Docs
+			}
+			if auth := s.postmanAuth(x, item.Auth); auth != nil {
+				folder["auth"] = auth
+			}
+			converted = append(converted, folder)
+		case "websocket":
+		default:
+			converted = append(converted, s.postmanRequest(x, exportRequest{item: item}))
+		}
+	}
+	return converted
+}
+
+func (s *ExportService) postmanRequest(x *exportContext, r exportRequest) map[string]any {
+	item := r.item
+
+	headers := []map[string]any{}
+	for _, h := range item.Headers {
+		headers = append(headers, postmanKeyValue(h.Key, x.resolve(h.Value), h.Enabled))
+	}
+
+	query := []map[string]any{}
+	for _, p := range item.Params {
+		query = append(query, postmanKeyValue(p.Key, x.resolve(p.Value), p.Enabled))
+	}
+
+	var enabled []KeyValue
+	for _, p := range item.Params {
+		if p.Enabled {
+			enabled = append(enabled, KeyValue{Key: p.Key, Value: x.resolve(p.Value), Enabled: true})
+		}
+	}
+	requestURL := map[string]any{"raw": appendQuery(x.resolve(item.URL), encodeQuery(enabled))}
+	if len(query) > 0 {
+		requestURL["query"] = query
+	}
+
+	request := map[string]any{
+		"method": r.method(),
+		"header": headers,
+		"url":    requestURL,
+	}
+	if item.Docs != "" {
+		request["description"] = item.Docs
+	}
+	if auth := s.postmanAuth(x, item.Auth); auth != nil {
+		request["auth"] = auth
+	}
+
+	if item.Type == "graphql" {
+		request["body"] = map[string]any{
+			"mode": "graphql",
+			"graphql": map[string]any{
+				"query":     item.GqlQuery,
+				"variables": item.GqlVariables,
+			},
+		}
+	} else if body := s.postmanBody(x, item.Body); body != nil {
+		request["body"] = body
+	}
+
+	converted := map[string]any{
+		"name":     item.Name,
+		"request":  request,
+		"response": []any{},
+	}
+
+	if item.Scripts != nil {
+		var events []map[string]any
+		for _, script := range []struct{ listen, source string }{
+			{"prerequest", item.Scripts.Pre},
+			{"test", item.Scripts.Post},
+		} {
+			if strings.TrimSpace(script.source) == "" {
+				continue
+			}
+			events = append(events, map[string]any{
+				"listen": script.listen,
+				"script": map[string]any{
+					"type": "text/javascript",
+					"exec": strings.Split(script.source, "\n"),
+				},
+			})
+		}
+		if events != nil {
+			converted["event"] = events
+		}
+	}
+
+	return converted
+}
+
+func postmanKeyValue(key, value string, enabled bool) map[string]any {
+	kv := map[string]any{"key": key, "value": value}
+	if !enabled {
+		kv["disabled"] = true
+	}
+	return kv
+}
+
+func (s *ExportService) postmanBody(x *exportContext, body *RequestBody) map[string]any {
+	if body == nil {
+		return nil
+	}
+
+	entries := func(typed bool) []map[string]any {
+		converted := []map[string]any{}
+		for _, e := range body.Entries {
+			entry := postmanKeyValue(e.Key, x.resolve(e.Value), e.Enabled)
+			if typed {
+				entry["type"] = "text"
+			}
+			converted = append(converted, entry)
+		}
+		return converted
+	}
+
+	switch body.Type {
+	case "json":
+		return map[string]any{
+			"mode":    "raw",
+			"raw":     x.resolve(body.Content),
+			"options": map[string]any{"raw": map[string]any{"language": "json"}},
+		}
+	case "raw":
+		return map[string]any{"mode": "raw", "raw": x.resolve(body.Content)}
+	case "x-www-form-urlencoded":
+		return map[string]any{"mode": "urlencoded", "urlencoded": entries(false)}
+	case "form-data":
+		return map[string]any{"mode": "formdata", "formdata": entries(true)}
+	case "binary":
+		return map[string]any{"mode": "file", "file": map[string]any{}}
+	}
+	return nil
+}
+
+func (s *ExportService) postmanAuth(x *exportContext, auth *Auth) map[string]any {
+	if auth == nil {
+		return nil
+	}
+
+	params := func(values ...string) []map[string]any {
+		converted := []map[string]any{}
+		for i := 0; i+1 < len(values); i += 2 {
+			converted = append(converted, map[string]any{"key": values[i], "value": x.resolve(values[i+1]), "type": "string"})
+		}
+		return converted
+	}
+
+	switch auth.Type {
+	case "none":
+		return map[string]any{"type": "noauth"}
+	case "bearer":
+		return map[string]any{"type": "bearer", "bearer": params("token", auth.Token)}
+	case "basic":
+		return map[string]any{"type": "basic", "basic": params("username", auth.Username, "password", auth.Password)}
+	case "apikey":
+		in := auth.In
+		if in == "" || in == "cookie" {
+			// Postman API keys go in a header or the query string
+			in = "header"
+		}
+		return map[string]any{"type": "apikey", "apikey": params("key", auth.Key, "value", auth.Value, "in", in)}
+	case "oauth2":
+		if auth.OAuth2 == nil {
+			return nil
+		}
+		o := auth.OAuth2
+		grantType := o.GrantType
+		if grantType == "password" {
+			grantType = "password_credentials"
+		}
+		return map[string]any{"type": "oauth2", "oauth2": params(
+			"grant_type", grantType,
+			"authUrl", o.AuthURL,
+			"accessTokenUrl", o.TokenURL,
+			"clientId", o.ClientID,
+			"clientSecret", o.ClientSecret,
+			"scope", o.Scope,
+			"accessToken", o.AccessToken,
+		)}
+	}
+	return nil
+}
+
+// --- curl ---
+
+// curlEscaper escapes text inside a double-quoted shell string.
+var curlEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "`", "\\`")
+
+// curlScript renders requests as a shell script. Kept variables become shell
+// variables with the environment's values as defaults.
+type curlScript struct {
+	x    *exportContext
+	used map[string]string
+}
+
+func (s *ExportService) exportCurl(x *exportContext, requests []exportRequest) []byte {
+	c := &curlScript{x: x, used: make(map[string]string)}
+
+	var commands []string
+	for _, r := range requests {
+		commands = append(commands, c.command(r))
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# " + strings.ReplaceAll(x.name, "\n", " ") + "\n")
+	if x.env != nil {
+		b.WriteString("# Environment: " + x.env.Name + "\n")
+	}
+
+	if len(c.used) > 0 {
+		b.WriteString("\n")
+		for _, name := range sortedKeys(c.used) {
+			b.WriteString(`: "${` + name + `:=` + curlEscaper.Replace(c.used[name]) + `}"` + "\n")
+		}
+	}
+
+	for _, command := range commands {
+		b.WriteString("\n" + command + "\n")
+	}
+	return []byte(b.String())
+}
+
+func (c *curlScript) command(r exportRequest) string {
+	item := r.item
+	title := append(r.folderPath(), item.Name)
+
+	args := []string{"curl"}
+	switch method := r.method(); method {
+	case "GET":
+	case "HEAD":
+		args = append(args, "--head")
+	default:
+		args = append(args, "-X "+method)
+	}
+
+	var query []KeyValue
+	for _, p := range r.queryParams() {
+		if p.Enabled {
+			query = append(query, p)
+		}
+	}
+
+	var headers []string
+	addHeader := func(key, value string) {
+		headers = append(headers, "-H "+c.quote(key+": "+value))
+	}
+	for _, h := range item.Headers {
+		if h.Enabled && h.Key != "" {
+			addHeader(h.Key, h.Value)
+		}
+	}
+
+	var authArgs []string
+	if auth := r.auth; auth != nil {
+		switch auth.Type {
+		case "bearer":
+			addHeader("Authorization", "Bearer "+auth.Token)
+		case "basic":
+			authArgs = append(authArgs, "-u "+c.quote(auth.Username+":"+auth.Password))
+		case "apikey":
+			switch auth.In {
+			case "query":
+				query = append(query, KeyValue{Key: auth.Key, Value: auth.Value, Enabled: true})
+			case "cookie":
+				authArgs = append(authArgs, "-b "+c.quote(auth.Key+"="+auth.Value))
+			default:
+				addHeader(auth.Key, auth.Value)
+			}
+		case "oauth2":
+			if auth.OAuth2 != nil && auth.OAuth2.AccessToken != "" {
+				addHeader("Authorization", "Bearer "+auth.OAuth2.AccessToken)
+			}
+		}
+	}
+
+	_, hasContentType := r.header("Content-Type")
+	var bodyArgs []string
+	if item.Type == "graphql" {
+		encoded, _ := json.Marshal(r.graphQLBody())
+		if !hasContentType {
+			addHeader("Content-Type", "application/json")
+		}
+		bodyArgs = append(bodyArgs, "--data-raw "+c.quote(string(encoded)))
+	} else if body := item.Body; body != nil {
+		switch body.Type {
+		case "json":
+			if !hasContentType {
+				addHeader("Content-Type", "application/json")
+			}
+			bodyArgs = append(bodyArgs, "--data-raw "+c.quote(body.Content))
+		case "raw":
+			bodyArgs = append(bodyArgs, "--data-raw "+c.quote(body.Content))
+		case "x-www-form-urlencoded":
+			for _, e := range body.Entries {
+				if e.Enabled {
+					bodyArgs = append(bodyArgs, "--data-urlencode "+c.quote(e.Key+"="+e.Value))
+				}
+			}
+		case "form-data":
+			for _, e := range body.Entries {
+				if e.Enabled {
+					bodyArgs = append(bodyArgs, "-F "+c.quote(e.Key+"="+e.Value))
+				}
+			}
+		case "binary":
+			bodyArgs = append(bodyArgs, `--data-binary "@body.bin"`)
+		}
+	}
+
+	args = append(args, c.quote(appendQuery(r.baseURL(), encodeQuery(query))))
+
+	// Method and URL on the first line, one option per continuation line
+	lines := []string{strings.Join(args, " ")}
+	lines = append(lines, headers...)
+	lines = append(lines, authArgs...)
+	lines = append(lines, bodyArgs...)
+
+	return "# " + strings.Join(title, " / ") + "\n" + strings.Join(lines, " \\\n  ")
+}
+
+// quote returns value as a double-quoted shell word. Substituted exports
+// resolve placeholders first; kept placeholders become shell variables.
+func (c *curlScript) quote(value string) string {
+	escaped := curlEscaper.Replace(c.x.resolve(value))
+	if !c.x.substitute {
+		escaped = exportVariable.ReplaceAllStringFunc(escaped, func(match string) string {
+			key := exportVariable.FindStringSubmatch(match)[1]
+			name := shellVariableName(key)
+			c.used[name] = c.x.expand(c.x.values[key])
+			return "${" + name + "}"
+		})
+	}
+	return `"` + escaped + `"`
+}
+
+var shellVariableInvalid = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+func shellVariableName(key string) string {
+	name := shellVariableInvalid.ReplaceAllString(key, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
+
+// --- HAR ---
+
+func (s *ExportService) exportHAR(x *exportContext, requests []exportRequest) ([]byte, error) {
+	archive := harArchive{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "Nikode", Version: "1.0"},
+		Entries: []harEntry{},
+	}}
+	started := time.Now().UTC().Format(time.RFC3339)
+
+	for _, r := range requests {
+		request := harRequest{
+			Method:      r.method(),
+			HTTPVersion: "HTTP/1.1",
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+
+		for _, p := range r.queryParams() {
+			if p.Enabled {
+				request.QueryString = append(request.QueryString, harNameValue{Name: x.resolve(p.Key), Value: x.resolve(p.Value)})
+			}
+		}
+		for _, h := range r.item.Headers {
+			if h.Enabled && h.Key != "" {
+				request.Headers = append(request.Headers, harNameValue{Name: h.Key, Value: x.resolve(h.Value)})
+			}
+		}
+
+		if auth := r.auth; auth != nil {
+			switch auth.Type {
+			case "bearer":
+				request.Headers = append(request.Headers, harNameValue{Name: "Authorization", Value: "Bearer " + x.resolve(auth.Token)})
+			case "basic":
+				credentials := x.resolve(auth.Username) + ":" + x.resolve(auth.Password)
+				request.Headers = append(request.Headers, harNameValue{Name: "Authorization", Value: "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))})
+			case "apikey":
+				kv := harNameValue{Name: x.resolve(auth.Key), Value: x.resolve(auth.Value)}
+				switch auth.In {
+				case "query":
+					request.QueryString = append(request.QueryString, kv)
+				case "cookie":
+					request.Cookies = append(request.Cookies, kv)
+				default:
+					request.Headers = append(request.Headers, kv)
+				}
+			case "oauth2":
+				if auth.OAuth2 != nil && auth.OAuth2.AccessToken != "" {
+					request.Headers = append(request.Headers, harNameValue{Name: "Authorization", Value: "Bearer " + x.resolve(auth.OAuth2.AccessToken)})
+				}
+			}
+		}
+
+		var query []KeyValue
+		for _, q := range request.QueryString {
+			query = append(query, KeyValue{Key: q.Name, Value: q.Value, Enabled: true})
+		}
+		request.URL = appendQuery(x.resolve(r.baseURL()), encodeQuery(query))
+		request.PostData = s.harPostData(x, r)
+
+		if request.PostData != nil {
+			if _, ok := r.header("Content-Type"); !ok && request.PostData.MimeType != "" {
+				request.Headers = append(request.Headers, harNameValue{Name: "Content-Type", Value: request.PostData.MimeType})
+			}
+		}
+
+		archive.Log.Entries = append(archive.Log.Entries, harEntry{
+			StartedDateTime: started,
+			Request:         request,
+			Response: harResponse{
+				HTTPVersion: "HTTP/1.1",
+				Cookies:     []harNameValue{},
+				Headers:     []harNameValue{},
+				HeadersSize: -1,
+				BodySize:    -1,
+			},
+			Cache: map[string]any{},
+		})
+	}
+
+	return json.MarshalIndent(archive, "", "  ")
+}
+
+func (s *ExportService) harPostData(x *exportContext, r exportRequest) *harPostData {
+	if r.item.Type == "graphql" {
+		encoded, _ := json.Marshal(r.graphQLBody())
+		return &harPostData{MimeType: "application/json", Text: x.resolve(string(encoded))}
+	}
+
+	body := r.item.Body
+	if body == nil {
+		return nil
+	}
+
+	var params []harNameValue
+	for _, e := range body.Entries {
+		if e.Enabled {
+			params = append(params, harNameValue{Name: x.resolve(e.Key), Value: x.resolve(e.Value)})
+		}
+	}
+
+	switch body.Type {
+	case "json":
+		return &harPostData{MimeType: "application/json", Text: x.resolve(body.Content)}
+	case "raw":
+		mimeType := "text/plain"
+		if value, ok := r.header("Content-Type"); ok {
+			mimeType = x.resolve(value)
+		}
+		return &harPostData{MimeType: mimeType, Text: x.resolve(body.Content)}
+	case "x-www-form-urlencoded":
+		values := url.Values{}
+		for _, p := range params {
+			values.Add(p.Name, p.Value)
+		}
+		return &harPostData{MimeType: "application/x-www-form-urlencoded", Text: values.Encode(), Params: params}
+	case "form-data":
+		return &harPostData{MimeType: "multipart/form-data", Params: params}
+	case "binary":
+		return &harPostData{MimeType: "application/octet-stream"}
+	}
+	return nil
+}
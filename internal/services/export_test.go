@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testExportCollection = `{
+	"name": "Shop",
+	"version": "1.2.0",
+	"activeEnvironmentId": "env-local",
+	"auth": {"type": "bearer", "token": "{{token}}"},
+	"environments": [
+		{"id": "env-local", "name": "Local", "variables": [
+			{"key": "baseUrl", "value": "http://localhost:8080", "enabled": true},
+			{"key": "token", "value": "dev-token", "enabled": true},
+			{"key": "orderId", "value": "42", "enabled": true}
+		]},
+		{"id": "env-prod", "name": "Production", "variables": [
+			{"key": "baseUrl", "value": "https://{{host}}/v1", "enabled": true},
+			{"key": "host", "value": "shop.example.com", "enabled": true},
+			{"key": "token", "value": "prod-token", "enabled": true}
+		]}
+	],
+	"items": [
+		{"id": "f1", "type": "folder", "name": "Orders", "docs": "Order management", "items": [
+			{"id": "r1", "type": "request", "name": "Get order", "method": "GET",
+				"url": "{{baseUrl}}/orders/{{orderId}}?expand=items",
+				"params": [{"key": "fields", "value": "id,total", "enabled": false}],
+				"headers": [{"key": "Accept", "value": "application/json", "enabled": true}],
+				"docs": "Fetch one order"},
+			{"id": "r2", "type": "request", "name": "Create order", "method": "POST",
+				"url": "{{baseUrl}}/orders",
+				"body": {"type": "json", "content": "{\"sku\": \"abc\", \"quantity\": 2, \"price\": 9.5, \"gift\": false, \"tags\": [\"new\"]}"},
+				"auth": {"type": "apikey", "key": "X-Api-Key", "value": "k'1", "in": "header"}}
+		]},
+		{"id": "r3", "type": "request", "name": "Health", "method": "GET", "url": "{{baseUrl}}/health", "auth": {"type": "none"}},
+		{"id": "r4", "type": "request", "name": "Login", "method": "POST", "url": "https://auth.example.com/login",
+			"body": {"type": "x-www-form-urlencoded", "entries": [{"key": "user", "value": "ada", "enabled": true}]}},
+		{"id": "g1", "type": "graphql", "name": "Products", "url": "{{baseUrl}}/graphql",
+			"gqlQuery": "query Products { products { id } }", "gqlVariables": "{\"first\": 5}"},
+		{"id": "w1", "type": "websocket", "name": "Live", "url": "ws://localhost:8080/live"}
+	]
+}`
+
+func exportTestCollection(t *testing.T, opts ExportOptions) *ExportResult {
+	t.Helper()
+	result, err := NewExportService().Export("Shop API", json.RawMessage(testExportCollection), opts)
+	require.NoError(t, err)
+	return result
+}
+
+func TestExportService_Export_OpenAPI(t *testing.T) {
+	result := exportTestCollection(t, ExportOptions{Format: ExportFormatOpenAPI})
+	assert.Equal(t, "application/vnd.oai.openapi+json", result.ContentType)
+
+	doc, err := openapi3.NewLoader().LoadFromData(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+
+	assert.Equal(t, "Shop API", doc.Info.Title)
+	assert.Equal(t, "1.2.0", doc.Info.Version)
+
+	require.Len(t, doc.Servers, 1)
+	assert.Equal(t, "{baseUrl}", doc.Servers[0].URL)
+	assert.Equal(t, "http://localhost:8080", doc.Servers[0].Variables["baseUrl"].Default)
+	assert.Equal(t, []string{"http://localhost:8080", "https://shop.example.com/v1"}, doc.Servers[0].Variables["baseUrl"].Enum)
+
+	require.Len(t, doc.Tags, 1)
+	assert.Equal(t, "Orders", doc.Tags[0].Name)
+	assert.Equal(t, "Order management", doc.Tags[0].Description)
+
+	assert.Equal(t, openapi3.SecurityRequirements{{"bearerAuth": []string{}}}, doc.Security)
+	assert.Equal(t, "bearer", doc.Components.SecuritySchemes["bearerAuth"].Value.Scheme)
+
+	getOrder := doc.Paths.Value("/orders/{orderId}").Get
+	require.NotNil(t, getOrder)
+	assert.Equal(t, "getOrder", getOrder.OperationID)
+	assert.Equal(t, []string{"Orders"}, getOrder.Tags)
+	assert.Equal(t, "Fetch one order", getOrder.Description)
+	assert.Nil(t, getOrder.Security, "inherits the document security")
+	orderID := getOrder.Parameters.GetByInAndName("path", "orderId")
+	require.NotNil(t, orderID)
+	assert.True(t, orderID.Required)
+	assert.Equal(t, "42", orderID.Example)
+	assert.NotNil(t, getOrder.Parameters.GetByInAndName("query", "expand"))
+	assert.NotNil(t, getOrder.Parameters.GetByInAndName("query", "fields"))
+	assert.NotNil(t, getOrder.Parameters.GetByInAndName("header", "Accept"))
+
+	createOrder := doc.Paths.Value("/orders").Post
+	require.NotNil(t, createOrder)
+	assert.Equal(t, &openapi3.SecurityRequirements{{"apiKeyAuth": []string{}}}, createOrder.Security)
+	body := createOrder.RequestBody.Value.Content.Get("application/json")
+	require.NotNil(t, body)
+	properties := body.Schema.Value.Properties
+	assert.True(t, properties["sku"].Value.Type.Is("string"))
+	assert.True(t, properties["quantity"].Value.Type.Is("integer"))
+	assert.True(t, properties["price"].Value.Type.Is("number"))
+	assert.True(t, properties["gift"].Value.Type.Is("boolean"))
+	assert.True(t, properties["tags"].Value.Items.Value.Type.Is("string"))
+
+	health := doc.Paths.Value("/health").Get
+	assert.Equal(t, &openapi3.SecurityRequirements{}, health.Security, "auth none clears security")
+
+	login := doc.Paths.Value("/login").Post
+	require.NotNil(t, login.Servers)
+	assert.Equal(t, "https://auth.example.com", (*login.Servers)[0].URL)
+	assert.NotNil(t, login.RequestBody.Value.Content.Get("application/x-www-form-urlencoded"))
+
+	graphql := doc.Paths.Value("/graphql").Post
+	require.NotNil(t, graphql)
+	assert.Equal(t, map[string]any{"query": "query Products { products { id } }", "variables": map[string]any{"first": float64(5)}},
+		graphql.RequestBody.Value.Content.Get("application/json").Example)
+
+	assert.Nil(t, doc.Paths.Value("/live"), "websocket items are skipped")
+}
+
+func TestExportService_Export_OpenAPISubstitute(t *testing.T) {
+	result := exportTestCollection(t, ExportOptions{Format: ExportFormatOpenAPI, Environment: "Production", Variables: VariablesSubstitute})
+
+	doc, err := openapi3.NewLoader().LoadFromData(result.Body)
+	require.NoError(t, err)
+	require.NoError(t, doc.Validate(context.Background()))
+
+	require.Len(t, doc.Servers, 1)
+	assert.Equal(t, "https://shop.example.com/v1", doc.Servers[0].URL)
+	assert.Equal(t, "Production", doc.Servers[0].Description)
+	assert.NotNil(t, doc.Paths.Value("/orders/{orderId}"), "path variables stay parameters")
+}
+
+func TestExportService_Export_Postman(t *testing.T) {
+	result := exportTestCollection(t, ExportOptions{Format: ExportFormatPostman})
+	assert.Equal(t, "application/json", result.ContentType)
+
+	// The export round-trips through the Postman importer
+	collection := convertPostmanTestCollection(t, string(result.Body))
+	assert.Equal(t, "Shop API", collection.Name)
+	assert.Equal(t, "1.2.0", collection.Version)
+	assert.Equal(t, &Auth{Type: "bearer", Token: "{{token}}"}, collection.Auth)
+	assert.Equal(t, "dev-token", collection.Environments[0].Variables[1].Value)
+
+	require.Len(t, collection.Items, 4)
+	orders := collection.Items[0]
+	assert.Equal(t, "folder", orders.Type)
+	getOrder := orders.Items[0]
+	assert.Equal(t, "{{baseUrl}}/orders/{{orderId}}", getOrder.URL)
+	assert.Equal(t, []KeyValue{{Key: "fields", Value: "id,total", Enabled: false}}, getOrder.Params)
+	assert.Equal(t, "json", orders.Items[1].Body.Type)
+	assert.Equal(t, &Auth{Type: "apikey", Key: "X-Api-Key", Value: "k'1", In: "header"}, orders.Items[1].Auth)
+	assert.Equal(t, "none", collection.Items[1].Auth.Type)
+	assert.Equal(t, "graphql", collection.Items[3].Type)
+	assert.Equal(t, `{"first": 5}`, collection.Items[3].GqlVariables)
+}
+
+func TestExportService_Export_Curl(t *testing.T) {
+	result := exportTestCollection(t, ExportOptions{Format: ExportFormatCurl})
+	script := string(result.Body)
+
+	assert.True(t, strings.HasPrefix(script, "#!/bin/sh\n# Shop API\n# Environment: Local\n"))
+	assert.Contains(t, script, `: "${baseUrl:=http://localhost:8080}"`)
+	assert.Contains(t, script, `: "${orderId:=42}"`)
+	assert.Contains(t, script, "# Orders / Get order\ncurl \"${baseUrl}/orders/${orderId}?expand=items\" \\\n  -H \"Accept: application/json\" \\\n  -H \"Authorization: Bearer ${token}\"\n")
+	assert.Contains(t, script, "# Orders / Create order\ncurl -X POST \"${baseUrl}/orders\" \\\n  -H \"X-Api-Key: k'1\" \\\n  -H \"Content-Type: application/json\" \\\n  --data-raw \"{\\\"sku\\\": \\\"abc\\\"")
+	assert.Contains(t, script, "# Health\ncurl \"${baseUrl}/health\"\n")
+	assert.Contains(t, script, "--data-urlencode \"user=ada\"")
+	assert.NotContains(t, script, "Live")
+
+	substituted := string(exportTestCollection(t, ExportOptions{Format: ExportFormatCurl, Environment: "env-prod", Variables: VariablesSubstitute}).Body)
+	assert.Contains(t, substituted, `curl "https://shop.example.com/v1/health"`)
+	assert.Contains(t, substituted, `/orders/{{orderId}}`, "unknown variables are kept")
+	assert.NotContains(t, substituted, ":=")
+}
+
+func TestExportService_Export_HAR(t *testing.T) {
+	result := exportTestCollection(t, ExportOptions{Format: ExportFormatHAR})
+	assert.Equal(t, "shop-api.har", result.Filename)
+
+	// The export round-trips through the HAR importer
+	collection := convertHARTestArchive(t, string(result.Body))
+	assert.Equal(t, "Imported from Nikode", collection.Name)
+	assert.Equal(t, "http://localhost:8080", collection.Environments[0].Variables[0].Value)
+
+	var archive harArchive
+	require.NoError(t, json.Unmarshal(result.Body, &archive))
+	require.Len(t, archive.Log.Entries, 5)
+
+	getOrder := archive.Log.Entries[0].Request
+	assert.Equal(t, "http://localhost:8080/orders/42?expand=items", getOrder.URL)
+	assert.Contains(t, getOrder.Headers, harNameValue{Name: "Authorization", Value: "Bearer dev-token"})
+
+	createOrder := archive.Log.Entries[1].Request
+	assert.Contains(t, createOrder.Headers, harNameValue{Name: "X-Api-Key", Value: "k'1"})
+	assert.Contains(t, createOrder.Headers, harNameValue{Name: "Content-Type", Value: "application/json"})
+	assert.Equal(t, "application/json", createOrder.PostData.MimeType)
+
+	login := archive.Log.Entries[3].Request
+	assert.Equal(t, "user=ada", login.PostData.Text)
+}
+
+func TestExportService_Export_Errors(t *testing.T) {
+	svc := NewExportService()
+	data := json.RawMessage(testExportCollection)
+
+	_, err := svc.Export("Shop", data, ExportOptions{Format: "insomnia"})
+	assert.ErrorIs(t, err, ErrUnsupportedExportFormat)
+
+	_, err = svc.Export("Shop", data, ExportOptions{Format: ExportFormatCurl, Variables: "expand"})
+	assert.ErrorIs(t, err, ErrInvalidVariableMode)
+
+	_, err = svc.Export("Shop", data, ExportOptions{Format: ExportFormatCurl, Environment: "Staging"})
+	assert.ErrorIs(t, err, ErrEnvironmentNotFound)
+}
+
+func TestSelectEnvironment(t *testing.T) {
+	data := json.RawMessage(testExportCollection)
+
+	env, err := SelectEnvironment(data, "")
+	require.NoError(t, err)
+	assert.Equal(t, "env-local", env.ID)
+
+	env, err = SelectEnvironment(data, "Production")
+	require.NoError(t, err)
+	assert.Equal(t, "env-prod", env.ID)
+
+	env, err = SelectEnvironment(data, "env-prod")
+	require.NoError(t, err)
+	assert.Equal(t, "Production", env.Name)
+
+	env, err = SelectEnvironment(json.RawMessage(`{"activeEnvironmentId": "gone", "environments": [{"id": "env-a", "name": "A"}]}`), "")
+	require.NoError(t, err)
+	assert.Equal(t, "env-a", env.ID)
+
+	_, err = SelectEnvironment(json.RawMessage(`{"items": []}`), "")
+	assert.ErrorIs(t, err, ErrEnvironmentNotFound)
+}
@@ -0,0 +1,1179 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultGraphQLSelectionDepth is how many levels of nested object fields
+	// are selected when no depth is requested.
+	DefaultGraphQLSelectionDepth = 3
+	// MaxGraphQLSelectionDepth caps the requested selection depth.
+	MaxGraphQLSelectionDepth = 10
+)
+
+// GraphQLService converts GraphQL schemas, given as SDL or as an
+// introspection query result, into Nikode collections with one graphql item
+// per query, mutation and subscription field.
+type GraphQLService struct {
+	openapi *OpenAPIService
+}
+
+func NewGraphQLService() *GraphQLService {
+	return &GraphQLService{openapi: NewOpenAPIService()}
+}
+
+// gqlSchema is the subset of a GraphQL type system needed to build operations.
+type gqlSchema struct {
+	queryType        string
+	mutationType     string
+	subscriptionType string
+	types            map[string]*gqlType
+}
+
+type gqlType struct {
+	kind          string // OBJECT, INTERFACE, UNION, ENUM, INPUT_OBJECT or SCALAR
+	name          string
+	fields        []gqlField
+	inputFields   []gqlInputValue
+	enumValues    []string
+	possibleTypes []string
+}
+
+type gqlField struct {
+	name        string
+	description string
+	args        []gqlInputValue
+	typ         *gqlTypeRef
+}
+
+type gqlInputValue struct {
+	name         string
+	typ          *gqlTypeRef
+	defaultValue any
+	hasDefault   bool
+}
+
+// gqlTypeRef is a type reference such as [User!]!. Exactly one of name and
+// list is set.
+type gqlTypeRef struct {
+	name    string
+	list    *gqlTypeRef
+	nonNull bool
+}
+
+func (r *gqlTypeRef) String() string {
+	s := r.name
+	if r.list != nil {
+		s = "[" + r.list.String() + "]"
+	}
+	if r.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+func (r *gqlTypeRef) namedType() string {
+	for r.list != nil {
+		r = r.list
+	}
+	return r.name
+}
+
+func (s *gqlSchema) typeFor(kind, name string) *gqlType {
+	t, ok := s.types[name]
+	if !ok {
+		t = &gqlType{kind: kind, name: name}
+		s.types[name] = t
+	}
+	return t
+}
+
+// ParseGraphQL parses a GraphQL SDL document or an introspection query result
+// (with or without the "data" envelope) and returns the schema
+func (s *GraphQLService) ParseGraphQL(content []byte) (any, error) {
+	trimmed := strings.TrimSpace(string(content))
+	if strings.HasPrefix(trimmed, "{") && strings.Contains(trimmed, `"__schema"`) {
+		return s.parseIntrospection([]byte(trimmed))
+	}
+
+	parser, err := newGQLParser(trimmed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GraphQL schema: %w", err)
+	}
+	schema, err := parser.parseDocument()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GraphQL schema: %w", err)
+	}
+	return schema, nil
+}
+
+// ConvertToNikode converts a GraphQL schema to Nikode collection format.
+// Object fields are selected up to selectionDepth levels deep; zero selects
+// DefaultGraphQLSelectionDepth.
+func (s *GraphQLService) ConvertToNikode(specInterface any, selectionDepth int) (json.RawMessage, error) {
+	schema, ok := specInterface.(*gqlSchema)
+	if !ok {
+		return nil, fmt.Errorf("invalid spec type, expected GraphQL schema")
+	}
+
+	if selectionDepth <= 0 {
+		selectionDepth = DefaultGraphQLSelectionDepth
+	}
+	selectionDepth = min(selectionDepth, MaxGraphQLSelectionDepth)
+
+	gen := &gqlGenerator{schema: schema, maxDepth: selectionDepth}
+
+	collection := NikodeCollection{
+		Name:         "GraphQL API",
+		Version:      "1.0.0",
+		Environments: s.openapi.createEnvironments(nil, "http://localhost:3000/graphql"),
+		Items:        []CollectionItem{},
+	}
+	collection.ActiveEnvironmentID = collection.Environments[0].ID
+
+	roots := []struct {
+		operation string
+		typeName  string
+		folder    string
+	}{
+		{"query", schema.queryType, "Queries"},
+		{"mutation", schema.mutationType, "Mutations"},
+		{"subscription", schema.subscriptionType, "Subscriptions"},
+	}
+	for _, root := range roots {
+		rootType := schema.types[root.typeName]
+		if rootType == nil || len(rootType.fields) == 0 {
+			continue
+		}
+
+		folder := CollectionItem{
+			ID:    s.openapi.generateID("folder", root.folder),
+			Type:  "folder",
+			Name:  root.folder,
+			Items: []CollectionItem{},
+		}
+		for _, field := range rootType.fields {
+			folder.Items = append(folder.Items, s.convertField(gen, root.operation, field))
+		}
+		collection.Items = append(collection.Items, folder)
+	}
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *GraphQLService) convertField(gen *gqlGenerator, operation string, field gqlField) CollectionItem {
+	operationName := strings.ToUpper(field.name[:1]) + field.name[1:]
+
+	var definitions, arguments []string
+	variables := make(map[string]any, len(field.args))
+	for _, arg := range field.args {
+		definitions = append(definitions, "$"+arg.name+": "+arg.typ.String())
+		arguments = append(arguments, arg.name+": $"+arg.name)
+		if arg.hasDefault {
+			variables[arg.name] = arg.defaultValue
+		} else {
+			variables[arg.name] = gen.inputExample(arg.typ, make(map[string]bool))
+		}
+	}
+
+	var query strings.Builder
+	query.WriteString(operation + " " + operationName)
+	if len(definitions) > 0 {
+		query.WriteString("(" + strings.Join(definitions, ", ") + ")")
+	}
+	query.WriteString(" {\n  " + field.name)
+	if len(arguments) > 0 {
+		query.WriteString("(" + strings.Join(arguments, ", ") + ")")
+	}
+	if !gen.isLeaf(field.typ.namedType()) {
+		lines := gen.selection(field.typ.namedType(), 1)
+		if len(lines) == 0 {
+			lines = []string{"__typename"}
+		}
+		query.WriteString(" {\n")
+		for _, line := range lines {
+			query.WriteString("    " + line + "\n")
+		}
+		query.WriteString("  }")
+	}
+	query.WriteString("\n}")
+
+	variablesJSON, err := json.MarshalIndent(variables, "", "  ")
+	if err != nil {
+		variablesJSON = []byte("{}")
+	}
+
+	return CollectionItem{
+		ID:               s.openapi.generateID("gql", field.name),
+		Type:             "graphql",
+		Name:             field.name,
+		URL:              "{{baseUrl}}",
+		Docs:             field.description,
+		GqlQuery:         query.String(),
+		GqlVariables:     string(variablesJSON),
+		GqlOperationName: operationName,
+	}
+}
+
+// gqlGenerator builds selection sets and example variables from a schema.
+type gqlGenerator struct {
+	schema   *gqlSchema
+	maxDepth int
+}
+
+var gqlBuiltinScalars = map[string]any{
+	"Int":     0,
+	"Float":   0.0,
+	"String":  "string",
+	"Boolean": false,
+	"ID":      "1",
+}
+
+func (g *gqlGenerator) isLeaf(typeName string) bool {
+	t := g.schema.types[typeName]
+	return t == nil || t.kind == "SCALAR" || t.kind == "ENUM"
+}
+
+// selection returns the lines of the selection set for the named type at the
+// given depth, with nested selections already indented. Leaf fields are
+// always selected; object fields only while depth is below the maximum.
+// Fields with required arguments are skipped since they cannot be selected
+// without extra variables.
+func (g *gqlGenerator) selection(typeName string, depth int) []string {
+	t := g.schema.types[typeName]
+	if t == nil {
+		return nil
+	}
+
+	switch t.kind {
+	case "OBJECT", "INTERFACE":
+		var lines []string
+		for _, field := range t.fields {
+			if hasRequiredArgs(field) {
+				continue
+			}
+			fieldType := field.typ.namedType()
+			if g.isLeaf(fieldType) {
+				lines = append(lines, field.name)
+				continue
+			}
+			if depth >= g.maxDepth {
+				continue
+			}
+			nested := g.selection(fieldType, depth+1)
+			if len(nested) == 0 {
+				continue
+			}
+			lines = append(lines, field.name+" {")
+			lines = append(lines, indentLines(nested)...)
+			lines = append(lines, "}")
+		}
+		return lines
+
+	case "UNION":
+		lines := []string{"__typename"}
+		for _, member := range t.possibleTypes {
+			nested := g.selection(member, depth)
+			if len(nested) == 0 {
+				continue
+			}
+			lines = append(lines, "... on "+member+" {")
+			lines = append(lines, indentLines(nested)...)
+			lines = append(lines, "}")
+		}
+		return lines
+	}
+
+	return nil
+}
+
+func hasRequiredArgs(field gqlField) bool {
+	for _, arg := range field.args {
+		if arg.typ.nonNull && !arg.hasDefault {
+			return true
+		}
+	}
+	return false
+}
+
+func indentLines(lines []string) []string {
+	indented := make([]string, len(lines))
+	for i, line := range lines {
+		indented[i] = "  " + line
+	}
+	return indented
+}
+
+// inputExample generates an example variable value for an input type.
+// Recursive input objects are cut off where they refer back to themselves.
+func (g *gqlGenerator) inputExample(ref *gqlTypeRef, visiting map[string]bool) any {
+	if ref.list != nil {
+		return []any{g.inputExample(ref.list, visiting)}
+	}
+
+	if value, ok := gqlBuiltinScalars[ref.name]; ok {
+		return value
+	}
+
+	t := g.schema.types[ref.name]
+	if t == nil || t.kind == "SCALAR" {
+		return customScalarExample(ref.name)
+	}
+
+	switch t.kind {
+	case "ENUM":
+		if len(t.enumValues) > 0 {
+			return t.enumValues[0]
+		}
+		return nil
+
+	case "INPUT_OBJECT":
+		obj := make(map[string]any)
+		if visiting[t.name] || len(visiting) > maxExampleDepth {
+			return obj
+		}
+		visiting[t.name] = true
+		defer delete(visiting, t.name)
+
+		for _, field := range t.inputFields {
+			if field.hasDefault {
+				obj[field.name] = field.defaultValue
+				continue
+			}
+			if !field.typ.nonNull && visiting[field.typ.namedType()] {
+				continue
+			}
+			obj[field.name] = g.inputExample(field.typ, visiting)
+		}
+		return obj
+	}
+
+	return nil
+}
+
+// customScalarExample guesses a value for a custom scalar from its name,
+// using the same formats as OpenAPI example generation.
+func customScalarExample(name string) any {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.Contains(lower, "datetime"), strings.Contains(lower, "timestamp"):
+		return formatExamples["date-time"]
+	case strings.Contains(lower, "date"):
+		return formatExamples["date"]
+	case strings.Contains(lower, "time"):
+		return formatExamples["time"]
+	case strings.Contains(lower, "uuid"):
+		return formatExamples["uuid"]
+	case strings.Contains(lower, "email"):
+		return formatExamples["email"]
+	case strings.Contains(lower, "url"), strings.Contains(lower, "uri"):
+		return formatExamples["uri"]
+	case strings.Contains(lower, "json"), strings.Contains(lower, "object"), strings.Contains(lower, "map"):
+		return map[string]any{}
+	case strings.Contains(lower, "upload"), strings.Contains(lower, "file"):
+		return nil
+	case strings.Contains(lower, "int"), strings.Contains(lower, "long"):
+		return 0
+	case strings.Contains(lower, "float"), strings.Contains(lower, "decimal"):
+		return 0.0
+	}
+	return "string"
+}
+
+// Introspection
+
+type introspectionResult struct {
+	Data *struct {
+		Schema *introspectionSchema `json:"__schema"`
+	} `json:"data"`
+	Schema *introspectionSchema `json:"__schema"`
+}
+
+type introspectionSchema struct {
+	QueryType        *introspectionNamed `json:"queryType"`
+	MutationType     *introspectionNamed `json:"mutationType"`
+	SubscriptionType *introspectionNamed `json:"subscriptionType"`
+	Types            []introspectionType `json:"types"`
+}
+
+type introspectionNamed struct {
+	Name string `json:"name"`
+}
+
+type introspectionType struct {
+	Kind          string                    `json:"kind"`
+	Name          string                    `json:"name"`
+	Fields        []introspectionField      `json:"fields"`
+	InputFields   []introspectionInputValue `json:"inputFields"`
+	EnumValues    []introspectionNamed      `json:"enumValues"`
+	PossibleTypes []introspectionNamed      `json:"possibleTypes"`
+}
+
+type introspectionField struct {
+	Name        string                    `json:"name"`
+	Description string                    `json:"description"`
+	Args        []introspectionInputValue `json:"args"`
+	Type        *introspectionTypeRef     `json:"type"`
+}
+
+type introspectionInputValue struct {
+	Name         string                `json:"name"`
+	Type         *introspectionTypeRef `json:"type"`
+	DefaultValue *string               `json:"defaultValue"`
+}
+
+type introspectionTypeRef struct {
+	Kind   string                `json:"kind"`
+	Name   string                `json:"name"`
+	OfType *introspectionTypeRef `json:"ofType"`
+}
+
+func (s *GraphQLService) parseIntrospection(content []byte) (*gqlSchema, error) {
+	var result introspectionResult
+	if err := json.Unmarshal(content, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse GraphQL introspection result: %w", err)
+	}
+
+	raw := result.Schema
+	if raw == nil && result.Data != nil {
+		raw = result.Data.Schema
+	}
+	if raw == nil {
+		return nil, fmt.Errorf("introspection result has no __schema")
+	}
+
+	schema := &gqlSchema{types: make(map[string]*gqlType)}
+	if raw.QueryType != nil {
+		schema.queryType = raw.QueryType.Name
+	}
+	if raw.MutationType != nil {
+		schema.mutationType = raw.MutationType.Name
+	}
+	if raw.SubscriptionType != nil {
+		schema.subscriptionType = raw.SubscriptionType.Name
+	}
+
+	for _, it := range raw.Types {
+		if it.Name == "" || strings.HasPrefix(it.Name, "__") {
+			continue
+		}
+		t := schema.typeFor(it.Kind, it.Name)
+		for _, f := range it.Fields {
+			field := gqlField{name: f.Name, description: f.Description, typ: convertIntrospectionTypeRef(f.Type)}
+			for _, a := range f.Args {
+				arg, err := convertIntrospectionInputValue(a)
+				if err != nil {
+					return nil, err
+				}
+				field.args = append(field.args, arg)
+			}
+			t.fields = append(t.fields, field)
+		}
+		for _, f := range it.InputFields {
+			input, err := convertIntrospectionInputValue(f)
+			if err != nil {
+				return nil, err
+			}
+			t.inputFields = append(t.inputFields, input)
+		}
+		for _, v := range it.EnumValues {
+			t.enumValues = append(t.enumValues, v.Name)
+		}
+		for _, p := range it.PossibleTypes {
+			t.possibleTypes = append(t.possibleTypes, p.Name)
+		}
+	}
+
+	return schema, nil
+}
+
+func convertIntrospectionTypeRef(ref *introspectionTypeRef) *gqlTypeRef {
+	if ref == nil {
+		return &gqlTypeRef{name: "String"}
+	}
+	switch ref.Kind {
+	case "NON_NULL":
+		inner := convertIntrospectionTypeRef(ref.OfType)
+		inner.nonNull = true
+		return inner
+	case "LIST":
+		return &gqlTypeRef{list: convertIntrospectionTypeRef(ref.OfType)}
+	}
+	return &gqlTypeRef{name: ref.Name}
+}
+
+func convertIntrospectionInputValue(v introspectionInputValue) (gqlInputValue, error) {
+	input := gqlInputValue{name: v.Name, typ: convertIntrospectionTypeRef(v.Type)}
+	if v.DefaultValue != nil {
+		// Default values are GraphQL value literals encoded as strings
+		parser, err := newGQLParser(*v.DefaultValue)
+		if err != nil {
+			return input, fmt.Errorf("invalid default value for %s: %w", v.Name, err)
+		}
+		value, err := parser.parseValue()
+		if err != nil {
+			return input, fmt.Errorf("invalid default value for %s: %w", v.Name, err)
+		}
+		input.defaultValue = value
+		input.hasDefault = true
+	}
+	return input, nil
+}
+
+// SDL parsing
+
+type gqlTokenKind int
+
+const (
+	gqlTokenEOF gqlTokenKind = iota
+	gqlTokenPunct
+	gqlTokenName
+	gqlTokenInt
+	gqlTokenFloat
+	gqlTokenString
+)
+
+type gqlToken struct {
+	kind  gqlTokenKind
+	value string
+	line  int
+}
+
+type gqlParser struct {
+	tokens []gqlToken
+	pos    int
+}
+
+func newGQLParser(source string) (*gqlParser, error) {
+	tokens, err := lexGraphQL(source)
+	if err != nil {
+		return nil, err
+	}
+	return &gqlParser{tokens: tokens}, nil
+}
+
+func lexGraphQL(source string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	line := 1
+	i := 0
+	for i < len(source) {
+		c := source[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(source[i:], "\uFEFF"):
+			i += len("\uFEFF")
+		case strings.HasPrefix(source[i:], "..."):
+			tokens = append(tokens, gqlToken{kind: gqlTokenPunct, value: "...", line: line})
+			i += 3
+		case strings.ContainsRune("!$&():=@[]{}|", rune(c)):
+			tokens = append(tokens, gqlToken{kind: gqlTokenPunct, value: string(c), line: line})
+			i++
+		case c == '_' || isASCIILetter(c):
+			start := i
+			for i < len(source) && (source[i] == '_' || isASCIILetter(source[i]) || isASCIIDigit(source[i])) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{kind: gqlTokenName, value: source[start:i], line: line})
+		case c == '-' || isASCIIDigit(c):
+			start := i
+			kind := gqlTokenInt
+			i++
+			for i < len(source) && isASCIIDigit(source[i]) {
+				i++
+			}
+			if i < len(source) && source[i] == '.' {
+				kind = gqlTokenFloat
+				i++
+				for i < len(source) && isASCIIDigit(source[i]) {
+					i++
+				}
+			}
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				kind = gqlTokenFloat
+				i++
+				if i < len(source) && (source[i] == '+' || source[i] == '-') {
+					i++
+				}
+				for i < len(source) && isASCIIDigit(source[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, gqlToken{kind: kind, value: source[start:i], line: line})
+		case strings.HasPrefix(source[i:], `"""`):
+			end := i + 3
+			for end < len(source) && !strings.HasPrefix(source[end:], `"""`) {
+				if strings.HasPrefix(source[end:], `\"""`) {
+					end += 4
+					continue
+				}
+				end++
+			}
+			if end >= len(source) {
+				return nil, fmt.Errorf("line %d: unterminated block string", line)
+			}
+			raw := source[i+3 : end]
+			tokens = append(tokens, gqlToken{kind: gqlTokenString, value: blockStringValue(raw), line: line})
+			line += strings.Count(raw, "\n")
+			i = end + 3
+		case c == '"':
+			value, n, err := lexGraphQLString(source[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			tokens = append(tokens, gqlToken{kind: gqlTokenString, value: value, line: line})
+			i += n
+		default:
+			r, _ := utf8.DecodeRuneInString(source[i:])
+			return nil, fmt.Errorf("line %d: unexpected character %q", line, r)
+		}
+	}
+	return append(tokens, gqlToken{kind: gqlTokenEOF, line: line}), nil
+}
+
+// lexGraphQLString reads a quoted string at the start of s and returns its
+// value and the number of bytes consumed.
+func lexGraphQLString(s string) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\n':
+			return "", 0, fmt.Errorf("unterminated string")
+		case '\\':
+			i++
+			if i >= len(s) {
+				return "", 0, fmt.Errorf("unterminated string")
+			}
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if i+4 >= len(s) {
+					return "", 0, fmt.Errorf("invalid unicode escape")
+				}
+				code, err := strconv.ParseUint(s[i+1:i+5], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid unicode escape")
+				}
+				b.WriteRune(rune(code))
+				i += 4
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// blockStringValue removes the common indentation and surrounding blank
+// lines from a block string, as described in the GraphQL specification.
+func blockStringValue(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, `\"""`, `"""`), "\n")
+
+	common := -1
+	for _, line := range lines[1:] {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+		if indent := len(line) - len(trimmed); common < 0 || indent < common {
+			common = indent
+		}
+	}
+	if common > 0 {
+		for i := 1; i < len(lines); i++ {
+			if len(lines[i]) >= common {
+				lines[i] = lines[i][common:]
+			} else {
+				lines[i] = strings.TrimLeft(lines[i], " \t")
+			}
+		}
+	}
+
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.pos]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.pos]
+	if t.kind != gqlTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *gqlParser) peekPunct(value string) bool {
+	t := p.peek()
+	return t.kind == gqlTokenPunct && t.value == value
+}
+
+func (p *gqlParser) skipPunct(value string) bool {
+	if p.peekPunct(value) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *gqlParser) expectPunct(value string) error {
+	if !p.skipPunct(value) {
+		return p.unexpected("\"" + value + "\"")
+	}
+	return nil
+}
+
+func (p *gqlParser) expectName() (string, error) {
+	t := p.peek()
+	if t.kind != gqlTokenName {
+		return "", p.unexpected("name")
+	}
+	p.pos++
+	return t.value, nil
+}
+
+func (p *gqlParser) unexpected(expected string) error {
+	t := p.peek()
+	if t.kind == gqlTokenEOF {
+		return fmt.Errorf("line %d: expected %s, found end of document", t.line, expected)
+	}
+	return fmt.Errorf("line %d: expected %s, found %q", t.line, expected, t.value)
+}
+
+// parseDescription consumes an optional description string.
+func (p *gqlParser) parseDescription() string {
+	if t := p.peek(); t.kind == gqlTokenString {
+		p.pos++
+		return t.value
+	}
+	return ""
+}
+
+func (p *gqlParser) parseDocument() (*gqlSchema, error) {
+	schema := &gqlSchema{types: make(map[string]*gqlType)}
+
+	for p.peek().kind != gqlTokenEOF {
+		p.parseDescription()
+
+		keyword, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if keyword == "extend" {
+			if keyword, err = p.expectName(); err != nil {
+				return nil, err
+			}
+		}
+
+		switch keyword {
+		case "schema":
+			err = p.parseSchemaDefinition(schema)
+		case "scalar":
+			err = p.parseScalar(schema)
+		case "type", "interface":
+			err = p.parseObject(schema, keyword)
+		case "union":
+			err = p.parseUnion(schema)
+		case "enum":
+			err = p.parseEnum(schema)
+		case "input":
+			err = p.parseInputObject(schema)
+		case "directive":
+			err = p.parseDirectiveDefinition()
+		default:
+			return nil, fmt.Errorf("line %d: unsupported definition %q", p.tokens[p.pos-1].line, keyword)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Without a schema definition the conventional root type names apply
+	for _, root := range []struct {
+		operation *string
+		name      string
+	}{
+		{&schema.queryType, "Query"},
+		{&schema.mutationType, "Mutation"},
+		{&schema.subscriptionType, "Subscription"},
+	} {
+		if _, ok := schema.types[root.name]; ok && *root.operation == "" {
+			*root.operation = root.name
+		}
+	}
+
+	return schema, nil
+}
+
+func (p *gqlParser) parseSchemaDefinition(schema *gqlSchema) error {
+	if err := p.skipDirectives(); err != nil {
+		return err
+	}
+	if !p.skipPunct("{") {
+		return nil
+	}
+	for !p.skipPunct("}") {
+		operation, err := p.expectName()
+		if err != nil {
+			return err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return err
+		}
+		typeName, err := p.expectName()
+		if err != nil {
+			return err
+		}
+		switch operation {
+		case "query":
+			schema.queryType = typeName
+		case "mutation":
+			schema.mutationType = typeName
+		case "subscription":
+			schema.subscriptionType = typeName
+		default:
+			return fmt.Errorf("unknown root operation %q", operation)
+		}
+	}
+	return nil
+}
+
+func (p *gqlParser) parseScalar(schema *gqlSchema) error {
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	schema.typeFor("SCALAR", name)
+	return p.skipDirectives()
+}
+
+func (p *gqlParser) parseObject(schema *gqlSchema, keyword string) error {
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	kind := "OBJECT"
+	if keyword == "interface" {
+		kind = "INTERFACE"
+	}
+	t := schema.typeFor(kind, name)
+
+	if p.peek().kind == gqlTokenName && p.peek().value == "implements" {
+		p.next()
+		p.skipPunct("&")
+		if _, err := p.expectName(); err != nil {
+			return err
+		}
+		for p.skipPunct("&") {
+			if _, err := p.expectName(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := p.skipDirectives(); err != nil {
+		return err
+	}
+	if !p.skipPunct("{") {
+		return nil
+	}
+
+	for !p.skipPunct("}") {
+		description := p.parseDescription()
+		fieldName, err := p.expectName()
+		if err != nil {
+			return err
+		}
+		field := gqlField{name: fieldName, description: description}
+		if p.skipPunct("(") {
+			if field.args, err = p.parseInputValues(")"); err != nil {
+				return err
+			}
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return err
+		}
+		if field.typ, err = p.parseTypeRef(); err != nil {
+			return err
+		}
+		if err := p.skipDirectives(); err != nil {
+			return err
+		}
+		t.fields = append(t.fields, field)
+	}
+	return nil
+}
+
+func (p *gqlParser) parseUnion(schema *gqlSchema) error {
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	t := schema.typeFor("UNION", name)
+	if err := p.skipDirectives(); err != nil {
+		return err
+	}
+	if !p.skipPunct("=") {
+		return nil
+	}
+	p.skipPunct("|")
+	for {
+		member, err := p.expectName()
+		if err != nil {
+			return err
+		}
+		t.possibleTypes = append(t.possibleTypes, member)
+		if !p.skipPunct("|") {
+			return nil
+		}
+	}
+}
+
+func (p *gqlParser) parseEnum(schema *gqlSchema) error {
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	t := schema.typeFor("ENUM", name)
+	if err := p.skipDirectives(); err != nil {
+		return err
+	}
+	if !p.skipPunct("{") {
+		return nil
+	}
+	for !p.skipPunct("}") {
+		p.parseDescription()
+		value, err := p.expectName()
+		if err != nil {
+			return err
+		}
+		t.enumValues = append(t.enumValues, value)
+		if err := p.skipDirectives(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *gqlParser) parseInputObject(schema *gqlSchema) error {
+	name, err := p.expectName()
+	if err != nil {
+		return err
+	}
+	t := schema.typeFor("INPUT_OBJECT", name)
+	if err := p.skipDirectives(); err != nil {
+		return err
+	}
+	if !p.skipPunct("{") {
+		return nil
+	}
+	fields, err := p.parseInputValues("}")
+	if err != nil {
+		return err
+	}
+	t.inputFields = append(t.inputFields, fields...)
+	return nil
+}
+
+func (p *gqlParser) parseDirectiveDefinition() error {
+	if err := p.expectPunct("@"); err != nil {
+		return err
+	}
+	if _, err := p.expectName(); err != nil {
+		return err
+	}
+	if p.skipPunct("(") {
+		if _, err := p.parseInputValues(")"); err != nil {
+			return err
+		}
+	}
+	if p.peek().kind == gqlTokenName && p.peek().value == "repeatable" {
+		p.next()
+	}
+	if on, err := p.expectName(); err != nil || on != "on" {
+		return p.unexpected("\"on\"")
+	}
+	p.skipPunct("|")
+	for {
+		if _, err := p.expectName(); err != nil {
+			return err
+		}
+		if !p.skipPunct("|") {
+			return nil
+		}
+	}
+}
+
+// parseInputValues parses argument or input field definitions up to and
+// including the closing punctuator.
+func (p *gqlParser) parseInputValues(closing string) ([]gqlInputValue, error) {
+	var values []gqlInputValue
+	for !p.skipPunct(closing) {
+		p.parseDescription()
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(":"); err != nil {
+			return nil, err
+		}
+		value := gqlInputValue{name: name}
+		if value.typ, err = p.parseTypeRef(); err != nil {
+			return nil, err
+		}
+		if p.skipPunct("=") {
+			if value.defaultValue, err = p.parseValue(); err != nil {
+				return nil, err
+			}
+			value.hasDefault = true
+		}
+		if err := p.skipDirectives(); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (p *gqlParser) parseTypeRef() (*gqlTypeRef, error) {
+	var ref *gqlTypeRef
+	if p.skipPunct("[") {
+		inner, err := p.parseTypeRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct("]"); err != nil {
+			return nil, err
+		}
+		ref = &gqlTypeRef{list: inner}
+	} else {
+		name, err := p.expectName()
+		if err != nil {
+			return nil, err
+		}
+		ref = &gqlTypeRef{name: name}
+	}
+	ref.nonNull = p.skipPunct("!")
+	return ref, nil
+}
+
+// parseValue parses a constant value literal into its JSON equivalent. Enum
+// values become strings.
+func (p *gqlParser) parseValue() (any, error) {
+	start := p.pos
+	t := p.next()
+	switch t.kind {
+	case gqlTokenInt:
+		return strconv.ParseInt(t.value, 10, 64)
+	case gqlTokenFloat:
+		return strconv.ParseFloat(t.value, 64)
+	case gqlTokenString:
+		return t.value, nil
+	case gqlTokenName:
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return t.value, nil
+	case gqlTokenPunct:
+		switch t.value {
+		case "[":
+			list := []any{}
+			for !p.skipPunct("]") {
+				value, err := p.parseValue()
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, value)
+			}
+			return list, nil
+		case "{":
+			obj := map[string]any{}
+			for !p.skipPunct("}") {
+				name, err := p.expectName()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expectPunct(":"); err != nil {
+					return nil, err
+				}
+				if obj[name], err = p.parseValue(); err != nil {
+					return nil, err
+				}
+			}
+			return obj, nil
+		}
+	}
+	p.pos = start
+	return nil, p.unexpected("value")
+}
+
+func (p *gqlParser) skipDirectives() error {
+	for p.skipPunct("@") {
+		if _, err := p.expectName(); err != nil {
+			return err
+		}
+		if p.skipPunct("(") {
+			for !p.skipPunct(")") {
+				if _, err := p.expectName(); err != nil {
+					return err
+				}
+				if err := p.expectPunct(":"); err != nil {
+					return err
+				}
+				if _, err := p.parseValue(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
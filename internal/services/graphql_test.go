@@ -0,0 +1,225 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGraphQLSDL = `
+"""
+Entry points
+"""
+schema {
+  query: RootQuery
+  mutation: RootMutation
+}
+
+scalar DateTime
+
+enum Role {
+  ADMIN
+  MEMBER
+}
+
+interface Node {
+  id: ID!
+}
+
+type User implements Node & Entity @key(fields: "id") {
+  id: ID!
+  name: String
+  role: Role!
+  createdAt: DateTime
+  "Users this user follows"
+  following(first: Int = 10): [User!]!
+  avatar(size: Int!): String
+  posts: [Post]
+}
+
+type Post implements Node {
+  id: ID!
+  title: String!
+  author: User
+}
+
+union SearchResult = | User | Post
+
+input UserFilter {
+  role: Role
+  name: String = "any"
+  and: [UserFilter!]
+}
+
+input CreateUserInput {
+  name: String!
+  tags: [String!]
+  filter: UserFilter
+}
+
+type RootQuery {
+  "Look up a user by ID"
+  user(id: ID!): User
+  users(filter: UserFilter, limit: Int = 20): [User!]!
+  search(term: String!): [SearchResult!]!
+  version: String!
+}
+
+type RootMutation {
+  createUser(input: CreateUserInput!): User @deprecated(reason: "use register")
+}
+
+extend type RootQuery {
+  me: User
+}
+`
+
+func convertGraphQLTestSchema(t *testing.T, schema string, depth int) NikodeCollection {
+	t.Helper()
+	svc := NewGraphQLService()
+
+	parsed, err := svc.ParseGraphQL([]byte(schema))
+	require.NoError(t, err)
+
+	data, err := svc.ConvertToNikode(parsed, depth)
+	require.NoError(t, err)
+
+	var collection NikodeCollection
+	require.NoError(t, json.Unmarshal(data, &collection))
+	return collection
+}
+
+func TestGraphQLService_ConvertToNikode_SDL(t *testing.T) {
+	collection := convertGraphQLTestSchema(t, testGraphQLSDL, 2)
+
+	require.Len(t, collection.Environments, 1)
+	assert.Equal(t, "http://localhost:3000/graphql", collection.Environments[0].Variables[0].Value)
+
+	require.Len(t, collection.Items, 2)
+	queries := collection.Items[0]
+	assert.Equal(t, "Queries", queries.Name)
+	require.Len(t, queries.Items, 5)
+	assert.Equal(t, "me", queries.Items[4].Name, "extensions append fields")
+
+	user := queries.Items[0]
+	assert.Equal(t, "graphql", user.Type)
+	assert.Equal(t, "{{baseUrl}}", user.URL)
+	assert.Equal(t, "User", user.GqlOperationName)
+	assert.Equal(t, "Look up a user by ID", user.Docs)
+	assert.Equal(t, `query User($id: ID!) {
+  user(id: $id) {
+    id
+    name
+    role
+    createdAt
+    following {
+      id
+      name
+      role
+      createdAt
+    }
+    posts {
+      id
+      title
+    }
+  }
+}`, user.GqlQuery)
+	assert.JSONEq(t, `{"id": "1"}`, user.GqlVariables)
+
+	users := queries.Items[1]
+	assert.Equal(t, "query Users($filter: UserFilter, $limit: Int) {", firstLine(users.GqlQuery))
+	assert.JSONEq(t, `{"filter": {"role": "ADMIN", "name": "any"}, "limit": 20}`, users.GqlVariables)
+
+	search := queries.Items[2]
+	assert.Contains(t, search.GqlQuery, "    __typename\n    ... on User {\n      id\n")
+	assert.Contains(t, search.GqlQuery, "    ... on Post {\n      id\n      title\n")
+
+	version := queries.Items[3]
+	assert.Equal(t, "query Version {\n  version\n}", version.GqlQuery)
+	assert.Equal(t, "{}", version.GqlVariables)
+
+	mutations := collection.Items[1]
+	assert.Equal(t, "Mutations", mutations.Name)
+	createUser := mutations.Items[0]
+	assert.Equal(t, "mutation CreateUser($input: CreateUserInput!) {", firstLine(createUser.GqlQuery))
+	assert.JSONEq(t, `{"input": {"name": "string", "tags": ["string"], "filter": {"role": "ADMIN", "name": "any"}}}`, createUser.GqlVariables)
+}
+
+func TestGraphQLService_ConvertToNikode_SelectionDepth(t *testing.T) {
+	shallow := convertGraphQLTestSchema(t, testGraphQLSDL, 1)
+	assert.Equal(t, "query User($id: ID!) {\n  user(id: $id) {\n    id\n    name\n    role\n    createdAt\n  }\n}", shallow.Items[0].Items[0].GqlQuery)
+
+	// Default depth reaches user -> posts -> author
+	deep := convertGraphQLTestSchema(t, testGraphQLSDL, 0)
+	assert.Contains(t, deep.Items[0].Items[0].GqlQuery, "      author {\n        id\n")
+}
+
+func TestGraphQLService_ConvertToNikode_Introspection(t *testing.T) {
+	collection := convertGraphQLTestSchema(t, `{
+		"data": {
+			"__schema": {
+				"queryType": {"name": "Query"},
+				"mutationType": null,
+				"subscriptionType": {"name": "Subscription"},
+				"types": [
+					{"kind": "OBJECT", "name": "Query", "fields": [
+						{"name": "pets", "description": "All pets", "args": [
+							{"name": "species", "type": {"kind": "ENUM", "name": "Species"}, "defaultValue": "CAT"},
+							{"name": "ids", "type": {"kind": "NON_NULL", "ofType": {"kind": "LIST", "ofType": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}}}, "defaultValue": null}
+						], "type": {"kind": "LIST", "ofType": {"kind": "OBJECT", "name": "Pet"}}}
+					]},
+					{"kind": "OBJECT", "name": "Subscription", "fields": [
+						{"name": "petAdded", "args": [], "type": {"kind": "OBJECT", "name": "Pet"}}
+					]},
+					{"kind": "OBJECT", "name": "Pet", "fields": [
+						{"name": "id", "args": [], "type": {"kind": "NON_NULL", "ofType": {"kind": "SCALAR", "name": "ID"}}},
+						{"name": "bornAt", "args": [], "type": {"kind": "SCALAR", "name": "Timestamp"}}
+					]},
+					{"kind": "ENUM", "name": "Species", "enumValues": [{"name": "DOG"}, {"name": "CAT"}]},
+					{"kind": "SCALAR", "name": "Timestamp"},
+					{"kind": "OBJECT", "name": "__Schema", "fields": []}
+				]
+			}
+		}
+	}`, 0)
+
+	require.Len(t, collection.Items, 2)
+	assert.Equal(t, "Subscriptions", collection.Items[1].Name)
+
+	pets := collection.Items[0].Items[0]
+	assert.Equal(t, "All pets", pets.Docs)
+	assert.Equal(t, "query Pets($species: Species, $ids: [ID!]!) {\n  pets(species: $species, ids: $ids) {\n    id\n    bornAt\n  }\n}", pets.GqlQuery)
+	assert.JSONEq(t, `{"species": "CAT", "ids": ["1"]}`, pets.GqlVariables)
+
+	petAdded := collection.Items[1].Items[0]
+	assert.Equal(t, "subscription PetAdded {", firstLine(petAdded.GqlQuery))
+}
+
+func TestGraphQLService_ParseGraphQL_Errors(t *testing.T) {
+	svc := NewGraphQLService()
+
+	_, err := svc.ParseGraphQL([]byte("type Query {\n  users: [User\n}"))
+	assert.ErrorContains(t, err, "line 3")
+
+	_, err = svc.ParseGraphQL([]byte("query { users { id } }"))
+	assert.ErrorContains(t, err, "unsupported definition")
+
+	_, err = svc.ParseGraphQL([]byte(`{"data": {"__schema": null}}`))
+	assert.Error(t, err)
+}
+
+func TestDetectSpecFormat_GraphQL(t *testing.T) {
+	assert.Equal(t, SpecFormatGraphQL, DetectSpecFormat([]byte(testGraphQLSDL)))
+	assert.Equal(t, SpecFormatGraphQL, DetectSpecFormat([]byte("schema { query: Q }\ntype Q { a: Int }")))
+	assert.Equal(t, SpecFormatGraphQL, DetectSpecFormat([]byte(`{"data": {"__schema": {"types": []}}}`)))
+	assert.Equal(t, SpecFormatGraphQL, DetectSpecFormat([]byte(`{"__schema": {"types": []}}`)))
+	assert.Equal(t, SpecFormatOpenAPI, DetectSpecFormat([]byte("openapi: 3.0.3\ncomponents:\n  schemas: {}\n")))
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
@@ -0,0 +1,328 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// maxHARResponseDocs caps the size of a captured response body copied into
+// request docs.
+const maxHARResponseDocs = 16 << 10
+
+// HARService converts HTTP Archive (HAR 1.2) captures into the Nikode format.
+type HARService struct {
+	openapi *OpenAPIService
+}
+
+func NewHARService() *HARService {
+	return &HARService{openapi: NewOpenAPIService()}
+}
+
+// HAR types cover the fields read on import and the fields HAR 1.2 requires
+// on export.
+type harArchive struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string         `json:"startedDateTime"`
+	Time            float64        `json:"time"`
+	Request         harRequest     `json:"request"`
+	Response        harResponse    `json:"response"`
+	Cache           map[string]any `json:"cache"`
+	Timings         harTimings     `json:"timings"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harPostData struct {
+	MimeType string         `json:"mimeType"`
+	Text     string         `json:"text"`
+	Params   []harNameValue `json:"params,omitempty"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type harNameValue struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	FileName string `json:"fileName,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harSkippedHeaders are set by the client when the request is sent.
+var harSkippedHeaders = map[string]bool{
+	"host":           true,
+	"content-length": true,
+	"connection":     true,
+}
+
+// ParseHAR parses a HAR archive
+func (s *HARService) ParseHAR(content []byte) (any, error) {
+	var archive harArchive
+	if err := json.Unmarshal(content, &archive); err != nil {
+		return nil, fmt.Errorf("failed to parse HAR archive: %w", err)
+	}
+	if archive.Log.Entries == nil {
+		return nil, fmt.Errorf("missing log.entries array")
+	}
+	return &archive, nil
+}
+
+// ConvertToNikode converts a HAR archive to Nikode collection format. Each
+// distinct method and URL becomes one request. The origin of the first entry
+// becomes the baseUrl variable; when the capture spans several origins the
+// requests are grouped into one folder per host.
+func (s *HARService) ConvertToNikode(specInterface any) (json.RawMessage, error) {
+	archive, ok := specInterface.(*harArchive)
+	if !ok {
+		return nil, fmt.Errorf("invalid spec type, expected HAR archive")
+	}
+
+	var origins []string
+	byOrigin := make(map[string][]CollectionItem)
+	seen := make(map[string]bool)
+	baseURL := ""
+
+	for _, entry := range archive.Log.Entries {
+		parsed, err := url.Parse(entry.Request.URL)
+		if err != nil || parsed.Host == "" {
+			continue
+		}
+		method := strings.ToUpper(entry.Request.Method)
+		if method == "" {
+			method = "GET"
+		}
+
+		origin := parsed.Scheme + "://" + parsed.Host
+		if baseURL == "" {
+			baseURL = origin
+		}
+
+		path := parsed.EscapedPath()
+		key := method + " " + origin + path + "?" + parsed.RawQuery
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if _, ok := byOrigin[origin]; !ok {
+			origins = append(origins, origin)
+		}
+
+		requestURL := origin + path
+		if origin == baseURL {
+			requestURL = "{{baseUrl}}" + path
+		}
+
+		name := method + " " + path
+		if path == "" {
+			name = method + " /"
+		}
+
+		byOrigin[origin] = append(byOrigin[origin], CollectionItem{
+			ID:      s.openapi.generateID("req", name),
+			Type:    "request",
+			Name:    name,
+			Method:  method,
+			URL:     requestURL,
+			Params:  s.convertQuery(entry.Request, parsed),
+			Headers: s.convertHeaders(entry.Request.Headers),
+			Body:    s.convertBody(entry.Request),
+			Scripts: &Scripts{Pre: "", Post: ""},
+			Docs:    s.buildDocs(entry.Response),
+		})
+	}
+
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+
+	collection := NikodeCollection{
+		Name:    "Imported HAR",
+		Version: "1.0.0",
+		Environments: []Environment{
+			{
+				ID:   "env-default",
+				Name: "Default",
+				Variables: []Variable{
+					{Key: "baseUrl", Value: baseURL, Enabled: true},
+				},
+			},
+		},
+		ActiveEnvironmentID: "env-default",
+		Items:               []CollectionItem{},
+	}
+	if archive.Log.Creator.Name != "" {
+		collection.Name = "Imported from " + archive.Log.Creator.Name
+	}
+
+	if len(origins) == 1 {
+		collection.Items = byOrigin[origins[0]]
+	} else {
+		for _, origin := range origins {
+			host := strings.TrimPrefix(strings.TrimPrefix(origin, "https://"), "http://")
+			collection.Items = append(collection.Items, CollectionItem{
+				ID:    s.openapi.generateID("folder", host),
+				Type:  "folder",
+				Name:  host,
+				Items: byOrigin[origin],
+			})
+		}
+	}
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// convertQuery prefers the recorded queryString list and falls back to the
+// URL's query when a capture omits it.
+func (s *HARService) convertQuery(request harRequest, parsed *url.URL) []KeyValue {
+	var params []KeyValue
+	if len(request.QueryString) > 0 {
+		for _, q := range request.QueryString {
+			params = append(params, KeyValue{Key: q.Name, Value: q.Value, Enabled: true})
+		}
+		return params
+	}
+
+	query := parsed.Query()
+	for _, key := range sortedKeys(query) {
+		for _, value := range query[key] {
+			params = append(params, KeyValue{Key: key, Value: value, Enabled: true})
+		}
+	}
+	return params
+}
+
+func (s *HARService) convertHeaders(headers []harNameValue) []KeyValue {
+	var converted []KeyValue
+	for _, h := range headers {
+		// HTTP/2 pseudo headers such as :authority
+		if h.Name == "" || strings.HasPrefix(h.Name, ":") || harSkippedHeaders[strings.ToLower(h.Name)] {
+			continue
+		}
+		converted = append(converted, KeyValue{Key: h.Name, Value: h.Value, Enabled: true})
+	}
+	return converted
+}
+
+func (s *HARService) convertBody(request harRequest) *RequestBody {
+	postData := request.PostData
+	if postData == nil || (postData.Text == "" && len(postData.Params) == 0) {
+		return &RequestBody{Type: "none"}
+	}
+
+	mimeType := strings.ToLower(postData.MimeType)
+	switch {
+	case strings.Contains(mimeType, "json"):
+		return &RequestBody{Type: "json", Content: postData.Text}
+	case strings.HasPrefix(mimeType, "application/x-www-form-urlencoded"):
+		entries := s.convertParams(postData.Params)
+		if len(entries) == 0 {
+			if values, err := url.ParseQuery(postData.Text); err == nil {
+				for _, key := range sortedKeys(values) {
+					for _, value := range values[key] {
+						entries = append(entries, KeyValue{Key: key, Value: value, Enabled: true})
+					}
+				}
+			}
+		}
+		return &RequestBody{Type: "x-www-form-urlencoded", Entries: entries}
+	case strings.HasPrefix(mimeType, "multipart/form-data"):
+		return &RequestBody{Type: "form-data", Entries: s.convertParams(postData.Params)}
+	}
+	return &RequestBody{Type: "raw", Content: postData.Text}
+}
+
+// convertParams converts form params. Uploaded files keep their field name
+// with an empty value.
+func (s *HARService) convertParams(params []harNameValue) []KeyValue {
+	var entries []KeyValue
+	for _, p := range params {
+		value := p.Value
+		if p.FileName != "" {
+			value = ""
+		}
+		entries = append(entries, KeyValue{Key: p.Name, Value: value, Enabled: true})
+	}
+	return entries
+}
+
+// buildDocs records the captured response. Base64 encoded bodies are omitted
+// and large bodies are truncated.
+func (s *HARService) buildDocs(response harResponse) string {
+	if response.Status == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("## Response\n\n")
+	b.WriteString(fmt.Sprintf("### %d - %s\n", response.Status, response.StatusText))
+
+	content := response.Content
+	if content.MimeType != "" {
+		b.WriteString("\n`" + content.MimeType + "`\n")
+	}
+	if content.Text != "" && content.Encoding != "base64" {
+		text := content.Text
+		if len(text) > maxHARResponseDocs {
+			text = text[:maxHARResponseDocs] + "\n..."
+		}
+		language := ""
+		if strings.Contains(content.MimeType, "json") {
+			language = "json"
+		}
+		b.WriteString("\n```" + language + "\n" + text + "\n```\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testHARArchive = `{
+	"log": {
+		"version": "1.2",
+		"creator": {"name": "Firefox", "version": "120.0"},
+		"entries": [
+			{
+				"request": {
+					"method": "GET",
+					"url": "https://api.example.com/users?page=2",
+					"headers": [
+						{"name": ":authority", "value": "api.example.com"},
+						{"name": "Host", "value": "api.example.com"},
+						{"name": "Accept", "value": "application/json"}
+					],
+					"queryString": [{"name": "page", "value": "2"}]
+				},
+				"response": {
+					"status": 200,
+					"statusText": "OK",
+					"content": {"mimeType": "application/json", "text": "[{\"id\": 1}]"}
+				}
+			},
+			{
+				"request": {"method": "GET", "url": "https://api.example.com/users?page=2", "headers": []},
+				"response": {"status": 304, "statusText": "Not Modified", "content": {}}
+			},
+			{
+				"request": {
+					"method": "POST",
+					"url": "https://api.example.com/login",
+					"headers": [{"name": "Content-Length", "value": "27"}],
+					"postData": {"mimeType": "application/x-www-form-urlencoded", "text": "user=ada&remember=1"}
+				},
+				"response": {"status": 302, "statusText": "Found", "content": {"mimeType": "image/png", "text": "iVBORw0KGgo=", "encoding": "base64"}}
+			},
+			{
+				"request": {
+					"method": "PUT",
+					"url": "https://cdn.example.com/assets/logo.png",
+					"headers": [],
+					"postData": {"mimeType": "multipart/form-data; boundary=x", "params": [{"name": "file", "fileName": "logo.png"}, {"name": "alt", "value": "Logo"}]}
+				},
+				"response": {"status": 201, "statusText": "Created", "content": {}}
+			}
+		]
+	}
+}`
+
+func convertHARTestArchive(t *testing.T, content string) NikodeCollection {
+	t.Helper()
+	svc := NewHARService()
+
+	spec, err := svc.ParseHAR([]byte(content))
+	require.NoError(t, err)
+
+	data, err := svc.ConvertToNikode(spec)
+	require.NoError(t, err)
+
+	var collection NikodeCollection
+	require.NoError(t, json.Unmarshal(data, &collection))
+	return collection
+}
+
+func TestHARService_ConvertToNikode(t *testing.T) {
+	collection := convertHARTestArchive(t, testHARArchive)
+
+	assert.Equal(t, "Imported from Firefox", collection.Name)
+	assert.Equal(t, "https://api.example.com", collection.Environments[0].Variables[0].Value)
+
+	require.Len(t, collection.Items, 2, "one folder per origin")
+	api := collection.Items[0]
+	assert.Equal(t, "api.example.com", api.Name)
+	require.Len(t, api.Items, 2, "repeated requests are imported once")
+
+	users := api.Items[0]
+	assert.Equal(t, "GET /users", users.Name)
+	assert.Equal(t, "{{baseUrl}}/users", users.URL)
+	assert.Equal(t, []KeyValue{{Key: "page", Value: "2", Enabled: true}}, users.Params)
+	assert.Equal(t, []KeyValue{{Key: "Accept", Value: "application/json", Enabled: true}}, users.Headers)
+	assert.Equal(t, "## Response\n\n### 200 - OK\n\n`application/json`\n\n```json\n[{\"id\": 1}]\n```\n", users.Docs)
+
+	login := api.Items[1]
+	assert.Empty(t, login.Headers)
+	assert.Equal(t, &RequestBody{Type: "x-www-form-urlencoded", Entries: []KeyValue{
+		{Key: "remember", Value: "1", Enabled: true},
+		{Key: "user", Value: "ada", Enabled: true},
+	}}, login.Body)
+	assert.NotContains(t, login.Docs, "iVBOR", "base64 bodies are omitted")
+
+	cdn := collection.Items[1]
+	assert.Equal(t, "cdn.example.com", cdn.Name)
+	upload := cdn.Items[0]
+	assert.Equal(t, "https://cdn.example.com/assets/logo.png", upload.URL)
+	assert.Equal(t, "form-data", upload.Body.Type)
+	assert.Equal(t, []KeyValue{
+		{Key: "file", Value: "", Enabled: true},
+		{Key: "alt", Value: "Logo", Enabled: true},
+	}, upload.Body.Entries)
+}
+
+func TestHARService_ConvertToNikode_SingleOrigin(t *testing.T) {
+	collection := convertHARTestArchive(t, `{"log": {"entries": [
+		{"request": {"method": "post", "url": "http://localhost:4000/items", "headers": [],
+			"postData": {"mimeType": "application/json", "text": "{\"name\": \"a\"}"}},
+		 "response": {"status": 201, "statusText": "Created", "content": {"text": "`+strings.Repeat("x", maxHARResponseDocs+1)+`"}}}
+	]}}`)
+
+	assert.Equal(t, "Imported HAR", collection.Name)
+	require.Len(t, collection.Items, 1)
+	item := collection.Items[0]
+	assert.Equal(t, "request", item.Type)
+	assert.Equal(t, "POST", item.Method)
+	assert.Equal(t, "{{baseUrl}}/items", item.URL)
+	assert.Equal(t, &RequestBody{Type: "json", Content: `{"name": "a"}`}, item.Body)
+	assert.Contains(t, item.Docs, "x\n...\n```")
+}
+
+func TestHARService_ParseHAR_Errors(t *testing.T) {
+	_, err := NewHARService().ParseHAR([]byte(`{"log": {}}`))
+	assert.ErrorContains(t, err, "missing log.entries")
+}
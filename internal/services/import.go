@@ -0,0 +1,203 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported import format")
+
+// ImportOptions tunes how an imported document is converted.
+type ImportOptions struct {
+	// SelectionDepth limits nested selections in generated GraphQL queries
+	SelectionDepth int
+}
+
+// ImportResult is a converted document. Postman environment files produce
+// an Environment to merge into an existing collection instead of Data.
+type ImportResult struct {
+	Format      SpecFormat
+	Name        string
+	Data        json.RawMessage
+	Environment *Environment
+}
+
+// SpecParseError reports a document that could not be parsed in its
+// detected format.
+type SpecParseError struct {
+	Format SpecFormat
+	Err    error
+}
+
+func (e *SpecParseError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", formatLabels[e.Format], e.Err)
+}
+
+func (e *SpecParseError) Unwrap() error {
+	return e.Err
+}
+
+var formatLabels = map[SpecFormat]string{
+	SpecFormatOpenAPI:    "openapi spec",
+	SpecFormatAsyncAPI:   "asyncapi spec",
+	SpecFormatGraphQL:    "graphql schema",
+	SpecFormatPostman:    "postman collection",
+	SpecFormatPostmanEnv: "postman environment",
+	SpecFormatInsomnia:   "insomnia export",
+	SpecFormatHAR:        "har archive",
+}
+
+// ImportService detects the format of an uploaded document and converts it
+// with the matching converter.
+type ImportService struct {
+	openapi  *OpenAPIService
+	asyncapi *AsyncAPIService
+	graphql  *GraphQLService
+	postman  *PostmanService
+	insomnia *InsomniaService
+	har      *HARService
+}
+
+func NewImportService(
+	openapi *OpenAPIService,
+	asyncapi *AsyncAPIService,
+	graphql *GraphQLService,
+	postman *PostmanService,
+	insomnia *InsomniaService,
+	har *HARService,
+) *ImportService {
+	return &ImportService{
+		openapi:  openapi,
+		asyncapi: asyncapi,
+		graphql:  graphql,
+		postman:  postman,
+		insomnia: insomnia,
+		har:      har,
+	}
+}
+
+// Import detects the document format and converts it to the Nikode format.
+// Parse failures are returned as *SpecParseError.
+func (s *ImportService) Import(content []byte, opts ImportOptions) (*ImportResult, error) {
+	format := DetectSpecFormat(content)
+	result := &ImportResult{Format: format}
+
+	var spec any
+	var err error
+	switch format {
+	case SpecFormatOpenAPI:
+		if spec, err = s.openapi.ParseOpenAPI(content); err == nil {
+			result.Data, err = s.openapi.ConvertToNikode(spec)
+		}
+	case SpecFormatAsyncAPI:
+		if spec, err = s.asyncapi.ParseAsyncAPI(content); err == nil {
+			result.Data, err = s.asyncapi.ConvertToNikode(spec)
+		}
+	case SpecFormatGraphQL:
+		if spec, err = s.graphql.ParseGraphQL(content); err == nil {
+			result.Data, err = s.graphql.ConvertToNikode(spec, opts.SelectionDepth)
+		}
+	case SpecFormatPostman:
+		if spec, err = s.postman.ParseCollection(content); err == nil {
+			result.Data, err = s.postman.ConvertToNikode(spec)
+		}
+	case SpecFormatPostmanEnv:
+		var env *Environment
+		if env, err = s.postman.ParseEnvironment(content); err == nil {
+			result.Name = env.Name
+			result.Environment = env
+			return result, nil
+		}
+	case SpecFormatInsomnia:
+		if spec, err = s.insomnia.ParseExport(content); err == nil {
+			result.Data, err = s.insomnia.ConvertToNikode(spec)
+		}
+	case SpecFormatHAR:
+		if spec, err = s.har.ParseHAR(content); err == nil {
+			result.Data, err = s.har.ConvertToNikode(spec)
+		}
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+
+	if err != nil {
+		if spec == nil {
+			return nil, &SpecParseError{Format: format, Err: err}
+		}
+		return nil, fmt.Errorf("failed to convert %s: %w", formatLabels[format], err)
+	}
+
+	var collection struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(result.Data, &collection); err == nil {
+		result.Name = collection.Name
+	}
+
+	return result, nil
+}
+
+// MergeEnvironment adds env to the collection data, replacing an existing
+// environment with the same name while keeping that environment's ID.
+func MergeEnvironment(data json.RawMessage, env Environment) (json.RawMessage, error) {
+	var collection map[string]json.RawMessage
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, err
+	}
+	if collection == nil {
+		collection = make(map[string]json.RawMessage)
+	}
+
+	var envs []json.RawMessage
+	if raw, ok := collection["environments"]; ok {
+		if err := json.Unmarshal(raw, &envs); err != nil {
+			return nil, err
+		}
+	}
+
+	replaced := false
+	usedIDs := make(map[string]bool, len(envs))
+	for i, raw := range envs {
+		var existing Environment
+		if err := json.Unmarshal(raw, &existing); err != nil {
+			continue
+		}
+		usedIDs[existing.ID] = true
+		if !replaced && existing.Name == env.Name {
+			env.ID = existing.ID
+			encoded, err := json.Marshal(env)
+			if err != nil {
+				return nil, err
+			}
+			envs[i] = encoded
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		baseID := env.ID
+		for n := 2; usedIDs[env.ID]; n++ {
+			env.ID = fmt.Sprintf("%s-%d", baseID, n)
+		}
+		encoded, err := json.Marshal(env)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, encoded)
+	}
+
+	encoded, err := json.Marshal(envs)
+	if err != nil {
+		return nil, err
+	}
+	collection["environments"] = encoded
+
+	if active, ok := collection["activeEnvironmentId"]; !ok || string(active) == `""` || string(active) == "null" {
+		if collection["activeEnvironmentId"], err = json.Marshal(env.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(collection)
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestImportService() *ImportService {
+	return NewImportService(
+		NewOpenAPIService(),
+		NewAsyncAPIService(),
+		NewGraphQLService(),
+		NewPostmanService(),
+		NewInsomniaService(),
+		NewHARService(),
+	)
+}
+
+func TestDetectSpecFormat_Imports(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    SpecFormat
+	}{
+		{"postman v2.1", `{"info": {"name": "x", "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"}, "item": []}`, SpecFormatPostman},
+		{"postman id only", `{"info": {"_postman_id": "1", "name": "x"}, "item": []}`, SpecFormatPostman},
+		{"postman environment", `{"name": "Dev", "values": [], "_postman_variable_scope": "environment"}`, SpecFormatPostmanEnv},
+		{"postman environment without scope", `{"id": "1", "name": "Dev", "values": []}`, SpecFormatPostmanEnv},
+		{"insomnia", `{"_type": "export", "__export_format": 4, "resources": []}`, SpecFormatInsomnia},
+		{"insomnia yaml", "_type: export\n__export_format: 4\nresources: []\n", SpecFormatInsomnia},
+		{"har", `{"log": {"version": "1.2", "entries": []}}`, SpecFormatHAR},
+		{"openapi", `{"openapi": "3.0.3", "info": {"title": "x", "version": "1"}, "paths": {}}`, SpecFormatOpenAPI},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, DetectSpecFormat([]byte(tt.content)))
+		})
+	}
+}
+
+func TestImportService_Import(t *testing.T) {
+	svc := newTestImportService()
+
+	result, err := svc.Import([]byte(testPostmanCollection), ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, SpecFormatPostman, result.Format)
+	assert.Equal(t, "Pet Store", result.Name)
+	assert.Nil(t, result.Environment)
+	assert.NotEmpty(t, result.Data)
+
+	result, err = svc.Import([]byte(testHARArchive), ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, SpecFormatHAR, result.Format)
+	assert.Equal(t, "Imported from Firefox", result.Name)
+
+	result, err = svc.Import([]byte(`{"name": "QA", "values": [{"key": "a", "value": "1"}]}`), ImportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, SpecFormatPostmanEnv, result.Format)
+	assert.Nil(t, result.Data)
+	require.NotNil(t, result.Environment)
+	assert.Equal(t, "env-qa", result.Environment.ID)
+}
+
+func TestImportService_Import_ParseError(t *testing.T) {
+	svc := newTestImportService()
+
+	_, err := svc.Import([]byte(`{"_type": "export", "__export_format": 3, "resources": []}`), ImportOptions{})
+	var parseErr *SpecParseError
+	require.True(t, errors.As(err, &parseErr))
+	assert.Equal(t, SpecFormatInsomnia, parseErr.Format)
+	assert.Contains(t, err.Error(), "invalid insomnia export: ")
+
+	_, err = svc.Import([]byte("not: [valid"), ImportOptions{})
+	require.True(t, errors.As(err, &parseErr))
+	assert.Contains(t, err.Error(), "invalid openapi spec: ")
+}
+
+func TestMergeEnvironment(t *testing.T) {
+	data := json.RawMessage(`{
+		"name": "API",
+		"activeEnvironmentId": "",
+		"environments": [
+			{"id": "env-default", "name": "Default", "variables": []},
+			{"id": "env-stage", "name": "Staging", "variables": [{"key": "old", "value": "1", "enabled": true}]}
+		],
+		"items": []
+	}`)
+
+	merged, err := MergeEnvironment(data, Environment{
+		ID:        "env-staging",
+		Name:      "Staging",
+		Variables: []Variable{{Key: "baseUrl", Value: "https://stage", Enabled: true}},
+	})
+	require.NoError(t, err)
+
+	var collection NikodeCollection
+	require.NoError(t, json.Unmarshal(merged, &collection))
+	assert.Equal(t, "API", collection.Name)
+	require.Len(t, collection.Environments, 2)
+	assert.Equal(t, "env-stage", collection.Environments[1].ID, "replacement keeps the existing ID")
+	assert.Equal(t, "baseUrl", collection.Environments[1].Variables[0].Key)
+	assert.Equal(t, "env-stage", collection.ActiveEnvironmentID)
+
+	merged, err = MergeEnvironment(merged, Environment{ID: "env-default", Name: "Local", Variables: []Variable{}})
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(merged, &collection))
+	require.Len(t, collection.Environments, 3)
+	assert.Equal(t, "env-default-2", collection.Environments[2].ID)
+	assert.Equal(t, "env-stage", collection.ActiveEnvironmentID, "an active environment is kept")
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// InsomniaService converts Insomnia v4 exports into the Nikode format.
+type InsomniaService struct {
+	openapi *OpenAPIService
+}
+
+func NewInsomniaService() *InsomniaService {
+	return &InsomniaService{openapi: NewOpenAPIService()}
+}
+
+// insomniaExport is a parsed Insomnia export: a flat list of resources
+// linked through parentId.
+type insomniaExport struct {
+	resources []map[string]any
+	children  map[string][]map[string]any
+}
+
+// insomniaTemplateVariable matches Nunjucks variables such as {{ _.baseUrl }}.
+var insomniaTemplateVariable = regexp.MustCompile(`\{\{\s*(?:_\.)?([A-Za-z0-9_.\-]+)\s*\}\}`)
+
+// ParseExport parses an Insomnia v4 export (auto-detects JSON/YAML)
+func (s *InsomniaService) ParseExport(content []byte) (any, error) {
+	var data any
+	if err := yaml.Unmarshal(content, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse Insomnia export: %w", err)
+	}
+	raw := asMap(normalizeYAML(data))
+
+	if format := fmt.Sprintf("%v", raw["__export_format"]); format != "4" {
+		return nil, fmt.Errorf("unsupported Insomnia export format %q, expected 4", format)
+	}
+
+	export := &insomniaExport{children: make(map[string][]map[string]any)}
+	for _, r := range asSlice(raw["resources"]) {
+		resource := asMap(r)
+		if resource == nil {
+			continue
+		}
+		export.resources = append(export.resources, resource)
+		parentID := stringOr(resource["parentId"], "")
+		export.children[parentID] = append(export.children[parentID], resource)
+	}
+
+	// Insomnia orders siblings by metaSortKey
+	for _, siblings := range export.children {
+		sort.SliceStable(siblings, func(i, j int) bool {
+			return insomniaSortKey(siblings[i]) < insomniaSortKey(siblings[j])
+		})
+	}
+
+	return export, nil
+}
+
+func insomniaSortKey(resource map[string]any) float64 {
+	switch key := resource["metaSortKey"].(type) {
+	case int:
+		return float64(key)
+	case float64:
+		return key
+	}
+	return 0
+}
+
+// ConvertToNikode converts an Insomnia export to Nikode collection format.
+// Requests under every workspace in the export are included; the first
+// workspace names the collection.
+func (s *InsomniaService) ConvertToNikode(specInterface any) (json.RawMessage, error) {
+	export, ok := specInterface.(*insomniaExport)
+	if !ok {
+		return nil, fmt.Errorf("invalid spec type, expected Insomnia export")
+	}
+
+	collection := NikodeCollection{
+		Name:    "Imported Collection",
+		Version: "1.0.0",
+		Items:   []CollectionItem{},
+	}
+
+	var workspaces []map[string]any
+	for _, resource := range export.resources {
+		if resource["_type"] == "workspace" {
+			workspaces = append(workspaces, resource)
+		}
+	}
+	if len(workspaces) > 0 {
+		collection.Name = stringOr(workspaces[0]["name"], collection.Name)
+	}
+
+	for _, workspace := range workspaces {
+		workspaceID := stringOr(workspace["_id"], "")
+		collection.Items = append(collection.Items, s.convertChildren(export, workspaceID)...)
+		collection.Environments = append(collection.Environments, s.convertEnvironments(export, workspaceID)...)
+	}
+	if len(collection.Environments) == 0 {
+		collection.Environments = []Environment{{ID: "env-default", Name: "Default", Variables: []Variable{}}}
+	}
+	collection.ActiveEnvironmentID = collection.Environments[0].ID
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *InsomniaService) convertChildren(export *insomniaExport, parentID string) []CollectionItem {
+	items := []CollectionItem{}
+	for _, resource := range export.children[parentID] {
+		name := stringOr(resource["name"], "Untitled")
+		switch resource["_type"] {
+		case "request_group":
+			items = append(items, CollectionItem{
+				ID:    s.openapi.generateID("folder", name),
+				Type:  "folder",
+				Name:  name,
+				Items: s.convertChildren(export, stringOr(resource["_id"], "")),
+				Auth:  s.convertAuth(resource["authentication"]),
+				Docs:  stringOr(resource["description"], ""),
+			})
+		case "request":
+			items = append(items, s.convertRequest(name, resource))
+		case "websocket_request":
+			items = append(items, CollectionItem{
+				ID:          s.openapi.generateID("ws", name),
+				Type:        "websocket",
+				Name:        name,
+				URL:         convertInsomniaTemplate(stringOr(resource["url"], "")),
+				Params:      s.convertPairs(resource["parameters"]),
+				Headers:     s.convertPairs(resource["headers"]),
+				WsProtocols: []string{},
+				Docs:        stringOr(resource["description"], ""),
+			})
+		}
+	}
+	return items
+}
+
+func (s *InsomniaService) convertRequest(name string, resource map[string]any) CollectionItem {
+	body := asMap(resource["body"])
+	mimeType := strings.ToLower(stringOr(body["mimeType"], ""))
+
+	item := CollectionItem{
+		ID:      s.openapi.generateID("req", name),
+		Type:    "request",
+		Name:    name,
+		Method:  strings.ToUpper(stringOr(resource["method"], "GET")),
+		URL:     convertInsomniaTemplate(stringOr(resource["url"], "")),
+		Params:  s.convertPairs(resource["parameters"]),
+		Headers: s.convertPairs(resource["headers"]),
+		Body:    &RequestBody{Type: "none"},
+		Scripts: &Scripts{
+			Pre:  stringOr(resource["preRequestScript"], ""),
+			Post: stringOr(resource["afterResponseScript"], ""),
+		},
+		Auth: s.convertAuth(resource["authentication"]),
+		Docs: stringOr(resource["description"], ""),
+	}
+
+	text := convertInsomniaTemplate(stringOr(body["text"], ""))
+	switch {
+	case mimeType == "application/graphql":
+		var graphql struct {
+			Query     string `json:"query"`
+			Variables any    `json:"variables"`
+		}
+		_ = json.Unmarshal([]byte(text), &graphql)
+		item.Type = "graphql"
+		item.Method = ""
+		item.Body = nil
+		item.GqlQuery = graphql.Query
+		if graphql.Variables != nil {
+			if variables, err := json.MarshalIndent(graphql.Variables, "", "  "); err == nil {
+				item.GqlVariables = string(variables)
+			}
+		}
+	case strings.Contains(mimeType, "json"):
+		item.Body = &RequestBody{Type: "json", Content: text}
+	case mimeType == "application/x-www-form-urlencoded":
+		item.Body = &RequestBody{Type: "x-www-form-urlencoded", Entries: s.convertPairs(body["params"])}
+	case mimeType == "multipart/form-data":
+		item.Body = &RequestBody{Type: "form-data", Entries: s.convertPairs(body["params"])}
+	case mimeType == "application/octet-stream":
+		item.Body = &RequestBody{Type: "binary", Content: ""}
+	case text != "":
+		item.Body = &RequestBody{Type: "raw", Content: text}
+	}
+
+	return item
+}
+
+// convertPairs converts Insomnia name/value lists (headers, parameters and
+// form fields). File fields keep their name with an empty value.
+func (s *InsomniaService) convertPairs(node any) []KeyValue {
+	var pairs []KeyValue
+	for _, p := range asSlice(node) {
+		pair := asMap(p)
+		name := stringOr(pair["name"], "")
+		if name == "" {
+			continue
+		}
+		disabled, _ := pair["disabled"].(bool)
+		value := ""
+		if pair["type"] != "file" {
+			value = convertInsomniaTemplate(s.openapi.formatExampleValue(pair["value"]))
+		}
+		pairs = append(pairs, KeyValue{Key: name, Value: value, Enabled: !disabled})
+	}
+	return pairs
+}
+
+// convertAuth maps Insomnia authentication. An empty object inherits from
+// the parent folder; disabled auth turns it off.
+func (s *InsomniaService) convertAuth(node any) *Auth {
+	auth := asMap(node)
+	authType := stringOr(auth["type"], "")
+	if authType == "" {
+		return nil
+	}
+	if disabled, _ := auth["disabled"].(bool); disabled || authType == "none" {
+		return &Auth{Type: "none"}
+	}
+
+	value := func(key string) string {
+		return convertInsomniaTemplate(stringOr(auth[key], ""))
+	}
+
+	switch authType {
+	case "bearer":
+		return &Auth{Type: "bearer", Token: value("token")}
+	case "basic":
+		return &Auth{Type: "basic", Username: value("username"), Password: value("password")}
+	case "apikey":
+		in := "header"
+		switch auth["addTo"] {
+		case "queryParams":
+			in = "query"
+		case "cookie":
+			in = "cookie"
+		}
+		return &Auth{Type: "apikey", Key: value("key"), Value: value("value"), In: in}
+	case "oauth2":
+		grantType := value("grantType")
+		if grantType == "" {
+			grantType = "authorization_code"
+		}
+		return &Auth{
+			Type: "oauth2",
+			OAuth2: &OAuth2Auth{
+				GrantType:    grantType,
+				AuthURL:      value("authorizationUrl"),
+				TokenURL:     value("accessTokenUrl"),
+				ClientID:     value("clientId"),
+				ClientSecret: value("clientSecret"),
+				Scope:        value("scope"),
+				AccessToken:  "",
+			},
+		}
+	}
+	return nil
+}
+
+// convertEnvironments returns one environment per sub environment of the
+// workspace's base environment, each including the base values. Without sub
+// environments the base environment itself is returned.
+func (s *InsomniaService) convertEnvironments(export *insomniaExport, workspaceID string) []Environment {
+	var base map[string]any
+	for _, resource := range export.children[workspaceID] {
+		if resource["_type"] == "environment" {
+			base = resource
+			break
+		}
+	}
+	if base == nil {
+		return nil
+	}
+
+	baseData := asMap(base["data"])
+	var environments []Environment
+	usedIDs := make(map[string]bool)
+	for _, resource := range export.children[stringOr(base["_id"], "")] {
+		if resource["_type"] != "environment" {
+			continue
+		}
+		data := make(map[string]any, len(baseData))
+		for key, value := range baseData {
+			data[key] = value
+		}
+		for key, value := range asMap(resource["data"]) {
+			data[key] = value
+		}
+		environments = append(environments, s.newEnvironment(stringOr(resource["name"], "Environment"), data, usedIDs))
+	}
+
+	if len(environments) == 0 {
+		environments = append(environments, s.newEnvironment("Default", baseData, usedIDs))
+	}
+	return environments
+}
+
+func (s *InsomniaService) newEnvironment(name string, data map[string]any, usedIDs map[string]bool) Environment {
+	baseID := "env-" + s.openapi.slugify(name)
+	if baseID == "env-" {
+		baseID = "env-environment"
+	}
+	id := baseID
+	for n := 2; usedIDs[id]; n++ {
+		id = fmt.Sprintf("%s-%d", baseID, n)
+	}
+	usedIDs[id] = true
+
+	env := Environment{ID: id, Name: name, Variables: []Variable{}}
+	flattenInsomniaData("", data, &env.Variables)
+	return env
+}
+
+// flattenInsomniaData turns nested environment objects into dotted keys,
+// matching how Insomnia templates address them ({{ _.auth.token }}).
+func flattenInsomniaData(prefix string, data map[string]any, variables *[]Variable) {
+	for _, key := range sortedKeys(data) {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+		if nested := asMap(data[key]); nested != nil {
+			flattenInsomniaData(name, nested, variables)
+			continue
+		}
+		value := ""
+		if data[key] != nil {
+			value = convertInsomniaTemplate(fmt.Sprintf("%v", data[key]))
+		}
+		*variables = append(*variables, Variable{Key: name, Value: value, Enabled: true})
+	}
+}
+
+func convertInsomniaTemplate(value string) string {
+	return insomniaTemplateVariable.ReplaceAllString(value, "{{$1}}")
+}
@@ -0,0 +1,106 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testInsomniaExport = `{
+	"_type": "export",
+	"__export_format": 4,
+	"__export_source": "insomnia.desktop.app:v2023.5.8",
+	"resources": [
+		{"_id": "wrk_1", "_type": "workspace", "parentId": null, "name": "Billing"},
+		{"_id": "env_base", "_type": "environment", "parentId": "wrk_1", "name": "Base Environment", "data": {"baseUrl": "http://localhost:8080", "auth": {"token": "dev"}}},
+		{"_id": "env_prod", "_type": "environment", "parentId": "env_base", "name": "Production", "data": {"baseUrl": "https://billing.example.com"}},
+		{"_id": "fld_1", "_type": "request_group", "parentId": "wrk_1", "name": "Invoices", "metaSortKey": -10, "authentication": {"type": "bearer", "token": "{{ _.auth.token }}"}},
+		{"_id": "req_2", "_type": "request", "parentId": "fld_1", "name": "Create invoice", "metaSortKey": 2, "method": "POST",
+			"url": "{{ _.baseUrl }}/invoices",
+			"body": {"mimeType": "application/json", "text": "{\"amount\": {{ amount }}}"},
+			"headers": [{"name": "Content-Type", "value": "application/json"}],
+			"authentication": {}},
+		{"_id": "req_1", "_type": "request", "parentId": "fld_1", "name": "List invoices", "metaSortKey": 1, "method": "GET",
+			"url": "{{ _.baseUrl }}/invoices",
+			"parameters": [{"name": "status", "value": "open"}, {"name": "limit", "value": "10", "disabled": true}],
+			"authentication": {"type": "apikey", "key": "X-Key", "value": "k", "addTo": "queryParams"},
+			"description": "All invoices"},
+		{"_id": "req_3", "_type": "request", "parentId": "wrk_1", "name": "Upload", "metaSortKey": 5, "method": "POST",
+			"url": "{{ _.baseUrl }}/upload",
+			"body": {"mimeType": "multipart/form-data", "params": [{"name": "file", "type": "file", "fileName": "/tmp/x"}, {"name": "note", "value": "hi"}]},
+			"authentication": {"type": "basic", "username": "u", "password": "p", "disabled": true}},
+		{"_id": "req_4", "_type": "request", "parentId": "wrk_1", "name": "Graph", "metaSortKey": 6, "method": "POST",
+			"url": "{{ _.baseUrl }}/graphql",
+			"body": {"mimeType": "application/graphql", "text": "{\"query\": \"{ invoices { id } }\", \"variables\": {\"first\": 2}}"}},
+		{"_id": "ws_1", "_type": "websocket_request", "parentId": "wrk_1", "name": "Events", "metaSortKey": 7, "url": "wss://billing.example.com/events"}
+	]
+}`
+
+func TestInsomniaService_ConvertToNikode(t *testing.T) {
+	svc := NewInsomniaService()
+
+	spec, err := svc.ParseExport([]byte(testInsomniaExport))
+	require.NoError(t, err)
+	data, err := svc.ConvertToNikode(spec)
+	require.NoError(t, err)
+
+	var collection NikodeCollection
+	require.NoError(t, json.Unmarshal(data, &collection))
+
+	assert.Equal(t, "Billing", collection.Name)
+
+	require.Len(t, collection.Environments, 1)
+	prod := collection.Environments[0]
+	assert.Equal(t, "env-production", prod.ID)
+	assert.Equal(t, "env-production", collection.ActiveEnvironmentID)
+	assert.Equal(t, []Variable{
+		{Key: "auth.token", Value: "dev", Enabled: true},
+		{Key: "baseUrl", Value: "https://billing.example.com", Enabled: true},
+	}, prod.Variables)
+
+	require.Len(t, collection.Items, 4)
+	invoices := collection.Items[0]
+	assert.Equal(t, "folder", invoices.Type)
+	assert.Equal(t, &Auth{Type: "bearer", Token: "{{auth.token}}"}, invoices.Auth)
+	require.Len(t, invoices.Items, 2)
+
+	list := invoices.Items[0]
+	assert.Equal(t, "List invoices", list.Name, "sorted by metaSortKey")
+	assert.Equal(t, "{{baseUrl}}/invoices", list.URL)
+	assert.Equal(t, "All invoices", list.Docs)
+	assert.Equal(t, []KeyValue{
+		{Key: "status", Value: "open", Enabled: true},
+		{Key: "limit", Value: "10", Enabled: false},
+	}, list.Params)
+	assert.Equal(t, &Auth{Type: "apikey", Key: "X-Key", Value: "k", In: "query"}, list.Auth)
+
+	create := invoices.Items[1]
+	assert.Equal(t, &RequestBody{Type: "json", Content: `{"amount": {{amount}}}`}, create.Body)
+	assert.Nil(t, create.Auth, "empty authentication inherits")
+
+	upload := collection.Items[1]
+	assert.Equal(t, "form-data", upload.Body.Type)
+	assert.Equal(t, []KeyValue{
+		{Key: "file", Value: "", Enabled: true},
+		{Key: "note", Value: "hi", Enabled: true},
+	}, upload.Body.Entries)
+	assert.Equal(t, "none", upload.Auth.Type)
+
+	graph := collection.Items[2]
+	assert.Equal(t, "graphql", graph.Type)
+	assert.Equal(t, "{ invoices { id } }", graph.GqlQuery)
+	assert.JSONEq(t, `{"first": 2}`, graph.GqlVariables)
+
+	events := collection.Items[3]
+	assert.Equal(t, "websocket", events.Type)
+	assert.Equal(t, "wss://billing.example.com/events", events.URL)
+}
+
+func TestInsomniaService_ParseExport_Errors(t *testing.T) {
+	svc := NewInsomniaService()
+
+	_, err := svc.ParseExport([]byte(`{"_type": "export", "__export_format": 3, "resources": []}`))
+	assert.ErrorContains(t, err, "unsupported Insomnia export format")
+}
@@ -1,25 +1,44 @@
 package services
 
 import (
+	"crypto/ed25519"
+	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// JWTService signs tokens with the newest signing key and verifies them with
+// any key named by their kid. Until keys are set, tokens are HS256 with the
+// secret. Once they are, HS256 tokens only verify if they were issued before
+// the first key and are younger than the refresh expiry, so the secret stops
+// verifying anything when the last token it signed has expired.
 type JWTService struct {
 	secret        []byte
 	accessExpiry  time.Duration
 	refreshExpiry time.Duration
+
+	mu      sync.RWMutex
+	signing *SigningKey
+	keys    map[string]*SigningKey
+	// legacyBefore is when the oldest key was created. Keys are kept longer
+	// than the refresh expiry after they are replaced, so the oldest key
+	// outlives every HS256 token issued before it.
+	legacyBefore time.Time
 }
 
 type Claims struct {
 	UserID     uuid.UUID `json:"user_id"`
 	Email      string    `json:"email"`
 	GlobalRole string    `json:"global_role"`
+	// SessionID is the session the token was issued to
+	SessionID uuid.UUID `json:"sid,omitzero"`
 	jwt.RegisteredClaims
 }
 
@@ -34,16 +53,114 @@ func NewJWTService(secret string, accessExpiry, refreshExpiry time.Duration) *JW
 		secret:        []byte(secret),
 		accessExpiry:  accessExpiry,
 		refreshExpiry: refreshExpiry,
+		keys:          make(map[string]*SigningKey),
+	}
+}
+
+// SetKeys replaces the keys tokens are signed and verified with. The first
+// key signs new tokens.
+func (s *JWTService) SetKeys(keys []SigningKey) {
+	byID := make(map[string]*SigningKey, len(keys))
+	for i := range keys {
+		byID[keys[i].ID] = &keys[i]
+	}
+
+	var legacyBefore time.Time
+	for _, key := range keys {
+		if legacyBefore.IsZero() || key.CreatedAt.Before(legacyBefore) {
+			legacyBefore = key.CreatedAt
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signing = nil
+	if len(keys) > 0 {
+		s.signing = &keys[0]
+	}
+	s.keys = byID
+	s.legacyBefore = legacyBefore
+}
+
+// JWKS returns the public keys tokens are verified with.
+func (s *JWTService) JWKS() JWKSet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range s.keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	return set
+}
+
+func (s *JWTService) sign(claims jwt.Claims) (string, error) {
+	s.mu.RLock()
+	key := s.signing
+	s.mu.RUnlock()
+
+	if key == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.PrivateKey)
+}
+
+// verificationKey picks the key a token is checked against from its kid.
+// Tokens without a kid are HS256 with the secret.
+func (s *JWTService) verificationKey(token *jwt.Token) (any, error) {
+	s.mu.RLock()
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	legacyBefore := s.legacyBefore
+	s.mu.RUnlock()
+
+	if kid == "" {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		if !legacyBefore.IsZero() && !s.legacyTokenValid(token, legacyBefore) {
+			return nil, errors.New("tokens signed with the secret are no longer accepted")
+		}
+		return s.secret, nil
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	switch pub := key.PrivateKey.Public().(type) {
+	case ed25519.PublicKey:
+		return pub, nil
+	case *rsa.PublicKey:
+		return pub, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key %q", kid)
 	}
 }
 
-func (s *JWTService) GenerateTokenPair(userID uuid.UUID, email, globalRole string) (*TokenPair, error) {
+// legacyTokenValid reports whether an HS256 token was issued before the
+// first signing key, within the refresh expiry
+func (s *JWTService) legacyTokenValid(token *jwt.Token, legacyBefore time.Time) bool {
+	issuedAt, err := token.Claims.GetIssuedAt()
+	if err != nil || issuedAt == nil {
+		return false
+	}
+	return issuedAt.Before(legacyBefore) && time.Since(issuedAt.Time) < s.refreshExpiry
+}
+
+func (s *JWTService) GenerateTokenPair(userID, sessionID uuid.UUID, email, globalRole string) (*TokenPair, error) {
 	now := time.Now()
 
 	accessClaims := Claims{
 		UserID:     userID,
 		Email:      email,
 		GlobalRole: globalRole,
+		SessionID:  sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessExpiry)),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -53,8 +170,7 @@ func (s *JWTService) GenerateTokenPair(userID uuid.UUID, email, globalRole strin
 		},
 	}
 
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(s.secret)
+	accessTokenString, err := s.sign(accessClaims)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign access token: %w", err)
 	}
@@ -68,8 +184,7 @@ func (s *JWTService) GenerateTokenPair(userID uuid.UUID, email, globalRole strin
 		ID:        uuid.New().String(),
 	}
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(s.secret)
+	refreshTokenString, err := s.sign(refreshClaims)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign refresh token: %w", err)
 	}
@@ -82,12 +197,7 @@ func (s *JWTService) GenerateTokenPair(userID uuid.UUID, email, globalRole strin
 }
 
 func (s *JWTService) ValidateAccessToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, s.verificationKey)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -102,12 +212,7 @@ func (s *JWTService) ValidateAccessToken(tokenString string) (*Claims, error) {
 }
 
 func (s *JWTService) ValidateRefreshToken(tokenString string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return s.secret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, s.verificationKey)
 
 	if err != nil {
 		return uuid.Nil, fmt.Errorf("failed to parse refresh token: %w", err)
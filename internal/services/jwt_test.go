@@ -4,6 +4,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,7 +22,7 @@ func TestJWTService_GenerateTokenPair(t *testing.T) {
 	userID := uuid.New()
 	email := "test@example.com"
 
-	pair, err := svc.GenerateTokenPair(userID, email, "user")
+	pair, err := svc.GenerateTokenPair(userID, uuid.Nil, email, "user")
 
 	require.NoError(t, err)
 	assert.NotEmpty(t, pair.AccessToken)
@@ -34,7 +35,7 @@ func TestJWTService_ValidateAccessToken_Valid(t *testing.T) {
 	userID := uuid.New()
 	email := "test@example.com"
 
-	pair, err := svc.GenerateTokenPair(userID, email, "user")
+	pair, err := svc.GenerateTokenPair(userID, uuid.Nil, email, "user")
 	require.NoError(t, err)
 
 	claims, err := svc.ValidateAccessToken(pair.AccessToken)
@@ -49,7 +50,7 @@ func TestJWTService_ValidateAccessToken_WrongSecret(t *testing.T) {
 	svc1 := NewJWTService("secret-1", 15*time.Minute, 24*time.Hour)
 	svc2 := NewJWTService("secret-2", 15*time.Minute, 24*time.Hour)
 
-	pair, err := svc1.GenerateTokenPair(uuid.New(), "test@example.com", "user")
+	pair, err := svc1.GenerateTokenPair(uuid.New(), uuid.Nil, "test@example.com", "user")
 	require.NoError(t, err)
 
 	_, err = svc2.ValidateAccessToken(pair.AccessToken)
@@ -62,7 +63,7 @@ func TestJWTService_ValidateAccessToken_Expired(t *testing.T) {
 	// Create service with very short expiry
 	svc := NewJWTService("test-secret", 1*time.Millisecond, 24*time.Hour)
 
-	pair, err := svc.GenerateTokenPair(uuid.New(), "test@example.com", "user")
+	pair, err := svc.GenerateTokenPair(uuid.New(), uuid.Nil, "test@example.com", "user")
 	require.NoError(t, err)
 
 	// Wait for token to expire
@@ -98,7 +99,7 @@ func TestJWTService_ValidateRefreshToken_Valid(t *testing.T) {
 	svc := NewJWTService("test-secret", 15*time.Minute, 24*time.Hour)
 	userID := uuid.New()
 
-	pair, err := svc.GenerateTokenPair(userID, "test@example.com", "user")
+	pair, err := svc.GenerateTokenPair(userID, uuid.Nil, "test@example.com", "user")
 	require.NoError(t, err)
 
 	returnedUserID, err := svc.ValidateRefreshToken(pair.RefreshToken)
@@ -111,7 +112,7 @@ func TestJWTService_ValidateRefreshToken_WrongSecret(t *testing.T) {
 	svc1 := NewJWTService("secret-1", 15*time.Minute, 24*time.Hour)
 	svc2 := NewJWTService("secret-2", 15*time.Minute, 24*time.Hour)
 
-	pair, err := svc1.GenerateTokenPair(uuid.New(), "test@example.com", "user")
+	pair, err := svc1.GenerateTokenPair(uuid.New(), uuid.Nil, "test@example.com", "user")
 	require.NoError(t, err)
 
 	_, err = svc2.ValidateRefreshToken(pair.RefreshToken)
@@ -122,7 +123,7 @@ func TestJWTService_ValidateRefreshToken_WrongSecret(t *testing.T) {
 func TestJWTService_ValidateRefreshToken_Expired(t *testing.T) {
 	svc := NewJWTService("test-secret", 15*time.Minute, 1*time.Millisecond)
 
-	pair, err := svc.GenerateTokenPair(uuid.New(), "test@example.com", "user")
+	pair, err := svc.GenerateTokenPair(uuid.New(), uuid.Nil, "test@example.com", "user")
 	require.NoError(t, err)
 
 	time.Sleep(10 * time.Millisecond)
@@ -153,15 +154,160 @@ func TestJWTService_RefreshTokensAreDifferent(t *testing.T) {
 	svc := NewJWTService("test-secret", 15*time.Minute, 24*time.Hour)
 	userID := uuid.New()
 
-	pair1, err := svc.GenerateTokenPair(userID, "test@example.com", "user")
+	pair1, err := svc.GenerateTokenPair(userID, uuid.Nil, "test@example.com", "user")
 	require.NoError(t, err)
 
 	// Wait a bit to ensure different timestamps
 	time.Sleep(5 * time.Millisecond)
 
-	pair2, err := svc.GenerateTokenPair(userID, "test@example.com", "user")
+	pair2, err := svc.GenerateTokenPair(userID, uuid.Nil, "test@example.com", "user")
 	require.NoError(t, err)
 
 	// Refresh tokens should be different due to different JTI (unique ID)
 	assert.NotEqual(t, pair1.RefreshToken, pair2.RefreshToken)
 }
+
+func testSigningKey(t *testing.T, algorithm string) SigningKey {
+	t.Helper()
+	key, err := generateSigningKey(algorithm)
+	require.NoError(t, err)
+	return SigningKey{ID: uuid.New().String(), Algorithm: algorithm, PrivateKey: key, CreatedAt: time.Now()}
+}
+
+func TestJWTService_SigningKeys(t *testing.T) {
+	for _, algorithm := range []string{SigningAlgorithmEdDSA, SigningAlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			svc := NewJWTService("test-secret", 15*time.Minute, 24*time.Hour)
+			key := testSigningKey(t, algorithm)
+			svc.SetKeys([]SigningKey{key})
+			userID := uuid.New()
+
+			pair, err := svc.GenerateTokenPair(userID, uuid.Nil, "test@example.com", "user")
+			require.NoError(t, err)
+
+			token, _, err := jwt.NewParser().ParseUnverified(pair.AccessToken, &Claims{})
+			require.NoError(t, err)
+			assert.Equal(t, key.ID, token.Header["kid"])
+			assert.Equal(t, algorithm, token.Method.Alg())
+
+			claims, err := svc.ValidateAccessToken(pair.AccessToken)
+			require.NoError(t, err)
+			assert.Equal(t, userID, claims.UserID)
+
+			refreshUserID, err := svc.ValidateRefreshToken(pair.RefreshToken)
+			require.NoError(t, err)
+			assert.Equal(t, userID, refreshUserID)
+		})
+	}
+}
+
+func TestJWTService_SigningKeys_Rotation(t *testing.T) {
+	legacy := NewJWTService("test-secret", 15*time.Minute, 24*time.Hour)
+	legacyPair, err := legacy.GenerateTokenPair(uuid.New(), uuid.Nil, "test@example.com", "user")
+	require.NoError(t, err)
+
+	svc := NewJWTService("test-secret", 15*time.Minute, 24*time.Hour)
+	oldKey := testSigningKey(t, SigningAlgorithmEdDSA)
+	svc.SetKeys([]SigningKey{oldKey})
+
+	oldPair, err := svc.GenerateTokenPair(uuid.New(), uuid.Nil, "test@example.com", "user")
+	require.NoError(t, err)
+
+	newKey := testSigningKey(t, SigningAlgorithmEdDSA)
+	svc.SetKeys([]SigningKey{newKey, oldKey})
+
+	// Tokens from the replaced key and from before signing keys still verify
+	_, err = svc.ValidateAccessToken(oldPair.AccessToken)
+	assert.NoError(t, err)
+	_, err = svc.ValidateAccessToken(legacyPair.AccessToken)
+	assert.NoError(t, err)
+
+	svc.SetKeys([]SigningKey{newKey})
+
+	_, err = svc.ValidateAccessToken(oldPair.AccessToken)
+	assert.Error(t, err)
+}
+
+func TestJWTService_SigningKeys_LegacyWindow(t *testing.T) {
+	svc := NewJWTService("test-secret", 15*time.Minute, 24*time.Hour)
+	key := testSigningKey(t, SigningAlgorithmEdDSA)
+	key.CreatedAt = time.Now().Add(-time.Hour)
+	svc.SetKeys([]SigningKey{key})
+
+	legacyToken := func(issuedAt time.Time) string {
+		t.Helper()
+		claims := Claims{
+			UserID: uuid.New(),
+			RegisteredClaims: jwt.RegisteredClaims{
+				IssuedAt:  jwt.NewNumericDate(issuedAt),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}
+		tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+		require.NoError(t, err)
+		return tokenString
+	}
+
+	// Issued before the first key and within the refresh expiry
+	_, err := svc.ValidateAccessToken(legacyToken(key.CreatedAt.Add(-time.Hour)))
+	assert.NoError(t, err)
+
+	// Issued after the first key, as only someone holding the secret could
+	_, err = svc.ValidateAccessToken(legacyToken(time.Now()))
+	assert.Error(t, err)
+
+	// Older than any refresh token can be
+	_, err = svc.ValidateAccessToken(legacyToken(time.Now().Add(-25 * time.Hour)))
+	assert.Error(t, err)
+
+	// Without an issue time
+	tokenString, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).SignedString([]byte("test-secret"))
+	require.NoError(t, err)
+	_, err = svc.ValidateAccessToken(tokenString)
+	assert.Error(t, err)
+}
+
+func TestJWTService_SigningKeys_AlgorithmMismatch(t *testing.T) {
+	svc := NewJWTService("test-secret", 15*time.Minute, 24*time.Hour)
+	key := testSigningKey(t, SigningAlgorithmEdDSA)
+	svc.SetKeys([]SigningKey{key})
+
+	// A token naming a known kid but signed HS256 must not verify
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: uuid.New().String()})
+	forged.Header["kid"] = key.ID
+	tokenString, err := forged.SignedString([]byte("test-secret"))
+	require.NoError(t, err)
+
+	_, err = svc.ValidateAccessToken(tokenString)
+
+	assert.Error(t, err)
+}
+
+func TestJWTService_JWKS(t *testing.T) {
+	svc := NewJWTService("test-secret", 15*time.Minute, 24*time.Hour)
+	assert.Empty(t, svc.JWKS().Keys)
+
+	edKey := testSigningKey(t, SigningAlgorithmEdDSA)
+	rsaKey := testSigningKey(t, SigningAlgorithmRS256)
+	svc.SetKeys([]SigningKey{edKey, rsaKey})
+
+	jwks := svc.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	for _, jwk := range jwks.Keys {
+		assert.Equal(t, "sig", jwk.Use)
+		switch jwk.KeyID {
+		case edKey.ID:
+			assert.Equal(t, "OKP", jwk.KeyType)
+			assert.Equal(t, "Ed25519", jwk.Curve)
+			assert.NotEmpty(t, jwk.X)
+		case rsaKey.ID:
+			assert.Equal(t, "RSA", jwk.KeyType)
+			assert.Equal(t, "AQAB", jwk.E)
+			assert.NotEmpty(t, jwk.N)
+		default:
+			t.Fatalf("unexpected key %s", jwk.KeyID)
+		}
+	}
+}
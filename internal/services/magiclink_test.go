@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/jackc/pgx/v5"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMagicLinkService(t *testing.T) (*MagicLinkService, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	t.Cleanup(func() { mock.Close() })
+
+	db := &database.DB{Pool: mock}
+	return NewMagicLinkService(db, "test-secret", 15*time.Minute), mock
+}
+
+func TestMagicLinkService_CreateAndConsume(t *testing.T) {
+	svc, mock := setupMagicLinkService(t)
+	ctx := context.Background()
+
+	mock.ExpectExec(`DELETE FROM magic_link_tokens WHERE expires_at`).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`INSERT INTO magic_link_tokens`).
+		WithArgs(pgxmock.AnyArg(), "ada@example.com", pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	token, err := svc.Create(ctx, "ada@example.com")
+	require.NoError(t, err)
+	assert.Contains(t, token, ".")
+
+	mock.ExpectQuery(`DELETE FROM magic_link_tokens WHERE token_hash = .+ RETURNING email, expires_at`).
+		WithArgs(HashToken(token)).
+		WillReturnRows(pgxmock.NewRows([]string{"email", "expires_at"}).
+			AddRow("ada@example.com", time.Now().Add(10*time.Minute)))
+
+	email, err := svc.Consume(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", email)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMagicLinkService_Consume_BadSignature(t *testing.T) {
+	svc, mock := setupMagicLinkService(t)
+	other := NewMagicLinkService(nil, "other-secret", time.Minute)
+
+	nonce := "bm9uY2U"
+	for _, token := range []string{"", nonce, nonce + ".forged", nonce + "." + other.sign(nonce)} {
+		_, err := svc.Consume(context.Background(), token)
+		assert.ErrorIs(t, err, ErrMagicLinkInvalid, token)
+	}
+	// Rejected before touching the database
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMagicLinkService_Consume_AlreadyUsed(t *testing.T) {
+	svc, mock := setupMagicLinkService(t)
+	token := "bm9uY2U." + svc.sign("bm9uY2U")
+
+	mock.ExpectQuery(`DELETE FROM magic_link_tokens WHERE token_hash`).
+		WithArgs(HashToken(token)).
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err := svc.Consume(context.Background(), token)
+
+	assert.ErrorIs(t, err, ErrMagicLinkInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMagicLinkService_Consume_Expired(t *testing.T) {
+	svc, mock := setupMagicLinkService(t)
+	token := "bm9uY2U." + svc.sign("bm9uY2U")
+
+	mock.ExpectQuery(`DELETE FROM magic_link_tokens WHERE token_hash`).
+		WithArgs(HashToken(token)).
+		WillReturnRows(pgxmock.NewRows([]string{"email", "expires_at"}).
+			AddRow("ada@example.com", time.Now().Add(-time.Minute)))
+
+	_, err := svc.Consume(context.Background(), token)
+
+	assert.ErrorIs(t, err, ErrMagicLinkInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
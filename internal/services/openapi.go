@@ -3,7 +3,11 @@ package services
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/url"
+	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -23,6 +27,7 @@ type NikodeCollection struct {
 	Version             string           `json:"version"`
 	Environments        []Environment    `json:"environments"`
 	ActiveEnvironmentID string           `json:"activeEnvironmentId"`
+	Auth                *Auth            `json:"auth,omitempty"`
 	Items               []CollectionItem `json:"items"`
 }
 
@@ -33,10 +38,11 @@ type Environment struct {
 }
 
 type Variable struct {
-	Key     string `json:"key"`
-	Value   string `json:"value"`
-	Enabled bool   `json:"enabled"`
-	Secret  bool   `json:"secret,omitempty"`
+	Key     string   `json:"key"`
+	Value   string   `json:"value"`
+	Enabled bool     `json:"enabled"`
+	Secret  bool     `json:"secret,omitempty"`
+	Enum    []string `json:"enum,omitempty"`
 }
 
 type CollectionItem struct {
@@ -50,7 +56,24 @@ type CollectionItem struct {
 	Headers []KeyValue       `json:"headers,omitempty"`
 	Body    *RequestBody     `json:"body,omitempty"`
 	Scripts *Scripts         `json:"scripts,omitempty"`
+	Auth    *Auth            `json:"auth,omitempty"`
 	Docs    string           `json:"docs,omitempty"`
+
+	// WebSocket-specific
+	WsProtocols     []string                `json:"wsProtocols,omitempty"`
+	WsSavedMessages []WebSocketSavedMessage `json:"wsSavedMessages,omitempty"`
+
+	// GraphQL-specific
+	GqlQuery         string `json:"gqlQuery,omitempty"`
+	GqlVariables     string `json:"gqlVariables,omitempty"`
+	GqlOperationName string `json:"gqlOperationName,omitempty"`
+}
+
+type WebSocketSavedMessage struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
 }
 
 type KeyValue struct {
@@ -70,6 +93,31 @@ type Scripts struct {
 	Post string `json:"post"`
 }
 
+// Auth describes how a request authenticates. It can be set on the collection,
+// on folders and on individual requests; items without auth inherit from the
+// closest parent that has it, and type "none" turns inherited auth off.
+type Auth struct {
+	Type     string      `json:"type"` // "none", "bearer", "basic", "apikey", "oauth2"
+	Token    string      `json:"token,omitempty"`
+	Username string      `json:"username,omitempty"`
+	Password string      `json:"password,omitempty"`
+	Key      string      `json:"key,omitempty"`
+	Value    string      `json:"value,omitempty"`
+	In       string      `json:"in,omitempty"` // "header", "query", "cookie" (apikey only)
+	OAuth2   *OAuth2Auth `json:"oauth2,omitempty"`
+}
+
+type OAuth2Auth struct {
+	GrantType    string `json:"grantType"` // "authorization_code", "client_credentials", "password", "implicit"
+	AuthURL      string `json:"authUrl,omitempty"`
+	TokenURL     string `json:"tokenUrl,omitempty"`
+	RefreshURL   string `json:"refreshUrl,omitempty"`
+	ClientID     string `json:"clientId"`
+	ClientSecret string `json:"clientSecret,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	AccessToken  string `json:"accessToken"`
+}
+
 // ParseOpenAPI parses OpenAPI content (auto-detects JSON/YAML) and returns the spec
 func (s *OpenAPIService) ParseOpenAPI(content []byte) (any, error) {
 	loader := openapi3.NewLoader()
@@ -103,12 +151,21 @@ func (s *OpenAPIService) ConvertToNikode(specInterface any) (json.RawMessage, er
 		return nil, fmt.Errorf("invalid spec type, expected *openapi3.T")
 	}
 
+	security := newSecurityResolver(spec)
+
 	collection := NikodeCollection{
-		Name:                s.extractTitle(spec),
-		Version:             s.extractVersion(spec),
-		Environments:        s.createEnvironments(spec),
-		ActiveEnvironmentID: "env-default",
-		Items:               s.convertPaths(spec),
+		Name:         s.extractTitle(spec),
+		Version:      s.extractVersion(spec),
+		Environments: s.createEnvironments(spec.Servers, "http://localhost:3000"),
+		Auth:         security.resolve(spec.Security),
+		Items:        s.convertPaths(spec, security),
+	}
+	collection.ActiveEnvironmentID = collection.Environments[0].ID
+	collection.Items = s.assignInheritedAuth(collection.Items, collection.Auth)
+
+	// Credentials referenced by the auth settings start out empty in every environment
+	for i := range collection.Environments {
+		collection.Environments[i].Variables = append(collection.Environments[i].Variables, security.variables()...)
 	}
 
 	data, err := json.Marshal(collection)
@@ -133,30 +190,103 @@ func (s *OpenAPIService) extractVersion(spec *openapi3.T) string {
 	return "1.0.0"
 }
 
-func (s *OpenAPIService) extractBaseURL(spec *openapi3.T) string {
-	if len(spec.Servers) > 0 && spec.Servers[0].URL != "" {
-		return spec.Servers[0].URL
+// createEnvironments returns one environment per server, or a single default
+// environment pointing at defaultBaseURL when no server has a URL.
+func (s *OpenAPIService) createEnvironments(specServers openapi3.Servers, defaultBaseURL string) []Environment {
+	var servers []*openapi3.Server
+	for _, server := range specServers {
+		if server != nil && server.URL != "" {
+			servers = append(servers, server)
+		}
 	}
-	return "http://localhost:3000"
-}
 
-func (s *OpenAPIService) createEnvironments(spec *openapi3.T) []Environment {
-	return []Environment{
-		{
-			ID:   "env-default",
-			Name: "Default",
-			Variables: []Variable{
-				{
-					Key:     "baseUrl",
-					Value:   s.extractBaseURL(spec),
-					Enabled: true,
+	if len(servers) == 0 {
+		return []Environment{
+			{
+				ID:   "env-default",
+				Name: "Default",
+				Variables: []Variable{
+					{Key: "baseUrl", Value: defaultBaseURL, Enabled: true},
 				},
 			},
-		},
+		}
+	}
+
+	environments := make([]Environment, 0, len(servers))
+	usedIDs := make(map[string]bool)
+	for i, server := range servers {
+		name := s.serverEnvironmentName(server, i, len(servers))
+		baseID := "env-" + s.slugify(name)
+		if baseID == "env-" {
+			baseID = "env-server"
+		}
+		id := baseID
+		for n := 2; usedIDs[id]; n++ {
+			id = fmt.Sprintf("%s-%d", baseID, n)
+		}
+		usedIDs[id] = true
+
+		environments = append(environments, Environment{
+			ID:        id,
+			Name:      name,
+			Variables: s.serverVariables(server),
+		})
+	}
+
+	return environments
+}
+
+// serverEnvironmentName picks a display name for the environment generated
+// from a server entry. A lone server without a description keeps the
+// historical "Default" name so existing collections map onto the same ID.
+func (s *OpenAPIService) serverEnvironmentName(server *openapi3.Server, index, total int) string {
+	if desc := strings.TrimSpace(server.Description); desc != "" {
+		return desc
+	}
+	if total == 1 {
+		return "Default"
+	}
+	if u, err := url.Parse(server.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return fmt.Sprintf("Server %d", index+1)
+}
+
+// serverVariables returns the baseUrl variable followed by one variable per
+// server variable, sorted by name. Templated segments such as {region} are
+// rewritten to {{region}} so they resolve against the same environment.
+func (s *OpenAPIService) serverVariables(server *openapi3.Server) []Variable {
+	variables := []Variable{
+		{Key: "baseUrl", Value: s.convertPathParams(server.URL), Enabled: true},
+	}
+
+	names := make([]string, 0, len(server.Variables))
+	for name := range server.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		sv := server.Variables[name]
+		if sv == nil {
+			continue
+		}
+		value := sv.Default
+		if value == "" && len(sv.Enum) > 0 {
+			value = sv.Enum[0]
+		}
+		variables = append(variables, Variable{
+			Key:     name,
+			Value:   value,
+			Enabled: true,
+			Enum:    sv.Enum,
+		})
 	}
+
+	return variables
 }
 
-func (s *OpenAPIService) convertPaths(spec *openapi3.T) []CollectionItem {
+func (s *OpenAPIService) convertPaths(spec *openapi3.T, security *securityResolver) []CollectionItem {
 	// Group operations by tag
 	tagFolders := make(map[string]*CollectionItem)
 	var rootItems []CollectionItem
@@ -183,6 +313,13 @@ func (s *OpenAPIService) convertPaths(spec *openapi3.T) []CollectionItem {
 			}
 
 			request := s.convertOperationToRequest(pathStr, method, op)
+			request.Auth = security.resolve(spec.Security)
+			if op.Security != nil {
+				request.Auth = security.resolve(*op.Security)
+				if request.Auth == nil {
+					request.Auth = &Auth{Type: "none"}
+				}
+			}
 
 			// Get tag for organization
 			tag := s.getFirstTag(op)
@@ -215,21 +352,222 @@ func (s *OpenAPIService) convertPaths(spec *openapi3.T) []CollectionItem {
 	return items
 }
 
+// assignInheritedAuth removes auth settings that repeat the parent's so that
+// items inherit them. When every request in a folder shares auth that differs
+// from the parent, the setting is hoisted onto the folder instead.
+func (s *OpenAPIService) assignInheritedAuth(items []CollectionItem, parent *Auth) []CollectionItem {
+	for i := range items {
+		item := &items[i]
+		if item.Type != "folder" {
+			if sameAuth(item.Auth, parent) {
+				item.Auth = nil
+			} else if item.Auth == nil {
+				item.Auth = &Auth{Type: "none"}
+			}
+			continue
+		}
+
+		folderAuth := parent
+		if len(item.Items) > 0 && s.sharedAuth(item.Items) {
+			folderAuth = item.Items[0].Auth
+		}
+		if sameAuth(folderAuth, parent) {
+			item.Auth = nil
+		} else {
+			item.Auth = folderAuth
+		}
+		item.Items = s.assignInheritedAuth(item.Items, folderAuth)
+	}
+	return items
+}
+
+func (s *OpenAPIService) sharedAuth(items []CollectionItem) bool {
+	for _, item := range items {
+		if item.Type == "folder" || !sameAuth(item.Auth, items[0].Auth) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameAuth(a, b *Auth) bool {
+	if a == nil || a.Type == "none" {
+		return b == nil || b.Type == "none"
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// securityResolver maps OpenAPI security requirements onto Nikode auth
+// settings for a single conversion. Credentials are referenced through
+// environment variables, which are allocated on first use.
+type securityResolver struct {
+	schemes  openapi3.SecuritySchemes
+	varNames map[string]string // scheme name + "." + base name -> variable key
+	varOrder []Variable
+	used     map[string]bool
+}
+
+func newSecurityResolver(spec *openapi3.T) *securityResolver {
+	r := &securityResolver{
+		varNames: make(map[string]string),
+		used:     make(map[string]bool),
+	}
+	if spec.Components != nil {
+		r.schemes = spec.Components.SecuritySchemes
+	}
+	return r
+}
+
+// resolve returns the auth for a list of alternative requirements, using the
+// first alternative that names a supported scheme. Requirements combining
+// several schemes only carry over their first scheme in name order.
+func (r *securityResolver) resolve(requirements openapi3.SecurityRequirements) *Auth {
+	for _, requirement := range requirements {
+		names := make([]string, 0, len(requirement))
+		for name := range requirement {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if auth := r.schemeAuth(name, requirement[name]); auth != nil {
+				return auth
+			}
+		}
+	}
+	return nil
+}
+
+func (r *securityResolver) schemeAuth(name string, scopes []string) *Auth {
+	ref, ok := r.schemes[name]
+	if !ok || ref == nil || ref.Value == nil {
+		return nil
+	}
+	scheme := ref.Value
+
+	switch scheme.Type {
+	case "http":
+		switch strings.ToLower(scheme.Scheme) {
+		case "bearer":
+			return &Auth{Type: "bearer", Token: r.variable(name, "token", true)}
+		case "basic":
+			return &Auth{
+				Type:     "basic",
+				Username: r.variable(name, "username", false),
+				Password: r.variable(name, "password", true),
+			}
+		}
+	case "apiKey":
+		if scheme.Name == "" {
+			return nil
+		}
+		in := scheme.In
+		if in != "query" && in != "cookie" {
+			in = "header"
+		}
+		return &Auth{
+			Type:  "apikey",
+			Key:   scheme.Name,
+			Value: r.variable(name, "apiKey", true),
+			In:    in,
+		}
+	case "oauth2":
+		return r.oauth2Auth(name, scheme, scopes)
+	case "openIdConnect":
+		return &Auth{Type: "bearer", Token: r.variable(name, "accessToken", true)}
+	}
+	return nil
+}
+
+func (r *securityResolver) oauth2Auth(name string, scheme *openapi3.SecurityScheme, scopes []string) *Auth {
+	if scheme.Flows == nil {
+		return nil
+	}
+
+	var grantType string
+	var flow *openapi3.OAuthFlow
+	switch {
+	case scheme.Flows.AuthorizationCode != nil:
+		grantType, flow = "authorization_code", scheme.Flows.AuthorizationCode
+	case scheme.Flows.ClientCredentials != nil:
+		grantType, flow = "client_credentials", scheme.Flows.ClientCredentials
+	case scheme.Flows.Password != nil:
+		grantType, flow = "password", scheme.Flows.Password
+	case scheme.Flows.Implicit != nil:
+		grantType, flow = "implicit", scheme.Flows.Implicit
+	default:
+		return nil
+	}
+
+	// Without scopes on the requirement, request every scope the flow offers
+	if len(scopes) == 0 {
+		for scope := range flow.Scopes {
+			scopes = append(scopes, scope)
+		}
+		sort.Strings(scopes)
+	}
+
+	config := &OAuth2Auth{
+		GrantType:   grantType,
+		AuthURL:     flow.AuthorizationURL,
+		TokenURL:    flow.TokenURL,
+		RefreshURL:  flow.RefreshURL,
+		ClientID:    r.variable(name, "clientId", false),
+		Scope:       strings.Join(scopes, " "),
+		AccessToken: r.variable(name, "accessToken", true),
+	}
+	if grantType != "implicit" {
+		config.ClientSecret = r.variable(name, "clientSecret", true)
+	}
+
+	return &Auth{Type: "oauth2", OAuth2: config}
+}
+
+// variable returns a {{reference}} to the environment variable holding a
+// credential of the given scheme. The first scheme to use a base name gets it
+// unchanged; other schemes get the base name suffixed with their own name.
+func (r *securityResolver) variable(schemeName, base string, secret bool) string {
+	id := schemeName + "." + base
+	if key, ok := r.varNames[id]; ok {
+		return "{{" + key + "}}"
+	}
+
+	key := base
+	if r.used[key] {
+		key = base + "_" + strings.ReplaceAll(slugifyText(schemeName), "-", "_")
+		for n := 2; r.used[key]; n++ {
+			key = fmt.Sprintf("%s_%d", key, n)
+		}
+	}
+	r.used[key] = true
+	r.varNames[id] = key
+	r.varOrder = append(r.varOrder, Variable{Key: key, Value: "", Enabled: true, Secret: secret})
+
+	return "{{" + key + "}}"
+}
+
+// variables returns the credential variables referenced so far, in order of first use.
+func (r *securityResolver) variables() []Variable {
+	vars := make([]Variable, len(r.varOrder))
+	copy(vars, r.varOrder)
+	return vars
+}
+
 func (s *OpenAPIService) convertOperationToRequest(pathStr, method string, op *openapi3.Operation) CollectionItem {
 	// Convert path parameters from {param} to {{param}}
-	url := "{{baseUrl}}" + s.convertPathParams(pathStr)
+	requestURL := "{{baseUrl}}" + s.convertPathParams(pathStr)
 
 	request := CollectionItem{
 		ID:      s.generateID("req", s.getOperationID(op, method, pathStr)),
 		Type:    "request",
 		Name:    s.getOperationName(op, method, pathStr),
 		Method:  method,
-		URL:     url,
+		URL:     requestURL,
 		Params:  s.extractQueryParams(op),
 		Headers: s.extractHeaders(op),
 		Body:    s.convertRequestBody(op),
 		Scripts: &Scripts{Pre: "", Post: ""},
-		Docs:    s.getDescription(op),
+		Docs:    s.buildDocs(op),
 	}
 
 	return request
@@ -278,7 +616,7 @@ func (s *OpenAPIService) extractQueryParams(op *openapi3.Operation) []KeyValue {
 		if param != nil && param.In == "query" {
 			params = append(params, KeyValue{
 				Key:     param.Name,
-				Value:   s.getExampleValue(param.Schema),
+				Value:   s.getParameterExample(param),
 				Enabled: param.Required,
 			})
 		}
@@ -293,7 +631,7 @@ func (s *OpenAPIService) extractHeaders(op *openapi3.Operation) []KeyValue {
 		if param != nil && param.In == "header" {
 			headers = append(headers, KeyValue{
 				Key:     param.Name,
-				Value:   s.getExampleValue(param.Schema),
+				Value:   s.getParameterExample(param),
 				Enabled: param.Required,
 			})
 		}
@@ -311,11 +649,11 @@ func (s *OpenAPIService) convertRequestBody(op *openapi3.Operation) *RequestBody
 		return &RequestBody{Type: "none"}
 	}
 
-	// Check for JSON
-	if mediaType, ok := content["application/json"]; ok {
+	// Check for JSON, including vendor types such as application/vnd.api+json
+	if _, mediaType := s.jsonMediaType(content); mediaType != nil {
 		return &RequestBody{
 			Type:    "json",
-			Content: s.generateExampleJSON(mediaType.Schema),
+			Content: s.mediaTypeExampleJSON(mediaType, exampleModeRequest),
 		}
 	}
 
@@ -336,10 +674,10 @@ func (s *OpenAPIService) convertRequestBody(op *openapi3.Operation) *RequestBody
 	}
 
 	// Check for text/plain
-	if _, ok := content["text/plain"]; ok {
+	if mediaType, ok := content["text/plain"]; ok {
 		return &RequestBody{
 			Type:    "raw",
-			Content: "",
+			Content: s.mediaTypeExampleText(mediaType),
 		}
 	}
 
@@ -347,12 +685,48 @@ func (s *OpenAPIService) convertRequestBody(op *openapi3.Operation) *RequestBody
 	return &RequestBody{Type: "raw", Content: ""}
 }
 
-func (s *OpenAPIService) generateExampleJSON(schemaRef *openapi3.SchemaRef) string {
-	if schemaRef == nil || schemaRef.Value == nil {
-		return "{}"
+// jsonMediaType returns application/json if present, otherwise the first
+// (by name) media type with a JSON structured syntax suffix.
+func (s *OpenAPIService) jsonMediaType(content openapi3.Content) (string, *openapi3.MediaType) {
+	if mediaType, ok := content["application/json"]; ok && mediaType != nil {
+		return "application/json", mediaType
+	}
+
+	names := make([]string, 0, len(content))
+	for name := range content {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	example := s.generateSchemaExample(schemaRef.Value)
+	for _, name := range names {
+		if strings.HasSuffix(strings.SplitN(name, ";", 2)[0], "+json") && content[name] != nil {
+			return name, content[name]
+		}
+	}
+	return "", nil
+}
+
+// mediaTypeExample returns the example for a media type, preferring the
+// media type's own example, then its named examples (by name, "default"
+// first), then an example synthesized from its schema.
+func (s *OpenAPIService) mediaTypeExample(mediaType *openapi3.MediaType, mode exampleMode) (any, bool) {
+	if mediaType.Example != nil {
+		return mediaType.Example, true
+	}
+	if value, ok := s.namedExample(mediaType.Examples); ok {
+		return value, true
+	}
+	if mediaType.Schema == nil || mediaType.Schema.Value == nil {
+		return nil, false
+	}
+	return newExampleGenerator(mode).generate(mediaType.Schema.Value, 0), true
+}
+
+func (s *OpenAPIService) mediaTypeExampleJSON(mediaType *openapi3.MediaType, mode exampleMode) string {
+	example, ok := s.mediaTypeExample(mediaType, mode)
+	if !ok {
+		return "{}"
+	}
 	data, err := json.MarshalIndent(example, "", "  ")
 	if err != nil {
 		return "{}"
@@ -360,52 +734,114 @@ func (s *OpenAPIService) generateExampleJSON(schemaRef *openapi3.SchemaRef) stri
 	return string(data)
 }
 
-func (s *OpenAPIService) generateSchemaExample(schema *openapi3.Schema) any {
+func (s *OpenAPIService) mediaTypeExampleText(mediaType *openapi3.MediaType) string {
+	if mediaType.Example != nil {
+		return fmt.Sprintf("%v", mediaType.Example)
+	}
+	if value, ok := s.namedExample(mediaType.Examples); ok {
+		return fmt.Sprintf("%v", value)
+	}
+	return ""
+}
+
+func (s *OpenAPIService) namedExample(examples openapi3.Examples) (any, bool) {
+	names := make([]string, 0, len(examples))
+	for name := range examples {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == "default" || names[j] == "default" {
+			return names[i] == "default"
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		ref := examples[name]
+		if ref != nil && ref.Value != nil && ref.Value.Value != nil {
+			return ref.Value.Value, true
+		}
+	}
+	return nil, false
+}
+
+type exampleMode int
+
+const (
+	exampleModeRequest exampleMode = iota
+	exampleModeResponse
+)
+
+// maxExampleDepth bounds how deep nested schemas are expanded. It also stops
+// recursive schemas that are reached through different paths.
+const maxExampleDepth = 8
+
+// maxExampleStringLength bounds how far an example string is padded to reach
+// its schema's minLength.
+const maxExampleStringLength = 64
+
+// exampleGenerator synthesizes example values from schemas. Read-only
+// properties are left out of request examples and write-only properties out
+// of response examples. Schemas already being expanded further up the tree
+// are not expanded again, so self-referencing schemas terminate.
+type exampleGenerator struct {
+	mode     exampleMode
+	visiting map[*openapi3.Schema]bool
+}
+
+func newExampleGenerator(mode exampleMode) *exampleGenerator {
+	return &exampleGenerator{
+		mode:     mode,
+		visiting: make(map[*openapi3.Schema]bool),
+	}
+}
+
+func (g *exampleGenerator) generate(schema *openapi3.Schema, depth int) any {
+	if schema == nil {
+		return nil
+	}
+
 	if schema.Example != nil {
 		return schema.Example
 	}
-
 	if schema.Default != nil {
 		return schema.Default
 	}
+	if len(schema.Enum) > 0 {
+		return schema.Enum[0]
+	}
 
-	// Handle nil or empty type
-	types := schema.Type
-	if types == nil || len(types.Slice()) == 0 {
-		// If no type is specified, try to infer from properties
-		if len(schema.Properties) > 0 {
-			obj := make(map[string]any)
-			for propName, propRef := range schema.Properties {
-				if propRef.Value != nil {
-					obj[propName] = s.generateSchemaExample(propRef.Value)
-				}
-			}
-			return obj
+	if g.visiting[schema] || depth > maxExampleDepth {
+		return g.emptyValue(schema)
+	}
+	g.visiting[schema] = true
+	defer delete(g.visiting, schema)
+
+	if len(schema.AllOf) > 0 {
+		return g.generateAllOf(schema, depth)
+	}
+	for _, alternatives := range []openapi3.SchemaRefs{schema.OneOf, schema.AnyOf} {
+		if len(alternatives) > 0 && alternatives[0] != nil {
+			return g.mergeValues(g.generateOwn(schema, depth), g.generate(alternatives[0].Value, depth+1))
 		}
-		return nil
 	}
 
-	switch types.Slice()[0] {
+	return g.generateOwn(schema, depth)
+}
+
+// generateOwn generates a value from the schema's own keywords, ignoring composition.
+func (g *exampleGenerator) generateOwn(schema *openapi3.Schema, depth int) any {
+	switch g.schemaType(schema) {
 	case "object":
-		obj := make(map[string]any)
-		for propName, propRef := range schema.Properties {
-			if propRef.Value != nil {
-				obj[propName] = s.generateSchemaExample(propRef.Value)
-			}
-		}
-		return obj
+		return g.generateObject(schema, depth)
 	case "array":
-		if schema.Items != nil && schema.Items.Value != nil {
-			return []any{s.generateSchemaExample(schema.Items.Value)}
-		}
-		return []any{}
+		return g.generateArray(schema, depth)
 	case "string":
-		if len(schema.Enum) > 0 {
-			return schema.Enum[0]
-		}
-		return "string"
-	case "integer", "number":
-		return 0
+		return g.generateString(schema)
+	case "integer":
+		return g.generateInteger(schema)
+	case "number":
+		return g.generateNumber(schema)
 	case "boolean":
 		return false
 	default:
@@ -413,42 +849,257 @@ func (s *OpenAPIService) generateSchemaExample(schema *openapi3.Schema) any {
 	}
 }
 
-func (s *OpenAPIService) extractFormEntries(schemaRef *openapi3.SchemaRef) []KeyValue {
-	if schemaRef == nil || schemaRef.Value == nil {
-		return nil
+func (g *exampleGenerator) generateAllOf(schema *openapi3.Schema, depth int) any {
+	var result any
+	if len(schema.Properties) > 0 || g.schemaType(schema) != "" {
+		result = g.generateOwn(schema, depth)
 	}
+	for _, ref := range schema.AllOf {
+		if ref == nil {
+			continue
+		}
+		result = g.mergeValues(result, g.generate(ref.Value, depth+1))
+	}
+	return result
+}
 
-	var entries []KeyValue
-	schema := schemaRef.Value
+// mergeValues combines object examples key by key; for anything else the
+// second value wins unless it is nil.
+func (g *exampleGenerator) mergeValues(a, b any) any {
+	objA, okA := a.(map[string]any)
+	objB, okB := b.(map[string]any)
+	if okA && okB {
+		merged := make(map[string]any, len(objA)+len(objB))
+		for k, v := range objA {
+			merged[k] = v
+		}
+		for k, v := range objB {
+			merged[k] = v
+		}
+		return merged
+	}
+	if b == nil {
+		return a
+	}
+	return b
+}
 
-	for propName, propRef := range schema.Properties {
-		value := ""
-		if propRef.Value != nil {
-			if propRef.Value.Example != nil {
-				value = fmt.Sprintf("%v", propRef.Value.Example)
-			} else if propRef.Value.Default != nil {
-				value = fmt.Sprintf("%v", propRef.Value.Default)
+func (g *exampleGenerator) schemaType(schema *openapi3.Schema) string {
+	if schema.Type != nil {
+		for _, t := range schema.Type.Slice() {
+			if t != "null" {
+				return t
 			}
 		}
+	}
+	// No type given: infer it from the keywords present
+	switch {
+	case len(schema.Properties) > 0 || schema.AdditionalProperties.Schema != nil:
+		return "object"
+	case schema.Items != nil:
+		return "array"
+	case schema.Format != "" || schema.Pattern != "" || schema.MinLength > 0 || schema.MaxLength != nil:
+		return "string"
+	case schema.Min != nil || schema.Max != nil:
+		return "number"
+	}
+	return ""
+}
+
+func (g *exampleGenerator) emptyValue(schema *openapi3.Schema) any {
+	switch g.schemaType(schema) {
+	case "object":
+		return map[string]any{}
+	case "array":
+		return []any{}
+	default:
+		return nil
+	}
+}
+
+func (g *exampleGenerator) generateObject(schema *openapi3.Schema, depth int) map[string]any {
+	obj := make(map[string]any)
+	for propName, propRef := range schema.Properties {
+		if propRef == nil || propRef.Value == nil {
+			continue
+		}
+		if g.mode == exampleModeRequest && propRef.Value.ReadOnly {
+			continue
+		}
+		if g.mode == exampleModeResponse && propRef.Value.WriteOnly {
+			continue
+		}
+		obj[propName] = g.generate(propRef.Value, depth+1)
+	}
+
+	if len(obj) == 0 && schema.AdditionalProperties.Schema != nil && schema.AdditionalProperties.Schema.Value != nil {
+		obj["key"] = g.generate(schema.AdditionalProperties.Schema.Value, depth+1)
+	}
+
+	return obj
+}
+
+func (g *exampleGenerator) generateArray(schema *openapi3.Schema, depth int) []any {
+	if schema.Items == nil || schema.Items.Value == nil {
+		return []any{}
+	}
+	if schema.MaxItems != nil && *schema.MaxItems == 0 {
+		return []any{}
+	}
+
+	count := 1
+	if schema.MinItems > 1 {
+		count = int(min(schema.MinItems, 10))
+	}
+
+	items := make([]any, count)
+	for i := range items {
+		items[i] = g.generate(schema.Items.Value, depth+1)
+	}
+	return items
+}
+
+var formatExamples = map[string]string{
+	"date-time": "2024-01-01T12:00:00Z",
+	"date":      "2024-01-01",
+	"time":      "12:00:00",
+	"email":     "user@example.com",
+	"uri":       "https://example.com",
+	"url":       "https://example.com",
+	"hostname":  "example.com",
+	"ipv4":      "192.168.0.1",
+	"ipv6":      "2001:db8::1",
+	"uuid":      "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+	"byte":      "c3RyaW5n",
+	"binary":    "",
+	"password":  "password",
+}
 
-		required := false
-		for _, req := range schema.Required {
-			if req == propName {
-				required = true
-				break
+func (g *exampleGenerator) generateString(schema *openapi3.Schema) string {
+	value, ok := formatExamples[strings.ToLower(schema.Format)]
+	if ok {
+		return value
+	}
+
+	value = "string"
+	if schema.MaxLength != nil && uint64(len(value)) > *schema.MaxLength {
+		value = value[:*schema.MaxLength]
+	}
+	// Long minimums are padded only up to maxExampleStringLength, the way
+	// generateArray caps its items
+	if minLength := min(schema.MinLength, maxExampleStringLength); uint64(len(value)) < minLength {
+		value += strings.Repeat("x", int(minLength)-len(value))
+	}
+	return value
+}
+
+func (g *exampleGenerator) generateInteger(schema *openapi3.Schema) int64 {
+	if schema.Min != nil {
+		value := int64(math.Ceil(*schema.Min))
+		if schema.ExclusiveMin && float64(value) <= *schema.Min {
+			value++
+		}
+		return value
+	}
+	if schema.Max != nil && *schema.Max < 0 {
+		value := int64(math.Floor(*schema.Max))
+		if schema.ExclusiveMax && float64(value) >= *schema.Max {
+			value--
+		}
+		return value
+	}
+	return 0
+}
+
+func (g *exampleGenerator) generateNumber(schema *openapi3.Schema) float64 {
+	if schema.Min != nil {
+		if schema.ExclusiveMin {
+			if schema.Max != nil {
+				return (*schema.Min + *schema.Max) / 2
 			}
+			return *schema.Min + 1
 		}
+		return *schema.Min
+	}
+	if schema.Max != nil && *schema.Max < 0 {
+		if schema.ExclusiveMax {
+			return *schema.Max - 1
+		}
+		return *schema.Max
+	}
+	return 0
+}
 
+func (s *OpenAPIService) extractFormEntries(schemaRef *openapi3.SchemaRef) []KeyValue {
+	if schemaRef == nil || schemaRef.Value == nil {
+		return nil
+	}
+
+	example, _ := newExampleGenerator(exampleModeRequest).generate(schemaRef.Value, 0).(map[string]any)
+	required := make(map[string]bool)
+	s.collectRequired(schemaRef.Value, required, 0)
+
+	names := make([]string, 0, len(example))
+	for name := range example {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var entries []KeyValue
+	for _, name := range names {
 		entries = append(entries, KeyValue{
-			Key:     propName,
-			Value:   value,
-			Enabled: required,
+			Key:     name,
+			Value:   s.formatExampleValue(example[name]),
+			Enabled: required[name],
 		})
 	}
 
 	return entries
 }
 
+func (s *OpenAPIService) collectRequired(schema *openapi3.Schema, required map[string]bool, depth int) {
+	if schema == nil || depth > maxExampleDepth {
+		return
+	}
+	for _, name := range schema.Required {
+		required[name] = true
+	}
+	for _, ref := range schema.AllOf {
+		if ref != nil {
+			s.collectRequired(ref.Value, required, depth+1)
+		}
+	}
+}
+
+// formatExampleValue renders an example as a single string for query
+// parameters, headers and form fields. Structured values are JSON encoded.
+func (s *OpenAPIService) formatExampleValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]any, []any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func (s *OpenAPIService) getParameterExample(param *openapi3.Parameter) string {
+	if param.Example != nil {
+		return s.formatExampleValue(param.Example)
+	}
+	if value, ok := s.namedExample(param.Examples); ok {
+		return s.formatExampleValue(value)
+	}
+	return s.getExampleValue(param.Schema)
+}
+
 func (s *OpenAPIService) getExampleValue(schemaRef *openapi3.SchemaRef) string {
 	if schemaRef == nil || schemaRef.Value == nil {
 		return ""
@@ -456,14 +1107,75 @@ func (s *OpenAPIService) getExampleValue(schemaRef *openapi3.SchemaRef) string {
 
 	schema := schemaRef.Value
 	if schema.Example != nil {
-		return fmt.Sprintf("%v", schema.Example)
+		return s.formatExampleValue(schema.Example)
 	}
 	if schema.Default != nil {
-		return fmt.Sprintf("%v", schema.Default)
+		return s.formatExampleValue(schema.Default)
+	}
+	if len(schema.Enum) > 0 {
+		return s.formatExampleValue(schema.Enum[0])
 	}
 	return ""
 }
 
+// buildDocs returns the operation description followed by a section listing
+// the documented responses with an example body for each JSON response.
+func (s *OpenAPIService) buildDocs(op *openapi3.Operation) string {
+	docs := s.getDescription(op)
+	if op.Responses == nil || op.Responses.Len() == 0 {
+		return docs
+	}
+
+	responses := op.Responses.Map()
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		// "default" sorts after numeric codes and ranges like 4XX
+		if codes[i] == "default" || codes[j] == "default" {
+			return codes[j] == "default" && codes[i] != "default"
+		}
+		return codes[i] < codes[j]
+	})
+
+	var b strings.Builder
+	for _, code := range codes {
+		ref := responses[code]
+		if ref == nil || ref.Value == nil {
+			continue
+		}
+
+		b.WriteString("\n### " + code)
+		if ref.Value.Description != nil && *ref.Value.Description != "" {
+			b.WriteString(" - " + *ref.Value.Description)
+		}
+		b.WriteString("\n")
+
+		contentType, mediaType := s.jsonMediaType(ref.Value.Content)
+		if mediaType == nil {
+			continue
+		}
+		example, ok := s.mediaTypeExample(mediaType, exampleModeResponse)
+		if !ok {
+			continue
+		}
+		data, err := json.MarshalIndent(example, "", "  ")
+		if err != nil {
+			continue
+		}
+		b.WriteString("\n`" + contentType + "`\n\n```json\n" + string(data) + "\n```\n")
+	}
+
+	if b.Len() == 0 {
+		return docs
+	}
+	if docs != "" {
+		docs += "\n\n"
+	}
+	return docs + "## Responses\n" + b.String()
+}
+
 func (s *OpenAPIService) generateID(prefix, slug string) string {
 	cleanSlug := s.slugify(slug)
 	if len(cleanSlug) > 20 {
@@ -473,6 +1185,10 @@ func (s *OpenAPIService) generateID(prefix, slug string) string {
 }
 
 func (s *OpenAPIService) slugify(str string) string {
+	return slugifyText(str)
+}
+
+func slugifyText(str string) string {
 	// Remove special characters and convert to lowercase
 	re := regexp.MustCompile(`[^a-zA-Z0-9]+`)
 	slug := re.ReplaceAllString(str, "-")
@@ -480,3 +1196,87 @@ func (s *OpenAPIService) slugify(str string) string {
 	slug = strings.ToLower(slug)
 	return slug
 }
+
+// PreserveEnvironments carries what users set in the environments of a
+// previously stored collection over to freshly converted collection data.
+// Variables keep their values, such as credentials for security schemes,
+// when the environment has the same ID or name and the variable the same
+// key. The active environment selection is kept the same way. If nothing
+// matches the new data is returned unchanged.
+func PreserveEnvironments(previous, next json.RawMessage) json.RawMessage {
+	var prev NikodeCollection
+	if err := json.Unmarshal(previous, &prev); err != nil || len(prev.Environments) == 0 {
+		return next
+	}
+
+	var collection map[string]json.RawMessage
+	if err := json.Unmarshal(next, &collection); err != nil {
+		return next
+	}
+	var envs []Environment
+	if err := json.Unmarshal(collection["environments"], &envs); err != nil {
+		return next
+	}
+
+	changed := false
+	activeID := ""
+	for i := range envs {
+		prevEnv := findEnvironment(prev.Environments, envs[i].ID, envs[i].Name)
+		if prevEnv == nil {
+			continue
+		}
+		if prevEnv.ID == prev.ActiveEnvironmentID && (activeID == "" || envs[i].ID == prevEnv.ID) {
+			activeID = envs[i].ID
+		}
+		for j := range envs[i].Variables {
+			for _, v := range prevEnv.Variables {
+				if v.Key == envs[i].Variables[j].Key {
+					changed = changed || v.Value != envs[i].Variables[j].Value
+					envs[i].Variables[j].Value = v.Value
+					break
+				}
+			}
+		}
+	}
+
+	if changed {
+		encoded, err := json.Marshal(envs)
+		if err != nil {
+			return next
+		}
+		collection["environments"] = encoded
+	}
+	if activeID != "" {
+		encoded, err := json.Marshal(activeID)
+		if err != nil {
+			return next
+		}
+		collection["activeEnvironmentId"] = encoded
+		changed = true
+	}
+	if !changed {
+		return next
+	}
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return next
+	}
+	return data
+}
+
+// findEnvironment returns the environment with the given ID or, failing
+// that, the given name.
+func findEnvironment(envs []Environment, id, name string) *Environment {
+	for i := range envs {
+		if envs[i].ID == id {
+			return &envs[i]
+		}
+	}
+	for i := range envs {
+		if envs[i].Name == name {
+			return &envs[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,547 @@
+package services
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func convertTestSpec(t *testing.T, spec string) NikodeCollection {
+	t.Helper()
+	svc := NewOpenAPIService()
+
+	parsed, err := svc.ParseOpenAPI([]byte(spec))
+	require.NoError(t, err)
+
+	data, err := svc.ConvertToNikode(parsed)
+	require.NoError(t, err)
+
+	var collection NikodeCollection
+	require.NoError(t, json.Unmarshal(data, &collection))
+	return collection
+}
+
+func TestOpenAPIService_ConvertToNikode_NoServers(t *testing.T) {
+	collection := convertTestSpec(t, `{
+		"openapi": "3.0.3",
+		"info": {"title": "Pets", "version": "1.0.0"},
+		"paths": {}
+	}`)
+
+	require.Len(t, collection.Environments, 1)
+	assert.Equal(t, "env-default", collection.Environments[0].ID)
+	assert.Equal(t, "Default", collection.Environments[0].Name)
+	assert.Equal(t, "http://localhost:3000", collection.Environments[0].Variables[0].Value)
+	assert.Equal(t, "env-default", collection.ActiveEnvironmentID)
+}
+
+func TestOpenAPIService_ConvertToNikode_SingleServerKeepsDefault(t *testing.T) {
+	collection := convertTestSpec(t, `{
+		"openapi": "3.0.3",
+		"info": {"title": "Pets", "version": "1.0.0"},
+		"servers": [{"url": "https://api.example.com"}],
+		"paths": {}
+	}`)
+
+	require.Len(t, collection.Environments, 1)
+	assert.Equal(t, "env-default", collection.Environments[0].ID)
+	assert.Equal(t, "https://api.example.com", collection.Environments[0].Variables[0].Value)
+}
+
+func TestOpenAPIService_ConvertToNikode_MultipleServers(t *testing.T) {
+	collection := convertTestSpec(t, `
+openapi: 3.0.3
+info:
+  title: Pets
+  version: 1.0.0
+servers:
+  - url: http://localhost:8080
+    description: Development
+  - url: https://{region}.staging.example.com/{basePath}
+    description: Staging
+    variables:
+      region:
+        default: eu
+        enum: [eu, us]
+      basePath:
+        default: v1
+  - url: https://api.example.com
+    description: Production
+paths: {}
+`)
+
+	require.Len(t, collection.Environments, 3)
+
+	dev := collection.Environments[0]
+	assert.Equal(t, "env-development", dev.ID)
+	assert.Equal(t, "Development", dev.Name)
+	assert.Equal(t, "env-development", collection.ActiveEnvironmentID)
+
+	staging := collection.Environments[1]
+	assert.Equal(t, "env-staging", staging.ID)
+	require.Len(t, staging.Variables, 3)
+	assert.Equal(t, "baseUrl", staging.Variables[0].Key)
+	assert.Equal(t, "https://{{region}}.staging.example.com/{{basePath}}", staging.Variables[0].Value)
+	assert.Equal(t, "basePath", staging.Variables[1].Key)
+	assert.Equal(t, "v1", staging.Variables[1].Value)
+	assert.Empty(t, staging.Variables[1].Enum)
+	assert.Equal(t, "region", staging.Variables[2].Key)
+	assert.Equal(t, "eu", staging.Variables[2].Value)
+	assert.Equal(t, []string{"eu", "us"}, staging.Variables[2].Enum)
+
+	assert.Equal(t, "Production", collection.Environments[2].Name)
+}
+
+func TestOpenAPIService_ConvertToNikode_DuplicateServerNames(t *testing.T) {
+	collection := convertTestSpec(t, `{
+		"openapi": "3.0.3",
+		"info": {"title": "Pets", "version": "1.0.0"},
+		"servers": [
+			{"url": "https://a.example.com", "description": "Cluster"},
+			{"url": "https://b.example.com", "description": "Cluster"},
+			{"url": "https://c.example.com"}
+		],
+		"paths": {}
+	}`)
+
+	require.Len(t, collection.Environments, 3)
+	assert.Equal(t, "env-cluster", collection.Environments[0].ID)
+	assert.Equal(t, "env-cluster-2", collection.Environments[1].ID)
+	assert.Equal(t, "c.example.com", collection.Environments[2].Name)
+}
+
+func TestPreserveEnvironments(t *testing.T) {
+	next := json.RawMessage(`{"name":"Pets","environments":[{"id":"env-development","name":"Development","variables":[]},{"id":"env-production","name":"Production","variables":[]}],"activeEnvironmentId":"env-development","items":[]}`)
+
+	t.Run("keeps matching id", func(t *testing.T) {
+		previous := json.RawMessage(`{"environments":[{"id":"env-production","name":"Production"}],"activeEnvironmentId":"env-production"}`)
+		var result NikodeCollection
+		require.NoError(t, json.Unmarshal(PreserveEnvironments(previous, next), &result))
+		assert.Equal(t, "env-production", result.ActiveEnvironmentID)
+		assert.Equal(t, "Pets", result.Name)
+	})
+
+	t.Run("falls back to matching name", func(t *testing.T) {
+		previous := json.RawMessage(`{"environments":[{"id":"env-prod-old","name":"Production"}],"activeEnvironmentId":"env-prod-old"}`)
+		var result NikodeCollection
+		require.NoError(t, json.Unmarshal(PreserveEnvironments(previous, next), &result))
+		assert.Equal(t, "env-production", result.ActiveEnvironmentID)
+	})
+
+	t.Run("unknown selection leaves data unchanged", func(t *testing.T) {
+		previous := json.RawMessage(`{"environments":[{"id":"env-qa","name":"QA"}],"activeEnvironmentId":"env-qa"}`)
+		assert.Equal(t, next, PreserveEnvironments(previous, next))
+	})
+
+	t.Run("invalid previous data leaves data unchanged", func(t *testing.T) {
+		assert.Equal(t, next, PreserveEnvironments(json.RawMessage(`{}`), next))
+	})
+
+	t.Run("keeps variable values", func(t *testing.T) {
+		next := json.RawMessage(`{"name":"Pets","environments":[` +
+			`{"id":"env-production","name":"Production","variables":[{"key":"baseUrl","value":"https://api.example.com","enabled":true},{"key":"token","value":"","enabled":true,"secret":true},{"key":"apiKey","value":"","enabled":true,"secret":true}]},` +
+			`{"id":"env-staging","name":"Staging","variables":[{"key":"token","value":"","enabled":true,"secret":true}]}],` +
+			`"activeEnvironmentId":"env-production","items":[]}`)
+		previous := json.RawMessage(`{"environments":[` +
+			`{"id":"env-prod-old","name":"Production","variables":[{"key":"token","value":"prod-token","enabled":true},{"key":"removed","value":"gone","enabled":true}]},` +
+			`{"id":"env-qa","name":"QA","variables":[{"key":"token","value":"qa-token","enabled":true}]}]}`)
+
+		var result NikodeCollection
+		require.NoError(t, json.Unmarshal(PreserveEnvironments(previous, next), &result))
+		require.Len(t, result.Environments, 2)
+
+		production := result.Environments[0]
+		assert.Equal(t, "prod-token", findEnvVariable(production, "token").Value)
+		assert.True(t, findEnvVariable(production, "token").Secret)
+		assert.Equal(t, "https://api.example.com", findEnvVariable(production, "baseUrl").Value)
+		assert.Empty(t, findEnvVariable(production, "apiKey").Value)
+		assert.Nil(t, findEnvVariable(production, "removed"))
+
+		assert.Empty(t, findEnvVariable(result.Environments[1], "token").Value, "environments are matched by name")
+		assert.Equal(t, "env-production", result.ActiveEnvironmentID)
+	})
+}
+
+func findEnvVariable(env Environment, key string) *Variable {
+	for i := range env.Variables {
+		if env.Variables[i].Key == key {
+			return &env.Variables[i]
+		}
+	}
+	return nil
+}
+
+func TestOpenAPIService_ConvertToNikode_SecuritySchemes(t *testing.T) {
+	collection := convertTestSpec(t, `
+openapi: 3.0.3
+info:
+  title: Pets
+  version: 1.0.0
+servers:
+  - url: https://dev.example.com
+    description: Development
+  - url: https://api.example.com
+    description: Production
+security:
+  - bearerAuth: []
+components:
+  securitySchemes:
+    bearerAuth:
+      type: http
+      scheme: bearer
+    partnerKey:
+      type: apiKey
+      in: query
+      name: api_key
+    oauth:
+      type: oauth2
+      flows:
+        clientCredentials:
+          tokenUrl: https://auth.example.com/token
+          scopes:
+            pets:read: Read pets
+            pets:write: Write pets
+paths:
+  /pets:
+    get:
+      tags: [Pets]
+      summary: List pets
+    post:
+      tags: [Pets]
+      summary: Create pet
+      security:
+        - oauth: [pets:write]
+  /partners:
+    get:
+      tags: [Partners]
+      summary: List partners
+      security:
+        - partnerKey: []
+    delete:
+      tags: [Partners]
+      summary: Delete partners
+      security:
+        - partnerKey: []
+  /health:
+    get:
+      summary: Health
+      security: []
+`)
+
+	require.NotNil(t, collection.Auth)
+	assert.Equal(t, "bearer", collection.Auth.Type)
+	assert.Equal(t, "{{token}}", collection.Auth.Token)
+
+	var pets, partners *CollectionItem
+	var health *CollectionItem
+	for i := range collection.Items {
+		switch collection.Items[i].Name {
+		case "Pets":
+			pets = &collection.Items[i]
+		case "Partners":
+			partners = &collection.Items[i]
+		case "Health":
+			health = &collection.Items[i]
+		}
+	}
+	require.NotNil(t, pets)
+	require.NotNil(t, partners)
+	require.NotNil(t, health)
+
+	// Mixed folder: inherits collection auth, the override sits on the request
+	assert.Nil(t, pets.Auth)
+	for _, item := range pets.Items {
+		if item.Name == "Create pet" {
+			require.NotNil(t, item.Auth)
+			assert.Equal(t, "oauth2", item.Auth.Type)
+			assert.Equal(t, "client_credentials", item.Auth.OAuth2.GrantType)
+			assert.Equal(t, "https://auth.example.com/token", item.Auth.OAuth2.TokenURL)
+			assert.Equal(t, "pets:write", item.Auth.OAuth2.Scope)
+			assert.Equal(t, "{{clientId}}", item.Auth.OAuth2.ClientID)
+			assert.Equal(t, "{{clientSecret}}", item.Auth.OAuth2.ClientSecret)
+		} else {
+			assert.Nil(t, item.Auth)
+		}
+	}
+
+	// Uniform folder: auth hoisted onto the folder
+	require.NotNil(t, partners.Auth)
+	assert.Equal(t, "apikey", partners.Auth.Type)
+	assert.Equal(t, "api_key", partners.Auth.Key)
+	assert.Equal(t, "query", partners.Auth.In)
+	assert.Equal(t, "{{apiKey}}", partners.Auth.Value)
+	for _, item := range partners.Items {
+		assert.Nil(t, item.Auth)
+	}
+
+	// Explicitly unauthenticated operation
+	require.NotNil(t, health.Auth)
+	assert.Equal(t, "none", health.Auth.Type)
+
+	for _, env := range collection.Environments {
+		for _, key := range []string{"token", "apiKey", "clientId", "clientSecret", "accessToken"} {
+			v := findEnvVariable(env, key)
+			require.NotNil(t, v, "missing %s in %s", key, env.Name)
+			assert.Empty(t, v.Value)
+		}
+		assert.True(t, findEnvVariable(env, "token").Secret)
+		assert.False(t, findEnvVariable(env, "clientId").Secret)
+	}
+}
+
+func TestOpenAPIService_ConvertToNikode_SecurityVariableCollisions(t *testing.T) {
+	collection := convertTestSpec(t, `
+openapi: 3.0.3
+info:
+  title: Pets
+  version: 1.0.0
+components:
+  securitySchemes:
+    userToken:
+      type: http
+      scheme: bearer
+    adminToken:
+      type: http
+      scheme: bearer
+    login:
+      type: http
+      scheme: basic
+paths:
+  /me:
+    get:
+      summary: Me
+      security:
+        - userToken: []
+  /admin:
+    get:
+      summary: Admin
+      security:
+        - adminToken: []
+  /login:
+    post:
+      summary: Login
+      security:
+        - login: []
+`)
+
+	assert.Nil(t, collection.Auth)
+
+	tokens := map[string]string{}
+	for _, item := range collection.Items {
+		require.NotNil(t, item.Auth, item.Name)
+		switch item.Auth.Type {
+		case "bearer":
+			tokens[item.Name] = item.Auth.Token
+		case "basic":
+			assert.Equal(t, "{{username}}", item.Auth.Username)
+			assert.Equal(t, "{{password}}", item.Auth.Password)
+		}
+	}
+	require.Len(t, tokens, 2)
+	assert.NotEqual(t, tokens["Me"], tokens["Admin"])
+	assert.Contains(t, []string{"{{token}}", "{{token_usertoken}}", "{{token_admintoken}}"}, tokens["Me"])
+}
+
+func findRequest(items []CollectionItem, name string) *CollectionItem {
+	for i := range items {
+		if items[i].Name == name {
+			return &items[i]
+		}
+		if found := findRequest(items[i].Items, name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestOpenAPIService_ConvertToNikode_ExampleGeneration(t *testing.T) {
+	collection := convertTestSpec(t, `
+openapi: 3.0.3
+info:
+  title: Pets
+  version: 1.0.0
+components:
+  schemas:
+    Node:
+      type: object
+      properties:
+        name:
+          type: string
+        children:
+          type: array
+          items:
+            $ref: '#/components/schemas/Node'
+    Base:
+      type: object
+      properties:
+        id:
+          type: string
+          format: uuid
+          readOnly: true
+        createdAt:
+          type: string
+          format: date-time
+    Pet:
+      allOf:
+        - $ref: '#/components/schemas/Base'
+        - type: object
+          required: [name]
+          properties:
+            name:
+              type: string
+              minLength: 10
+            code:
+              type: string
+              maxLength: 3
+            nickname:
+              type: string
+              minLength: 9223372036854775807
+            age:
+              type: integer
+              minimum: 1
+              maximum: 30
+            weight:
+              type: number
+              minimum: 0.5
+            contact:
+              oneOf:
+                - type: string
+                  format: email
+                - type: string
+                  format: uri
+            tags:
+              type: array
+              minItems: 2
+              items:
+                type: string
+paths:
+  /nodes:
+    post:
+      summary: Create node
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Node'
+  /pets:
+    post:
+      summary: Create pet
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Pet'
+      responses:
+        "201":
+          description: Created
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Pet'
+        "400":
+          description: Invalid pet
+  /pets/search:
+    get:
+      summary: Search pets
+      parameters:
+        - name: species
+          in: query
+          schema:
+            type: string
+          examples:
+            cat:
+              value: cat
+            default:
+              value: dog
+    put:
+      summary: Replace pets
+      requestBody:
+        content:
+          application/vnd.api+json:
+            schema:
+              type: object
+            examples:
+              second:
+                value: {"name": "Second"}
+              first:
+                value: {"name": "First"}
+  /pets/upload:
+    post:
+      summary: Upload pet
+      requestBody:
+        content:
+          multipart/form-data:
+            schema:
+              allOf:
+                - type: object
+                  required: [file]
+                  properties:
+                    file:
+                      type: string
+                      format: binary
+                - type: object
+                  properties:
+                    count:
+                      type: integer
+                      minimum: 2
+`)
+
+	t.Run("recursive schema terminates", func(t *testing.T) {
+		item := findRequest(collection.Items, "Create node")
+		require.NotNil(t, item)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal([]byte(item.Body.Content), &body))
+		assert.Equal(t, "string", body["name"])
+		assert.Equal(t, []any{map[string]any{}}, body["children"], "cycle is cut at the first revisit")
+	})
+
+	t.Run("composition, formats and bounds", func(t *testing.T) {
+		item := findRequest(collection.Items, "Create pet")
+		require.NotNil(t, item)
+		var body map[string]any
+		require.NoError(t, json.Unmarshal([]byte(item.Body.Content), &body))
+
+		assert.NotContains(t, body, "id", "readOnly properties are skipped in requests")
+		assert.Equal(t, "2024-01-01T12:00:00Z", body["createdAt"])
+		assert.Len(t, body["name"], 10)
+		assert.Equal(t, "str", body["code"])
+		assert.Len(t, body["nickname"], 64, "huge minLength is capped")
+		assert.Equal(t, float64(1), body["age"])
+		assert.Equal(t, 0.5, body["weight"])
+		assert.Equal(t, "user@example.com", body["contact"])
+		assert.Equal(t, []any{"string", "string"}, body["tags"])
+	})
+
+	t.Run("response examples in docs", func(t *testing.T) {
+		item := findRequest(collection.Items, "Create pet")
+		require.NotNil(t, item)
+		assert.Contains(t, item.Docs, "## Responses")
+		assert.Contains(t, item.Docs, "### 201 - Created")
+		assert.Contains(t, item.Docs, `"id": "3fa85f64-5717-4562-b3fc-2c963f66afa6"`)
+		assert.Contains(t, item.Docs, "### 400 - Invalid pet")
+		assert.Less(t, strings.Index(item.Docs, "### 201"), strings.Index(item.Docs, "### 400"))
+	})
+
+	t.Run("named examples preferred", func(t *testing.T) {
+		search := findRequest(collection.Items, "Search pets")
+		require.NotNil(t, search)
+		require.Len(t, search.Params, 1)
+		assert.Equal(t, "dog", search.Params[0].Value)
+
+		replace := findRequest(collection.Items, "Replace pets")
+		require.NotNil(t, replace)
+		assert.Equal(t, "json", replace.Body.Type)
+		assert.JSONEq(t, `{"name": "First"}`, replace.Body.Content)
+	})
+
+	t.Run("form entries from allOf", func(t *testing.T) {
+		item := findRequest(collection.Items, "Upload pet")
+		require.NotNil(t, item)
+		require.Len(t, item.Body.Entries, 2)
+		assert.Equal(t, KeyValue{Key: "count", Value: "2", Enabled: false}, item.Body.Entries[0])
+		assert.Equal(t, KeyValue{Key: "file", Value: "", Enabled: true}, item.Body.Entries[1])
+	})
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrPersonalAccessTokenNotFound = errors.New("personal access token not found")
+	ErrPersonalAccessTokenInvalid  = errors.New("invalid personal access token")
+
+	ErrInvalidPersonalAccessTokenScope = errors.New("invalid personal access token scope")
+)
+
+const (
+	personalAccessTokenPrefix    = "nikp_"
+	personalAccessTokenRandomLen = 32
+)
+
+// personalAccessTokenColumns is the column list scanned by
+// scanPersonalAccessToken.
+const personalAccessTokenColumns = `id, user_id, name, token_hash, token_prefix, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scanPersonalAccessToken(row apiKeyRow, t *models.PersonalAccessToken) error {
+	return row.Scan(
+		&t.ID, &t.UserID, &t.Name, &t.TokenHash, &t.TokenPrefix,
+		&t.Scopes, &t.ExpiresAt, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt,
+	)
+}
+
+// IsPersonalAccessToken reports whether a bearer token is a personal access
+// token rather than a JWT.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
+
+// NormalizePersonalAccessTokenScopes validates scopes and removes
+// duplicates. No scopes selects read only.
+func NormalizePersonalAccessTokenScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return []string{models.PersonalAccessTokenScopeRead}, nil
+	}
+
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(models.PersonalAccessTokenScopes, scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidPersonalAccessTokenScope, scope)
+		}
+		if !slices.Contains(normalized, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
+
+// PersonalAccessTokenHasScope reports whether token was granted scope.
+func PersonalAccessTokenHasScope(token *models.PersonalAccessToken, scope string) bool {
+	return slices.Contains(token.Scopes, scope)
+}
+
+type PersonalAccessTokenService struct {
+	db *database.DB
+}
+
+func NewPersonalAccessTokenService(db *database.DB) *PersonalAccessTokenService {
+	return &PersonalAccessTokenService{db: db}
+}
+
+// GeneratePersonalAccessToken generates a token with the format
+// nikp_<32_random_bytes_hex>. Like API keys only its SHA-256 hash is stored.
+func (s *PersonalAccessTokenService) GeneratePersonalAccessToken() (plainToken, tokenHash, tokenPrefix string) {
+	randomBytes := make([]byte, personalAccessTokenRandomLen)
+	_, _ = rand.Read(randomBytes)
+	randomPart := hex.EncodeToString(randomBytes)
+
+	plainToken = personalAccessTokenPrefix + randomPart
+	tokenPrefix = personalAccessTokenPrefix + randomPart[:8] + "..."
+	return plainToken, HashToken(plainToken), tokenPrefix
+}
+
+// Create issues a token for a user. The scopes are expected to be
+// normalized.
+func (s *PersonalAccessTokenService) Create(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error) {
+	plainToken, tokenHash, tokenPrefix := s.GeneratePersonalAccessToken()
+
+	var token models.PersonalAccessToken
+	err := scanPersonalAccessToken(s.db.Pool.QueryRow(ctx, `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING `+personalAccessTokenColumns,
+		userID, name, tokenHash, tokenPrefix, scopes, expiresAt,
+	), &token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &token, plainToken, nil
+}
+
+// Authenticate validates a token and returns it with the user it acts as
+func (s *PersonalAccessTokenService) Authenticate(ctx context.Context, plainToken string) (*models.PersonalAccessToken, *models.User, error) {
+	var token models.PersonalAccessToken
+	var user models.User
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT t.id, t.user_id, t.name, t.token_hash, t.token_prefix, t.scopes, t.expires_at, t.last_used_at, t.revoked_at, t.created_at,
+			u.email, u.name, u.global_role
+		FROM personal_access_tokens t
+		JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1
+	`, HashToken(plainToken)).Scan(
+		&token.ID, &token.UserID, &token.Name, &token.TokenHash, &token.TokenPrefix,
+		&token.Scopes, &token.ExpiresAt, &token.LastUsedAt, &token.RevokedAt, &token.CreatedAt,
+		&user.Email, &user.Name, &user.GlobalRole,
+	)
+	if err != nil {
+		return nil, nil, ErrPersonalAccessTokenInvalid
+	}
+	user.ID = token.UserID
+
+	if token.RevokedAt != nil {
+		return nil, nil, ErrPersonalAccessTokenInvalid
+	}
+	if token.ExpiresAt != nil && token.ExpiresAt.Before(time.Now()) {
+		return nil, nil, ErrPersonalAccessTokenInvalid
+	}
+
+	// Update last_used_at asynchronously
+	go func() {
+		_, _ = s.db.Pool.Exec(context.Background(), `
+			UPDATE personal_access_tokens SET last_used_at = NOW() WHERE id = $1
+		`, token.ID)
+	}()
+
+	return &token, &user, nil
+}
+
+// List returns a user's tokens, excluding revoked ones
+func (s *PersonalAccessTokenService) List(ctx context.Context, userID uuid.UUID) ([]models.PersonalAccessToken, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+personalAccessTokenColumns+`
+		FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []models.PersonalAccessToken
+	for rows.Next() {
+		var t models.PersonalAccessToken
+		if err := scanPersonalAccessToken(rows, &t); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// Revoke revokes one of a user's tokens
+func (s *PersonalAccessTokenService) Revoke(ctx context.Context, userID, tokenID uuid.UUID) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE personal_access_tokens
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrPersonalAccessTokenNotFound
+	}
+	return nil
+}
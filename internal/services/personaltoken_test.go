@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/dimitrije/nikode-api/internal/models"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var personalAccessTokenTestColumns = []string{
+	"id", "user_id", "name", "token_hash", "token_prefix", "scopes", "expires_at", "last_used_at", "revoked_at", "created_at",
+}
+
+var personalAccessTokenAuthColumns = append(slices.Clone(personalAccessTokenTestColumns), "email", "name", "global_role")
+
+func setupPersonalAccessTokenService(t *testing.T) (*PersonalAccessTokenService, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	t.Cleanup(func() { mock.Close() })
+
+	db := &database.DB{Pool: mock}
+	return NewPersonalAccessTokenService(db), mock
+}
+
+func TestNormalizePersonalAccessTokenScopes(t *testing.T) {
+	scopes, err := NormalizePersonalAccessTokenScopes(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.PersonalAccessTokenScopeRead}, scopes)
+
+	scopes, err = NormalizePersonalAccessTokenScopes([]string{"write", " read ", "write"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"write", "read"}, scopes)
+
+	_, err = NormalizePersonalAccessTokenScopes([]string{"admin"})
+	assert.ErrorIs(t, err, ErrInvalidPersonalAccessTokenScope)
+}
+
+func TestPersonalAccessTokenService_GeneratePersonalAccessToken(t *testing.T) {
+	svc, _ := setupPersonalAccessTokenService(t)
+
+	plain, hash, prefix := svc.GeneratePersonalAccessToken()
+
+	assert.True(t, IsPersonalAccessToken(plain))
+	assert.Equal(t, HashToken(plain), hash)
+	assert.True(t, strings.HasPrefix(plain, strings.TrimSuffix(prefix, "...")))
+	assert.LessOrEqual(t, len(prefix), 20)
+}
+
+func TestPersonalAccessTokenService_Create(t *testing.T) {
+	svc, mock := setupPersonalAccessTokenService(t)
+	userID := uuid.New()
+	scopes := []string{models.PersonalAccessTokenScopeRead}
+
+	mock.ExpectQuery(`INSERT INTO personal_access_tokens`).
+		WithArgs(userID, "sync script", pgxmock.AnyArg(), pgxmock.AnyArg(), scopes, (*time.Time)(nil)).
+		WillReturnRows(pgxmock.NewRows(personalAccessTokenTestColumns).AddRow(
+			uuid.New(), userID, "sync script", "hash", "nikp_abcd1234...", scopes, nil, nil, nil, time.Now(),
+		))
+
+	token, plain, err := svc.Create(context.Background(), userID, "sync script", scopes, nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, "sync script", token.Name)
+	assert.True(t, IsPersonalAccessToken(plain))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPersonalAccessTokenService_Authenticate(t *testing.T) {
+	svc, mock := setupPersonalAccessTokenService(t)
+	userID := uuid.New()
+	plain := "nikp_0123456789"
+
+	mock.ExpectQuery(`SELECT .* FROM personal_access_tokens t\s+JOIN users u`).
+		WithArgs(HashToken(plain)).
+		WillReturnRows(pgxmock.NewRows(personalAccessTokenAuthColumns).AddRow(
+			uuid.New(), userID, "sync script", HashToken(plain), "nikp_01234567...", []string{"read"}, nil, nil, nil, time.Now(),
+			"test@example.com", "Test User", models.GlobalRoleUser,
+		))
+
+	token, user, err := svc.Authenticate(context.Background(), plain)
+
+	require.NoError(t, err)
+	assert.Equal(t, userID, token.UserID)
+	assert.Equal(t, userID, user.ID)
+	assert.Equal(t, "test@example.com", user.Email)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPersonalAccessTokenService_Authenticate_Expired(t *testing.T) {
+	svc, mock := setupPersonalAccessTokenService(t)
+	expiresAt := time.Now().Add(-time.Hour)
+
+	mock.ExpectQuery(`SELECT .* FROM personal_access_tokens t\s+JOIN users u`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(personalAccessTokenAuthColumns).AddRow(
+			uuid.New(), uuid.New(), "old", "hash", "nikp_01234567...", []string{"read"}, &expiresAt, nil, nil, time.Now(),
+			"test@example.com", "Test User", models.GlobalRoleUser,
+		))
+
+	_, _, err := svc.Authenticate(context.Background(), "nikp_0123456789")
+
+	assert.ErrorIs(t, err, ErrPersonalAccessTokenInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPersonalAccessTokenService_Authenticate_Revoked(t *testing.T) {
+	svc, mock := setupPersonalAccessTokenService(t)
+	revokedAt := time.Now().Add(-time.Hour)
+
+	mock.ExpectQuery(`SELECT .* FROM personal_access_tokens t\s+JOIN users u`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows(personalAccessTokenAuthColumns).AddRow(
+			uuid.New(), uuid.New(), "old", "hash", "nikp_01234567...", []string{"read"}, nil, nil, &revokedAt, time.Now(),
+			"test@example.com", "Test User", models.GlobalRoleUser,
+		))
+
+	_, _, err := svc.Authenticate(context.Background(), "nikp_0123456789")
+
+	assert.ErrorIs(t, err, ErrPersonalAccessTokenInvalid)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPersonalAccessTokenService_Revoke_NotFound(t *testing.T) {
+	svc, mock := setupPersonalAccessTokenService(t)
+	userID := uuid.New()
+	tokenID := uuid.New()
+
+	mock.ExpectExec(`UPDATE personal_access_tokens\s+SET revoked_at = NOW\(\)`).
+		WithArgs(tokenID, userID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	err := svc.Revoke(context.Background(), userID, tokenID)
+
+	assert.ErrorIs(t, err, ErrPersonalAccessTokenNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
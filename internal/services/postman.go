@@ -0,0 +1,503 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// PostmanService converts Postman v2.0 and v2.1 collections and Postman
+// environment files into the Nikode format.
+type PostmanService struct {
+	openapi *OpenAPIService
+}
+
+func NewPostmanService() *PostmanService {
+	return &PostmanService{openapi: NewOpenAPIService()}
+}
+
+// postmanCollection is a parsed Postman collection. Postman fields are
+// polymorphic between schema versions (strings or objects, arrays or maps),
+// so the document is kept as generic JSON values.
+type postmanCollection struct {
+	raw map[string]any
+}
+
+// postmanPathVariable matches Postman path variables such as /:id.
+var postmanPathVariable = regexp.MustCompile(`/:([A-Za-z_][A-Za-z0-9_-]*)`)
+
+// ParseCollection parses a Postman v2.0 or v2.1 collection
+func (s *PostmanService) ParseCollection(content []byte) (any, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse Postman collection: %w", err)
+	}
+
+	info := asMap(raw["info"])
+	if info == nil {
+		return nil, fmt.Errorf("missing info object")
+	}
+	if schema := stringOr(info["schema"], ""); schema != "" &&
+		!strings.Contains(schema, "v2.0.0") && !strings.Contains(schema, "v2.1.0") {
+		return nil, fmt.Errorf("unsupported Postman collection schema %q, expected v2.0 or v2.1", schema)
+	}
+	if _, ok := raw["item"].([]any); !ok {
+		return nil, fmt.Errorf("missing item array")
+	}
+
+	return &postmanCollection{raw: raw}, nil
+}
+
+// ParseEnvironment parses a Postman environment (or globals) export
+func (s *PostmanService) ParseEnvironment(content []byte) (*Environment, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse Postman environment: %w", err)
+	}
+
+	values, ok := raw["values"].([]any)
+	if !ok {
+		return nil, fmt.Errorf("missing values array")
+	}
+
+	name := stringOr(raw["name"], "Imported")
+	env := &Environment{
+		ID:        "env-" + s.openapi.slugify(name),
+		Name:      name,
+		Variables: []Variable{},
+	}
+	if env.ID == "env-" {
+		env.ID = "env-imported"
+	}
+
+	for _, v := range values {
+		value := asMap(v)
+		key := stringOr(value["key"], "")
+		if key == "" {
+			continue
+		}
+		enabled, ok := value["enabled"].(bool)
+		if !ok {
+			enabled = true
+		}
+		env.Variables = append(env.Variables, Variable{
+			Key:     key,
+			Value:   s.openapi.formatExampleValue(value["value"]),
+			Enabled: enabled,
+			Secret:  value["type"] == "secret",
+		})
+	}
+
+	return env, nil
+}
+
+// ConvertToNikode converts a Postman collection to Nikode collection format
+func (s *PostmanService) ConvertToNikode(specInterface any) (json.RawMessage, error) {
+	spec, ok := specInterface.(*postmanCollection)
+	if !ok {
+		return nil, fmt.Errorf("invalid spec type, expected Postman collection")
+	}
+
+	info := asMap(spec.raw["info"])
+
+	// Collection variables become the default environment
+	env := Environment{ID: "env-default", Name: "Default", Variables: []Variable{}}
+	for _, v := range asSlice(spec.raw["variable"]) {
+		variable := asMap(v)
+		key := stringOr(variable["key"], stringOr(variable["id"], ""))
+		if key == "" {
+			continue
+		}
+		disabled, _ := variable["disabled"].(bool)
+		env.Variables = append(env.Variables, Variable{
+			Key:     key,
+			Value:   s.openapi.formatExampleValue(variable["value"]),
+			Enabled: !disabled,
+		})
+	}
+
+	collection := NikodeCollection{
+		Name:                stringOr(info["name"], "Imported Collection"),
+		Version:             stringOr(asMap(info["version"])["raw"], stringOr(info["version"], "1.0.0")),
+		Environments:        []Environment{env},
+		ActiveEnvironmentID: env.ID,
+		Auth:                s.convertAuth(spec.raw["auth"]),
+		Items:               s.convertItems(asSlice(spec.raw["item"])),
+	}
+
+	data, err := json.Marshal(collection)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (s *PostmanService) convertItems(items []any) []CollectionItem {
+	converted := []CollectionItem{}
+	for _, i := range items {
+		item := asMap(i)
+		if item == nil {
+			continue
+		}
+
+		name := stringOr(item["name"], "Untitled")
+		if children, ok := item["item"].([]any); ok {
+			converted = append(converted, CollectionItem{
+				ID:    s.openapi.generateID("folder", name),
+				Type:  "folder",
+				Name:  name,
+				Items: s.convertItems(children),
+				Auth:  s.convertAuth(item["auth"]),
+				Docs:  postmanDescription(item["description"]),
+			})
+			continue
+		}
+
+		converted = append(converted, s.convertRequest(name, item))
+	}
+	return converted
+}
+
+func (s *PostmanService) convertRequest(name string, item map[string]any) CollectionItem {
+	// v2.0 allows the request to be just a URL string
+	request := asMap(item["request"])
+	if request == nil {
+		request = map[string]any{"url": item["request"], "method": "GET"}
+	}
+
+	requestURL, params := s.convertURL(request["url"])
+	body := asMap(request["body"])
+
+	converted := CollectionItem{
+		ID:      s.openapi.generateID("req", name),
+		Type:    "request",
+		Name:    name,
+		Method:  strings.ToUpper(stringOr(request["method"], "GET")),
+		URL:     requestURL,
+		Params:  params,
+		Headers: s.convertHeaders(request["header"]),
+		Body:    s.convertBody(body),
+		Scripts: s.convertScripts(item["event"]),
+		Auth:    s.convertAuth(request["auth"]),
+		Docs:    s.buildDocs(postmanDescription(request["description"]), item["response"]),
+	}
+
+	if body["mode"] == "graphql" {
+		graphql := asMap(body["graphql"])
+		converted.Type = "graphql"
+		converted.Method = ""
+		converted.Body = nil
+		converted.GqlQuery = stringOr(graphql["query"], "")
+		converted.GqlVariables = stringOr(graphql["variables"], "")
+	}
+
+	return converted
+}
+
+// convertURL returns the request URL without its query string, with path
+// variables rewritten to Nikode variables, and the query parameters.
+func (s *PostmanService) convertURL(node any) (string, []KeyValue) {
+	var raw string
+	var params []KeyValue
+
+	switch u := node.(type) {
+	case string:
+		raw = u
+	case map[string]any:
+		raw = stringOr(u["raw"], "")
+		if raw == "" {
+			raw = postmanBuildURL(u)
+		}
+		for _, q := range asSlice(u["query"]) {
+			query := asMap(q)
+			if query == nil || query["key"] == nil {
+				continue
+			}
+			disabled, _ := query["disabled"].(bool)
+			params = append(params, KeyValue{
+				Key:     stringOr(query["key"], ""),
+				Value:   s.openapi.formatExampleValue(query["value"]),
+				Enabled: !disabled,
+			})
+		}
+	}
+
+	base, rawQuery, hasQuery := strings.Cut(raw, "?")
+	if hasQuery && params == nil {
+		for _, pair := range strings.Split(rawQuery, "&") {
+			if pair == "" {
+				continue
+			}
+			key, value, _ := strings.Cut(pair, "=")
+			params = append(params, KeyValue{Key: key, Value: value, Enabled: true})
+		}
+	}
+
+	return postmanPathVariable.ReplaceAllString(base, "/{{$1}}"), params
+}
+
+func postmanBuildURL(u map[string]any) string {
+	var b strings.Builder
+	if protocol := stringOr(u["protocol"], ""); protocol != "" {
+		b.WriteString(protocol + "://")
+	}
+	b.WriteString(joinPostmanParts(u["host"], "."))
+	if port := stringOr(u["port"], ""); port != "" {
+		b.WriteString(":" + port)
+	}
+	if path := joinPostmanParts(u["path"], "/"); path != "" {
+		b.WriteString("/" + path)
+	}
+	return b.String()
+}
+
+func joinPostmanParts(node any, sep string) string {
+	if s, ok := node.(string); ok {
+		return strings.Trim(s, sep)
+	}
+	var parts []string
+	for _, part := range asSlice(node) {
+		if s, ok := part.(string); ok {
+			parts = append(parts, s)
+		} else if segment := asMap(part); segment != nil {
+			parts = append(parts, stringOr(segment["value"], ""))
+		}
+	}
+	return strings.Join(parts, sep)
+}
+
+func (s *PostmanService) convertHeaders(node any) []KeyValue {
+	var headers []KeyValue
+
+	// v2.0 allows headers as a single "Key: Value\n" string
+	if raw, ok := node.(string); ok {
+		for _, line := range strings.Split(raw, "\n") {
+			key, value, found := strings.Cut(line, ":")
+			if found && strings.TrimSpace(key) != "" {
+				headers = append(headers, KeyValue{Key: strings.TrimSpace(key), Value: strings.TrimSpace(value), Enabled: true})
+			}
+		}
+		return headers
+	}
+
+	for _, h := range asSlice(node) {
+		header := asMap(h)
+		key := stringOr(header["key"], "")
+		if key == "" {
+			continue
+		}
+		disabled, _ := header["disabled"].(bool)
+		headers = append(headers, KeyValue{
+			Key:     key,
+			Value:   s.openapi.formatExampleValue(header["value"]),
+			Enabled: !disabled,
+		})
+	}
+	return headers
+}
+
+func (s *PostmanService) convertBody(body map[string]any) *RequestBody {
+	if body == nil {
+		return &RequestBody{Type: "none"}
+	}
+	if disabled, _ := body["disabled"].(bool); disabled {
+		return &RequestBody{Type: "none"}
+	}
+
+	switch body["mode"] {
+	case "raw":
+		content := stringOr(body["raw"], "")
+		language := stringOr(asMap(asMap(body["options"])["raw"])["language"], "")
+		if language == "json" || (language == "" && looksLikeJSON(content)) {
+			return &RequestBody{Type: "json", Content: content}
+		}
+		return &RequestBody{Type: "raw", Content: content}
+	case "urlencoded":
+		return &RequestBody{Type: "x-www-form-urlencoded", Entries: s.convertFormEntries(body["urlencoded"])}
+	case "formdata":
+		return &RequestBody{Type: "form-data", Entries: s.convertFormEntries(body["formdata"])}
+	case "file":
+		return &RequestBody{Type: "binary", Content: ""}
+	}
+	return &RequestBody{Type: "none"}
+}
+
+func (s *PostmanService) convertFormEntries(node any) []KeyValue {
+	var entries []KeyValue
+	for _, e := range asSlice(node) {
+		entry := asMap(e)
+		key := stringOr(entry["key"], "")
+		if key == "" {
+			continue
+		}
+		disabled, _ := entry["disabled"].(bool)
+		value := entry["value"]
+		if entry["type"] == "file" {
+			// File contents are not part of the export
+			value = nil
+		}
+		entries = append(entries, KeyValue{
+			Key:     key,
+			Value:   s.openapi.formatExampleValue(value),
+			Enabled: !disabled,
+		})
+	}
+	return entries
+}
+
+func (s *PostmanService) convertScripts(node any) *Scripts {
+	scripts := &Scripts{Pre: "", Post: ""}
+	for _, e := range asSlice(node) {
+		event := asMap(e)
+		if disabled, _ := event["disabled"].(bool); disabled {
+			continue
+		}
+		script := asMap(event["script"])
+		var source string
+		if exec, ok := script["exec"].(string); ok {
+			source = exec
+		} else {
+			var lines []string
+			for _, line := range asSlice(script["exec"]) {
+				if l, ok := line.(string); ok {
+					lines = append(lines, l)
+				}
+			}
+			source = strings.Join(lines, "\n")
+		}
+
+		switch event["listen"] {
+		case "prerequest":
+			scripts.Pre = source
+		case "test":
+			scripts.Post = source
+		}
+	}
+	return scripts
+}
+
+// convertAuth maps Postman auth settings. A missing auth object inherits
+// from the parent like in Postman; auth types Nikode does not support are
+// dropped so the item inherits as well.
+func (s *PostmanService) convertAuth(node any) *Auth {
+	auth := asMap(node)
+	if auth == nil {
+		return nil
+	}
+
+	authType := stringOr(auth["type"], "")
+	params := postmanAuthParams(auth[authType])
+	switch authType {
+	case "noauth":
+		return &Auth{Type: "none"}
+	case "bearer":
+		return &Auth{Type: "bearer", Token: params["token"]}
+	case "basic":
+		return &Auth{Type: "basic", Username: params["username"], Password: params["password"]}
+	case "apikey":
+		in := params["in"]
+		if in == "" {
+			in = "header"
+		}
+		return &Auth{Type: "apikey", Key: params["key"], Value: params["value"], In: in}
+	case "oauth2":
+		grantType := params["grant_type"]
+		switch grantType {
+		case "password_credentials":
+			grantType = "password"
+		case "authorization_code_with_pkce", "":
+			grantType = "authorization_code"
+		}
+		return &Auth{
+			Type: "oauth2",
+			OAuth2: &OAuth2Auth{
+				GrantType:    grantType,
+				AuthURL:      params["authUrl"],
+				TokenURL:     params["accessTokenUrl"],
+				ClientID:     params["clientId"],
+				ClientSecret: params["clientSecret"],
+				Scope:        params["scope"],
+				AccessToken:  params["accessToken"],
+			},
+		}
+	}
+	return nil
+}
+
+// postmanAuthParams reads auth parameters stored as a key/value list (v2.1)
+// or as an object (v2.0).
+func postmanAuthParams(node any) map[string]string {
+	params := make(map[string]string)
+	switch v := node.(type) {
+	case []any:
+		for _, p := range v {
+			param := asMap(p)
+			if key := stringOr(param["key"], ""); key != "" {
+				params[key] = formatPostmanValue(param["value"])
+			}
+		}
+	case map[string]any:
+		for key, value := range v {
+			params[key] = formatPostmanValue(value)
+		}
+	}
+	return params
+}
+
+func formatPostmanValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func postmanDescription(node any) string {
+	if description, ok := node.(string); ok {
+		return description
+	}
+	return stringOr(asMap(node)["content"], "")
+}
+
+// buildDocs appends the saved example responses to the request description.
+func (s *PostmanService) buildDocs(description string, responses any) string {
+	var b strings.Builder
+	for _, r := range asSlice(responses) {
+		response := asMap(r)
+		if response == nil {
+			continue
+		}
+
+		b.WriteString("\n### ")
+		if code, ok := response["code"].(float64); ok {
+			b.WriteString(fmt.Sprintf("%d - ", int(code)))
+		}
+		b.WriteString(stringOr(response["name"], stringOr(response["status"], "Response")) + "\n")
+
+		if body := stringOr(response["body"], ""); body != "" {
+			language := stringOr(response["_postman_previewlanguage"], "")
+			if language == "" && looksLikeJSON(body) {
+				language = "json"
+			}
+			b.WriteString("\n```" + language + "\n" + body + "\n```\n")
+		}
+	}
+
+	if b.Len() == 0 {
+		return description
+	}
+	if description != "" {
+		description += "\n\n"
+	}
+	return description + "## Responses\n" + b.String()
+}
+
+func looksLikeJSON(content string) bool {
+	trimmed := strings.TrimSpace(content)
+	return (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Valid([]byte(trimmed))
+}
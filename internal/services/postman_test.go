@@ -0,0 +1,219 @@
+package services
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPostmanCollection = `{
+	"info": {
+		"_postman_id": "0b0c",
+		"name": "Pet Store",
+		"version": {"raw": "2.3.0"},
+		"schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+	},
+	"auth": {"type": "bearer", "bearer": [{"key": "token", "value": "{{token}}", "type": "string"}]},
+	"variable": [
+		{"key": "baseUrl", "value": "https://api.example.com"},
+		{"key": "legacy", "value": "1", "disabled": true}
+	],
+	"item": [
+		{
+			"name": "Pets",
+			"description": "Pet operations",
+			"item": [
+				{
+					"name": "Get pet",
+					"event": [
+						{"listen": "prerequest", "script": {"exec": ["console.log('a')", "console.log('b')"]}},
+						{"listen": "test", "script": {"exec": "pm.test('ok')"}}
+					],
+					"request": {
+						"method": "get",
+						"header": [{"key": "Accept", "value": "application/json"}, {"key": "X-Debug", "value": "1", "disabled": true}],
+						"url": {
+							"raw": "{{baseUrl}}/pets/:petId?expand=owner",
+							"host": ["{{baseUrl}}"],
+							"path": ["pets", ":petId"],
+							"query": [{"key": "expand", "value": "owner"}, {"key": "fields", "value": "id", "disabled": true}]
+						},
+						"description": "Fetch a pet"
+					},
+					"response": [
+						{"name": "Found", "code": 200, "body": "{\"id\": 1}", "_postman_previewlanguage": "json"}
+					]
+				},
+				{
+					"name": "Create pet",
+					"request": {
+						"method": "POST",
+						"auth": {"type": "noauth"},
+						"body": {"mode": "raw", "raw": "{\"name\": \"{{name}}\"}", "options": {"raw": {"language": "json"}}},
+						"url": "{{baseUrl}}/pets"
+					}
+				}
+			]
+		},
+		{
+			"name": "Upload",
+			"request": {
+				"method": "POST",
+				"auth": {"type": "apikey", "apikey": [{"key": "key", "value": "X-Key"}, {"key": "value", "value": "secret"}, {"key": "in", "value": "query"}]},
+				"body": {"mode": "formdata", "formdata": [{"key": "file", "type": "file", "src": "/tmp/a.png"}, {"key": "title", "value": "Cat"}]},
+				"url": {"raw": "https://files.example.com/upload"}
+			}
+		},
+		{
+			"name": "Search",
+			"request": {
+				"method": "POST",
+				"body": {"mode": "graphql", "graphql": {"query": "{ pets { id } }", "variables": "{\"first\": 1}"}},
+				"url": "{{baseUrl}}/graphql"
+			}
+		}
+	]
+}`
+
+func convertPostmanTestCollection(t *testing.T, content string) NikodeCollection {
+	t.Helper()
+	svc := NewPostmanService()
+
+	spec, err := svc.ParseCollection([]byte(content))
+	require.NoError(t, err)
+
+	data, err := svc.ConvertToNikode(spec)
+	require.NoError(t, err)
+
+	var collection NikodeCollection
+	require.NoError(t, json.Unmarshal(data, &collection))
+	return collection
+}
+
+func TestPostmanService_ConvertToNikode(t *testing.T) {
+	collection := convertPostmanTestCollection(t, testPostmanCollection)
+
+	assert.Equal(t, "Pet Store", collection.Name)
+	assert.Equal(t, "2.3.0", collection.Version)
+	require.NotNil(t, collection.Auth)
+	assert.Equal(t, "bearer", collection.Auth.Type)
+	assert.Equal(t, "{{token}}", collection.Auth.Token)
+
+	require.Len(t, collection.Environments, 1)
+	assert.Equal(t, []Variable{
+		{Key: "baseUrl", Value: "https://api.example.com", Enabled: true},
+		{Key: "legacy", Value: "1", Enabled: false},
+	}, collection.Environments[0].Variables)
+
+	require.Len(t, collection.Items, 3)
+	pets := collection.Items[0]
+	assert.Equal(t, "folder", pets.Type)
+	assert.Equal(t, "Pet operations", pets.Docs)
+	require.Len(t, pets.Items, 2)
+
+	getPet := pets.Items[0]
+	assert.Equal(t, "GET", getPet.Method)
+	assert.Equal(t, "{{baseUrl}}/pets/{{petId}}", getPet.URL)
+	assert.Equal(t, []KeyValue{
+		{Key: "expand", Value: "owner", Enabled: true},
+		{Key: "fields", Value: "id", Enabled: false},
+	}, getPet.Params)
+	assert.Equal(t, []KeyValue{
+		{Key: "Accept", Value: "application/json", Enabled: true},
+		{Key: "X-Debug", Value: "1", Enabled: false},
+	}, getPet.Headers)
+	assert.Equal(t, "console.log('a')\nconsole.log('b')", getPet.Scripts.Pre)
+	assert.Equal(t, "pm.test('ok')", getPet.Scripts.Post)
+	assert.Nil(t, getPet.Auth, "requests without auth inherit")
+	assert.Contains(t, getPet.Docs, "Fetch a pet\n\n## Responses\n")
+	assert.Contains(t, getPet.Docs, "### 200 - Found\n\n```json\n{\"id\": 1}\n```")
+
+	createPet := pets.Items[1]
+	assert.Equal(t, "{{baseUrl}}/pets", createPet.URL)
+	assert.Equal(t, &RequestBody{Type: "json", Content: `{"name": "{{name}}"}`}, createPet.Body)
+	assert.Equal(t, "none", createPet.Auth.Type)
+
+	upload := collection.Items[1]
+	assert.Equal(t, "form-data", upload.Body.Type)
+	assert.Equal(t, []KeyValue{
+		{Key: "file", Value: "", Enabled: true},
+		{Key: "title", Value: "Cat", Enabled: true},
+	}, upload.Body.Entries)
+	assert.Equal(t, &Auth{Type: "apikey", Key: "X-Key", Value: "secret", In: "query"}, upload.Auth)
+
+	search := collection.Items[2]
+	assert.Equal(t, "graphql", search.Type)
+	assert.Equal(t, "{ pets { id } }", search.GqlQuery)
+	assert.Equal(t, `{"first": 1}`, search.GqlVariables)
+	assert.Nil(t, search.Body)
+}
+
+func TestPostmanService_ConvertToNikode_V20(t *testing.T) {
+	collection := convertPostmanTestCollection(t, `{
+		"info": {"name": "Legacy", "schema": "https://schema.getpostman.com/json/collection/v2.0.0/collection.json"},
+		"item": [
+			{
+				"name": "Login",
+				"request": {
+					"method": "POST",
+					"header": "Content-Type: application/x-www-form-urlencoded\nX-Trace: on",
+					"auth": {"type": "basic", "basic": {"username": "admin", "password": "{{password}}"}},
+					"body": {"mode": "urlencoded", "urlencoded": [{"key": "remember", "value": "true"}]},
+					"url": "https://example.com/login"
+				}
+			},
+			{"name": "Home", "request": "https://example.com/"}
+		]
+	}`)
+
+	assert.Equal(t, "1.0.0", collection.Version)
+	require.Len(t, collection.Items, 2)
+
+	login := collection.Items[0]
+	assert.Equal(t, []KeyValue{
+		{Key: "Content-Type", Value: "application/x-www-form-urlencoded", Enabled: true},
+		{Key: "X-Trace", Value: "on", Enabled: true},
+	}, login.Headers)
+	assert.Equal(t, &Auth{Type: "basic", Username: "admin", Password: "{{password}}"}, login.Auth)
+	assert.Equal(t, "x-www-form-urlencoded", login.Body.Type)
+
+	home := collection.Items[1]
+	assert.Equal(t, "GET", home.Method)
+	assert.Equal(t, "https://example.com/", home.URL)
+}
+
+func TestPostmanService_ParseCollection_Errors(t *testing.T) {
+	svc := NewPostmanService()
+
+	_, err := svc.ParseCollection([]byte(`{"info": {"name": "x", "schema": "https://schema.getpostman.com/json/collection/v1.0.0/collection.json"}, "item": []}`))
+	assert.ErrorContains(t, err, "unsupported Postman collection schema")
+
+	_, err = svc.ParseCollection([]byte(`{"info": {"name": "x"}}`))
+	assert.ErrorContains(t, err, "missing item array")
+}
+
+func TestPostmanService_ParseEnvironment(t *testing.T) {
+	svc := NewPostmanService()
+
+	env, err := svc.ParseEnvironment([]byte(`{
+		"id": "5d2c",
+		"name": "Staging API",
+		"values": [
+			{"key": "baseUrl", "value": "https://staging.example.com", "enabled": true},
+			{"key": "apiKey", "value": "s3cret", "type": "secret", "enabled": true},
+			{"key": "unused", "value": "", "enabled": false}
+		],
+		"_postman_variable_scope": "environment"
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, "env-staging-api", env.ID)
+	assert.Equal(t, "Staging API", env.Name)
+	assert.Equal(t, []Variable{
+		{Key: "baseUrl", Value: "https://staging.example.com", Enabled: true},
+		{Key: "apiKey", Value: "s3cret", Enabled: true, Secret: true},
+		{Key: "unused", Value: "", Enabled: false},
+	}, env.Variables)
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TokenBucketLimiter rate limits by ID. Each ID gets a bucket holding up to
+// burst tokens that refills at perMinute tokens per minute; a request takes
+// one token. The limits are passed on every call so configuration changes
+// apply immediately.
+type TokenBucketLimiter struct {
+	mu        sync.Mutex
+	buckets   map[uuid.UUID]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens    float64
+	last      time.Time
+	perMinute int
+	burst     int
+}
+
+// bucketSweepInterval is how often buckets that have refilled completely
+// are dropped.
+const bucketSweepInterval = 10 * time.Minute
+
+func NewTokenBucketLimiter() *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		buckets: make(map[uuid.UUID]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from id's bucket. When the bucket is empty it returns
+// false and how long until a token is available.
+func (l *TokenBucketLimiter) Allow(id uuid.UUID, perMinute, burst int) (bool, time.Duration) {
+	if perMinute <= 0 || burst <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	bucket, ok := l.buckets[id]
+	if !ok || bucket.perMinute != perMinute || bucket.burst != burst {
+		bucket = &tokenBucket{tokens: float64(burst), last: now, perMinute: perMinute, burst: burst}
+		l.buckets[id] = bucket
+	}
+
+	rate := float64(perMinute) / 60 // tokens per second
+	bucket.tokens = math.Min(float64(burst), bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	return false, wait
+}
+
+// sweep drops buckets that have been idle long enough to be full again,
+// since a new bucket starts full anyway.
+func (l *TokenBucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for id, bucket := range l.buckets {
+		refill := time.Duration(float64(bucket.burst) / float64(bucket.perMinute) * float64(time.Minute))
+		if now.Sub(bucket.last) >= refill {
+			delete(l.buckets, id)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketLimiter_Allow(t *testing.T) {
+	limiter := NewTokenBucketLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	id := uuid.New()
+
+	// The bucket starts full
+	for i := 0; i < 3; i++ {
+		allowed, _ := limiter.Allow(id, 60, 3)
+		assert.True(t, allowed, "request %d", i)
+	}
+
+	allowed, retryAfter := limiter.Allow(id, 60, 3)
+	assert.False(t, allowed)
+	assert.Equal(t, time.Second, retryAfter)
+
+	// 60 per minute refills one token per second
+	now = now.Add(1500 * time.Millisecond)
+	allowed, _ = limiter.Allow(id, 60, 3)
+	assert.True(t, allowed)
+	allowed, retryAfter = limiter.Allow(id, 60, 3)
+	assert.False(t, allowed)
+	assert.Equal(t, 500*time.Millisecond, retryAfter)
+
+	// Other IDs have their own bucket
+	allowed, _ = limiter.Allow(uuid.New(), 60, 3)
+	assert.True(t, allowed)
+}
+
+func TestTokenBucketLimiter_ConfigChange(t *testing.T) {
+	limiter := NewTokenBucketLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	id := uuid.New()
+
+	allowed, _ := limiter.Allow(id, 60, 1)
+	assert.True(t, allowed)
+	allowed, _ = limiter.Allow(id, 60, 1)
+	assert.False(t, allowed)
+
+	// A new limit starts a fresh bucket
+	allowed, _ = limiter.Allow(id, 120, 5)
+	assert.True(t, allowed)
+
+	// Zero disables limiting
+	for i := 0; i < 10; i++ {
+		allowed, _ = limiter.Allow(id, 0, 0)
+		assert.True(t, allowed)
+	}
+}
+
+func TestTokenBucketLimiter_Sweep(t *testing.T) {
+	limiter := NewTokenBucketLimiter()
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+	idle := uuid.New()
+
+	limiter.Allow(idle, 60, 10)
+	now = now.Add(bucketSweepInterval)
+	limiter.Allow(uuid.New(), 60, 10)
+
+	assert.NotContains(t, limiter.buckets, idle)
+	assert.Len(t, limiter.buckets, 1)
+}
@@ -0,0 +1,324 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	SigningAlgorithmEdDSA = "EdDSA"
+	SigningAlgorithmRS256 = "RS256"
+)
+
+// signingKeyPropagation is how long a new key is only published before it
+// signs, so other instances and JWKS caches know it by then
+const signingKeyPropagation = 10 * time.Minute
+
+// signingKeyLock is the advisory lock held while rotating, so instances
+// sharing the database don't each add a key
+const signingKeyLock = 0x6e696b6f6465
+
+// SigningKey is a key pair tokens are signed with. ID is published as the
+// kid of the tokens and in the JWKS.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	PrivateKey crypto.Signer
+	CreatedAt  time.Time
+	// ExpiresAt is set once the key is replaced; it keeps verifying tokens
+	// until then
+	ExpiresAt *time.Time
+}
+
+// JWK is a public key in JSON Web Key format.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public half of the key.
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{KeyID: k.ID, Algorithm: k.Algorithm, Use: "sig"}
+	switch pub := k.PrivateKey.Public().(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	}
+	return jwk
+}
+
+// SigningKeyService keeps the token signing keys in the database so every
+// instance signs with the same key. The newest propagated key signs; replaced
+// keys are kept for verification until every token they signed has expired.
+// Private keys are stored encrypted with AES-GCM, so a database dump alone
+// can't forge tokens.
+type SigningKeyService struct {
+	db        *database.DB
+	algorithm string
+	interval  time.Duration
+	retention time.Duration
+	aead      cipher.AEAD
+}
+
+// NewSigningKeyService creates a service that replaces the signing key every
+// interval. Replaced keys are kept for retention, the lifetime of the
+// longest-lived token. Keys are encrypted with a key derived from
+// encryptionKey.
+func NewSigningKeyService(db *database.DB, algorithm string, interval, retention time.Duration, encryptionKey string) *SigningKeyService {
+	return &SigningKeyService{
+		db:        db,
+		algorithm: algorithm,
+		interval:  interval,
+		retention: retention,
+		aead:      newSigningKeyCipher(encryptionKey),
+	}
+}
+
+func newSigningKeyCipher(encryptionKey string) cipher.AEAD {
+	key, err := hkdf.Key(sha256.New, []byte(encryptionKey), nil, "nikode signing keys", 32)
+	if err != nil {
+		panic(err)
+	}
+	// Neither fails for a 32-byte key
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// seal encrypts a private key, bound to its key ID
+func (s *SigningKeyService) seal(id string, der []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, der, []byte(id)), nil
+}
+
+// open decrypts a private key sealed for the key ID
+func (s *SigningKeyService) open(id string, sealed []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed key too short")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, ciphertext, []byte(id))
+}
+
+// Rotate adds a new signing key if there is none, the current one is older
+// than the rotation interval or uses another algorithm. It reports whether a
+// key was added.
+func (s *SigningKeyService) Rotate(ctx context.Context) (bool, error) {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, signingKeyLock); err != nil {
+		return false, fmt.Errorf("failed to lock signing keys: %w", err)
+	}
+
+	var current int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM signing_keys
+		WHERE expires_at IS NULL AND algorithm = $1 AND created_at > $2
+	`, s.algorithm, time.Now().Add(-s.interval)).Scan(&current)
+	if err != nil {
+		return false, err
+	}
+	if current > 0 {
+		return false, nil
+	}
+
+	key, err := generateSigningKey(s.algorithm)
+	if err != nil {
+		return false, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	id := uuid.New().String()
+	sealed, err := s.seal(id, der)
+	if err != nil {
+		return false, fmt.Errorf("failed to encrypt signing key: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE signing_keys SET expires_at = $1 WHERE expires_at IS NULL
+	`, time.Now().Add(signingKeyPropagation+s.retention)); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO signing_keys (id, algorithm, private_key, encrypted) VALUES ($1, $2, $3, TRUE)
+	`, id, s.algorithm, sealed); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// List returns the keys that still verify tokens, newest first.
+func (s *SigningKeyService) List(ctx context.Context) ([]SigningKey, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, algorithm, private_key, encrypted, created_at, expires_at FROM signing_keys
+		WHERE expires_at IS NULL OR expires_at > NOW()
+		ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []SigningKey
+	for rows.Next() {
+		var key SigningKey
+		var der []byte
+		var encrypted bool
+		if err := rows.Scan(&key.ID, &key.Algorithm, &der, &encrypted, &key.CreatedAt, &key.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if encrypted {
+			if der, err = s.open(key.ID, der); err != nil {
+				return nil, fmt.Errorf("failed to decrypt signing key %s (check JWT_KEY_ENCRYPTION_KEY): %w", key.ID, err)
+			}
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode signing key %s: %w", key.ID, err)
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("signing key %s is not a signer", key.ID)
+		}
+		key.PrivateKey = signer
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// EncryptPlaintext encrypts keys stored before keys were encrypted at rest.
+func (s *SigningKeyService) EncryptPlaintext(ctx context.Context) error {
+	rows, err := s.db.Pool.Query(ctx, `SELECT id, private_key FROM signing_keys WHERE NOT encrypted`)
+	if err != nil {
+		return err
+	}
+	plaintext := make(map[string][]byte)
+	for rows.Next() {
+		var id string
+		var der []byte
+		if err := rows.Scan(&id, &der); err != nil {
+			rows.Close()
+			return err
+		}
+		plaintext[id] = der
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, der := range plaintext {
+		sealed, err := s.seal(id, der)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt signing key %s: %w", id, err)
+		}
+		// Another instance may have encrypted the key meanwhile
+		if _, err := s.db.Pool.Exec(ctx, `
+			UPDATE signing_keys SET private_key = $2, encrypted = TRUE WHERE id = $1 AND NOT encrypted
+		`, id, sealed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CleanupExpired deletes keys whose tokens have all expired.
+func (s *SigningKeyService) CleanupExpired(ctx context.Context) error {
+	_, err := s.db.Pool.Exec(ctx, `DELETE FROM signing_keys WHERE expires_at < NOW()`)
+	return err
+}
+
+// Refresh rotates the signing key when it is due and hands the current keys
+// to the JWT service. A new key signs once it has propagated; until then the
+// key it replaced keeps signing.
+func (s *SigningKeyService) Refresh(ctx context.Context, jwtService *JWTService) error {
+	if err := s.EncryptPlaintext(ctx); err != nil {
+		return fmt.Errorf("failed to encrypt signing keys: %w", err)
+	}
+	if _, err := s.Rotate(ctx); err != nil {
+		return fmt.Errorf("failed to rotate signing key: %w", err)
+	}
+	keys, err := s.List(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	for i, key := range keys {
+		if time.Since(key.CreatedAt) >= signingKeyPropagation {
+			keys[0], keys[i] = keys[i], keys[0]
+			break
+		}
+	}
+	jwtService.SetKeys(keys)
+	return nil
+}
+
+func generateSigningKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case SigningAlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		return key, nil
+	case SigningAlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
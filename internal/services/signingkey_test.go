@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupSigningKeyService(t *testing.T) (*SigningKeyService, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	t.Cleanup(func() { mock.Close() })
+
+	db := &database.DB{Pool: mock}
+	return NewSigningKeyService(db, SigningAlgorithmEdDSA, 720*time.Hour, 168*time.Hour, "test-secret"), mock
+}
+
+func TestSigningKeyService_Rotate_Current(t *testing.T) {
+	svc, mock := setupSigningKeyService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).
+		WithArgs(signingKeyLock).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM signing_keys`).
+		WithArgs(SigningAlgorithmEdDSA, pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	rotated, err := svc.Rotate(context.Background())
+
+	require.NoError(t, err)
+	assert.False(t, rotated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSigningKeyService_Rotate_Due(t *testing.T) {
+	svc, mock := setupSigningKeyService(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock`).
+		WithArgs(signingKeyLock).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM signing_keys`).
+		WithArgs(SigningAlgorithmEdDSA, pgxmock.AnyArg()).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(`UPDATE signing_keys SET expires_at`).
+		WithArgs(pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`INSERT INTO signing_keys \(id, algorithm, private_key, encrypted\) VALUES \(\$1, \$2, \$3, TRUE\)`).
+		WithArgs(pgxmock.AnyArg(), SigningAlgorithmEdDSA, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	rotated, err := svc.Rotate(context.Background())
+
+	require.NoError(t, err)
+	assert.True(t, rotated)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSigningKeyService_List(t *testing.T) {
+	svc, mock := setupSigningKeyService(t)
+
+	key, err := generateSigningKey(SigningAlgorithmEdDSA)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	sealed, err := svc.seal("key-1", der)
+	require.NoError(t, err)
+	now := time.Now()
+	var noExpiry *time.Time
+
+	// Keys stored before encryption at rest are read as they are
+	mock.ExpectQuery(`SELECT id, algorithm, private_key, encrypted, created_at, expires_at FROM signing_keys`).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "algorithm", "private_key", "encrypted", "created_at", "expires_at"}).
+			AddRow("key-1", SigningAlgorithmEdDSA, sealed, true, now, noExpiry).
+			AddRow("key-0", SigningAlgorithmEdDSA, der, false, now.Add(-time.Hour), &now))
+
+	keys, err := svc.List(context.Background())
+
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, "key-1", keys[0].ID)
+	assert.Equal(t, key.Public(), keys[0].PrivateKey.Public())
+	assert.Nil(t, keys[0].ExpiresAt)
+	assert.Equal(t, key.Public(), keys[1].PrivateKey.Public())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSigningKeyService_List_WrongEncryptionKey(t *testing.T) {
+	svc, mock := setupSigningKeyService(t)
+	other := NewSigningKeyService(svc.db, SigningAlgorithmEdDSA, 720*time.Hour, 168*time.Hour, "other-secret")
+
+	key, err := generateSigningKey(SigningAlgorithmEdDSA)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	sealed, err := other.seal("key-1", der)
+	require.NoError(t, err)
+	var noExpiry *time.Time
+
+	mock.ExpectQuery(`SELECT id, algorithm, private_key, encrypted, created_at, expires_at FROM signing_keys`).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "algorithm", "private_key", "encrypted", "created_at", "expires_at"}).
+			AddRow("key-1", SigningAlgorithmEdDSA, sealed, true, time.Now(), noExpiry))
+
+	_, err = svc.List(context.Background())
+
+	assert.ErrorContains(t, err, "failed to decrypt signing key key-1")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSigningKeyService_SealBoundToID(t *testing.T) {
+	svc, _ := setupSigningKeyService(t)
+
+	sealed, err := svc.seal("key-1", []byte("private key"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(sealed), "private key")
+
+	der, err := svc.open("key-1", sealed)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("private key"), der)
+
+	// A sealed key copied to another row doesn't decrypt
+	_, err = svc.open("key-2", sealed)
+	assert.Error(t, err)
+}
+
+func TestSigningKeyService_EncryptPlaintext(t *testing.T) {
+	svc, mock := setupSigningKeyService(t)
+
+	mock.ExpectQuery(`SELECT id, private_key FROM signing_keys WHERE NOT encrypted`).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "private_key"}).AddRow("key-0", []byte("private key")))
+	mock.ExpectExec(`UPDATE signing_keys SET private_key = \$2, encrypted = TRUE WHERE id = \$1 AND NOT encrypted`).
+		WithArgs("key-0", pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	require.NoError(t, svc.EncryptPlaintext(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+const (
+	// MaxSpecBundleFiles limits how many specs one batch upsert can hold
+	MaxSpecBundleFiles = 100
+	// MaxSpecBundleSize limits the uncompressed size of a spec bundle
+	MaxSpecBundleSize = 32 << 20
+	// SpecBundleManifest is the archive entry describing the specs
+	SpecBundleManifest = "manifest.json"
+)
+
+var (
+	ErrInvalidSpecBundle  = errors.New("invalid spec archive")
+	ErrSpecBundleTooLarge = errors.New("spec archive is too large")
+)
+
+// SpecFile is one document of a spec bundle.
+type SpecFile struct {
+	Name    string
+	Content []byte
+}
+
+// ReadSpecArchive reads the regular files of a tar archive, which may be
+// gzip-compressed. Hidden files such as .DS_Store are skipped. File names are
+// cleaned paths relative to the archive root.
+func ReadSpecArchive(r io.Reader) ([]SpecFile, error) {
+	br := bufio.NewReader(r)
+	var src io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSpecBundle, err)
+		}
+		defer func() { _ = gz.Close() }()
+		src = gz
+	}
+
+	var files []SpecFile
+	total := int64(0)
+	tr := tar.NewReader(src)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSpecBundle, err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+header.Name), "/")
+		if strings.HasPrefix(path.Base(name), ".") {
+			continue
+		}
+
+		total += header.Size
+		if total > MaxSpecBundleSize {
+			return nil, ErrSpecBundleTooLarge
+		}
+		if len(files) == MaxSpecBundleFiles+1 {
+			// One extra entry is allowed for the manifest
+			return nil, fmt.Errorf("%w: at most %d specs are allowed", ErrSpecBundleTooLarge, MaxSpecBundleFiles)
+		}
+
+		content, err := io.ReadAll(io.LimitReader(tr, header.Size))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSpecBundle, err)
+		}
+		files = append(files, SpecFile{Name: name, Content: content})
+	}
+
+	return files, nil
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func buildTar(t *testing.T, files map[string]string, order []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "specs/", Typeflag: tar.TypeDir, Mode: 0o755}))
+	for _, name := range order {
+		content := files[name]
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestReadSpecArchive(t *testing.T) {
+	files := map[string]string{
+		"./manifest.json":       `[]`,
+		"specs/users.yaml":      "openapi: 3.0.0",
+		"specs/.DS_Store":       "junk",
+		"../specs/billing.json": `{"openapi":"3.0.0"}`,
+		"specs/._billing.json":  "junk",
+	}
+	archive := buildTar(t, files, []string{"./manifest.json", "specs/users.yaml", "specs/.DS_Store", "../specs/billing.json", "specs/._billing.json"})
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err := zw.Write(archive)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+
+	for name, body := range map[string][]byte{"tar": archive, "tar.gz": gz.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			got, err := ReadSpecArchive(bytes.NewReader(body))
+			require.NoError(t, err)
+			require.Len(t, got, 3)
+			assert.Equal(t, "manifest.json", got[0].Name)
+			assert.Equal(t, "specs/users.yaml", got[1].Name)
+			assert.Equal(t, "openapi: 3.0.0", string(got[1].Content))
+			assert.Equal(t, "specs/billing.json", got[2].Name)
+		})
+	}
+}
+
+func TestReadSpecArchive_Invalid(t *testing.T) {
+	_, err := ReadSpecArchive(bytes.NewReader([]byte("not a tarball, just some text that is long enough")))
+	assert.ErrorIs(t, err, ErrInvalidSpecBundle)
+}
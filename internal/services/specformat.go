@@ -0,0 +1,80 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SpecFormat identifies the kind of document submitted for import.
+type SpecFormat string
+
+const (
+	SpecFormatOpenAPI    SpecFormat = "openapi"
+	SpecFormatAsyncAPI   SpecFormat = "asyncapi"
+	SpecFormatGraphQL    SpecFormat = "graphql"
+	SpecFormatPostman    SpecFormat = "postman"
+	SpecFormatPostmanEnv SpecFormat = "postman-env"
+	SpecFormatInsomnia   SpecFormat = "insomnia"
+	SpecFormatHAR        SpecFormat = "har"
+)
+
+// graphQLSDLPattern matches the start of a type system definition.
+var graphQLSDLPattern = regexp.MustCompile(`(?m)^\s*(extend\s+)?(schema|type|interface|input|enum|scalar|union|directive)\b[^:\n]*[{=@\n]`)
+
+// DetectSpecFormat inspects the top-level fields of a JSON or YAML document,
+// or recognises GraphQL SDL. Documents that are not recognised are reported
+// as OpenAPI so that parsing errors keep describing the default format.
+func DetectSpecFormat(content []byte) SpecFormat {
+	var fields map[string]any
+	if err := yaml.Unmarshal(content, &fields); err != nil || fields == nil {
+		if graphQLSDLPattern.Match(content) {
+			return SpecFormatGraphQL
+		}
+		return SpecFormatOpenAPI
+	}
+
+	if _, ok := fields["asyncapi"]; ok {
+		return SpecFormatAsyncAPI
+	}
+	if _, ok := fields["__schema"]; ok {
+		return SpecFormatGraphQL
+	}
+	if data, ok := fields["data"].(map[string]any); ok {
+		if _, ok := data["__schema"]; ok {
+			return SpecFormatGraphQL
+		}
+	}
+
+	if info, ok := fields["info"].(map[string]any); ok {
+		schema, _ := info["schema"].(string)
+		if _, ok := info["_postman_id"]; ok || strings.Contains(schema, "postman") {
+			return SpecFormatPostman
+		}
+	}
+	if _, ok := fields["values"].([]any); ok {
+		if scope, _ := fields["_postman_variable_scope"].(string); scope == "environment" || scope == "globals" {
+			return SpecFormatPostmanEnv
+		}
+		if _, ok := fields["name"].(string); ok && len(fields) <= 6 {
+			return SpecFormatPostmanEnv
+		}
+	}
+	if fields["_type"] == "export" && fields["__export_format"] != nil {
+		return SpecFormatInsomnia
+	}
+	if log, ok := fields["log"].(map[string]any); ok {
+		if _, ok := log["entries"]; ok {
+			return SpecFormatHAR
+		}
+	}
+
+	// Some SDL documents happen to be valid YAML as well
+	_, isOpenAPI := fields["openapi"]
+	_, isSwagger := fields["swagger"]
+	if !isOpenAPI && !isSwagger && graphQLSDLPattern.Match(content) {
+		return SpecFormatGraphQL
+	}
+	return SpecFormatOpenAPI
+}
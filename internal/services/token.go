@@ -2,10 +2,19 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrRefreshTokenReused = errors.New("refresh token reused")
 )
 
 type TokenService struct {
@@ -16,21 +25,173 @@ func NewTokenService(db *database.DB) *TokenService {
 	return &TokenService{db: db}
 }
 
-func (s *TokenService) StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+// CreateSession records a newly signed-in device. The caller stores the
+// session's first refresh token.
+func (s *TokenService) CreateSession(ctx context.Context, userID uuid.UUID, deviceName, userAgent, ipAddress string) (*models.Session, error) {
+	var session models.Session
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO sessions (user_id, device_name, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, user_id, device_name, user_agent, ip_address, created_at, last_used_at
+	`, userID, deviceName, userAgent, ipAddress).Scan(
+		&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent,
+		&session.IPAddress, &session.CreatedAt, &session.LastUsedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return &session, nil
+}
+
+// TouchSession records that a session was just used from ipAddress.
+func (s *TokenService) TouchSession(ctx context.Context, sessionID uuid.UUID, userAgent, ipAddress string) error {
 	_, err := s.db.Pool.Exec(ctx, `
-		INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
-		VALUES ($1, $2, $3)
-	`, userID, tokenHash, expiresAt)
+		UPDATE sessions SET user_agent = $2, ip_address = $3, last_used_at = NOW()
+		WHERE id = $1
+	`, sessionID, userAgent, ipAddress)
 	return err
 }
 
-func (s *TokenService) ValidateRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
-	var userID uuid.UUID
+// ListSessions returns the user's sessions, most recently used first.
+func (s *TokenService) ListSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, user_id, device_name, user_agent, ip_address, created_at, last_used_at
+		FROM sessions
+		WHERE user_id = $1
+		ORDER BY last_used_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []models.Session
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(
+			&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent,
+			&session.IPAddress, &session.CreatedAt, &session.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// RevokeSession signs a device out by deleting its session and refresh
+// tokens. Access tokens already issued to it stay valid until they expire.
+func (s *TokenService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM sessions WHERE id = $1 AND user_id = $2`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeSessionByToken ends the session a refresh token belongs to and
+// returns its ID.
+func (s *TokenService) RevokeSessionByToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+	var sessionID uuid.UUID
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT user_id FROM refresh_tokens
+		DELETE FROM sessions WHERE id = (SELECT session_id FROM refresh_tokens WHERE token_hash = $1)
+		RETURNING id
+	`, tokenHash).Scan(&sessionID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrSessionNotFound
+	}
+	return sessionID, err
+}
+
+// IsSessionActive reports whether a session hasn't been revoked.
+func (s *TokenService) IsSessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	var exists bool
+	err := s.db.Pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM sessions WHERE id = $1)`, sessionID).Scan(&exists)
+	return exists, err
+}
+
+func (s *TokenService) StoreRefreshToken(ctx context.Context, userID, sessionID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, sessionID, tokenHash, expiresAt)
+	return err
+}
+
+// ValidateRefreshToken returns the user and session of a stored, unexpired
+// refresh token. A session is a token family: presenting a token that was
+// already rotated means a copy leaked, so the whole session is revoked and
+// ErrRefreshTokenReused is returned along with the user and session.
+func (s *TokenService) ValidateRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, uuid.UUID, error) {
+	var userID, sessionID uuid.UUID
+	var used bool
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT user_id, session_id, used_at IS NOT NULL FROM refresh_tokens
 		WHERE token_hash = $1 AND expires_at > NOW()
-	`, tokenHash).Scan(&userID)
-	return userID, err
+	`, tokenHash).Scan(&userID, &sessionID, &used)
+	if err != nil {
+		return uuid.Nil, uuid.Nil, err
+	}
+
+	if used {
+		if _, err := s.revokeFamily(ctx, sessionID); err != nil {
+			return uuid.Nil, uuid.Nil, err
+		}
+		return userID, sessionID, ErrRefreshTokenReused
+	}
+	return userID, sessionID, nil
+}
+
+// RotateRefreshToken marks a validated refresh token used and stores its
+// successor in the same session. If another request rotated the token
+// first, the session is revoked and ErrRefreshTokenReused returned.
+func (s *TokenService) RotateRefreshToken(ctx context.Context, userID, sessionID uuid.UUID, oldTokenHash, newTokenHash string, expiresAt time.Time) error {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	result, err := tx.Exec(ctx, `
+		UPDATE refresh_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND session_id = $2 AND used_at IS NULL
+	`, oldTokenHash, sessionID)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		_ = tx.Rollback(ctx)
+		// The token is gone when its session was signed out meanwhile
+		revoked, err := s.revokeFamily(ctx, sessionID)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return ErrSessionNotFound
+		}
+		return ErrRefreshTokenReused
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO refresh_tokens (user_id, session_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, sessionID, newTokenHash, expiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// revokeFamily deletes a session and all refresh tokens issued to it
+func (s *TokenService) revokeFamily(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	result, err := s.db.Pool.Exec(ctx, `DELETE FROM sessions WHERE id = $1`, sessionID)
+	if err != nil {
+		return false, err
+	}
+	return result.RowsAffected() > 0, nil
 }
 
 func (s *TokenService) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
@@ -38,12 +199,36 @@ func (s *TokenService) RevokeRefreshToken(ctx context.Context, tokenHash string)
 	return err
 }
 
-func (s *TokenService) RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) error {
-	_, err := s.db.Pool.Exec(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1`, userID)
-	return err
+// RevokeAllUserTokens ends all sessions of a user and returns their IDs.
+func (s *TokenService) RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := s.db.Pool.Query(ctx, `DELETE FROM sessions WHERE user_id = $1 RETURNING id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessionIDs []uuid.UUID
+	for rows.Next() {
+		var sessionID uuid.UUID
+		if err := rows.Scan(&sessionID); err != nil {
+			return nil, err
+		}
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	return sessionIDs, rows.Err()
 }
 
 func (s *TokenService) CleanupExpired(ctx context.Context) error {
-	_, err := s.db.Pool.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at < NOW()`)
+	if _, err := s.db.Pool.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at < NOW()`); err != nil {
+		return err
+	}
+
+	// Sessions whose last token expired are signed out. New sessions get
+	// their first token right after they're created
+	_, err := s.db.Pool.Exec(ctx, `
+		DELETE FROM sessions s
+		WHERE s.created_at < NOW() - INTERVAL '1 minute'
+		AND NOT EXISTS (SELECT 1 FROM refresh_tokens r WHERE r.session_id = s.id)
+	`)
 	return err
 }
@@ -27,14 +27,15 @@ func TestTokenService_StoreRefreshToken(t *testing.T) {
 	svc, mock := setupTokenService(t)
 	ctx := context.Background()
 	userID := uuid.New()
+	sessionID := uuid.New()
 	tokenHash := "abc123hash"
 	expiresAt := time.Now().Add(24 * time.Hour)
 
 	mock.ExpectExec(`INSERT INTO refresh_tokens`).
-		WithArgs(userID, tokenHash, expiresAt).
+		WithArgs(userID, sessionID, tokenHash, expiresAt).
 		WillReturnResult(pgxmock.NewResult("INSERT", 1))
 
-	err := svc.StoreRefreshToken(ctx, userID, tokenHash, expiresAt)
+	err := svc.StoreRefreshToken(ctx, userID, sessionID, tokenHash, expiresAt)
 
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -44,17 +45,19 @@ func TestTokenService_ValidateRefreshToken_Valid(t *testing.T) {
 	svc, mock := setupTokenService(t)
 	ctx := context.Background()
 	userID := uuid.New()
+	sessionID := uuid.New()
 	tokenHash := "valid-hash"
 
-	rows := pgxmock.NewRows([]string{"user_id"}).AddRow(userID)
-	mock.ExpectQuery(`SELECT user_id FROM refresh_tokens`).
+	rows := pgxmock.NewRows([]string{"user_id", "session_id", "used"}).AddRow(userID, sessionID, false)
+	mock.ExpectQuery(`SELECT user_id, session_id, used_at IS NOT NULL FROM refresh_tokens`).
 		WithArgs(tokenHash).
 		WillReturnRows(rows)
 
-	result, err := svc.ValidateRefreshToken(ctx, tokenHash)
+	resultUserID, resultSessionID, err := svc.ValidateRefreshToken(ctx, tokenHash)
 
 	assert.NoError(t, err)
-	assert.Equal(t, userID, result)
+	assert.Equal(t, userID, resultUserID)
+	assert.Equal(t, sessionID, resultSessionID)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -63,11 +66,11 @@ func TestTokenService_ValidateRefreshToken_Expired(t *testing.T) {
 	ctx := context.Background()
 	tokenHash := "expired-hash"
 
-	mock.ExpectQuery(`SELECT user_id FROM refresh_tokens`).
+	mock.ExpectQuery(`SELECT user_id, session_id, used_at IS NOT NULL FROM refresh_tokens`).
 		WithArgs(tokenHash).
 		WillReturnError(pgx.ErrNoRows)
 
-	_, err := svc.ValidateRefreshToken(ctx, tokenHash)
+	_, _, err := svc.ValidateRefreshToken(ctx, tokenHash)
 
 	assert.Error(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
@@ -78,16 +81,83 @@ func TestTokenService_ValidateRefreshToken_NotFound(t *testing.T) {
 	ctx := context.Background()
 	tokenHash := "nonexistent-hash"
 
-	mock.ExpectQuery(`SELECT user_id FROM refresh_tokens`).
+	mock.ExpectQuery(`SELECT user_id, session_id, used_at IS NOT NULL FROM refresh_tokens`).
 		WithArgs(tokenHash).
 		WillReturnError(pgx.ErrNoRows)
 
-	_, err := svc.ValidateRefreshToken(ctx, tokenHash)
+	_, _, err := svc.ValidateRefreshToken(ctx, tokenHash)
 
 	assert.Error(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestTokenService_ValidateRefreshToken_Reused(t *testing.T) {
+	svc, mock := setupTokenService(t)
+	ctx := context.Background()
+	userID := uuid.New()
+	sessionID := uuid.New()
+	tokenHash := "used-hash"
+
+	rows := pgxmock.NewRows([]string{"user_id", "session_id", "used"}).AddRow(userID, sessionID, true)
+	mock.ExpectQuery(`SELECT user_id, session_id, used_at IS NOT NULL FROM refresh_tokens`).
+		WithArgs(tokenHash).
+		WillReturnRows(rows)
+	mock.ExpectExec(`DELETE FROM sessions WHERE id`).
+		WithArgs(sessionID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	resultUserID, resultSessionID, err := svc.ValidateRefreshToken(ctx, tokenHash)
+
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	assert.Equal(t, userID, resultUserID)
+	assert.Equal(t, sessionID, resultSessionID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenService_RotateRefreshToken(t *testing.T) {
+	svc, mock := setupTokenService(t)
+	ctx := context.Background()
+	userID := uuid.New()
+	sessionID := uuid.New()
+	expiresAt := time.Now().Add(24 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE refresh_tokens SET used_at = NOW\(\)`).
+		WithArgs("old-hash", sessionID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`INSERT INTO refresh_tokens`).
+		WithArgs(userID, sessionID, "new-hash", expiresAt).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	err := svc.RotateRefreshToken(ctx, userID, sessionID, "old-hash", "new-hash", expiresAt)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenService_RotateRefreshToken_Race(t *testing.T) {
+	svc, mock := setupTokenService(t)
+	ctx := context.Background()
+	userID := uuid.New()
+	sessionID := uuid.New()
+	expiresAt := time.Now().Add(24 * time.Hour)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE refresh_tokens SET used_at = NOW\(\)`).
+		WithArgs("old-hash", sessionID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+	mock.ExpectRollback()
+	mock.ExpectExec(`DELETE FROM sessions WHERE id`).
+		WithArgs(sessionID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	err := svc.RotateRefreshToken(ctx, userID, sessionID, "old-hash", "new-hash", expiresAt)
+
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestTokenService_RevokeRefreshToken(t *testing.T) {
 	svc, mock := setupTokenService(t)
 	ctx := context.Background()
@@ -108,13 +178,15 @@ func TestTokenService_RevokeAllUserTokens(t *testing.T) {
 	ctx := context.Background()
 	userID := uuid.New()
 
-	mock.ExpectExec(`DELETE FROM refresh_tokens WHERE user_id`).
+	sessionIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	mock.ExpectQuery(`DELETE FROM sessions WHERE user_id = \$1 RETURNING id`).
 		WithArgs(userID).
-		WillReturnResult(pgxmock.NewResult("DELETE", 3))
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(sessionIDs[0]).AddRow(sessionIDs[1]))
 
-	err := svc.RevokeAllUserTokens(ctx, userID)
+	revoked, err := svc.RevokeAllUserTokens(ctx, userID)
 
 	assert.NoError(t, err)
+	assert.Equal(t, sessionIDs, revoked)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -124,9 +196,126 @@ func TestTokenService_CleanupExpired(t *testing.T) {
 
 	mock.ExpectExec(`DELETE FROM refresh_tokens WHERE expires_at < NOW`).
 		WillReturnResult(pgxmock.NewResult("DELETE", 5))
+	mock.ExpectExec(`DELETE FROM sessions s\s+WHERE .+ NOT EXISTS`).
+		WillReturnResult(pgxmock.NewResult("DELETE", 2))
 
 	err := svc.CleanupExpired(ctx)
 
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+var sessionTestColumns = []string{"id", "user_id", "device_name", "user_agent", "ip_address", "created_at", "last_used_at"}
+
+func TestTokenService_CreateSession(t *testing.T) {
+	svc, mock := setupTokenService(t)
+	userID := uuid.New()
+	sessionID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`INSERT INTO sessions`).
+		WithArgs(userID, "Ada's laptop", "nikode-cli/1.0", "192.0.2.1").
+		WillReturnRows(pgxmock.NewRows(sessionTestColumns).
+			AddRow(sessionID, userID, "Ada's laptop", "nikode-cli/1.0", "192.0.2.1", now, now))
+
+	session, err := svc.CreateSession(context.Background(), userID, "Ada's laptop", "nikode-cli/1.0", "192.0.2.1")
+
+	require.NoError(t, err)
+	assert.Equal(t, sessionID, session.ID)
+	assert.Equal(t, "Ada's laptop", session.DeviceName)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenService_ListSessions(t *testing.T) {
+	svc, mock := setupTokenService(t)
+	userID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT .+ FROM sessions\s+WHERE user_id = .+ ORDER BY last_used_at DESC`).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows(sessionTestColumns).
+			AddRow(uuid.New(), userID, "Laptop", "Electron", "192.0.2.1", now, now).
+			AddRow(uuid.New(), userID, "", "nikode-cli/1.0", "198.51.100.7", now, now.Add(-time.Hour)))
+
+	sessions, err := svc.ListSessions(context.Background(), userID)
+
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, "Laptop", sessions[0].DeviceName)
+	assert.Equal(t, "198.51.100.7", sessions[1].IPAddress)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenService_RevokeSession(t *testing.T) {
+	svc, mock := setupTokenService(t)
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	mock.ExpectExec(`DELETE FROM sessions WHERE id = .+ AND user_id`).
+		WithArgs(sessionID, userID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	err := svc.RevokeSession(context.Background(), userID, sessionID)
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenService_RevokeSession_NotFound(t *testing.T) {
+	svc, mock := setupTokenService(t)
+	userID := uuid.New()
+	sessionID := uuid.New()
+
+	// Another user's session is not found either
+	mock.ExpectExec(`DELETE FROM sessions WHERE id = .+ AND user_id`).
+		WithArgs(sessionID, userID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	err := svc.RevokeSession(context.Background(), userID, sessionID)
+
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenService_RevokeSessionByToken(t *testing.T) {
+	svc, mock := setupTokenService(t)
+
+	sessionID := uuid.New()
+	mock.ExpectQuery(`DELETE FROM sessions WHERE id = \(SELECT session_id FROM refresh_tokens WHERE token_hash`).
+		WithArgs("token-hash").
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(sessionID))
+
+	revoked, err := svc.RevokeSessionByToken(context.Background(), "token-hash")
+
+	assert.NoError(t, err)
+	assert.Equal(t, sessionID, revoked)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenService_RevokeSessionByToken_NotFound(t *testing.T) {
+	svc, mock := setupTokenService(t)
+
+	mock.ExpectQuery(`DELETE FROM sessions WHERE id = \(SELECT session_id FROM refresh_tokens WHERE token_hash`).
+		WithArgs("token-hash").
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err := svc.RevokeSessionByToken(context.Background(), "token-hash")
+
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTokenService_IsSessionActive(t *testing.T) {
+	svc, mock := setupTokenService(t)
+	sessionID := uuid.New()
+
+	mock.ExpectQuery(`SELECT EXISTS\(SELECT 1 FROM sessions WHERE id`).
+		WithArgs(sessionID).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+
+	active, err := svc.IsSessionActive(context.Background(), sessionID)
+
+	require.NoError(t, err)
+	assert.False(t, active)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
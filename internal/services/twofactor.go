@@ -0,0 +1,385 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnrolling   = errors.New("two-factor enrollment has not been started")
+	ErrTwoFactorInvalidCode    = errors.New("invalid two-factor code")
+	// ErrTwoFactorRequired is returned when a workspace requires 2FA of a
+	// user who hasn't enabled it
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required")
+)
+
+// TOTP parameters (RFC 6238). These are the defaults every authenticator
+// app supports.
+const (
+	totpIssuer    = "Nikode"
+	totpPeriod    = 30
+	totpDigits    = 6
+	totpSecretLen = 20
+	// totpSkew accepts codes from one period either side of now, for
+	// clocks that drift
+	totpSkew = 1
+
+	RecoveryCodeCount      = 10
+	recoveryCodeChars      = "abcdefghjkmnpqrstuvwxyz23456789"
+	recoveryCodeHalfLength = 5
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactorEnrollment is a TOTP secret waiting to be confirmed with a code
+// from the user's authenticator app.
+type TwoFactorEnrollment struct {
+	Secret string
+	// OTPAuthURL is the otpauth:// URI shown as a QR code
+	OTPAuthURL string
+}
+
+// TwoFactorStatus describes a user's second factor.
+type TwoFactorStatus struct {
+	Enabled           bool
+	RecoveryCodesLeft int
+}
+
+// TwoFactorService manages TOTP second factors. A user has a second factor
+// once an enrollment is confirmed; from then on every sign-in asks for a
+// code from the authenticator app or one of the single-use recovery codes.
+type TwoFactorService struct {
+	db *database.DB
+}
+
+func NewTwoFactorService(db *database.DB) *TwoFactorService {
+	return &TwoFactorService{db: db}
+}
+
+// BeginEnrollment creates a new TOTP secret for a user, replacing any
+// unconfirmed one.
+func (s *TwoFactorService) BeginEnrollment(ctx context.Context, userID uuid.UUID, accountName string) (*TwoFactorEnrollment, error) {
+	raw := make([]byte, totpSecretLen)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	secret := totpEncoding.EncodeToString(raw)
+
+	result, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO user_totp (user_id, secret) VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, created_at = NOW()
+		WHERE user_totp.enabled_at IS NULL
+	`, userID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected() == 0 {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	return &TwoFactorEnrollment{
+		Secret:     secret,
+		OTPAuthURL: totpURL(secret, accountName),
+	}, nil
+}
+
+// ConfirmEnrollment enables the pending secret once the user proves their
+// app generates its codes, and returns the user's recovery codes.
+func (s *TwoFactorService) ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	var secret string
+	var enabledAt *time.Time
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT secret, enabled_at FROM user_totp WHERE user_id = $1
+	`, userID).Scan(&secret, &enabledAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTwoFactorNotEnrolling
+	}
+	if err != nil {
+		return nil, err
+	}
+	if enabledAt != nil {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, ErrTwoFactorInvalidCode
+	}
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	result, err := tx.Exec(ctx, `
+		UPDATE user_totp SET enabled_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`, userID, step)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected() == 0 {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// IsEnabled reports whether a user has a confirmed second factor.
+func (s *TwoFactorService) IsEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var enabled bool
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL)
+	`, userID).Scan(&enabled)
+	return enabled, err
+}
+
+// Status returns whether a user has a second factor and how many recovery
+// codes they have left.
+func (s *TwoFactorService) Status(ctx context.Context, userID uuid.UUID) (*TwoFactorStatus, error) {
+	var status TwoFactorStatus
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT
+			EXISTS(SELECT 1 FROM user_totp WHERE user_id = $1 AND enabled_at IS NOT NULL),
+			(SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL)
+	`, userID).Scan(&status.Enabled, &status.RecoveryCodesLeft)
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Verify checks a code from the user's authenticator app or one of their
+// recovery codes. Each TOTP code and recovery code is accepted only once.
+func (s *TwoFactorService) Verify(ctx context.Context, userID uuid.UUID, code string) error {
+	code = strings.TrimSpace(code)
+	if !isTOTPCode(code) {
+		return s.useRecoveryCode(ctx, userID, code)
+	}
+
+	var secret string
+	var lastStep int64
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT secret, last_used_step FROM user_totp
+		WHERE user_id = $1 AND enabled_at IS NOT NULL
+	`, userID).Scan(&secret, &lastStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok || step <= lastStep {
+		return ErrTwoFactorInvalidCode
+	}
+
+	// The condition on last_used_step keeps a code from being used twice by
+	// concurrent requests
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE user_totp SET last_used_step = $2
+		WHERE user_id = $1 AND last_used_step < $2
+	`, userID, step)
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTwoFactorInvalidCode
+	}
+	return nil
+}
+
+func (s *TwoFactorService) useRecoveryCode(ctx context.Context, userID uuid.UUID, code string) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE user_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, HashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if result.RowsAffected() == 0 {
+		return ErrTwoFactorInvalidCode
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces a user's recovery codes after checking
+// a current code.
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	codes, err := replaceRecoveryCodes(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable removes a user's second factor after checking a current code. It
+// fails with ErrTwoFactorRequired while the user belongs to a workspace
+// that requires it.
+func (s *TwoFactorService) Disable(ctx context.Context, userID uuid.UUID, code string) error {
+	var required bool
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM workspace_members wm
+			JOIN workspaces w ON w.id = wm.workspace_id
+			WHERE wm.user_id = $1 AND w.require_2fa
+		)
+	`, userID).Scan(&required)
+	if err != nil {
+		return err
+	}
+	if required {
+		return ErrTwoFactorRequired
+	}
+
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID uuid.UUID) ([]string, error) {
+	if _, err := tx.Exec(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO user_recovery_codes (user_id, code_hash) VALUES ($1, $2)
+		`, userID, HashToken(normalizeRecoveryCode(code))); err != nil {
+			return nil, err
+		}
+		codes[i] = code
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code like "k3m9p-x7q2r"
+func generateRecoveryCode() (string, error) {
+	var b strings.Builder
+	for i := range 2 * recoveryCodeHalfLength {
+		if i == recoveryCodeHalfLength {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(recoveryCodeChars))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		b.WriteByte(recoveryCodeChars[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+func isTOTPCode(code string) bool {
+	if len(code) != totpDigits {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTOTP checks a code against the periods around now and returns the
+// period it belongs to.
+func matchTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || !isTOTPCode(code) {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the code for a time step (RFC 4226 dynamic truncation)
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+func totpURL(secret, accountName string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(totpIssuer + ":" + accountName)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dimitrije/nikode-api/internal/database"
+	"github.com/google/uuid"
+	"github.com/pashagolub/pgxmock/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupTwoFactorService(t *testing.T) (*TwoFactorService, pgxmock.PgxPoolIface) {
+	t.Helper()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	t.Cleanup(func() { mock.Close() })
+
+	db := &database.DB{Pool: mock}
+	return NewTwoFactorService(db), mock
+}
+
+// rfc6238Secret is the SHA-1 key of the RFC 6238 test vectors
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	// The last six digits of the RFC 6238 appendix B SHA-1 codes
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	key := []byte("12345678901234567890")
+	for _, tt := range tests {
+		assert.Equal(t, tt.code, totpCode(key, tt.unix/totpPeriod), "time %d", tt.unix)
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+
+	step, ok := matchTOTP(rfc6238Secret, "050471", now)
+	assert.True(t, ok)
+	assert.Equal(t, current, step)
+
+	// A code from the previous period is still accepted
+	step, ok = matchTOTP(rfc6238Secret, "050471", now.Add(totpPeriod*time.Second))
+	assert.True(t, ok)
+	assert.Equal(t, current, step)
+
+	_, ok = matchTOTP(rfc6238Secret, "050471", now.Add(3*totpPeriod*time.Second))
+	assert.False(t, ok)
+
+	_, ok = matchTOTP(rfc6238Secret, "12345", now)
+	assert.False(t, ok)
+}
+
+func TestTOTPURL(t *testing.T) {
+	u := totpURL("JBSWY3DPEHPK3PXP", "ada@example.com")
+
+	assert.Contains(t, u, "otpauth://totp/Nikode:ada@example.com?")
+	assert.Contains(t, u, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, u, "issuer=Nikode")
+}
+
+func TestGenerateRecoveryCode(t *testing.T) {
+	code, err := generateRecoveryCode()
+	require.NoError(t, err)
+
+	assert.Regexp(t, `^[a-z2-9]{5}-[a-z2-9]{5}$`, code)
+	assert.Equal(t, normalizeRecoveryCode(code), normalizeRecoveryCode(" "+code[:5]+" "+code[6:]))
+	assert.Equal(t, normalizeRecoveryCode(code), normalizeRecoveryCode(strings.ToUpper(code)))
+}
+
+func TestTwoFactorService_BeginEnrollment_AlreadyEnabled(t *testing.T) {
+	svc, mock := setupTwoFactorService(t)
+	userID := uuid.New()
+
+	mock.ExpectExec(`INSERT INTO user_totp .+ WHERE user_totp.enabled_at IS NULL`).
+		WithArgs(userID, pgxmock.AnyArg()).
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+	_, err := svc.BeginEnrollment(context.Background(), userID, "ada@example.com")
+
+	assert.ErrorIs(t, err, ErrTwoFactorAlreadyEnabled)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorService_Verify_TOTP(t *testing.T) {
+	svc, mock := setupTwoFactorService(t)
+	userID := uuid.New()
+	key := []byte("12345678901234567890")
+	step := time.Now().Unix() / totpPeriod
+	code := totpCode(key, step)
+
+	mock.ExpectQuery(`SELECT secret, last_used_step FROM user_totp`).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"secret", "last_used_step"}).AddRow(rfc6238Secret, step-2))
+	mock.ExpectExec(`UPDATE user_totp SET last_used_step`).
+		WithArgs(userID, step).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	assert.NoError(t, svc.Verify(context.Background(), userID, code))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorService_Verify_Replay(t *testing.T) {
+	svc, mock := setupTwoFactorService(t)
+	userID := uuid.New()
+	key := []byte("12345678901234567890")
+	step := time.Now().Unix() / totpPeriod
+
+	mock.ExpectQuery(`SELECT secret, last_used_step FROM user_totp`).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"secret", "last_used_step"}).AddRow(rfc6238Secret, step))
+
+	err := svc.Verify(context.Background(), userID, totpCode(key, step))
+
+	assert.ErrorIs(t, err, ErrTwoFactorInvalidCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorService_Verify_RecoveryCode(t *testing.T) {
+	svc, mock := setupTwoFactorService(t)
+	userID := uuid.New()
+
+	mock.ExpectExec(`UPDATE user_recovery_codes SET used_at`).
+		WithArgs(userID, HashToken("k3m9px7q2r")).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`UPDATE user_recovery_codes SET used_at`).
+		WithArgs(userID, HashToken("k3m9px7q2r")).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	assert.NoError(t, svc.Verify(context.Background(), userID, "K3M9P-X7Q2R"))
+	assert.ErrorIs(t, svc.Verify(context.Background(), userID, "k3m9p-x7q2r"), ErrTwoFactorInvalidCode)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTwoFactorService_Disable_RequiredByWorkspace(t *testing.T) {
+	svc, mock := setupTwoFactorService(t)
+	userID := uuid.New()
+
+	mock.ExpectQuery(`SELECT EXISTS\(.*require_2fa`).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+
+	err := svc.Disable(context.Background(), userID, "123456")
+
+	assert.ErrorIs(t, err, ErrTwoFactorRequired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -2,12 +2,22 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/dimitrije/nikode-api/internal/database"
 	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/dimitrije/nikode-api/internal/oauth"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrEmailInUse       = errors.New("an account with this email already exists")
+	ErrIdentityLinked   = errors.New("identity is linked to another user")
+	ErrIdentityNotFound = errors.New("identity not found")
+	ErrLastIdentity     = errors.New("cannot unlink the last sign-in identity")
 )
 
 type UserService struct {
@@ -18,48 +28,272 @@ func NewUserService(db *database.DB) *UserService {
 	return &UserService{db: db}
 }
 
+// FindOrCreateFromOAuth signs in the user an identity belongs to. An
+// unknown identity whose email matches an existing user is linked to that
+// user only when both the new provider and one of the user's identities
+// verified the email; otherwise ErrEmailInUse is returned. A verified email
+// also claims workspace invites sent to it before the account existed.
 func (s *UserService) FindOrCreateFromOAuth(ctx context.Context, info *oauth.UserInfo) (*models.User, error) {
+	user, err := s.findOrCreate(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.EmailVerified {
+		// Unclaimed invites stay put and are retried on the next sign-in
+		_ = s.claimEmailInvites(ctx, user.ID, info.Email)
+	}
+	return user, nil
+}
+
+func (s *UserService) findOrCreate(ctx context.Context, info *oauth.UserInfo) (*models.User, error) {
 	var user models.User
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, email, name, avatar_url, provider, provider_id, global_role, created_at, updated_at
-		FROM users
-		WHERE provider = $1 AND provider_id = $2
+		SELECT u.id, u.email, u.name, u.avatar_url, u.provider, u.provider_id, u.global_role, u.created_at, u.updated_at
+		FROM user_identities i
+		JOIN users u ON u.id = i.user_id
+		WHERE i.provider = $1 AND i.provider_id = $2
 	`, info.Provider, info.ID).Scan(
 		&user.ID, &user.Email, &user.Name, &user.AvatarURL,
 		&user.Provider, &user.ProviderID, &user.GlobalRole, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == nil {
-		if user.Email != info.Email || user.Name != info.Name || (user.AvatarURL == nil && info.AvatarURL != "") {
+		_, _ = s.db.Pool.Exec(ctx, `
+			UPDATE user_identities SET email = $1, email_verified = $2, last_used_at = NOW()
+			WHERE provider = $3 AND provider_id = $4
+		`, info.Email, info.EmailVerified, info.Provider, info.ID)
+
+		// The profile follows the identity the account was created with. A
+		// provider without a display name (email links) keeps the current one
+		name := info.Name
+		if name == "" {
+			name = user.Name
+		}
+		isPrimary := user.Provider == info.Provider && user.ProviderID == info.ID
+		if isPrimary && (user.Email != info.Email || user.Name != name || (user.AvatarURL == nil && info.AvatarURL != "")) {
 			_, _ = s.db.Pool.Exec(ctx, `
 				UPDATE users SET email = $1, name = $2, avatar_url = $3, updated_at = NOW()
 				WHERE id = $4
-			`, info.Email, info.Name, nullableString(info.AvatarURL), user.ID)
+			`, info.Email, name, nullableString(info.AvatarURL), user.ID)
 			user.Email = info.Email
-			user.Name = info.Name
+			user.Name = name
 			if info.AvatarURL != "" {
 				user.AvatarURL = &info.AvatarURL
 			}
 		}
 		return &user, nil
 	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find identity: %w", err)
+	}
+
+	existing, err := s.GetByEmail(ctx, info.Email)
+	if err == nil {
+		return s.autoLink(ctx, existing, info)
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to find user: %w", err)
+	}
+
+	name := info.Name
+	if name == "" {
+		name, _, _ = strings.Cut(info.Email, "@")
+	}
+
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
 
-	err = s.db.Pool.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 		INSERT INTO users (email, name, avatar_url, provider, provider_id)
 		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id, email, name, avatar_url, provider, provider_id, global_role, created_at, updated_at
-	`, info.Email, info.Name, nullableString(info.AvatarURL), info.Provider, info.ID).Scan(
+	`, info.Email, name, nullableString(info.AvatarURL), info.Provider, info.ID).Scan(
 		&user.ID, &user.Email, &user.Name, &user.AvatarURL,
 		&user.Provider, &user.ProviderID, &user.GlobalRole, &user.CreatedAt, &user.UpdatedAt,
 	)
-
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO user_identities (user_id, provider, provider_id, email, email_verified)
+		VALUES ($1, $2, $3, $4, $5)
+	`, user.ID, info.Provider, info.ID, info.Email, info.EmailVerified); err != nil {
+		return nil, fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return &user, nil
 }
 
+// claimEmailInvites turns invites sent to email into pending invites for
+// the user, skipping workspaces they already belong to.
+func (s *UserService) claimEmailInvites(ctx context.Context, userID uuid.UUID, email string) error {
+	_, err := s.db.Pool.Exec(ctx, `
+		WITH claimed AS (
+			DELETE FROM workspace_email_invites WHERE email = lower($2)
+			RETURNING workspace_id, inviter_id
+		)
+		INSERT INTO workspace_invites (workspace_id, inviter_id, invitee_id, status)
+		SELECT c.workspace_id, c.inviter_id, $1, $3 FROM claimed c
+		WHERE NOT EXISTS (
+			SELECT 1 FROM workspace_members m WHERE m.workspace_id = c.workspace_id AND m.user_id = $1
+		)
+		ON CONFLICT (workspace_id, invitee_id) DO UPDATE SET
+			inviter_id = EXCLUDED.inviter_id,
+			status = EXCLUDED.status,
+			updated_at = NOW()
+	`, userID, email, models.InviteStatusPending)
+	return err
+}
+
+// autoLink adds a new identity to the user who already has its email.
+func (s *UserService) autoLink(ctx context.Context, user *models.User, info *oauth.UserInfo) (*models.User, error) {
+	if !info.EmailVerified {
+		return nil, ErrEmailInUse
+	}
+
+	var verified bool
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM user_identities
+			WHERE user_id = $1 AND lower(email) = lower($2) AND email_verified
+		)
+	`, user.ID, info.Email).Scan(&verified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check identities: %w", err)
+	}
+	if !verified {
+		return nil, ErrEmailInUse
+	}
+
+	if _, err := s.LinkIdentity(ctx, user.ID, info); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// LinkIdentity adds an identity to a signed-in user. Linking an identity the
+// user already has refreshes it; one that belongs to someone else fails with
+// ErrIdentityLinked.
+func (s *UserService) LinkIdentity(ctx context.Context, userID uuid.UUID, info *oauth.UserInfo) (*models.UserIdentity, error) {
+	var identity models.UserIdentity
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO user_identities (user_id, provider, provider_id, email, email_verified)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (provider, provider_id) DO UPDATE
+		SET email = EXCLUDED.email, email_verified = EXCLUDED.email_verified, last_used_at = NOW()
+		WHERE user_identities.user_id = EXCLUDED.user_id
+		RETURNING id, user_id, provider, provider_id, email, email_verified, created_at, last_used_at
+	`, userID, info.Provider, info.ID, info.Email, info.EmailVerified).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.ProviderID,
+		&identity.Email, &identity.EmailVerified, &identity.CreatedAt, &identity.LastUsedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrIdentityLinked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to link identity: %w", err)
+	}
+	return &identity, nil
+}
+
+func (s *UserService) ListIdentities(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, user_id, provider, provider_id, email, email_verified, created_at, last_used_at
+		FROM user_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []models.UserIdentity
+	for rows.Next() {
+		var identity models.UserIdentity
+		if err := rows.Scan(
+			&identity.ID, &identity.UserID, &identity.Provider, &identity.ProviderID,
+			&identity.Email, &identity.EmailVerified, &identity.CreatedAt, &identity.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		identities = append(identities, identity)
+	}
+	return identities, rows.Err()
+}
+
+// UnlinkIdentity removes one of the user's identities. The last identity
+// can't be removed. When the profile was synced from the removed identity,
+// the most recently used remaining one takes over.
+func (s *UserService) UnlinkIdentity(ctx context.Context, userID, identityID uuid.UUID) error {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	// Lock the user so concurrent unlinks can't remove every identity
+	var primaryProvider, primaryProviderID string
+	err = tx.QueryRow(ctx, `
+		SELECT provider, provider_id FROM users WHERE id = $1 FOR UPDATE
+	`, userID).Scan(&primaryProvider, &primaryProviderID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrIdentityNotFound
+		}
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	var provider, providerID string
+	err = tx.QueryRow(ctx, `
+		DELETE FROM user_identities WHERE id = $1 AND user_id = $2
+		RETURNING provider, provider_id
+	`, identityID, userID).Scan(&provider, &providerID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrIdentityNotFound
+		}
+		return fmt.Errorf("failed to unlink identity: %w", err)
+	}
+
+	var nextProvider, nextProviderID string
+	err = tx.QueryRow(ctx, `
+		SELECT provider, provider_id FROM user_identities
+		WHERE user_id = $1
+		ORDER BY last_used_at DESC
+		LIMIT 1
+	`, userID).Scan(&nextProvider, &nextProviderID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrLastIdentity
+		}
+		return fmt.Errorf("failed to find remaining identity: %w", err)
+	}
+
+	if provider == primaryProvider && providerID == primaryProviderID {
+		if _, err := tx.Exec(ctx, `
+			UPDATE users SET provider = $1, provider_id = $2, updated_at = NOW()
+			WHERE id = $3
+		`, nextProvider, nextProviderID, userID); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
 func (s *UserService) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
 	var user models.User
 	err := s.db.Pool.QueryRow(ctx, `
@@ -75,11 +309,12 @@ func (s *UserService) GetByID(ctx context.Context, id uuid.UUID) (*models.User,
 	return &user, nil
 }
 
+// GetByEmail finds a user by email, ignoring case.
 func (s *UserService) GetByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
 	err := s.db.Pool.QueryRow(ctx, `
 		SELECT id, email, name, avatar_url, provider, provider_id, global_role, created_at, updated_at
-		FROM users WHERE email = $1
+		FROM users WHERE lower(email) = lower($1)
 	`, email).Scan(
 		&user.ID, &user.Email, &user.Name, &user.AvatarURL,
 		&user.Provider, &user.ProviderID, &user.GlobalRole, &user.CreatedAt, &user.UpdatedAt,
@@ -106,6 +341,12 @@ func (s *UserService) Update(ctx context.Context, id uuid.UUID, name string) (*m
 	return &user, nil
 }
 
+// NormalizeEmail returns the form emails are stored in where they are
+// looked up, such as sign-in links and email invites.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 func nullableString(s string) *string {
 	if s == "" {
 		return nil
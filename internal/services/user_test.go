@@ -37,19 +37,29 @@ func TestUserService_FindOrCreateFromOAuth_CreateNew(t *testing.T) {
 	userID := uuid.New()
 	now := time.Now()
 
-	// First query - user not found
-	mock.ExpectQuery(`SELECT .+ FROM users WHERE provider = .+ AND provider_id`).
+	// First query - identity not found
+	mock.ExpectQuery(`SELECT .+ FROM user_identities i JOIN users u .+ WHERE i.provider = .+ AND i.provider_id`).
 		WithArgs(info.Provider, info.ID).
 		WillReturnError(pgx.ErrNoRows)
 
-	// Insert new user
+	// No user with the email either
+	mock.ExpectQuery(`SELECT .+ FROM users WHERE lower\(email\) = lower\(\$1\)`).
+		WithArgs(info.Email).
+		WillReturnError(pgx.ErrNoRows)
+
+	// Insert new user with its identity
 	rows := pgxmock.NewRows([]string{
 		"id", "email", "name", "avatar_url", "provider", "provider_id", "global_role", "created_at", "updated_at",
 	}).AddRow(userID, info.Email, info.Name, &info.AvatarURL, info.Provider, info.ID, "user", now, now)
 
+	mock.ExpectBegin()
 	mock.ExpectQuery(`INSERT INTO users`).
 		WithArgs(info.Email, info.Name, &info.AvatarURL, info.Provider, info.ID).
 		WillReturnRows(rows)
+	mock.ExpectExec(`INSERT INTO user_identities`).
+		WithArgs(userID, info.Provider, info.ID, info.Email, false).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
 
 	user, err := svc.FindOrCreateFromOAuth(ctx, info)
 
@@ -60,6 +70,41 @@ func TestUserService_FindOrCreateFromOAuth_CreateNew(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestUserService_FindOrCreateFromOAuth_ClaimsEmailInvites(t *testing.T) {
+	svc, mock := setupUserService(t)
+	info := &oauth.UserInfo{Email: "grace@example.com", ID: "grace@example.com", Provider: "email", EmailVerified: true}
+	userID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT .+ FROM user_identities i JOIN users u`).
+		WithArgs(info.Provider, info.ID).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery(`SELECT .+ FROM users WHERE lower\(email\) = lower\(\$1\)`).
+		WithArgs(info.Email).
+		WillReturnError(pgx.ErrNoRows)
+
+	// Without a display name the user is named after their address
+	mock.ExpectBegin()
+	mock.ExpectQuery(`INSERT INTO users`).
+		WithArgs(info.Email, "grace", (*string)(nil), info.Provider, info.ID).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "email", "name", "avatar_url", "provider", "provider_id", "global_role", "created_at", "updated_at",
+		}).AddRow(userID, info.Email, "grace", (*string)(nil), info.Provider, info.ID, "user", now, now))
+	mock.ExpectExec(`INSERT INTO user_identities`).
+		WithArgs(userID, info.Provider, info.ID, info.Email, true).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(`WITH claimed AS \(\s+DELETE FROM workspace_email_invites`).
+		WithArgs(userID, info.Email, "pending").
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+
+	user, err := svc.FindOrCreateFromOAuth(context.Background(), info)
+
+	require.NoError(t, err)
+	assert.Equal(t, "grace", user.Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestUserService_FindOrCreateFromOAuth_FindExisting(t *testing.T) {
 	svc, mock := setupUserService(t)
 	ctx := context.Background()
@@ -79,10 +124,14 @@ func TestUserService_FindOrCreateFromOAuth_FindExisting(t *testing.T) {
 		"id", "email", "name", "avatar_url", "provider", "provider_id", "global_role", "created_at", "updated_at",
 	}).AddRow(userID, info.Email, info.Name, &avatarURL, info.Provider, info.ID, "user", now, now)
 
-	mock.ExpectQuery(`SELECT .+ FROM users WHERE provider = .+ AND provider_id`).
+	mock.ExpectQuery(`SELECT .+ FROM user_identities i JOIN users u .+ WHERE i.provider = .+ AND i.provider_id`).
 		WithArgs(info.Provider, info.ID).
 		WillReturnRows(rows)
 
+	mock.ExpectExec(`UPDATE user_identities SET email = .+, email_verified = .+, last_used_at`).
+		WithArgs(info.Email, false, info.Provider, info.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
 	user, err := svc.FindOrCreateFromOAuth(ctx, info)
 
 	require.NoError(t, err)
@@ -109,10 +158,14 @@ func TestUserService_FindOrCreateFromOAuth_UpdateExisting(t *testing.T) {
 		"id", "email", "name", "avatar_url", "provider", "provider_id", "global_role", "created_at", "updated_at",
 	}).AddRow(userID, "old@example.com", "Old Name", nil, info.Provider, info.ID, "user", now, now)
 
-	mock.ExpectQuery(`SELECT .+ FROM users WHERE provider = .+ AND provider_id`).
+	mock.ExpectQuery(`SELECT .+ FROM user_identities i JOIN users u .+ WHERE i.provider = .+ AND i.provider_id`).
 		WithArgs(info.Provider, info.ID).
 		WillReturnRows(rows)
 
+	mock.ExpectExec(`UPDATE user_identities SET email`).
+		WithArgs(info.Email, false, info.Provider, info.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
 	// Update triggered
 	mock.ExpectExec(`UPDATE users SET email = .+, name = .+, avatar_url`).
 		WithArgs(info.Email, info.Name, &info.AvatarURL, userID).
@@ -127,6 +180,213 @@ func TestUserService_FindOrCreateFromOAuth_UpdateExisting(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func userRows(userID uuid.UUID, email, provider, providerID string) *pgxmock.Rows {
+	now := time.Now()
+	return pgxmock.NewRows([]string{
+		"id", "email", "name", "avatar_url", "provider", "provider_id", "global_role", "created_at", "updated_at",
+	}).AddRow(userID, email, "Ada", nil, provider, providerID, "user", now, now)
+}
+
+func TestUserService_FindOrCreateFromOAuth_SecondaryIdentityKeepsProfile(t *testing.T) {
+	svc, mock := setupUserService(t)
+	info := &oauth.UserInfo{Email: "ada@work.example", Name: "Ada at Work", ID: "g-1", Provider: "google", EmailVerified: true}
+	userID := uuid.New()
+
+	// The user signed up with GitHub; a linked Google login doesn't overwrite the profile
+	mock.ExpectQuery(`SELECT .+ FROM user_identities i JOIN users u`).
+		WithArgs(info.Provider, info.ID).
+		WillReturnRows(userRows(userID, "ada@example.com", "github", "gh-1"))
+	mock.ExpectExec(`UPDATE user_identities SET email`).
+		WithArgs(info.Email, true, info.Provider, info.ID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectExec(`WITH claimed AS \(\s+DELETE FROM workspace_email_invites`).
+		WithArgs(userID, info.Email, "pending").
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+	user, err := svc.FindOrCreateFromOAuth(context.Background(), info)
+
+	require.NoError(t, err)
+	assert.Equal(t, "ada@example.com", user.Email)
+	assert.Equal(t, "Ada", user.Name)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_FindOrCreateFromOAuth_AutoLink(t *testing.T) {
+	svc, mock := setupUserService(t)
+	info := &oauth.UserInfo{Email: "ada@example.com", Name: "Ada", ID: "g-1", Provider: "google", EmailVerified: true}
+	userID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT .+ FROM user_identities i JOIN users u`).
+		WithArgs(info.Provider, info.ID).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectQuery(`SELECT .+ FROM users WHERE lower\(email\) = lower\(\$1\)`).
+		WithArgs(info.Email).
+		WillReturnRows(userRows(userID, info.Email, "github", "gh-1"))
+	mock.ExpectQuery(`SELECT EXISTS .+ FROM user_identities\s+WHERE user_id = .+ AND lower\(email\) = lower\(.+\) AND email_verified`).
+		WithArgs(userID, info.Email).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(`INSERT INTO user_identities .+ ON CONFLICT`).
+		WithArgs(userID, info.Provider, info.ID, info.Email, true).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "user_id", "provider", "provider_id", "email", "email_verified", "created_at", "last_used_at",
+		}).AddRow(uuid.New(), userID, info.Provider, info.ID, info.Email, true, now, now))
+	mock.ExpectExec(`WITH claimed AS \(\s+DELETE FROM workspace_email_invites`).
+		WithArgs(userID, info.Email, "pending").
+		WillReturnResult(pgxmock.NewResult("INSERT", 0))
+
+	user, err := svc.FindOrCreateFromOAuth(context.Background(), info)
+
+	require.NoError(t, err)
+	assert.Equal(t, userID, user.ID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_FindOrCreateFromOAuth_AutoLinkRefused(t *testing.T) {
+	tests := []struct {
+		name             string
+		newVerified      bool
+		existingVerified bool
+	}{
+		{"new provider unverified", false, true},
+		{"existing identity unverified", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, mock := setupUserService(t)
+			info := &oauth.UserInfo{Email: "ada@example.com", Name: "Ada", ID: "g-1", Provider: "google", EmailVerified: tt.newVerified}
+			userID := uuid.New()
+
+			mock.ExpectQuery(`SELECT .+ FROM user_identities i JOIN users u`).
+				WithArgs(info.Provider, info.ID).
+				WillReturnError(pgx.ErrNoRows)
+			mock.ExpectQuery(`SELECT .+ FROM users WHERE lower\(email\) = lower\(\$1\)`).
+				WithArgs(info.Email).
+				WillReturnRows(userRows(userID, info.Email, "github", "gh-1"))
+			if tt.newVerified {
+				mock.ExpectQuery(`SELECT EXISTS`).
+					WithArgs(userID, info.Email).
+					WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(tt.existingVerified))
+			}
+
+			user, err := svc.FindOrCreateFromOAuth(context.Background(), info)
+
+			assert.ErrorIs(t, err, ErrEmailInUse)
+			assert.Nil(t, user)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestUserService_LinkIdentity_LinkedToAnotherUser(t *testing.T) {
+	svc, mock := setupUserService(t)
+	info := &oauth.UserInfo{Email: "ada@example.com", ID: "g-1", Provider: "google"}
+	userID := uuid.New()
+
+	// The conflict update is skipped when the identity belongs to someone else
+	mock.ExpectQuery(`INSERT INTO user_identities .+ ON CONFLICT .+ WHERE user_identities.user_id = EXCLUDED.user_id`).
+		WithArgs(userID, info.Provider, info.ID, info.Email, false).
+		WillReturnError(pgx.ErrNoRows)
+
+	identity, err := svc.LinkIdentity(context.Background(), userID, info)
+
+	assert.ErrorIs(t, err, ErrIdentityLinked)
+	assert.Nil(t, identity)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_ListIdentities(t *testing.T) {
+	svc, mock := setupUserService(t)
+	userID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`SELECT .+ FROM user_identities\s+WHERE user_id = \$1\s+ORDER BY created_at`).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "user_id", "provider", "provider_id", "email", "email_verified", "created_at", "last_used_at",
+		}).
+			AddRow(uuid.New(), userID, "github", "gh-1", "ada@example.com", true, now, now).
+			AddRow(uuid.New(), userID, "google", "g-1", "ada@example.com", true, now, now))
+
+	identities, err := svc.ListIdentities(context.Background(), userID)
+
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+	assert.Equal(t, "github", identities[0].Provider)
+	assert.Equal(t, "google", identities[1].Provider)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_UnlinkIdentity_PromotesRemainingIdentity(t *testing.T) {
+	svc, mock := setupUserService(t)
+	userID := uuid.New()
+	identityID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT provider, provider_id FROM users WHERE id = \$1 FOR UPDATE`).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"provider", "provider_id"}).AddRow("github", "gh-1"))
+	mock.ExpectQuery(`DELETE FROM user_identities WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(identityID, userID).
+		WillReturnRows(pgxmock.NewRows([]string{"provider", "provider_id"}).AddRow("github", "gh-1"))
+	mock.ExpectQuery(`SELECT provider, provider_id FROM user_identities`).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"provider", "provider_id"}).AddRow("google", "g-1"))
+	mock.ExpectExec(`UPDATE users SET provider = \$1, provider_id = \$2`).
+		WithArgs("google", "g-1", userID).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	err := svc.UnlinkIdentity(context.Background(), userID, identityID)
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_UnlinkIdentity_LastIdentity(t *testing.T) {
+	svc, mock := setupUserService(t)
+	userID := uuid.New()
+	identityID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT provider, provider_id FROM users`).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"provider", "provider_id"}).AddRow("github", "gh-1"))
+	mock.ExpectQuery(`DELETE FROM user_identities`).
+		WithArgs(identityID, userID).
+		WillReturnRows(pgxmock.NewRows([]string{"provider", "provider_id"}).AddRow("github", "gh-1"))
+	mock.ExpectQuery(`SELECT provider, provider_id FROM user_identities`).
+		WithArgs(userID).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectRollback()
+
+	err := svc.UnlinkIdentity(context.Background(), userID, identityID)
+
+	assert.ErrorIs(t, err, ErrLastIdentity)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUserService_UnlinkIdentity_NotFound(t *testing.T) {
+	svc, mock := setupUserService(t)
+	userID := uuid.New()
+	identityID := uuid.New()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT provider, provider_id FROM users`).
+		WithArgs(userID).
+		WillReturnRows(pgxmock.NewRows([]string{"provider", "provider_id"}).AddRow("github", "gh-1"))
+	mock.ExpectQuery(`DELETE FROM user_identities`).
+		WithArgs(identityID, userID).
+		WillReturnError(pgx.ErrNoRows)
+	mock.ExpectRollback()
+
+	err := svc.UnlinkIdentity(context.Background(), userID, identityID)
+
+	assert.ErrorIs(t, err, ErrIdentityNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestUserService_GetByID(t *testing.T) {
 	svc, mock := setupUserService(t)
 	ctx := context.Background()
@@ -176,7 +436,7 @@ func TestUserService_GetByEmail(t *testing.T) {
 		"id", "email", "name", "avatar_url", "provider", "provider_id", "global_role", "created_at", "updated_at",
 	}).AddRow(userID, email, "Test User", nil, "github", "123", "user", now, now)
 
-	mock.ExpectQuery(`SELECT .+ FROM users WHERE email`).
+	mock.ExpectQuery(`SELECT .+ FROM users WHERE lower\(email\) = lower\(\$1\)`).
 		WithArgs(email).
 		WillReturnRows(rows)
 
@@ -193,7 +453,7 @@ func TestUserService_GetByEmail_NotFound(t *testing.T) {
 	ctx := context.Background()
 	email := "notfound@example.com"
 
-	mock.ExpectQuery(`SELECT .+ FROM users WHERE email`).
+	mock.ExpectQuery(`SELECT .+ FROM users WHERE lower\(email\) = lower\(\$1\)`).
 		WithArgs(email).
 		WillReturnError(pgx.ErrNoRows)
 
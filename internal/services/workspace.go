@@ -8,6 +8,7 @@ import (
 	"github.com/dimitrije/nikode-api/internal/database"
 	"github.com/dimitrije/nikode-api/internal/models"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 )
 
 var (
@@ -37,8 +38,8 @@ func (s *WorkspaceService) Create(ctx context.Context, name string, ownerID uuid
 	err = tx.QueryRow(ctx, `
 		INSERT INTO workspaces (name, owner_id)
 		VALUES ($1, $2)
-		RETURNING id, name, owner_id, created_at, updated_at
-	`, name, ownerID).Scan(&workspace.ID, &workspace.Name, &workspace.OwnerID, &workspace.CreatedAt, &workspace.UpdatedAt)
+		RETURNING id, name, owner_id, created_at, updated_at, require_2fa
+	`, name, ownerID).Scan(&workspace.ID, &workspace.Name, &workspace.OwnerID, &workspace.CreatedAt, &workspace.UpdatedAt, &workspace.RequireTwoFactor)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create workspace: %w", err)
 	}
@@ -61,9 +62,9 @@ func (s *WorkspaceService) Create(ctx context.Context, name string, ownerID uuid
 func (s *WorkspaceService) GetByID(ctx context.Context, workspaceID uuid.UUID) (*models.Workspace, error) {
 	var workspace models.Workspace
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT id, name, owner_id, created_at, updated_at
+		SELECT id, name, owner_id, created_at, updated_at, require_2fa
 		FROM workspaces WHERE id = $1
-	`, workspaceID).Scan(&workspace.ID, &workspace.Name, &workspace.OwnerID, &workspace.CreatedAt, &workspace.UpdatedAt)
+	`, workspaceID).Scan(&workspace.ID, &workspace.Name, &workspace.OwnerID, &workspace.CreatedAt, &workspace.UpdatedAt, &workspace.RequireTwoFactor)
 	if err != nil {
 		return nil, err
 	}
@@ -72,7 +73,7 @@ func (s *WorkspaceService) GetByID(ctx context.Context, workspaceID uuid.UUID) (
 
 func (s *WorkspaceService) GetUserWorkspaces(ctx context.Context, userID uuid.UUID) ([]models.Workspace, []string, error) {
 	rows, err := s.db.Pool.Query(ctx, `
-		SELECT w.id, w.name, w.owner_id, w.created_at, w.updated_at, wm.role
+		SELECT w.id, w.name, w.owner_id, w.created_at, w.updated_at, w.require_2fa, wm.role
 		FROM workspaces w
 		JOIN workspace_members wm ON w.id = wm.workspace_id
 		WHERE wm.user_id = $1
@@ -88,7 +89,7 @@ func (s *WorkspaceService) GetUserWorkspaces(ctx context.Context, userID uuid.UU
 	for rows.Next() {
 		var w models.Workspace
 		var role string
-		if err := rows.Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.UpdatedAt, &role); err != nil {
+		if err := rows.Scan(&w.ID, &w.Name, &w.OwnerID, &w.CreatedAt, &w.UpdatedAt, &w.RequireTwoFactor, &role); err != nil {
 			return nil, nil, err
 		}
 		workspaces = append(workspaces, w)
@@ -102,8 +103,29 @@ func (s *WorkspaceService) Update(ctx context.Context, workspaceID uuid.UUID, na
 	err := s.db.Pool.QueryRow(ctx, `
 		UPDATE workspaces SET name = $1, updated_at = NOW()
 		WHERE id = $2
-		RETURNING id, name, owner_id, created_at, updated_at
-	`, name, workspaceID).Scan(&workspace.ID, &workspace.Name, &workspace.OwnerID, &workspace.CreatedAt, &workspace.UpdatedAt)
+		RETURNING id, name, owner_id, created_at, updated_at, require_2fa
+	`, name, workspaceID).Scan(&workspace.ID, &workspace.Name, &workspace.OwnerID, &workspace.CreatedAt, &workspace.UpdatedAt, &workspace.RequireTwoFactor)
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// SetRequireTwoFactor turns the two-factor requirement of a workspace on or
+// off. Only an owner with two-factor authentication can turn it on, so they
+// don't lock themselves out.
+func (s *WorkspaceService) SetRequireTwoFactor(ctx context.Context, workspaceID uuid.UUID, require bool) (*models.Workspace, error) {
+	var workspace models.Workspace
+	err := s.db.Pool.QueryRow(ctx, `
+		UPDATE workspaces w SET require_2fa = $1, updated_at = NOW()
+		WHERE w.id = $2 AND (NOT $1 OR EXISTS(
+			SELECT 1 FROM user_totp t WHERE t.user_id = w.owner_id AND t.enabled_at IS NOT NULL
+		))
+		RETURNING id, name, owner_id, created_at, updated_at, require_2fa
+	`, require, workspaceID).Scan(&workspace.ID, &workspace.Name, &workspace.OwnerID, &workspace.CreatedAt, &workspace.UpdatedAt, &workspace.RequireTwoFactor)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTwoFactorRequired
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -132,8 +154,21 @@ func (s *WorkspaceService) IsMember(ctx context.Context, workspaceID, userID uui
 	return exists, err
 }
 
+// CanAccess reports whether a user can use a workspace: they must be a
+// member, and have two-factor authentication if the workspace requires it.
 func (s *WorkspaceService) CanAccess(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error) {
-	return s.IsMember(ctx, workspaceID, userID)
+	var canAccess bool
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM workspace_members wm
+			JOIN workspaces w ON w.id = wm.workspace_id
+			WHERE wm.workspace_id = $1 AND wm.user_id = $2
+			AND (NOT w.require_2fa OR EXISTS(
+				SELECT 1 FROM user_totp t WHERE t.user_id = wm.user_id AND t.enabled_at IS NOT NULL
+			))
+		)
+	`, workspaceID, userID).Scan(&canAccess)
+	return canAccess, err
 }
 
 func (s *WorkspaceService) CanModify(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error) {
@@ -226,6 +261,28 @@ func (s *WorkspaceService) CreateInvite(ctx context.Context, workspaceID, invite
 	return &invite, nil
 }
 
+// CreateEmailInvite invites an email address that has no account yet. The
+// invite becomes a regular pending invite when someone signs in with a
+// verified address matching it.
+func (s *WorkspaceService) CreateEmailInvite(ctx context.Context, workspaceID, inviterID uuid.UUID, email string) (*models.WorkspaceInvite, error) {
+	invite := models.WorkspaceInvite{Status: models.InviteStatusPending}
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO workspace_email_invites (workspace_id, inviter_id, email)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (workspace_id, email) DO UPDATE SET
+			inviter_id = EXCLUDED.inviter_id,
+			updated_at = NOW()
+		RETURNING id, workspace_id, inviter_id, email, created_at, updated_at
+	`, workspaceID, inviterID, email).Scan(
+		&invite.ID, &invite.WorkspaceID, &invite.InviterID, &invite.InviteeEmail,
+		&invite.CreatedAt, &invite.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invite: %w", err)
+	}
+	return &invite, nil
+}
+
 func (s *WorkspaceService) GetInviteByID(ctx context.Context, inviteID uuid.UUID) (*models.WorkspaceInvite, error) {
 	var invite models.WorkspaceInvite
 	err := s.db.Pool.QueryRow(ctx, `
@@ -342,7 +399,32 @@ func (s *WorkspaceService) GetWorkspacePendingInvites(ctx context.Context, works
 		invite.Invitee = &invitee
 		invites = append(invites, invite)
 	}
-	return invites, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	emailRows, err := s.db.Pool.Query(ctx, `
+		SELECT id, workspace_id, inviter_id, email, created_at, updated_at
+		FROM workspace_email_invites
+		WHERE workspace_id = $1
+		ORDER BY created_at DESC
+	`, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer emailRows.Close()
+
+	for emailRows.Next() {
+		invite := models.WorkspaceInvite{Status: models.InviteStatusPending}
+		if err := emailRows.Scan(
+			&invite.ID, &invite.WorkspaceID, &invite.InviterID, &invite.InviteeEmail,
+			&invite.CreatedAt, &invite.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		invites = append(invites, invite)
+	}
+	return invites, emailRows.Err()
 }
 
 func (s *WorkspaceService) AcceptInvite(ctx context.Context, inviteID, userID uuid.UUID) error {
@@ -408,6 +490,16 @@ func (s *WorkspaceService) CancelInvite(ctx context.Context, inviteID, workspace
 	if err != nil {
 		return err
 	}
+	if result.RowsAffected() > 0 {
+		return nil
+	}
+
+	result, err = s.db.Pool.Exec(ctx, `
+		DELETE FROM workspace_email_invites WHERE id = $1 AND workspace_id = $2
+	`, inviteID, workspaceID)
+	if err != nil {
+		return err
+	}
 	if result.RowsAffected() == 0 {
 		return ErrInviteNotFound
 	}
@@ -33,8 +33,8 @@ func TestWorkspaceService_Create(t *testing.T) {
 
 	mock.ExpectBegin()
 
-	rows := pgxmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at"}).
-		AddRow(workspaceID, name, ownerID, now, now)
+	rows := pgxmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at", "require_2fa"}).
+		AddRow(workspaceID, name, ownerID, now, now, false)
 	mock.ExpectQuery(`INSERT INTO workspaces \(name, owner_id\)`).
 		WithArgs(name, ownerID).
 		WillReturnRows(rows)
@@ -61,8 +61,8 @@ func TestWorkspaceService_GetByID(t *testing.T) {
 	ownerID := uuid.New()
 	now := time.Now()
 
-	rows := pgxmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at"}).
-		AddRow(workspaceID, "Test Workspace", ownerID, now, now)
+	rows := pgxmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at", "require_2fa"}).
+		AddRow(workspaceID, "Test Workspace", ownerID, now, now, false)
 
 	mock.ExpectQuery(`SELECT .+ FROM workspaces WHERE id`).
 		WithArgs(workspaceID).
@@ -98,9 +98,9 @@ func TestWorkspaceService_GetUserWorkspaces(t *testing.T) {
 	ws2ID := uuid.New()
 	now := time.Now()
 
-	rows := pgxmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at", "role"}).
-		AddRow(ws1ID, "Workspace 1", userID, now, now, "owner").
-		AddRow(ws2ID, "Workspace 2", uuid.New(), now, now, "member")
+	rows := pgxmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at", "require_2fa", "role"}).
+		AddRow(ws1ID, "Workspace 1", userID, now, now, false, "owner").
+		AddRow(ws2ID, "Workspace 2", uuid.New(), now, now, true, "member")
 
 	mock.ExpectQuery(`SELECT .+ FROM workspaces w JOIN workspace_members`).
 		WithArgs(userID).
@@ -124,8 +124,8 @@ func TestWorkspaceService_Update(t *testing.T) {
 	newName := "Updated Workspace"
 	now := time.Now()
 
-	rows := pgxmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at"}).
-		AddRow(workspaceID, newName, ownerID, now, now)
+	rows := pgxmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at", "require_2fa"}).
+		AddRow(workspaceID, newName, ownerID, now, now, false)
 
 	mock.ExpectQuery(`UPDATE workspaces SET name`).
 		WithArgs(newName, workspaceID).
@@ -188,3 +188,110 @@ func TestWorkspaceService_IsMember(t *testing.T) {
 	assert.True(t, isMember)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
+
+func TestWorkspaceService_CanAccess_RequiresTwoFactor(t *testing.T) {
+	svc, mock := setupWorkspaceService(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	userID := uuid.New()
+
+	mock.ExpectQuery(`SELECT EXISTS\(.*workspace_members.*require_2fa.*user_totp`).
+		WithArgs(workspaceID, userID).
+		WillReturnRows(pgxmock.NewRows([]string{"exists"}).AddRow(false))
+
+	canAccess, err := svc.CanAccess(ctx, workspaceID, userID)
+
+	require.NoError(t, err)
+	assert.False(t, canAccess)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkspaceService_SetRequireTwoFactor(t *testing.T) {
+	svc, mock := setupWorkspaceService(t)
+	ctx := context.Background()
+	workspaceID := uuid.New()
+	ownerID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`UPDATE workspaces w SET require_2fa`).
+		WithArgs(true, workspaceID).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "name", "owner_id", "created_at", "updated_at", "require_2fa"}).
+			AddRow(workspaceID, "Secure", ownerID, now, now, true))
+
+	ws, err := svc.SetRequireTwoFactor(ctx, workspaceID, true)
+
+	require.NoError(t, err)
+	assert.True(t, ws.RequireTwoFactor)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkspaceService_SetRequireTwoFactor_OwnerWithoutTwoFactor(t *testing.T) {
+	svc, mock := setupWorkspaceService(t)
+	workspaceID := uuid.New()
+
+	mock.ExpectQuery(`UPDATE workspaces w SET require_2fa`).
+		WithArgs(true, workspaceID).
+		WillReturnError(pgx.ErrNoRows)
+
+	_, err := svc.SetRequireTwoFactor(context.Background(), workspaceID, true)
+
+	assert.ErrorIs(t, err, ErrTwoFactorRequired)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkspaceService_CreateEmailInvite(t *testing.T) {
+	svc, mock := setupWorkspaceService(t)
+	workspaceID := uuid.New()
+	inviterID := uuid.New()
+	inviteID := uuid.New()
+	now := time.Now()
+
+	mock.ExpectQuery(`INSERT INTO workspace_email_invites .+ ON CONFLICT \(workspace_id, email\) DO UPDATE`).
+		WithArgs(workspaceID, inviterID, "grace@example.com").
+		WillReturnRows(pgxmock.NewRows([]string{"id", "workspace_id", "inviter_id", "email", "created_at", "updated_at"}).
+			AddRow(inviteID, workspaceID, inviterID, "grace@example.com", now, now))
+
+	invite, err := svc.CreateEmailInvite(context.Background(), workspaceID, inviterID, "grace@example.com")
+
+	require.NoError(t, err)
+	assert.Equal(t, inviteID, invite.ID)
+	assert.Equal(t, "grace@example.com", invite.InviteeEmail)
+	assert.Equal(t, "pending", invite.Status)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkspaceService_CancelInvite_EmailInvite(t *testing.T) {
+	svc, mock := setupWorkspaceService(t)
+	inviteID := uuid.New()
+	workspaceID := uuid.New()
+
+	mock.ExpectExec(`DELETE FROM workspace_invites WHERE id`).
+		WithArgs(inviteID, workspaceID, "pending").
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`DELETE FROM workspace_email_invites WHERE id`).
+		WithArgs(inviteID, workspaceID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	err := svc.CancelInvite(context.Background(), inviteID, workspaceID)
+
+	require.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWorkspaceService_CancelInvite_NotFound(t *testing.T) {
+	svc, mock := setupWorkspaceService(t)
+	inviteID := uuid.New()
+	workspaceID := uuid.New()
+
+	mock.ExpectExec(`DELETE FROM workspace_invites WHERE id`).
+		WithArgs(inviteID, workspaceID, "pending").
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+	mock.ExpectExec(`DELETE FROM workspace_email_invites WHERE id`).
+		WithArgs(inviteID, workspaceID).
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	err := svc.CancelInvite(context.Background(), inviteID, workspaceID)
+
+	assert.ErrorIs(t, err, ErrInviteNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -9,22 +9,72 @@ import (
 type CreateAPIKeyRequest struct {
 	Name      string     `json:"name"`
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Scopes defaults to collections:read and collections:write
+	Scopes        []string    `json:"scopes,omitempty"`
+	CollectionIDs []uuid.UUID `json:"collection_ids,omitempty"`
+	AllowedCIDRs  []string    `json:"allowed_cidrs,omitempty"`
+	// Rate limits default to 120 requests per minute with a burst of 60
+	RateLimitPerMinute *int `json:"rate_limit_per_minute,omitempty"`
+	RateLimitBurst     *int `json:"rate_limit_burst,omitempty"`
+}
+
+type UpdateAPIKeyRequest struct {
+	RateLimitPerMinute *int `json:"rate_limit_per_minute,omitempty"`
+	RateLimitBurst     *int `json:"rate_limit_burst,omitempty"`
 }
 
 type APIKeyResponse struct {
-	ID        uuid.UUID  `json:"id"`
-	Name      string     `json:"name"`
-	KeyPrefix string     `json:"key_prefix"`
-	ExpiresAt *string    `json:"expires_at,omitempty"`
-	CreatedAt string     `json:"created_at"`
-	LastUsedAt *string   `json:"last_used_at,omitempty"`
+	ID                 uuid.UUID   `json:"id"`
+	Name               string      `json:"name"`
+	KeyPrefix          string      `json:"key_prefix"`
+	ExpiresAt          *string     `json:"expires_at,omitempty"`
+	CreatedAt          string      `json:"created_at"`
+	LastUsedAt         *string     `json:"last_used_at,omitempty"`
+	Scopes             []string    `json:"scopes"`
+	CollectionIDs      []uuid.UUID `json:"collection_ids,omitempty"`
+	AllowedCIDRs       []string    `json:"allowed_cidrs,omitempty"`
+	ReplacedBy         *uuid.UUID  `json:"replaced_by,omitempty"`
+	RateLimitPerMinute int         `json:"rate_limit_per_minute"`
+	RateLimitBurst     int         `json:"rate_limit_burst"`
 }
 
 type APIKeyCreatedResponse struct {
-	ID        uuid.UUID  `json:"id"`
-	Name      string     `json:"name"`
-	Key       string     `json:"key"`
-	KeyPrefix string     `json:"key_prefix"`
-	ExpiresAt *string    `json:"expires_at,omitempty"`
-	CreatedAt string     `json:"created_at"`
+	ID                 uuid.UUID   `json:"id"`
+	Name               string      `json:"name"`
+	Key                string      `json:"key"`
+	KeyPrefix          string      `json:"key_prefix"`
+	ExpiresAt          *string     `json:"expires_at,omitempty"`
+	CreatedAt          string      `json:"created_at"`
+	Scopes             []string    `json:"scopes"`
+	CollectionIDs      []uuid.UUID `json:"collection_ids,omitempty"`
+	AllowedCIDRs       []string    `json:"allowed_cidrs,omitempty"`
+	RateLimitPerMinute int         `json:"rate_limit_per_minute"`
+	RateLimitBurst     int         `json:"rate_limit_burst"`
+}
+
+type RotateAPIKeyRequest struct {
+	// GracePeriodSeconds keeps the old key valid after rotation
+	// (default: 86400, 0 revokes it immediately)
+	GracePeriodSeconds *int64 `json:"grace_period_seconds,omitempty"`
+}
+
+type RotateAPIKeyResponse struct {
+	Key      APIKeyCreatedResponse `json:"key"`
+	Previous APIKeyResponse        `json:"previous"`
+}
+
+type APIKeyUsageEntry struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Status    int    `json:"status"`
+	IP        string `json:"ip"`
+	LatencyMs int    `json:"latency_ms"`
+	CreatedAt string `json:"created_at"`
+}
+
+type APIKeyUsageResponse struct {
+	KeyID              uuid.UUID          `json:"key_id"`
+	RateLimitPerMinute int                `json:"rate_limit_per_minute"`
+	RateLimitBurst     int                `json:"rate_limit_burst"`
+	Entries            []APIKeyUsageEntry `json:"entries"`
 }
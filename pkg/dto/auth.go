@@ -15,5 +15,36 @@ type RefreshTokenRequest struct {
 }
 
 type ExchangeCodeRequest struct {
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type DeviceCodeResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+type DeviceTokenRequest struct {
+	DeviceCode string `json:"device_code"`
+	DeviceName string `json:"device_name,omitempty"`
+}
+
+// VerifyTwoFactorRequest completes a login that redirected with a
+// two_factor challenge. Code is a TOTP code or a recovery code.
+type VerifyTwoFactorRequest struct {
+	Token string `json:"token"`
+	Code  string `json:"code"`
+}
+
+// VerifyTwoFactorResponse carries the auth code to trade at /auth/exchange
+type VerifyTwoFactorResponse struct {
 	Code string `json:"code"`
 }
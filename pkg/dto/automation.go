@@ -11,6 +11,8 @@ type UpsertCollectionRequest struct {
 	CollectionID string          `json:"collection_id,omitempty"`
 	Resolution   string          `json:"resolution,omitempty"` // "force", "clone", "fail" (default: "force")
 	Spec         json.RawMessage `json:"spec"`
+	// SelectionDepth limits nested selections in generated GraphQL queries (default: 3)
+	SelectionDepth int `json:"selection_depth,omitempty"`
 }
 
 type UpsertCollectionResponse struct {
@@ -20,3 +22,32 @@ type UpsertCollectionResponse struct {
 	Version     int       `json:"version"`
 	Created     bool      `json:"created"`
 }
+
+// BatchUpsertSpec is a manifest entry of a batch upsert. File names the spec
+// in the upload or archive; the other fields are as in UpsertCollectionRequest.
+type BatchUpsertSpec struct {
+	File           string `json:"file"`
+	Name           string `json:"name,omitempty"`
+	CollectionID   string `json:"collection_id,omitempty"`
+	Resolution     string `json:"resolution,omitempty"`
+	SelectionDepth int    `json:"selection_depth,omitempty"`
+}
+
+type BatchUpsertResult struct {
+	File    string     `json:"file"`
+	ID      *uuid.UUID `json:"id,omitempty"`
+	Name    string     `json:"name,omitempty"`
+	Version int        `json:"version,omitempty"`
+	Created bool       `json:"created"`
+	// Status and Error are set for specs that were rejected
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type BatchUpsertResponse struct {
+	WorkspaceID uuid.UUID `json:"workspace_id"`
+	// Applied is false when any spec was rejected, in which case nothing
+	// was written
+	Applied bool                `json:"applied"`
+	Results []BatchUpsertResult `json:"results"`
+}
@@ -24,4 +24,35 @@ type CollectionResponse struct {
 	Data        json.RawMessage `json:"data"`
 	Version     int             `json:"version"`
 	UpdatedBy   *uuid.UUID      `json:"updated_by,omitempty"`
+	// UpdatedByActor is the user or API key that made the last change
+	UpdatedByActor *Actor `json:"updated_by_actor,omitempty"`
+}
+
+// Actor is a user or, for automation, an API key
+type Actor struct {
+	Type string    `json:"type"` // "user" or "api_key"
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name,omitempty"`
+}
+
+type ImportCollectionRequest struct {
+	Name         string          `json:"name,omitempty"`
+	CollectionID string          `json:"collection_id,omitempty"`
+	Spec         json.RawMessage `json:"spec"`
+	// SelectionDepth limits nested selections in generated GraphQL queries (default: 3)
+	SelectionDepth int `json:"selection_depth,omitempty"`
+}
+
+type EnvironmentVariable struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Enabled bool   `json:"enabled"`
+	Secret  bool   `json:"secret,omitempty"`
+}
+
+type EnvironmentResponse struct {
+	CollectionID uuid.UUID             `json:"collection_id"`
+	ID           string                `json:"id"`
+	Name         string                `json:"name"`
+	Variables    []EnvironmentVariable `json:"variables"`
 }
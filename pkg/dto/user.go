@@ -1,6 +1,10 @@
 package dto
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type UserResponse struct {
 	ID         uuid.UUID `json:"id"`
@@ -14,3 +18,68 @@ type UserResponse struct {
 type UpdateUserRequest struct {
 	Name string `json:"name"`
 }
+
+type UserIdentityResponse struct {
+	ID            uuid.UUID `json:"id"`
+	Provider      string    `json:"provider"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	CreatedAt     string    `json:"created_at"`
+	LastUsedAt    string    `json:"last_used_at"`
+}
+
+type SessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  string    `json:"created_at"`
+	LastUsedAt string    `json:"last_used_at"`
+	Current    bool      `json:"current"`
+}
+
+type CreatePersonalAccessTokenRequest struct {
+	Name      string     `json:"name"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Scopes defaults to read
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+type PersonalAccessTokenResponse struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	TokenPrefix string    `json:"token_prefix"`
+	Scopes      []string  `json:"scopes"`
+	ExpiresAt   *string   `json:"expires_at,omitempty"`
+	LastUsedAt  *string   `json:"last_used_at,omitempty"`
+	CreatedAt   string    `json:"created_at"`
+}
+
+// PersonalAccessTokenCreatedResponse includes the token, which is only
+// shown once
+type PersonalAccessTokenCreatedResponse struct {
+	PersonalAccessTokenResponse
+	Token string `json:"token"`
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recovery_codes_left"`
+}
+
+// TwoFactorEnrollmentResponse is shown as a QR code of OTPAuthURL, with the
+// secret for manual entry
+type TwoFactorEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURL string `json:"otpauth_url"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code or a recovery code
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// RecoveryCodesResponse lists new recovery codes, which are only shown once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
@@ -7,7 +7,8 @@ type CreateWorkspaceRequest struct {
 }
 
 type UpdateWorkspaceRequest struct {
-	Name string `json:"name"`
+	Name             string `json:"name"`
+	RequireTwoFactor *bool  `json:"require_2fa,omitempty"`
 }
 
 type InviteMemberRequest struct {
@@ -19,6 +20,8 @@ type WorkspaceResponse struct {
 	Name    string    `json:"name"`
 	OwnerID uuid.UUID `json:"owner_id"`
 	Role    string    `json:"role"`
+	// RequireTwoFactor keeps members without two-factor authentication out
+	RequireTwoFactor bool `json:"require_2fa"`
 }
 
 type WorkspaceMemberResponse struct {
@@ -36,4 +39,6 @@ type WorkspaceInviteResponse struct {
 	Workspace   *WorkspaceResponse `json:"workspace,omitempty"`
 	Inviter     *UserResponse      `json:"inviter,omitempty"`
 	Invitee     *UserResponse      `json:"invitee,omitempty"`
+	// InviteeEmail is set for invites to people without an account
+	InviteeEmail string `json:"invitee_email,omitempty"`
 }
@@ -7,6 +7,7 @@ import (
 
 	"github.com/dimitrije/nikode-api/internal/services"
 	"github.com/dimitrije/nikode-api/tests/testutil"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,17 +23,20 @@ func TestTokenService_Integration_StoreAndValidate(t *testing.T) {
 	ctx := context.Background()
 
 	user := fixtures.CreateUser(t)
+	session, err := svc.CreateSession(ctx, user.ID, "Laptop", "test-agent", "192.0.2.1")
+	require.NoError(t, err)
 	tokenHash := services.HashToken("my-refresh-token")
 	expiresAt := time.Now().Add(24 * time.Hour)
 
 	// Store token
-	err := svc.StoreRefreshToken(ctx, user.ID, tokenHash, expiresAt)
+	err = svc.StoreRefreshToken(ctx, user.ID, session.ID, tokenHash, expiresAt)
 	require.NoError(t, err)
 
 	// Validate token
-	userID, err := svc.ValidateRefreshToken(ctx, tokenHash)
+	userID, sessionID, err := svc.ValidateRefreshToken(ctx, tokenHash)
 	require.NoError(t, err)
 	assert.Equal(t, user.ID, userID)
+	assert.Equal(t, session.ID, sessionID)
 }
 
 func TestTokenService_Integration_ValidateExpired(t *testing.T) {
@@ -46,15 +50,17 @@ func TestTokenService_Integration_ValidateExpired(t *testing.T) {
 	ctx := context.Background()
 
 	user := fixtures.CreateUser(t)
+	session, err := svc.CreateSession(ctx, user.ID, "Laptop", "test-agent", "192.0.2.1")
+	require.NoError(t, err)
 	tokenHash := services.HashToken("expired-token")
 	expiresAt := time.Now().Add(-1 * time.Hour) // Already expired
 
 	// Store expired token
-	err := svc.StoreRefreshToken(ctx, user.ID, tokenHash, expiresAt)
+	err = svc.StoreRefreshToken(ctx, user.ID, session.ID, tokenHash, expiresAt)
 	require.NoError(t, err)
 
 	// Validate should fail
-	_, err = svc.ValidateRefreshToken(ctx, tokenHash)
+	_, _, err = svc.ValidateRefreshToken(ctx, tokenHash)
 	assert.Error(t, err)
 }
 
@@ -69,10 +75,12 @@ func TestTokenService_Integration_RevokeRefreshToken(t *testing.T) {
 	ctx := context.Background()
 
 	user := fixtures.CreateUser(t)
+	session, err := svc.CreateSession(ctx, user.ID, "Laptop", "test-agent", "192.0.2.1")
+	require.NoError(t, err)
 	tokenHash := services.HashToken("to-be-revoked")
 	expiresAt := time.Now().Add(24 * time.Hour)
 
-	err := svc.StoreRefreshToken(ctx, user.ID, tokenHash, expiresAt)
+	err = svc.StoreRefreshToken(ctx, user.ID, session.ID, tokenHash, expiresAt)
 	require.NoError(t, err)
 
 	// Revoke
@@ -80,7 +88,7 @@ func TestTokenService_Integration_RevokeRefreshToken(t *testing.T) {
 	require.NoError(t, err)
 
 	// Validate should fail
-	_, err = svc.ValidateRefreshToken(ctx, tokenHash)
+	_, _, err = svc.ValidateRefreshToken(ctx, tokenHash)
 	assert.Error(t, err)
 }
 
@@ -95,26 +103,29 @@ func TestTokenService_Integration_RevokeAllUserTokens(t *testing.T) {
 	ctx := context.Background()
 
 	user := fixtures.CreateUser(t)
+	session, err := svc.CreateSession(ctx, user.ID, "Laptop", "test-agent", "192.0.2.1")
+	require.NoError(t, err)
 	expiresAt := time.Now().Add(24 * time.Hour)
 
 	// Store multiple tokens
-	err := svc.StoreRefreshToken(ctx, user.ID, services.HashToken("token-1"), expiresAt)
+	err = svc.StoreRefreshToken(ctx, user.ID, session.ID, services.HashToken("token-1"), expiresAt)
 	require.NoError(t, err)
-	err = svc.StoreRefreshToken(ctx, user.ID, services.HashToken("token-2"), expiresAt)
+	err = svc.StoreRefreshToken(ctx, user.ID, session.ID, services.HashToken("token-2"), expiresAt)
 	require.NoError(t, err)
-	err = svc.StoreRefreshToken(ctx, user.ID, services.HashToken("token-3"), expiresAt)
+	err = svc.StoreRefreshToken(ctx, user.ID, session.ID, services.HashToken("token-3"), expiresAt)
 	require.NoError(t, err)
 
 	// Revoke all
-	err = svc.RevokeAllUserTokens(ctx, user.ID)
+	revoked, err := svc.RevokeAllUserTokens(ctx, user.ID)
 	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{session.ID}, revoked)
 
 	// All should be invalid
-	_, err = svc.ValidateRefreshToken(ctx, services.HashToken("token-1"))
+	_, _, err = svc.ValidateRefreshToken(ctx, services.HashToken("token-1"))
 	assert.Error(t, err)
-	_, err = svc.ValidateRefreshToken(ctx, services.HashToken("token-2"))
+	_, _, err = svc.ValidateRefreshToken(ctx, services.HashToken("token-2"))
 	assert.Error(t, err)
-	_, err = svc.ValidateRefreshToken(ctx, services.HashToken("token-3"))
+	_, _, err = svc.ValidateRefreshToken(ctx, services.HashToken("token-3"))
 	assert.Error(t, err)
 }
 
@@ -129,13 +140,15 @@ func TestTokenService_Integration_CleanupExpired(t *testing.T) {
 	ctx := context.Background()
 
 	user := fixtures.CreateUser(t)
+	session, err := svc.CreateSession(ctx, user.ID, "Laptop", "test-agent", "192.0.2.1")
+	require.NoError(t, err)
 
 	// Store expired token
-	err := svc.StoreRefreshToken(ctx, user.ID, services.HashToken("expired"), time.Now().Add(-1*time.Hour))
+	err = svc.StoreRefreshToken(ctx, user.ID, session.ID, services.HashToken("expired"), time.Now().Add(-1*time.Hour))
 	require.NoError(t, err)
 
 	// Store valid token
-	err = svc.StoreRefreshToken(ctx, user.ID, services.HashToken("valid"), time.Now().Add(24*time.Hour))
+	err = svc.StoreRefreshToken(ctx, user.ID, session.ID, services.HashToken("valid"), time.Now().Add(24*time.Hour))
 	require.NoError(t, err)
 
 	// Cleanup
@@ -143,7 +156,55 @@ func TestTokenService_Integration_CleanupExpired(t *testing.T) {
 	require.NoError(t, err)
 
 	// Valid token should still work
-	userID, err := svc.ValidateRefreshToken(ctx, services.HashToken("valid"))
+	userID, _, err := svc.ValidateRefreshToken(ctx, services.HashToken("valid"))
 	require.NoError(t, err)
 	assert.Equal(t, user.ID, userID)
 }
+
+func TestTokenService_Integration_Sessions(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	tdb := setupTest(t)
+	fixtures := testutil.NewFixtures(tdb.DB)
+	svc := services.NewTokenService(tdb.DB)
+	ctx := context.Background()
+
+	user := fixtures.CreateUser(t)
+	other := fixtures.CreateUser(t)
+	expiresAt := time.Now().Add(24 * time.Hour)
+
+	laptop, err := svc.CreateSession(ctx, user.ID, "Laptop", "Electron", "192.0.2.1")
+	require.NoError(t, err)
+	require.NoError(t, svc.StoreRefreshToken(ctx, user.ID, laptop.ID, services.HashToken("laptop"), expiresAt))
+	cli, err := svc.CreateSession(ctx, user.ID, "CI runner", "nikode-cli", "198.51.100.7")
+	require.NoError(t, err)
+	require.NoError(t, svc.StoreRefreshToken(ctx, user.ID, cli.ID, services.HashToken("cli"), expiresAt))
+
+	require.NoError(t, svc.TouchSession(ctx, laptop.ID, "Electron/2", "192.0.2.2"))
+
+	sessions, err := svc.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	assert.Equal(t, laptop.ID, sessions[0].ID)
+	assert.Equal(t, "192.0.2.2", sessions[0].IPAddress)
+
+	// Sessions can only be revoked by their owner
+	assert.ErrorIs(t, svc.RevokeSession(ctx, other.ID, cli.ID), services.ErrSessionNotFound)
+
+	require.NoError(t, svc.RevokeSession(ctx, user.ID, cli.ID))
+	_, _, err = svc.ValidateRefreshToken(ctx, services.HashToken("cli"))
+	assert.Error(t, err)
+	active, err := svc.IsSessionActive(ctx, cli.ID)
+	require.NoError(t, err)
+	assert.False(t, active)
+
+	// Logging out with a refresh token ends its session
+	revokedID, err := svc.RevokeSessionByToken(ctx, services.HashToken("laptop"))
+	require.NoError(t, err)
+	assert.Equal(t, laptop.ID, revokedID)
+	sessions, err = svc.ListSessions(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
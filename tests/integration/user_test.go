@@ -177,3 +177,44 @@ func TestUserService_Integration_Update(t *testing.T) {
 	assert.Equal(t, created.ID, updated.ID)
 	assert.Equal(t, "New Name", updated.Name)
 }
+
+func TestUserService_Integration_AccountLinking(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+
+	tdb := setupTest(t)
+	svc := services.NewUserService(tdb.DB)
+	ctx := context.Background()
+
+	github := &oauth.UserInfo{Email: "linked@example.com", Name: "Linked", ID: "github-55555", Provider: "github"}
+	created, err := svc.FindOrCreateFromOAuth(ctx, github)
+	require.NoError(t, err)
+
+	// The GitHub email isn't verified yet, so Google can't take over the account
+	google := &oauth.UserInfo{Email: "linked@example.com", Name: "Linked", ID: "google-55555", Provider: "google", EmailVerified: true}
+	_, err = svc.FindOrCreateFromOAuth(ctx, google)
+	assert.ErrorIs(t, err, services.ErrEmailInUse)
+
+	// Once both providers verified the email the identities are linked
+	github.EmailVerified = true
+	_, err = svc.FindOrCreateFromOAuth(ctx, github)
+	require.NoError(t, err)
+
+	linked, err := svc.FindOrCreateFromOAuth(ctx, google)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, linked.ID)
+
+	identities, err := svc.ListIdentities(ctx, created.ID)
+	require.NoError(t, err)
+	require.Len(t, identities, 2)
+
+	// Unlinking the sign-up identity moves the profile to the remaining one
+	require.NoError(t, svc.UnlinkIdentity(ctx, created.ID, identities[0].ID))
+	user, err := svc.GetByID(ctx, created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "google", user.Provider)
+
+	err = svc.UnlinkIdentity(ctx, created.ID, identities[1].ID)
+	assert.ErrorIs(t, err, services.ErrLastIdentity)
+}
@@ -53,6 +53,14 @@ func (f *Fixtures) CreateUser(t *testing.T, opts ...UserOption) *models.User {
 		t.Fatalf("failed to create user: %v", err)
 	}
 
+	_, err = f.db.Pool.Exec(ctx, `
+		INSERT INTO user_identities (user_id, provider, provider_id, email)
+		VALUES ($1, $2, $3, $4)
+	`, user.ID, user.Provider, user.ProviderID, user.Email)
+	if err != nil {
+		t.Fatalf("failed to create user identity: %v", err)
+	}
+
 	return user
 }
 
@@ -32,7 +32,7 @@ func GenerateTestToken(t *testing.T, userID uuid.UUID, email string) string {
 func GenerateTestTokenWithRole(t *testing.T, userID uuid.UUID, email, globalRole string) string {
 	t.Helper()
 	jwtSvc := TestJWTService()
-	pair, err := jwtSvc.GenerateTokenPair(userID, email, globalRole)
+	pair, err := jwtSvc.GenerateTokenPair(userID, uuid.Nil, email, globalRole)
 	if err != nil {
 		t.Fatalf("failed to generate test token: %v", err)
 	}
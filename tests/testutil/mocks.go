@@ -54,6 +54,29 @@ func (m *MockUserService) Update(ctx context.Context, id uuid.UUID, name string)
 	return user, args.Error(1)
 }
 
+func (m *MockUserService) ListIdentities(ctx context.Context, userID uuid.UUID) ([]models.UserIdentity, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	identities, _ := args.Get(0).([]models.UserIdentity)
+	return identities, args.Error(1)
+}
+
+func (m *MockUserService) LinkIdentity(ctx context.Context, userID uuid.UUID, info *oauth.UserInfo) (*models.UserIdentity, error) {
+	args := m.Called(ctx, userID, info)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	identity, _ := args.Get(0).(*models.UserIdentity)
+	return identity, args.Error(1)
+}
+
+func (m *MockUserService) UnlinkIdentity(ctx context.Context, userID, identityID uuid.UUID) error {
+	args := m.Called(ctx, userID, identityID)
+	return args.Error(0)
+}
+
 // MockWorkspaceService mocks the WorkspaceService
 type MockWorkspaceService struct {
 	mock.Mock
@@ -88,6 +111,14 @@ func (m *MockWorkspaceService) Update(ctx context.Context, workspaceID uuid.UUID
 	return args.Get(0).(*models.Workspace), args.Error(1)
 }
 
+func (m *MockWorkspaceService) SetRequireTwoFactor(ctx context.Context, workspaceID uuid.UUID, require bool) (*models.Workspace, error) {
+	args := m.Called(ctx, workspaceID, require)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Workspace), args.Error(1)
+}
+
 func (m *MockWorkspaceService) Delete(ctx context.Context, workspaceID uuid.UUID) error {
 	args := m.Called(ctx, workspaceID)
 	return args.Error(0)
@@ -98,11 +129,6 @@ func (m *MockWorkspaceService) IsOwner(ctx context.Context, workspaceID, userID
 	return args.Bool(0), args.Error(1)
 }
 
-func (m *MockWorkspaceService) IsMember(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error) {
-	args := m.Called(ctx, workspaceID, userID)
-	return args.Bool(0), args.Error(1)
-}
-
 func (m *MockWorkspaceService) CanAccess(ctx context.Context, workspaceID, userID uuid.UUID) (bool, error) {
 	args := m.Called(ctx, workspaceID, userID)
 	return args.Bool(0), args.Error(1)
@@ -136,6 +162,14 @@ func (m *MockWorkspaceService) CreateInvite(ctx context.Context, workspaceID, in
 	return args.Get(0).(*models.WorkspaceInvite), args.Error(1)
 }
 
+func (m *MockWorkspaceService) CreateEmailInvite(ctx context.Context, workspaceID, inviterID uuid.UUID, email string) (*models.WorkspaceInvite, error) {
+	args := m.Called(ctx, workspaceID, inviterID, email)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WorkspaceInvite), args.Error(1)
+}
+
 func (m *MockWorkspaceService) GetInviteByID(ctx context.Context, inviteID uuid.UUID) (*models.WorkspaceInvite, error) {
 	args := m.Called(ctx, inviteID)
 	if args.Get(0) == nil {
@@ -190,6 +224,14 @@ func (m *MockCollectionService) Create(ctx context.Context, workspaceID uuid.UUI
 	return args.Get(0).(*models.Collection), args.Error(1)
 }
 
+func (m *MockCollectionService) CreateAs(ctx context.Context, workspaceID uuid.UUID, name string, data json.RawMessage, actor models.Actor) (*models.Collection, error) {
+	args := m.Called(ctx, workspaceID, name, data, actor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Collection), args.Error(1)
+}
+
 func (m *MockCollectionService) GetByID(ctx context.Context, collectionID uuid.UUID) (*models.Collection, error) {
 	args := m.Called(ctx, collectionID)
 	if args.Get(0) == nil {
@@ -216,6 +258,14 @@ func (m *MockCollectionService) Delete(ctx context.Context, collectionID uuid.UU
 	return args.Error(0)
 }
 
+func (m *MockCollectionService) UpsertBatch(ctx context.Context, workspaceID uuid.UUID, upserts []services.CollectionUpsert, actor models.Actor) ([]models.Collection, error) {
+	args := m.Called(ctx, workspaceID, upserts, actor)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Collection), args.Error(1)
+}
+
 func (m *MockCollectionService) GetByWorkspaceAndName(ctx context.Context, workspaceID uuid.UUID, name string) (*models.Collection, error) {
 	args := m.Called(ctx, workspaceID, name)
 	if args.Get(0) == nil {
@@ -224,37 +274,219 @@ func (m *MockCollectionService) GetByWorkspaceAndName(ctx context.Context, works
 	return args.Get(0).(*models.Collection), args.Error(1)
 }
 
-func (m *MockCollectionService) ForceUpdate(ctx context.Context, collectionID uuid.UUID, name string, data json.RawMessage) (*models.Collection, error) {
-	args := m.Called(ctx, collectionID, name, data)
+func (m *MockCollectionService) ForceUpdate(ctx context.Context, collectionID uuid.UUID, name string, data json.RawMessage, actor models.Actor) (*models.Collection, error) {
+	args := m.Called(ctx, collectionID, name, data, actor)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
 	return args.Get(0).(*models.Collection), args.Error(1)
 }
 
+// MockPersonalAccessTokenService mocks the PersonalAccessTokenService
+type MockPersonalAccessTokenService struct {
+	mock.Mock
+}
+
+func (m *MockPersonalAccessTokenService) Create(ctx context.Context, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (*models.PersonalAccessToken, string, error) {
+	args := m.Called(ctx, userID, name, scopes, expiresAt)
+	if args.Get(0) == nil {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).(*models.PersonalAccessToken), args.String(1), args.Error(2)
+}
+
+func (m *MockPersonalAccessTokenService) Authenticate(ctx context.Context, token string) (*models.PersonalAccessToken, *models.User, error) {
+	args := m.Called(ctx, token)
+	if args.Get(0) == nil {
+		return nil, nil, args.Error(2)
+	}
+	return args.Get(0).(*models.PersonalAccessToken), args.Get(1).(*models.User), args.Error(2)
+}
+
+func (m *MockPersonalAccessTokenService) List(ctx context.Context, userID uuid.UUID) ([]models.PersonalAccessToken, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.PersonalAccessToken), args.Error(1)
+}
+
+func (m *MockPersonalAccessTokenService) Revoke(ctx context.Context, userID, tokenID uuid.UUID) error {
+	args := m.Called(ctx, userID, tokenID)
+	return args.Error(0)
+}
+
+// MockTwoFactorService mocks the TwoFactorService
+type MockTwoFactorService struct {
+	mock.Mock
+}
+
+func (m *MockTwoFactorService) BeginEnrollment(ctx context.Context, userID uuid.UUID, accountName string) (*services.TwoFactorEnrollment, error) {
+	args := m.Called(ctx, userID, accountName)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*services.TwoFactorEnrollment), args.Error(1)
+}
+
+func (m *MockTwoFactorService) ConfirmEnrollment(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	args := m.Called(ctx, userID, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockTwoFactorService) IsEnabled(ctx context.Context, userID uuid.UUID) (bool, error) {
+	args := m.Called(ctx, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTwoFactorService) Status(ctx context.Context, userID uuid.UUID) (*services.TwoFactorStatus, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*services.TwoFactorStatus), args.Error(1)
+}
+
+func (m *MockTwoFactorService) Verify(ctx context.Context, userID uuid.UUID, code string) error {
+	args := m.Called(ctx, userID, code)
+	return args.Error(0)
+}
+
+func (m *MockTwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	args := m.Called(ctx, userID, code)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockTwoFactorService) Disable(ctx context.Context, userID uuid.UUID, code string) error {
+	args := m.Called(ctx, userID, code)
+	return args.Error(0)
+}
+
+// MockAPIKeyService mocks the APIKeyService
+type MockAPIKeyService struct {
+	mock.Mock
+}
+
+func (m *MockAPIKeyService) Create(ctx context.Context, workspaceID uuid.UUID, name string, createdBy uuid.UUID, expiresAt *time.Time, restrictions services.APIKeyRestrictions) (*models.WorkspaceAPIKey, string, error) {
+	args := m.Called(ctx, workspaceID, name, createdBy, expiresAt, restrictions)
+	if args.Get(0) == nil {
+		return nil, "", args.Error(2)
+	}
+	return args.Get(0).(*models.WorkspaceAPIKey), args.String(1), args.Error(2)
+}
+
+func (m *MockAPIKeyService) Authenticate(ctx context.Context, key string) (*models.WorkspaceAPIKey, error) {
+	args := m.Called(ctx, key)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WorkspaceAPIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) List(ctx context.Context, workspaceID uuid.UUID) ([]models.WorkspaceAPIKey, error) {
+	args := m.Called(ctx, workspaceID)
+	return args.Get(0).([]models.WorkspaceAPIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) Revoke(ctx context.Context, keyID, workspaceID uuid.UUID) error {
+	args := m.Called(ctx, keyID, workspaceID)
+	return args.Error(0)
+}
+
+func (m *MockAPIKeyService) Rotate(ctx context.Context, keyID, workspaceID, rotatedBy uuid.UUID, gracePeriod time.Duration) (*services.APIKeyRotation, error) {
+	args := m.Called(ctx, keyID, workspaceID, rotatedBy, gracePeriod)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*services.APIKeyRotation), args.Error(1)
+}
+
+func (m *MockAPIKeyService) Get(ctx context.Context, keyID, workspaceID uuid.UUID) (*models.WorkspaceAPIKey, error) {
+	args := m.Called(ctx, keyID, workspaceID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WorkspaceAPIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) UpdateRateLimit(ctx context.Context, keyID, workspaceID uuid.UUID, perMinute, burst int) (*models.WorkspaceAPIKey, error) {
+	args := m.Called(ctx, keyID, workspaceID, perMinute, burst)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WorkspaceAPIKey), args.Error(1)
+}
+
+func (m *MockAPIKeyService) Usage(ctx context.Context, keyID uuid.UUID, limit int) ([]models.APIKeyUsage, error) {
+	args := m.Called(ctx, keyID, limit)
+	return args.Get(0).([]models.APIKeyUsage), args.Error(1)
+}
+
 // MockTokenService mocks the TokenService
 type MockTokenService struct {
 	mock.Mock
 }
 
-func (m *MockTokenService) StoreRefreshToken(ctx context.Context, userID uuid.UUID, tokenHash string, expiresAt time.Time) error {
-	args := m.Called(ctx, userID, tokenHash, expiresAt)
+func (m *MockTokenService) CreateSession(ctx context.Context, userID uuid.UUID, deviceName, userAgent, ipAddress string) (*models.Session, error) {
+	args := m.Called(ctx, userID, deviceName, userAgent, ipAddress)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Session), args.Error(1)
+}
+
+func (m *MockTokenService) TouchSession(ctx context.Context, sessionID uuid.UUID, userAgent, ipAddress string) error {
+	args := m.Called(ctx, sessionID, userAgent, ipAddress)
 	return args.Error(0)
 }
 
-func (m *MockTokenService) ValidateRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
+func (m *MockTokenService) ListSessions(ctx context.Context, userID uuid.UUID) ([]models.Session, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]models.Session), args.Error(1)
+}
+
+func (m *MockTokenService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockTokenService) RevokeSessionByToken(ctx context.Context, tokenHash string) (uuid.UUID, error) {
 	args := m.Called(ctx, tokenHash)
 	return args.Get(0).(uuid.UUID), args.Error(1)
 }
 
-func (m *MockTokenService) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+func (m *MockTokenService) IsSessionActive(ctx context.Context, sessionID uuid.UUID) (bool, error) {
+	args := m.Called(ctx, sessionID)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockTokenService) StoreRefreshToken(ctx context.Context, userID, sessionID uuid.UUID, tokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, sessionID, tokenHash, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockTokenService) ValidateRefreshToken(ctx context.Context, tokenHash string) (uuid.UUID, uuid.UUID, error) {
 	args := m.Called(ctx, tokenHash)
+	return args.Get(0).(uuid.UUID), args.Get(1).(uuid.UUID), args.Error(2)
+}
+
+func (m *MockTokenService) RotateRefreshToken(ctx context.Context, userID, sessionID uuid.UUID, oldTokenHash, newTokenHash string, expiresAt time.Time) error {
+	args := m.Called(ctx, userID, sessionID, oldTokenHash, newTokenHash, expiresAt)
 	return args.Error(0)
 }
 
-func (m *MockTokenService) RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) error {
+func (m *MockTokenService) RevokeAllUserTokens(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
 	args := m.Called(ctx, userID)
-	return args.Error(0)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]uuid.UUID), args.Error(1)
 }
 
 func (m *MockTokenService) CleanupExpired(ctx context.Context) error {
@@ -285,13 +517,41 @@ func (m *MockOAuthProvider) Name() string {
 	return args.String(0)
 }
 
+// MockSAMLProvider mocks a SAML service provider
+type MockSAMLProvider struct {
+	mock.Mock
+}
+
+func (m *MockSAMLProvider) Metadata() []byte {
+	args := m.Called()
+	return args.Get(0).([]byte)
+}
+
+func (m *MockSAMLProvider) AuthnRequestURL(relayState string) (string, string, error) {
+	args := m.Called(relayState)
+	return args.String(0), args.String(1), args.Error(2)
+}
+
+func (m *MockSAMLProvider) ParseResponse(ctx context.Context, encoded, requestID string) (*oauth.UserInfo, error) {
+	args := m.Called(ctx, encoded, requestID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*oauth.UserInfo), args.Error(1)
+}
+
+func (m *MockSAMLProvider) AllowIdPInitiated() bool {
+	args := m.Called()
+	return args.Bool(0)
+}
+
 // MockJWTService mocks the JWTService
 type MockJWTService struct {
 	mock.Mock
 }
 
-func (m *MockJWTService) GenerateTokenPair(userID uuid.UUID, email, globalRole string) (*services.TokenPair, error) {
-	args := m.Called(userID, email, globalRole)
+func (m *MockJWTService) GenerateTokenPair(userID, sessionID uuid.UUID, email, globalRole string) (*services.TokenPair, error) {
+	args := m.Called(userID, sessionID, email, globalRole)
 	if args.Get(0) == nil {
 		return nil, args.Error(1)
 	}
@@ -308,6 +568,11 @@ func (m *MockJWTService) RefreshExpiry() time.Duration {
 	return args.Get(0).(time.Duration)
 }
 
+func (m *MockJWTService) JWKS() services.JWKSet {
+	args := m.Called()
+	return args.Get(0).(services.JWKSet)
+}
+
 // MockHub mocks the Hub
 type MockHub struct {
 	mock.Mock
@@ -337,6 +602,18 @@ func (m *MockHub) BroadcastCollectionUpdate(workspaceID, collectionID, updatedBy
 	m.Called(workspaceID, collectionID, updatedBy, name, version)
 }
 
+func (m *MockHub) BroadcastCollectionCreateAs(workspaceID, collectionID uuid.UUID, actor models.Actor, name string, version int) {
+	m.Called(workspaceID, collectionID, actor, name, version)
+}
+
+func (m *MockHub) BroadcastCollectionUpdateAs(workspaceID, collectionID uuid.UUID, actor models.Actor, name string, version int) {
+	m.Called(workspaceID, collectionID, actor, name, version)
+}
+
+func (m *MockHub) BroadcastCollectionsBatch(workspaceID uuid.UUID, actor models.Actor, collections []hub.CollectionBatchItem) {
+	m.Called(workspaceID, actor, collections)
+}
+
 func (m *MockHub) BroadcastCollectionDelete(workspaceID, collectionID, deletedBy uuid.UUID) {
 	m.Called(workspaceID, collectionID, deletedBy)
 }
@@ -392,6 +669,19 @@ func (m *MockHub) MarkKeyReady(userID uuid.UUID, workspaceID uuid.UUID) {
 	m.Called(userID, workspaceID)
 }
 
+func (m *MockHub) TrackSession(client *hub.Client) {
+	m.Called(client)
+}
+
+func (m *MockHub) UntrackSession(client *hub.Client) {
+	m.Called(client)
+}
+
+func (m *MockHub) DisconnectSession(sessionID uuid.UUID) int {
+	args := m.Called(sessionID)
+	return args.Int(0)
+}
+
 // MockEmailService mocks the EmailService
 type MockEmailService struct {
 	mock.Mock
@@ -401,3 +691,37 @@ func (m *MockEmailService) SendWorkspaceInvite(to, workspaceName, inviterName, i
 	args := m.Called(to, workspaceName, inviterName, inviteURL)
 	return args.Error(0)
 }
+
+func (m *MockEmailService) SendWorkspaceEmailInvite(to, workspaceName, inviterName string) error {
+	args := m.Called(to, workspaceName, inviterName)
+	return args.Error(0)
+}
+
+func (m *MockEmailService) SendMagicLink(to, link string, ttl time.Duration) error {
+	args := m.Called(to, link, ttl)
+	return args.Error(0)
+}
+
+func (m *MockEmailService) SendRefreshTokenReuse(to string, detectedAt time.Time) error {
+	args := m.Called(to, detectedAt)
+	return args.Error(0)
+}
+
+// MockMagicLinkService mocks the MagicLinkService
+type MockMagicLinkService struct {
+	mock.Mock
+}
+
+func (m *MockMagicLinkService) Create(ctx context.Context, email string) (string, error) {
+	args := m.Called(ctx, email)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockMagicLinkService) Consume(ctx context.Context, token string) (string, error) {
+	args := m.Called(ctx, token)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockMagicLinkService) TTL() time.Duration {
+	return 15 * time.Minute
+}